@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+)
+
+// Attestation types, used in the summary and in the digest tag names.
+const (
+	attestationSBOM       = "sbom"
+	attestationProvenance = "provenance"
+)
+
+// attestation is a supply-chain document published with an upload and
+// linked from its summary, and so from the stored manifest.
+type attestation struct {
+	Type   string `json:"type"`
+	Source string `json:"source"`
+	Key    string `json:"key"`
+	SHA256 string `json:"sha256"`
+	size   int64
+}
+
+// loadAttestations hashes the configured attestation documents.
+func loadAttestations(cfg *config.Config) ([]attestation, error) {
+	documents := []struct{ kind, path string }{
+		{attestationSBOM, cfg.Attestations.SBOM},
+		{attestationProvenance, cfg.Attestations.Provenance},
+	}
+
+	attestations := make([]attestation, 0, len(documents))
+	for _, document := range documents {
+		if document.path == "" {
+			continue
+		}
+		info, err := os.Stat(document.path)
+		if err == nil && !info.Mode().IsRegular() {
+			err = fmt.Errorf("%s is not a regular file", document.path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("attestations.%s: %w", document.kind, err)
+		}
+		digest, err := hashAttestation(document.path)
+		if err != nil {
+			return nil, fmt.Errorf("attestations.%s: %w", document.kind, err)
+		}
+		attestations = append(attestations, attestation{
+			Type:   document.kind,
+			Source: document.path,
+			Key:    cfg.AttestationObjectKey(document.path),
+			SHA256: digest,
+			size:   info.Size(),
+		})
+	}
+	if len(attestations) == 2 && attestations[0].Key == attestations[1].Key {
+		return nil, fmt.Errorf("attestations: sbom and provenance would both be published as %s", attestations[0].Key)
+	}
+	return attestations, nil
+}
+
+func hashAttestation(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// attestationPlans returns the plans uploading the attestations themselves.
+func attestationPlans(attestations []attestation) []uploader.FilePlan {
+	plans := make([]uploader.FilePlan, 0, len(attestations))
+	for _, att := range attestations {
+		plans = append(plans, uploader.FilePlan{Source: att.Source, Key: att.Key, Size: att.size})
+	}
+	return plans
+}
+
+// attestationDigests returns the digest annotations stamped onto every
+// uploaded object, such as ds-sbom-sha256.
+func attestationDigests(attestations []attestation) map[string]string {
+	if len(attestations) == 0 {
+		return nil
+	}
+	digests := make(map[string]string, len(attestations))
+	for _, att := range attestations {
+		digests["ds-"+att.Type+"-sha256"] = att.SHA256
+	}
+	return digests
+}
+
+// streamedAttestationCheck runs checkAttestationKeys over every streamed plan
+// before next, which may be nil.
+func streamedAttestationCheck(attestations []attestation, next func(uploader.FilePlan) (bool, error)) func(uploader.FilePlan) (bool, error) {
+	if len(attestations) == 0 {
+		return next
+	}
+	return func(plan uploader.FilePlan) (bool, error) {
+		if err := checkAttestationKeys(attestations, []uploader.FilePlan{plan}); err != nil {
+			return false, err
+		}
+		if next == nil {
+			return true, nil
+		}
+		return next(plan)
+	}
+}
+
+// checkAttestationKeys rejects uploads whose files would replace a published
+// attestation.
+func checkAttestationKeys(attestations []attestation, plans []uploader.FilePlan) error {
+	for _, plan := range plans {
+		for _, att := range attestations {
+			if plan.Key == att.Key && plan.Source != att.Source {
+				return fmt.Errorf("%s would overwrite the %s attestation at %s", plan.Source, att.Type, att.Key)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+)
+
+func TestStreamedAttestationCheck(t *testing.T) {
+	attestations := []attestation{{Type: "sbom", Source: "/build/sbom.json", Key: "app/.attestations/sbom.json"}}
+	checked := 0
+	check := streamedAttestationCheck(attestations, func(uploader.FilePlan) (bool, error) {
+		checked++
+		return true, nil
+	})
+
+	if keep, err := check(uploader.FilePlan{Source: "/build/sbom.json", Key: "app/.attestations/sbom.json"}); err != nil || !keep {
+		t.Fatalf("expected the attestation itself to pass, got %v, %v", keep, err)
+	}
+	if keep, err := check(uploader.FilePlan{Source: "dist/app.bin", Key: "app/app.bin"}); err != nil || !keep {
+		t.Fatalf("expected other files to pass, got %v, %v", keep, err)
+	}
+	if _, err := check(uploader.FilePlan{Source: "dist/.attestations/sbom.json", Key: "app/.attestations/sbom.json"}); err == nil {
+		t.Fatal("expected a file at the attestation key to fail")
+	}
+	if checked != 2 {
+		t.Errorf("expected the other checks to run for the passing plans, ran %d", checked)
+	}
+
+	if check := streamedAttestationCheck(attestations, nil); check == nil {
+		t.Fatal("expected a check without other guards")
+	}
+}
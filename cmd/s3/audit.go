@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/delivery-station/ds-s3/internal/buildinfo"
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds/pkg/types"
+)
+
+// auditedOperations are the operations that write to buckets, whose runs are
+// recorded when audit.prefix is set.
+var auditedOperations = []string{"upload", "rollback", "snapshot", "promote", "batch"}
+
+// secretFlags are flags whose values audit records leave out.
+var secretFlags = []string{"mfa-token"}
+
+// auditWriteTimeout bounds storing the record of a run that was canceled,
+// which is still recorded.
+const auditWriteTimeout = 15 * time.Second
+
+// auditRecord is stored below audit.prefix after every run of an audited
+// operation, successful or not.
+type auditRecord struct {
+	Operation     string    `json:"operation"`
+	PluginVersion string    `json:"plugin_version"`
+	User          string    `json:"user,omitempty"`
+	Host          string    `json:"host,omitempty"`
+	Pipeline      string    `json:"pipeline,omitempty"`
+	RunID         string    `json:"run_id,omitempty"`
+	Commit        string    `json:"commit,omitempty"`
+	TraceID       string    `json:"trace_id,omitempty"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	Environment   string    `json:"environment,omitempty"`
+	Bucket        string    `json:"bucket"`
+	ContextPath   string    `json:"context_path"`
+	Args          []string  `json:"args"`
+	StartedAt     time.Time `json:"started_at"`
+	FinishedAt    time.Time `json:"finished_at"`
+	ExitCode      int       `json:"exit_code"`
+	Error         string    `json:"error,omitempty"`
+	// ResultDigest is the SHA-256 of the summary the run printed, to match
+	// the record with a summary kept elsewhere.
+	ResultDigest string `json:"result_digest"`
+}
+
+type auditConfigKey struct{}
+
+// auditedConfig holds the configuration an audited operation ran with: the
+// resolved settings with the flags of the run applied, which may name
+// another bucket or context path, and its run id.
+type auditedConfig struct {
+	mu  sync.Mutex
+	cfg *config.Config
+}
+
+// trackAuditConfig returns a context carrying a holder of the configuration
+// of the run, which starts out as cfg.
+func trackAuditConfig(ctx context.Context, cfg *config.Config) (context.Context, *auditedConfig) {
+	audited := &auditedConfig{cfg: cfg}
+	return context.WithValue(ctx, auditConfigKey{}, audited), audited
+}
+
+// auditConfigFrom returns the holder of the run with ctx, or nil.
+func auditConfigFrom(ctx context.Context) *auditedConfig {
+	audited, _ := ctx.Value(auditConfigKey{}).(*auditedConfig)
+	return audited
+}
+
+// use records cfg as the configuration the run writes with. Handlers call it
+// once the flags are applied; later changes to cfg, such as the run id, are
+// recorded too.
+func (a *auditedConfig) use(cfg *config.Config) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.cfg = cfg
+}
+
+func (a *auditedConfig) config() *config.Config {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.cfg
+}
+
+// newAuditRecord describes a finished run of operation with args and cfg.
+func newAuditRecord(operation, version string, args []string, cfg *config.Config, started time.Time, result *types.ExecutionResult) auditRecord {
+	info := buildinfo.FromEnv(os.LookupEnv)
+	correlation := buildinfo.CorrelationFromEnv(os.LookupEnv)
+	digest := sha256.Sum256([]byte(result.Stdout))
+	record := auditRecord{
+		Operation:     operation,
+		PluginVersion: version,
+		Pipeline:      info.Pipeline,
+		RunID:         info.RunID,
+		Commit:        info.Commit,
+		TraceID:       correlation.TraceID,
+		CorrelationID: correlation.CorrelationID,
+		Environment:   cfg.Environment,
+		Bucket:        cfg.Bucket,
+		ContextPath:   cfg.ContextPath,
+		Args:          redactArgs(args),
+		StartedAt:     started,
+		FinishedAt:    time.Now().UTC(),
+		ExitCode:      result.ExitCode,
+		Error:         result.Error,
+		ResultDigest:  "sha256:" + hex.EncodeToString(digest[:]),
+	}
+	if cfg.RunID != "" {
+		record.RunID = cfg.RunID
+	}
+	if current, err := user.Current(); err == nil {
+		record.User = current.Username
+	} else {
+		record.User = os.Getenv("USER")
+	}
+	record.Host, _ = os.Hostname()
+	return record
+}
+
+// redactArgs returns args with the values of secretFlags replaced.
+func redactArgs(args []string) []string {
+	redacted := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, _, inline := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || !slices.Contains(secretFlags, name) {
+			redacted = append(redacted, arg)
+			continue
+		}
+		if inline {
+			redacted = append(redacted, arg[:strings.IndexByte(arg, '=')+1]+config.Redacted)
+			continue
+		}
+		redacted = append(redacted, arg)
+		if i+1 < len(args) {
+			redacted = append(redacted, config.Redacted)
+			i++
+		}
+	}
+	return redacted
+}
+
+// auditKey returns a new key for a record of operation started at started:
+// records sort by date and time below the prefix.
+func auditKey(prefix, operation string, started time.Time) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("failed to generate audit record key: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s-%s.json", started.Format("20060102T150405Z"), operation, hex.EncodeToString(suffix))
+	return path.Join(prefix, started.Format("2006/01/02"), name), nil
+}
+
+// writeAudit stores the record of a finished run of operation in the audit
+// bucket and returns its key. Runs of operations that do not write, and dry
+// runs, are not recorded.
+func (p *Plugin) writeAudit(ctx context.Context, operation string, args []string, cfg *config.Config, started time.Time, result *types.ExecutionResult) (string, error) {
+	if !cfg.Audit.Enabled() || cfg.DryRun || !slices.Contains(auditedOperations, operation) {
+		return "", nil
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditWriteTimeout)
+	defer cancel()
+
+	auditCfg := cfg
+	if cfg.Audit.Bucket != "" && cfg.Audit.Bucket != cfg.Bucket {
+		auditCfg = cfg.Clone()
+		auditCfg.Bucket = cfg.Audit.Bucket
+	}
+	client, err := p.newS3Client(ctx, auditCfg)
+	if err != nil {
+		return "", err
+	}
+	transfer, err := newTransport(client, auditCfg, nil)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := auditKey(cfg.Audit.Prefix, operation, started)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(newAuditRecord(operation, p.version, args, cfg, started, result), "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	if err := transfer.WriteObject(ctx, key, data, "application/json"); err != nil {
+		return "", fmt.Errorf("failed to store audit record: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds/pkg/types"
+)
+
+func TestRedactArgs(t *testing.T) {
+	args := []string{"--bucket", "artifacts", "--mfa-token", "123456", "-mfa-token=654321", "mfa-token", "dist"}
+	want := []string{"--bucket", "artifacts", "--mfa-token", config.Redacted, "-mfa-token=" + config.Redacted, "mfa-token", "dist"}
+	if got := redactArgs(args); !slices.Equal(got, want) {
+		t.Errorf("redactArgs returned %q, want %q", got, want)
+	}
+	if got := redactArgs([]string{"--mfa-token"}); !slices.Equal(got, []string{"--mfa-token"}) {
+		t.Errorf("expected a trailing flag without value to be kept, got %q", got)
+	}
+}
+
+func TestAuditKey(t *testing.T) {
+	started := time.Date(2026, 10, 16, 9, 30, 5, 0, time.UTC)
+	key, err := auditKey("ds-audit", "upload", started)
+	if err != nil {
+		t.Fatalf("auditKey returned error: %v", err)
+	}
+	if !regexp.MustCompile(`^ds-audit/2026/10/16/20261016T093005Z-upload-[0-9a-f]{8}\.json$`).MatchString(key) {
+		t.Errorf("unexpected key %s", key)
+	}
+	other, _ := auditKey("ds-audit", "upload", started)
+	if other == key {
+		t.Error("expected records of runs started at the same time to get distinct keys")
+	}
+}
+
+func TestAuditRecordUsesConfigOfRun(t *testing.T) {
+	base := &config.Config{Bucket: "artifacts", ContextPath: "builds"}
+	ctx, audited := trackAuditConfig(context.Background(), base)
+
+	merged := base.Clone()
+	auditConfigFrom(ctx).use(merged)
+	merged.Bucket = "artifacts-eu"
+	merged.ContextPath = "releases/1.2"
+	merged.RunID = "run-7"
+
+	record := newAuditRecord("upload", "1.0.0", nil, audited.config(), time.Now(), &types.ExecutionResult{})
+	if record.Bucket != "artifacts-eu" || record.ContextPath != "releases/1.2" || record.RunID != "run-7" {
+		t.Errorf("expected the record to describe the run, got s3://%s/%s run %s", record.Bucket, record.ContextPath, record.RunID)
+	}
+}
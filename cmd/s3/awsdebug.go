@@ -0,0 +1,105 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyauth "github.com/aws/smithy-go/auth"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/delivery-station/ds-s3/internal/awsauth"
+	"github.com/delivery-station/ds-s3/internal/config"
+)
+
+// logAWSConfig logs what the SDK resolved for requests to the bucket of cfg
+// when --debug-aws-config is given: region, endpoint and addressing style as
+// the endpoint rules produce them for the bucket, the retry settings, where
+// the credentials came from and the signer. Credentials themselves are never
+// logged, and a failed resolution is logged in place of the value.
+func (p *Plugin) logAWSConfig(ctx context.Context, client *s3.Client, cfg *config.Config) {
+	options := client.Options()
+	fields := []interface{}{
+		"bucket", cfg.Bucket,
+		"backend", cfg.Backend,
+		"region", options.Region,
+		"base_endpoint", aws.ToString(options.BaseEndpoint),
+		"force_path_style", options.UsePathStyle,
+		"retry_mode", retryMode(options.Retryer),
+		"max_attempts", options.Retryer.MaxAttempts(),
+		"credentials_setting", cmp.Or(cfg.Credentials.Source, awsauth.SourceAuto),
+	}
+
+	endpoint, err := options.EndpointResolverV2.ResolveEndpoint(ctx, s3.EndpointParameters{
+		Bucket:         aws.String(cfg.Bucket),
+		Region:         aws.String(options.Region),
+		Endpoint:       options.BaseEndpoint,
+		ForcePathStyle: aws.Bool(options.UsePathStyle),
+		UseArnRegion:   aws.Bool(options.UseARNRegion),
+	})
+	if err != nil {
+		fields = append(fields, "endpoint_error", err.Error())
+	} else {
+		fields = append(fields, "endpoint", endpoint.URI.String(), "addressing", addressingStyle(endpoint.URI, aws.ToString(options.BaseEndpoint), cfg.Bucket))
+		signer, region := "aws.auth#sigv4", options.Region
+		if schemes, ok := smithyauth.GetAuthOptions(&endpoint.Properties); ok && len(schemes) > 0 {
+			signer = schemes[0].SchemeID
+			if name, ok := smithyhttp.GetSigV4SigningRegion(&schemes[0].SignerProperties); ok {
+				region = name
+			}
+			if regions, ok := smithyhttp.GetSigV4ASigningRegions(&schemes[0].SignerProperties); ok {
+				region = strings.Join(regions, ",")
+			}
+		}
+		fields = append(fields, "signer", signer, "signing_region", region)
+	}
+
+	if options.Credentials == nil {
+		fields = append(fields, "credentials", "anonymous")
+	} else if creds, err := options.Credentials.Retrieve(ctx); err != nil {
+		fields = append(fields, "credentials_error", err.Error())
+	} else {
+		fields = append(fields, "credentials", creds.Source)
+		if creds.CanExpire {
+			fields = append(fields, "credentials_expiry", creds.Expires)
+		}
+	}
+
+	p.logger.Info("Effective AWS config", fields...)
+}
+
+// addressingStyle reports whether the endpoint addresses the bucket in its
+// path or, as it does by default, in its host name. A custom endpoint may
+// carry a path of its own, such as a gateway serving S3 below /s3, which
+// precedes the bucket.
+func addressingStyle(endpoint url.URL, base, bucket string) string {
+	path := endpoint.Path
+	if parsed, err := url.Parse(base); err == nil {
+		path = strings.TrimPrefix(path, strings.TrimSuffix(parsed.Path, "/"))
+	}
+	first, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if bucket != "" && first == bucket {
+		return "path"
+	}
+	return "virtual-hosted"
+}
+
+// retryMode names the retry mode of the retryer of a client, as the SDK
+// names the retry_mode setting.
+func retryMode(retryer aws.Retryer) string {
+	switch retryer := retryer.(type) {
+	case redirectRetryer:
+		return retryMode(retryer.RetryerV2)
+	case nil, aws.NopRetryer:
+		return "off"
+	case *retry.AdaptiveMode:
+		return string(aws.RetryModeAdaptive)
+	case *retry.Standard:
+		return string(aws.RetryModeStandard)
+	}
+	return fmt.Sprintf("%T", retryer)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestLogAWSConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoint  string
+		pathStyle bool
+		retry     config.Retry
+		want      []string
+	}{
+		{
+			name:      "path style below a gateway path",
+			endpoint:  "http://minio.internal:9000/s3",
+			pathStyle: true,
+			want:      []string{`"addressing":"path"`, `"endpoint":"http://minio.internal:9000/s3/artifacts"`, `"retry_mode":"standard"`, `"max_attempts":3`},
+		},
+		{
+			name:     "virtual hosted",
+			endpoint: "http://minio.internal:9000",
+			retry:    config.Retry{MaxAttempts: 5},
+			want:     []string{`"addressing":"virtual-hosted"`, `"endpoint":"http://artifacts.minio.internal:9000"`, `"retry_mode":"standard"`, `"max_attempts":5`},
+		},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		plugin := NewPlugin(newLogOutput(&out, hclog.Info), "1.0.0", "", "")
+		cfg := &config.Config{
+			Bucket:         "artifacts",
+			Region:         "us-east-1",
+			Endpoint:       tt.endpoint,
+			ForcePathStyle: tt.pathStyle,
+			Retry:          tt.retry,
+			Credentials:    config.Credentials{AccessKeyID: "key", SecretAccessKey: "secret"},
+			DebugAWSConfig: true,
+		}
+		if _, err := plugin.newS3Client(context.Background(), cfg); err != nil {
+			t.Fatalf("%s: newS3Client returned error: %v", tt.name, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("%s: expected %s in %s", tt.name, want, out.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	"github.com/delivery-station/ds-s3/internal/batchops"
+	"github.com/delivery-station/ds-s3/internal/buildinfo"
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/delivery-station/ds/pkg/types"
+)
+
+// Batch actions.
+const (
+	batchCopy   = "copy"
+	batchDelete = "delete"
+	batchStatus = "status"
+)
+
+// handleBatch copies or deletes every object under the context path with an
+// S3 Batch Operations job instead of a request per object, or reports the
+// status of an earlier job.
+func (p *Plugin) handleBatch(ctx context.Context, baseCfg *config.Config, args types.PluginArgs) (*types.ExecutionResult, error) {
+	if help, ok := args.BoolAny("help", "h"); ok && help {
+		return &types.ExecutionResult{Stdout: batchUsage(), ExitCode: 0}, nil
+	}
+
+	merged := baseCfg.Clone()
+	auditConfigFrom(ctx).use(merged)
+	applyTargetOverrides(merged, args)
+	if contextPath, ok := args.FirstAny("context", "context-path"); ok && strings.TrimSpace(contextPath) != "" {
+		merged.ContextPath = strings.Trim(strings.TrimSpace(contextPath), "/")
+	}
+	if role, ok := args.First("role-arn"); ok && strings.TrimSpace(role) != "" {
+		merged.Batch.RoleARN = strings.TrimSpace(role)
+	}
+
+	positionals := args.Positionals()
+	if len(positionals) != 1 {
+		err := fmt.Errorf("batch takes one action: copy, delete or status")
+		return &types.ExecutionResult{ExitCode: 1, Stderr: batchUsage(), Error: err.Error()}, nil
+	}
+	action := strings.TrimSpace(positionals[0])
+
+	targetName, _ := args.First("target")
+	cfg, err := merged.ForTarget(targetName)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	if err := cfg.Validate(); err != nil {
+		return configFailure(ctx, err), nil
+	}
+
+	switch action {
+	case batchStatus:
+		jobID, _ := args.First("job-id")
+		if strings.TrimSpace(jobID) == "" {
+			return &types.ExecutionResult{ExitCode: 1, Error: "--job-id is required"}, nil
+		}
+		return p.batchJobStatus(ctx, cfg, strings.TrimSpace(jobID))
+	case batchCopy, batchDelete:
+	default:
+		return &types.ExecutionResult{ExitCode: 1, Stderr: batchUsage(), Error: fmt.Sprintf("unknown batch action %q", action)}, nil
+	}
+
+	if cfg.Batch.RoleARN == "" {
+		return configFailure(ctx, fmt.Errorf("batch.role_arn (or --role-arn) is required to submit batch jobs")), nil
+	}
+	selector, err := selectorArgs(cfg, args)
+	if err != nil {
+		return configFailure(ctx, err), nil
+	}
+	summary := batchSummary{Action: action, Bucket: cfg.Bucket, ContextPath: cfg.ContextPath, Filter: selector}
+	switch action {
+	case batchCopy:
+		toBucket, _ := args.First("to-bucket")
+		toPrefix, _ := args.First("to-prefix")
+		summary.ToBucket = strings.TrimSpace(toBucket)
+		summary.ToPrefix = strings.Trim(strings.TrimSpace(toPrefix), "/")
+		if summary.ToBucket == "" {
+			summary.ToBucket = cfg.Bucket
+		}
+		if summary.ToBucket == cfg.Bucket && summary.ToPrefix == "" {
+			return &types.ExecutionResult{ExitCode: 1, Error: "batch copy needs --to-bucket or --to-prefix, otherwise it copies every object onto itself"}, nil
+		}
+	case batchDelete:
+		if cfg.Batch.DeleteFunctionARN == "" {
+			return configFailure(ctx, fmt.Errorf("batch.delete_function_arn is required for batch deletes, as S3 Batch Operations has no delete of its own")), nil
+		}
+		if cfg.ContextPath == "" {
+			return &types.ExecutionResult{ExitCode: 1, Error: "batch delete requires a context path, it does not delete a whole bucket"}, nil
+		}
+	}
+	// S3 Batch Operations writes the copies and the completion report itself,
+	// past the checks of the transport.
+	written := cfg.ContextPath
+	if action == batchCopy {
+		written = path.Join(summary.ToPrefix, cfg.ContextPath)
+	}
+	if err := checkAllowedPrefixes(cfg, written, cfg.Batch.Prefix); err != nil {
+		return configFailure(ctx, err), nil
+	}
+
+	accountID, err := batchops.AccountID(cfg.Batch.AccountID, cfg.Batch.RoleARN)
+	if err != nil {
+		return configFailure(ctx, err), nil
+	}
+	runID, _, err := resolveRunID(cfg)
+	if err != nil {
+		return configFailure(ctx, err), nil
+	}
+
+	client, err := p.newS3Client(ctx, cfg)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	transfer, err := newTransport(client, cfg, nil)
+	if err != nil {
+		return configFailure(ctx, err), nil
+	}
+	control, err := p.newS3ControlClient(ctx, cfg)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	if selector != nil {
+		transfer.SetSelector(*selector)
+	}
+
+	listing, err := transfer.List(ctx, cfg.ContextPath, "")
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	keys := make([]string, 0, len(listing.Objects))
+	oversized := 0
+	for _, object := range listing.Objects {
+		// Leave out the manifests and reports of earlier jobs.
+		if object.Key == cfg.Batch.Prefix || strings.HasPrefix(object.Key, cfg.Batch.Prefix+"/") {
+			continue
+		}
+		if object.Size > batchops.MaxCopySize {
+			oversized++
+		}
+		keys = append(keys, object.Key)
+	}
+	if len(keys) == 0 {
+		return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("no objects under %q to %s", cfg.ContextPath, action)}, nil
+	}
+	if action == batchCopy && oversized > 0 {
+		p.logger.Warn("Batch copies fail for objects above 5GiB; they will be listed in the completion report", "objects", oversized)
+	}
+	summary.Objects = len(keys)
+
+	summary.Manifest = cfg.Batch.Prefix + "/" + runID + "-" + action + "/manifest.csv"
+	if cfg.DryRun {
+		p.logger.Info("Dry run, not submitting the batch job", "action", action, "objects", len(keys))
+		summary.DryRun = true
+		return batchResult(summary)
+	}
+	if action == batchDelete {
+		if err := confirm(args, cfg, fmt.Sprintf("Delete the %d objects below s3://%s/%s with a batch job", len(keys), cfg.Bucket, cfg.ContextPath)); err != nil {
+			return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+		}
+	}
+	if err := transfer.WriteObject(ctx, summary.Manifest, batchops.Manifest(cfg.Bucket, keys), "text/csv"); err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(cfg.Bucket), Key: aws.String(summary.Manifest)})
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("failed to read the ETag of the batch manifest: %v", err)}, nil
+	}
+
+	job := batchops.Job{
+		AccountID:      accountID,
+		RoleARN:        cfg.Batch.RoleARN,
+		Priority:       int32(cfg.Batch.Priority),
+		Token:          runID + "-" + action,
+		Description:    fmt.Sprintf("ds-s3 %s of s3://%s/%s", action, cfg.Bucket, cfg.ContextPath),
+		ManifestBucket: cfg.Bucket,
+		ManifestKey:    summary.Manifest,
+		ManifestETag:   aws.ToString(head.ETag),
+		ReportBucket:   cfg.Bucket,
+		ReportPrefix:   cfg.Batch.Prefix + "/" + runID + "-" + action,
+	}
+	if action == batchCopy {
+		job.Operation = batchops.CopyOperation(batchops.BucketARN(summary.ToBucket, cfg.Batch.RoleARN), summary.ToPrefix)
+	} else {
+		job.Operation = batchops.DeleteOperation(cfg.Batch.DeleteFunctionARN)
+	}
+	jobID, err := batchops.Submit(ctx, control, job)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	p.logger.Info("Submitted batch job", "job_id", jobID, "action", action, "objects", len(keys), "manifest", summary.Manifest)
+
+	summary.Job = batchops.Status{JobID: jobID}
+	if wait, ok := args.Bool("wait"); !ok || wait {
+		interval := cfg.Batch.PollInterval
+		if interval <= 0 {
+			interval = config.DefaultBatchPollInterval
+		}
+		summary.Job, err = batchops.Wait(ctx, control, accountID, jobID, interval, func(status batchops.Status) {
+			p.logger.Info("Batch job progress", "job_id", jobID, "status", status.Status, "succeeded", status.Succeeded, "failed", status.Failed, "total", status.Total)
+		})
+		if err != nil {
+			return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("%v; the job keeps running, follow it with batch status --job-id %s", err, jobID)}, nil
+		}
+	}
+	return batchResult(summary)
+}
+
+// batchJobStatus reports the status of the job with the id jobID.
+func (p *Plugin) batchJobStatus(ctx context.Context, cfg *config.Config, jobID string) (*types.ExecutionResult, error) {
+	accountID, err := batchops.AccountID(cfg.Batch.AccountID, cfg.Batch.RoleARN)
+	if err != nil {
+		return configFailure(ctx, err), nil
+	}
+	control, err := p.newS3ControlClient(ctx, cfg)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	status, err := batchops.Describe(ctx, control, accountID, jobID)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	return batchResult(batchSummary{Action: batchStatus, Bucket: cfg.Bucket, Job: status})
+}
+
+// batchResult prints summary, failing when the job finished without
+// completing every task.
+func batchResult(summary batchSummary) (*types.ExecutionResult, error) {
+	payload, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("failed to encode execution summary: %v", err)}, nil
+	}
+	result := &types.ExecutionResult{Stdout: string(payload) + "\n", ExitCode: 0}
+	if job := summary.Job; job.Done() && (job.Status != "Complete" || job.Failed > 0) {
+		result.ExitCode = 1
+		result.Error = fmt.Sprintf("batch job %s ended %s with %d of %d tasks failed", job.JobID, job.Status, job.Failed, job.Total)
+		if job.Report != "" {
+			result.Error += "; the failed objects are listed in the completion report at " + job.Report
+		}
+	}
+	return result, nil
+}
+
+// newS3ControlClient returns an S3 Control client for the account APIs, such
+// as Batch Operations, in the region of cfg.
+func (p *Plugin) newS3ControlClient(ctx context.Context, cfg *config.Config) (*s3control.Client, error) {
+	awsCfg, err := p.awsConfig(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure AWS SDK: %w", err)
+	}
+	return s3control.NewFromConfig(awsCfg, func(o *s3control.Options) {
+		o.APIOptions = append(o.APIOptions, requestDecorations(cfg, buildinfo.CorrelationFromEnv(os.LookupEnv))...)
+		if failures := failuresFrom(ctx); failures != nil {
+			o.APIOptions = append(o.APIOptions, failures.recorder.Middleware())
+		}
+	}), nil
+}
+
+func batchUsage() string {
+	return `Usage: ds s3 batch <copy|delete|status> [flags]
+
+Copies or deletes every object under the context path with an S3 Batch
+Operations job: the objects are listed into a CSV manifest written below
+batch.prefix, a job is submitted with batch.role_arn, and its status is
+polled every batch.poll_interval until it finishes. Objects that failed are
+listed in the job's completion report, next to the manifest. --filter-tag and
+--filter-metadata put only the objects carrying the given tags and user
+metadata into the manifest.
+
+  copy      Copy to --to-bucket, at the source key below --to-prefix
+  delete    Invoke batch.delete_function_arn on every object to delete it
+  status    Report the status of the job --job-id
+
+Flags:
+  --context <prefix>         Object prefix/context path to copy or delete
+  --to-bucket <name>         (copy) Destination bucket (defaults to the source bucket)
+  --to-prefix <prefix>       (copy) Prefix prepended to every source key
+  --filter-tag <key=value>   Only act on objects carrying this tag (repeatable)
+  --filter-metadata <key=value>  Only act on objects with this user metadata (repeatable)
+  --job-id <id>              (status) Job to report on
+  --wait                     Wait for the submitted job to finish (default true)
+  --yes                      (delete) Do not ask for confirmation on the terminal
+  --role-arn <arn>           Role S3 assumes to run the job (defaults to batch.role_arn)
+  --target <name>            Use a named target from configuration
+  --bucket <name>            Override the bucket (defaults to configuration)
+  --region <name>            Override AWS region
+  --profile <name>           Shared AWS profile to use
+  --mfa-token <code>         MFA code for credentials.mfa_serial (or $DS_S3_MFA_TOKEN)
+  --debug-aws-config         Log the resolved region, endpoint, addressing, retries, credential source and signer
+`
+}
+
+type batchSummary struct {
+	Action      string             `json:"action"`
+	Bucket      string             `json:"bucket"`
+	ContextPath string             `json:"context_path,omitempty"`
+	ToBucket    string             `json:"to_bucket,omitempty"`
+	ToPrefix    string             `json:"to_prefix,omitempty"`
+	Filter      *uploader.Selector `json:"filter,omitempty"`
+	Objects     int                `json:"objects,omitempty"`
+	Manifest    string             `json:"manifest,omitempty"`
+	Job         batchops.Status    `json:"job"`
+	DryRun      bool               `json:"dry_run,omitempty"`
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/delivery-station/ds-s3/internal/bench"
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/delivery-station/ds/pkg/types"
+)
+
+const (
+	defaultBenchSizes       = "1MiB,16MiB"
+	defaultBenchCount       = 8
+	defaultBenchConcurrency = 4
+	benchPrefix             = ".ds-s3-bench"
+)
+
+func (p *Plugin) handleBench(ctx context.Context, baseCfg *config.Config, args types.PluginArgs) (*types.ExecutionResult, error) {
+	if help, ok := args.BoolAny("help", "h"); ok && help {
+		return &types.ExecutionResult{Stdout: benchUsage(), ExitCode: 0}, nil
+	}
+
+	merged := baseCfg.Clone()
+	applyTargetOverrides(merged, args)
+	if contextPath, ok := args.FirstAny("context", "context-path"); ok && strings.TrimSpace(contextPath) != "" {
+		merged.ContextPath = strings.Trim(strings.TrimSpace(contextPath), "/")
+	}
+	if err := applyMultipartOverrides(merged, args); err != nil {
+		return configFailure(ctx, err), nil
+	}
+
+	targetName, _ := args.First("target")
+	targetCfg, err := merged.ForTarget(targetName)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	if err := targetCfg.Validate(); err != nil {
+		return configFailure(ctx, err), nil
+	}
+
+	opts, err := benchOptions(targetCfg, args)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Stderr: benchUsage(), Error: err.Error()}, nil
+	}
+
+	if err := checkAllowedPrefixes(targetCfg, opts.Prefix); err != nil {
+		return configFailure(ctx, err), nil
+	}
+
+	client, err := p.newS3Client(ctx, targetCfg)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+
+	partSize := targetCfg.EffectivePartSize()
+	partConcurrency := targetCfg.EffectiveConcurrency()
+	upload := manager.NewUploader(uploader.AbortDetached(client), func(u *manager.Uploader) {
+		u.PartSize = partSize
+		u.Concurrency = partConcurrency
+	})
+
+	// The benchmark writes and deletes its own objects, so a dry run skips it.
+	var report *bench.Report
+	if targetCfg.DryRun {
+		p.logger.Info("Dry run, skipping the benchmark", "bucket", targetCfg.Bucket, "prefix", opts.Prefix)
+	} else {
+		p.logger.Info("Starting benchmark", "bucket", targetCfg.Bucket, "prefix", opts.Prefix, "sizes", len(opts.Sizes), "count", opts.Count, "concurrency", opts.Concurrency)
+		if report, err = bench.Run(ctx, client, upload, opts); err != nil {
+			return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("benchmark failed: %v", err)}, nil
+		}
+	}
+
+	summary := benchSummary{
+		Target:          targetName,
+		Bucket:          targetCfg.Bucket,
+		Endpoint:        targetCfg.Endpoint,
+		PartSize:        partSize,
+		PartConcurrency: partConcurrency,
+		Report:          report,
+		DryRun:          targetCfg.DryRun,
+	}
+
+	payload, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("failed to encode execution summary: %v", err)}, nil
+	}
+
+	return &types.ExecutionResult{
+		Stdout:   string(payload) + "\n",
+		ExitCode: 0,
+	}, nil
+}
+
+// benchOptions resolves the benchmark flags against the target configuration.
+func benchOptions(cfg *config.Config, args types.PluginArgs) (bench.Options, error) {
+	opts := bench.Options{
+		Bucket:      cfg.Bucket,
+		Count:       defaultBenchCount,
+		Concurrency: defaultBenchConcurrency,
+	}
+	if cfg.Concurrency > 0 {
+		opts.Concurrency = cfg.Concurrency
+	}
+
+	sizes := defaultBenchSizes
+	if value, ok := args.First("sizes"); ok && strings.TrimSpace(value) != "" {
+		sizes = value
+	}
+	for _, raw := range strings.Split(sizes, ",") {
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		size, err := config.ParseByteSize(raw)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --sizes: %w", err)
+		}
+		if size <= 0 {
+			return opts, fmt.Errorf("invalid --sizes: %q must be positive", strings.TrimSpace(raw))
+		}
+		opts.Sizes = append(opts.Sizes, size)
+	}
+
+	if value, ok := args.First("count"); ok && strings.TrimSpace(value) != "" {
+		count, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || count < 1 {
+			return opts, fmt.Errorf("invalid --count %q: must be a positive integer", value)
+		}
+		opts.Count = count
+	}
+	if value, ok := args.First("concurrency"); ok && strings.TrimSpace(value) != "" {
+		concurrency, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || concurrency < 1 {
+			return opts, fmt.Errorf("invalid --concurrency %q: must be a positive integer", value)
+		}
+		opts.Concurrency = concurrency
+	}
+	if keep, ok := args.Bool("keep"); ok {
+		opts.Keep = keep
+	}
+
+	prefix := path.Join(benchPrefix, time.Now().UTC().Format(uploader.SnapshotTimeFormat))
+	if value, ok := args.First("prefix"); ok && strings.Trim(strings.TrimSpace(value), "/") != "" {
+		prefix = strings.Trim(strings.TrimSpace(value), "/")
+	}
+	if cfg.ContextPath != "" {
+		prefix = path.Join(cfg.ContextPath, prefix)
+	}
+	opts.Prefix = prefix
+
+	return opts, nil
+}
+
+func benchUsage() string {
+	return `Usage: ds s3 bench [flags]
+
+Uploads and downloads synthetic objects against the target endpoint and
+reports latency percentiles and throughput per object size. Use it to tune
+multipart and concurrency settings for each environment.
+
+Flags:
+  --target <name>            Named target from configuration to benchmark
+  --sizes <list>             Comma-separated object sizes (default "1MiB,16MiB")
+  --count <n>                Objects per size (default 8)
+  --concurrency <n>          Parallel transfers (default 4 or configured concurrency)
+  --prefix <prefix>          Prefix for synthetic objects (default ".ds-s3-bench/<timestamp>")
+  --keep                     Keep the synthetic objects after the run
+  --part-size <size>         Multipart part size to benchmark
+  --part-concurrency <n>     Parts uploaded in parallel per object
+  --bucket <name>            Override target bucket (defaults to configuration)
+  --region <name>            Override AWS region
+  --context <prefix>         Object prefix/context path for the synthetic objects
+  --endpoint <url>           Use a custom S3-compatible endpoint
+  --force-path-style         Force path-style addressing
+  --skip-tls-verify          Disable TLS verification (requires --endpoint)
+  --profile <name>           Shared AWS profile to use
+  --mfa-token <code>         MFA code for credentials.mfa_serial (or $DS_S3_MFA_TOKEN)
+  --debug-aws-config         Log the resolved region, endpoint, addressing, retries, credential source and signer
+`
+}
+
+type benchSummary struct {
+	Target          string        `json:"target,omitempty"`
+	Bucket          string        `json:"bucket"`
+	Endpoint        string        `json:"endpoint,omitempty"`
+	PartSize        int64         `json:"part_size"`
+	PartConcurrency int           `json:"part_concurrency"`
+	Report          *bench.Report `json:"report"`
+	DryRun          bool          `json:"dry_run,omitempty"`
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/delivery-station/ds-s3/internal/config"
+)
+
+// awsConfigKey identifies the settings an AWS configuration is built from.
+// Operations resolving the same key share one configuration, and with it the
+// HTTP client's idle connections and the credentials cache.
+type awsConfigKey struct {
+	endpoint      string
+	region        string
+	profile       string
+	credentials   string
+	http          config.HTTP
+	skipTLSVerify bool
+	dnsPin        string
+	retry         config.Retry
+}
+
+// newAWSConfigKey returns the key of the AWS configuration cfg resolves to.
+// Credentials are only kept as a fingerprint.
+func newAWSConfigKey(cfg *config.Config) awsConfigKey {
+	creds := cfg.Credentials
+	fingerprint := sha256.Sum256([]byte(strings.Join([]string{
+		creds.Source,
+		creds.AccessKeyID,
+		creds.SecretAccessKey,
+		creds.SessionToken,
+		creds.RoleARN,
+		creds.RoleSessionName,
+		creds.ExternalID,
+		creds.RoleDuration.String(),
+		// The MFA token is left out: it is only needed to assume the role,
+		// and the cached credentials outlive it.
+		creds.MFASerial,
+	}, "\x00")))
+	return awsConfigKey{
+		endpoint:      cfg.Endpoint,
+		region:        cfg.Region,
+		profile:       cfg.Profile,
+		credentials:   hex.EncodeToString(fingerprint[:]),
+		http:          cfg.HTTP,
+		skipTLSVerify: cfg.SkipTLSVerify,
+		dnsPin:        fmt.Sprintf("%q", cfg.DNS.Pin),
+		retry:         cfg.Retry,
+	}
+}
+
+// awsConfigCache keeps the AWS configurations built in this plugin process,
+// so that operations run one after another in a long-lived session reuse warm
+// connections and credentials instead of resolving them again. Clients are
+// still built per operation, as they carry the operation's middleware.
+type awsConfigCache struct {
+	mu      sync.Mutex
+	configs map[awsConfigKey]aws.Config
+}
+
+func (c *awsConfigCache) get(key awsConfigKey) (aws.Config, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	awsCfg, ok := c.configs[key]
+	return awsCfg, ok
+}
+
+// put stores awsCfg under key and returns the configuration cached for key,
+// which is an earlier one when a concurrent operation built it first.
+func (c *awsConfigCache) put(key awsConfigKey, awsCfg aws.Config) aws.Config {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.configs[key]; ok {
+		return cached
+	}
+	if c.configs == nil {
+		c.configs = make(map[awsConfigKey]aws.Config)
+	}
+	c.configs[key] = awsCfg
+	return awsCfg
+}
+
+// reset drops every cached configuration, so that the next operation reads
+// the shared AWS config files and the environment again.
+func (c *awsConfigCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.configs = nil
+}
+
+// awsConfig returns the AWS configuration for cfg, built by buildAWSConfig
+// unless an earlier operation of this process already built it. With
+// dns.cache the endpoint host is resolved once per operation, so the
+// configuration is not shared.
+func (p *Plugin) awsConfig(ctx context.Context, cfg *config.Config) (aws.Config, error) {
+	if cfg.DNS.Cache {
+		return p.buildAWSConfig(ctx, cfg)
+	}
+	key := newAWSConfigKey(cfg)
+	if awsCfg, ok := p.awsConfigs.get(key); ok {
+		p.logger.Debug("Reusing the AWS configuration of an earlier operation", "region", awsCfg.Region)
+		return awsCfg, nil
+	}
+	awsCfg, err := p.buildAWSConfig(ctx, cfg)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	return p.awsConfigs.put(key, awsCfg), nil
+}
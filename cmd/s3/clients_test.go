@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/delivery-station/ds-s3/internal/config"
+)
+
+func TestAWSConfigKey(t *testing.T) {
+	base := &config.Config{Region: "eu-west-1", Endpoint: "https://s3.example.com"}
+	base.Credentials.AccessKeyID = "AKIAEXAMPLE"
+	base.Credentials.SecretAccessKey = "secret-one"
+
+	same := base.Clone()
+	same.Bucket = "other-bucket"
+	same.Credentials.MFAToken = "123456"
+	if newAWSConfigKey(base) != newAWSConfigKey(same) {
+		t.Error("expected settings unrelated to the AWS configuration, and the MFA token, to share a key")
+	}
+
+	for name, change := range map[string]func(*config.Config){
+		"region":     func(c *config.Config) { c.Region = "us-east-1" },
+		"endpoint":   func(c *config.Config) { c.Endpoint = "https://minio.example.com" },
+		"secret":     func(c *config.Config) { c.Credentials.SecretAccessKey = "secret-two" },
+		"role":       func(c *config.Config) { c.Credentials.RoleARN = "arn:aws:iam::123456789012:role/deploy" },
+		"retries":    func(c *config.Config) { c.Retry.MaxAttempts++ },
+		"tls verify": func(c *config.Config) { c.SkipTLSVerify = true },
+	} {
+		changed := base.Clone()
+		change(changed)
+		if newAWSConfigKey(base) == newAWSConfigKey(changed) {
+			t.Errorf("expected a different %s to get another key", name)
+		}
+	}
+
+	if key := fmt.Sprintf("%+v", newAWSConfigKey(base)); strings.Contains(key, "secret-one") {
+		t.Errorf("expected the key to hold only a fingerprint of the credentials, got %s", key)
+	}
+}
+
+func TestAWSConfigCache(t *testing.T) {
+	var cache awsConfigCache
+	key := newAWSConfigKey(&config.Config{Region: "eu-west-1"})
+	if _, ok := cache.get(key); ok {
+		t.Fatal("expected an empty cache")
+	}
+	if got := cache.put(key, aws.Config{Region: "first"}); got.Region != "first" {
+		t.Errorf("expected the first configuration to be stored, got %s", got.Region)
+	}
+	if got := cache.put(key, aws.Config{Region: "second"}); got.Region != "first" {
+		t.Errorf("expected a concurrent build to get the cached configuration, got %s", got.Region)
+	}
+	cache.reset()
+	if _, ok := cache.get(key); ok {
+		t.Error("expected reset to drop the cached configurations")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds/pkg/types"
+)
+
+// openTerminal opens the controlling terminal destructive operations are
+// confirmed on. DS owns the standard streams of the plugin, but like the MFA
+// prompt the terminal of an interactive session is still reachable.
+var openTerminal = func() (io.ReadWriteCloser, error) {
+	return os.OpenFile("/dev/tty", os.O_RDWR, 0)
+}
+
+// confirm asks on the terminal whether to go ahead with action, such as
+// wiping a prefix, before the operation writes anything. --yes and dry runs
+// skip the question, and so does a run without a terminal, such as a CI job,
+// which goes ahead as before. Any answer but yes refuses the operation.
+func confirm(args types.PluginArgs, cfg *config.Config, action string) error {
+	if yes, ok := args.Bool("yes"); (ok && yes) || cfg.DryRun {
+		return nil
+	}
+	tty, err := openTerminal()
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = tty.Close() }()
+
+	if _, err := fmt.Fprintf(tty, "%s? [y/N] ", action); err != nil {
+		return fmt.Errorf("failed to ask for confirmation: %w", err)
+	}
+	line, _ := bufio.NewReader(tty).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return nil
+	}
+	return fmt.Errorf("%s was not confirmed; pass --yes to skip the question", strings.ToLower(action[:1])+action[1:])
+}
+
+// cleanupAction describes the prefixes a cleaning upload to cfg deletes.
+func cleanupAction(cfg *config.Config) string {
+	action := fmt.Sprintf("Delete every object below s3://%s/%s before uploading", cfg.Bucket, cfg.ContextPath)
+	if replicas := len(cfg.Replication.Targets); replicas > 0 {
+		action += fmt.Sprintf(" and below the context paths of %d replica targets", replicas)
+	}
+	return action
+}
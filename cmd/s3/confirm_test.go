@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds/pkg/types"
+	"github.com/hashicorp/go-hclog"
+)
+
+// fakeTerminal answers a prompt with input and records what was asked.
+type fakeTerminal struct {
+	io.Reader
+	asked bytes.Buffer
+}
+
+func (f *fakeTerminal) Write(p []byte) (int, error) { return f.asked.Write(p) }
+func (f *fakeTerminal) Close() error                { return nil }
+
+func withTerminal(t *testing.T, input string) *fakeTerminal {
+	t.Helper()
+	terminal := &fakeTerminal{Reader: strings.NewReader(input)}
+	previous := openTerminal
+	openTerminal = func() (io.ReadWriteCloser, error) { return terminal, nil }
+	t.Cleanup(func() { openTerminal = previous })
+	return terminal
+}
+
+func TestConfirm(t *testing.T) {
+	cfg := &config.Config{Bucket: "artifacts", ContextPath: "latest"}
+	action := cleanupAction(cfg)
+
+	terminal := withTerminal(t, "y\n")
+	if err := confirm(types.NewPluginArgs(nil), cfg, action); err != nil {
+		t.Errorf("expected yes to confirm, got %v", err)
+	}
+	if !strings.Contains(terminal.asked.String(), "s3://artifacts/latest") {
+		t.Errorf("expected the prompt to name the prefix, got %q", terminal.asked.String())
+	}
+
+	for _, answer := range []string{"\n", "n\n", ""} {
+		withTerminal(t, answer)
+		if err := confirm(types.NewPluginArgs(nil), cfg, action); err == nil || !strings.Contains(err.Error(), "--yes") {
+			t.Errorf("expected answer %q to refuse the operation, got %v", answer, err)
+		}
+	}
+
+	terminal = withTerminal(t, "n\n")
+	if err := confirm(types.NewPluginArgs([]string{"yes=true"}), cfg, action); err != nil || terminal.asked.Len() > 0 {
+		t.Errorf("expected --yes to skip the question, got %v", err)
+	}
+	dryRun := &config.Config{Bucket: "artifacts", DryRun: true}
+	if err := confirm(types.NewPluginArgs(nil), dryRun, action); err != nil || terminal.asked.Len() > 0 {
+		t.Errorf("expected a dry run to skip the question, got %v", err)
+	}
+
+	previous := openTerminal
+	openTerminal = func() (io.ReadWriteCloser, error) { return nil, errors.New("no terminal") }
+	defer func() { openTerminal = previous }()
+	if err := confirm(types.NewPluginArgs(nil), cfg, action); err != nil {
+		t.Errorf("expected runs without a terminal to go ahead, got %v", err)
+	}
+}
+
+func TestBatchDeleteIsConfirmed(t *testing.T) {
+	var writes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writes = append(writes, r.Method+" "+r.URL.Path)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`<ListBucketResult><Name>artifacts</Name><IsTruncated>false</IsTruncated>` +
+			`<Contents><Key>nightly/app.js</Key><Size>3</Size></Contents></ListBucketResult>`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		Bucket:         "artifacts",
+		Region:         "us-east-1",
+		Endpoint:       server.URL,
+		ForcePathStyle: true,
+		Credentials:    config.Credentials{AccessKeyID: "key", SecretAccessKey: "secret"},
+		Batch: config.Batch{
+			RoleARN:           "arn:aws:iam::123456789012:role/batch",
+			DeleteFunctionARN: "arn:aws:lambda:us-east-1:123456789012:function:delete",
+			Prefix:            ".ds-batch",
+		},
+	}
+	plugin := NewPlugin(newLogOutput(io.Discard, hclog.Error), "1.0.0", "", "")
+	terminal := withTerminal(t, "n\n")
+
+	result, err := plugin.handleBatch(context.Background(), cfg, types.NewPluginArgs([]string{"arg0=delete", "context=nightly"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ExitCode == 0 || !strings.Contains(result.Error, "not confirmed") {
+		t.Errorf("expected the refused delete to fail, got %+v", result)
+	}
+	if !strings.Contains(terminal.asked.String(), "s3://artifacts/nightly") {
+		t.Errorf("expected the prompt to name the prefix, got %q", terminal.asked.String())
+	}
+	if len(writes) > 0 {
+		t.Errorf("expected nothing to be written before the delete is confirmed, got %v", writes)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/delivery-station/ds/pkg/types"
+)
+
+// previousManifestSuffix is appended to the manifest key to keep the manifest
+// of the run before the latest one.
+const previousManifestSuffix = ".previous"
+
+// storeManifest writes the upload summary to the manifest key and keeps the
+// manifest of the previous run, read before cleanup, next to it for diff.
+func storeManifest(ctx context.Context, transfer *uploader.Transport, key string, previous, current []byte) error {
+	if previous != nil {
+		if err := transfer.WriteObject(ctx, key+previousManifestSuffix, previous, "application/json"); err != nil {
+			return fmt.Errorf("failed to keep previous manifest: %w", err)
+		}
+	}
+	if err := transfer.WriteObject(ctx, key, current, "application/json"); err != nil {
+		return fmt.Errorf("failed to store manifest: %w", err)
+	}
+	return nil
+}
+
+func (p *Plugin) handleDiff(ctx context.Context, baseCfg *config.Config, args types.PluginArgs) (*types.ExecutionResult, error) {
+	if help, ok := args.BoolAny("help", "h"); ok && help {
+		return &types.ExecutionResult{Stdout: diffUsage(), ExitCode: 0}, nil
+	}
+
+	merged := baseCfg.Clone()
+	applyTargetOverrides(merged, args)
+	if contextPath, ok := args.FirstAny("context", "context-path"); ok && strings.TrimSpace(contextPath) != "" {
+		merged.ContextPath = strings.Trim(strings.TrimSpace(contextPath), "/")
+	}
+	if key, ok := args.First("manifest-key"); ok && strings.TrimSpace(key) != "" {
+		merged.ManifestKey = strings.Trim(strings.TrimSpace(key), "/")
+	}
+	currentPath, _ := args.First("manifest")
+	previousPath, _ := args.First("previous")
+	currentPath, previousPath = strings.TrimSpace(currentPath), strings.TrimSpace(previousPath)
+	useInventory, _ := args.Bool("inventory")
+	if useInventory {
+		if !merged.Inventory.Enabled() {
+			return configFailure(ctx, fmt.Errorf("--inventory requires inventory.prefix")), nil
+		}
+		if previousPath != "" {
+			return configFailure(ctx, fmt.Errorf("--inventory and --previous cannot be combined")), nil
+		}
+	}
+	format, _ := args.First("format")
+	switch format = strings.ToLower(strings.TrimSpace(format)); format {
+	case "":
+		format = "json"
+	case "json", "text":
+	default:
+		return configFailure(ctx, fmt.Errorf("invalid --format %q (expected json or text)", format)), nil
+	}
+
+	var current, previous *uploadSummary
+	var report *inventoryReport
+	var err error
+	if currentPath != "" {
+		if current, err = loadManifestFile(currentPath); err != nil {
+			return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+		}
+	}
+	if previousPath != "" {
+		if previous, err = loadManifestFile(previousPath); err != nil {
+			return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+		}
+	}
+
+	if useInventory {
+		// The bucket as listed by the latest report stands in for the
+		// previous run.
+		if err := merged.Validate(); err != nil {
+			return configFailure(ctx, err), nil
+		}
+		if report, err = p.loadInventory(ctx, merged); err != nil {
+			return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+		}
+		previous = &uploadSummary{ObjectsUploaded: report.results(merged)}
+	}
+
+	if current == nil || previous == nil {
+		// Without --manifest the stored manifest is the current run and its
+		// predecessor the previous one; with it, the stored manifest is the
+		// previous run.
+		key := merged.ManifestObjectKey()
+		if key == "" {
+			return &types.ExecutionResult{ExitCode: 1, Error: "manifest_key is not configured (set it, pass --manifest-key, or pass both --manifest and --previous)"}, nil
+		}
+		if err := merged.Validate(); err != nil {
+			return configFailure(ctx, err), nil
+		}
+		client, err := p.newS3Client(ctx, merged)
+		if err != nil {
+			return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+		}
+		transfer, err := newTransport(client, merged, nil)
+		if err != nil {
+			return configFailure(ctx, err), nil
+		}
+
+		if current == nil {
+			if current, err = loadManifestObject(ctx, transfer, key); err != nil {
+				return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+			}
+			if current == nil {
+				return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("no manifest stored at %s", key)}, nil
+			}
+			key += previousManifestSuffix
+		}
+		if previous == nil {
+			if previous, err = loadManifestObject(ctx, transfer, key); err != nil {
+				return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+			}
+		}
+	}
+
+	var before []uploader.UploadResult
+	if previous != nil {
+		before = previous.ObjectsUploaded
+	}
+	var options []uploader.DiffOption
+	if merged.WeakETags() {
+		options = append(options, uploader.IgnoreETags())
+	}
+	diff := uploader.DiffManifests(before, current.ObjectsUploaded, options...)
+
+	if format == "text" {
+		return &types.ExecutionResult{Stdout: formatManifestDiff(diff), ExitCode: 0}, nil
+	}
+
+	summary := diffSummary{
+		Bucket:       merged.Bucket,
+		ContextPath:  merged.ContextPath,
+		FirstRun:     previous == nil,
+		ManifestDiff: diff,
+	}
+	if report != nil {
+		summary.Inventory = report.info()
+	}
+	payload, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("failed to encode execution summary: %v", err)}, nil
+	}
+
+	return &types.ExecutionResult{
+		Stdout:   string(payload) + "\n",
+		ExitCode: 0,
+	}, nil
+}
+
+// loadManifestFile reads an upload summary saved from a previous run.
+func loadManifestFile(path string) (*uploadSummary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", path, err)
+	}
+	return parseManifest(path, data)
+}
+
+// loadManifestObject reads an upload summary stored in the bucket, or returns
+// nil when there is none.
+func loadManifestObject(ctx context.Context, transfer *uploader.Transport, key string) (*uploadSummary, error) {
+	data, err := transfer.ReadObject(ctx, key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return parseManifest(key, data)
+}
+
+func parseManifest(name string, data []byte) (*uploadSummary, error) {
+	var summary uploadSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", name, err)
+	}
+	return &summary, nil
+}
+
+// formatManifestDiff renders the diff as a change log, one line per key.
+func formatManifestDiff(diff uploader.ManifestDiff) string {
+	var b strings.Builder
+	for _, obj := range diff.Added {
+		fmt.Fprintf(&b, "+ %s (%d bytes)\n", obj.Key, obj.Size)
+	}
+	for _, obj := range diff.Removed {
+		fmt.Fprintf(&b, "- %s\n", obj.Key)
+	}
+	for _, change := range diff.Changed {
+		fmt.Fprintf(&b, "~ %s (%d -> %d bytes)\n", change.Key, change.Previous.Size, change.Current.Size)
+	}
+	fmt.Fprintf(&b, "%d added, %d removed, %d changed, %d unchanged\n", len(diff.Added), len(diff.Removed), len(diff.Changed), diff.Unchanged)
+	return b.String()
+}
+
+func diffUsage() string {
+	return `Usage: ds s3 diff [flags]
+
+Compares the objects uploaded by two runs and reports added, removed and
+changed keys. By default the manifest stored at manifest_key is compared with
+the one it replaced. With --manifest, a saved upload summary is compared with
+the stored manifest instead. With --inventory, the manifest is compared with
+the objects below the context path as listed by the latest S3 Inventory
+report, without listing the bucket: added keys are missing from the bucket,
+removed keys are objects the manifest does not know.
+
+Flags:
+  --bucket <name>            Override target bucket (defaults to configuration)
+  --region <name>            Override AWS region
+  --context <prefix>         Object prefix/context path the manifest is stored under
+  --manifest-key <key>       Override the manifest key below the context path
+  --manifest <file>          Upload summary of the current run
+  --previous <file>          Upload summary of the previous run
+  --inventory                Compare with the latest inventory report instead of the previous run
+  --format <fmt>             "json" (default) or "text" for a change log
+  --endpoint <url>           Use a custom S3-compatible endpoint
+  --force-path-style         Force path-style addressing
+  --skip-tls-verify          Disable TLS verification (requires --endpoint)
+  --profile <name>           Shared AWS profile to use
+  --mfa-token <code>         MFA code for credentials.mfa_serial (or $DS_S3_MFA_TOKEN)
+  --debug-aws-config         Log the resolved region, endpoint, addressing, retries, credential source and signer
+`
+}
+
+type diffSummary struct {
+	Bucket      string `json:"bucket,omitempty"`
+	ContextPath string `json:"context_path,omitempty"`
+	FirstRun    bool   `json:"first_run,omitempty"`
+	// Inventory is the report diffed against with --inventory.
+	Inventory *inventoryInfo `json:"inventory,omitempty"`
+	uploader.ManifestDiff
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/delivery-station/ds/pkg/types"
+)
+
+func (p *Plugin) handleDownload(ctx context.Context, baseCfg *config.Config, args types.PluginArgs) (*types.ExecutionResult, error) {
+	if help, ok := args.BoolAny("help", "h"); ok && help {
+		return &types.ExecutionResult{Stdout: downloadUsage(), ExitCode: 0}, nil
+	}
+
+	merged := baseCfg.Clone()
+	applyTargetOverrides(merged, args)
+	if contextPath, ok := args.FirstAny("context", "context-path"); ok && strings.TrimSpace(contextPath) != "" {
+		merged.ContextPath = strings.Trim(strings.TrimSpace(contextPath), "/")
+	}
+	applyEncryptionOverrides(merged, args)
+	if decompress, ok := args.Bool("decompress"); ok {
+		merged.Decompress = decompress
+	}
+
+	destination := "."
+	if positionals := args.Positionals(); len(positionals) > 1 {
+		return &types.ExecutionResult{ExitCode: 1, Error: "download accepts a single destination directory"}, nil
+	} else if len(positionals) == 1 && strings.TrimSpace(positionals[0]) != "" {
+		destination = strings.TrimSpace(positionals[0])
+	}
+
+	targetName, _ := args.First("target")
+	targetCfg, err := merged.ForTarget(targetName)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	if err := targetCfg.Validate(); err != nil {
+		return configFailure(ctx, err), nil
+	}
+
+	client, err := p.newS3Client(ctx, targetCfg)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	transfer, err := newTransport(client, targetCfg, nil)
+	if err != nil {
+		return configFailure(ctx, err), nil
+	}
+	transfer.SetDecompress(targetCfg.Decompress)
+	if err := p.applyClientEncryption(ctx, transfer, targetCfg); err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+
+	results, err := transfer.Download(ctx, targetCfg.ContextPath, destination)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	p.logger.Info("Download completed", "bucket", targetCfg.Bucket, "objects", len(results), "destination", destination)
+
+	summary := downloadSummary{
+		Target:      targetName,
+		Bucket:      targetCfg.Bucket,
+		Region:      targetCfg.Region,
+		ContextPath: targetCfg.ContextPath,
+		Destination: destination,
+		Objects:     results,
+		DryRun:      targetCfg.DryRun,
+	}
+
+	payload, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("failed to encode execution summary: %v", err)}, nil
+	}
+
+	return &types.ExecutionResult{
+		Stdout:   string(payload) + "\n",
+		ExitCode: 0,
+	}, nil
+}
+
+func downloadUsage() string {
+	return `Usage: ds s3 download [directory] [flags]
+
+Downloads every object under the context path into the directory (default
+the current one), recreating the key hierarchy below the context path.
+Objects encrypted on the client are decrypted with the configured
+client_encryption key. Files an upload bundled into packs (packing.enabled)
+are extracted from them, in place of the packs and their index.
+
+Flags:
+  --bucket <name>            Override target bucket (defaults to configuration)
+  --region <name>            Override AWS region
+  --context <prefix>         Object prefix/context path to download
+  --target <name>            Download from a named target from configuration
+  --decompress               Gunzip objects with Content-Encoding gzip or a .gz key
+  --client-encryption-kms-key-id <id>
+                             KMS key wrapping the data keys of client-side encrypted objects
+  --endpoint <url>           Use a custom S3-compatible endpoint
+  --force-path-style         Force path-style addressing
+  --skip-tls-verify          Disable TLS verification (requires --endpoint)
+  --profile <name>           Shared AWS profile to use
+  --mfa-token <code>         MFA code for credentials.mfa_serial (or $DS_S3_MFA_TOKEN)
+  --debug-aws-config         Log the resolved region, endpoint, addressing, retries, credential source and signer
+`
+}
+
+type downloadSummary struct {
+	Target      string                    `json:"target,omitempty"`
+	Bucket      string                    `json:"bucket"`
+	Region      string                    `json:"region,omitempty"`
+	ContextPath string                    `json:"context_path,omitempty"`
+	Destination string                    `json:"destination"`
+	Objects     []uploader.DownloadResult `json:"objects"`
+	DryRun      bool                      `json:"dry_run,omitempty"`
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/internal/envelope"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+)
+
+// applyClientEncryption makes transfer encrypt uploads and decrypt downloads
+// on the client when client_encryption is configured.
+func (p *Plugin) applyClientEncryption(ctx context.Context, transfer *uploader.Transport, cfg *config.Config) error {
+	settings := cfg.ClientEncryption
+	if !settings.Enabled() {
+		return nil
+	}
+
+	var wrapper envelope.KeyWrapper
+	if settings.KMSKeyID != "" {
+		awsCfg, err := p.awsConfig(ctx, cfg)
+		if err != nil {
+			return fmt.Errorf("failed to configure AWS SDK: %w", err)
+		}
+		wrapper = envelope.NewKMSWrapper(newKMSClient(awsCfg, settings.KMSKeyID), settings.KMSKeyID)
+	} else {
+		key, err := settings.DecodedKey()
+		if err != nil {
+			return err
+		}
+		if wrapper, err = envelope.NewAESWrapper(key); err != nil {
+			return err
+		}
+	}
+
+	transfer.SetEnvelope(envelope.New(wrapper))
+	return nil
+}
+
+// newKMSClient returns a KMS client for the key keyID. A key ARN pins the
+// region the key lives in, which need not be the bucket's.
+func newKMSClient(awsCfg aws.Config, keyID string) *kms.Client {
+	return kms.NewFromConfig(awsCfg, func(o *kms.Options) {
+		if parsed, err := arn.Parse(keyID); err == nil && parsed.Region != "" {
+			o.Region = parsed.Region
+		}
+	})
+}
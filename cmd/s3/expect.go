@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+)
+
+// plannedOutput tallies the files the sources were planned into, which
+// expect.min_files and expect.min_total_size are checked against.
+type plannedOutput struct {
+	mu    sync.Mutex
+	files int
+	size  int64
+}
+
+// add counts plans.
+func (o *plannedOutput) add(plans ...uploader.FilePlan) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, plan := range plans {
+		o.files++
+		o.size += plan.Size
+	}
+}
+
+// count counts a streamed plan and lets it through.
+func (o *plannedOutput) count(plan uploader.FilePlan) (bool, error) {
+	o.add(plan)
+	return true, nil
+}
+
+// check fails when the sources hold less than cfg expects, which usually
+// means the build did not produce its output.
+func (o *plannedOutput) check(cfg *config.Config) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var problems []error
+	if cfg.Expect.MinFiles > 0 && o.files < cfg.Expect.MinFiles {
+		problems = append(problems, fmt.Errorf("the sources contain %d file(s), fewer than expect.min_files %d", o.files, cfg.Expect.MinFiles))
+	}
+	if cfg.Expect.MinTotalSize > 0 && o.size < cfg.Expect.MinTotalSize {
+		problems = append(problems, fmt.Errorf("the sources add up to %s, less than expect.min_total_size %s", config.FormatByteSize(o.size), config.FormatByteSize(cfg.Expect.MinTotalSize)))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w; check that the build produced its output", errors.Join(problems...))
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+)
+
+func TestPlannedOutputCheck(t *testing.T) {
+	cfg := &config.Config{Expect: config.Expect{MinFiles: 3, MinTotalSize: 1 << 10}}
+
+	var planned plannedOutput
+	planned.add(uploader.FilePlan{Size: 100})
+	if ok, err := planned.count(uploader.FilePlan{Size: 100}); !ok || err != nil {
+		t.Errorf("expected a streamed plan to be let through, got %v, %v", ok, err)
+	}
+	err := planned.check(cfg)
+	if err == nil {
+		t.Fatal("expected too little output to fail")
+	}
+	for _, want := range []string{"2 file(s), fewer than expect.min_files 3", "less than expect.min_total_size", "check that the build produced its output"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %v", want, err)
+		}
+	}
+
+	planned.add(uploader.FilePlan{Size: 1 << 10})
+	if err := planned.check(cfg); err != nil {
+		t.Errorf("expected enough output to pass, got %v", err)
+	}
+
+	var empty plannedOutput
+	if err := empty.check(&config.Config{}); err != nil {
+		t.Errorf("expected no expectations to pass, got %v", err)
+	}
+	if err := empty.check(&config.Config{Expect: config.Expect{MinTotalSize: 1}}); err == nil || strings.Contains(err.Error(), "min_files") {
+		t.Errorf("expected only the size to fail, got %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/delivery-station/ds-s3/internal/buildinfo"
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/internal/diagnostics"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/delivery-station/ds/pkg/types"
+)
+
+// failureReport is written to failure_report when a command fails. It holds
+// the S3 requests that failed, with what support needs to debug them, and
+// for uploads the files left out, so that a later run with --retry-from
+// uploads only those instead of everything again.
+type failureReport struct {
+	Operation       string                `json:"operation"`
+	PluginVersion   string                `json:"plugin_version"`
+	Bucket          string                `json:"bucket"`
+	ContextPath     string                `json:"context_path"`
+	RunID           string                `json:"run_id,omitempty"`
+	TraceID         string                `json:"trace_id,omitempty"`
+	CorrelationID   string                `json:"correlation_id,omitempty"`
+	FailedAt        time.Time             `json:"failed_at"`
+	Error           string                `json:"error"`
+	ErrorClass      string                `json:"error_class"`
+	Failures        []diagnostics.Failure `json:"failures,omitempty"`
+	FailuresDropped int                   `json:"failures_dropped,omitempty"`
+	Uploaded        int                   `json:"objects_uploaded,omitempty"`
+	Failed          []failedFile          `json:"failed,omitempty"`
+}
+
+// failedFile is a plan that failed or was skipped after the first failure.
+type failedFile struct {
+	Source      string `json:"source"`
+	Key         string `json:"key"`
+	Placeholder bool   `json:"placeholder,omitempty"`
+}
+
+// failureTracker gathers the failure report of one command while it runs.
+type failureTracker struct {
+	recorder *diagnostics.Recorder
+
+	mu     sync.Mutex
+	report failureReport
+	// marked is the class the command marked its failure with, if any.
+	marked string
+}
+
+type failureTrackerKey struct{}
+
+// trackFailures returns a context carrying a new tracker for operation.
+func trackFailures(ctx context.Context, operation, version string, cfg *config.Config) (context.Context, *failureTracker) {
+	correlation := buildinfo.CorrelationFromEnv(os.LookupEnv)
+	tracker := &failureTracker{
+		recorder: diagnostics.NewRecorder(),
+		report: failureReport{
+			Operation:     operation,
+			PluginVersion: version,
+			Bucket:        cfg.Bucket,
+			ContextPath:   cfg.ContextPath,
+			TraceID:       correlation.TraceID,
+			CorrelationID: correlation.CorrelationID,
+		},
+	}
+	return context.WithValue(ctx, failureTrackerKey{}, tracker), tracker
+}
+
+// failuresFrom returns the tracker of the command running with ctx, or nil.
+func failuresFrom(ctx context.Context) *failureTracker {
+	tracker, _ := ctx.Value(failureTrackerKey{}).(*failureTracker)
+	return tracker
+}
+
+// failedAs marks the failure of the command as class, which takes precedence
+// over the class of the S3 request it failed on.
+func (f *failureTracker) failedAs(class string) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.marked = class
+}
+
+// class returns the class of the failure of the command that ended with
+// message: the one it was marked with, else the class of the latest failed S3
+// request the message reports. Requests that failed along the way without
+// ending the command, such as those of a replica, say nothing about it, so a
+// message reporting none is ClassUnknown.
+func (f *failureTracker) class(message string) string {
+	f.mu.Lock()
+	class := f.marked
+	f.mu.Unlock()
+	if class != "" {
+		return class
+	}
+	failures, _ := f.recorder.Failures()
+	for i := len(failures) - 1; i >= 0; i-- {
+		if failures[i].Message != "" && strings.Contains(message, failures[i].Message) {
+			return failures[i].ErrorClass
+		}
+	}
+	return diagnostics.ClassUnknown
+}
+
+// leftOut records the files a failed upload to cfg's target did not upload.
+func (f *failureTracker) leftOut(cfg *config.Config, failure *uploader.UploadError) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.report.Bucket = cfg.Bucket
+	f.report.ContextPath = cfg.ContextPath
+	f.report.RunID = cfg.RunID
+	f.report.Uploaded = len(failure.Uploaded)
+	if len(failure.Uploaded) > 0 {
+		f.marked = diagnostics.ClassPartial
+	}
+	f.report.Failed = make([]failedFile, 0, len(failure.Failed))
+	for _, plan := range failure.Failed {
+		f.report.Failed = append(f.report.Failed, failedFile{Source: plan.Source, Key: plan.Key, Placeholder: plan.Placeholder})
+	}
+}
+
+// write stores the report of a command that failed with message at path.
+func (f *failureTracker) write(path, message string) error {
+	f.mu.Lock()
+	report := f.report
+	f.mu.Unlock()
+	report.FailedAt = time.Now().UTC()
+	report.Error = message
+	report.ErrorClass = f.class(message)
+	report.Failures, report.FailuresDropped = f.recorder.Failures()
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode failure report: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write failure report: %w", err)
+	}
+	return nil
+}
+
+// configFailure returns the result of a command rejected for its settings or
+// flags.
+func configFailure(ctx context.Context, err error) *types.ExecutionResult {
+	failuresFrom(ctx).failedAs(diagnostics.ClassConfig)
+	return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}
+}
+
+// loadFailureReport returns the plans listed in the failure report at path,
+// which must have been written for the same bucket and context path.
+func loadFailureReport(path string, cfg *config.Config) ([]uploader.FilePlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read failure report: %w", err)
+	}
+	var report failureReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse failure report %s: %w", path, err)
+	}
+	if report.Bucket != cfg.Bucket || report.ContextPath != cfg.ContextPath {
+		return nil, fmt.Errorf("failure report %s was written for s3://%s/%s, not s3://%s/%s", path, report.Bucket, report.ContextPath, cfg.Bucket, cfg.ContextPath)
+	}
+	if len(report.Failed) == 0 {
+		return nil, fmt.Errorf("failure report %s lists no files to retry", path)
+	}
+
+	plans := make([]uploader.FilePlan, 0, len(report.Failed))
+	for _, file := range report.Failed {
+		plan := uploader.FilePlan{Source: file.Source, Key: file.Key, Placeholder: file.Placeholder}
+		if !file.Placeholder {
+			// The file may have been fixed since, so its size is taken anew.
+			info, err := os.Stat(file.Source)
+			if err != nil {
+				return nil, fmt.Errorf("failed to stat %s from failure report: %w", file.Source, err)
+			}
+			plan.Size = info.Size()
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/internal/diagnostics"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+)
+
+func TestFailureReportRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "app.tar")
+	if err := os.WriteFile(source, []byte("fixed since"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Bucket: "artifacts", ContextPath: "builds/7", RunID: "run-7"}
+
+	_, failures := trackFailures(context.Background(), "upload", "1.0.0", cfg)
+	failures.leftOut(cfg, &uploader.UploadError{
+		Err:      errors.New("access denied"),
+		Uploaded: []uploader.UploadResult{{Key: "builds/7/index.html"}},
+		Failed: []uploader.FilePlan{
+			{Source: source, Key: "builds/7/app.tar", Size: 3},
+			{Source: filepath.Join(dir, "logs"), Key: "builds/7/logs/", Placeholder: true},
+		},
+	})
+	if class := failures.class("access denied"); class != diagnostics.ClassPartial {
+		t.Errorf("expected a run that uploaded some files to fail as partial, got %s", class)
+	}
+	path := filepath.Join(dir, "failures.json")
+	if err := failures.write(path, "access denied"); err != nil {
+		t.Fatalf("write returned error: %v", err)
+	}
+
+	plans, err := loadFailureReport(path, cfg)
+	if err != nil {
+		t.Fatalf("loadFailureReport returned error: %v", err)
+	}
+	if len(plans) != 2 || plans[0].Key != "builds/7/app.tar" || plans[0].Size != int64(len("fixed since")) || !plans[1].Placeholder {
+		t.Errorf("unexpected plans %+v", plans)
+	}
+
+	other := &config.Config{Bucket: "artifacts", ContextPath: "builds/8"}
+	if _, err := loadFailureReport(path, other); err == nil || !strings.Contains(err.Error(), "s3://artifacts/builds/7") {
+		t.Errorf("expected a report for another context path to be refused, got %v", err)
+	}
+
+	if err := os.Remove(source); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadFailureReport(path, cfg); err == nil || !strings.Contains(err.Error(), "app.tar") {
+		t.Errorf("expected a missing source to be reported, got %v", err)
+	}
+
+	_, empty := trackFailures(context.Background(), "upload", "1.0.0", cfg)
+	if err := empty.write(path, "bucket not found"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadFailureReport(path, cfg); err == nil || !strings.Contains(err.Error(), "no files to retry") {
+		t.Errorf("expected a report without files to be refused, got %v", err)
+	}
+}
+
+func TestFailureClassIsTheEndingFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{Bucket: "artifacts", ContextPath: "builds/7"}
+	_, failures := trackFailures(context.Background(), "upload", "1.0.0", cfg)
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		APIOptions:   []func(*middleware.Stack) error{failures.recorder.Middleware()},
+	})
+	_, err := client.HeadBucket(context.Background(), &s3.HeadBucketInput{Bucket: aws.String("replica")})
+	if err == nil {
+		t.Fatal("expected HeadBucket to fail")
+	}
+
+	if class := failures.class(fmt.Sprintf("replica failed: %v", err)); class != diagnostics.ClassAuth {
+		t.Errorf("expected the failed request to classify the error reporting it, got %s", class)
+	}
+	if class := failures.class("failed to plan uploads: open dist: no such file or directory"); class != diagnostics.ClassUnknown {
+		t.Errorf("expected an error reporting no request to be unknown, got %s", class)
+	}
+	failures.failedAs(diagnostics.ClassConfig)
+	if class := failures.class(err.Error()); class != diagnostics.ClassConfig {
+		t.Errorf("expected the marked class to take precedence, got %s", class)
+	}
+}
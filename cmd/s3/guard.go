@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/internal/scan"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/hashicorp/go-hclog"
+)
+
+// maxReportedFindings bounds how many findings are spelled out in an error.
+const maxReportedFindings = 10
+
+// planGuard inspects planned files before they are uploaded.
+type planGuard interface {
+	// checkAll inspects every pre-built plan before the run touches the
+	// bucket and returns the plans that may be uploaded.
+	checkAll(ctx context.Context, plans []uploader.FilePlan) ([]uploader.FilePlan, error)
+	// check inspects a single streamed plan and reports whether to upload it.
+	check(ctx context.Context, plan uploader.FilePlan) (bool, error)
+}
+
+// checkPlans runs every guard over the pre-built plans in order. Placeholders
+// for special files have no content to inspect and bypass the guards.
+func checkPlans(ctx context.Context, guards []planGuard, plans []uploader.FilePlan) ([]uploader.FilePlan, error) {
+	var placeholders []uploader.FilePlan
+	files := make([]uploader.FilePlan, 0, len(plans))
+	for _, plan := range plans {
+		if plan.Placeholder {
+			placeholders = append(placeholders, plan)
+		} else {
+			files = append(files, plan)
+		}
+	}
+
+	for _, guard := range guards {
+		var err error
+		if files, err = guard.checkAll(ctx, files); err != nil {
+			return nil, err
+		}
+	}
+	return append(files, placeholders...), nil
+}
+
+// streamCheck combines the guards into a check for streamed plans, or nil when there are none.
+func streamCheck(ctx context.Context, guards []planGuard) func(uploader.FilePlan) (bool, error) {
+	if len(guards) == 0 {
+		return nil
+	}
+	return func(plan uploader.FilePlan) (bool, error) {
+		if plan.Placeholder {
+			return true, nil
+		}
+		for _, guard := range guards {
+			keep, err := guard.check(ctx, plan)
+			if err != nil || !keep {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+}
+
+// secretGuard scans planned files for potential secrets. In block mode
+// findings fail the run; in warn mode they are logged and reported in the summary.
+type secretGuard struct {
+	scanner *scan.SecretScanner
+	block   bool
+	logger  hclog.Logger
+
+	mu       sync.Mutex
+	findings []scan.Finding
+}
+
+// newSecretGuard builds the guard configured by cfg, or nil when scanning is disabled.
+func newSecretGuard(cfg *config.Config, logger hclog.Logger) (*secretGuard, error) {
+	if !cfg.SecretScan.Enabled {
+		return nil, nil
+	}
+
+	rules := scan.DefaultRules()
+	custom, err := scan.CompileRules(cfg.SecretScan.Patterns)
+	if err != nil {
+		return nil, err
+	}
+	rules = append(rules, custom...)
+	if cfg.SecretScan.EntropyThreshold > 0 {
+		rules = append(rules, scan.EntropyRule(cfg.SecretScan.EntropyThreshold))
+	}
+
+	return &secretGuard{
+		scanner: scan.NewSecretScanner(rules, cfg.SecretScan.MaxFileSize),
+		block:   cfg.SecretScan.Mode != config.ScanModeWarn,
+		logger:  logger,
+	}, nil
+}
+
+// checkAll scans every plan so a blocked upload reports all findings at once.
+func (g *secretGuard) checkAll(ctx context.Context, plans []uploader.FilePlan) ([]uploader.FilePlan, error) {
+	var found []scan.Finding
+	for _, plan := range plans {
+		findings, err := g.scan(plan)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, findings...)
+	}
+	if g.block && len(found) > 0 {
+		return nil, blockedError(found)
+	}
+	return plans, nil
+}
+
+func (g *secretGuard) check(ctx context.Context, plan uploader.FilePlan) (bool, error) {
+	findings, err := g.scan(plan)
+	if err != nil {
+		return false, err
+	}
+	if g.block && len(findings) > 0 {
+		return false, blockedError(findings)
+	}
+	return true, nil
+}
+
+func (g *secretGuard) scan(plan uploader.FilePlan) ([]scan.Finding, error) {
+	findings, err := g.scanner.ScanFile(plan.Source)
+	if err != nil {
+		return nil, fmt.Errorf("secret scan failed: %w", err)
+	}
+	for i := range findings {
+		findings[i].Key = plan.Key
+		if !g.block {
+			g.logger.Warn("Potential secret in upload", "source", plan.Source, "rule", findings[i].Rule, "line", findings[i].Line)
+		}
+	}
+
+	g.mu.Lock()
+	g.findings = append(g.findings, findings...)
+	g.mu.Unlock()
+	return findings, nil
+}
+
+// report returns the findings recorded so far.
+func (g *secretGuard) report() []scan.Finding {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]scan.Finding(nil), g.findings...)
+}
+
+func blockedError(findings []scan.Finding) error {
+	described := make([]string, 0, maxReportedFindings)
+	for i, f := range findings {
+		if i == maxReportedFindings {
+			described = append(described, fmt.Sprintf("and %d more", len(findings)-i))
+			break
+		}
+		described = append(described, fmt.Sprintf("%s:%d (%s)", f.Source, f.Line, f.Rule))
+	}
+	return fmt.Errorf("secret scan blocked upload, %d potential secrets found: %s", len(findings), strings.Join(described, ", "))
+}
+
+// quarantinedFile reports a planned file withheld from upload by the antivirus scan.
+type quarantinedFile struct {
+	Source    string `json:"source"`
+	Key       string `json:"key"`
+	Signature string `json:"signature"`
+}
+
+// antivirusGuard streams every planned file through a malware scanner. In
+// block mode a detection fails the run; in quarantine mode the file is left
+// out of the upload and reported in the summary.
+type antivirusGuard struct {
+	scanner    scan.VirusScanner
+	quarantine bool
+	logger     hclog.Logger
+
+	mu          sync.Mutex
+	quarantined []quarantinedFile
+}
+
+// newAntivirusGuard builds the guard configured by cfg, or nil when scanning is disabled.
+func newAntivirusGuard(cfg *config.Config, logger hclog.Logger) (*antivirusGuard, error) {
+	if !cfg.Antivirus.Enabled {
+		return nil, nil
+	}
+
+	var (
+		scanner scan.VirusScanner
+		err     error
+	)
+	if cfg.Antivirus.Clamd != "" {
+		scanner, err = scan.NewClamdScanner(cfg.Antivirus.Clamd)
+	} else {
+		scanner, err = scan.NewCommandScanner(cfg.Antivirus.Command)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &antivirusGuard{
+		scanner:    scanner,
+		quarantine: cfg.Antivirus.Action == config.AntivirusActionQuarantine,
+		logger:     logger,
+	}, nil
+}
+
+func (g *antivirusGuard) checkAll(ctx context.Context, plans []uploader.FilePlan) ([]uploader.FilePlan, error) {
+	clean := make([]uploader.FilePlan, 0, len(plans))
+	for _, plan := range plans {
+		keep, err := g.check(ctx, plan)
+		if err != nil {
+			return nil, err
+		}
+		if keep {
+			clean = append(clean, plan)
+		}
+	}
+	if len(clean) == 0 && len(plans) > 0 {
+		return nil, fmt.Errorf("antivirus scan quarantined every planned file")
+	}
+	return clean, nil
+}
+
+func (g *antivirusGuard) check(ctx context.Context, plan uploader.FilePlan) (bool, error) {
+	verdict, err := g.scanner.ScanFile(ctx, plan.Source)
+	if err != nil {
+		return false, fmt.Errorf("antivirus scan failed: %w", err)
+	}
+	if !verdict.Infected {
+		return true, nil
+	}
+	if !g.quarantine {
+		return false, fmt.Errorf("antivirus scan blocked upload: %s is infected (%s)", plan.Source, verdict.Signature)
+	}
+
+	g.logger.Warn("Quarantined infected file", "source", plan.Source, "signature", verdict.Signature)
+	g.mu.Lock()
+	g.quarantined = append(g.quarantined, quarantinedFile{Source: plan.Source, Key: plan.Key, Signature: verdict.Signature})
+	g.mu.Unlock()
+	return false, nil
+}
+
+// report returns the files quarantined so far.
+func (g *antivirusGuard) report() []quarantinedFile {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]quarantinedFile(nil), g.quarantined...)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds/pkg/types"
+)
+
+func (p *Plugin) handleInfo(ctx context.Context, baseCfg *config.Config, args types.PluginArgs) (*types.ExecutionResult, error) {
+	if help, ok := args.BoolAny("help", "h"); ok && help {
+		return &types.ExecutionResult{Stdout: infoUsage(), ExitCode: 0}, nil
+	}
+
+	if operation, ok := args.First("operation"); ok && strings.TrimSpace(operation) != "" {
+		opCfg, err := baseCfg.ForOperation(operation)
+		if err != nil {
+			return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+		}
+		baseCfg = opCfg
+	}
+
+	merged := baseCfg.Clone()
+	if err := applyUploadOverrides(merged, args); err != nil {
+		return configFailure(ctx, err), nil
+	}
+	settings := config.MarkOverrides(baseCfg.Describe(), merged.Describe(), config.SourceFlag)
+
+	targetName, _ := args.First("target")
+	if targetName != "" {
+		targetCfg, err := merged.ForTarget(targetName)
+		if err != nil {
+			return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+		}
+		settings = config.MarkOverrides(settings, targetCfg.Describe(), "target:"+targetName)
+	}
+
+	summary := infoSummary{Target: targetName, Settings: settings}
+	if err := merged.Validate(); err != nil {
+		summary.ValidationError = err.Error()
+	}
+
+	payload, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("failed to encode execution summary: %v", err)}, nil
+	}
+
+	return &types.ExecutionResult{
+		Stdout:   string(payload) + "\n",
+		ExitCode: 0,
+	}, nil
+}
+
+func infoUsage() string {
+	return `Usage: ds s3 info [flags]
+
+Prints the effective configuration after merging host settings, defaults, the
+local .ds-s3.yaml and CLI flags. Secrets are redacted and every value is
+annotated with its source (default, settings, local, environment:<name>,
+operation:<name>, host, flag or target:<name>).
+
+Accepts every upload flag so an invocation can be checked before running it.
+
+Flags:
+  --env <name>               Apply a configured environment overlay (defaults to $DS_ENV)
+  --operation <name>         Include the configured defaults of another operation
+  --target <name>            Show the configuration as resolved for a named target
+`
+}
+
+type infoSummary struct {
+	Target          string           `json:"target,omitempty"`
+	Settings        []config.Setting `json:"settings"`
+	ValidationError string           `json:"validation_error,omitempty"`
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/internal/inventory"
+	"github.com/delivery-station/ds-s3/internal/syncstate"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+)
+
+// errStaleInventory reports that the latest inventory report is older than
+// inventory.max_age.
+var errStaleInventory = errors.New("inventory report is stale")
+
+// inventoryReport is the report read as the remote state of the context path.
+type inventoryReport struct {
+	manifest *inventory.Manifest
+	objects  map[string]inventory.Object
+}
+
+// inventoryInfo identifies the report a command used in its summary.
+type inventoryInfo struct {
+	Manifest string    `json:"manifest"`
+	Created  time.Time `json:"created"`
+	Objects  int       `json:"objects"`
+}
+
+func (r *inventoryReport) info() *inventoryInfo {
+	return &inventoryInfo{Manifest: r.manifest.Key, Created: r.manifest.Created(), Objects: len(r.objects)}
+}
+
+// loadInventory reads the current objects below the context path from the
+// latest inventory report configured by cfg. A report older than
+// inventory.max_age fails with errStaleInventory before its data is read.
+func (p *Plugin) loadInventory(ctx context.Context, cfg *config.Config) (*inventoryReport, error) {
+	reportCfg := cfg
+	if cfg.Inventory.Bucket != "" && cfg.Inventory.Bucket != cfg.Bucket {
+		reportCfg = cfg.Clone()
+		reportCfg.Bucket = cfg.Inventory.Bucket
+	}
+	client, err := p.newS3Client(ctx, reportCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := inventory.Latest(ctx, client, reportCfg.Bucket, cfg.Inventory.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	if age := time.Since(manifest.Created()); cfg.Inventory.MaxAge > 0 && age > cfg.Inventory.MaxAge {
+		return nil, fmt.Errorf("%w: %s was created %s ago, more than inventory.max_age %s", errStaleInventory, manifest.Key, age.Round(time.Minute), cfg.Inventory.MaxAge)
+	}
+
+	prefix := cfg.ContextPath
+	if prefix != "" {
+		prefix += "/"
+	}
+	objects, err := inventory.Objects(ctx, client, reportCfg.Bucket, manifest, prefix)
+	if err != nil {
+		return nil, err
+	}
+	p.logger.Info("Read inventory report", "manifest", manifest.Key, "created", manifest.Created().Format(time.RFC3339), "objects", len(objects))
+	return &inventoryReport{manifest: manifest, objects: objects}, nil
+}
+
+// useInventory makes the sync guard re-upload unchanged files whose objects
+// are missing from the latest inventory report or differ in size, such as
+// objects deleted or overwritten behind the sync state's back. A stale report
+// is logged and ignored.
+func (p *Plugin) useInventory(ctx context.Context, guard *syncGuard, cfg *config.Config) error {
+	if guard == nil || !cfg.Inventory.Enabled() {
+		return nil
+	}
+	report, err := p.loadInventory(ctx, cfg)
+	if errors.Is(err, errStaleInventory) {
+		p.logger.Warn("Ignoring stale inventory report, trusting the sync state", "error", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	created := report.manifest.Created().UnixNano()
+	guard.tracker.SetRemote(func(key string, previous syncstate.Entry) bool {
+		// Objects uploaded after the report was taken are missing from it.
+		if previous.Uploaded > created {
+			return true
+		}
+		obj, ok := report.objects[key]
+		return ok && obj.Size == previous.Size
+	})
+	return nil
+}
+
+// results returns the objects of the report, minus the plugin's own state
+// objects, as upload results to diff manifests against.
+func (r *inventoryReport) results(cfg *config.Config) []uploader.UploadResult {
+	own := map[string]bool{}
+	if key := cfg.ManifestObjectKey(); key != "" {
+		own[key] = true
+		own[key+previousManifestSuffix] = true
+	}
+	if key := cfg.SyncStateObjectKey(); key != "" {
+		own[key] = true
+	}
+	if key := cfg.MarkerObjectKey(); key != "" {
+		own[key] = true
+	}
+	own[cfg.RollbackStateObjectKey()] = true
+	runs := config.RunStateDir + "/"
+	if cfg.ContextPath != "" {
+		runs = cfg.ContextPath + "/" + runs
+	}
+
+	results := make([]uploader.UploadResult, 0, len(r.objects))
+	for key, obj := range r.objects {
+		if own[key] || strings.HasPrefix(key, runs) || strings.HasPrefix(key, cfg.Batch.Prefix+"/") {
+			continue
+		}
+		// Reports list ETags without the quotes S3 returns them in.
+		etag := obj.ETag
+		if etag != "" && !strings.HasPrefix(etag, `"`) {
+			etag = `"` + etag + `"`
+		}
+		results = append(results, uploader.UploadResult{Key: key, Size: obj.Size, ETag: etag})
+	}
+	return results
+}
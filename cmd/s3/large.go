@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/hashicorp/go-hclog"
+)
+
+// minSparseSize keeps small files with a few holes from being flagged.
+const minSparseSize = 64 << 20
+
+// largeFile is a planned file flagged by the large file check.
+type largeFile struct {
+	Source    string `json:"source"`
+	Key       string `json:"key"`
+	Size      int64  `json:"size"`
+	Allocated int64  `json:"allocated,omitempty"`
+	Sparse    bool   `json:"sparse,omitempty"`
+}
+
+// largeFileGuard flags files above large_files.threshold and sparse files,
+// which are usually core dumps or disk images swept into the sources by
+// accident. In warn mode they are logged and reported in the summary; the
+// other modes fail the run with guidance before anything is uploaded.
+type largeFileGuard struct {
+	threshold int64
+	action    string
+	partSize  int64
+	logger    hclog.Logger
+
+	mu      sync.Mutex
+	flagged []largeFile
+}
+
+// newLargeFileGuard builds the guard configured by cfg, or nil when no
+// threshold is set.
+func newLargeFileGuard(cfg *config.Config, logger hclog.Logger) *largeFileGuard {
+	if cfg.LargeFiles.Threshold <= 0 {
+		return nil
+	}
+	return &largeFileGuard{
+		threshold: cfg.LargeFiles.Threshold,
+		action:    cfg.LargeFiles.Action,
+		partSize:  cfg.Multipart.PartSize,
+		logger:    logger,
+	}
+}
+
+// checkAll inspects every plan so a failing run lists all offending files.
+func (g *largeFileGuard) checkAll(ctx context.Context, plans []uploader.FilePlan) ([]uploader.FilePlan, error) {
+	var problems []string
+	for _, plan := range plans {
+		if _, err := g.check(ctx, plan); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "\n"))
+	}
+	return plans, nil
+}
+
+// check flags plan when its file is above the threshold or sparse, failing
+// it unless the configured action lets it through.
+func (g *largeFileGuard) check(ctx context.Context, plan uploader.FilePlan) (bool, error) {
+	info, err := os.Stat(plan.Source)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat %s: %w", plan.Source, err)
+	}
+	file := largeFile{Source: plan.Source, Key: plan.Key, Size: info.Size()}
+	if allocated, ok := uploader.AllocatedSize(info); ok && file.Size >= minSparseSize && allocated < file.Size/2 {
+		file.Allocated = allocated
+		file.Sparse = true
+	}
+	if file.Size <= g.threshold && !file.Sparse {
+		return true, nil
+	}
+
+	if file.Size > config.MaxObjectSize {
+		return false, fmt.Errorf("%s exceeds the 5TiB S3 object size limit; exclude it from the sources", g.describe(file))
+	}
+	switch g.action {
+	case config.LargeFileActionError:
+		return false, fmt.Errorf("%s; exclude it from the sources or raise large_files.threshold", g.describe(file))
+	case config.LargeFileActionRequireMultipart:
+		minimum := (file.Size + config.MaxUploadParts - 1) / config.MaxUploadParts
+		if g.partSize == 0 {
+			return false, fmt.Errorf("%s; set multipart.part_size (at least %s for this file) to upload it within the memory limit", g.describe(file), config.FormatByteSize(max(minimum, config.MinPartSize)))
+		}
+		if g.partSize < minimum {
+			return false, fmt.Errorf("%s; multipart.part_size %s would need more than %d parts, use at least %s", g.describe(file), config.FormatByteSize(g.partSize), config.MaxUploadParts, config.FormatByteSize(minimum))
+		}
+	}
+
+	g.logger.Warn("Uploading large file", "source", file.Source, "size", config.FormatByteSize(file.Size), "sparse", file.Sparse)
+	g.mu.Lock()
+	g.flagged = append(g.flagged, file)
+	g.mu.Unlock()
+	return true, nil
+}
+
+// describe names the file, its size and why it was flagged.
+func (g *largeFileGuard) describe(file largeFile) string {
+	description := fmt.Sprintf("%s is %s", file.Source, config.FormatByteSize(file.Size))
+	if file.Sparse {
+		return description + fmt.Sprintf(" but sparse with only %s allocated, likely a core dump or disk image", config.FormatByteSize(file.Allocated))
+	}
+	return description + fmt.Sprintf(", above large_files.threshold %s", config.FormatByteSize(g.threshold))
+}
+
+// report returns the large files accepted for upload so far.
+func (g *largeFileGuard) report() []largeFile {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]largeFile(nil), g.flagged...)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/delivery-station/ds/pkg/types"
+)
+
+func (p *Plugin) handleList(ctx context.Context, baseCfg *config.Config, args types.PluginArgs) (*types.ExecutionResult, error) {
+	if help, ok := args.BoolAny("help", "h"); ok && help {
+		return &types.ExecutionResult{Stdout: listUsage(), ExitCode: 0}, nil
+	}
+
+	merged := baseCfg.Clone()
+	applyTargetOverrides(merged, args)
+	if contextPath, ok := args.FirstAny("context", "context-path"); ok && strings.TrimSpace(contextPath) != "" {
+		merged.ContextPath = strings.Trim(strings.TrimSpace(contextPath), "/")
+	}
+	delimiter, _ := args.First("delimiter")
+
+	targetName, _ := args.First("target")
+	targetCfg, err := merged.ForTarget(targetName)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	if err := targetCfg.Validate(); err != nil {
+		return configFailure(ctx, err), nil
+	}
+	if targetCfg.IsDirectoryBucket() && delimiter != "" && delimiter != "/" {
+		return &types.ExecutionResult{ExitCode: 1, Error: "directory buckets only support the / delimiter"}, nil
+	}
+	selector, err := selectorArgs(targetCfg, args)
+	if err != nil {
+		return configFailure(ctx, err), nil
+	}
+
+	client, err := p.newS3Client(ctx, targetCfg)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	transfer, err := newTransport(client, targetCfg, nil)
+	if err != nil {
+		return configFailure(ctx, err), nil
+	}
+
+	if selector != nil {
+		transfer.SetSelector(*selector)
+	}
+
+	listing, err := transfer.List(ctx, targetCfg.ContextPath, delimiter)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+
+	summary := listSummary{
+		Target:      targetName,
+		Bucket:      targetCfg.Bucket,
+		Region:      targetCfg.Region,
+		ContextPath: targetCfg.ContextPath,
+		Delimiter:   delimiter,
+		Filter:      selector,
+		Listing:     listing,
+	}
+
+	payload, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("failed to encode execution summary: %v", err)}, nil
+	}
+
+	return &types.ExecutionResult{
+		Stdout:   string(payload) + "\n",
+		ExitCode: 0,
+	}, nil
+}
+
+func listUsage() string {
+	return `Usage: ds s3 list [flags]
+
+Lists the objects under the context path, sorted by key. With --delimiter,
+keys below the next delimiter are grouped into prefixes, listing one level
+like a directory. --filter-tag and --filter-metadata list only the objects
+carrying the given tags and user metadata, at one extra request per object.
+
+Flags:
+  --bucket <name>            Override target bucket (defaults to configuration)
+  --region <name>            Override AWS region
+  --context <prefix>         Object prefix/context path to list
+  --target <name>            List a named target from configuration
+  --delimiter <char>         Group keys into prefixes at this delimiter (e.g. /)
+  --filter-tag <key=value>   Only list objects carrying this tag (repeatable)
+  --filter-metadata <key=value>  Only list objects with this user metadata (repeatable)
+  --endpoint <url>           Use a custom S3-compatible endpoint
+  --force-path-style         Force path-style addressing
+  --skip-tls-verify          Disable TLS verification (requires --endpoint)
+  --profile <name>           Shared AWS profile to use
+  --mfa-token <code>         MFA code for credentials.mfa_serial (or $DS_S3_MFA_TOKEN)
+  --debug-aws-config         Log the resolved region, endpoint, addressing, retries, credential source and signer
+`
+}
+
+type listSummary struct {
+	Target      string `json:"target,omitempty"`
+	Bucket      string `json:"bucket"`
+	Region      string `json:"region,omitempty"`
+	ContextPath string `json:"context_path,omitempty"`
+	Delimiter   string `json:"delimiter,omitempty"`
+	// Filter is the selector objects were listed by.
+	Filter *uploader.Selector `json:"filter,omitempty"`
+	uploader.Listing
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/hashicorp/go-hclog"
+)
+
+// logOutput builds the loggers of the plugin process. Every operation gets
+// its own logger with the level and format it was configured with, so
+// operations running at the same time do not change each other's logging.
+type logOutput struct {
+	out io.Writer
+	// level is the level the plugin started with, used by operations for
+	// which the host sets none.
+	level hclog.Level
+	// fields are added to every line, such as the correlation ids of the
+	// host run.
+	fields []interface{}
+}
+
+func newLogOutput(out io.Writer, level hclog.Level, fields ...interface{}) *logOutput {
+	return &logOutput{out: out, level: level, fields: fields}
+}
+
+// processLogger returns the logger for messages outside of an operation,
+// writing JSON lines at the starting level.
+func (o *logOutput) processLogger() hclog.Logger {
+	return o.logger(config.Logging{Format: config.LogFormatJSON}, o.level)
+}
+
+// operationLogger returns the logger of an operation run with cfg.
+func (o *logOutput) operationLogger(cfg *config.Config) hclog.Logger {
+	level := o.level
+	if parsed := hclog.LevelFromString(strings.TrimSpace(cfg.LogLevel)); parsed != hclog.NoLevel {
+		level = parsed
+	}
+	return o.logger(cfg.Logging, level)
+}
+
+func (o *logOutput) logger(logging config.Logging, level hclog.Level) hclog.Logger {
+	var logger hclog.Logger
+	switch logging.Format {
+	case config.LogFormatLogfmt:
+		intercept := hclog.NewInterceptLogger(&hclog.LoggerOptions{
+			Name:   "ds-s3",
+			Output: io.Discard,
+			Level:  level,
+		})
+		intercept.RegisterSink(&logfmtSink{out: o.out, level: level, includeLocation: logging.IncludeLocation})
+		logger = intercept
+	case config.LogFormatConsole:
+		logger = hclog.New(&hclog.LoggerOptions{
+			Name:            "ds-s3",
+			Output:          o.out,
+			Level:           level,
+			Color:           hclog.AutoColor,
+			IncludeLocation: logging.IncludeLocation,
+		})
+	default:
+		logger = hclog.New(&hclog.LoggerOptions{
+			Name:            "ds-s3",
+			Output:          o.out,
+			Level:           level,
+			JSONFormat:      true,
+			IncludeLocation: logging.IncludeLocation,
+		})
+	}
+	if len(o.fields) > 0 {
+		logger = logger.With(o.fields...)
+	}
+	return logger
+}
+
+// logfmtCallerDepth is the number of frames between logfmtSink.Accept and
+// the logging call: the log and level methods of the intercepting logger.
+const logfmtCallerDepth = 3
+
+// logfmtSink writes one key=value line per entry, for tools and humans that
+// read logfmt.
+type logfmtSink struct {
+	out             io.Writer
+	level           hclog.Level
+	includeLocation bool
+}
+
+// Accept implements hclog.SinkAdapter. The intercepting logger serializes
+// calls to its sinks.
+func (s *logfmtSink) Accept(name string, level hclog.Level, msg string, args ...interface{}) {
+	if level < s.level {
+		return
+	}
+	var line strings.Builder
+	line.WriteString("time=" + time.Now().Format(time.RFC3339Nano))
+	line.WriteString(" level=" + level.String())
+	if name != "" {
+		line.WriteString(" logger=" + logfmtValue(name))
+	}
+	if s.includeLocation {
+		if _, file, lineNo, ok := runtime.Caller(logfmtCallerDepth); ok {
+			line.WriteString(" caller=" + logfmtValue(fmt.Sprintf("%s:%d", trimCallerPath(file), lineNo)))
+		}
+	}
+	line.WriteString(" msg=" + logfmtValue(msg))
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			line.WriteString(" EXTRA_VALUE_AT_END=" + logfmtValue(fmt.Sprint(args[i])))
+			break
+		}
+		line.WriteString(" " + logfmtKey(fmt.Sprint(args[i])) + "=" + logfmtValue(formatLogValue(args[i+1])))
+	}
+	line.WriteString("\n")
+	_, _ = io.WriteString(s.out, line.String())
+}
+
+func formatLogValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case hclog.Format:
+		return fmt.Sprintf(v[0].(string), v[1:]...)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// logfmtKey replaces the characters logfmt does not allow in keys.
+func logfmtKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+// logfmtValue quotes value when it is empty or contains spaces, quotes,
+// equals signs or control characters.
+func logfmtValue(value string) string {
+	if value == "" || strings.ContainsFunc(value, func(r rune) bool {
+		return r <= ' ' || r == '=' || r == '"' || r == '\\' || r == 0x7f
+	}) {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// trimCallerPath keeps the last directory and the file name of path, as the
+// hclog formats do.
+func trimCallerPath(path string) string {
+	file := path[strings.LastIndexByte(path, '/')+1:]
+	dir := strings.TrimSuffix(path, "/"+file)
+	if i := strings.LastIndexByte(dir, '/'); i >= 0 {
+		dir = dir[i+1:]
+	}
+	if dir == path {
+		return file
+	}
+	return dir + "/" + file
+}
+
+// forOperation returns a copy of p logging through the logger of an
+// operation run with cfg. The copy shares the lifecycle, configuration
+// snapshots and AWS configurations with p.
+func (p *Plugin) forOperation(cfg *config.Config) *Plugin {
+	op := *p
+	op.logger = p.logs.operationLogger(cfg)
+	return &op
+}
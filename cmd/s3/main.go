@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/delivery-station/ds-s3/internal/buildinfo"
 	pkgplugin "github.com/delivery-station/ds/pkg/plugin"
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc"
 )
 
 var (
@@ -27,21 +29,21 @@ func main() {
 		}
 	}
 
-	logger := hclog.New(&hclog.LoggerOptions{
-		Name:       "ds-s3",
-		Output:     os.Stderr,
-		Level:      hclog.Info,
-		JSONFormat: true,
-	})
+	logs := newLogOutput(os.Stderr, hclog.Info, buildinfo.CorrelationFromEnv(os.LookupEnv).LogFields()...)
 
-	s3Plugin := NewPlugin(logger, version, commit, date)
+	s3Plugin := NewPlugin(logs, version, commit, date)
+	go handleSignals(s3Plugin.logger, s3Plugin.lifecycle)
 
 	plugin.Serve(&plugin.ServeConfig{
 		HandshakeConfig: pkgplugin.Handshake,
 		Plugins: map[string]plugin.Plugin{
 			"ds-plugin": &pkgplugin.DSPlugin{Impl: s3Plugin},
 		},
-		GRPCServer: plugin.DefaultGRPCServer,
+		// The lifecycle counts the calls in flight, so that a shutdown waits
+		// for the results of the canceled commands to be sent.
+		GRPCServer: func(opts []grpc.ServerOption) *grpc.Server {
+			return plugin.DefaultGRPCServer(append(opts, grpc.StatsHandler(s3Plugin.lifecycle)))
+		},
 	})
 }
 
@@ -61,9 +63,21 @@ func printStandaloneHelp() {
 		"ds-s3 is a Delivery Station plugin and must be launched by DS.",
 		"Usage: ds s3 <command> [args]",
 		"Commands:",
-		"  upload   Upload local files or directories to an S3-compatible bucket",
-		"  help     Show this help message",
-		"  version  Show plugin version metadata",
+		"  upload          Upload local files or directories to an S3-compatible bucket",
+		"  download        Download objects under a prefix to a local directory",
+		"  rollback        Restore objects under a prefix to their previous versions",
+		"  snapshot        Copy objects under a prefix to a timestamped snapshot location",
+		"  promote         Copy objects from one prefix or target to another",
+		"  batch           Copy or delete the objects under a prefix with an S3 Batch Operations job",
+		"  bench           Measure upload/download latency and throughput against an endpoint",
+		"  diff            Report keys added, removed or changed between two upload runs",
+		"  list            List objects under a prefix, optionally one level at a time",
+		"  list-versions   List object versions and delete markers under a prefix",
+		"  list-multipart  List incomplete multipart uploads under a prefix",
+		"  info            Show the effective configuration and where each value came from",
+		"  reload          Re-read the host configuration and list what changed since the previous operation",
+		"  help            Show this help message",
+		"  version         Show plugin version metadata",
 	}
 	for _, line := range lines {
 		_, _ = fmt.Fprintln(os.Stdout, line)
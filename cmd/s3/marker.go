@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/hashicorp/go-hclog"
+)
+
+// completionMarker is stored at skip_if_exists_key once an upload succeeded,
+// so that a retried pipeline finds it and uploads nothing.
+type completionMarker struct {
+	RunID       string    `json:"run_id"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// findMarker reports whether the completion marker configured by cfg exists.
+// Markers written by other tools count too, whatever their content.
+func findMarker(ctx context.Context, transfer *uploader.Transport, cfg *config.Config, logger hclog.Logger) (bool, error) {
+	key := cfg.MarkerObjectKey()
+	if key == "" {
+		return false, nil
+	}
+	data, err := transfer.ReadObject(ctx, key)
+	if err != nil {
+		return false, fmt.Errorf("failed to read completion marker: %w", err)
+	}
+	if data == nil {
+		return false, nil
+	}
+	var marker completionMarker
+	if json.Unmarshal(data, &marker) == nil && marker.RunID != "" {
+		logger.Info("Completion marker found, skipping upload", "key", key, "run_id", marker.RunID, "completed_at", marker.CompletedAt)
+	} else {
+		logger.Info("Completion marker found, skipping upload", "key", key)
+	}
+	return true, nil
+}
+
+// writeMarker stores the completion marker configured by cfg for the run id.
+func writeMarker(ctx context.Context, transfer *uploader.Transport, cfg *config.Config, runID string) error {
+	key := cfg.MarkerObjectKey()
+	if key == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(completionMarker{RunID: runID, CompletedAt: time.Now().UTC()}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode completion marker: %w", err)
+	}
+	if err := transfer.WriteObject(ctx, key, data, "application/json"); err != nil {
+		return fmt.Errorf("failed to store completion marker: %w", err)
+	}
+	return nil
+}
+
+// latestPointer is stored at latest_key after a successful upload, so that
+// consumers find the newest artifacts without knowing the context path.
+type latestPointer struct {
+	Bucket      string `json:"bucket"`
+	ContextPath string `json:"context_path"`
+	Manifest    string `json:"manifest,omitempty"`
+	RunID       string `json:"run_id"`
+	// StartedAt is when the run that wrote the pointer started, which
+	// orders builds that finish out of order.
+	StartedAt    time.Time         `json:"started_at"`
+	CompletedAt  time.Time         `json:"completed_at"`
+	Objects      int               `json:"objects"`
+	BuildContext map[string]string `json:"build_context,omitempty"`
+}
+
+// latestAttempts bounds how often writeLatest reads the pointer again after
+// losing a race with a concurrent upload.
+const latestAttempts = 5
+
+// newerThan reports whether the build that wrote p is newer than the one that
+// wrote other: by run id when both are build numbers, otherwise by when their
+// runs started, and for pointers without a start by when they completed.
+func (p latestPointer) newerThan(other latestPointer) bool {
+	if a, err := strconv.ParseUint(p.RunID, 10, 64); err == nil {
+		if b, err := strconv.ParseUint(other.RunID, 10, 64); err == nil {
+			return a > b
+		}
+	}
+	if !p.StartedAt.IsZero() && !other.StartedAt.IsZero() {
+		return p.StartedAt.After(other.StartedAt)
+	}
+	return p.CompletedAt.After(other.CompletedAt)
+}
+
+// writeLatest points latest_key at the context path the upload summarized by
+// summary, started at started, published to. A slower, older build finishing
+// last must not point consumers back at its output, so the pointer is read
+// first and kept when a newer build wrote it. The write is conditional on the
+// pointer read, and a concurrent write makes it read the pointer again.
+func writeLatest(ctx context.Context, transfer *uploader.Transport, cfg *config.Config, summary uploadSummary, started time.Time, logger hclog.Logger) error {
+	if cfg.LatestKey == "" {
+		return nil
+	}
+	pointer := latestPointer{
+		Bucket:       cfg.Bucket,
+		ContextPath:  cfg.ContextPath,
+		Manifest:     cfg.ManifestObjectKey(),
+		RunID:        summary.RunID,
+		StartedAt:    started.UTC(),
+		CompletedAt:  time.Now().UTC(),
+		Objects:      len(summary.ObjectsUploaded),
+		BuildContext: summary.BuildContext,
+	}
+	data, err := json.MarshalIndent(pointer, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode latest pointer: %w", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		stored, etag, err := transfer.ReadObjectETag(ctx, cfg.LatestKey)
+		if err != nil {
+			return fmt.Errorf("failed to read latest pointer: %w", err)
+		}
+		var current latestPointer
+		if stored != nil && json.Unmarshal(stored, &current) == nil && current.newerThan(pointer) {
+			logger.Info("Keeping the latest pointer of a newer build", "key", cfg.LatestKey, "run_id", current.RunID, "context_path", current.ContextPath)
+			return nil
+		}
+		err = transfer.WriteObjectIf(ctx, cfg.LatestKey, data, "application/json", etag)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, uploader.ErrConditionFailed) || attempt == latestAttempts {
+			return fmt.Errorf("failed to store latest pointer: %w", err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/s3fake"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestCompletionMarker(t *testing.T) {
+	ctx := context.Background()
+	fake := s3fake.New()
+	fake.CreateBucket("artifacts")
+	transfer := uploader.NewTransport(fake, fake, "artifacts", true)
+	cfg := &config.Config{Bucket: "artifacts", ContextPath: "builds/7", SkipIfExistsKey: ".done"}
+
+	if found, err := findMarker(ctx, transfer, cfg, hclog.NewNullLogger()); err != nil || found {
+		t.Fatalf("expected no marker before the upload, got %v, %v", found, err)
+	}
+	if err := writeMarker(ctx, transfer, cfg, "run-7"); err != nil {
+		t.Fatalf("writeMarker returned error: %v", err)
+	}
+	object, ok := fake.Object("artifacts", "builds/7/.done")
+	if !ok {
+		t.Fatal("expected the marker below the context path")
+	}
+	var marker completionMarker
+	if err := json.Unmarshal(object.Body, &marker); err != nil || marker.RunID != "run-7" || marker.CompletedAt.IsZero() {
+		t.Errorf("unexpected marker %s, %v", object.Body, err)
+	}
+	if found, err := findMarker(ctx, transfer, cfg, hclog.NewNullLogger()); err != nil || !found {
+		t.Errorf("expected the marker to be found, got %v, %v", found, err)
+	}
+
+	// Markers written by other tools count too.
+	fake.Put("artifacts", s3fake.Object{Key: "builds/8/.done", Body: []byte("ok")})
+	other := &config.Config{Bucket: "artifacts", ContextPath: "builds/8", SkipIfExistsKey: ".done"}
+	if found, err := findMarker(ctx, transfer, other, hclog.NewNullLogger()); err != nil || !found {
+		t.Errorf("expected a foreign marker to be found, got %v, %v", found, err)
+	}
+
+	unset := &config.Config{Bucket: "artifacts", ContextPath: "builds/9"}
+	if err := writeMarker(ctx, transfer, unset, "run-9"); err != nil || len(fake.Keys("artifacts")) != 2 {
+		t.Errorf("expected no marker without skip_if_exists_key, got %v, %v", fake.Keys("artifacts"), err)
+	}
+}
+
+func TestLatestPointer(t *testing.T) {
+	ctx := context.Background()
+	fake := s3fake.New()
+	fake.CreateBucket("artifacts")
+	transfer := uploader.NewTransport(fake, fake, "artifacts", true)
+	cfg := &config.Config{Bucket: "artifacts", ContextPath: "releases/1.2", LatestKey: "releases/latest.json", ManifestKey: "manifest.json"}
+	summary := uploadSummary{
+		RunID:           "run-7",
+		ObjectsUploaded: []uploader.UploadResult{{Key: "releases/1.2/app.js"}, {Key: "releases/1.2/index.html"}},
+		BuildContext:    map[string]string{"commit": "9fceb02"},
+	}
+
+	if err := writeLatest(ctx, transfer, cfg, summary, time.Now(), hclog.NewNullLogger()); err != nil {
+		t.Fatalf("writeLatest returned error: %v", err)
+	}
+	object, ok := fake.Object("artifacts", "releases/latest.json")
+	if !ok {
+		t.Fatal("expected the pointer at latest_key, outside the context path")
+	}
+	var pointer latestPointer
+	if err := json.Unmarshal(object.Body, &pointer); err != nil {
+		t.Fatal(err)
+	}
+	if pointer.Bucket != "artifacts" || pointer.ContextPath != "releases/1.2" || pointer.Manifest != "releases/1.2/manifest.json" ||
+		pointer.RunID != "run-7" || pointer.Objects != 2 || pointer.BuildContext["commit"] != "9fceb02" {
+		t.Errorf("unexpected pointer %+v", pointer)
+	}
+
+	cfg.LatestKey = ""
+	if err := writeLatest(ctx, transfer, cfg, summary, time.Now(), hclog.NewNullLogger()); err != nil || len(fake.Keys("artifacts")) != 1 {
+		t.Errorf("expected no pointer without latest_key, got %v, %v", fake.Keys("artifacts"), err)
+	}
+}
+
+func TestLatestPointerKeepsNewerBuilds(t *testing.T) {
+	ctx := context.Background()
+	fake := s3fake.New()
+	fake.CreateBucket("artifacts")
+	transfer := uploader.NewTransport(fake, fake, "artifacts", true)
+	read := func() latestPointer {
+		t.Helper()
+		object, ok := fake.Object("artifacts", "latest.json")
+		if !ok {
+			t.Fatal("expected a latest pointer")
+		}
+		var pointer latestPointer
+		if err := json.Unmarshal(object.Body, &pointer); err != nil {
+			t.Fatal(err)
+		}
+		return pointer
+	}
+	write := func(path, runID string, started time.Time) error {
+		cfg := &config.Config{Bucket: "artifacts", ContextPath: path, LatestKey: "latest.json"}
+		return writeLatest(ctx, transfer, cfg, uploadSummary{RunID: runID}, started, hclog.NewNullLogger())
+	}
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := write("builds/new", "run-b", start.Add(time.Minute)); err != nil {
+		t.Fatalf("writeLatest returned error: %v", err)
+	}
+	// An older build finishing last leaves the pointer alone.
+	if err := write("builds/old", "run-a", start); err != nil {
+		t.Fatalf("writeLatest returned error: %v", err)
+	}
+	if pointer := read(); pointer.ContextPath != "builds/new" {
+		t.Errorf("expected the newer build to stay latest, got %+v", pointer)
+	}
+
+	// Build numbers order builds regardless of when they started.
+	if err := write("builds/41", "41", start.Add(time.Hour)); err != nil {
+		t.Fatalf("writeLatest returned error: %v", err)
+	}
+	if err := write("builds/40", "40", start.Add(2*time.Hour)); err != nil {
+		t.Fatalf("writeLatest returned error: %v", err)
+	}
+	if pointer := read(); pointer.ContextPath != "builds/41" {
+		t.Errorf("expected build 41 to stay latest, got %+v", pointer)
+	}
+
+	// A write losing a race with another upload reads the pointer again.
+	fake.Inject(s3fake.Fault{Operation: "PutObject", Key: "latest.json", Times: 1, Err: s3fake.APIError("PreconditionFailed", http.StatusPreconditionFailed)})
+	puts := fake.Calls("PutObject")
+	if err := write("builds/42", "42", start.Add(3*time.Hour)); err != nil {
+		t.Fatalf("writeLatest returned error: %v", err)
+	}
+	if pointer := read(); pointer.ContextPath != "builds/42" || fake.Calls("PutObject") != puts+2 {
+		t.Errorf("expected build 42 to be written on the second attempt, got %+v after %d puts", pointer, fake.Calls("PutObject")-puts)
+	}
+}
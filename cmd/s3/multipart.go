@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/delivery-station/ds/pkg/types"
+)
+
+func (p *Plugin) handleListMultipart(ctx context.Context, baseCfg *config.Config, args types.PluginArgs) (*types.ExecutionResult, error) {
+	if help, ok := args.BoolAny("help", "h"); ok && help {
+		return &types.ExecutionResult{Stdout: listMultipartUsage(), ExitCode: 0}, nil
+	}
+
+	merged := baseCfg.Clone()
+	applyTargetOverrides(merged, args)
+	if contextPath, ok := args.FirstAny("context", "context-path"); ok && strings.TrimSpace(contextPath) != "" {
+		merged.ContextPath = strings.Trim(strings.TrimSpace(contextPath), "/")
+	}
+	parts := true
+	if value, ok := args.Bool("parts"); ok {
+		parts = value
+	}
+
+	targetName, _ := args.First("target")
+	targetCfg, err := merged.ForTarget(targetName)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	if err := targetCfg.Validate(); err != nil {
+		return configFailure(ctx, err), nil
+	}
+
+	client, err := p.newS3Client(ctx, targetCfg)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	transfer, err := newTransport(client, targetCfg, nil)
+	if err != nil {
+		return configFailure(ctx, err), nil
+	}
+
+	uploads, err := transfer.ListMultipartUploads(ctx, targetCfg.ContextPath, parts)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+
+	summary := listMultipartSummary{
+		Target:      targetName,
+		Bucket:      targetCfg.Bucket,
+		Region:      targetCfg.Region,
+		ContextPath: targetCfg.ContextPath,
+		Uploads:     uploads,
+	}
+
+	payload, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("failed to encode execution summary: %v", err)}, nil
+	}
+
+	return &types.ExecutionResult{
+		Stdout:   string(payload) + "\n",
+		ExitCode: 0,
+	}, nil
+}
+
+func listMultipartUsage() string {
+	return `Usage: ds s3 list-multipart [flags]
+
+Lists incomplete multipart uploads under the context path, oldest first, with
+the number and total size of the parts uploaded so far.
+
+Flags:
+  --bucket <name>            Override target bucket (defaults to configuration)
+  --region <name>            Override AWS region
+  --context <prefix>         Object prefix/context path to inspect
+  --target <name>            Inspect a named target from configuration
+  --parts=false              Skip listing parts (faster with many uploads)
+  --endpoint <url>           Use a custom S3-compatible endpoint
+  --force-path-style         Force path-style addressing
+  --skip-tls-verify          Disable TLS verification (requires --endpoint)
+  --profile <name>           Shared AWS profile to use
+  --mfa-token <code>         MFA code for credentials.mfa_serial (or $DS_S3_MFA_TOKEN)
+  --debug-aws-config         Log the resolved region, endpoint, addressing, retries, credential source and signer
+`
+}
+
+type listMultipartSummary struct {
+	Target      string                     `json:"target,omitempty"`
+	Bucket      string                     `json:"bucket"`
+	Region      string                     `json:"region,omitempty"`
+	ContextPath string                     `json:"context_path,omitempty"`
+	Uploads     []uploader.MultipartUpload `json:"uploads"`
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/hashicorp/go-hclog"
+)
+
+// packPlans bundles the small files among plans into packs written to a
+// temporary directory, which the returned function removes once the upload
+// is done. Attestations are never packed, as objects are tagged with their
+// digest and consumers fetch them by key. The entries of previous, the index
+// of an earlier upload, are carried over. The returned index is nil when
+// nothing was packed.
+func packPlans(cfg *config.Config, runID string, attestations []attestation, plans []uploader.FilePlan, previous *uploader.PackIndex, logger hclog.Logger) ([]uploader.FilePlan, *uploader.PackIndex, func(), error) {
+	attested := make(map[string]bool, len(attestations))
+	for _, att := range attestations {
+		attested[att.Key] = true
+	}
+	var kept, candidates []uploader.FilePlan
+	for _, plan := range plans {
+		if attested[plan.Key] {
+			kept = append(kept, plan)
+			continue
+		}
+		candidates = append(candidates, plan)
+	}
+
+	dir, err := os.MkdirTemp("", "ds-s3-packs-")
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create pack directory: %w", err)
+	}
+	remove := func() {
+		_ = os.RemoveAll(dir)
+	}
+	packed, index, err := uploader.Pack(candidates, cfg.ContextPath, dir, uploader.PackPolicy{
+		MaxFileSize: cfg.Packing.MaxFileSize,
+		ChunkSize:   cfg.Packing.ChunkSize,
+		Name:        runID,
+		ExtractTar:  cfg.ExtractTar,
+		Previous:    previous,
+	})
+	if err != nil {
+		remove()
+		return nil, nil, nil, fmt.Errorf("packing failed: %w", err)
+	}
+	if index == nil {
+		remove()
+		return plans, nil, func() {}, nil
+	}
+	logger.Info("Packed small files", "files", len(index.Entries), "packs", len(index.Packs), "max_file_size", config.FormatByteSize(cfg.Packing.MaxFileSize))
+	return append(kept, packed...), index, remove, nil
+}
@@ -1,39 +1,74 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/delivery-station/ds-s3/internal/awsauth"
+	"github.com/delivery-station/ds-s3/internal/backoff"
+	"github.com/delivery-station/ds-s3/internal/buildinfo"
 	"github.com/delivery-station/ds-s3/internal/config"
-	"github.com/delivery-station/ds-s3/internal/uploader"
+	"github.com/delivery-station/ds-s3/internal/diagnostics"
+	"github.com/delivery-station/ds-s3/internal/dnscache"
+	"github.com/delivery-station/ds-s3/internal/scan"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
 	"github.com/delivery-station/ds/pkg/types"
 	"github.com/hashicorp/go-hclog"
 )
 
-// Plugin implements the DS PluginProtocol for ds-s3.
+// Plugin implements the DS PluginProtocol for ds-s3. Execute may be called
+// concurrently: every operation runs on a copy of the Plugin with its own
+// logger and configuration, and only the fields shared between the copies
+// are process-wide.
 type Plugin struct {
-	logger  hclog.Logger
-	version string
-	commit  string
-	date    string
+	// logger logs outside of operations; during an operation it is the
+	// operation's logger.
+	logger    hclog.Logger
+	version   string
+	commit    string
+	date      string
+	lifecycle *lifecycle
+	// logs builds the logger of every operation.
+	logs      *logOutput
+	snapshots *configSnapshots
+	// awsConfigs shares AWS configurations between the operations of a
+	// long-lived plugin process.
+	awsConfigs *awsConfigCache
 }
 
 // NewPlugin constructs a Plugin instance.
-func NewPlugin(logger hclog.Logger, version, commit, date string) *Plugin {
+func NewPlugin(logs *logOutput, version, commit, date string) *Plugin {
 	return &Plugin{
-		logger:  logger,
-		version: version,
-		commit:  commit,
-		date:    date,
+		logger:     logs.processLogger(),
+		version:    version,
+		commit:     commit,
+		date:       date,
+		lifecycle:  newLifecycle(),
+		logs:       logs,
+		snapshots:  &configSnapshots{},
+		awsConfigs: &awsConfigCache{},
 	}
 }
 
@@ -44,6 +79,18 @@ func (p *Plugin) GetManifest(ctx context.Context) (*types.PluginInfo, error) {
 		Description: "Upload artifacts to S3-compatible storage",
 		Commands: []types.PluginCommand{
 			{Name: "upload", Description: "Upload artifacts to an S3 bucket"},
+			{Name: "download", Description: "Download objects under a prefix to a local directory"},
+			{Name: "rollback", Description: "Restore objects under a prefix to their previous versions"},
+			{Name: "snapshot", Description: "Copy objects under a prefix to a timestamped snapshot location"},
+			{Name: "promote", Description: "Copy objects from one prefix or target to another"},
+			{Name: "batch", Description: "Copy or delete the objects under a prefix with an S3 Batch Operations job"},
+			{Name: "bench", Description: "Measure upload/download latency and throughput against an endpoint"},
+			{Name: "diff", Description: "Report keys added, removed or changed between two upload runs"},
+			{Name: "list", Description: "List objects under a prefix, optionally one level at a time"},
+			{Name: "list-versions", Description: "List object versions and delete markers under a prefix"},
+			{Name: "list-multipart", Description: "List incomplete multipart uploads under a prefix"},
+			{Name: "info", Description: "Show the effective configuration and where each value came from"},
+			{Name: "reload", Description: "Re-read the host configuration and list the settings changed since the previous operation"},
 			{Name: "help", Description: "Show usage information"},
 			{Name: "version", Description: "Display plugin version information"},
 		},
@@ -55,23 +102,113 @@ func (p *Plugin) GetManifest(ctx context.Context) (*types.PluginInfo, error) {
 }
 
 func (p *Plugin) Execute(ctx context.Context, operation string, args []string) (*types.ExecutionResult, error) {
+	ctx, done := p.lifecycle.begin(ctx)
+	defer done()
+	started := time.Now().UTC()
+
 	cfg, err := config.LoadFromHost(ctx, p.logger)
 	if err != nil {
 		p.logger.Error("Failed to load configuration from host", "error", err)
 		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
 	}
 
-	if level := strings.TrimSpace(cfg.LogLevel); level != "" {
-		if parsed := hclog.LevelFromString(level); parsed != hclog.NoLevel {
-			p.logger.SetLevel(parsed)
-		}
+	local, err := p.applyLocalConfig(cfg)
+	if err != nil {
+		p.logger.Error("Failed to load local configuration", "error", err)
+		return &types.ExecutionResult{ExitCode: cfg.ExitCode(diagnostics.ClassConfig), Error: err.Error()}, nil
+	}
+	cfg = local
+	// From here on the operation logs at its own level and in its own format.
+	p = p.forOperation(cfg)
+	for _, deprecation := range cfg.Deprecations() {
+		p.logger.Warn("Deprecated setting", "detail", deprecation)
+	}
+	changed, hadPrevious := p.snapshots.record(cfg)
+	if len(changed) > 0 {
+		p.logger.Info("Host configuration changed since the previous operation", "settings", changed)
 	}
 
 	parsedArgs := types.NewPluginArgs(args)
+	envCfg, err := p.selectEnvironment(cfg, parsedArgs)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: cfg.ExitCode(diagnostics.ClassConfig), Error: err.Error()}, nil
+	}
+	cfg, err = envCfg.ForOperation(operation)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: envCfg.ExitCode(diagnostics.ClassConfig), Error: err.Error()}, nil
+	}
+	if report, ok := parsedArgs.First("failure-report"); ok && strings.TrimSpace(report) != "" {
+		cfg.FailureReport = strings.TrimSpace(report)
+	}
+	if dryRun, ok := parsedArgs.Bool("dry-run"); ok {
+		cfg.DryRun = dryRun
+	}
+	if cfg.DryRun {
+		p.logger.Info("Dry run, nothing is written to the bucket", "operation", operation)
+	}
+	p.lifecycle.setGrace(cfg.ShutdownGracePeriod)
 
+	ctx, failures := trackFailures(ctx, operation, p.version, cfg)
+	ctx, audited := trackAuditConfig(ctx, cfg)
+	var result *types.ExecutionResult
+	if operation == "reload" {
+		result, err = p.handleReload(ctx, cfg, changed, hadPrevious, parsedArgs)
+	} else {
+		result, err = p.dispatch(ctx, operation, cfg, parsedArgs)
+	}
+	if err == nil && result != nil && result.ExitCode != 0 {
+		result.ExitCode = cfg.ExitCode(failures.class(result.Error))
+	}
+	if err == nil && result != nil {
+		if key, auditErr := p.writeAudit(ctx, operation, args, audited.config(), started, result); auditErr != nil {
+			if !cfg.Audit.Required {
+				p.logger.Warn("Failed to store audit record", "error", auditErr)
+			} else if result.ExitCode == 0 {
+				result.Error = auditErr.Error()
+				result.ExitCode = cfg.ExitCode(failures.class(result.Error))
+			} else {
+				result.Error += "; " + auditErr.Error()
+			}
+		} else if key != "" {
+			p.logger.Info("Audit record stored", "key", key)
+		}
+	}
+	if err == nil && result != nil && result.ExitCode != 0 && result.Error != "" {
+		if reportErr := failures.write(cfg.FailureReport, result.Error); reportErr != nil {
+			p.logger.Warn("Failed to write failure report", "path", cfg.FailureReport, "error", reportErr)
+		} else {
+			p.logger.Info("Failure report written", "path", cfg.FailureReport)
+		}
+	}
+	return result, err
+}
+
+func (p *Plugin) dispatch(ctx context.Context, operation string, cfg *config.Config, parsedArgs types.PluginArgs) (*types.ExecutionResult, error) {
 	switch operation {
 	case "upload":
 		return p.handleUpload(ctx, cfg, parsedArgs)
+	case "download":
+		return p.handleDownload(ctx, cfg, parsedArgs)
+	case "rollback":
+		return p.handleRollback(ctx, cfg, parsedArgs)
+	case "snapshot":
+		return p.handleSnapshot(ctx, cfg, parsedArgs)
+	case "promote":
+		return p.handlePromote(ctx, cfg, parsedArgs)
+	case "batch":
+		return p.handleBatch(ctx, cfg, parsedArgs)
+	case "bench":
+		return p.handleBench(ctx, cfg, parsedArgs)
+	case "diff":
+		return p.handleDiff(ctx, cfg, parsedArgs)
+	case "list":
+		return p.handleList(ctx, cfg, parsedArgs)
+	case "list-versions":
+		return p.handleListVersions(ctx, cfg, parsedArgs)
+	case "list-multipart":
+		return p.handleListMultipart(ctx, cfg, parsedArgs)
+	case "info":
+		return p.handleInfo(ctx, cfg, parsedArgs)
 	case "help":
 		return &types.ExecutionResult{
 			Stdout:   uploadUsage(),
@@ -83,7 +220,7 @@ func (p *Plugin) Execute(ctx context.Context, operation string, args []string) (
 			ExitCode: 0,
 		}, nil
 	default:
-		return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("unknown operation: %s", operation)}, nil
+		return configFailure(ctx, fmt.Errorf("unknown operation: %s", operation)), nil
 	}
 }
 
@@ -92,16 +229,77 @@ func (p *Plugin) ValidateConfig(ctx context.Context, raw map[string]interface{})
 	if err != nil {
 		return err
 	}
-	return cfg.Validate()
+
+	// With overlays configured the base settings may be incomplete on their
+	// own, so each environment is validated as it would be resolved instead.
+	names := cfg.EnvironmentNames()
+	if len(names) == 0 {
+		return validateOperations(cfg)
+	}
+	for _, name := range names {
+		envCfg, err := cfg.ForEnvironment(name)
+		if err != nil {
+			return err
+		}
+		if err := validateOperations(envCfg); err != nil {
+			return fmt.Errorf("environment %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// validateOperations validates cfg and every operation default layered over it.
+func validateOperations(cfg *config.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	for _, name := range cfg.OperationNames() {
+		opCfg, err := cfg.ForOperation(name)
+		if err != nil {
+			return err
+		}
+		if err := opCfg.Validate(); err != nil {
+			return fmt.Errorf("operations.%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// applyLocalConfig merges the local settings file of the working directory, if
+// any, over the host configuration.
+func (p *Plugin) applyLocalConfig(cfg *config.Config) (*config.Config, error) {
+	resolved, applied, err := cfg.WithLocalFile(config.LocalFileName)
+	if err != nil {
+		return nil, err
+	}
+	if applied {
+		p.logger.Debug("Merged local configuration", "path", config.LocalFileName)
+	}
+	return resolved, nil
+}
+
+// selectEnvironment layers the environment overlay chosen by --env, or by
+// DS_ENV when the flag is absent, over the host configuration. A DS_ENV value
+// without a matching overlay is ignored so pipelines can export it globally.
+func (p *Plugin) selectEnvironment(cfg *config.Config, args types.PluginArgs) (*config.Config, error) {
+	name, ok := args.First("env")
+	if !ok || strings.TrimSpace(name) == "" {
+		name = strings.TrimSpace(os.Getenv(config.EnvironmentVariable))
+		if name != "" && !cfg.HasEnvironment(name) {
+			p.logger.Debug("Ignoring environment without an overlay", "variable", config.EnvironmentVariable, "environment", name)
+			return cfg, nil
+		}
+	}
+	return cfg.ForEnvironment(name)
 }
 
 func (p *Plugin) GetSchema(ctx context.Context) (*types.PluginSchema, error) {
-	return &types.PluginSchema{
+	schema := &types.PluginSchema{
 		Version: "1.0.0",
 		Properties: map[string]types.SchemaProperty{
 			"bucket": {
 				Type:        "string",
-				Description: "Target S3 bucket name",
+				Description: "Target S3 bucket name (including --x-s3 directory buckets), or an access point / Object Lambda access point / Multi-Region Access Point ARN",
 				Required:    true,
 			},
 			"region": {
@@ -114,13 +312,17 @@ func (p *Plugin) GetSchema(ctx context.Context) (*types.PluginSchema, error) {
 			},
 			"sources": {
 				Type:        "array",
-				Description: "Default source paths used when no CLI paths are supplied",
+				Description: "Default source paths used when no CLI paths are supplied; local_path=remote_key stores a file at, or a directory under, that key below the context path",
 			},
 			"cleanup": {
 				Type:        "boolean",
 				Description: "Remove existing objects beneath the context path before uploading",
 				Default:     "false",
 			},
+			"cleanup_tags": {
+				Type:        "object",
+				Description: "Only clean up objects carrying all of these tags (e.g. ephemeral: \"true\")",
+			},
 			"overwrite": {
 				Type:        "boolean",
 				Description: "Overwrite objects when they already exist",
@@ -144,6 +346,528 @@ func (p *Plugin) GetSchema(ctx context.Context) (*types.PluginSchema, error) {
 				Type:        "string",
 				Description: "Shared AWS credentials profile name",
 			},
+			"targets": {
+				Type:        "object",
+				Description: "Named alternate buckets/endpoints (bucket, region, endpoint, force_path_style, tls, profile, credentials, backend) addressable by operations",
+			},
+			"environments": {
+				Type:        "object",
+				Description: "Named settings overlays (any plugin setting) selected with --env or DS_ENV and merged over the base settings",
+			},
+			"operations": {
+				Type:        "object",
+				Description: "Per-operation default settings (e.g. operations.upload.cleanup) merged before CLI flags",
+			},
+			"replication.targets": {
+				Type:        "array",
+				Description: "Named targets that receive a copy of every upload",
+			},
+			"replication.require_all": {
+				Type:        "boolean",
+				Description: "Fail the run when any replication target fails",
+				Default:     "true",
+			},
+			"concurrency": {
+				Type:        "integer",
+				Description: "Number of files uploaded in parallel",
+				Default:     "1",
+			},
+			"stream_plans": {
+				Type:        "boolean",
+				Description: "Start uploading while source directories are still being walked instead of planning everything first",
+				Default:     "false",
+			},
+			"walk_concurrency": {
+				Type:        "integer",
+				Description: "Directories read in parallel while walking sources, for slow network file systems; 0 or 1 walks sequentially",
+				Default:     "1",
+			},
+			"file_policy.empty": {
+				Type:        "string",
+				Description: "Empty files in the sources: upload, skip or error",
+				Default:     "upload",
+			},
+			"file_policy.special": {
+				Type:        "string",
+				Description: "FIFOs, sockets, devices and other special files in the sources: error, skip or upload_empty",
+				Default:     "error",
+			},
+			"large_files.threshold": {
+				Type:        "string",
+				Description: "Flag source files above this size (e.g. 10GiB) and sparse files such as core dumps; empty disables the check",
+				Default:     "",
+			},
+			"large_files.action": {
+				Type:        "string",
+				Description: "Files flagged by large_files.threshold: warn, require_multipart or error",
+				Default:     "warn",
+			},
+			"ignore_files": {
+				Type:        "boolean",
+				Description: "Leave out files matched by .s3ignore and .dsignore files (gitignore syntax) in source directories",
+				Default:     "true",
+			},
+			"respect_gitignore": {
+				Type:        "boolean",
+				Description: "Leave out files ignored by the .gitignore files and info/exclude of the git repository containing each source directory",
+				Default:     "false",
+			},
+			"max_depth": {
+				Type:        "integer",
+				Description: "Directory levels walked below each source directory (1 = only its files); 0 walks the whole tree",
+				Default:     "0",
+			},
+			"strip_components": {
+				Type:        "integer",
+				Description: "Leading path elements removed from the keys of files in source directories, like tar --strip-components",
+				Default:     "0",
+			},
+			"limits.max_files": {
+				Type:        "integer",
+				Description: "Abort planning when the sources contain more files than this; 0 disables the limit",
+				Default:     "0",
+			},
+			"limits.max_total_size": {
+				Type:        "string",
+				Description: "Abort planning when the sources add up to more than this size (e.g. 50GiB); empty disables the limit",
+				Default:     "",
+			},
+			"expect.min_files": {
+				Type:        "integer",
+				Description: "Fail the upload when the sources contain fewer files than this, e.g. an empty dist directory; 0 disables the check",
+				Default:     "0",
+			},
+			"expect.min_total_size": {
+				Type:        "string",
+				Description: "Fail the upload when the sources add up to less than this size (e.g. 1MiB); empty disables the check",
+				Default:     "",
+			},
+			"verify.wait": {
+				Type:        "string",
+				Description: "After uploading, retry HeadObject until the uploaded objects are visible, failing after this long (e.g. 2m); 0 disables the check",
+				Default:     "0s",
+			},
+			"verify.interval": {
+				Type:        "string",
+				Description: "Pause between checks for the uploaded objects to be visible",
+				Default:     config.DefaultVerifyInterval.String(),
+			},
+			"verify.sample": {
+				Type:        "integer",
+				Description: "Check this many randomly chosen uploaded objects instead of all; 0 checks all",
+				Default:     "0",
+			},
+			"run_id": {
+				Type:        "string",
+				Description: "Stable id of the run, recorded on every object, so a re-run skips completed cleanup, snapshot and uploads; defaults to DS_RUN_ID, else a generated id",
+				Default:     "",
+			},
+			"shutdown_grace_period": {
+				Type:        "string",
+				Description: "How long a command canceled by SIGTERM or SIGINT may take to abort its multipart uploads and write its failure report before the plugin exits",
+				Default:     config.DefaultShutdownGracePeriod.String(),
+			},
+			"exit_codes": {
+				Type:        "object",
+				Description: "Exit codes (1-125) reported for classes of failed commands instead of 1, e.g. partial: 2, config: 3, auth: 4, not_found: 5",
+			},
+			"backend": {
+				Type:        "string",
+				Description: "Backend requests go through: s3; gcs for the XML API of Google Cloud Storage with HMAC keys as credentials (endpoint and region default to Cloud Storage; tags, S3 encryption and checksums are unsupported); azure-gateway for Azure Blob behind an S3 gateway (single-object deletes, objects compared by size instead of ETag)",
+				Default:     uploader.BackendS3,
+			},
+			"local_config": {
+				Type:        "boolean",
+				Description: "Merge the .ds-s3.yaml file of the working directory over these settings; it may only set the context path, sources, headers, ignore and layout rules, marker keys and expectations, and environments, operation defaults and flags still apply on top",
+				Default:     "true",
+			},
+			"strict_settings": {
+				Type:        "boolean",
+				Description: "Reject unknown settings keys (e.g. a misspelled contex_path) instead of ignoring them",
+				Default:     "false",
+			},
+			"failure_report": {
+				Type:        "string",
+				Description: "File a failed command writes its failure report to: the failed S3 requests with status, request id and retries, and the files an upload left out for --retry-from",
+				Default:     config.DefaultFailureReport,
+			},
+			"dry_run": {
+				Type:        "boolean",
+				Description: "Preview every operation: list and read the bucket, but write, copy and delete nothing and submit no batch jobs",
+				Default:     "false",
+			},
+			"summary.max_objects": {
+				Type:        "integer",
+				Description: "Objects listed in the upload summary on stdout; larger runs list the first ones and write the full summary to summary.file. 0 lists every object",
+				Default:     strconv.Itoa(config.DefaultSummaryMaxObjects),
+			},
+			"summary.file": {
+				Type:        "string",
+				Description: "File the full upload summary is written to when the one on stdout is truncated",
+				Default:     config.DefaultSummaryFile,
+			},
+			"progress.file": {
+				Type:        "string",
+				Description: "File an upload rewrites with its progress (bytes and files done, current file, ETA) for monitors to poll; empty disables it",
+				Default:     "",
+			},
+			"progress.interval": {
+				Type:        "string",
+				Description: "How often an upload logs its progress, with throughput and ETA, and rewrites the progress file (e.g. 5s)",
+				Default:     config.DefaultProgressInterval.String(),
+			},
+			"packing.enabled": {
+				Type:        "boolean",
+				Description: "Bundle small files into tar packs uploaded with an index to .packs below the context path; download extracts them again",
+				Default:     "false",
+			},
+			"packing.max_file_size": {
+				Type:        "string",
+				Description: "Size up to which packing bundles files (e.g. 64KiB)",
+				Default:     "64KiB",
+			},
+			"packing.chunk_size": {
+				Type:        "string",
+				Description: "Size a pack is closed at and the next one started (e.g. 64MiB)",
+				Default:     "64MiB",
+			},
+			"batch.role_arn": {
+				Type:        "string",
+				Description: "Role S3 Batch Operations assumes to read the manifest, copy or delete the objects and write the report",
+				Default:     "",
+			},
+			"batch.account_id": {
+				Type:        "string",
+				Description: "Account batch jobs run in; defaults to the account of batch.role_arn",
+				Default:     "",
+			},
+			"batch.prefix": {
+				Type:        "string",
+				Description: "Key prefix in the bucket batch job manifests and completion reports are written below",
+				Default:     config.DefaultBatchPrefix,
+			},
+			"batch.priority": {
+				Type:        "integer",
+				Description: "Priority of submitted batch jobs; higher runs first",
+				Default:     strconv.Itoa(config.DefaultBatchPriority),
+			},
+			"batch.poll_interval": {
+				Type:        "string",
+				Description: "How often the status of a submitted batch job is checked while waiting for it (e.g. 30s)",
+				Default:     config.DefaultBatchPollInterval.String(),
+			},
+			"batch.delete_function_arn": {
+				Type:        "string",
+				Description: "Lambda function batch delete invokes on every object to delete it",
+				Default:     "",
+			},
+			"inventory.bucket": {
+				Type:        "string",
+				Description: "Bucket S3 Inventory reports are delivered to; defaults to the bucket",
+				Default:     "",
+			},
+			"inventory.prefix": {
+				Type:        "string",
+				Description: "Key prefix of the reports of one inventory configuration (<destination prefix>/<source bucket>/<configuration id>); reads the latest report as the remote state for sync and diff",
+				Default:     "",
+			},
+			"inventory.max_age": {
+				Type:        "string",
+				Description: "Age after which an inventory report is not trusted (e.g. 48h); 0 accepts any age",
+				Default:     "0s",
+			},
+			"audit.bucket": {
+				Type:        "string",
+				Description: "Bucket audit records are stored in (defaults to bucket)",
+				Default:     "",
+			},
+			"audit.prefix": {
+				Type:        "string",
+				Description: "Key prefix below which a record of every upload, promote, rollback, snapshot and batch run is stored; empty stores none",
+				Default:     "",
+			},
+			"audit.required": {
+				Type:        "boolean",
+				Description: "Fail a run whose audit record cannot be stored instead of logging a warning",
+				Default:     "false",
+			},
+			"throttle.timezone": {
+				Type:        "string",
+				Description: "IANA time zone of the throttle windows (e.g. Europe/Berlin); empty uses the zone of the host",
+				Default:     "",
+			},
+			"throttle.windows": {
+				Type:        "array",
+				Description: "Windows (days, start, end, concurrency, bandwidth) during which uploads send fewer files at once or fewer bytes per second; the first active window applies",
+			},
+			"extract_tar": {
+				Type:        "boolean",
+				Description: "Upload the entries of .tar, .tar.gz and .tgz sources as individual objects instead of the archive",
+				Default:     "false",
+			},
+			"decompress": {
+				Type:        "boolean",
+				Description: "Gunzip downloaded objects stored with Content-Encoding gzip or under a .gz key",
+				Default:     "false",
+			},
+			"sync.enabled": {
+				Type:        "boolean",
+				Description: "Only upload files changed since the last successful sync, tracked in a state object in the bucket",
+				Default:     "false",
+			},
+			"sync.state_key": {
+				Type:        "string",
+				Description: "Key of the sync state object below the context path",
+				Default:     config.DefaultSyncStateKey,
+			},
+			"sync.cache_dir": {
+				Type:        "string",
+				Description: "Keep the sync state in a local cache database in this directory instead of the bucket",
+			},
+			"manifest_key": {
+				Type:        "string",
+				Description: "Store each upload summary at this key below the context path, keeping the previous one for diff",
+			},
+			"skip_if_exists_key": {
+				Type:        "string",
+				Description: "Marker object below the context path; an upload finding it exits successfully without uploading, and a successful upload writes it",
+			},
+			"latest_key": {
+				Type:        "string",
+				Description: "Key in the bucket, outside the context path, where a successful upload stores a pointer to its context path, manifest and run",
+			},
+			"build_context.enabled": {
+				Type:        "boolean",
+				Description: "Stamp uploaded objects with the DS pipeline name, run id and commit",
+				Default:     "false",
+			},
+			"build_context.tags": {
+				Type:        "boolean",
+				Description: "Write the build context as object tags",
+				Default:     "true",
+			},
+			"build_context.metadata": {
+				Type:        "boolean",
+				Description: "Write the build context as user metadata",
+				Default:     "true",
+			},
+			"build_context.git": {
+				Type:        "boolean",
+				Description: "Add the sha, branch, tag and dirty flag of the local git checkout to the build context",
+				Default:     "false",
+			},
+			"secret_scan.enabled": {
+				Type:        "boolean",
+				Description: "Scan planned files for potential secrets before uploading",
+				Default:     "false",
+			},
+			"secret_scan.mode": {
+				Type:        "string",
+				Description: "block fails the run on findings, warn only reports them",
+				Default:     "block",
+			},
+			"secret_scan.patterns": {
+				Type:        "object",
+				Description: "Additional named regular expressions that identify secrets",
+			},
+			"secret_scan.entropy_threshold": {
+				Type:        "number",
+				Description: "Flag 32+ character tokens at or above this Shannon entropy (bits per character); 0 disables",
+				Default:     "0",
+			},
+			"secret_scan.max_file_size": {
+				Type:        "string",
+				Description: "Skip files larger than this size, e.g. 10MiB",
+				Default:     "10MiB",
+			},
+			"antivirus.enabled": {
+				Type:        "boolean",
+				Description: "Scan every planned file for malware before uploading",
+				Default:     "false",
+			},
+			"antivirus.clamd": {
+				Type:        "string",
+				Description: "clamd address, e.g. unix:///var/run/clamav/clamd.ctl or tcp://clamav:3310",
+			},
+			"antivirus.command": {
+				Type:        "array",
+				Description: "External scanner command; the file path is appended and exit status 1 means infected",
+			},
+			"antivirus.action": {
+				Type:        "string",
+				Description: "block fails the run on detection, quarantine leaves infected files out of the upload",
+				Default:     "block",
+			},
+			"multipart.part_size": {
+				Type:        "string",
+				Description: "Multipart part size, e.g. 16MiB (minimum 5MiB)",
+				Default:     "5MiB",
+			},
+			"multipart.concurrency": {
+				Type:        "integer",
+				Description: "Parts uploaded in parallel per object",
+				Default:     "5",
+			},
+			"checksum_type": {
+				Type:        "string",
+				Description: "Checksum of multipart uploads: composite (checksum of part checksums) or full-object (CRC of the whole content)",
+			},
+			"checksum_algorithm": {
+				Type:        "string",
+				Description: "Checksum algorithm for uploads: crc32, crc32c, crc64nvme, sha1 or sha256",
+			},
+			"checksum_metadata": {
+				Type:        "boolean",
+				Description: "Store the SHA-256 of every uploaded file as x-amz-meta-sha256",
+				Default:     "false",
+			},
+			"memory_limit": {
+				Type:        "string",
+				Description: "Ceiling for part buffers shared by all concurrent uploads, e.g. 256MiB",
+			},
+			"encryption.mode": {
+				Type:        "string",
+				Description: "Server-side encryption for written objects: AES256, aws:kms or aws:kms:dsse",
+			},
+			"encryption.kms_key_id": {
+				Type:        "string",
+				Description: "KMS key id, ARN or alias used with the aws:kms modes",
+			},
+			"encryption.bucket_key": {
+				Type:        "boolean",
+				Description: "Use an S3 Bucket Key for aws:kms objects so S3 does not call KMS for every object; unset follows the bucket configuration",
+				Default:     "false",
+			},
+			"encryption.preflight": {
+				Type:        "boolean",
+				Description: "Check with a GenerateDataKey dry run that every configured KMS key may be used before the first write",
+				Default:     "true",
+			},
+			"encryption.preflight_strict": {
+				Type:        "boolean",
+				Description: "Fail the command when the KMS preflight is denied a key instead of logging a warning",
+				Default:     "false",
+			},
+			"encryption.key_rules": {
+				Type:        "array",
+				Description: "Rules (pattern, kms_key_id) selecting another KMS key for the object keys matching a prefix or glob; the first matching rule applies",
+			},
+			"attestations.sbom": {
+				Type:        "string",
+				Description: "SBOM published below .attestations with every upload; objects are tagged with its SHA-256",
+			},
+			"attestations.provenance": {
+				Type:        "string",
+				Description: "SLSA provenance statement published below .attestations with every upload; objects are tagged with its SHA-256",
+			},
+			"client_encryption.kms_key_id": {
+				Type:        "string",
+				Description: "KMS key wrapping the per-object data keys of client-side encryption",
+			},
+			"client_encryption.key": {
+				Type:        "string",
+				Description: "Base64-encoded 256-bit key wrapping the per-object data keys of client-side encryption",
+			},
+			"policy.require_encryption": {
+				Type:        "boolean",
+				Description: "Refuse uploads unless encryption.mode is set or the bucket has default encryption",
+				Default:     "false",
+			},
+			"policy.allowed_prefixes": {
+				Type:        "array",
+				Description: "Key prefixes every write and delete must stay within, whatever the flags say; empty allows the whole bucket",
+			},
+			"policy.forbidden_patterns": {
+				Type:        "array",
+				Description: "Patterns of files that are never uploaded, such as *.pem or id_rsa*; uploads containing a match fail listing every such file",
+			},
+			"policy.max_object_size": {
+				Type:        "string",
+				Description: "Refuse to upload files larger than this size (e.g. 2GiB), failing with a list of every such file; empty disables the limit",
+				Default:     "",
+			},
+			"acl.canned": {
+				Type:        "string",
+				Description: "Canned ACL applied to uploaded and copied objects (private, public-read, public-read-write, authenticated-read, aws-exec-read, bucket-owner-read, bucket-owner-full-control)",
+				Default:     "",
+			},
+			"acl.when_disabled": {
+				Type:        "string",
+				Description: "What to do when the bucket has ACLs disabled (Object Ownership BucketOwnerEnforced): fail before the first write, or drop the ACL",
+				Default:     config.ACLDisabledFail,
+			},
+			"logging.format": {
+				Type:        "string",
+				Description: "Format of the plugin's log lines: json, which DS renders in its own format, or logfmt and console for reading the plugin output directly",
+				Default:     config.LogFormatJSON,
+			},
+			"logging.include_location": {
+				Type:        "boolean",
+				Description: "Add the file and line of the logging call to every log line",
+				Default:     "false",
+			},
+			"http.max_idle_conns_per_host": {
+				Type:        "integer",
+				Description: "Idle connections kept per host; raise for highly concurrent uploads to a single endpoint",
+				Default:     "10",
+			},
+			"http.disable_http2": {
+				Type:        "boolean",
+				Description: "Use HTTP/1.1 only",
+				Default:     "false",
+			},
+			"http.disable_keepalives": {
+				Type:        "boolean",
+				Description: "Open a new connection for every request",
+				Default:     "false",
+			},
+			"http.idle_conn_timeout": {
+				Type:        "string",
+				Description: "Close idle connections after this duration, e.g. 90s",
+				Default:     "90s",
+			},
+			"dns.cache": {
+				Type:        "boolean",
+				Description: "Resolve the custom endpoint once per run and re-resolve only when connecting fails",
+				Default:     "false",
+			},
+			"dns.pin": {
+				Type:        "array",
+				Description: "Static IP addresses for the custom endpoint host; DNS is used only when none accepts connections",
+			},
+			"user_agent_suffix": {
+				Type:        "string",
+				Description: "Appended to the User-Agent of every S3 request, e.g. team/payments",
+			},
+			"request_headers": {
+				Type:        "object",
+				Description: "Headers set on every S3 request, e.g. for gateway accounting or routing",
+			},
+			"retry.max_attempts": {
+				Type:        "integer",
+				Description: "Attempts per S3 request including the first",
+				Default:     "3",
+			},
+			"retry.max_backoff": {
+				Type:        "string",
+				Description: "Longest computed delay between attempts, e.g. 20s; Retry-After headers are honoured up to 2m",
+				Default:     "20s",
+			},
+			"snapshot.enabled": {
+				Type:        "boolean",
+				Description: "Copy existing objects beneath the context path to a timestamped snapshot before uploading",
+				Default:     "false",
+			},
+			"snapshot.prefix": {
+				Type:        "string",
+				Description: "Root prefix under which snapshots are stored",
+				Default:     "snapshots",
+			},
+			"credentials.source": {
+				Type:        "string",
+				Description: "Where credentials come from: auto (static keys, else the SDK default chain), static, profile, imds (EC2 instance role over IMDSv2), ecs (container credentials endpoint) or web_identity (AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE); a pinned source that is unavailable fails the run",
+				Default:     awsauth.SourceAuto,
+			},
 			"credentials.access_key_id": {
 				Type:        "string",
 				Description: "AWS access key ID override",
@@ -156,112 +880,1092 @@ func (p *Plugin) GetSchema(ctx context.Context) (*types.PluginSchema, error) {
 				Type:        "string",
 				Description: "AWS session token override",
 			},
+			"credentials.role_arn": {
+				Type:        "string",
+				Description: "IAM role assumed with the static credentials or the default chain; its sessions are renewed before they expire",
+			},
+			"credentials.role_session_name": {
+				Type:        "string",
+				Description: "Session name of the assumed role",
+				Default:     awsauth.DefaultRoleSessionName,
+			},
+			"credentials.external_id": {
+				Type:        "string",
+				Description: "External ID required by the trust policy of the assumed role",
+			},
+			"credentials.mfa_serial": {
+				Type:        "string",
+				Description: "MFA device (ARN or serial number) required to assume credentials.role_arn; the code comes from --mfa-token, DS_S3_MFA_TOKEN or a terminal prompt",
+			},
+			"credentials.role_duration": {
+				Type:        "string",
+				Description: "Lifetime of each role session between 15m and 12h (e.g. 1h); defaults to the STS default of one hour",
+			},
 		},
+	}
+	// Renamed settings are still read, so hosts validating against the
+	// schema must accept them too.
+	for _, rename := range config.Renames {
+		schema.Properties[rename.Old] = types.SchemaProperty{
+			Type:        cmp.Or(schema.Properties[rename.New].Type, "string"),
+			Description: fmt.Sprintf("Deprecated: renamed to %s", rename.New),
+		}
+	}
+	return schema, nil
+}
+
+func (p *Plugin) handleUpload(ctx context.Context, baseCfg *config.Config, args types.PluginArgs) (*types.ExecutionResult, error) {
+	if help, ok := args.BoolAny("help", "h"); ok && help {
+		return &types.ExecutionResult{Stdout: uploadUsage(), ExitCode: 0}, nil
+	}
+
+	format, err := outputFormat(args)
+	if err != nil {
+		return configFailure(ctx, err), nil
+	}
+
+	merged := baseCfg.Clone()
+	auditConfigFrom(ctx).use(merged)
+	if err := applyUploadOverrides(merged, args); err != nil {
+		return configFailure(ctx, err), nil
+	}
+
+	retryFrom, _ := args.First("retry-from")
+	retryFrom = strings.TrimSpace(retryFrom)
+	sources := trimmedArgs(args.Positionals())
+	for _, value := range trimmedArgs(args.All("source")) {
+		sources = append(sources, prefixedSource(value))
+	}
+	if retryFrom != "" {
+		if len(sources) > 0 {
+			return &types.ExecutionResult{ExitCode: 1, Error: "--retry-from cannot be combined with source paths"}, nil
+		}
+		// A retry adds to the objects the failed run uploaded, which cleanup
+		// and a snapshot taken now would get in the way of.
+		merged.Cleanup = false
+		merged.Snapshot.Enabled = false
+		merged.StreamPlans = false
+	} else {
+		if len(sources) == 0 {
+			sources = append([]string{}, merged.Sources...)
+		}
+		if len(sources) == 0 {
+			err := fmt.Errorf("at least one source path is required (provide CLI paths or configure sources)")
+			return &types.ExecutionResult{ExitCode: 1, Stderr: uploadUsage(), Error: err.Error()}, nil
+		}
+	}
+
+	if err := merged.Validate(); err != nil {
+		return configFailure(ctx, err), nil
+	}
+	if merged.Cleanup {
+		if err := confirm(args, merged, cleanupAction(merged)); err != nil {
+			return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+		}
+	}
+
+	client, err := p.newS3Client(ctx, merged)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	attestations, err := loadAttestations(merged)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	digests := attestationDigests(attestations)
+
+	runID, stableRun, err := resolveRunID(merged)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	merged.RunID = runID
+
+	budget := uploader.NewMemoryBudget(merged.MemoryLimit)
+	transfer, err := newTransport(client, merged, budget)
+	if err != nil {
+		return configFailure(ctx, err), nil
+	}
+	stamp := p.buildContextValues(ctx, merged)
+	annotateTransport(transfer, merged, stamp, digests)
+
+	transfer.SetConcurrency(merged.Concurrency)
+	// The primary upload and its replicas share one throttle, so that the
+	// window limits cap all of them together.
+	throttle, err := newThrottle(merged)
+	if err != nil {
+		return configFailure(ctx, err), nil
+	}
+	transfer.SetThrottle(throttle)
+	logThrottle(p.logger, merged)
+
+	if found, err := findMarker(ctx, transfer, merged, p.logger); err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	} else if found {
+		region, regionFrom := clientRegion(client, merged.Region)
+		summary := uploadSummary{
+			Bucket:          merged.Bucket,
+			Region:          region,
+			RegionFrom:      regionFrom,
+			ContextPath:     merged.ContextPath,
+			RunID:           runID,
+			ObjectsUploaded: []uploader.UploadResult{},
+			SkippedByMarker: merged.MarkerObjectKey(),
+		}
+		if format == "table" {
+			return &types.ExecutionResult{Stdout: formatUploadTable(summary, colorEnabled(args))}, nil
+		}
+		payload, err := json.MarshalIndent(summary, "", "  ")
+		if err != nil {
+			return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("failed to encode execution summary: %v", err)}, nil
+		}
+		return &types.ExecutionResult{Stdout: string(payload) + "\n"}, nil
+	}
+
+	written := []string{merged.ContextPath}
+	if merged.LatestKey != "" {
+		written = append(written, merged.LatestKey)
+	}
+	if err := checkAllowedPrefixes(merged, written...); err != nil {
+		return configFailure(ctx, err), nil
+	}
+	if err := p.enforceEncryption(ctx, transfer, merged); err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	if err := p.checkACL(ctx, transfer, merged); err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	if err := p.checkKMSKeys(ctx, transfer, merged); err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	if err := p.applyClientEncryption(ctx, transfer, merged); err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+
+	secrets, err := newSecretGuard(merged, p.logger)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	antivirus, err := newAntivirusGuard(merged, p.logger)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	syncer, err := newSyncGuard(ctx, transfer, merged, p.logger)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	if err := p.useInventory(ctx, syncer, merged); err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	run, err := startRun(ctx, transfer, merged, runID, stableRun, p.logger)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	resumer := newResumeGuard(run, transfer, merged, p.logger)
+
+	large := newLargeFileGuard(merged, p.logger)
+	var guards []planGuard
+	if large != nil {
+		guards = append(guards, large)
+	}
+	if secrets != nil {
+		guards = append(guards, secrets)
+	}
+	if antivirus != nil {
+		guards = append(guards, antivirus)
+	}
+	if syncer != nil {
+		guards = append(guards, syncer)
+	}
+	if resumer != nil {
+		guards = append(guards, resumer)
+	}
+
+	policy := planPolicy(merged, p.logger)
+	planned := &plannedOutput{}
+	var plans []uploader.FilePlan
+	switch {
+	case retryFrom != "":
+		// Attestations that failed to upload are listed in the report.
+		plans, err = loadFailureReport(retryFrom, merged)
+	case merged.StreamPlans:
+		err = uploader.CheckSources(sources)
+	default:
+		plans, err = uploader.BuildPlans(sources, merged.ContextPath, policy)
+		if err == nil {
+			err = checkAttestationKeys(attestations, plans)
+		}
+		if err == nil {
+			planned.add(plans...)
+			err = planned.check(merged)
+		}
+	}
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	if retryFrom == "" {
+		plans = append(attestationPlans(attestations), plans...)
+	}
+	if !merged.StreamPlans {
+		if plans, err = checkPlans(ctx, guards, plans); err != nil {
+			return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+		}
+	}
+	var packIndex *uploader.PackIndex
+	if merged.Packing.Enabled && retryFrom != "" {
+		// The failure report lists the files themselves, as packs do not
+		// outlive the run that built them.
+		p.logger.Info("Uploading retried files without packing them")
+	} else if merged.Packing.Enabled {
+		var previous *uploader.PackIndex
+		if !merged.Cleanup {
+			// The packs of earlier uploads stay without cleanup, and so
+			// must the index entries of the files only they hold.
+			if previous, err = transfer.ReadPackIndex(ctx, merged.ContextPath); err != nil {
+				return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+			}
+		}
+		var removePacks func()
+		if plans, packIndex, removePacks, err = packPlans(merged, runID, attestations, plans, previous, p.logger); err != nil {
+			return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+		}
+		defer removePacks()
+	}
+	if etag, ok := args.First("if-match-etag"); ok && strings.TrimSpace(etag) != "" {
+		if err := checkIfMatch(merged, plans); err != nil {
+			return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+		}
+		transfer.SetIfMatch(etag)
+	}
+
+	snapshotPath := ""
+	if location, taken := run.snapshot(); taken && merged.Snapshot.Enabled {
+		snapshotPath = location
+		p.logger.Info("Snapshot already taken by an earlier attempt of this run", "snapshot", location)
+	} else if merged.Snapshot.Enabled {
+		location, copied, err := transfer.Snapshot(ctx, merged.ContextPath, merged.Snapshot.Prefix, time.Now())
+		if err != nil {
+			return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("snapshot failed: %v", err)}, nil
+		}
+		snapshotPath = location
+		p.logger.Info("Snapshot completed", "copied", len(copied), "snapshot", location)
+		if err := run.recordSnapshot(ctx, location); err != nil {
+			return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+		}
+	}
+
+	manifestKey := merged.ManifestObjectKey()
+	if manifestKey != "" && retryFrom != "" {
+		// The summary of a retry only lists the retried files, which would
+		// make the manifest look as if everything else had been removed.
+		p.logger.Info("Keeping the manifest of the failed run while retrying", "key", manifestKey)
+		manifestKey = ""
+	}
+	var previousManifest []byte
+	if manifestKey != "" {
+		// Read before cleanup, which would remove it.
+		if previousManifest, err = transfer.ReadObject(ctx, manifestKey); err != nil {
+			return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("failed to read previous manifest: %v", err)}, nil
+		}
+	}
+
+	cleaned := 0
+	if merged.Cleanup && run.cleanedUp() {
+		p.logger.Info("Skipping cleanup done by an earlier attempt of this run", "prefix", merged.ContextPath)
+	} else if merged.Cleanup {
+		deleted, err := transfer.Cleanup(ctx, merged.ContextPath)
+		if err != nil {
+			return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("cleanup failed: %v", err)}, nil
+		}
+		cleaned = deleted
+		p.logger.Info("Cleanup completed", "deleted", deleted, "prefix", merged.ContextPath)
+		// Cleanup also removed the run state, which this records again.
+		if err := run.recordCleanup(ctx); err != nil {
+			return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+		}
+	}
+
+	// A failed upload stops the walk, which would otherwise plan and check
+	// the rest of the sources only for them to be left out.
+	walkCtx, stopWalk := context.WithCancel(ctx)
+	defer stopWalk()
+	transfer.SetOnFailure(stopWalk)
+	check := streamCheck(ctx, guards)
+	if merged.StreamPlans && retryFrom == "" {
+		check = streamedAttestationCheck(attestations, check)
+	}
+	feeds, walkErr := planFeeds(walkCtx, merged, sources, policy, planned, plans, check, 1+len(merged.Replication.Targets))
+	waitReplicas := p.startReplicas(ctx, merged, feeds[1:], budget, throttle, stamp, digests)
+
+	progress := newProgressCheckpoint(merged, runID, plans, p.logger)
+	transfer.SetProgress(progress)
+	progress.start()
+	results, err := transfer.UploadStream(ctx, feeds[0])
+	replicas := waitReplicas()
+	walkFailure := walkErr()
+	if err != nil && errors.Is(walkFailure, context.Canceled) && ctx.Err() == nil {
+		// Stopped by the failed upload, which is the error to report.
+		walkFailure = nil
+	}
+	resumed := resumer.report()
+	if errors.Is(err, uploader.ErrNoFiles) && (syncer.skipped() > 0 || len(resumed) > 0) {
+		// Everything is up to date.
+		results, err = []uploader.UploadResult{}, nil
+	}
+	finished := progress.stop(errors.Join(walkFailure, err))
+	if walkFailure != nil {
+		return withReplicas(&types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("planning failed: %v", walkFailure)}, replicas), nil
+	}
+	if merged.StreamPlans && (err == nil || errors.Is(err, uploader.ErrNoFiles)) {
+		// Streamed sources are only counted once uploaded; failing still
+		// keeps the manifest, latest pointer and marker from naming them.
+		if err := planned.check(merged); err != nil {
+			return withReplicas(&types.ExecutionResult{ExitCode: 1, Error: err.Error()}, replicas), nil
+		}
+	}
+	var failure *uploader.UploadError
+	if errors.As(err, &failure) && packIndex != nil {
+		err = fmt.Errorf("%w; packs are rebuilt on every upload, so re-run it instead of retrying the files left out", err)
+	} else if errors.As(err, &failure) {
+		failuresFrom(ctx).leftOut(merged, failure)
+		err = fmt.Errorf("%w; %d file(s) left out are listed in %s, upload them with --retry-from %s", err, len(failure.Failed), merged.FailureReport, merged.FailureReport)
+	}
+	if err != nil {
+		return withReplicas(&types.ExecutionResult{ExitCode: 1, Error: err.Error()}, replicas), nil
+	}
+	if len(resumed) > 0 {
+		results = append(results, resumed...)
+		sort.Slice(results, func(i, j int) bool { return results[i].Key < results[j].Key })
+	}
+	// A dry run must not record files as uploaded in a local sync cache.
+	if !merged.DryRun {
+		if err := syncer.store(ctx, transfer); err != nil {
+			return withReplicas(&types.ExecutionResult{ExitCode: 1, Error: err.Error()}, replicas), nil
+		}
+	}
+	verified, err := p.waitVisible(ctx, transfer, merged, results)
+	if err != nil {
+		return withReplicas(&types.ExecutionResult{ExitCode: 1, Error: err.Error()}, replicas), nil
+	}
+
+	region, regionFrom := clientRegion(client, merged.Region)
+	summary := uploadSummary{
+		Bucket:          merged.Bucket,
+		Region:          region,
+		RegionFrom:      regionFrom,
+		ContextPath:     merged.ContextPath,
+		RunID:           runID,
+		DryRun:          merged.DryRun,
+		CleanupEnabled:  merged.Cleanup,
+		SnapshotPath:    snapshotPath,
+		ObjectsRemoved:  cleaned,
+		ObjectsUploaded: results,
+		ObjectsSkipped:  syncer.skipped(),
+		ObjectsResumed:  len(resumed),
+		ObjectsVerified: verified,
+		Replicas:        replicas,
+		BuildContext:    stamp,
+		Attestations:    attestations,
+		LargeFiles:      large.report(),
+		SecretFindings:  secrets.report(),
+		Quarantined:     antivirus.report(),
+		DurationSeconds: finished.UpdatedAt.Sub(finished.StartedAt).Round(time.Millisecond).Seconds(),
+		Throughput:      finished.Average,
+	}
+
+	payload, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("failed to encode execution summary: %v", err)}, nil
+	}
+	// The manifest keeps the full summary; only stdout is truncated.
+	shown, shownPayload := p.truncateSummary(merged.Summary, summary, payload)
+	output := string(shownPayload) + "\n"
+	if format == "table" {
+		output = formatUploadTable(shown, colorEnabled(args))
+	}
+
+	if manifestKey != "" {
+		if err := storeManifest(ctx, transfer, manifestKey, previousManifest, payload); err != nil {
+			return &types.ExecutionResult{Stdout: output, ExitCode: 1, Error: err.Error()}, nil
+		}
+	}
+
+	if failed := failedReplicas(replicas); failed != "" && merged.Replication.RequireAll {
+		failuresFrom(ctx).failedAs(diagnostics.ClassPartial)
+		return &types.ExecutionResult{
+			Stdout:   output,
+			ExitCode: 1,
+			Error:    fmt.Sprintf("replication failed: %s", failed),
+		}, nil
+	}
+	// The pointer goes first: a marker without it would make retries skip
+	// the upload that is meant to update it.
+	if err := writeLatest(ctx, transfer, merged, summary, run.startedAt(finished.StartedAt), p.logger); err != nil {
+		return &types.ExecutionResult{Stdout: output, ExitCode: 1, Error: err.Error()}, nil
+	}
+	if err := writeMarker(ctx, transfer, merged, runID); err != nil {
+		return &types.ExecutionResult{Stdout: output, ExitCode: 1, Error: err.Error()}, nil
+	}
+	if err := run.complete(ctx); err != nil {
+		p.logger.Warn("Failed to record completed run", "run_id", runID, "error", err)
+	}
+
+	return &types.ExecutionResult{
+		Stdout:   output,
+		ExitCode: 0,
 	}, nil
 }
 
-func (p *Plugin) handleUpload(ctx context.Context, baseCfg *config.Config, args types.PluginArgs) (*types.ExecutionResult, error) {
-	if help, ok := args.BoolAny("help", "h"); ok && help {
-		return &types.ExecutionResult{Stdout: uploadUsage(), ExitCode: 0}, nil
+// checkIfMatch ensures a compare-and-swap upload addresses a single object that
+// is replaced in place, since one expected ETag only describes one object.
+func checkIfMatch(cfg *config.Config, plans []uploader.FilePlan) error {
+	if cfg.StreamPlans || len(plans) != 1 {
+		return fmt.Errorf("--if-match-etag requires exactly one file to upload")
 	}
+	if cfg.Cleanup {
+		return fmt.Errorf("--if-match-etag cannot be combined with cleanup")
+	}
+	return nil
+}
 
-	merged := baseCfg.Clone()
+// planFeeds returns one plan channel per consumer. Pre-built plans are replayed;
+// when streaming, they are followed by the source walk, which runs concurrently
+// with the uploads and whose plans are counted in planned, and every plan must
+// be accepted by check (when set) before it is handed out. The returned
+// function reports the walk or check error once every channel has been drained.
+func planFeeds(ctx context.Context, cfg *config.Config, sources []string, policy uploader.PlanPolicy, planned *plannedOutput, plans []uploader.FilePlan, check func(uploader.FilePlan) (bool, error), consumers int) ([]<-chan uploader.FilePlan, func() error) {
+	var (
+		in       <-chan uploader.FilePlan
+		errs     <-chan error
+		checkErr = func() error { return nil }
+	)
+
+	if cfg.StreamPlans {
+		in, errs = uploader.StreamPlans(ctx, sources, cfg.ContextPath, policy)
+		in, _ = uploader.CheckPlans(in, planned.count)
+		if len(plans) > 0 {
+			in = uploader.PrependPlans(ctx, plans, in)
+		}
+		if check != nil {
+			in, checkErr = uploader.CheckPlans(in, check)
+		}
+	} else {
+		queue := make(chan uploader.FilePlan, len(plans))
+		for _, plan := range plans {
+			queue <- plan
+		}
+		close(queue)
+		in = queue
+	}
 
+	feeds := []<-chan uploader.FilePlan{in}
+	if consumers > 1 {
+		feeds = uploader.TeePlans(in, consumers)
+	}
+
+	return feeds, func() error {
+		if errs != nil {
+			if err := <-errs; err != nil {
+				return err
+			}
+		}
+		return checkErr()
+	}
+}
+
+// planPolicy maps the configured file policy onto the planner, logging every
+// file it skips.
+func planPolicy(cfg *config.Config, logger hclog.Logger) uploader.PlanPolicy {
+	actions := map[string]uploader.FileAction{
+		config.FileActionUpload:      uploader.FileUpload,
+		config.FileActionSkip:        uploader.FileSkip,
+		config.FileActionError:       uploader.FileFail,
+		config.FileActionUploadEmpty: uploader.FileUploadEmpty,
+	}
+	policy := uploader.PlanPolicy{
+		Empty:   actions[cfg.FilePolicy.Empty],
+		Special: actions[cfg.FilePolicy.Special],
+		Skipped: func(path, reason string) {
+			logger.Info("Skipping file", "source", path, "reason", reason)
+		},
+		MaxFiles:        cfg.Limits.MaxFiles,
+		MaxTotalSize:    cfg.Limits.MaxTotalSize,
+		MaxDepth:        cfg.MaxDepth,
+		StripComponents: cfg.StripComponents,
+		Gitignore:       cfg.RespectGitignore,
+		Forbidden:       cfg.Policy.ForbiddenPatterns,
+		MaxObjectSize:   cfg.Policy.MaxObjectSize,
+		WalkConcurrency: cfg.WalkConcurrency,
+	}
+	if cfg.IgnoreFiles {
+		policy.IgnoreFiles = uploader.IgnoreFileNames
+	}
+	return policy
+}
+
+// applyTargetOverrides applies the CLI flags that select and address the bucket.
+func applyTargetOverrides(cfg *config.Config, args types.PluginArgs) {
 	if bucket, ok := args.First("bucket"); ok && strings.TrimSpace(bucket) != "" {
-		merged.Bucket = strings.TrimSpace(bucket)
+		cfg.Bucket = strings.TrimSpace(bucket)
 	}
 	if region, ok := args.First("region"); ok && strings.TrimSpace(region) != "" {
-		merged.Region = strings.TrimSpace(region)
-	}
-	if contextPath, ok := args.FirstAny("context", "context-path"); ok && strings.TrimSpace(contextPath) != "" {
-		merged.ContextPath = strings.Trim(strings.TrimSpace(contextPath), "/")
+		cfg.Region = strings.TrimSpace(region)
 	}
 	if endpoint, ok := args.First("endpoint"); ok && strings.TrimSpace(endpoint) != "" {
-		merged.Endpoint = strings.TrimSpace(endpoint)
+		cfg.Endpoint = strings.TrimSpace(endpoint)
 	}
 	if profile, ok := args.First("profile"); ok && strings.TrimSpace(profile) != "" {
-		merged.Profile = strings.TrimSpace(profile)
+		cfg.Profile = strings.TrimSpace(profile)
 	}
-	if cleanup, ok := args.Bool("cleanup"); ok {
-		merged.Cleanup = cleanup
+	if token, ok := args.First("mfa-token"); ok {
+		cfg.Credentials.MFAToken = strings.TrimSpace(token)
 	}
-	if overwrite, ok := args.Bool("overwrite"); ok {
-		merged.Overwrite = overwrite
+	if debug, ok := args.Bool("debug-aws-config"); ok {
+		cfg.DebugAWSConfig = debug
 	}
 	if forcePathStyle, ok := args.BoolAny("force-path-style"); ok {
-		merged.ForcePathStyle = forcePathStyle
+		cfg.ForcePathStyle = forcePathStyle
 	}
 	if skipTLSVerify, ok := args.BoolAny("skip-tls-verify"); ok {
-		merged.SkipTLSVerify = skipTLSVerify
+		cfg.SkipTLSVerify = skipTLSVerify
 	}
+}
 
-	sources := trimmedArgs(args.Positionals())
-	if len(sources) == 0 {
-		sources = append([]string{}, merged.Sources...)
+// applyUploadOverrides applies every CLI flag accepted by upload to cfg.
+func applyUploadOverrides(cfg *config.Config, args types.PluginArgs) error {
+	applyTargetOverrides(cfg, args)
+	if contextPath, ok := args.FirstAny("context", "context-path"); ok && strings.TrimSpace(contextPath) != "" {
+		cfg.ContextPath = strings.Trim(strings.TrimSpace(contextPath), "/")
+	}
+	if cleanup, ok := args.Bool("cleanup"); ok {
+		cfg.Cleanup = cleanup
+	}
+	if values := trimmedArgs(args.All("cleanup-tag")); len(values) > 0 {
+		tags, err := parseTagArgs(values)
+		if err != nil {
+			return fmt.Errorf("invalid --cleanup-tag: %w", err)
+		}
+		cfg.CleanupTags = tags
+	}
+	if overwrite, ok := args.Bool("overwrite"); ok {
+		cfg.Overwrite = overwrite
+	}
+	if acl, ok := args.First("acl"); ok {
+		cfg.ACL.Canned = strings.ToLower(strings.TrimSpace(acl))
+	}
+	if err := applyMultipartOverrides(cfg, args); err != nil {
+		return err
+	}
+	applyEncryptionOverrides(cfg, args)
+	if snapshot, ok := args.Bool("snapshot"); ok {
+		cfg.Snapshot.Enabled = snapshot
+	}
+	if streamPlans, ok := args.Bool("stream-plans"); ok {
+		cfg.StreamPlans = streamPlans
+	}
+	if value, ok := args.First("walk-concurrency"); ok {
+		concurrency, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid --walk-concurrency: %w", err)
+		}
+		cfg.WalkConcurrency = concurrency
+	}
+	if sbom, ok := args.First("sbom"); ok {
+		cfg.Attestations.SBOM = strings.TrimSpace(sbom)
+	}
+	if provenance, ok := args.First("provenance"); ok {
+		cfg.Attestations.Provenance = strings.TrimSpace(provenance)
+	}
+	if action, ok := args.First("empty-files"); ok {
+		cfg.FilePolicy.Empty = strings.ToLower(strings.TrimSpace(action))
+	}
+	if action, ok := args.First("special-files"); ok {
+		cfg.FilePolicy.Special = strings.ToLower(strings.TrimSpace(action))
+	}
+	if value, ok := args.First("large-file-threshold"); ok {
+		threshold, err := config.ParseByteSize(value)
+		if err != nil {
+			return fmt.Errorf("invalid --large-file-threshold: %w", err)
+		}
+		cfg.LargeFiles.Threshold = threshold
+	}
+	if action, ok := args.First("large-file-action"); ok {
+		cfg.LargeFiles.Action = strings.ToLower(strings.TrimSpace(action))
+	}
+	if ignoreFiles, ok := args.Bool("ignore-files"); ok {
+		cfg.IgnoreFiles = ignoreFiles
+	}
+	if respect, ok := args.Bool("respect-gitignore"); ok {
+		cfg.RespectGitignore = respect
+	}
+	if value, ok := args.First("max-depth"); ok {
+		depth, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid --max-depth: %w", err)
+		}
+		cfg.MaxDepth = depth
+	}
+	if value, ok := args.First("strip-components"); ok {
+		strip, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid --strip-components: %w", err)
+		}
+		cfg.StripComponents = strip
+	}
+	if value, ok := args.First("max-files"); ok {
+		maxFiles, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid --max-files: %w", err)
+		}
+		cfg.Limits.MaxFiles = maxFiles
+	}
+	if value, ok := args.First("progress-file"); ok {
+		cfg.Progress.File = strings.TrimSpace(value)
+	}
+	if value, ok := args.First("summary-max-objects"); ok {
+		maxObjects, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid --summary-max-objects: %w", err)
+		}
+		cfg.Summary.MaxObjects = maxObjects
+	}
+	if value, ok := args.First("max-total-size"); ok {
+		size, err := config.ParseByteSize(value)
+		if err != nil {
+			return fmt.Errorf("invalid --max-total-size: %w", err)
+		}
+		cfg.Limits.MaxTotalSize = size
+	}
+	if value, ok := args.First("expect-min-files"); ok {
+		minFiles, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid --expect-min-files: %w", err)
+		}
+		cfg.Expect.MinFiles = minFiles
+	}
+	if value, ok := args.First("expect-min-total-size"); ok {
+		size, err := config.ParseByteSize(value)
+		if err != nil {
+			return fmt.Errorf("invalid --expect-min-total-size: %w", err)
+		}
+		cfg.Expect.MinTotalSize = size
+	}
+	if value, ok := args.First("verify-wait"); ok {
+		wait, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid --verify-wait: %w", err)
+		}
+		cfg.Verify.Wait = wait
+	}
+	if extractTar, ok := args.Bool("extract-tar"); ok {
+		cfg.ExtractTar = extractTar
+	}
+	if pack, ok := args.Bool("pack"); ok {
+		cfg.Packing.Enabled = pack
+	}
+	if key, ok := args.First("manifest-key"); ok && strings.TrimSpace(key) != "" {
+		cfg.ManifestKey = strings.Trim(strings.TrimSpace(key), "/")
+	}
+	if key, ok := args.First("skip-if-exists-key"); ok {
+		cfg.SkipIfExistsKey = strings.Trim(strings.TrimSpace(key), "/")
+	}
+	if key, ok := args.First("latest-key"); ok {
+		cfg.LatestKey = strings.Trim(strings.TrimSpace(key), "/")
+	}
+	if runID, ok := args.First("run-id"); ok && strings.TrimSpace(runID) != "" {
+		cfg.RunID = strings.TrimSpace(runID)
+	}
+	if sync, ok := args.Bool("sync"); ok {
+		cfg.Sync.Enabled = sync
+	}
+	if dir, ok := args.First("sync-cache-dir"); ok && strings.TrimSpace(dir) != "" {
+		cfg.Sync.CacheDir = strings.TrimSpace(dir)
+	}
+	if buildContext, ok := args.Bool("build-context"); ok {
+		cfg.BuildContext.Enabled = buildContext
+	}
+	if gitMetadata, ok := args.Bool("git-metadata"); ok {
+		cfg.BuildContext.Git = gitMetadata
+	}
+	if secretScan, ok := args.Bool("secret-scan"); ok {
+		cfg.SecretScan.Enabled = secretScan
 	}
-	if len(sources) == 0 {
-		err := fmt.Errorf("at least one source path is required (provide CLI paths or configure sources)")
-		return &types.ExecutionResult{ExitCode: 1, Stderr: uploadUsage(), Error: err.Error()}, nil
+	if mode, ok := args.First("secret-scan-mode"); ok && strings.TrimSpace(mode) != "" {
+		cfg.SecretScan.Mode = strings.ToLower(strings.TrimSpace(mode))
 	}
+	if antivirus, ok := args.Bool("antivirus"); ok {
+		cfg.Antivirus.Enabled = antivirus
+	}
+	if action, ok := args.First("antivirus-action"); ok && strings.TrimSpace(action) != "" {
+		cfg.Antivirus.Action = strings.ToLower(strings.TrimSpace(action))
+	}
+	if value, ok := args.First("concurrency"); ok {
+		concurrency, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid --concurrency: %w", err)
+		}
+		cfg.Concurrency = concurrency
+	}
+	if replicas := trimmedArgs(args.All("replicate-to")); len(replicas) > 0 {
+		cfg.Replication.Targets = replicas
+	}
+	if requireAll, ok := args.Bool("require-all-replicas"); ok {
+		cfg.Replication.RequireAll = requireAll
+	}
+	applySnapshotOverrides(cfg, args)
+	return nil
+}
 
-	if err := merged.Validate(); err != nil {
-		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+// applyMultipartOverrides applies the CLI flags that tune multipart transfers and memory use.
+func applyMultipartOverrides(cfg *config.Config, args types.PluginArgs) error {
+	if value, ok := args.First("part-size"); ok {
+		size, err := config.ParseByteSize(value)
+		if err != nil {
+			return fmt.Errorf("invalid --part-size: %w", err)
+		}
+		cfg.Multipart.PartSize = size
+	}
+	if value, ok := args.First("part-concurrency"); ok {
+		concurrency, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid --part-concurrency: %w", err)
+		}
+		cfg.Multipart.Concurrency = concurrency
+	}
+	if value, ok := args.First("checksum-type"); ok {
+		cfg.Checksum.Type = strings.ToLower(strings.TrimSpace(value))
 	}
+	if value, ok := args.First("checksum-algorithm"); ok {
+		cfg.Checksum.Algorithm = strings.ToLower(strings.TrimSpace(value))
+	}
+	if value, ok := args.Bool("checksum-metadata"); ok {
+		cfg.Checksum.Metadata = value
+	}
+	if value, ok := args.First("memory-limit"); ok {
+		limit, err := config.ParseByteSize(value)
+		if err != nil {
+			return fmt.Errorf("invalid --memory-limit: %w", err)
+		}
+		cfg.MemoryLimit = limit
+	}
+	return nil
+}
 
-	awsCfg, err := p.buildAWSConfig(ctx, merged)
-	if err != nil {
-		return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("failed to configure AWS SDK: %v", err)}, nil
+// requestDecorations returns the stack mutators adding the configured
+// User-Agent suffix and request headers to every S3 request, along with the
+// correlation ids of the host run. The correlation id also goes into the
+// User-Agent, which unlike other headers appears in S3 server access logs.
+func requestDecorations(cfg *config.Config, correlation buildinfo.Correlation) []func(*middleware.Stack) error {
+	mutators := make([]func(*middleware.Stack) error, 0, len(cfg.RequestHeaders)+3)
+	for _, key := range strings.Fields(cfg.UserAgentSuffix) {
+		mutators = append(mutators, awsmiddleware.AddUserAgentKey(key))
+	}
+	if id := correlation.ID(); id != "" {
+		mutators = append(mutators, awsmiddleware.AddUserAgentKeyValue("ds-correlation", id))
+		if _, set := cfg.RequestHeaders[buildinfo.CorrelationHeader]; !set {
+			mutators = append(mutators, smithyhttp.SetHeaderValue(buildinfo.CorrelationHeader, id))
+		}
+	}
+	if correlation.Traceparent != "" {
+		mutators = append(mutators, smithyhttp.SetHeaderValue("Traceparent", correlation.Traceparent))
+	}
+	names := make([]string, 0, len(cfg.RequestHeaders))
+	for name := range cfg.RequestHeaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		mutators = append(mutators, smithyhttp.SetHeaderValue(name, cfg.RequestHeaders[name]))
 	}
+	return mutators
+}
 
-	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
-		o.UsePathStyle = merged.ForcePathStyle
-		if merged.Endpoint != "" {
-			o.BaseEndpoint = aws.String(merged.Endpoint)
-			o.Region = awsCfg.Region
+// newRetryer returns the SDK standard retryer with a backoff that honours
+// Retry-After headers and S3 SlowDown responses. HTTP 429 responses, which
+// S3-compatible gateways use for throttling, are retried as well, and so are
+// requests rejected for expired credentials, after dropping the cached ones.
+func newRetryer(settings config.Retry, credentials aws.CredentialsProvider) aws.Retryer {
+	return retry.NewStandard(func(o *retry.StandardOptions) {
+		if settings.MaxAttempts > 0 {
+			o.MaxAttempts = settings.MaxAttempts
+		}
+		if settings.MaxBackoff > 0 {
+			o.MaxBackoff = settings.MaxBackoff
+		}
+		o.Backoff = backoff.New(o.MaxBackoff)
+		o.Retryables = append(append([]retry.IsErrorRetryable{}, o.Retryables...), retry.RetryableHTTPStatusCode{
+			Codes: map[int]struct{}{http.StatusTooManyRequests: {}},
+		}, awsauth.ExpiredRetryable{Credentials: credentials})
+	})
+}
+
+// newHTTPClient returns the HTTP client for S3 requests, starting from the SDK
+// defaults, or nil when no transport setting is configured.
+func newHTTPClient(cfg *config.Config) aws.HTTPClient {
+	if !cfg.SkipTLSVerify && cfg.HTTP == (config.HTTP{}) && !cfg.DNS.Enabled() {
+		return nil
+	}
+
+	return awshttp.NewBuildableClient().WithTransportOptions(func(transport *http.Transport) {
+		if cfg.SkipTLSVerify {
+			transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // #nosec G402 - explicitly requested by user configuration
+		}
+		if n := cfg.HTTP.MaxIdleConnsPerHost; n > 0 {
+			transport.MaxIdleConnsPerHost = n
+			if transport.MaxIdleConns < n {
+				transport.MaxIdleConns = n
+			}
+		}
+		if cfg.HTTP.DisableHTTP2 {
+			transport.ForceAttemptHTTP2 = false
+			// A non-nil empty map keeps net/http from negotiating HTTP/2.
+			transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		}
+		if cfg.HTTP.DisableKeepAlives {
+			transport.DisableKeepAlives = true
+		}
+		if cfg.HTTP.IdleConnTimeout > 0 {
+			transport.IdleConnTimeout = cfg.HTTP.IdleConnTimeout
+		}
+		if cfg.DNS.Enabled() {
+			if endpoint, err := url.Parse(cfg.Endpoint); err == nil && endpoint.Hostname() != "" {
+				dialer := dnscache.NewDialer(endpoint.Hostname(), cfg.DNS.Pin, transport.DialContext, net.DefaultResolver.LookupHost)
+				transport.DialContext = dialer.DialContext
+			}
 		}
 	})
-	transfer := uploader.NewTransport(client, manager.NewUploader(client), merged.Bucket, merged.Overwrite)
+}
 
-	plans, err := uploader.BuildPlans(sources, merged.ContextPath)
+// newS3Client builds an S3 client for the resolved configuration.
+func (p *Plugin) newS3Client(ctx context.Context, cfg *config.Config) (*s3.Client, error) {
+	awsCfg, err := p.awsConfig(ctx, cfg)
 	if err != nil {
-		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+		return nil, fmt.Errorf("failed to configure AWS SDK: %w", err)
 	}
 
-	cleaned := 0
-	if merged.Cleanup {
-		deleted, err := transfer.Cleanup(ctx, merged.ContextPath)
-		if err != nil {
-			return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("cleanup failed: %v", err)}, nil
+	options := func(o *s3.Options) {
+		o.UsePathStyle = cfg.ForcePathStyle
+		if cfg.IsAccessPoint() {
+			// Access points are only reachable virtual-host style, in the
+			// region named by the ARN. Multi-Region Access Points name no
+			// region: the SDK sends their requests to the global endpoint
+			// signed with SigV4A, valid in every region S3 routes them to.
+			o.UsePathStyle = false
+			o.UseARNRegion = true
+		}
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+			o.Region = awsCfg.Region
+		}
+		if cfg.IsGCS() {
+			// Cloud Storage rejects the x-amz-checksum headers and trailers
+			// the SDK adds to uploads by default.
+			o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+			o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+		}
+		o.APIOptions = append(o.APIOptions, requestDecorations(cfg, buildinfo.CorrelationFromEnv(os.LookupEnv))...)
+		if p.logger.IsTrace() {
+			o.APIOptions = append(o.APIOptions, diagnostics.Trace(p.logger))
 		}
-		cleaned = deleted
-		p.logger.Info("Cleanup completed", "deleted", deleted, "prefix", merged.ContextPath)
 	}
+	recorded := func(o *s3.Options) {
+		if failures := failuresFrom(ctx); failures != nil {
+			o.APIOptions = append(o.APIOptions, failures.recorder.Middleware())
+		}
+	}
+	client := s3.NewFromConfig(awsCfg, options, recorded, followRegionRedirects(cfg, awsCfg.Region, p.logger))
+	if cfg.DebugAWSConfig {
+		p.logAWSConfig(ctx, client, cfg)
+	}
+	return client, nil
+}
 
-	results, err := transfer.Upload(ctx, plans)
+// newTransport builds a Transport whose upload manager honours the multipart
+// settings and draws part buffers from the shared memory budget, sending
+// requests through the configured backend.
+func newTransport(client *s3.Client, cfg *config.Config, budget *uploader.MemoryBudget) (*uploader.Transport, error) {
+	partSize := cfg.EffectivePartSize()
+	concurrency := cfg.EffectiveConcurrency()
+
+	putter := manager.NewUploader(uploader.AbortDetached(client), func(u *manager.Uploader) {
+		u.PartSize = partSize
+		u.Concurrency = concurrency
+		if pool := uploader.NewBufferPool(budget, partSize); pool != nil {
+			u.BufferProvider = pool
+		}
+	})
+	backend, err := uploader.NewBackend(cfg.Backend, client, putter)
 	if err != nil {
-		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+		return nil, err
 	}
+	throttle, err := newThrottle(cfg)
+	if err != nil {
+		return nil, err
+	}
+	acl := s3types.ObjectCannedACL(cfg.ACL.Canned)
+	if cfg.IsGCS() {
+		// Cloud Storage maps canned ACLs onto its own; it is left to the
+		// bucket's default object ACL instead.
+		acl = ""
+	}
+	return uploader.NewTransport(client, putter, cfg.Bucket, cfg.Overwrite,
+		uploader.WithBackend(backend),
+		uploader.WithMemoryBudget(budget, partSize*int64(concurrency+1)),
+		uploader.WithCleanupTags(cfg.CleanupTags),
+		uploader.WithChecksumType(checksumType(cfg.Checksum.Type)),
+		uploader.WithChecksumAlgorithm(s3types.ChecksumAlgorithm(strings.ToUpper(cfg.Checksum.Algorithm))),
+		uploader.WithChecksumMetadata(cfg.Checksum.Metadata),
+		uploader.WithExtractTar(cfg.ExtractTar),
+		uploader.WithTarPolicy(uploader.PlanPolicy{Forbidden: cfg.Policy.ForbiddenPatterns, MaxObjectSize: cfg.Policy.MaxObjectSize}),
+		uploader.WithEncryption(s3types.ServerSideEncryption(cfg.Encryption.Mode), cfg.Encryption.KMSKeyID),
+		uploader.WithKMSKeyRules(kmsKeyRules(cfg.Encryption.KeyRules)),
+		uploader.WithBucketKey(cfg.Encryption.BucketKey),
+		uploader.WithRunID(cfg.RunID),
+		uploader.WithACL(acl),
+		uploader.WithDryRun(cfg.DryRun),
+		uploader.WithAllowedPrefixes(cfg.Policy.AllowedPrefixes),
+		uploader.WithThrottle(throttle),
+	), nil
+}
 
-	summary := uploadSummary{
-		Bucket:          merged.Bucket,
-		Region:          merged.Region,
-		ContextPath:     merged.ContextPath,
-		CleanupEnabled:  merged.Cleanup,
-		ObjectsRemoved:  cleaned,
-		ObjectsUploaded: results,
+// logThrottle notes a throttle window active as the upload starts.
+func logThrottle(logger hclog.Logger, cfg *config.Config) {
+	schedule, err := throttleSchedule(cfg)
+	if err != nil {
+		return
+	}
+	window, ok := schedule.At(time.Now())
+	if !ok {
+		return
 	}
+	fields := []interface{}{"concurrency", window.Concurrency}
+	if window.Bandwidth > 0 {
+		fields = append(fields, "bandwidth", config.FormatByteSize(window.Bandwidth)+"/s")
+	}
+	logger.Info("Throttling uploads during the current window", fields...)
+}
 
-	payload, err := json.MarshalIndent(summary, "", "  ")
+// newThrottle returns a throttle for the configured windows, or nil without
+// any. Transports get their own; set one on several transports to have the
+// windows cap them together.
+func newThrottle(cfg *config.Config) (*uploader.Throttle, error) {
+	schedule, err := throttleSchedule(cfg)
 	if err != nil {
-		return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("failed to encode execution summary: %v", err)}, nil
+		return nil, err
 	}
+	return uploader.NewThrottle(schedule), nil
+}
 
-	return &types.ExecutionResult{
-		Stdout:   string(payload) + "\n",
-		ExitCode: 0,
-	}, nil
+// throttleSchedule converts the configured throttle windows for the
+// transport.
+func throttleSchedule(cfg *config.Config) (uploader.ThrottleSchedule, error) {
+	if len(cfg.Throttle.Windows) == 0 {
+		return uploader.ThrottleSchedule{}, nil
+	}
+	location, err := cfg.Throttle.Location()
+	if err != nil {
+		return uploader.ThrottleSchedule{}, err
+	}
+	schedule := uploader.ThrottleSchedule{Location: location}
+	for _, window := range cfg.Throttle.Windows {
+		schedule.Windows = append(schedule.Windows, uploader.ThrottleWindow{
+			Days:        window.Days,
+			Start:       window.Start,
+			End:         window.End,
+			Concurrency: window.Concurrency,
+			Bandwidth:   window.Bandwidth,
+		})
+	}
+	return schedule, nil
+}
+
+// kmsKeyRules converts the configured KMS key rules for the transport.
+func kmsKeyRules(rules []config.KMSKeyRule) []uploader.KMSKeyRule {
+	if len(rules) == 0 {
+		return nil
+	}
+	converted := make([]uploader.KMSKeyRule, len(rules))
+	for i, rule := range rules {
+		converted[i] = uploader.KMSKeyRule{Pattern: rule.Pattern, KMSKeyID: rule.KMSKeyID}
+	}
+	return converted
+}
+
+// checksumType maps the configured checksum type to its S3 value.
+func checksumType(value string) s3types.ChecksumType {
+	switch value {
+	case config.ChecksumTypeComposite:
+		return s3types.ChecksumTypeComposite
+	case config.ChecksumTypeFullObject:
+		return s3types.ChecksumTypeFullObject
+	}
+	return ""
+}
+
+// buildContextValues resolves the build context stamped onto uploaded objects,
+// or nil when stamping is disabled or nothing is known about the run. A failed
+// git detection is logged and leaves the git fields out.
+func (p *Plugin) buildContextValues(ctx context.Context, cfg *config.Config) map[string]string {
+	if !cfg.BuildContext.Enabled {
+		return nil
+	}
+
+	info := buildinfo.FromEnv(os.LookupEnv)
+	if cfg.RunID != "" {
+		info.RunID = cfg.RunID
+	}
+	if cfg.BuildContext.Git {
+		git, err := buildinfo.DetectGit(ctx, ".")
+		if err != nil {
+			p.logger.Warn("Git metadata detection failed", "error", err)
+		}
+		info.Git = git
+	}
+	return info.Values()
+}
+
+// annotateTransport stamps the build context onto every object the transport
+// uploads, as tags and/or user metadata depending on the configuration, and
+// tags it with the attestation digests.
+func annotateTransport(transfer *uploader.Transport, cfg *config.Config, values, digests map[string]string) {
+	if values == nil && digests == nil {
+		return
+	}
+	var metadata, tags map[string]string
+	if values != nil && cfg.BuildContext.Metadata {
+		metadata = values
+	}
+	// Directory buckets and Cloud Storage do not support object tags.
+	if values != nil && cfg.BuildContext.Tags && cfg.ObjectTags() {
+		tags = values
+	}
+	if !cfg.ObjectTags() {
+		metadata = mergeAnnotations(metadata, digests)
+	} else {
+		tags = mergeAnnotations(tags, digests)
+	}
+	transfer.SetObjectAnnotations(metadata, tags)
+}
+
+// mergeAnnotations returns the union of two annotation maps without modifying
+// either.
+func mergeAnnotations(base, extra map[string]string) map[string]string {
+	if len(extra) == 0 {
+		return base
+	}
+	merged := make(map[string]string, len(base)+len(extra))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range extra {
+		merged[key] = value
+	}
+	return merged
 }
 
+// mfaTokenEnv holds the MFA code of credentials.mfa_serial when --mfa-token
+// is not given.
+const mfaTokenEnv = "DS_S3_MFA_TOKEN"
+
 func (p *Plugin) buildAWSConfig(ctx context.Context, cfg *config.Config) (aws.Config, error) {
 	options := make([]func(*awsconfig.LoadOptions) error, 0)
 	if cfg.Region != "" {
@@ -270,16 +1974,16 @@ func (p *Plugin) buildAWSConfig(ctx context.Context, cfg *config.Config) (aws.Co
 	if cfg.Profile != "" {
 		options = append(options, awsconfig.WithSharedConfigProfile(cfg.Profile))
 	}
-	if cfg.SkipTLSVerify {
-		transport := &http.Transport{
-			Proxy:           http.ProxyFromEnvironment,
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // #nosec G402 - explicitly requested by user configuration
-		}
-		options = append(options, awsconfig.WithHTTPClient(&http.Client{Transport: transport}))
+	if client := newHTTPClient(cfg); client != nil {
+		options = append(options, awsconfig.WithHTTPClient(client))
 	}
+	options = append(options, awsconfig.WithCredentialsCacheOptions(awsauth.CacheOptions))
 
 	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, options...)
 	if err != nil {
+		if cfg.Profile != "" {
+			err = awsauth.ExplainProfile(ctx, cfg.Profile, cfg.Region, err)
+		}
 		return aws.Config{}, err
 	}
 
@@ -290,12 +1994,35 @@ func (p *Plugin) buildAWSConfig(ctx context.Context, cfg *config.Config) (aws.Co
 		awsCfg.Region = "us-east-1"
 	}
 
-	if cfg.Credentials.AccessKeyID != "" && cfg.Credentials.SecretAccessKey != "" {
-		awsCfg.Credentials = aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(
-			cfg.Credentials.AccessKeyID,
-			cfg.Credentials.SecretAccessKey,
-			cfg.Credentials.SessionToken,
-		))
+	// The STS client of an assumed role drops the credentials of the default
+	// chain when they expire.
+	base := awsCfg.Credentials
+	awsCfg.Retryer = func() aws.Retryer {
+		return newRetryer(cfg.Retry, base)
+	}
+	credentials, err := awsauth.Provider(ctx, awsCfg, awsauth.Options{
+		Source:          cfg.Credentials.Source,
+		Profile:         cfg.Profile,
+		Region:          cfg.Region,
+		AccessKeyID:     cfg.Credentials.AccessKeyID,
+		SecretAccessKey: cfg.Credentials.SecretAccessKey,
+		SessionToken:    cfg.Credentials.SessionToken,
+		RoleARN:         cfg.Credentials.RoleARN,
+		RoleSessionName: cfg.Credentials.RoleSessionName,
+		ExternalID:      cfg.Credentials.ExternalID,
+		RoleDuration:    cfg.Credentials.RoleDuration,
+		MFASerial:       cfg.Credentials.MFASerial,
+		MFAToken: awsauth.MFAToken(
+			cmp.Or(cfg.Credentials.MFAToken, os.Getenv(mfaTokenEnv)),
+			awsauth.PromptMFAToken(cfg.Credentials.MFASerial),
+		),
+	})
+	if err != nil {
+		return aws.Config{}, err
+	}
+	awsCfg.Credentials = credentials
+	awsCfg.Retryer = func() aws.Retryer {
+		return newRetryer(cfg.Retry, credentials)
 	}
 
 	return awsCfg, nil
@@ -303,22 +2030,153 @@ func (p *Plugin) buildAWSConfig(ctx context.Context, cfg *config.Config) (aws.Co
 
 func uploadUsage() string {
 	return `Usage: ds s3 upload [flags] <path> [path...]
+       ds s3 upload [flags] --retry-from <file>
 
-Uploads one or more files/directories to an S3-compatible bucket.
+Uploads one or more files/directories to an S3-compatible bucket. A path
+given as local_path=remote_key stores a file at that key, or a directory's
+files under it, below the context path (e.g. build/app.bin=app-linux-amd64).
 
 Flags:
+  --env <name>               Apply a configured environment overlay (defaults to $DS_ENV)
+  --source <path[:prefix]>   Upload a path below a sub-prefix of the context path (repeatable)
   --bucket <name>            Override target bucket (defaults to configuration)
   --region <name>            Override AWS region
   --context <prefix>         Set object prefix/context path
   --cleanup                  Remove existing objects before uploading
+  --cleanup-tag <key=value>  Only clean up objects carrying this tag (repeatable)
+  --yes                      Clean up without asking on an interactive terminal
   --overwrite                Overwrite conflicting objects (default true)
+  --acl <canned>             Canned ACL of uploaded objects, e.g. bucket-owner-full-control
+  --if-match-etag <etag>     Replace the single uploaded object only if its ETag still matches
+  --snapshot                 Snapshot the context path before cleanup/upload
+  --snapshot-prefix <prefix> Root prefix for snapshots (default "snapshots")
+  --concurrency <n>          Number of files uploaded in parallel (default 1)
+  --stream-plans             Start uploading while large directories are still being walked
+  --walk-concurrency <n>     Directories read in parallel while walking sources (default 1)
+  --extract-tar              Upload the entries of tar archives instead of the archives
+  --pack                     Bundle small files into packs with an index (see packing.*)
+  --empty-files <action>     Empty files: "upload" (default), "skip" or "error"
+  --special-files <action>   FIFOs, sockets and devices: "error" (default), "skip" or "upload_empty"
+  --large-file-threshold <size>
+                             Flag files above this size and sparse files (e.g. 10GiB)
+  --large-file-action <action>
+                             Flagged files: "warn" (default), "require_multipart" or "error"
+  --ignore-files             Honour .s3ignore/.dsignore files in source directories (default true)
+  --respect-gitignore        Leave out files ignored by the repository's .gitignore files
+  --max-depth <n>            Only walk this many directory levels below each source directory
+  --strip-components <n>     Remove this many leading directories from the keys of directory sources
+  --max-files <n>            Abort planning when the sources hold more files than this
+  --max-total-size <size>    Abort planning when the sources add up to more than this (e.g. 50GiB)
+  --expect-min-files <n>     Fail when the sources hold fewer files than this, e.g. an empty dist directory
+  --expect-min-total-size <size>
+                             Fail when the sources add up to less than this (e.g. 1MiB)
+  --verify-wait <duration>   Wait up to this long for the uploaded objects to be visible (e.g. 2m)
+  --manifest-key <key>       Store the upload summary at this key below the context path
+  --skip-if-exists-key <key> Do nothing if this marker exists below the context path; write it on success
+  --latest-key <key>         Point this key in the bucket at the context path after a successful upload
+  --format <fmt>             "json" (default) or "table" for an aligned table of the uploaded objects
+  --color                    Colorize the table output (ignored when NO_COLOR is set)
+  --summary-max-objects <n>  List at most this many objects on stdout, the full summary goes to summary.file
+  --progress-file <file>     Rewrite this file with the upload's progress every progress.interval
+  --run-id <id>              Identify the run so a re-run skips completed work (default $DS_RUN_ID)
+  --failure-report <file>    Where a failed run writes its failure report (default ds-s3-failures.json)
+  --dry-run                  Report what would be uploaded, removed and copied without writing (any command)
+  --retry-from <file>        Upload only the files listed in the failure report of an earlier run
+  --sync                     Only upload files changed since the last successful sync
+  --sync-cache-dir <dir>     Keep the sync state in a local cache instead of the bucket
+  --sbom <file>              Publish an SBOM with the upload and tag objects with its digest
+  --provenance <file>        Publish a SLSA provenance statement the same way
+  --build-context            Stamp objects with the DS pipeline name, run id and commit
+  --git-metadata             Include the local git sha, branch, tag and dirty flag
+  --secret-scan              Scan planned files for potential secrets before uploading
+  --secret-scan-mode <mode>  "block" (default) fails the run, "warn" only reports
+  --antivirus                Scan planned files with the configured antivirus
+  --antivirus-action <mode>  "block" (default) fails the run, "quarantine" skips infected files
+  --part-size <size>         Multipart part size (e.g. 16MiB, minimum 5MiB)
+  --part-concurrency <n>     Parts uploaded in parallel per object
+  --memory-limit <size>      Ceiling for part buffers shared by all concurrent uploads
+  --checksum-type <type>     Multipart checksum: "composite" or "full-object"
+  --checksum-algorithm <alg> crc32, crc32c, crc64nvme, sha1 or sha256
+  --checksum-metadata        Store each file's SHA-256 as x-amz-meta-sha256
+  --sse <mode>               Server-side encryption: AES256, aws:kms or aws:kms:dsse
+  --sse-kms-key-id <id>      KMS key for the aws:kms modes
+  --sse-bucket-key           Use an S3 Bucket Key for aws:kms objects to cut KMS requests
+  --client-encryption-kms-key-id <id>
+                             Encrypt objects on the client with data keys wrapped by this KMS key
+  --require-encryption       Refuse to upload unless objects are encrypted at rest
+  --replicate-to <target>    Also upload to a named target (repeatable)
+  --require-all-replicas     Fail the run when any replica fails (default true)
   --endpoint <url>           Use a custom S3-compatible endpoint
   --force-path-style         Force path-style addressing
   --skip-tls-verify          Disable TLS verification (requires --endpoint)
   --profile <name>           Shared AWS profile to use
+  --mfa-token <code>         MFA code for credentials.mfa_serial (or $DS_S3_MFA_TOKEN)
+  --debug-aws-config         Log the resolved region, endpoint, addressing, retries, credential source and signer
 `
 }
 
+// parseTagArgs parses key=value pairs given on the command line.
+func parseTagArgs(values []string) (map[string]string, error) {
+	tags := make(map[string]string, len(values))
+	for _, value := range values {
+		key, tagValue, ok := strings.Cut(value, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", value)
+		}
+		tags[key] = strings.TrimSpace(tagValue)
+	}
+	return tags, nil
+}
+
+// selectorArgs parses the --filter-tag and --filter-metadata key=value
+// selectors of a bulk operation on the target configured by cfg. It returns
+// nil when neither is given.
+func selectorArgs(cfg *config.Config, args types.PluginArgs) (*uploader.Selector, error) {
+	var selector uploader.Selector
+	if values := trimmedArgs(args.All("filter-tag")); len(values) > 0 {
+		tags, err := parseTagArgs(values)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --filter-tag: %w", err)
+		}
+		switch {
+		case cfg.IsGCS():
+			return nil, fmt.Errorf("--filter-tag cannot be used with the gcs backend, which does not support object tags")
+		case cfg.IsDirectoryBucket():
+			return nil, fmt.Errorf("--filter-tag cannot be used with a directory bucket, which does not support object tags")
+		}
+		selector.Tags = tags
+	}
+	if values := trimmedArgs(args.All("filter-metadata")); len(values) > 0 {
+		metadata, err := parseTagArgs(values)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --filter-metadata: %w", err)
+		}
+		selector.Metadata = metadata
+	}
+	if selector.IsZero() {
+		return nil, nil
+	}
+	return &selector, nil
+}
+
+// prefixedSource turns a --source value, path or path:prefix, into a source
+// uploading path below the sub-prefix. The first ":" not preceded by a
+// backslash separates the two, so a path containing ":" writes it as "\:",
+// and the colon of a Windows drive letter is not a separator.
+func prefixedSource(value string) string {
+	drive := ""
+	if len(value) > 2 && value[1] == ':' && (value[2] == '\\' || value[2] == '/') &&
+		('a' <= value[0]|0x20 && value[0]|0x20 <= 'z') {
+		drive, value = value[:2], value[2:]
+	}
+	path, prefix, found := uploader.CutUnescaped(value, ':')
+	if !found {
+		return drive + path
+	}
+	return uploader.SourceUnder(drive+strings.TrimSpace(path), prefix)
+}
+
 func trimmedArgs(values []string) []string {
 	if len(values) == 0 {
 		return nil
@@ -336,8 +2194,37 @@ func trimmedArgs(values []string) []string {
 type uploadSummary struct {
 	Bucket          string                  `json:"bucket"`
 	Region          string                  `json:"region,omitempty"`
+	RegionFrom      string                  `json:"region_corrected_from,omitempty"`
 	ContextPath     string                  `json:"context_path,omitempty"`
+	RunID           string                  `json:"run_id"`
 	CleanupEnabled  bool                    `json:"cleanup_enabled"`
+	SnapshotPath    string                  `json:"snapshot_path,omitempty"`
 	ObjectsRemoved  int                     `json:"objects_removed"`
 	ObjectsUploaded []uploader.UploadResult `json:"objects_uploaded"`
+	ObjectsSkipped  int                     `json:"objects_skipped,omitempty"`
+	ObjectsResumed  int                     `json:"objects_resumed,omitempty"`
+	ObjectsVerified int                     `json:"objects_verified,omitempty"`
+	Replicas        []replicaSummary        `json:"replicas,omitempty"`
+	BuildContext    map[string]string       `json:"build_context,omitempty"`
+	Attestations    []attestation           `json:"attestations,omitempty"`
+	LargeFiles      []largeFile             `json:"large_files,omitempty"`
+	SecretFindings  []scan.Finding          `json:"secret_findings,omitempty"`
+	Quarantined     []quarantinedFile       `json:"quarantined,omitempty"`
+	// SkippedByMarker is the completion marker that made the upload a
+	// no-op; see skip_if_exists_key.
+	SkippedByMarker string `json:"skipped_by_marker,omitempty"`
+	// DryRun is set when the upload only previewed its writes; see dry_run.
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// ObjectsTruncated counts the uploaded objects left out of
+	// ObjectsUploaded, adding up to truncatedSize bytes; FullSummary names
+	// the file listing all of them.
+	ObjectsTruncated int    `json:"objects_truncated,omitempty"`
+	FullSummary      string `json:"full_summary,omitempty"`
+	truncatedSize    int64
+
+	// DurationSeconds is how long the upload took, and Throughput the
+	// average rate of the files it uploaded, in bytes per second.
+	DurationSeconds float64 `json:"duration_seconds"`
+	Throughput      int64   `json:"throughput_bytes_per_second"`
 }
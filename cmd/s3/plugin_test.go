@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/delivery-station/ds/pkg/types"
+	"github.com/hashicorp/go-hclog"
+)
+
+type hostConfig struct {
+	config *types.Config
+}
+
+func (h hostConfig) GetEffectiveConfig(ctx context.Context) (*types.Config, error) {
+	return h.config, nil
+}
+
+// lockedBuffer collects the log lines of concurrent operations.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestExecuteConcurrently(t *testing.T) {
+	var logs lockedBuffer
+	p := NewPlugin(newLogOutput(&logs, hclog.Info), "test", "none", "unknown")
+
+	// Even operations log at info in logfmt, odd ones only warnings in JSON,
+	// so every info line must be in logfmt.
+	const operations = 16
+	results := make([]*types.ExecutionResult, operations)
+	var wg sync.WaitGroup
+	for i := range operations {
+		level, format := "info", "logfmt"
+		if i%2 == 1 {
+			level, format = "warn", "json"
+		}
+		ctx := types.WithHostConfigProvider(context.Background(), hostConfig{config: &types.Config{
+			Logging: types.LoggingConfig{Level: level},
+			Plugins: types.PluginsConfig{Settings: map[string]map[string]interface{}{
+				"s3": {
+					"bucket":       fmt.Sprintf("artifacts-%d", i),
+					"logging":      map[string]interface{}{"format": format},
+					"local_config": false,
+				},
+			}},
+		}})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := p.Execute(ctx, "info", nil)
+			if err != nil {
+				t.Errorf("operation %d: %v", i, err)
+			}
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+
+	for i, result := range results {
+		if result == nil || result.ExitCode != 0 {
+			t.Fatalf("operation %d failed: %+v", i, result)
+		}
+		var summary infoSummary
+		if err := json.Unmarshal([]byte(result.Stdout), &summary); err != nil {
+			t.Fatalf("operation %d: %v", i, err)
+		}
+		values := make(map[string]interface{}, len(summary.Settings))
+		for _, setting := range summary.Settings {
+			values[setting.Key] = setting.Value
+		}
+		if values["bucket"] != fmt.Sprintf("artifacts-%d", i) {
+			t.Errorf("operation %d ran with bucket %v", i, values["bucket"])
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) == 0 || lines[0] == "" {
+		t.Fatal("expected the operations to log configuration changes")
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "time=") || !strings.Contains(line, "level=info") {
+			t.Errorf("expected only info lines in logfmt, got %s", line)
+		}
+	}
+	if level := p.logger.GetLevel(); level != hclog.Info {
+		t.Errorf("expected the process logger to keep its level, got %s", level)
+	}
+}
+
+// newTestPlugin returns a plugin whose logs are discarded.
+func newTestPlugin() *Plugin {
+	return NewPlugin(newLogOutput(io.Discard, hclog.Off), "test", "none", "unknown")
+}
+
+func TestPrefixedSource(t *testing.T) {
+	cases := []struct {
+		value string
+		path  string
+		key   string
+	}{
+		{value: "dist", path: "dist"},
+		{value: "dist:web", path: "dist", key: "web/"},
+		{value: `logs/build-12\:30\:00:qa/logs`, path: "logs/build-12:30:00", key: "qa/logs/"},
+		{value: `logs/build-12\:30\:00`, path: "logs/build-12:30:00"},
+		{value: `C:\builds\dist:web`, path: `C:\builds\dist`, key: "web/"},
+		{value: "C:/builds/dist", path: "C:/builds/dist"},
+		{value: "dt=2024-01-01:events", path: "dt=2024-01-01", key: "events/"},
+	}
+	for _, tc := range cases {
+		path, key := uploader.ParseSource(prefixedSource(tc.value))
+		if path != tc.path || key != tc.key {
+			t.Errorf("%s: expected %q, %q, got %q, %q", tc.value, tc.path, tc.key, path, key)
+		}
+	}
+}
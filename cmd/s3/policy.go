@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/delivery-station/ds/pkg/types"
+)
+
+// enforceEncryption refuses to write through transfer when
+// policy.require_encryption is set and neither an encryption mode is
+// configured nor the bucket encrypts new objects by default.
+func (p *Plugin) enforceEncryption(ctx context.Context, transfer *uploader.Transport, cfg *config.Config) error {
+	if !cfg.Policy.RequireEncryption || transfer.Encrypted() {
+		return nil
+	}
+
+	mode, err := transfer.BucketEncryption(ctx)
+	if err != nil {
+		return fmt.Errorf("policy.require_encryption: %w", err)
+	}
+	if mode == "" {
+		return fmt.Errorf("policy.require_encryption: bucket %s has no default encryption and no encryption.mode is configured, refusing to upload", cfg.Bucket)
+	}
+
+	p.logger.Debug("Bucket default encryption verified", "bucket", cfg.Bucket, "mode", mode)
+	return nil
+}
+
+// checkAllowedPrefixes refuses an operation writing or deleting below one of
+// prefixes outside policy.allowed_prefixes before its first write; an empty
+// prefix stands for the whole bucket. The transport refuses every single
+// write outside them anyway, this only fails before anything was written.
+func checkAllowedPrefixes(cfg *config.Config, prefixes ...string) error {
+	for _, prefix := range prefixes {
+		if err := cfg.Policy.CheckPrefix(prefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkACL verifies, before the first write through transfer, that the bucket
+// accepts the configured canned ACL. Buckets with Object Ownership set to
+// BucketOwnerEnforced have ACLs disabled and fail every write carrying one
+// other than bucket-owner-full-control with AccessControlListNotSupported;
+// acl.when_disabled decides whether that fails the command or the ACL is
+// dropped. Ownership that cannot be read is logged and the ACL kept.
+func (p *Plugin) checkACL(ctx context.Context, transfer *uploader.Transport, cfg *config.Config) error {
+	acl := transfer.ACL()
+	if acl == "" || acl == s3types.ObjectCannedACLBucketOwnerFullControl {
+		return nil
+	}
+
+	ownership, err := transfer.BucketOwnership(ctx)
+	if err != nil {
+		p.logger.Warn("Cannot tell whether the bucket accepts ACLs, writes fail if it has them disabled", "bucket", cfg.Bucket, "acl", acl, "error", err)
+		return nil
+	}
+	if ownership != s3types.ObjectOwnershipBucketOwnerEnforced {
+		p.logger.Debug("Bucket accepts ACLs", "bucket", cfg.Bucket, "ownership", ownership)
+		return nil
+	}
+	if cfg.ACL.WhenDisabled == config.ACLDisabledDrop {
+		p.logger.Warn("Bucket has ACLs disabled, writing objects without the configured ACL", "bucket", cfg.Bucket, "acl", acl)
+		transfer.SetACL("")
+		return nil
+	}
+	return fmt.Errorf("acl.canned: bucket %s has ACLs disabled (Object Ownership is BucketOwnerEnforced) and would reject every object written with the %s ACL; remove acl.canned, set acl.when_disabled to drop, or change the Object Ownership of the bucket", cfg.Bucket, acl)
+}
+
+// checkKMSKeys asks KMS, before the first write through transfer, whether the
+// caller may generate data keys with every configured KMS key, so a missing
+// kms:GenerateDataKey permission fails the command up front instead of every
+// object after gigabytes were sent. The dry runs carry the encryption context
+// S3 uses for the bucket. Keys that are missing or disabled fail the command.
+// A denied key only fails it with encryption.preflight_strict, as key
+// policies allowing the key only through S3 deny the direct call; otherwise
+// it is logged like other errors and the upload goes ahead.
+func (p *Plugin) checkKMSKeys(ctx context.Context, transfer *uploader.Transport, cfg *config.Config) error {
+	keys := transfer.KMSKeys()
+	if !cfg.Encryption.Preflight || len(keys) == 0 {
+		return nil
+	}
+	awsCfg, err := p.awsConfig(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to configure AWS SDK: %w", err)
+	}
+
+	// Access points encrypt with the ARN of a bucket unknown here.
+	var encryptionContext map[string]string
+	if !arn.IsARN(cfg.Bucket) {
+		encryptionContext = map[string]string{"aws:s3:arn": "arn:" + partitionOf(awsCfg.Region) + ":s3:::" + cfg.Bucket}
+	}
+	for _, key := range keys {
+		_, err := newKMSClient(awsCfg, key).GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+			KeyId:             aws.String(key),
+			KeySpec:           kmstypes.DataKeySpecAes256,
+			EncryptionContext: encryptionContext,
+			DryRun:            aws.Bool(true),
+		})
+		var apiErr smithy.APIError
+		if !errors.As(err, &apiErr) {
+			if err != nil {
+				p.logger.Warn("Cannot verify access to KMS key, uploads fail if it is denied", "kms_key_id", key, "error", err)
+			}
+			continue
+		}
+		switch apiErr.ErrorCode() {
+		case "DryRunOperationException":
+			p.logger.Debug("KMS key verified", "kms_key_id", key)
+		case "AccessDeniedException":
+			if !cfg.Encryption.PreflightStrict {
+				p.logger.Warn("Not allowed to generate data keys with KMS key, uploads fail unless its policy allows it through S3", "kms_key_id", key, "error", apiErr.ErrorMessage())
+				continue
+			}
+			return fmt.Errorf("encryption.preflight: not allowed to generate data keys with KMS key %s, so S3 would reject every object encrypted with it; grant kms:GenerateDataKey on the key, or unset encryption.preflight_strict if its policy only allows use through S3: %s", key, apiErr.ErrorMessage())
+		case "NotFoundException", "DisabledException", "KMSInvalidStateException":
+			return fmt.Errorf("encryption.preflight: KMS key %s cannot encrypt objects: %s", key, apiErr.ErrorMessage())
+		default:
+			p.logger.Warn("Cannot verify access to KMS key, uploads fail if it is denied", "kms_key_id", key, "error", err)
+		}
+	}
+	return nil
+}
+
+// applyEncryptionOverrides applies the CLI flags that control server-side and
+// client-side encryption.
+func applyEncryptionOverrides(cfg *config.Config, args types.PluginArgs) {
+	if mode, ok := args.First("sse"); ok {
+		cfg.Encryption.Mode = config.NormalizeEncryptionMode(mode)
+	}
+	if keyID, ok := args.First("sse-kms-key-id"); ok {
+		cfg.Encryption.KMSKeyID = strings.TrimSpace(keyID)
+	}
+	if bucketKey, ok := args.Bool("sse-bucket-key"); ok {
+		cfg.Encryption.BucketKey = bucketKey
+	}
+	if keyID, ok := args.First("client-encryption-kms-key-id"); ok {
+		cfg.ClientEncryption.KMSKeyID = strings.TrimSpace(keyID)
+	}
+	// The flag can only turn the policy on: a host requiring encryption is
+	// not overruled by a pipeline passing --require-encryption=false.
+	if require, ok := args.Bool("require-encryption"); ok && require {
+		cfg.Policy.RequireEncryption = true
+	}
+}
+
+// partitionOf returns the AWS partition of region, which ARNs of resources in
+// the region name.
+func partitionOf(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	case strings.HasPrefix(region, "us-isob-"):
+		return "aws-iso-b"
+	case strings.HasPrefix(region, "us-iso-"):
+		return "aws-iso"
+	}
+	return "aws"
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds/pkg/types"
+)
+
+func TestRequireEncryptionFlagOnlyTurnsPolicyOn(t *testing.T) {
+	cfg := &config.Config{}
+	applyEncryptionOverrides(cfg, types.NewPluginArgs([]string{"require-encryption=true"}))
+	if !cfg.Policy.RequireEncryption {
+		t.Error("expected --require-encryption to turn the policy on")
+	}
+
+	cfg = &config.Config{Policy: config.Policy{RequireEncryption: true}}
+	applyEncryptionOverrides(cfg, types.NewPluginArgs([]string{"require-encryption=false"}))
+	if !cfg.Policy.RequireEncryption {
+		t.Error("expected --require-encryption=false to leave the policy of the host on")
+	}
+}
+
+func TestPartitionOf(t *testing.T) {
+	tests := map[string]string{
+		"eu-central-1":   "aws",
+		"":               "aws",
+		"cn-north-1":     "aws-cn",
+		"us-gov-west-1":  "aws-us-gov",
+		"us-iso-east-1":  "aws-iso",
+		"us-isob-east-1": "aws-iso-b",
+	}
+	for region, want := range tests {
+		if got := partitionOf(region); got != want {
+			t.Errorf("%q: expected partition %s, got %s", region, want, got)
+		}
+	}
+}
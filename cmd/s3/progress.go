@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/hashicorp/go-hclog"
+)
+
+// throughputWindow is the span the rolling throughput, and the ETA derived
+// from it, are measured over, long enough to smooth out files of different
+// sizes and short enough to follow a slowing connection.
+const throughputWindow = 30 * time.Second
+
+// Progress checkpoint states.
+const (
+	progressUploading = "uploading"
+	progressCompleted = "completed"
+	progressFailed    = "failed"
+)
+
+// progressReport is the checkpoint written to progress.file. Throughput is
+// the rolling rate over throughputWindow and Average the rate since the
+// upload started, both in bytes per second. Totals are only known, and an
+// ETA only estimated, when the plans are built before the upload starts,
+// that is without stream_plans.
+type progressReport struct {
+	RunID       string    `json:"run_id"`
+	State       string    `json:"state"`
+	StartedAt   time.Time `json:"started_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	FilesDone   int       `json:"files_done"`
+	FilesTotal  int       `json:"files_total,omitempty"`
+	BytesDone   int64     `json:"bytes_done"`
+	BytesTotal  int64     `json:"bytes_total,omitempty"`
+	CurrentFile string    `json:"current_file,omitempty"`
+	Throughput  int64     `json:"throughput_bytes_per_second"`
+	Average     int64     `json:"average_bytes_per_second"`
+	ETASeconds  *int64    `json:"eta_seconds,omitempty"`
+	FilesFailed int       `json:"files_failed,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// progressSample is the number of bytes done at a point in time.
+type progressSample struct {
+	at    time.Time
+	bytes int64
+}
+
+// progressCheckpoint tracks the files of an upload and, every
+// progress.interval, logs its progress and rewrites the progress file, so
+// that operators, monitors and the DS UI can follow an upload whose stdout
+// the host only reads once it exits. Files count as done once uploaded in
+// full; bytes of a file in flight are not reported.
+type progressCheckpoint struct {
+	path     string
+	interval time.Duration
+	logger   hclog.Logger
+	stopped  chan struct{}
+	finished chan struct{}
+
+	mu       sync.Mutex
+	report   progressReport
+	inFlight []string
+	samples  []progressSample
+}
+
+// newProgressCheckpoint builds the checkpoint configured by cfg for an upload
+// of plans. Without a progress file it only logs. Streamed uploads pass no
+// plans.
+func newProgressCheckpoint(cfg *config.Config, runID string, plans []uploader.FilePlan, logger hclog.Logger) *progressCheckpoint {
+	c := &progressCheckpoint{
+		path:     cfg.Progress.File,
+		interval: cfg.Progress.Interval,
+		logger:   logger,
+		stopped:  make(chan struct{}),
+		finished: make(chan struct{}),
+		report:   progressReport{RunID: runID, State: progressUploading},
+	}
+	if c.interval <= 0 {
+		c.interval = config.DefaultProgressInterval
+	}
+	if !cfg.StreamPlans {
+		c.report.FilesTotal = len(plans)
+		for _, plan := range plans {
+			c.report.BytesTotal += plan.Size
+		}
+	}
+	return c
+}
+
+// start writes the first checkpoint and keeps rewriting it until stop.
+func (c *progressCheckpoint) start() {
+	c.mu.Lock()
+	c.report.StartedAt = time.Now().UTC()
+	c.samples = []progressSample{{at: c.report.StartedAt}}
+	c.mu.Unlock()
+	c.write(c.snapshot())
+
+	go func() {
+		defer close(c.finished)
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stopped:
+				return
+			case <-ticker.C:
+				report := c.snapshot()
+				c.log(report)
+				c.write(report)
+			}
+		}
+	}()
+}
+
+// stop writes the final checkpoint, completed or failed with err, and
+// returns it.
+func (c *progressCheckpoint) stop(err error) progressReport {
+	close(c.stopped)
+	<-c.finished
+
+	c.mu.Lock()
+	c.report.State = progressCompleted
+	if err != nil {
+		c.report.State = progressFailed
+		c.report.Error = err.Error()
+	}
+	c.inFlight = nil
+	c.mu.Unlock()
+	report := c.snapshot()
+	c.write(report)
+	return report
+}
+
+// FileStarted implements uploader.Progress.
+func (c *progressCheckpoint) FileStarted(plan uploader.FilePlan) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight = append(c.inFlight, plan.Source)
+}
+
+// FileDone implements uploader.Progress.
+func (c *progressCheckpoint) FileDone(plan uploader.FilePlan, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, source := range c.inFlight {
+		if source == plan.Source {
+			c.inFlight = append(c.inFlight[:i], c.inFlight[i+1:]...)
+			break
+		}
+	}
+	if err != nil {
+		c.report.FilesFailed++
+		return
+	}
+	c.report.FilesDone++
+	c.report.BytesDone += plan.Size
+}
+
+// snapshot returns the report as of now, with the most recently started file
+// still in flight as the current file and the ETA estimated from the rolling
+// throughput.
+func (c *progressCheckpoint) snapshot() progressReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	report := c.report
+	report.UpdatedAt = time.Now().UTC()
+	if len(c.inFlight) > 0 {
+		report.CurrentFile = c.inFlight[len(c.inFlight)-1]
+	}
+
+	c.samples = append(c.samples, progressSample{at: report.UpdatedAt, bytes: report.BytesDone})
+	// Keep the newest sample at or before the window start to measure from.
+	for len(c.samples) > 2 && report.UpdatedAt.Sub(c.samples[1].at) >= throughputWindow {
+		c.samples = c.samples[1:]
+	}
+	oldest := c.samples[0]
+	report.Throughput = bytesPerSecond(report.BytesDone-oldest.bytes, report.UpdatedAt.Sub(oldest.at))
+	report.Average = bytesPerSecond(report.BytesDone, report.UpdatedAt.Sub(report.StartedAt))
+
+	rate := report.Throughput
+	if rate == 0 {
+		// Nothing finished within the window, such as while one large file
+		// is uploaded; the average is the better guess then.
+		rate = report.Average
+	}
+	if report.State == progressUploading && report.BytesTotal > 0 && rate > 0 {
+		eta := (report.BytesTotal - report.BytesDone + rate/2) / rate
+		report.ETASeconds = &eta
+	}
+	return report
+}
+
+// log records report as a progress event.
+func (c *progressCheckpoint) log(report progressReport) {
+	fields := []interface{}{
+		"files_done", report.FilesDone,
+		"bytes_done", config.FormatByteSize(report.BytesDone),
+		"throughput", config.FormatByteSize(report.Throughput) + "/s",
+	}
+	if report.FilesTotal > 0 {
+		fields = append(fields, "files_total", report.FilesTotal, "bytes_total", config.FormatByteSize(report.BytesTotal))
+	}
+	if report.ETASeconds != nil {
+		fields = append(fields, "eta", (time.Duration(*report.ETASeconds) * time.Second).String())
+	}
+	c.logger.Info("Upload progress", fields...)
+}
+
+// write replaces the progress file, if any, with report. The file is renamed
+// into place so that a poller never reads a partial one; failures are
+// logged, as progress reporting must not fail the upload.
+func (c *progressCheckpoint) write(report progressReport) {
+	if c.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(c.path, append(data, '\n'))
+	}
+	if err != nil {
+		c.logger.Warn("Failed to write progress checkpoint", "file", c.path, "error", err)
+	}
+}
+
+// bytesPerSecond returns the rate of n bytes over elapsed, rounded down.
+func bytesPerSecond(n int64, elapsed time.Duration) int64 {
+	if n <= 0 || elapsed <= 0 {
+		return 0
+	}
+	return int64(float64(n) / elapsed.Seconds())
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// over path.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
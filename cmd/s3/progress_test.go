@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/hashicorp/go-hclog"
+)
+
+func readProgress(t *testing.T, path string) progressReport {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report progressReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("failed to decode checkpoint: %v", err)
+	}
+	return report
+}
+
+func TestProgressCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "progress.json")
+	cfg := &config.Config{Progress: config.Progress{File: path, Interval: time.Hour}}
+	plans := []uploader.FilePlan{{Source: "a", Size: 100}, {Source: "b", Size: 50}, {Source: "c", Size: 25}}
+
+	checkpoint := newProgressCheckpoint(cfg, "run-1", plans, hclog.NewNullLogger())
+	checkpoint.start()
+	if report := readProgress(t, path); report.State != progressUploading || report.RunID != "run-1" || report.FilesTotal != 3 || report.BytesTotal != 175 {
+		t.Errorf("unexpected first checkpoint %+v", report)
+	}
+
+	checkpoint.FileStarted(plans[0])
+	checkpoint.FileStarted(plans[1])
+	checkpoint.FileDone(plans[0], nil)
+	if report := checkpoint.snapshot(); report.FilesDone != 1 || report.BytesDone != 100 || report.CurrentFile != "b" {
+		t.Errorf("unexpected progress %+v", report)
+	}
+	checkpoint.FileDone(plans[1], errors.New("denied"))
+
+	report := checkpoint.stop(errors.New("1 file failed"))
+	if report.State != progressFailed || report.FilesFailed != 1 || report.Error != "1 file failed" || report.CurrentFile != "" || report.ETASeconds != nil {
+		t.Errorf("unexpected final report %+v", report)
+	}
+	if written := readProgress(t, path); written.State != progressFailed || written.FilesDone != 1 {
+		t.Errorf("expected the final checkpoint to be written, got %+v", written)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".progress.json.*")); len(matches) > 0 {
+		t.Errorf("expected no temporary files to be left, got %v", matches)
+	}
+
+	streamed := newProgressCheckpoint(&config.Config{StreamPlans: true}, "run-2", plans, hclog.NewNullLogger())
+	if streamed.report.FilesTotal != 0 || streamed.report.BytesTotal != 0 || streamed.interval != config.DefaultProgressInterval {
+		t.Errorf("expected streamed uploads to have no totals and the default interval, got %+v", streamed.report)
+	}
+}
+
+func TestProgressThroughputAndETA(t *testing.T) {
+	checkpoint := newProgressCheckpoint(&config.Config{}, "run-1", []uploader.FilePlan{{Source: "a", Size: 2010}}, hclog.NewNullLogger())
+	now := time.Now().UTC()
+	checkpoint.report.StartedAt = now.Add(-time.Minute)
+	checkpoint.report.BytesDone = 1010
+	// Samples older than the window are dropped, keeping the newest one at
+	// or before its start: 1010 bytes over the last 40s.
+	checkpoint.samples = []progressSample{
+		{at: now.Add(-time.Minute)},
+		{at: now.Add(-40 * time.Second)},
+		{at: now.Add(-20 * time.Second), bytes: 600},
+	}
+	report := checkpoint.snapshot()
+	if report.Throughput != 25 || report.Average != 16 {
+		t.Errorf("unexpected throughput %d and average %d", report.Throughput, report.Average)
+	}
+	if report.ETASeconds == nil || *report.ETASeconds != 40 {
+		t.Errorf("expected an ETA of 40s from the rolling throughput, got %v", report.ETASeconds)
+	}
+	if len(checkpoint.samples) != 3 || !checkpoint.samples[0].at.Equal(now.Add(-40*time.Second)) {
+		t.Errorf("unexpected samples kept %v", checkpoint.samples)
+	}
+
+	// Without bytes done within the window the average is the estimate.
+	checkpoint.samples = []progressSample{{at: now.Add(-20 * time.Second), bytes: 1010}}
+	report = checkpoint.snapshot()
+	if report.Throughput != 0 || report.ETASeconds == nil || *report.ETASeconds != 63 {
+		t.Errorf("expected an ETA of 63s from the average, got throughput %d, ETA %v", report.Throughput, report.ETASeconds)
+	}
+
+	if rate := bytesPerSecond(100, 0); rate != 0 {
+		t.Errorf("expected no rate without elapsed time, got %d", rate)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/delivery-station/ds/pkg/types"
+)
+
+func (p *Plugin) handlePromote(ctx context.Context, baseCfg *config.Config, args types.PluginArgs) (*types.ExecutionResult, error) {
+	if help, ok := args.BoolAny("help", "h"); ok && help {
+		return &types.ExecutionResult{Stdout: promoteUsage(), ExitCode: 0}, nil
+	}
+
+	merged := baseCfg.Clone()
+	auditConfigFrom(ctx).use(merged)
+	applyTargetOverrides(merged, args)
+	if overwrite, ok := args.Bool("overwrite"); ok {
+		merged.Overwrite = overwrite
+	}
+	if acl, ok := args.First("acl"); ok {
+		merged.ACL.Canned = strings.ToLower(strings.TrimSpace(acl))
+	}
+	if err := applyMultipartOverrides(merged, args); err != nil {
+		return configFailure(ctx, err), nil
+	}
+	applyEncryptionOverrides(merged, args)
+
+	fromTarget, _ := args.First("from-target")
+	toTarget, _ := args.First("to-target")
+
+	fromCfg, err := merged.ForTarget(fromTarget)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	toCfg, err := merged.ForTarget(toTarget)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	if bucket, ok := args.First("to-bucket"); ok && strings.TrimSpace(bucket) != "" {
+		toCfg.Bucket = strings.TrimSpace(bucket)
+	}
+	auditConfigFrom(ctx).use(toCfg)
+
+	fromPrefix, _ := args.First("from")
+	toPrefix, ok := args.First("to")
+	if !ok {
+		err := fmt.Errorf("--to is required")
+		return &types.ExecutionResult{ExitCode: 1, Stderr: promoteUsage(), Error: err.Error()}, nil
+	}
+
+	for _, cfg := range []*config.Config{fromCfg, toCfg} {
+		if err := cfg.Validate(); err != nil {
+			return configFailure(ctx, err), nil
+		}
+	}
+	selector, err := selectorArgs(fromCfg, args)
+	if err != nil {
+		return configFailure(ctx, err), nil
+	}
+
+	opts := uploader.PromoteOptions{
+		Stream: !config.SameConnection(fromCfg, toCfg),
+		Verify: true,
+	}
+	if stream, ok := args.Bool("stream"); ok && stream {
+		opts.Stream = true
+	}
+	if verify, ok := args.Bool("verify"); ok {
+		opts.Verify = verify
+	}
+
+	fromClient, err := p.newS3Client(ctx, fromCfg)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	toClient, err := p.newS3Client(ctx, toCfg)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+
+	budget := uploader.NewMemoryBudget(merged.MemoryLimit)
+	from, err := newTransport(fromClient, fromCfg, budget)
+	if err != nil {
+		return configFailure(ctx, err), nil
+	}
+	to, err := newTransport(toClient, toCfg, budget)
+	if err != nil {
+		return configFailure(ctx, err), nil
+	}
+	if err := checkAllowedPrefixes(toCfg, toCfg.ContextPath); err != nil {
+		return configFailure(ctx, err), nil
+	}
+	if err := p.enforceEncryption(ctx, to, toCfg); err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	if err := p.checkACL(ctx, to, toCfg); err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	if err := p.checkKMSKeys(ctx, to, toCfg); err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	if selector != nil {
+		from.SetSelector(*selector)
+	}
+
+	results, err := uploader.Promote(ctx, from, fromPrefix, to, toPrefix, opts)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("promote failed after %d objects: %v", len(results), err)}, nil
+	}
+	p.logger.Info("Promote completed", "objects", len(results), "from", fromPrefix, "to", toPrefix, "stream", opts.Stream)
+
+	summary := promoteSummary{
+		FromBucket: fromCfg.Bucket,
+		FromPrefix: strings.Trim(strings.TrimSpace(fromPrefix), "/"),
+		ToBucket:   toCfg.Bucket,
+		ToPrefix:   strings.Trim(strings.TrimSpace(toPrefix), "/"),
+		Streamed:   opts.Stream,
+		Verified:   opts.Verify,
+		Filter:     selector,
+		Objects:    results,
+		DryRun:     toCfg.DryRun,
+	}
+
+	payload, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("failed to encode execution summary: %v", err)}, nil
+	}
+
+	return &types.ExecutionResult{
+		Stdout:   string(payload) + "\n",
+		ExitCode: 0,
+	}, nil
+}
+
+func promoteUsage() string {
+	return `Usage: ds s3 promote --from <prefix> --to <prefix> [flags]
+
+Copies every object under one prefix to another, optionally between named
+targets. Targets behind different endpoints or credentials are streamed through
+the plugin; otherwise a server-side copy is used. --filter-tag and
+--filter-metadata copy only the objects carrying the given tags and user
+metadata, such as the ds-run-id of one pipeline run.
+
+Flags:
+  --from <prefix>            Source prefix
+  --to <prefix>              Destination prefix
+  --from-target <name>       Named target from configuration to read from
+  --to-target <name>         Named target from configuration to write to
+  --to-bucket <name>         Override the destination bucket
+  --filter-tag <key=value>   Only copy objects carrying this tag (repeatable)
+  --filter-metadata <key=value>  Only copy objects with this user metadata (repeatable)
+  --stream                   Force streaming instead of server-side copy
+  --verify                   Verify size/etag of each promoted object (default true)
+  --overwrite                Overwrite conflicting objects (default true)
+  --acl <canned>             Canned ACL of promoted objects (see acl.canned)
+  --part-size <size>         Multipart part size for streamed objects
+  --memory-limit <size>      Ceiling for part buffers of streamed objects
+  --sse <mode>               Server-side encryption of promoted objects
+  --sse-kms-key-id <id>      KMS key for the aws:kms modes
+  --require-encryption       Refuse to promote unless objects are encrypted at rest
+  --bucket <name>            Override the base bucket (defaults to configuration)
+  --region <name>            Override AWS region
+  --endpoint <url>           Use a custom S3-compatible endpoint
+  --profile <name>           Shared AWS profile to use
+  --mfa-token <code>         MFA code for credentials.mfa_serial (or $DS_S3_MFA_TOKEN)
+  --debug-aws-config         Log the resolved region, endpoint, addressing, retries, credential source and signer
+`
+}
+
+type promoteSummary struct {
+	FromBucket string                   `json:"from_bucket"`
+	FromPrefix string                   `json:"from_prefix,omitempty"`
+	ToBucket   string                   `json:"to_bucket"`
+	ToPrefix   string                   `json:"to_prefix,omitempty"`
+	Streamed   bool                     `json:"streamed"`
+	Verified   bool                     `json:"verified"`
+	Filter     *uploader.Selector       `json:"filter,omitempty"`
+	Objects    []uploader.PromoteResult `json:"objects"`
+	DryRun     bool                     `json:"dry_run,omitempty"`
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyendpoints "github.com/aws/smithy-go/endpoints"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/hashicorp/go-hclog"
+)
+
+// regionRedirect follows the 301 PermanentRedirect S3 answers a request to a
+// bucket in another region than the configured one with. The response names
+// the region of the bucket in its x-amz-bucket-region header; the request is
+// retried there, and so are the later requests of the client. Nothing is
+// looked up until a request is redirected.
+type regionRedirect struct {
+	bucket     string
+	configured string
+	logger     hclog.Logger
+
+	mu     sync.Mutex
+	region string
+}
+
+// followRegionRedirects makes the client of cfg follow region redirects,
+// unless the bucket is reached through a custom endpoint, an access point
+// ARN carrying its own region or a directory bucket in its zone.
+func followRegionRedirects(cfg *config.Config, configured string, logger hclog.Logger) func(*s3.Options) {
+	return func(o *s3.Options) {
+		if cfg.Endpoint != "" || cfg.Bucket == "" || cfg.IsAccessPoint() || cfg.IsDirectoryBucket() {
+			return
+		}
+		redirect := &regionRedirect{bucket: cfg.Bucket, configured: configured, logger: logger}
+		o.EndpointResolverV2 = redirectedResolver{EndpointResolverV2: o.EndpointResolverV2, redirect: redirect}
+		if retryer, ok := o.Retryer.(aws.RetryerV2); ok {
+			o.Retryer = redirectRetryer{RetryerV2: retryer, redirect: redirect}
+		}
+	}
+}
+
+// clientRegion returns the region of the bucket client was built for with
+// region configured: the region its requests were redirected to, and then
+// the region they were redirected from, or configured itself.
+func clientRegion(client *s3.Client, configured string) (string, string) {
+	retryer, ok := client.Options().Retryer.(redirectRetryer)
+	if !ok {
+		return configured, ""
+	}
+	if region := retryer.redirect.current(); region != "" {
+		return region, retryer.redirect.configured
+	}
+	return configured, ""
+}
+
+func (r *regionRedirect) current() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.region
+}
+
+// follow records the region a redirect in err names and reports whether the
+// request is to be retried there.
+func (r *regionRedirect) follow(err error) bool {
+	region := redirectedTo(err)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if region == "" || region == r.region || (r.region == "" && region == r.configured) {
+		return false
+	}
+	r.region = region
+	r.logger.Warn("Bucket is in a different region than configured, redirecting", "bucket", r.bucket, "configured", r.configured, "region", region)
+	return true
+}
+
+// redirectedTo returns the region a 301 response names for the bucket, or
+// an empty string for other errors.
+func redirectedTo(err error) string {
+	var response *smithyhttp.ResponseError
+	if !errors.As(err, &response) || response.HTTPStatusCode() != http.StatusMovedPermanently {
+		return ""
+	}
+	return response.Response.Header.Get("x-amz-bucket-region")
+}
+
+// redirectRetryer retries requests redirected to the region of the bucket.
+type redirectRetryer struct {
+	aws.RetryerV2
+	redirect *regionRedirect
+}
+
+func (r redirectRetryer) IsErrorRetryable(err error) bool {
+	return r.redirect.follow(err) || r.RetryerV2.IsErrorRetryable(err)
+}
+
+// RetryDelay retries a redirected request right away, as it is not the
+// bucket that failed.
+func (r redirectRetryer) RetryDelay(attempt int, err error) (time.Duration, error) {
+	if region := redirectedTo(err); region != "" && region == r.redirect.current() {
+		return 0, nil
+	}
+	return r.RetryerV2.RetryDelay(attempt, err)
+}
+
+// redirectedResolver resolves the endpoints, and so the signing region, of
+// requests in the region they were redirected to.
+type redirectedResolver struct {
+	s3.EndpointResolverV2
+	redirect *regionRedirect
+}
+
+func (r redirectedResolver) ResolveEndpoint(ctx context.Context, params s3.EndpointParameters) (smithyendpoints.Endpoint, error) {
+	if region := r.redirect.current(); region != "" {
+		params.Region = aws.String(region)
+	}
+	return r.EndpointResolverV2.ResolveEndpoint(ctx, params)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestRegionRedirect(t *testing.T) {
+	var signed []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		signed = append(signed, authorization)
+		if !strings.Contains(authorization, "/eu-west-1/s3/") {
+			w.Header().Set("x-amz-bucket-region", "eu-west-1")
+			w.WriteHeader(http.StatusMovedPermanently)
+			_, _ = w.Write([]byte(`<Error><Code>PermanentRedirect</Code><Message>The bucket you are attempting to access must be addressed using the specified endpoint.</Message></Error>`))
+			return
+		}
+		_, _ = w.Write([]byte(`<ListBucketResult><Name>artifacts</Name><IsTruncated>false</IsTruncated></ListBucketResult>`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{Bucket: "artifacts"}
+	newClient := func(region string) *s3.Client {
+		return s3.New(s3.Options{
+			Region:       region,
+			BaseEndpoint: aws.String(server.URL),
+			UsePathStyle: true,
+			Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+			Retryer:      newRetryer(config.Retry{}, nil),
+		}, followRegionRedirects(cfg, region, hclog.NewNullLogger()))
+	}
+	list := func(client *s3.Client) error {
+		_, err := client.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{Bucket: aws.String("artifacts")})
+		return err
+	}
+
+	client := newClient("us-east-1")
+	if region, from := clientRegion(client, "us-east-1"); region != "us-east-1" || from != "" || len(signed) > 0 {
+		t.Fatalf("expected nothing to be looked up before a request, got %s from %q after %d requests", region, from, len(signed))
+	}
+	if err := list(client); err != nil {
+		t.Fatalf("expected the redirected request to succeed, got %v", err)
+	}
+	if len(signed) != 2 {
+		t.Fatalf("expected the request to be retried once, got %d requests", len(signed))
+	}
+	if err := list(client); err != nil || len(signed) != 3 {
+		t.Fatalf("expected later requests to go to the bucket region directly, got %v after %d requests", err, len(signed))
+	}
+	if region, from := clientRegion(client, "us-east-1"); region != "eu-west-1" || from != "us-east-1" {
+		t.Errorf("expected the client to report the redirect, got %s from %q", region, from)
+	}
+
+	signed = nil
+	client = newClient("eu-west-1")
+	if err := list(client); err != nil || len(signed) != 1 {
+		t.Fatalf("expected a request in the bucket region not to be redirected, got %v after %d requests", err, len(signed))
+	}
+	if region, from := clientRegion(client, "eu-west-1"); region != "eu-west-1" || from != "" {
+		t.Errorf("expected no redirect, got %s from %q", region, from)
+	}
+}
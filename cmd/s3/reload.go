@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds/pkg/types"
+)
+
+// configSnapshots tracks the configuration each operation of a long-lived
+// plugin process ran with. Every operation resolves its own snapshot from
+// the current host configuration; the previous one is only kept to report
+// what changed in between.
+type configSnapshots struct {
+	mu       sync.Mutex
+	previous *config.Config
+}
+
+// record stores cfg as the latest snapshot and returns the settings that
+// changed since the previous one, and whether there was one.
+func (s *configSnapshots) record(cfg *config.Config) ([]string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.previous
+	s.previous = cfg
+	if previous == nil {
+		return nil, false
+	}
+	return cfg.ChangedSettings(previous), true
+}
+
+// handleReload reports the settings changed since the previous operation of
+// this process and drops the AWS configurations shared between operations,
+// so that the next one reads the shared AWS files and credentials again.
+// Execute has already re-read the host configuration, so the reload itself
+// takes effect for every later operation either way.
+func (p *Plugin) handleReload(ctx context.Context, cfg *config.Config, changed []string, hadPrevious bool, args types.PluginArgs) (*types.ExecutionResult, error) {
+	if help, ok := args.BoolAny("help", "h"); ok && help {
+		return &types.ExecutionResult{Stdout: reloadUsage(), ExitCode: 0}, nil
+	}
+	if err := cfg.Validate(); err != nil {
+		return configFailure(ctx, err), nil
+	}
+	p.awsConfigs.reset()
+
+	summary := reloadSummary{Changed: changed, Initial: !hadPrevious}
+	if summary.Changed == nil {
+		summary.Changed = []string{}
+	}
+	payload, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("failed to encode execution summary: %v", err)}, nil
+	}
+	return &types.ExecutionResult{Stdout: string(payload) + "\n", ExitCode: 0}, nil
+}
+
+func reloadUsage() string {
+	return `Usage: ds s3 reload [flags]
+
+Re-reads the host configuration and the local .ds-s3.yaml, validates them and
+lists the settings that changed since the previous operation of this plugin
+process. Every operation reads the current configuration when it starts, so
+reload is only needed to check a change before the next operation runs, or to
+drop the connections and credentials operations with the same settings share,
+for example after editing ~/.aws/config.
+
+Flags:
+  --env <name>               Validate with a configured environment overlay (defaults to $DS_ENV)
+`
+}
+
+type reloadSummary struct {
+	Changed []string `json:"changed"`
+	Initial bool     `json:"initial,omitempty"`
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/delivery-station/ds/pkg/types"
+)
+
+// replicaSummary reports the outcome of uploading to a single replication target.
+type replicaSummary struct {
+	Target          string `json:"target"`
+	Bucket          string `json:"bucket"`
+	Endpoint        string `json:"endpoint,omitempty"`
+	Region          string `json:"region,omitempty"`
+	RegionFrom      string `json:"region_corrected_from,omitempty"`
+	Succeeded       bool   `json:"succeeded"`
+	Error           string `json:"error,omitempty"`
+	ObjectsRemoved  int    `json:"objects_removed"`
+	ObjectsUploaded int    `json:"objects_uploaded"`
+}
+
+// startReplicas uploads to every replication target concurrently, each
+// consuming its own plan feed. The returned function blocks until all replicas
+// finish and returns their summaries. Replicas are stamped with the same build
+// context and attestation digests as the primary upload, and share its
+// throttle.
+func (p *Plugin) startReplicas(ctx context.Context, cfg *config.Config, feeds []<-chan uploader.FilePlan, budget *uploader.MemoryBudget, throttle *uploader.Throttle, stamp, digests map[string]string) func() []replicaSummary {
+	summaries := make([]replicaSummary, len(cfg.Replication.Targets))
+	var wg sync.WaitGroup
+
+	for i, name := range cfg.Replication.Targets {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			summaries[i] = p.replicate(ctx, cfg, name, feeds[i], budget, throttle, stamp, digests)
+		}(i, name)
+	}
+
+	return func() []replicaSummary {
+		wg.Wait()
+		return summaries
+	}
+}
+
+func (p *Plugin) replicate(ctx context.Context, cfg *config.Config, name string, plans <-chan uploader.FilePlan, budget *uploader.MemoryBudget, throttle *uploader.Throttle, stamp, digests map[string]string) (summary replicaSummary) {
+	summary = replicaSummary{Target: name}
+	// Drain whatever is left so the shared plan feed never blocks on this replica.
+	defer func() {
+		for range plans {
+		}
+	}()
+
+	replicaCfg, err := cfg.ForTarget(name)
+	if err != nil {
+		summary.Error = err.Error()
+		return summary
+	}
+	summary.Bucket = replicaCfg.Bucket
+	summary.Endpoint = replicaCfg.Endpoint
+
+	if err := replicaCfg.Validate(); err != nil {
+		summary.Error = err.Error()
+		return summary
+	}
+
+	client, err := p.newS3Client(ctx, replicaCfg)
+	if err != nil {
+		summary.Error = err.Error()
+		return summary
+	}
+	// Requests may be redirected to the region of the bucket any time.
+	defer func() {
+		summary.Region, summary.RegionFrom = clientRegion(client, replicaCfg.Region)
+	}()
+	transfer, err := newTransport(client, replicaCfg, budget)
+	if err != nil {
+		summary.Error = err.Error()
+		return summary
+	}
+	annotateTransport(transfer, replicaCfg, stamp, digests)
+	transfer.SetConcurrency(replicaCfg.Concurrency)
+	transfer.SetThrottle(throttle)
+
+	if err := checkAllowedPrefixes(replicaCfg, replicaCfg.ContextPath); err != nil {
+		summary.Error = err.Error()
+		return summary
+	}
+	if err := p.enforceEncryption(ctx, transfer, replicaCfg); err != nil {
+		summary.Error = err.Error()
+		return summary
+	}
+	if err := p.checkACL(ctx, transfer, replicaCfg); err != nil {
+		summary.Error = err.Error()
+		return summary
+	}
+	if err := p.checkKMSKeys(ctx, transfer, replicaCfg); err != nil {
+		summary.Error = err.Error()
+		return summary
+	}
+	if err := p.applyClientEncryption(ctx, transfer, replicaCfg); err != nil {
+		summary.Error = err.Error()
+		return summary
+	}
+
+	if replicaCfg.Cleanup {
+		deleted, err := transfer.Cleanup(ctx, replicaCfg.ContextPath)
+		if err != nil {
+			summary.Error = fmt.Sprintf("cleanup failed: %v", err)
+			return summary
+		}
+		summary.ObjectsRemoved = deleted
+	}
+
+	results, err := transfer.UploadStream(ctx, plans)
+	if err != nil {
+		summary.Error = err.Error()
+		p.logger.Warn("Replica upload failed", "target", name, "error", err)
+		return summary
+	}
+
+	summary.ObjectsUploaded = len(results)
+	summary.Succeeded = true
+	p.logger.Info("Replica upload completed", "target", name, "uploaded", len(results))
+	return summary
+}
+
+// withReplicas adds the summaries of replicas to result, the failure of the
+// primary upload, as the replicas may have succeeded regardless.
+func withReplicas(result *types.ExecutionResult, replicas []replicaSummary) *types.ExecutionResult {
+	if len(replicas) == 0 {
+		return result
+	}
+	payload, err := json.MarshalIndent(struct {
+		Replicas []replicaSummary `json:"replicas"`
+	}{replicas}, "", "  ")
+	if err == nil {
+		result.Stdout = string(payload) + "\n"
+	}
+	return result
+}
+
+// failedReplicas returns a description of every replica that did not succeed.
+func failedReplicas(replicas []replicaSummary) string {
+	failed := make([]string, 0)
+	for _, r := range replicas {
+		if !r.Succeeded {
+			failed = append(failed, fmt.Sprintf("%s: %s", r.Target, r.Error))
+		}
+	}
+	return strings.Join(failed, "; ")
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds/pkg/types"
+	"github.com/hashicorp/go-hclog"
+)
+
+// s3Endpoint serves an S3 endpoint that stores nothing: puts succeed when
+// accept is set and are denied otherwise, and every read finds nothing.
+func s3Endpoint(t *testing.T, accept bool) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		switch {
+		case r.Method == http.MethodPut && accept:
+			w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+		case r.Method == http.MethodPut:
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>Not Found</Message></Error>`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestUploadReportsReplicasWhenThePrimaryFails(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app.js"), []byte("console.log(1)\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	target := func(server *httptest.Server) map[string]interface{} {
+		return map[string]interface{}{"bucket": "artifacts", "endpoint": server.URL}
+	}
+	cfg, err := config.FromSettingsMap(map[string]interface{}{
+		"bucket":           "artifacts",
+		"region":           "us-east-1",
+		"endpoint":         s3Endpoint(t, false).URL,
+		"force_path_style": true,
+		"context_path":     "builds/7",
+		"credentials":      map[string]interface{}{"access_key_id": "key", "secret_access_key": "secret"},
+		"retry":            map[string]interface{}{"max_attempts": 1},
+		"failure_report":   filepath.Join(t.TempDir(), "failures.json"),
+		"targets": map[string]interface{}{
+			"mirror": target(s3Endpoint(t, true)),
+			"dr":     target(s3Endpoint(t, false)),
+		},
+		"replication": map[string]interface{}{"targets": []interface{}{"mirror", "dr"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugin := NewPlugin(newLogOutput(io.Discard, hclog.Error), "1.0.0", "", "")
+
+	result, err := plugin.handleUpload(context.Background(), cfg, types.NewPluginArgs([]string{"arg0=" + dir}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ExitCode == 0 {
+		t.Fatalf("expected the failed primary upload to fail the run, got %+v", result)
+	}
+	var report struct {
+		Replicas []replicaSummary `json:"replicas"`
+	}
+	if err := json.Unmarshal([]byte(result.Stdout), &report); err != nil {
+		t.Fatalf("expected the replicas in the output, got %q: %v", result.Stdout, err)
+	}
+	if len(report.Replicas) != 2 {
+		t.Fatalf("expected both replicas, got %+v", report.Replicas)
+	}
+	mirror, dr := report.Replicas[0], report.Replicas[1]
+	if mirror.Target != "mirror" || !mirror.Succeeded || mirror.ObjectsUploaded != 1 {
+		t.Errorf("expected the mirror to succeed, got %+v", mirror)
+	}
+	if dr.Target != "dr" || dr.Succeeded || !strings.Contains(dr.Error, "AccessDenied") {
+		t.Errorf("expected the dr replica to be denied, got %+v", dr)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/delivery-station/ds/pkg/types"
+)
+
+func (p *Plugin) handleRollback(ctx context.Context, baseCfg *config.Config, args types.PluginArgs) (*types.ExecutionResult, error) {
+	if help, ok := args.BoolAny("help", "h"); ok && help {
+		return &types.ExecutionResult{Stdout: rollbackUsage(), ExitCode: 0}, nil
+	}
+
+	merged := baseCfg.Clone()
+	auditConfigFrom(ctx).use(merged)
+	applyTargetOverrides(merged, args)
+	if contextPath, ok := args.FirstAny("context", "context-path"); ok && strings.TrimSpace(contextPath) != "" {
+		merged.ContextPath = strings.Trim(strings.TrimSpace(contextPath), "/")
+	}
+
+	if err := merged.Validate(); err != nil {
+		return configFailure(ctx, err), nil
+	}
+	if merged.IsDirectoryBucket() {
+		return &types.ExecutionResult{ExitCode: 1, Error: "directory buckets do not support versioning"}, nil
+	}
+	if merged.IsGCS() {
+		return &types.ExecutionResult{ExitCode: 1, Error: "the gcs backend does not support S3 object versions"}, nil
+	}
+	if err := confirm(args, merged, fmt.Sprintf("Roll back the objects below s3://%s/%s to their previous versions", merged.Bucket, merged.ContextPath)); err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+
+	var targets map[string]string
+	if manifestPath, ok := args.First("manifest"); ok && strings.TrimSpace(manifestPath) != "" {
+		loaded, err := loadRollbackTargets(strings.TrimSpace(manifestPath))
+		if err != nil {
+			return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+		}
+		targets = loaded
+	}
+
+	client, err := p.newS3Client(ctx, merged)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	transfer, err := newTransport(client, merged, nil)
+	if err != nil {
+		return configFailure(ctx, err), nil
+	}
+	if err := checkAllowedPrefixes(merged, merged.ContextPath); err != nil {
+		return configFailure(ctx, err), nil
+	}
+	if err := p.checkACL(ctx, transfer, merged); err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	if err := p.checkKMSKeys(ctx, transfer, merged); err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+
+	results, err := rollbackRecorded(ctx, transfer, merged, targets)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("rollback failed: %v", err)}, nil
+	}
+	p.logger.Info("Rollback completed", "keys", len(results), "prefix", merged.ContextPath)
+
+	summary := rollbackSummary{
+		Bucket:      merged.Bucket,
+		Region:      merged.Region,
+		ContextPath: merged.ContextPath,
+		Objects:     results,
+		DryRun:      merged.DryRun,
+	}
+
+	payload, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("failed to encode execution summary: %v", err)}, nil
+	}
+
+	return &types.ExecutionResult{
+		Stdout:   string(payload) + "\n",
+		ExitCode: 0,
+	}, nil
+}
+
+// rollbackRecord is stored at the rollback state key. Replaced maps every
+// key a rollback restored or deleted to the version it replaced, so running
+// the same rollback again, such as in a retried pipeline step, leaves those
+// keys alone instead of restoring the version just rolled back.
+type rollbackRecord struct {
+	Replaced map[string]string `json:"replaced"`
+}
+
+// rollbackRecorded rolls back the context path, skipping keys the last
+// rollback already handled, and records the keys it handles in turn. The
+// record is written after a failed rollback too, so a retry continues it.
+func rollbackRecorded(ctx context.Context, transfer *uploader.Transport, cfg *config.Config, targets map[string]string) ([]uploader.RollbackResult, error) {
+	key := cfg.RollbackStateObjectKey()
+	record := rollbackRecord{Replaced: map[string]string{}}
+	data, err := transfer.ReadObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("failed to parse rollback record %s: %w", key, err)
+		}
+		if record.Replaced == nil {
+			record.Replaced = map[string]string{}
+		}
+	}
+
+	results, err := transfer.Rollback(ctx, cfg.ContextPath, uploader.RollbackOptions{
+		Targets:  targets,
+		Replaced: record.Replaced,
+		Skip:     []string{key},
+	})
+	changed := false
+	for _, result := range results {
+		if result.Action == uploader.RollbackRestored || result.Action == uploader.RollbackDeleted {
+			record.Replaced[result.Key] = result.FromVersion
+			changed = true
+		}
+	}
+	if changed {
+		payload, marshalErr := json.Marshal(record)
+		if marshalErr != nil {
+			return results, errors.Join(err, fmt.Errorf("failed to encode rollback record: %w", marshalErr))
+		}
+		if writeErr := transfer.WriteObject(ctx, key, payload, "application/json"); writeErr != nil {
+			return results, errors.Join(err, writeErr)
+		}
+	}
+	return results, err
+}
+
+// loadRollbackTargets reads the key to version mapping from a previous upload summary.
+func loadRollbackTargets(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", path, err)
+	}
+
+	var summary uploadSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+
+	targets := make(map[string]string, len(summary.ObjectsUploaded))
+	for _, obj := range summary.ObjectsUploaded {
+		if obj.VersionID == "" {
+			return nil, fmt.Errorf("manifest %s has no version id for %s (was the bucket versioned?)", path, obj.Key)
+		}
+		targets[obj.Key] = obj.VersionID
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("manifest %s does not list any objects", path)
+	}
+
+	return targets, nil
+}
+
+func rollbackUsage() string {
+	return `Usage: ds s3 rollback [flags]
+
+Restores every object under the context path of a versioned bucket to its
+previous version. Objects that did not exist before are deleted. Running the
+same rollback again leaves the objects it rolled back alone.
+
+Flags:
+  --bucket <name>            Override target bucket (defaults to configuration)
+  --region <name>            Override AWS region
+  --context <prefix>         Object prefix/context path to roll back
+  --manifest <file>          Restore the versions recorded in an upload summary instead
+  --yes                      Roll back without asking on an interactive terminal
+  --endpoint <url>           Use a custom S3-compatible endpoint
+  --force-path-style         Force path-style addressing
+  --skip-tls-verify          Disable TLS verification (requires --endpoint)
+  --profile <name>           Shared AWS profile to use
+  --mfa-token <code>         MFA code for credentials.mfa_serial (or $DS_S3_MFA_TOKEN)
+  --debug-aws-config         Log the resolved region, endpoint, addressing, retries, credential source and signer
+`
+}
+
+type rollbackSummary struct {
+	Bucket      string                    `json:"bucket"`
+	Region      string                    `json:"region,omitempty"`
+	ContextPath string                    `json:"context_path,omitempty"`
+	Objects     []uploader.RollbackResult `json:"objects"`
+	DryRun      bool                      `json:"dry_run,omitempty"`
+}
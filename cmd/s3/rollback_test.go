@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/s3fake"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+)
+
+func TestRollbackTwiceIsANoOp(t *testing.T) {
+	ctx := context.Background()
+	fake := s3fake.New()
+	fake.EnableVersioning("artifacts")
+	fake.Put("artifacts", s3fake.Object{Key: "builds/7/app.bin", Body: []byte("v1")})
+	fake.Put("artifacts", s3fake.Object{Key: "builds/7/app.bin", Body: []byte("v2")})
+	fake.Put("artifacts", s3fake.Object{Key: "builds/7/new.txt", Body: []byte("new")})
+	transfer := uploader.NewTransport(fake, fake, "artifacts", true)
+	cfg := &config.Config{Bucket: "artifacts", ContextPath: "builds/7"}
+
+	results, err := rollbackRecorded(ctx, transfer, cfg, nil)
+	if err != nil {
+		t.Fatalf("rollbackRecorded returned error: %v", err)
+	}
+	if len(results) != 2 || results[0].Action != uploader.RollbackRestored || results[1].Action != uploader.RollbackDeleted {
+		t.Fatalf("expected app.bin restored and new.txt deleted, got %+v", results)
+	}
+
+	results, err = rollbackRecorded(ctx, transfer, cfg, nil)
+	if err != nil {
+		t.Fatalf("repeated rollbackRecorded returned error: %v", err)
+	}
+	for _, result := range results {
+		if result.Action != uploader.RollbackSkipped {
+			t.Errorf("expected the repeat to skip %s, got %+v", result.Key, result)
+		}
+	}
+	if object, ok := fake.Object("artifacts", "builds/7/app.bin"); !ok || string(object.Body) != "v1" {
+		t.Errorf("expected app.bin to stay at v1, got %q, %v", object.Body, ok)
+	}
+	if _, ok := fake.Object("artifacts", "builds/7/new.txt"); ok {
+		t.Error("expected new.txt to stay deleted")
+	}
+
+	// A new upload after the rollback is rolled back as usual.
+	fake.Put("artifacts", s3fake.Object{Key: "builds/7/app.bin", Body: []byte("v3")})
+	results, err = rollbackRecorded(ctx, transfer, cfg, nil)
+	if err != nil {
+		t.Fatalf("rollbackRecorded returned error: %v", err)
+	}
+	if object, ok := fake.Object("artifacts", "builds/7/app.bin"); !ok || string(object.Body) != "v1" {
+		t.Errorf("expected app.bin to be rolled back to v1 again, got %q, %v: %+v", object.Body, ok, results)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/delivery-station/ds-s3/internal/buildinfo"
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/hashicorp/go-hclog"
+)
+
+// resolveRunID returns the id of this run: run_id when configured, else the
+// pipeline run id DS exports, which stays the same when a failed pipeline is
+// re-run. Only those are stable; a generated id merely labels the objects.
+func resolveRunID(cfg *config.Config) (string, bool, error) {
+	id := cfg.RunID
+	if id == "" {
+		id = buildinfo.FromEnv(os.LookupEnv).RunID
+	}
+	if id != "" {
+		if err := config.ValidateRunID(id); err != nil {
+			return "", false, err
+		}
+		return id, true, nil
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", false, fmt.Errorf("failed to generate run id: %w", err)
+	}
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix), false, nil
+}
+
+// runRecord is the state object of a run, stored below the context path so a
+// re-run with the same id knows which destructive steps already happened.
+type runRecord struct {
+	RunID     string    `json:"run_id"`
+	StartedAt time.Time `json:"started_at"`
+	Snapshot  string    `json:"snapshot_path,omitempty"`
+	CleanedUp bool      `json:"cleaned_up,omitempty"`
+	Completed bool      `json:"completed,omitempty"`
+}
+
+// runTracker keeps the run record of a run with a stable id up to date. A nil
+// tracker, for runs with a generated id, records nothing.
+type runTracker struct {
+	transfer *uploader.Transport
+	key      string
+	record   runRecord
+	// resumed is set when an earlier attempt of the run left a record.
+	resumed bool
+}
+
+// startRun loads the record of an earlier attempt of the run, or stores a new
+// one so that a later attempt can find it.
+func startRun(ctx context.Context, transfer *uploader.Transport, cfg *config.Config, id string, stable bool, logger hclog.Logger) (*runTracker, error) {
+	if !stable {
+		return nil, nil
+	}
+	run := &runTracker{
+		transfer: transfer,
+		key:      cfg.RunStateObjectKey(id),
+		record:   runRecord{RunID: id, StartedAt: time.Now().UTC()},
+	}
+	data, err := transfer.ReadObject(ctx, run.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run state: %w", err)
+	}
+	if data != nil {
+		var previous runRecord
+		if err := json.Unmarshal(data, &previous); err != nil {
+			logger.Warn("Ignoring unreadable run state", "key", run.key, "error", err)
+		} else if previous.RunID == id {
+			run.record = previous
+			run.resumed = true
+			logger.Info("Resuming run", "run_id", id, "started_at", previous.StartedAt, "completed", previous.Completed)
+			return run, nil
+		}
+	}
+	return run, run.save(ctx)
+}
+
+func (r *runTracker) save(ctx context.Context) error {
+	data, err := json.MarshalIndent(r.record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode run state: %w", err)
+	}
+	if err := r.transfer.WriteObject(ctx, r.key, data, "application/json"); err != nil {
+		return fmt.Errorf("failed to store run state: %w", err)
+	}
+	return nil
+}
+
+// snapshot returns the snapshot an earlier attempt of the run took.
+func (r *runTracker) snapshot() (string, bool) {
+	if r == nil || r.record.Snapshot == "" {
+		return "", false
+	}
+	return r.record.Snapshot, true
+}
+
+func (r *runTracker) recordSnapshot(ctx context.Context, location string) error {
+	if r == nil {
+		return nil
+	}
+	r.record.Snapshot = location
+	return r.save(ctx)
+}
+
+// cleanedUp reports whether an earlier attempt of the run already removed the
+// existing objects, in which case cleaning up again would delete its uploads.
+func (r *runTracker) cleanedUp() bool {
+	return r != nil && r.record.CleanedUp
+}
+
+func (r *runTracker) recordCleanup(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	r.record.CleanedUp = true
+	return r.save(ctx)
+}
+
+// startedAt returns when the first attempt of the run started, or fallback
+// for runs with a generated id.
+func (r *runTracker) startedAt(fallback time.Time) time.Time {
+	if r == nil {
+		return fallback
+	}
+	return r.record.StartedAt
+}
+
+func (r *runTracker) complete(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	r.record.Completed = true
+	return r.save(ctx)
+}
+
+// resumeGuard skips files an earlier attempt of the run already uploaded, as
+// told by the run id in the object metadata and the size and SHA-256 of the
+// object, and reports them as uploaded.
+// It runs after the other guards, including sync, so skipped files are still
+// recorded in the sync state.
+type resumeGuard struct {
+	transfer *uploader.Transport
+
+	mu      sync.Mutex
+	resumed []uploader.UploadResult
+}
+
+// newResumeGuard returns the guard for a resumed run, or nil. Replicas only
+// receive the files uploaded to the primary target in this attempt, so
+// resuming is disabled when replicating.
+func newResumeGuard(run *runTracker, transfer *uploader.Transport, cfg *config.Config, logger hclog.Logger) *resumeGuard {
+	if run == nil || !run.resumed {
+		return nil
+	}
+	if len(cfg.Replication.Targets) > 0 {
+		logger.Info("Uploading every file again as replication is configured", "run_id", run.record.RunID)
+		return nil
+	}
+	return &resumeGuard{transfer: transfer}
+}
+
+func (g *resumeGuard) checkAll(ctx context.Context, plans []uploader.FilePlan) ([]uploader.FilePlan, error) {
+	pending := make([]uploader.FilePlan, 0, len(plans))
+	for _, plan := range plans {
+		keep, err := g.check(ctx, plan)
+		if err != nil {
+			return nil, err
+		}
+		if keep {
+			pending = append(pending, plan)
+		}
+	}
+	return pending, nil
+}
+
+func (g *resumeGuard) check(ctx context.Context, plan uploader.FilePlan) (bool, error) {
+	result, done, err := g.transfer.UploadedByRun(ctx, plan)
+	if err != nil || !done {
+		return err == nil, err
+	}
+	result.Source = plan.Source
+	result.Size = plan.Size
+	g.mu.Lock()
+	g.resumed = append(g.resumed, result)
+	g.mu.Unlock()
+	return false, nil
+}
+
+// report returns the files an earlier attempt uploaded.
+func (g *resumeGuard) report() []uploader.UploadResult {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]uploader.UploadResult(nil), g.resumed...)
+}
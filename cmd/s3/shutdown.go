@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/hashicorp/go-hclog"
+	"google.golang.org/grpc/stats"
+)
+
+// lifecycle cancels the running commands when the plugin process is asked to
+// stop and waits for them to clean up. As the gRPC stats handler of the
+// plugin server it also counts the calls of the host in flight, so that the
+// process only exits once the results of the canceled commands were sent.
+type lifecycle struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	// grace is the configured shutdown_grace_period in nanoseconds.
+	grace atomic.Int64
+
+	mu      sync.Mutex
+	running int
+	// calls counts the unary calls from their start until their response
+	// was written.
+	calls   int
+	drained chan struct{}
+}
+
+func newLifecycle() *lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &lifecycle{ctx: ctx, cancel: cancel}
+	l.grace.Store(int64(config.DefaultShutdownGracePeriod))
+	return l
+}
+
+// begin registers a running command. The returned context is canceled on
+// shutdown; done must be called when the command has finished.
+func (l *lifecycle) begin(ctx context.Context) (context.Context, func()) {
+	l.mu.Lock()
+	l.running++
+	l.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(l.ctx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.running--
+		l.checkDrained()
+	}
+}
+
+// checkDrained closes drained once neither commands nor calls are left. The
+// caller holds mu.
+func (l *lifecycle) checkDrained() {
+	if l.running == 0 && l.calls == 0 && l.drained != nil {
+		close(l.drained)
+		l.drained = nil
+	}
+}
+
+// callKey marks the context of a call counted in calls.
+type callKey struct{}
+
+// TagRPC implements stats.Handler.
+func (l *lifecycle) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, callKey{}, new(bool))
+}
+
+// HandleRPC implements stats.Handler. Streams, such as the one go-plugin
+// forwards stdio over, live as long as the connection and are not counted.
+// The end of a unary call is reported once its response and status were
+// written.
+func (l *lifecycle) HandleRPC(ctx context.Context, rpcStats stats.RPCStats) {
+	counted, _ := ctx.Value(callKey{}).(*bool)
+	if counted == nil {
+		return
+	}
+	switch s := rpcStats.(type) {
+	case *stats.Begin:
+		if s.IsClientStream || s.IsServerStream {
+			return
+		}
+		*counted = true
+		l.mu.Lock()
+		l.calls++
+		l.mu.Unlock()
+	case *stats.End:
+		if !*counted {
+			return
+		}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.calls--
+		l.checkDrained()
+	}
+}
+
+// TagConn implements stats.Handler.
+func (l *lifecycle) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+// HandleConn implements stats.Handler.
+func (l *lifecycle) HandleConn(context.Context, stats.ConnStats) {}
+
+// setGrace records the grace period configured for the running command.
+func (l *lifecycle) setGrace(grace time.Duration) {
+	if grace > 0 {
+		l.grace.Store(int64(grace))
+	}
+}
+
+// shutdown cancels the running commands and reports whether they finished,
+// and the host was sent their results, within the grace period.
+func (l *lifecycle) shutdown() bool {
+	l.mu.Lock()
+	l.cancel()
+	drained := make(chan struct{})
+	l.drained = drained
+	l.checkDrained()
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Duration(l.grace.Load()))
+	defer timer.Stop()
+	select {
+	case <-drained:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// handleSignals stops the plugin gracefully on SIGTERM or SIGINT: running
+// commands are canceled, which aborts their multipart uploads and writes
+// their failure reports, and the process exits once their results were sent
+// to the host or the grace period ran out. A second signal exits at once.
+func handleSignals(logger hclog.Logger, l *lifecycle) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+
+	received := <-signals
+	logger.Warn("Shutting down, canceling running commands", "signal", received.String(), "grace_period", time.Duration(l.grace.Load()).String())
+	go func() {
+		<-signals
+		logger.Warn("Second signal received, exiting immediately")
+		os.Exit(exitCode(received))
+	}()
+
+	if !l.shutdown() {
+		logger.Warn("Running commands did not finish within the grace period")
+	}
+	os.Exit(exitCode(received))
+}
+
+// exitCode follows the shell convention of 128 plus the signal number.
+func exitCode(received os.Signal) int {
+	if number, ok := received.(syscall.Signal); ok {
+		return 128 + int(number)
+	}
+	return 1
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/stats"
+)
+
+func TestLifecycleShutdown(t *testing.T) {
+	l := newLifecycle()
+	l.setGrace(time.Second)
+
+	ctx, done := l.begin(context.Background())
+	unary := l.TagRPC(context.Background(), &stats.RPCTagInfo{FullMethodName: "/plugin.Plugin/Execute"})
+	l.HandleRPC(unary, &stats.Begin{})
+	stream := l.TagRPC(context.Background(), &stats.RPCTagInfo{FullMethodName: "/plugin.GRPCStdio/StreamStdio"})
+	l.HandleRPC(stream, &stats.Begin{IsServerStream: true})
+
+	finished := make(chan bool)
+	go func() { finished <- l.shutdown() }()
+
+	// The command is canceled, finishes, and only once its result was
+	// written does the shutdown complete; the stdio stream stays open.
+	<-ctx.Done()
+	done()
+	select {
+	case <-finished:
+		t.Fatal("expected the shutdown to wait for the result to be sent")
+	case <-time.After(20 * time.Millisecond):
+	}
+	l.HandleRPC(unary, &stats.End{})
+	select {
+	case ok := <-finished:
+		if !ok {
+			t.Error("expected the shutdown to complete within the grace period")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the shutdown to complete once the result was sent")
+	}
+}
+
+func TestLifecycleShutdownTimesOut(t *testing.T) {
+	l := newLifecycle()
+	l.setGrace(20 * time.Millisecond)
+	_, done := l.begin(context.Background())
+	defer done()
+	if l.shutdown() {
+		t.Error("expected a command ignoring cancellation to exceed the grace period")
+	}
+
+	idle := newLifecycle()
+	if !idle.shutdown() {
+		t.Error("expected a shutdown without commands to complete at once")
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	if code := exitCode(syscall.SIGTERM); code != 143 {
+		t.Errorf("expected 143 for SIGTERM, got %d", code)
+	}
+	if code := exitCode(os.Kill); code != 137 {
+		t.Errorf("expected 137 for SIGKILL, got %d", code)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/delivery-station/ds/pkg/types"
+)
+
+func (p *Plugin) handleSnapshot(ctx context.Context, baseCfg *config.Config, args types.PluginArgs) (*types.ExecutionResult, error) {
+	if help, ok := args.BoolAny("help", "h"); ok && help {
+		return &types.ExecutionResult{Stdout: snapshotUsage(), ExitCode: 0}, nil
+	}
+
+	merged := baseCfg.Clone()
+	auditConfigFrom(ctx).use(merged)
+	applyTargetOverrides(merged, args)
+	if contextPath, ok := args.FirstAny("context", "context-path"); ok && strings.TrimSpace(contextPath) != "" {
+		merged.ContextPath = strings.Trim(strings.TrimSpace(contextPath), "/")
+	}
+	applySnapshotOverrides(merged, args)
+
+	if err := merged.Validate(); err != nil {
+		return configFailure(ctx, err), nil
+	}
+
+	client, err := p.newS3Client(ctx, merged)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	transfer, err := newTransport(client, merged, nil)
+	if err != nil {
+		return configFailure(ctx, err), nil
+	}
+	if err := checkAllowedPrefixes(merged, merged.Snapshot.Prefix); err != nil {
+		return configFailure(ctx, err), nil
+	}
+	if err := p.checkACL(ctx, transfer, merged); err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	if err := p.checkKMSKeys(ctx, transfer, merged); err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+
+	location, copied, err := transfer.Snapshot(ctx, merged.ContextPath, merged.Snapshot.Prefix, time.Now())
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("snapshot failed: %v", err)}, nil
+	}
+	p.logger.Info("Snapshot completed", "copied", len(copied), "prefix", merged.ContextPath, "snapshot", location)
+
+	summary := snapshotSummary{
+		Bucket:       merged.Bucket,
+		Region:       merged.Region,
+		ContextPath:  merged.ContextPath,
+		SnapshotPath: location,
+		Objects:      copied,
+		DryRun:       merged.DryRun,
+	}
+
+	payload, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("failed to encode execution summary: %v", err)}, nil
+	}
+
+	return &types.ExecutionResult{
+		Stdout:   string(payload) + "\n",
+		ExitCode: 0,
+	}, nil
+}
+
+func applySnapshotOverrides(cfg *config.Config, args types.PluginArgs) {
+	if prefix, ok := args.First("snapshot-prefix"); ok && strings.Trim(strings.TrimSpace(prefix), "/") != "" {
+		cfg.Snapshot.Prefix = strings.Trim(strings.TrimSpace(prefix), "/")
+	}
+}
+
+func snapshotUsage() string {
+	return `Usage: ds s3 snapshot [flags]
+
+Server-side copies every object under the context path to
+<snapshot-prefix>/<timestamp>/<context> for point-in-time recovery.
+
+Flags:
+  --bucket <name>            Override target bucket (defaults to configuration)
+  --region <name>            Override AWS region
+  --context <prefix>         Object prefix/context path to snapshot
+  --snapshot-prefix <prefix> Root prefix for snapshots (default "snapshots")
+  --endpoint <url>           Use a custom S3-compatible endpoint
+  --force-path-style         Force path-style addressing
+  --skip-tls-verify          Disable TLS verification (requires --endpoint)
+  --profile <name>           Shared AWS profile to use
+  --mfa-token <code>         MFA code for credentials.mfa_serial (or $DS_S3_MFA_TOKEN)
+  --debug-aws-config         Log the resolved region, endpoint, addressing, retries, credential source and signer
+`
+}
+
+type snapshotSummary struct {
+	Bucket       string                `json:"bucket"`
+	Region       string                `json:"region,omitempty"`
+	ContextPath  string                `json:"context_path,omitempty"`
+	SnapshotPath string                `json:"snapshot_path"`
+	Objects      []uploader.CopyResult `json:"objects"`
+	DryRun       bool                  `json:"dry_run,omitempty"`
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+)
+
+// truncateSummary returns the upload summary to print and its JSON encoding.
+// A summary listing more objects than limits.MaxObjects is written in full
+// to limits.File and printed with only the first MaxObjects objects, so that
+// large runs stay within what hosts read from stdout. payload is the full
+// summary encoded; it is printed as is when the summary fits or the full
+// summary cannot be written.
+func (p *Plugin) truncateSummary(limits config.Summary, summary uploadSummary, payload []byte) (uploadSummary, []byte) {
+	if limits.MaxObjects == 0 || len(summary.ObjectsUploaded) <= limits.MaxObjects {
+		return summary, payload
+	}
+	if err := os.WriteFile(limits.File, append(payload, '\n'), 0o644); err != nil {
+		p.logger.Warn("Failed to write the full upload summary, printing it in full", "file", limits.File, "error", err)
+		return summary, payload
+	}
+
+	left := summary.ObjectsUploaded[limits.MaxObjects:]
+	summary.ObjectsUploaded = summary.ObjectsUploaded[:limits.MaxObjects]
+	summary.ObjectsTruncated = len(left)
+	summary.FullSummary = limits.File
+	for _, obj := range left {
+		summary.truncatedSize += obj.Size
+	}
+	truncated, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return summary, payload
+	}
+	return summary, truncated
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+)
+
+func TestTruncateSummary(t *testing.T) {
+	p := newTestPlugin()
+	summary := uploadSummary{Bucket: "artifacts"}
+	for _, key := range []string{"a", "b", "c"} {
+		summary.ObjectsUploaded = append(summary.ObjectsUploaded, uploader.UploadResult{Key: key, Size: 10})
+	}
+	payload, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "summary.json")
+	if shown, shownPayload := p.truncateSummary(config.Summary{MaxObjects: 3, File: file}, summary, payload); len(shown.ObjectsUploaded) != 3 || string(shownPayload) != string(payload) {
+		t.Errorf("expected a summary within the limit to be printed as is, got %d objects", len(shown.ObjectsUploaded))
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("expected no full summary to be written, got %v", err)
+	}
+
+	shown, shownPayload := p.truncateSummary(config.Summary{MaxObjects: 1, File: file}, summary, payload)
+	if len(shown.ObjectsUploaded) != 1 || shown.ObjectsTruncated != 2 || shown.truncatedSize != 20 || shown.FullSummary != file {
+		t.Errorf("unexpected truncated summary %+v", shown)
+	}
+	var printed uploadSummary
+	if err := json.Unmarshal(shownPayload, &printed); err != nil || len(printed.ObjectsUploaded) != 1 || printed.ObjectsTruncated != 2 {
+		t.Errorf("expected the printed summary to be truncated, got %+v, %v", printed, err)
+	}
+	var full uploadSummary
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &full); err != nil || len(full.ObjectsUploaded) != 3 {
+		t.Errorf("expected the file to hold the full summary, got %d objects, %v", len(full.ObjectsUploaded), err)
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing", "summary.json")
+	if shown, _ := p.truncateSummary(config.Summary{MaxObjects: 1, File: missing}, summary, payload); len(shown.ObjectsUploaded) != 3 {
+		t.Errorf("expected the full summary to be printed when the file cannot be written, got %d objects", len(shown.ObjectsUploaded))
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/internal/syncstate"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/hashicorp/go-hclog"
+)
+
+// syncGuard skips files that are unchanged since the last successful sync,
+// as recorded in the state object stored in the bucket or, with a cache
+// directory, in the local sync cache. It runs after the other guards so files
+// they drop are not recorded as uploaded.
+type syncGuard struct {
+	tracker *syncstate.Tracker
+	key     string
+	cache   *syncstate.Cache
+	target  string
+}
+
+// newSyncGuard loads the sync state configured by cfg, or returns nil when
+// sync is disabled. An unreadable state is logged and treated as empty, so
+// the run uploads everything and writes a fresh one.
+func newSyncGuard(ctx context.Context, transfer *uploader.Transport, cfg *config.Config, logger hclog.Logger) (*syncGuard, error) {
+	if !cfg.Sync.Enabled {
+		return nil, nil
+	}
+
+	guard := &syncGuard{key: cfg.SyncStateObjectKey()}
+	if cfg.Sync.CacheDir != "" {
+		cache, err := syncstate.NewCache(cfg.Sync.CacheDir)
+		if err != nil {
+			return nil, err
+		}
+		guard.cache = cache
+		guard.target = syncTarget(cfg)
+		previous, err := cache.Load(guard.target)
+		if err != nil {
+			logger.Warn("Ignoring unreadable sync cache, uploading everything", "cache_dir", cfg.Sync.CacheDir, "error", err)
+		}
+		guard.tracker = syncstate.NewTracker(previous)
+		return guard, nil
+	}
+
+	data, err := transfer.ReadObject(ctx, guard.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync state: %w", err)
+	}
+
+	var previous *syncstate.State
+	if data != nil {
+		if previous, err = syncstate.Decode(data); err != nil {
+			logger.Warn("Ignoring unreadable sync state, uploading everything", "key", guard.key, "error", err)
+		}
+	}
+	guard.tracker = syncstate.NewTracker(previous)
+	return guard, nil
+}
+
+// syncTarget identifies the destination in the local sync cache, so one cache
+// serves every endpoint, bucket and context path an agent uploads to.
+func syncTarget(cfg *config.Config) string {
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "aws"
+	}
+	return endpoint + " " + cfg.Bucket + "/" + cfg.SyncStateObjectKey()
+}
+
+func (g *syncGuard) checkAll(ctx context.Context, plans []uploader.FilePlan) ([]uploader.FilePlan, error) {
+	changed := make([]uploader.FilePlan, 0, len(plans))
+	for _, plan := range plans {
+		keep, err := g.check(ctx, plan)
+		if err != nil {
+			return nil, err
+		}
+		if keep {
+			changed = append(changed, plan)
+		}
+	}
+	return changed, nil
+}
+
+func (g *syncGuard) check(ctx context.Context, plan uploader.FilePlan) (bool, error) {
+	changed, err := g.tracker.Changed(plan.Key, plan.Source)
+	if err != nil {
+		return false, fmt.Errorf("sync check failed: %w", err)
+	}
+	return changed, nil
+}
+
+// store records the state of this run for the next one.
+func (g *syncGuard) store(ctx context.Context, transfer *uploader.Transport) error {
+	if g == nil {
+		return nil
+	}
+	if g.cache != nil {
+		return g.cache.Save(g.target, g.tracker.State())
+	}
+	data, err := g.tracker.State().Encode()
+	if err != nil {
+		return fmt.Errorf("failed to encode sync state: %w", err)
+	}
+	if err := transfer.WriteObject(ctx, g.key, data, "application/gzip"); err != nil {
+		return fmt.Errorf("failed to store sync state: %w", err)
+	}
+	return nil
+}
+
+// skipped returns how many files were left out as unchanged.
+func (g *syncGuard) skipped() int {
+	if g == nil {
+		return 0
+	}
+	return g.tracker.Skipped()
+}
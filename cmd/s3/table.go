@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds/pkg/types"
+)
+
+// ANSI styles used by the table output.
+const (
+	styleReset  = "\x1b[0m"
+	styleBold   = "\x1b[1m"
+	styleDim    = "\x1b[2m"
+	styleRed    = "\x1b[31m"
+	styleGreen  = "\x1b[32m"
+	styleYellow = "\x1b[33m"
+	styleCyan   = "\x1b[36m"
+)
+
+// outputFormat reads --format for commands printing a summary: "json", the
+// default, or "table" for reading in a terminal.
+func outputFormat(args types.PluginArgs) (string, error) {
+	format, _ := args.First("format")
+	switch format = strings.ToLower(strings.TrimSpace(format)); format {
+	case "":
+		return "json", nil
+	case "json", "table":
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid --format %q (expected json or table)", format)
+	}
+}
+
+// colorEnabled reports whether table output is colorized. The plugin writes
+// its output through DS and cannot tell whether it ends up in a terminal, so
+// color is asked for with --color; NO_COLOR turns it off regardless.
+func colorEnabled(args types.PluginArgs) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	color, ok := args.Bool("color")
+	return ok && color
+}
+
+// table renders aligned rows, optionally colorized. Styles are applied after
+// padding so escape sequences do not upset the alignment.
+type table struct {
+	color bool
+	b     strings.Builder
+}
+
+func (t *table) style(text string, styles ...string) string {
+	if !t.color || len(styles) == 0 {
+		return text
+	}
+	return strings.Join(styles, "") + text + styleReset
+}
+
+// rows writes header and rows with every column but the last padded to its
+// widest cell. styleOf returns the style of a row's first column.
+func (t *table) rows(header []string, rows [][]string, styleOf func(row []string) string) {
+	widths := make([]int, len(header))
+	for _, row := range append([][]string{header}, rows...) {
+		for i, cell := range row {
+			widths[i] = max(widths[i], len(cell))
+		}
+	}
+	line := func(row []string, first string, rest ...string) {
+		for i, cell := range row {
+			if i < len(row)-1 {
+				cell += strings.Repeat(" ", widths[i]-len(cell)+2)
+			}
+			if i == 0 {
+				t.b.WriteString(t.style(cell, first))
+			} else {
+				t.b.WriteString(t.style(cell, rest...))
+			}
+		}
+		t.b.WriteString("\n")
+	}
+	line(header, styleBold, styleBold)
+	for _, row := range rows {
+		line(row, styleOf(row))
+	}
+}
+
+func (t *table) String() string {
+	return t.b.String()
+}
+
+// formatUploadTable renders the upload summary as a table of the uploaded
+// objects followed by a summary of the run.
+func formatUploadTable(summary uploadSummary, color bool) string {
+	t := &table{color: color}
+	rows := make([][]string, 0, len(summary.ObjectsUploaded))
+	var total int64
+	for _, obj := range summary.ObjectsUploaded {
+		status := "uploaded"
+		if obj.Resumed {
+			status = "resumed"
+		}
+		rows = append(rows, []string{status, obj.Key, config.FormatByteSize(obj.Size), obj.Source})
+		total += obj.Size
+	}
+	if len(rows) > 0 {
+		t.rows([]string{"STATUS", "KEY", "SIZE", "SOURCE"}, rows, func(row []string) string {
+			if row[0] == "resumed" {
+				return styleDim
+			}
+			return styleGreen
+		})
+		if summary.ObjectsTruncated > 0 {
+			fmt.Fprintf(&t.b, "%s\n", t.style(fmt.Sprintf("... and %d more object(s), listed in %s", summary.ObjectsTruncated, summary.FullSummary), styleDim))
+		}
+		t.b.WriteString("\n")
+	}
+
+	target := "s3://" + summary.Bucket + "/" + summary.ContextPath
+	if summary.SkippedByMarker != "" {
+		fmt.Fprintf(&t.b, "%s upload to %s, marker %s exists\n", t.style("Skipped", styleBold, styleYellow), t.style(target, styleCyan), summary.SkippedByMarker)
+		fmt.Fprintf(&t.b, "Run %s\n", summary.RunID)
+		return t.String()
+	}
+	uploaded, total := len(summary.ObjectsUploaded)+summary.ObjectsTruncated, total+summary.truncatedSize
+	fmt.Fprintf(&t.b, "%s %d object(s), %s, to %s\n", t.style("Uploaded", styleBold, styleGreen), uploaded, config.FormatByteSize(total), t.style(target, styleCyan))
+	if summary.DurationSeconds > 0 {
+		took := time.Duration(summary.DurationSeconds * float64(time.Second)).Round(100 * time.Millisecond)
+		fmt.Fprintf(&t.b, "Took %s at %s/s\n", took, config.FormatByteSize(summary.Throughput))
+	}
+	if summary.ObjectsRemoved > 0 {
+		fmt.Fprintf(&t.b, "%s %d object(s) before uploading\n", t.style("Removed", styleBold, styleYellow), summary.ObjectsRemoved)
+	}
+	if summary.SnapshotPath != "" {
+		fmt.Fprintf(&t.b, "Snapshot at %s\n", summary.SnapshotPath)
+	}
+	if summary.ObjectsSkipped > 0 || summary.ObjectsResumed > 0 {
+		fmt.Fprintf(&t.b, "Skipped %d unchanged, resumed %d from an earlier attempt\n", summary.ObjectsSkipped, summary.ObjectsResumed)
+	}
+	if summary.ObjectsVerified > 0 {
+		fmt.Fprintf(&t.b, "Verified %d object(s) visible\n", summary.ObjectsVerified)
+	}
+	for _, replica := range summary.Replicas {
+		if replica.Succeeded {
+			fmt.Fprintf(&t.b, "Replica %s: %s %d object(s)\n", replica.Target, t.style("uploaded", styleGreen), replica.ObjectsUploaded)
+		} else {
+			fmt.Fprintf(&t.b, "Replica %s: %s %s\n", replica.Target, t.style("failed", styleBold, styleRed), replica.Error)
+		}
+	}
+	if len(summary.LargeFiles) > 0 {
+		fmt.Fprintf(&t.b, "%s %d large file(s)\n", t.style("Flagged", styleYellow), len(summary.LargeFiles))
+	}
+	if len(summary.SecretFindings) > 0 {
+		fmt.Fprintf(&t.b, "%s %d potential secret(s)\n", t.style("Found", styleBold, styleRed), len(summary.SecretFindings))
+	}
+	if len(summary.Quarantined) > 0 {
+		fmt.Fprintf(&t.b, "%s %d infected file(s)\n", t.style("Quarantined", styleBold, styleRed), len(summary.Quarantined))
+	}
+	fmt.Fprintf(&t.b, "Run %s\n", summary.RunID)
+	return t.String()
+}
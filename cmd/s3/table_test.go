@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/delivery-station/ds/pkg/types"
+)
+
+func TestFormatUploadTable(t *testing.T) {
+	summary := uploadSummary{
+		Bucket:      "artifacts",
+		ContextPath: "releases/1.2",
+		RunID:       "run-7",
+		ObjectsUploaded: []uploader.UploadResult{
+			{Key: "releases/1.2/index.html", Size: 512, Source: "dist/index.html"},
+			{Key: "releases/1.2/app.js", Size: 2048, Source: "dist/app.js", Resumed: true},
+		},
+		ObjectsRemoved:  3,
+		ObjectsResumed:  1,
+		DurationSeconds: 1.04,
+		Throughput:      2560,
+		Replicas:        []replicaSummary{{Target: "mirror", Succeeded: true, ObjectsUploaded: 2}, {Target: "dr", Error: "access denied"}},
+	}
+	got := formatUploadTable(summary, false)
+	want := `STATUS    KEY                      SIZE  SOURCE
+uploaded  releases/1.2/index.html  512B  dist/index.html
+resumed   releases/1.2/app.js      2KiB  dist/app.js
+
+Uploaded 2 object(s), 2.5KiB, to s3://artifacts/releases/1.2
+Took 1s at 2.5KiB/s
+Removed 3 object(s) before uploading
+Skipped 0 unchanged, resumed 1 from an earlier attempt
+Replica mirror: uploaded 2 object(s)
+Replica dr: failed access denied
+Run run-7
+`
+	if got != want {
+		t.Errorf("unexpected table:\n%s\nwant:\n%s", got, want)
+	}
+	if strings.Contains(got, "\x1b[") {
+		t.Error("expected no escape sequences without color")
+	}
+
+	colored := formatUploadTable(summary, true)
+	if !strings.Contains(colored, styleGreen+"uploaded  ") || !strings.Contains(colored, styleDim+"resumed   ") {
+		t.Errorf("expected rows styled after padding, got %q", colored)
+	}
+
+	summary.SkippedByMarker = "releases/1.2/.done"
+	if got := formatUploadTable(summary, false); !strings.Contains(got, "Skipped upload to s3://artifacts/releases/1.2, marker releases/1.2/.done exists\nRun run-7\n") {
+		t.Errorf("unexpected table of a skipped upload:\n%s", got)
+	}
+}
+
+func TestOutputFormat(t *testing.T) {
+	for args, want := range map[string]string{"": "json", "format=TABLE": "table", "format=json": "json"} {
+		if got, err := outputFormat(types.NewPluginArgs([]string{args})); err != nil || got != want {
+			t.Errorf("outputFormat(%q) returned %q, %v", args, got, err)
+		}
+	}
+	if _, err := outputFormat(types.NewPluginArgs([]string{"format=yaml"})); err == nil {
+		t.Error("expected an unknown format to be rejected")
+	}
+
+	t.Setenv("NO_COLOR", "1")
+	if colorEnabled(types.NewPluginArgs([]string{"color=true"})) {
+		t.Error("expected NO_COLOR to turn color off")
+	}
+}
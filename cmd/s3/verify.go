@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+)
+
+// maxMissingListed bounds the keys a failed visibility check names.
+const maxMissingListed = 10
+
+// waitVisible waits for the uploaded objects, or a sample of them, to be
+// visible when verify.wait is set, and returns how many were checked. Dry
+// runs upload nothing to wait for.
+func (p *Plugin) waitVisible(ctx context.Context, transfer *uploader.Transport, cfg *config.Config, results []uploader.UploadResult) (int, error) {
+	if cfg.Verify.Wait <= 0 || cfg.DryRun || len(results) == 0 {
+		return 0, nil
+	}
+	objects := results
+	if cfg.Verify.Sample > 0 && cfg.Verify.Sample < len(results) {
+		objects = make([]uploader.UploadResult, 0, cfg.Verify.Sample)
+		for _, i := range rand.Perm(len(results))[:cfg.Verify.Sample] {
+			objects = append(objects, results[i])
+		}
+	}
+
+	started := time.Now()
+	missing, err := transfer.WaitVisible(ctx, objects, cfg.Verify.Interval, cfg.Verify.Wait)
+	if err != nil {
+		return 0, err
+	}
+	if len(missing) > 0 {
+		listed := missing
+		if len(listed) > maxMissingListed {
+			listed = listed[:maxMissingListed]
+		}
+		return 0, fmt.Errorf("%d of %d checked object(s) not visible after verify.wait %s: %s", len(missing), len(objects), cfg.Verify.Wait, strings.Join(listed, ", "))
+	}
+	p.logger.Info("Uploaded objects are visible", "checked", len(objects), "waited", time.Since(started).Round(time.Millisecond))
+	return len(objects), nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/delivery-station/ds-s3/internal/config"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+	"github.com/delivery-station/ds/pkg/types"
+)
+
+func (p *Plugin) handleListVersions(ctx context.Context, baseCfg *config.Config, args types.PluginArgs) (*types.ExecutionResult, error) {
+	if help, ok := args.BoolAny("help", "h"); ok && help {
+		return &types.ExecutionResult{Stdout: listVersionsUsage(), ExitCode: 0}, nil
+	}
+
+	merged := baseCfg.Clone()
+	applyTargetOverrides(merged, args)
+	if contextPath, ok := args.FirstAny("context", "context-path"); ok && strings.TrimSpace(contextPath) != "" {
+		merged.ContextPath = strings.Trim(strings.TrimSpace(contextPath), "/")
+	}
+
+	targetName, _ := args.First("target")
+	targetCfg, err := merged.ForTarget(targetName)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	if err := targetCfg.Validate(); err != nil {
+		return configFailure(ctx, err), nil
+	}
+	if targetCfg.IsDirectoryBucket() {
+		return &types.ExecutionResult{ExitCode: 1, Error: "directory buckets do not support versioning"}, nil
+	}
+	if targetCfg.IsGCS() {
+		return &types.ExecutionResult{ExitCode: 1, Error: "the gcs backend does not support S3 object versions"}, nil
+	}
+
+	client, err := p.newS3Client(ctx, targetCfg)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+	transfer, err := newTransport(client, targetCfg, nil)
+	if err != nil {
+		return configFailure(ctx, err), nil
+	}
+
+	versions, err := transfer.VersionHistory(ctx, targetCfg.ContextPath)
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: err.Error()}, nil
+	}
+
+	summary := listVersionsSummary{
+		Target:      targetName,
+		Bucket:      targetCfg.Bucket,
+		Region:      targetCfg.Region,
+		ContextPath: targetCfg.ContextPath,
+		Versions:    versions,
+	}
+	keys := make(map[string]struct{})
+	for _, v := range versions {
+		keys[v.Key] = struct{}{}
+		if v.DeleteMarker {
+			summary.DeleteMarkers++
+		} else {
+			summary.ObjectVersions++
+		}
+	}
+	summary.Keys = len(keys)
+
+	payload, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return &types.ExecutionResult{ExitCode: 1, Error: fmt.Sprintf("failed to encode execution summary: %v", err)}, nil
+	}
+
+	return &types.ExecutionResult{
+		Stdout:   string(payload) + "\n",
+		ExitCode: 0,
+	}, nil
+}
+
+func listVersionsUsage() string {
+	return `Usage: ds s3 list-versions [flags]
+
+Lists every object version and delete marker under the context path, grouped
+by key with the newest version first. Use it to check what rollback would
+restore on a versioned bucket.
+
+Flags:
+  --bucket <name>            Override target bucket (defaults to configuration)
+  --region <name>            Override AWS region
+  --context <prefix>         Object prefix/context path to inspect
+  --target <name>            Inspect a named target from configuration
+  --endpoint <url>           Use a custom S3-compatible endpoint
+  --force-path-style         Force path-style addressing
+  --skip-tls-verify          Disable TLS verification (requires --endpoint)
+  --profile <name>           Shared AWS profile to use
+  --mfa-token <code>         MFA code for credentials.mfa_serial (or $DS_S3_MFA_TOKEN)
+  --debug-aws-config         Log the resolved region, endpoint, addressing, retries, credential source and signer
+`
+}
+
+type listVersionsSummary struct {
+	Target         string                   `json:"target,omitempty"`
+	Bucket         string                   `json:"bucket"`
+	Region         string                   `json:"region,omitempty"`
+	ContextPath    string                   `json:"context_path,omitempty"`
+	Keys           int                      `json:"keys"`
+	ObjectVersions int                      `json:"object_versions"`
+	DeleteMarkers  int                      `json:"delete_markers"`
+	Versions       []uploader.ObjectVersion `json:"versions"`
+}
@@ -0,0 +1,349 @@
+// Package awsauth builds the credentials provider for S3 requests so that
+// transfers outliving temporary credentials keep going: credentials are
+// refreshed ahead of their expiry, and a request rejected because its
+// credentials expired anyway is retried with fresh ones.
+package awsauth
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/endpointcreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+)
+
+// ExpiryWindow is how long before their expiry cached credentials are
+// refreshed, so a request is not signed with credentials that expire while
+// it is being sent. A multipart part of a slow upload is the longest request
+// the plugin makes.
+const ExpiryWindow = 5 * time.Minute
+
+// DefaultRoleSessionName names the sessions of assumed roles unless the
+// configuration picks another name.
+const DefaultRoleSessionName = "ds-s3"
+
+// Sources of credentials selectable with Options.Source.
+const (
+	// SourceAuto uses the static keys when they are set and the SDK default
+	// chain otherwise.
+	SourceAuto = "auto"
+	// SourceStatic uses the static keys.
+	SourceStatic = "static"
+	// SourceProfile uses the credentials of the shared config profile.
+	SourceProfile = "profile"
+	// SourceIMDS uses the instance role from the EC2 instance metadata
+	// service, with IMDSv2 session tokens only.
+	SourceIMDS = "imds"
+	// SourceECS uses the task role from the ECS container credentials
+	// endpoint (also served by EKS Pod Identity).
+	SourceECS = "ecs"
+	// SourceWebIdentity assumes AWS_ROLE_ARN with the token in
+	// AWS_WEB_IDENTITY_TOKEN_FILE, as on EKS with IRSA.
+	SourceWebIdentity = "web_identity"
+)
+
+// Sources lists the values of Options.Source.
+var Sources = []string{SourceAuto, SourceStatic, SourceProfile, SourceIMDS, SourceECS, SourceWebIdentity}
+
+// ecsEndpoint is the host of relative ECS container credentials URIs.
+const ecsEndpoint = "http://169.254.170.2"
+
+// Options selects the credentials layered over the SDK default chain.
+type Options struct {
+	// Source pins where the credentials come from; empty means SourceAuto.
+	Source string
+	// Profile names the shared config profile the default chain was loaded
+	// with, if any, and Region the region configured outside of it; failures
+	// of the profile are explained with ExplainProfile.
+	Profile string
+	Region  string
+	// AccessKeyID, SecretAccessKey and SessionToken replace the default
+	// chain with static credentials when the key pair is set.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// RoleARN assumes this role with the static credentials, or with the
+	// default chain when there are none.
+	RoleARN         string
+	RoleSessionName string
+	ExternalID      string
+	// RoleDuration is the lifetime of the role sessions; zero leaves it to
+	// STS (one hour).
+	RoleDuration time.Duration
+	// MFASerial is the MFA device required by the trust policy of the role,
+	// and MFAToken supplies its current code for every role session.
+	MFASerial string
+	MFAToken  func() (string, error)
+}
+
+// stsClient is the part of the STS API the providers use.
+type stsClient interface {
+	stscreds.AssumeRoleAPIClient
+	stscreds.AssumeRoleWithWebIdentityAPIClient
+}
+
+// newSTSClient is replaced in tests.
+var newSTSClient = func(awsCfg aws.Config) stsClient {
+	return sts.NewFromConfig(awsCfg)
+}
+
+// CacheOptions configures credential caches to refresh ExpiryWindow before
+// expiry. Pass it to config.WithCredentialsCacheOptions so the default chain
+// refreshes like the providers of Provider.
+func CacheOptions(options *aws.CredentialsCacheOptions) {
+	options.ExpiryWindow = ExpiryWindow
+	options.ExpiryWindowJitterFrac = 0.2
+}
+
+// Provider returns the credentials provider for awsCfg, whose Credentials
+// hold the default chain. Every provider it creates is cached and refreshes
+// on its own, including roles assumed with static credentials, whose
+// sessions expire while the static keys do not.
+//
+// A Source other than SourceAuto is tried right away, so a source that is
+// unavailable fails here with an error naming it, rather than letting the
+// first request fail or the default chain fall through to another source.
+func Provider(ctx context.Context, awsCfg aws.Config, opts Options) (aws.CredentialsProvider, error) {
+	provider, err := sourceProvider(awsCfg, opts)
+	if err != nil {
+		err = fmt.Errorf("credentials.source %s: %w", opts.Source, err)
+		if opts.Source == SourceProfile {
+			return nil, ExplainProfile(ctx, opts.Profile, opts.Region, err)
+		}
+		return nil, err
+	}
+	auto := opts.Source == "" || opts.Source == SourceAuto
+	// Profiles are checked up front too, so that their failures can be
+	// explained before any work starts.
+	profile := opts.Profile != "" && (opts.Source == SourceProfile || auto && (opts.AccessKeyID == "" || opts.SecretAccessKey == ""))
+	if !auto || profile {
+		if _, err := provider.Retrieve(ctx); err != nil {
+			err = fmt.Errorf("no credentials available: %w", err)
+			if !auto {
+				err = fmt.Errorf("credentials.source %s: %w", opts.Source, err)
+			}
+			if profile {
+				return nil, ExplainProfile(ctx, opts.Profile, opts.Region, err)
+			}
+			return nil, err
+		}
+	}
+	if opts.RoleARN == "" {
+		return provider, nil
+	}
+
+	stsCfg := awsCfg.Copy()
+	stsCfg.Credentials = provider
+	role := aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(newSTSClient(stsCfg), opts.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = opts.RoleSessionName
+		if o.RoleSessionName == "" {
+			o.RoleSessionName = DefaultRoleSessionName
+		}
+		if opts.ExternalID != "" {
+			o.ExternalID = aws.String(opts.ExternalID)
+		}
+		if opts.RoleDuration > 0 {
+			o.Duration = opts.RoleDuration
+		}
+		if opts.MFASerial != "" {
+			o.SerialNumber = aws.String(opts.MFASerial)
+			o.TokenProvider = opts.MFAToken
+		}
+	}), CacheOptions)
+	if opts.MFASerial != "" {
+		// Ask for the code now rather than when the first request is sent,
+		// possibly in the middle of planning output.
+		if _, err := role.Retrieve(ctx); err != nil {
+			return nil, fmt.Errorf("credentials.role_arn %s with MFA: %w", opts.RoleARN, err)
+		}
+	}
+	return role, nil
+}
+
+// MFAToken returns the MFA code provider of a role session. Codes are valid
+// for a single session, so token, when given, is used for the first session
+// only; prompt supplies the codes after that, and all of them without token.
+func MFAToken(token string, prompt func() (string, error)) func() (string, error) {
+	var once sync.Once
+	return func() (string, error) {
+		given := ""
+		once.Do(func() { given = token })
+		if given != "" {
+			return given, nil
+		}
+		return prompt()
+	}
+}
+
+// PromptMFAToken asks for the MFA code of serial on the controlling terminal,
+// which is reachable even when the standard streams are not.
+func PromptMFAToken(serial string) func() (string, error) {
+	return func() (string, error) {
+		tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+		if err != nil {
+			return "", fmt.Errorf("no terminal to ask for the MFA code of %s: %w", serial, err)
+		}
+		defer func() { _ = tty.Close() }()
+		if _, err := fmt.Fprintf(tty, "MFA code for %s: ", serial); err != nil {
+			return "", err
+		}
+		line, err := bufio.NewReader(tty).ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("reading the MFA code: %w", err)
+		}
+		return strings.TrimSpace(line), nil
+	}
+}
+
+// sourceProvider returns the provider of the credentials source.
+func sourceProvider(awsCfg aws.Config, opts Options) (aws.CredentialsProvider, error) {
+	static := opts.AccessKeyID != "" && opts.SecretAccessKey != ""
+	switch opts.Source {
+	case "", SourceAuto, SourceStatic:
+		if !static {
+			if opts.Source == SourceStatic {
+				return nil, errors.New("no access key configured")
+			}
+			return awsCfg.Credentials, nil
+		}
+		return aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(
+			opts.AccessKeyID,
+			opts.SecretAccessKey,
+			opts.SessionToken,
+		)), nil
+	case SourceProfile:
+		// The default chain was loaded with the profile, which takes
+		// precedence over the environment, but falls back to the instance
+		// and container roles when the profile has no credentials.
+		if !slices.ContainsFunc(credentialSources(awsCfg.Credentials), isProfileSource) {
+			return nil, errors.New("the profile defines no credentials")
+		}
+		return awsCfg.Credentials, nil
+	case SourceIMDS:
+		client := imds.NewFromConfig(awsCfg, func(o *imds.Options) {
+			o.EnableFallback = aws.FalseTernary
+		})
+		return aws.NewCredentialsCache(ec2rolecreds.New(func(o *ec2rolecreds.Options) {
+			o.Client = client
+		}), CacheOptions), nil
+	case SourceECS:
+		endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+		if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+			endpoint = ecsEndpoint + relative
+		}
+		if endpoint == "" {
+			return nil, errors.New("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI and AWS_CONTAINER_CREDENTIALS_FULL_URI are not set")
+		}
+		return aws.NewCredentialsCache(endpointcreds.New(endpoint, func(o *endpointcreds.Options) {
+			o.APIOptions = awsCfg.APIOptions
+			if awsCfg.Retryer != nil {
+				o.Retryer = awsCfg.Retryer()
+			}
+			o.AuthorizationToken = os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+			if path := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); path != "" {
+				// The agent rotates the token file, so it is read for every
+				// refresh.
+				o.AuthorizationTokenProvider = endpointcreds.TokenProviderFunc(func() (string, error) {
+					token, err := os.ReadFile(path)
+					return string(token), err
+				})
+			}
+		}), CacheOptions), nil
+	case SourceWebIdentity:
+		roleARN, tokenFile := os.Getenv("AWS_ROLE_ARN"), os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+		if roleARN == "" || tokenFile == "" {
+			return nil, errors.New("AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE must be set")
+		}
+		stsCfg := awsCfg.Copy()
+		stsCfg.Credentials = nil
+		return aws.NewCredentialsCache(stscreds.NewWebIdentityRoleProvider(newSTSClient(stsCfg), roleARN, stscreds.IdentityTokenFile(tokenFile), func(o *stscreds.WebIdentityRoleOptions) {
+			o.RoleSessionName = os.Getenv("AWS_ROLE_SESSION_NAME")
+			if o.RoleSessionName == "" {
+				o.RoleSessionName = DefaultRoleSessionName
+			}
+		}), CacheOptions), nil
+	}
+	return nil, fmt.Errorf("unknown source (expected one of %v)", Sources)
+}
+
+// credentialSources reports the chain of sources behind a provider of the
+// SDK default chain.
+func credentialSources(provider aws.CredentialsProvider) []aws.CredentialSource {
+	if source, ok := provider.(aws.CredentialProviderSource); ok {
+		return source.ProviderSources()
+	}
+	return nil
+}
+
+func isProfileSource(source aws.CredentialSource) bool {
+	switch source {
+	case aws.CredentialSourceProfile,
+		aws.CredentialSourceProfileSourceProfile,
+		aws.CredentialSourceProfileNamedProvider,
+		aws.CredentialSourceProfileSTSWebIDToken,
+		aws.CredentialSourceProfileSSO,
+		aws.CredentialSourceProfileSSOLegacy,
+		aws.CredentialSourceProfileProcess,
+		aws.CredentialSourceProfileLogin:
+		return true
+	}
+	return false
+}
+
+// expiredCodes are the error codes of requests signed with expired
+// credentials.
+var expiredCodes = map[string]struct{}{
+	"ExpiredToken":          {},
+	"ExpiredTokenException": {},
+	"TokenRefreshRequired":  {},
+}
+
+// IsExpired reports whether err rejects a request because its credentials
+// expired.
+func IsExpired(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	_, ok := expiredCodes[apiErr.ErrorCode()]
+	return ok
+}
+
+// invalidator is implemented by aws.CredentialsCache.
+type invalidator interface {
+	Invalidate()
+}
+
+// ExpiredRetryable implements retry.IsErrorRetryable. It makes requests
+// rejected for expired credentials retryable and drops the cached
+// credentials, so the retry is signed with fresh ones. That covers
+// credentials revoked or expired early, and clocks too far apart for
+// ExpiryWindow.
+type ExpiredRetryable struct {
+	Credentials aws.CredentialsProvider
+}
+
+// IsErrorRetryable returns aws.TrueTernary for expired credentials and
+// aws.UnknownTernary for everything else.
+func (r ExpiredRetryable) IsErrorRetryable(err error) aws.Ternary {
+	if !IsExpired(err) {
+		return aws.UnknownTernary
+	}
+	if cache, ok := r.Credentials.(invalidator); ok {
+		cache.Invalidate()
+	}
+	return aws.TrueTernary
+}
@@ -0,0 +1,355 @@
+package awsauth
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// sessionProvider hands out a new session token on every retrieval, valid
+// for lifetime.
+type sessionProvider struct {
+	lifetime time.Duration
+
+	mu        sync.Mutex
+	retrieved int
+}
+
+func (p *sessionProvider) Retrieve(context.Context) (aws.Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.retrieved++
+	return aws.Credentials{
+		AccessKeyID:     "AKIDSESSION",
+		SecretAccessKey: "secret",
+		SessionToken:    fmt.Sprintf("token-%d", p.retrieved),
+		CanExpire:       true,
+		Expires:         time.Now().Add(p.lifetime),
+	}, nil
+}
+
+func (p *sessionProvider) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.retrieved
+}
+
+// expiringS3 answers the requests of a multipart upload and rejects requests
+// signed with a session token once the token has been used for validFor
+// requests, as S3 does when the session behind a token ends mid-transfer.
+type expiringS3 struct {
+	validFor int
+
+	mu       sync.Mutex
+	uses     map[string]int
+	rejected int
+	parts    int
+}
+
+func (s *expiringS3) Do(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_, _ = io.Copy(io.Discard, req.Body)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token := req.Header.Get("X-Amz-Security-Token")
+	s.uses[token]++
+	if s.uses[token] > s.validFor {
+		s.rejected++
+		return response(req, http.StatusBadRequest, `<Error><Code>ExpiredToken</Code><Message>The provided token has expired.</Message></Error>`), nil
+	}
+
+	query := req.URL.Query()
+	switch {
+	case query.Has("uploads"):
+		return response(req, http.StatusOK, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>app.tar</Key><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`), nil
+	case query.Has("partNumber"):
+		s.parts++
+		resp := response(req, http.StatusOK, "")
+		resp.Header.Set("ETag", fmt.Sprintf(`"part-%s"`, query.Get("partNumber")))
+		return resp, nil
+	case query.Has("uploadId"):
+		return response(req, http.StatusOK, `<CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>app.tar</Key><ETag>"done-3"</ETag></CompleteMultipartUploadResult>`), nil
+	}
+	return response(req, http.StatusNotImplemented, `<Error><Code>NotImplemented</Code></Error>`), nil
+}
+
+func response(req *http.Request, status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode:    status,
+		Header:        http.Header{"Content-Type": []string{"application/xml"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+func TestUploadSurvivesExpiredCredentials(t *testing.T) {
+	// The session outlives the cache's expiry window, so only the server
+	// notices that it ended: after two requests, in the middle of the parts.
+	provider := &sessionProvider{lifetime: time.Hour}
+	credentials, err := Provider(context.Background(), aws.Config{Credentials: aws.NewCredentialsCache(provider, CacheOptions)}, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	server := &expiringS3{validFor: 2, uses: make(map[string]int)}
+
+	client := s3.New(s3.Options{
+		Region:      "us-east-1",
+		Credentials: credentials,
+		HTTPClient:  server,
+		Retryer: retry.NewStandard(func(o *retry.StandardOptions) {
+			o.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+			o.Retryables = append(append([]retry.IsErrorRetryable{}, o.Retryables...), ExpiredRetryable{Credentials: credentials})
+		}),
+	})
+	uploader := manager.NewUploader(client, func(u *manager.Uploader) {
+		u.PartSize = manager.MinUploadPartSize
+		u.Concurrency = 1
+	})
+
+	body := bytes.Repeat([]byte("x"), int(3*manager.MinUploadPartSize))
+	if _, err := uploader.Upload(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("app.tar"),
+		Body:   bytes.NewReader(body),
+	}); err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+
+	if server.parts != 3 {
+		t.Errorf("expected 3 uploaded parts, got %d", server.parts)
+	}
+	if server.rejected == 0 {
+		t.Fatal("expected the server to reject expired credentials")
+	}
+	if got := provider.count(); got != server.rejected+1 {
+		t.Errorf("expected fresh credentials for each of the %d rejected requests, got %d retrievals", server.rejected, got)
+	}
+}
+
+func TestCredentialsRefreshBeforeExpiry(t *testing.T) {
+	provider := &sessionProvider{lifetime: ExpiryWindow / 2}
+	cache := aws.NewCredentialsCache(provider, CacheOptions)
+
+	first, err := cache.Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := cache.Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first.SessionToken == second.SessionToken || provider.count() != 2 {
+		t.Errorf("expected credentials inside the expiry window to be refreshed, got %q then %q", first.SessionToken, second.SessionToken)
+	}
+}
+
+// stubSTS issues role sessions valid for lifetime and records the requests.
+type stubSTS struct {
+	lifetime      time.Duration
+	inputs        []*sts.AssumeRoleInput
+	webIdentities []*sts.AssumeRoleWithWebIdentityInput
+}
+
+func (s *stubSTS) AssumeRoleWithWebIdentity(_ context.Context, input *sts.AssumeRoleWithWebIdentityInput, _ ...func(*sts.Options)) (*sts.AssumeRoleWithWebIdentityOutput, error) {
+	s.webIdentities = append(s.webIdentities, input)
+	return &sts.AssumeRoleWithWebIdentityOutput{Credentials: &ststypes.Credentials{
+		AccessKeyId:     aws.String("AKIDWEB"),
+		SecretAccessKey: aws.String("web-secret"),
+		SessionToken:    aws.String("web-token"),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	}}, nil
+}
+
+func (s *stubSTS) AssumeRole(_ context.Context, input *sts.AssumeRoleInput, _ ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+	s.inputs = append(s.inputs, input)
+	return &sts.AssumeRoleOutput{Credentials: &ststypes.Credentials{
+		AccessKeyId:     aws.String("AKIDROLE"),
+		SecretAccessKey: aws.String("role-secret"),
+		SessionToken:    aws.String(fmt.Sprintf("role-token-%d", len(s.inputs))),
+		Expiration:      aws.Time(time.Now().Add(s.lifetime)),
+	}}, nil
+}
+
+func TestAssumeRoleWithStaticCredentials(t *testing.T) {
+	stub := &stubSTS{lifetime: ExpiryWindow / 2}
+	var signedWith aws.Credentials
+	restore := newSTSClient
+	newSTSClient = func(awsCfg aws.Config) stsClient {
+		creds, err := awsCfg.Credentials.Retrieve(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		signedWith = creds
+		return stub
+	}
+	t.Cleanup(func() { newSTSClient = restore })
+
+	provider, err := Provider(context.Background(), aws.Config{Region: "us-east-1"}, Options{
+		AccessKeyID:     "AKIDSTATIC",
+		SecretAccessKey: "static-secret",
+		RoleARN:         "arn:aws:iam::123456789012:role/publisher",
+		ExternalID:      "ci",
+		RoleDuration:    2 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if signedWith.AccessKeyID != "AKIDSTATIC" {
+		t.Fatalf("expected STS to be called with the static credentials, got %q", signedWith.AccessKeyID)
+	}
+
+	// Each role session is already inside the expiry window, so every
+	// retrieval renews it although the static keys never expire.
+	for i := 1; i <= 2; i++ {
+		creds, err := provider.Retrieve(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := fmt.Sprintf("role-token-%d", i); creds.SessionToken != want {
+			t.Errorf("expected session %s, got %s", want, creds.SessionToken)
+		}
+	}
+
+	input := stub.inputs[0]
+	if aws.ToString(input.RoleSessionName) != DefaultRoleSessionName || aws.ToString(input.ExternalId) != "ci" || aws.ToInt32(input.DurationSeconds) != 7200 {
+		t.Errorf("unexpected AssumeRole request %+v", input)
+	}
+}
+
+func TestAssumeRoleWithMFA(t *testing.T) {
+	stub := &stubSTS{lifetime: ExpiryWindow / 2}
+	restore := newSTSClient
+	newSTSClient = func(aws.Config) stsClient { return stub }
+	t.Cleanup(func() { newSTSClient = restore })
+
+	prompted := 0
+	provider, err := Provider(context.Background(), aws.Config{Region: "us-east-1"}, Options{
+		AccessKeyID:     "AKIDSTATIC",
+		SecretAccessKey: "static-secret",
+		RoleARN:         "arn:aws:iam::123456789012:role/publisher",
+		MFASerial:       "arn:aws:iam::123456789012:mfa/operator",
+		MFAToken: MFAToken("123456", func() (string, error) {
+			prompted++
+			return "654321", nil
+		}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The role was assumed up front with the given code; the renewed session
+	// needs a new one.
+	if _, err := provider.Retrieve(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(stub.inputs) != 2 {
+		t.Fatalf("expected two role sessions, got %d", len(stub.inputs))
+	}
+	for i, want := range []string{"123456", "654321"} {
+		input := stub.inputs[i]
+		if aws.ToString(input.SerialNumber) != "arn:aws:iam::123456789012:mfa/operator" || aws.ToString(input.TokenCode) != want {
+			t.Errorf("session %d: expected code %s, got %+v", i+1, want, input)
+		}
+	}
+	if prompted != 1 {
+		t.Errorf("expected one prompt, got %d", prompted)
+	}
+}
+
+// profileChain stands in for a default chain whose sources are known.
+type profileChain struct {
+	sessionProvider
+	sources []aws.CredentialSource
+}
+
+func (p *profileChain) ProviderSources() []aws.CredentialSource {
+	return p.sources
+}
+
+func TestCredentialSources(t *testing.T) {
+	stub := &stubSTS{}
+	restore := newSTSClient
+	newSTSClient = func(aws.Config) stsClient { return stub }
+	t.Cleanup(func() { newSTSClient = restore })
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(home, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(home, "credentials"))
+	for _, name := range []string{"AWS_CONTAINER_CREDENTIALS_FULL_URI", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_ROLE_ARN", "AWS_WEB_IDENTITY_TOKEN_FILE"} {
+		t.Setenv(name, "")
+	}
+	ctx := context.Background()
+	chain := &profileChain{sessionProvider: sessionProvider{lifetime: time.Hour}, sources: []aws.CredentialSource{aws.CredentialSourceIMDS}}
+	awsCfg := aws.Config{Region: "us-east-1", Credentials: chain}
+
+	// Unavailable sources fail up front instead of falling through.
+	for _, opts := range []Options{
+		{Source: SourceStatic},
+		{Source: SourceProfile, Profile: "ci"},
+		{Source: SourceECS},
+		{Source: SourceWebIdentity},
+	} {
+		if _, err := Provider(ctx, awsCfg, opts); err == nil || !strings.Contains(err.Error(), "credentials.source "+opts.Source) {
+			t.Errorf("%s: expected an error naming the source, got %v", opts.Source, err)
+		}
+	}
+
+	chain.sources = []aws.CredentialSource{aws.CredentialSourceProfileSSO}
+	if _, err := Provider(ctx, awsCfg, Options{Source: SourceProfile, Profile: "ci"}); err != nil {
+		t.Errorf("profile: unexpected error: %v", err)
+	}
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("jwt"), 0o600); err != nil {
+		t.Fatalf("failed to write token: %v", err)
+	}
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/irsa")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+	provider, err := Provider(ctx, awsCfg, Options{Source: SourceWebIdentity, AccessKeyID: "ignored"})
+	if err != nil {
+		t.Fatalf("web_identity: unexpected error: %v", err)
+	}
+	if creds, _ := provider.Retrieve(ctx); creds.AccessKeyID != "AKIDWEB" {
+		t.Errorf("web_identity: expected the web identity session, got %q", creds.AccessKeyID)
+	}
+	if input := stub.webIdentities[0]; aws.ToString(input.RoleArn) != "arn:aws:iam::123456789012:role/irsa" || aws.ToString(input.WebIdentityToken) != "jwt" {
+		t.Errorf("web_identity: unexpected request %+v", input)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "task-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `{"AccessKeyId":"AKIDTASK","SecretAccessKey":"task-secret","Token":"task-token","Expiration":%q}`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", server.URL)
+	t.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN", "task-token")
+	provider, err = Provider(ctx, awsCfg, Options{Source: SourceECS})
+	if err != nil {
+		t.Fatalf("ecs: unexpected error: %v", err)
+	}
+	if creds, _ := provider.Retrieve(ctx); creds.AccessKeyID != "AKIDTASK" {
+		t.Errorf("ecs: expected the task role, got %q", creds.AccessKeyID)
+	}
+}
@@ -0,0 +1,158 @@
+package awsauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+)
+
+// ProfileError explains why the credentials of a shared config profile could
+// not be resolved. Problems name the files and keys to fix; Err is the error
+// the SDK reported.
+type ProfileError struct {
+	Profile  string
+	Problems []string
+	Err      error
+}
+
+func (e *ProfileError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "profile %q: %v", e.Profile, e.Err)
+	for _, problem := range e.Problems {
+		b.WriteString("\n  - ")
+		b.WriteString(problem)
+	}
+	return b.String()
+}
+
+func (e *ProfileError) Unwrap() error {
+	return e.Err
+}
+
+// sharedFiles returns the shared config and credentials files the SDK reads,
+// honouring AWS_CONFIG_FILE and AWS_SHARED_CREDENTIALS_FILE.
+func sharedFiles() (configFile, credentialsFile string) {
+	configFile = os.Getenv("AWS_CONFIG_FILE")
+	if configFile == "" {
+		configFile = awsconfig.DefaultSharedConfigFilename()
+	}
+	credentialsFile = os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if credentialsFile == "" {
+		credentialsFile = awsconfig.DefaultSharedCredentialsFilename()
+	}
+	return configFile, credentialsFile
+}
+
+// ExplainProfile wraps err, a failure to load or use the credentials of
+// profile, in a ProfileError listing what is wrong with the profile chain:
+// undefined profiles and source profiles, roles without a source, SSO
+// settings that are incomplete or logins that expired, and a missing region.
+// region is the region configured outside the profile, if any.
+func ExplainProfile(ctx context.Context, profile, region string, err error) error {
+	configFile, credentialsFile := sharedFiles()
+	explained := &ProfileError{Profile: profile, Err: err}
+	shared, loadErr := awsconfig.LoadSharedConfigProfile(ctx, profile, func(o *awsconfig.LoadSharedConfigOptions) {
+		o.ConfigFiles = []string{configFile}
+		o.CredentialsFiles = []string{credentialsFile}
+	})
+
+	var notExist awsconfig.SharedConfigProfileNotExistError
+	var assumeRole awsconfig.SharedConfigAssumeRoleError
+	switch {
+	case errors.As(loadErr, &assumeRole):
+		explained.Problems = append(explained.Problems, fmt.Sprintf(
+			"source_profile %q of the profile chain is not defined as [profile %s] in %s or [%s] in %s",
+			assumeRole.Profile, assumeRole.Profile, configFile, assumeRole.Profile, credentialsFile))
+		return explained
+	case errors.As(loadErr, &notExist):
+		explained.Problems = append(explained.Problems, fmt.Sprintf(
+			"profile %q is not defined as [profile %s] in %s or [%s] in %s",
+			profile, profile, configFile, profile, credentialsFile))
+		return explained
+	case loadErr != nil:
+		explained.Problems = append(explained.Problems, loadErr.Error())
+		return explained
+	}
+
+	for link := &shared; link != nil; link = link.Source {
+		explained.Problems = append(explained.Problems, profileProblems(link, configFile, credentialsFile)...)
+	}
+	if shared.Region == "" && region == "" && os.Getenv("AWS_REGION") == "" && os.Getenv("AWS_DEFAULT_REGION") == "" {
+		explained.Problems = append(explained.Problems, fmt.Sprintf(
+			"profile %q sets no region in %s, and neither the region setting nor AWS_REGION is set", profile, configFile))
+	}
+	return explained
+}
+
+// profileProblems checks one profile of a chain.
+func profileProblems(shared *awsconfig.SharedConfig, configFile, credentialsFile string) []string {
+	var problems []string
+	name := shared.Profile
+	if shared.RoleARN != "" && shared.SourceProfileName == "" && shared.CredentialSource == "" && shared.WebIdentityTokenFile == "" {
+		problems = append(problems, fmt.Sprintf(
+			"profile %q sets role_arn in %s but neither source_profile nor credential_source", name, configFile))
+	}
+
+	startURL, ssoRegion, cacheKey := shared.SSOStartURL, shared.SSORegion, shared.SSOStartURL
+	if shared.SSOSession != nil {
+		startURL, ssoRegion, cacheKey = shared.SSOSession.SSOStartURL, shared.SSOSession.SSORegion, shared.SSOSession.Name
+	}
+	sso := startURL != "" || shared.SSOSessionName != "" || shared.SSOAccountID != "" || shared.SSORoleName != ""
+	if sso {
+		for _, setting := range [][2]string{
+			{"sso_start_url", startURL},
+			{"sso_region", ssoRegion},
+			{"sso_account_id", shared.SSOAccountID},
+			{"sso_role_name", shared.SSORoleName},
+		} {
+			if setting[1] == "" {
+				problems = append(problems, fmt.Sprintf("profile %q uses SSO but sets no %s in %s", name, setting[0], configFile))
+			}
+		}
+		if cacheKey != "" {
+			if problem := ssoLoginProblem(name, cacheKey); problem != "" {
+				problems = append(problems, problem)
+			}
+		}
+	}
+
+	if shared.Source == nil && shared.CredentialSource == "" && !shared.Credentials.HasKeys() &&
+		shared.CredentialProcess == "" && shared.WebIdentityTokenFile == "" && !sso {
+		problems = append(problems, fmt.Sprintf(
+			"profile %q defines no credentials: set aws_access_key_id and aws_secret_access_key in %s, or sso_session, credential_process or role_arn with source_profile in %s",
+			name, credentialsFile, configFile))
+	}
+	return problems
+}
+
+// ssoLoginProblem reports a missing or expired login of the SSO session
+// cached under key by `aws sso login`.
+func ssoLoginProblem(profile, key string) string {
+	path, err := ssocreds.StandardCachedTokenFilepath(key)
+	if err != nil {
+		return err.Error()
+	}
+	login := fmt.Sprintf("run `aws sso login --profile %s`", profile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Sprintf("profile %q has no cached SSO login in %s; %s", profile, path, login)
+	}
+	var token struct {
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+	if err := json.Unmarshal(data, &token); err != nil {
+		return fmt.Sprintf("the cached SSO login of profile %q in %s is unreadable (%v); %s", profile, path, err, login)
+	}
+	if !token.ExpiresAt.After(time.Now()) {
+		return fmt.Sprintf("the SSO login of profile %q expired at %s (%s); %s",
+			profile, token.ExpiresAt.Format(time.RFC3339), path, login)
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+package awsauth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+)
+
+func TestExplainProfile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	configFile := filepath.Join(home, "config")
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(home, "credentials"))
+	config := `[profile deploy]
+role_arn = arn:aws:iam::123456789012:role/publisher
+source_profile = missing
+
+[profile orphan-role]
+role_arn = arn:aws:iam::123456789012:role/publisher
+region = eu-west-1
+
+[profile sso]
+sso_session = corp
+sso_account_id = 123456789012
+sso_role_name = Publisher
+region = eu-west-1
+
+[sso-session corp]
+sso_start_url = https://corp.awsapps.com/start
+`
+	if err := os.WriteFile(configFile, []byte(config), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	cache, err := ssocreds.StandardCachedTokenFilepath("corp")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(cache), 0o700); err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	expired := `{"accessToken":"token","expiresAt":"` + time.Now().Add(-time.Hour).UTC().Format(time.RFC3339) + `"}`
+	if err := os.WriteFile(cache, []byte(expired), 0o600); err != nil {
+		t.Fatalf("failed to write cached token: %v", err)
+	}
+
+	failure := errors.New("failed to retrieve credentials")
+	for profile, want := range map[string][]string{
+		"absent":      {`profile "absent" is not defined as [profile absent] in ` + configFile},
+		"deploy":      {`source_profile "missing" of the profile chain is not defined`},
+		"orphan-role": {`profile "orphan-role" sets role_arn in ` + configFile + ` but neither source_profile nor credential_source`},
+		"sso": {
+			`profile "sso" uses SSO but sets no sso_region in ` + configFile,
+			`the SSO login of profile "sso" expired at`,
+			"run `aws sso login --profile sso`",
+		},
+	} {
+		err := ExplainProfile(context.Background(), profile, "", failure)
+		var explained *ProfileError
+		if !errors.As(err, &explained) || !errors.Is(err, failure) {
+			t.Fatalf("%s: expected a ProfileError wrapping the failure, got %v", profile, err)
+		}
+		for _, fragment := range want {
+			if !strings.Contains(err.Error(), fragment) {
+				t.Errorf("%s: expected %q in\n%v", profile, fragment, err)
+			}
+		}
+	}
+
+	if err := ExplainProfile(context.Background(), "orphan-role", "", failure); strings.Contains(err.Error(), "sets no region") {
+		t.Errorf("expected the profile region to count, got\n%v", err)
+	}
+	if err := ExplainProfile(context.Background(), "deploy", "", failure); strings.Contains(err.Error(), "sets no region") {
+		t.Errorf("expected no region check for an unresolved chain, got\n%v", err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(home, "empty"))
+	if err := os.WriteFile(filepath.Join(home, "empty"), []byte("[profile bare]\n"), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	err = ExplainProfile(context.Background(), "bare", "", failure)
+	for _, fragment := range []string{`profile "bare" defines no credentials`, `profile "bare" sets no region`} {
+		if !strings.Contains(err.Error(), fragment) {
+			t.Errorf("bare: expected %q in\n%v", fragment, err)
+		}
+	}
+	if err := ExplainProfile(context.Background(), "bare", "eu-west-1", failure); strings.Contains(err.Error(), "sets no region") {
+		t.Errorf("expected the region setting to count, got\n%v", err)
+	}
+}
@@ -0,0 +1,120 @@
+// Package backoff provides an SDK retry delayer that follows the server's
+// guidance on throttling instead of relying on exponential backoff alone.
+package backoff
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// MaxRetryAfter caps the delay requested through Retry-After so a
+// misbehaving gateway cannot stall an upload indefinitely.
+const MaxRetryAfter = 2 * time.Minute
+
+// slowDownBase is the minimum delay after the first SlowDown response; it
+// doubles with every further attempt up to the maximum backoff.
+const slowDownBase = 500 * time.Millisecond
+
+// Delayer implements retry.BackoffDelayer. A Retry-After header on the failed
+// response is honoured exactly (up to MaxRetryAfter). Throttling responses
+// without one back off exponentially from a floor rather than from zero, as
+// S3 asks clients to do on SlowDown. Everything else uses the SDK's
+// exponential jitter backoff.
+type Delayer struct {
+	jitter     retry.BackoffDelayer
+	maxBackoff time.Duration
+	now        func() time.Time
+}
+
+// New returns a Delayer whose computed delays never exceed maxBackoff.
+func New(maxBackoff time.Duration) *Delayer {
+	return &Delayer{
+		jitter:     retry.NewExponentialJitterBackoff(maxBackoff),
+		maxBackoff: maxBackoff,
+		now:        time.Now,
+	}
+}
+
+// BackoffDelay returns how long to wait before the given retry attempt.
+func (d *Delayer) BackoffDelay(attempt int, err error) (time.Duration, error) {
+	if delay, ok := d.retryAfter(err); ok {
+		return delay, nil
+	}
+
+	delay, jitterErr := d.jitter.BackoffDelay(attempt, err)
+	if jitterErr != nil {
+		return 0, jitterErr
+	}
+	if IsThrottle(err) {
+		if floor := d.throttleFloor(attempt); delay < floor {
+			delay = floor
+		}
+	}
+	return delay, nil
+}
+
+func (d *Delayer) throttleFloor(attempt int) time.Duration {
+	floor := slowDownBase
+	for i := 1; i < attempt && floor < d.maxBackoff; i++ {
+		floor *= 2
+	}
+	if floor > d.maxBackoff {
+		floor = d.maxBackoff
+	}
+	return floor
+}
+
+// retryAfter reads the Retry-After header of the failed response, given in
+// seconds or as an HTTP date.
+func (d *Delayer) retryAfter(err error) (time.Duration, bool) {
+	var withResponse interface{ HTTPResponse() *smithyhttp.Response }
+	if !errors.As(err, &withResponse) {
+		return 0, false
+	}
+	response := withResponse.HTTPResponse()
+	if response == nil || response.Response == nil {
+		return 0, false
+	}
+
+	value := strings.TrimSpace(response.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		delay = at.Sub(d.now())
+	} else {
+		return 0, false
+	}
+
+	if delay < 0 {
+		delay = 0
+	}
+	if delay > MaxRetryAfter {
+		delay = MaxRetryAfter
+	}
+	return delay, true
+}
+
+// IsThrottle reports whether err is a throttling response such as S3's
+// SlowDown or an HTTP 429.
+func IsThrottle(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		if _, ok := retry.DefaultThrottleErrorCodes[apiErr.ErrorCode()]; ok {
+			return true
+		}
+	}
+	var withStatus interface{ HTTPStatusCode() int }
+	return errors.As(err, &withStatus) && withStatus.HTTPStatusCode() == http.StatusTooManyRequests
+}
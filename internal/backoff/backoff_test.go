@@ -0,0 +1,76 @@
+package backoff
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+func responseError(status int, code, retryAfter string) error {
+	header := http.Header{}
+	if retryAfter != "" {
+		header.Set("Retry-After", retryAfter)
+	}
+	return &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status, Header: header}},
+		Err:      &smithy.GenericAPIError{Code: code},
+	}
+}
+
+func TestBackoffHonoursRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	delayer := New(20 * time.Second)
+	delayer.now = func() time.Time { return now }
+
+	cases := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "seconds", value: "3", want: 3 * time.Second},
+		{name: "http date", value: now.Add(7 * time.Second).Format(http.TimeFormat), want: 7 * time.Second},
+		{name: "past date", value: now.Add(-time.Minute).Format(http.TimeFormat), want: 0},
+		{name: "capped", value: "3600", want: MaxRetryAfter},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			delay, err := delayer.BackoffDelay(1, responseError(503, "SlowDown", tc.value))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if delay != tc.want {
+				t.Fatalf("expected %s, got %s", tc.want, delay)
+			}
+		})
+	}
+}
+
+func TestBackoffSlowDownFloor(t *testing.T) {
+	delayer := New(4 * time.Second)
+
+	for attempt, floor := range map[int]time.Duration{1: 500 * time.Millisecond, 3: 2 * time.Second, 6: 4 * time.Second} {
+		delay, err := delayer.BackoffDelay(attempt, responseError(503, "SlowDown", ""))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if delay < floor || delay > 4*time.Second {
+			t.Fatalf("attempt %d: expected a delay between %s and 4s, got %s", attempt, floor, delay)
+		}
+	}
+}
+
+func TestIsThrottle(t *testing.T) {
+	if !IsThrottle(responseError(503, "SlowDown", "")) {
+		t.Error("expected SlowDown to be a throttle")
+	}
+	if !IsThrottle(responseError(429, "", "")) {
+		t.Error("expected HTTP 429 to be a throttle")
+	}
+	if IsThrottle(responseError(500, "InternalError", "")) || IsThrottle(errors.New("boom")) {
+		t.Error("expected other errors not to be throttles")
+	}
+}
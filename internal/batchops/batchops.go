@@ -0,0 +1,250 @@
+// Package batchops submits S3 Batch Operations jobs and follows them to
+// completion, for copies and deletes too large to loop over the S3 API.
+package batchops
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3ctypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+)
+
+// MaxCopySize is the largest object a Batch Operations copy handles; it
+// copies with CopyObject, which refuses larger sources.
+const MaxCopySize int64 = 5 << 30
+
+// Client is the subset of the S3 Control API used to run jobs.
+type Client interface {
+	CreateJob(ctx context.Context, params *s3control.CreateJobInput, optFns ...func(*s3control.Options)) (*s3control.CreateJobOutput, error)
+	DescribeJob(ctx context.Context, params *s3control.DescribeJobInput, optFns ...func(*s3control.Options)) (*s3control.DescribeJobOutput, error)
+}
+
+// Manifest returns the CSV manifest listing keys of bucket, one bucket,key
+// line per object with the key URL-encoded, as Batch Operations expects.
+func Manifest(bucket string, keys []string) []byte {
+	var buf bytes.Buffer
+	for _, key := range keys {
+		buf.WriteString(bucket)
+		buf.WriteByte(',')
+		buf.WriteString(escapeKey(key))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// escapeKey percent-encodes every byte of key but unreserved characters and
+// the slashes separating its segments.
+func escapeKey(key string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+	}
+	return b.String()
+}
+
+// Job describes a job to submit.
+type Job struct {
+	// AccountID owns the job; see AccountID.
+	AccountID string
+	// RoleARN is the role Batch Operations assumes to read the manifest,
+	// run the operation and write the report.
+	RoleARN  string
+	Priority int32
+	// Token makes submitting idempotent: a retried submission with the
+	// same token returns the job created first. Tokens longer than S3
+	// accepts are hashed.
+	Token       string
+	Description string
+	Operation   s3ctypes.JobOperation
+	// ManifestBucket, ManifestKey and ManifestETag locate the manifest
+	// written with Manifest.
+	ManifestBucket string
+	ManifestKey    string
+	ManifestETag   string
+	// ReportBucket and ReportPrefix locate the completion report, which
+	// lists the objects the operation failed on.
+	ReportBucket string
+	ReportPrefix string
+}
+
+// AccountID returns account when set, else the account of the role ARN.
+func AccountID(account, roleARN string) (string, error) {
+	if account = strings.TrimSpace(account); account != "" {
+		return account, nil
+	}
+	parsed, err := arn.Parse(roleARN)
+	if err != nil || parsed.AccountID == "" {
+		return "", fmt.Errorf("cannot tell the account from role ARN %q; set batch.account_id", roleARN)
+	}
+	return parsed.AccountID, nil
+}
+
+// BucketARN returns the ARN of bucket in the partition of the role ARN.
+func BucketARN(bucket, roleARN string) string {
+	partition := "aws"
+	if parsed, err := arn.Parse(roleARN); err == nil && parsed.Partition != "" {
+		partition = parsed.Partition
+	}
+	return fmt.Sprintf("arn:%s:s3:::%s", partition, bucket)
+}
+
+// CopyOperation copies every object to the bucket with the ARN target, at its
+// key with prefix prepended.
+func CopyOperation(target, prefix string) s3ctypes.JobOperation {
+	operation := &s3ctypes.S3CopyObjectOperation{TargetResource: aws.String(target)}
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		operation.TargetKeyPrefix = aws.String(prefix + "/")
+	}
+	return s3ctypes.JobOperation{S3PutObjectCopy: operation}
+}
+
+// DeleteOperation invokes the Lambda function with the ARN function on every
+// object. Batch Operations has no delete of its own, so the function deletes
+// the object it is invoked for.
+func DeleteOperation(function string) s3ctypes.JobOperation {
+	return s3ctypes.JobOperation{LambdaInvoke: &s3ctypes.LambdaInvokeOperation{FunctionArn: aws.String(function)}}
+}
+
+// Submit creates job, ready to run without confirmation, and returns its id.
+func Submit(ctx context.Context, client Client, job Job) (string, error) {
+	input := &s3control.CreateJobInput{
+		AccountId:            aws.String(job.AccountID),
+		RoleArn:              aws.String(job.RoleARN),
+		Priority:             aws.Int32(job.Priority),
+		ClientRequestToken:   aws.String(requestToken(job.Token)),
+		ConfirmationRequired: aws.Bool(false),
+		Operation:            &job.Operation,
+		Manifest: &s3ctypes.JobManifest{
+			Spec: &s3ctypes.JobManifestSpec{
+				Format: s3ctypes.JobManifestFormatS3BatchOperationsCsv20180820,
+				Fields: []s3ctypes.JobManifestFieldName{s3ctypes.JobManifestFieldNameBucket, s3ctypes.JobManifestFieldNameKey},
+			},
+			Location: &s3ctypes.JobManifestLocation{
+				ObjectArn: aws.String(BucketARN(job.ManifestBucket, job.RoleARN) + "/" + job.ManifestKey),
+				ETag:      aws.String(job.ManifestETag),
+			},
+		},
+		Report: &s3ctypes.JobReport{
+			Enabled:     true,
+			Bucket:      aws.String(BucketARN(job.ReportBucket, job.RoleARN)),
+			Prefix:      aws.String(job.ReportPrefix),
+			Format:      s3ctypes.JobReportFormatReportCsv20180820,
+			ReportScope: s3ctypes.JobReportScopeFailedTasksOnly,
+		},
+	}
+	if job.Description != "" {
+		input.Description = aws.String(job.Description)
+	}
+	response, err := client.CreateJob(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("failed to create batch job: %w", err)
+	}
+	return aws.ToString(response.JobId), nil
+}
+
+// maxTokenLength is the longest client request token CreateJob accepts.
+const maxTokenLength = 64
+
+func requestToken(token string) string {
+	if len(token) <= maxTokenLength {
+		return token
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Status is the state of a job as last described.
+type Status struct {
+	JobID     string   `json:"job_id"`
+	Status    string   `json:"status"`
+	Total     int64    `json:"total_tasks"`
+	Succeeded int64    `json:"succeeded_tasks"`
+	Failed    int64    `json:"failed_tasks"`
+	Elapsed   int64    `json:"elapsed_seconds,omitempty"`
+	Reasons   []string `json:"failure_reasons,omitempty"`
+	// Report is where the completion report of a finished job was written.
+	Report string `json:"report,omitempty"`
+}
+
+// Done reports whether the job has stopped and its status will not change.
+func (s Status) Done() bool {
+	switch s3ctypes.JobStatus(s.Status) {
+	case s3ctypes.JobStatusComplete, s3ctypes.JobStatusFailed, s3ctypes.JobStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// Describe returns the status of the job with the id jobID.
+func Describe(ctx context.Context, client Client, accountID, jobID string) (Status, error) {
+	response, err := client.DescribeJob(ctx, &s3control.DescribeJobInput{
+		AccountId: aws.String(accountID),
+		JobId:     aws.String(jobID),
+	})
+	if err != nil {
+		return Status{}, fmt.Errorf("failed to describe batch job %s: %w", jobID, err)
+	}
+	status := Status{JobID: jobID}
+	job := response.Job
+	if job == nil {
+		return status, nil
+	}
+	status.Status = string(job.Status)
+	if progress := job.ProgressSummary; progress != nil {
+		status.Total = aws.ToInt64(progress.TotalNumberOfTasks)
+		status.Succeeded = aws.ToInt64(progress.NumberOfTasksSucceeded)
+		status.Failed = aws.ToInt64(progress.NumberOfTasksFailed)
+		if timers := progress.Timers; timers != nil {
+			status.Elapsed = aws.ToInt64(timers.ElapsedTimeInActiveSeconds)
+		}
+	}
+	for _, reason := range job.FailureReasons {
+		status.Reasons = append(status.Reasons, strings.TrimSpace(aws.ToString(reason.FailureCode)+" "+aws.ToString(reason.FailureReason)))
+	}
+	if report := job.Report; report != nil && status.Done() && report.Enabled {
+		status.Report = strings.TrimSuffix(aws.ToString(report.Bucket), "/") + "/" + strings.Trim(aws.ToString(report.Prefix), "/") + "/job-" + jobID
+	}
+	return status, nil
+}
+
+// Wait describes the job every interval until it is done, passing each status
+// to update, and returns the last one. A canceled ctx stops the waiting, not
+// the job.
+func Wait(ctx context.Context, client Client, accountID, jobID string, interval time.Duration, update func(Status)) (Status, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		status, err := Describe(ctx, client, accountID, jobID)
+		if err != nil {
+			return status, err
+		}
+		if update != nil {
+			update(status)
+		}
+		if status.Done() {
+			return status, nil
+		}
+		select {
+		case <-ctx.Done():
+			return status, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
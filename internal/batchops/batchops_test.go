@@ -0,0 +1,110 @@
+package batchops
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3ctypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+)
+
+type fakeControl struct {
+	created   []*s3control.CreateJobInput
+	statuses  []s3ctypes.JobStatus
+	described int
+}
+
+func (f *fakeControl) CreateJob(ctx context.Context, params *s3control.CreateJobInput, optFns ...func(*s3control.Options)) (*s3control.CreateJobOutput, error) {
+	f.created = append(f.created, params)
+	return &s3control.CreateJobOutput{JobId: aws.String("job-1")}, nil
+}
+
+func (f *fakeControl) DescribeJob(ctx context.Context, params *s3control.DescribeJobInput, optFns ...func(*s3control.Options)) (*s3control.DescribeJobOutput, error) {
+	status := f.statuses[min(f.described, len(f.statuses)-1)]
+	f.described++
+	return &s3control.DescribeJobOutput{Job: &s3ctypes.JobDescriptor{
+		Status: status,
+		ProgressSummary: &s3ctypes.JobProgressSummary{
+			TotalNumberOfTasks:     aws.Int64(3),
+			NumberOfTasksSucceeded: aws.Int64(int64(f.described)),
+		},
+		Report: &s3ctypes.JobReport{Enabled: true, Bucket: aws.String("arn:aws:s3:::artifacts"), Prefix: aws.String(".ds-batch/run")},
+	}}, nil
+}
+
+func TestManifestEscapesKeys(t *testing.T) {
+	got := string(Manifest("artifacts", []string{"releases/app v1/index.html", "a+b/ü.txt"}))
+	want := "artifacts,releases/app%20v1/index.html\nartifacts,a%2Bb/%C3%BC.txt\n"
+	if got != want {
+		t.Errorf("Manifest = %q, want %q", got, want)
+	}
+}
+
+func TestAccountIDFallsBackToRole(t *testing.T) {
+	account, err := AccountID("", "arn:aws:iam::123456789012:role/batch")
+	if err != nil || account != "123456789012" {
+		t.Errorf("AccountID = %q, %v", account, err)
+	}
+	if account, _ := AccountID("210987654321", "arn:aws:iam::123456789012:role/batch"); account != "210987654321" {
+		t.Errorf("expected the configured account to win, got %q", account)
+	}
+	if _, err := AccountID("", "batch"); err == nil {
+		t.Error("expected an error for a role name without account")
+	}
+	if got := BucketARN("artifacts", "arn:aws-cn:iam::123456789012:role/batch"); got != "arn:aws-cn:s3:::artifacts" {
+		t.Errorf("BucketARN = %q", got)
+	}
+}
+
+func TestSubmitAndWait(t *testing.T) {
+	client := &fakeControl{statuses: []s3ctypes.JobStatus{s3ctypes.JobStatusActive, s3ctypes.JobStatusActive, s3ctypes.JobStatusComplete}}
+	id, err := Submit(context.Background(), client, Job{
+		AccountID:      "123456789012",
+		RoleARN:        "arn:aws:iam::123456789012:role/batch",
+		Priority:       10,
+		Token:          "run-1",
+		Operation:      CopyOperation(BucketARN("mirror", ""), "/copies/"),
+		ManifestBucket: "artifacts",
+		ManifestKey:    ".ds-batch/run-1/manifest.csv",
+		ManifestETag:   `"abc"`,
+		ReportBucket:   "artifacts",
+		ReportPrefix:   ".ds-batch/run-1",
+	})
+	if err != nil || id != "job-1" {
+		t.Fatalf("Submit = %q, %v", id, err)
+	}
+	input := client.created[0]
+	if got := aws.ToString(input.Manifest.Location.ObjectArn); got != "arn:aws:s3:::artifacts/.ds-batch/run-1/manifest.csv" {
+		t.Errorf("manifest ARN = %q", got)
+	}
+	if got := aws.ToString(input.Operation.S3PutObjectCopy.TargetKeyPrefix); got != "copies/" {
+		t.Errorf("target prefix = %q", got)
+	}
+	if aws.ToBool(input.ConfirmationRequired) {
+		t.Error("expected the job to run without confirmation")
+	}
+
+	var updates int
+	status, err := Wait(context.Background(), client, "123456789012", id, time.Millisecond, func(Status) { updates++ })
+	if err != nil {
+		t.Fatalf("Wait returned error: %v", err)
+	}
+	if updates != 3 || status.Status != "Complete" || status.Succeeded != 3 {
+		t.Errorf("unexpected final status %+v after %d updates", status, updates)
+	}
+	if status.Report != "arn:aws:s3:::artifacts/.ds-batch/run/job-job-1" {
+		t.Errorf("report = %q", status.Report)
+	}
+}
+
+func TestWaitStopsWithContext(t *testing.T) {
+	client := &fakeControl{statuses: []s3ctypes.JobStatus{s3ctypes.JobStatusActive}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	status, err := Wait(ctx, client, "123456789012", "job-1", time.Hour, nil)
+	if err == nil || status.Status != "Active" {
+		t.Errorf("expected the wait to stop with the last status, got %+v, %v", status, err)
+	}
+}
@@ -0,0 +1,233 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Client captures the S3 methods needed to read back and remove benchmark objects.
+type Client interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+}
+
+// PutUploader uploads benchmark objects, normally a manager.Uploader.
+type PutUploader interface {
+	Upload(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error)
+}
+
+// Options describes a benchmark run.
+type Options struct {
+	Bucket      string
+	Prefix      string
+	Sizes       []int64
+	Count       int
+	Concurrency int
+	// Keep leaves the synthetic objects in the bucket after the run.
+	Keep bool
+}
+
+// Stats summarizes one direction (upload or download) for a single object size.
+type Stats struct {
+	Operations     int     `json:"operations"`
+	Errors         int     `json:"errors"`
+	LatencyP50Ms   float64 `json:"latency_p50_ms"`
+	LatencyP90Ms   float64 `json:"latency_p90_ms"`
+	LatencyP99Ms   float64 `json:"latency_p99_ms"`
+	ThroughputMBps float64 `json:"throughput_mbps"`
+}
+
+// SizeReport holds upload and download statistics for one object size.
+type SizeReport struct {
+	Size     int64 `json:"size"`
+	Upload   Stats `json:"upload"`
+	Download Stats `json:"download"`
+}
+
+// Report is the result of a benchmark run.
+type Report struct {
+	Prefix         string       `json:"prefix"`
+	Concurrency    int          `json:"concurrency"`
+	Count          int          `json:"count"`
+	Sizes          []SizeReport `json:"sizes"`
+	ObjectsRemoved int          `json:"objects_removed"`
+}
+
+// Run uploads Count synthetic objects of each size, downloads them again and
+// reports latency percentiles and aggregate throughput per size and direction.
+func Run(ctx context.Context, client Client, uploader PutUploader, opts Options) (*Report, error) {
+	if len(opts.Sizes) == 0 {
+		return nil, fmt.Errorf("at least one object size is required")
+	}
+	if opts.Count < 1 {
+		return nil, fmt.Errorf("count must be at least 1")
+	}
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	report := &Report{Prefix: opts.Prefix, Concurrency: concurrency, Count: opts.Count}
+	keys := make([]string, 0, len(opts.Sizes)*opts.Count)
+
+	for _, size := range opts.Sizes {
+		if size <= 0 {
+			return report, fmt.Errorf("object sizes must be positive, got %d", size)
+		}
+
+		payload := make([]byte, size)
+		// Random content keeps compressing gateways from flattering the numbers.
+		rand.New(rand.NewSource(size)).Read(payload)
+
+		sizeKeys := make([]string, opts.Count)
+		for i := range sizeKeys {
+			sizeKeys[i] = fmt.Sprintf("%s/%d/object-%04d", opts.Prefix, size, i)
+		}
+
+		upload := measure(ctx, sizeKeys, concurrency, size, func(ctx context.Context, key string) error {
+			_, err := uploader.Upload(ctx, &s3.PutObjectInput{
+				Bucket: aws.String(opts.Bucket),
+				Key:    aws.String(key),
+				Body:   bytes.NewReader(payload),
+			})
+			return err
+		})
+		keys = append(keys, sizeKeys...)
+
+		download := measure(ctx, sizeKeys, concurrency, size, func(ctx context.Context, key string) error {
+			out, err := client.GetObject(ctx, &s3.GetObjectInput{
+				Bucket: aws.String(opts.Bucket),
+				Key:    aws.String(key),
+			})
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = out.Body.Close()
+			}()
+			_, err = io.Copy(io.Discard, out.Body)
+			return err
+		})
+
+		report.Sizes = append(report.Sizes, SizeReport{Size: size, Upload: upload, Download: download})
+	}
+
+	if !opts.Keep {
+		removed, err := deleteKeys(ctx, client, opts.Bucket, keys)
+		report.ObjectsRemoved = removed
+		if err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+func measure(ctx context.Context, keys []string, concurrency int, size int64, op func(context.Context, string) error) Stats {
+	var (
+		mu        sync.Mutex
+		latencies = make([]time.Duration, 0, len(keys))
+		failures  int
+		wg        sync.WaitGroup
+	)
+
+	queue := make(chan string)
+	started := time.Now()
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range queue {
+				begin := time.Now()
+				err := op(ctx, key)
+				elapsed := time.Since(begin)
+
+				mu.Lock()
+				if err != nil {
+					failures++
+				} else {
+					latencies = append(latencies, elapsed)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, key := range keys {
+		queue <- key
+	}
+	close(queue)
+	wg.Wait()
+	wall := time.Since(started)
+
+	stats := Stats{Operations: len(latencies), Errors: failures}
+	if len(latencies) == 0 {
+		return stats
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	stats.LatencyP50Ms = milliseconds(Percentile(latencies, 50))
+	stats.LatencyP90Ms = milliseconds(Percentile(latencies, 90))
+	stats.LatencyP99Ms = milliseconds(Percentile(latencies, 99))
+	if wall > 0 {
+		stats.ThroughputMBps = float64(size*int64(len(latencies))) / (1024 * 1024) / wall.Seconds()
+	}
+	return stats
+}
+
+// Percentile returns the nearest-rank percentile of sorted durations.
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted)) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func deleteKeys(ctx context.Context, client Client, bucket string, keys []string) (int, error) {
+	removed := 0
+	for start := 0; start < len(keys); start += deleteBatchSize {
+		end := start + deleteBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		batch := make([]s3types.ObjectIdentifier, 0, end-start)
+		for _, key := range keys[start:end] {
+			batch = append(batch, s3types.ObjectIdentifier{Key: aws.String(key)})
+		}
+
+		_, err := client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &s3types.Delete{Objects: batch, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return removed, fmt.Errorf("failed to delete benchmark objects: %w", err)
+		}
+		removed += len(batch)
+	}
+	return removed, nil
+}
+
+// deleteBatchSize is the DeleteObjects per-request key limit.
+const deleteBatchSize = 1000
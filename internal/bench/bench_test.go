@@ -0,0 +1,126 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type memoryStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	deleted []string
+	failPut string
+}
+
+func (m *memoryStore) Upload(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error) {
+	key := aws.ToString(input.Key)
+	if key == m.failPut {
+		return nil, errors.New("put failed")
+	}
+	data, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.objects == nil {
+		m.objects = make(map[string][]byte)
+	}
+	m.objects[key] = data
+	return &manager.UploadOutput{Key: input.Key}, nil
+}
+
+func (m *memoryStore) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (m *memoryStore) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, obj := range params.Delete.Objects {
+		m.deleted = append(m.deleted, aws.ToString(obj.Key))
+	}
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func TestRunReportsEachSizeAndCleansUp(t *testing.T) {
+	store := &memoryStore{failPut: "bench/2048/object-0001"}
+
+	report, err := Run(context.Background(), store, store, Options{
+		Bucket:      "bucket",
+		Prefix:      "bench",
+		Sizes:       []int64{1024, 2048},
+		Count:       3,
+		Concurrency: 2,
+	})
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	if len(report.Sizes) != 2 {
+		t.Fatalf("expected 2 size reports, got %d", len(report.Sizes))
+	}
+	small := report.Sizes[0]
+	if small.Size != 1024 || small.Upload.Operations != 3 || small.Download.Operations != 3 {
+		t.Fatalf("unexpected report for 1024 bytes: %+v", small)
+	}
+	large := report.Sizes[1]
+	if large.Upload.Errors != 1 || large.Download.Errors != 1 || large.Upload.Operations != 2 {
+		t.Fatalf("expected the failed put to be counted in both directions, got %+v", large)
+	}
+	if got := len(store.objects["bench/1024/object-0000"]); got != 1024 {
+		t.Fatalf("expected 1024 byte payload, got %d", got)
+	}
+	if report.ObjectsRemoved != 6 || len(store.deleted) != 6 {
+		t.Fatalf("expected all 6 keys to be removed, got %d (%v)", report.ObjectsRemoved, store.deleted)
+	}
+}
+
+func TestRunKeepSkipsCleanup(t *testing.T) {
+	store := &memoryStore{}
+
+	report, err := Run(context.Background(), store, store, Options{Prefix: "bench", Sizes: []int64{16}, Count: 1, Keep: true})
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if report.ObjectsRemoved != 0 || len(store.deleted) != 0 {
+		t.Fatalf("expected no cleanup with Keep, got %v", store.deleted)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Millisecond
+	}
+
+	cases := map[float64]time.Duration{
+		50: 50 * time.Millisecond,
+		90: 90 * time.Millisecond,
+		99: 99 * time.Millisecond,
+		0:  1 * time.Millisecond,
+	}
+	for p, want := range cases {
+		if got := Percentile(sorted, p); got != want {
+			t.Fatalf("p%.0f: expected %s, got %s", p, want, got)
+		}
+	}
+	if got := Percentile(nil, 50); got != 0 {
+		t.Fatalf("expected zero for empty input, got %s", got)
+	}
+}
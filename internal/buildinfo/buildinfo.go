@@ -0,0 +1,62 @@
+package buildinfo
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Environment variables DS exports to plugins for pipeline runs.
+const (
+	EnvPipeline = "DS_PIPELINE"
+	EnvRunID    = "DS_RUN_ID"
+	EnvCommit   = "DS_COMMIT"
+)
+
+// Info is the build context of the current run. Empty fields are unknown.
+type Info struct {
+	Pipeline string `json:"pipeline,omitempty"`
+	RunID    string `json:"run_id,omitempty"`
+	Commit   string `json:"commit,omitempty"`
+	// Git is the detected local checkout, if detection was requested.
+	Git *Git `json:"git,omitempty"`
+}
+
+// FromEnv reads the build context through lookup, normally os.LookupEnv.
+func FromEnv(lookup func(string) (string, bool)) Info {
+	get := func(name string) string {
+		value, _ := lookup(name)
+		return strings.TrimSpace(value)
+	}
+	return Info{
+		Pipeline: get(EnvPipeline),
+		RunID:    get(EnvRunID),
+		Commit:   get(EnvCommit),
+	}
+}
+
+// Values returns the known fields keyed by the names used for object tags and
+// user metadata. It returns nil when nothing is known.
+func (i Info) Values() map[string]string {
+	fields := map[string]string{
+		"ds-pipeline": i.Pipeline,
+		"ds-run-id":   i.RunID,
+		"ds-commit":   i.Commit,
+	}
+	if i.Git != nil {
+		fields["ds-git-sha"] = i.Git.SHA
+		fields["ds-git-branch"] = i.Git.Branch
+		fields["ds-git-tag"] = i.Git.Tag
+		fields["ds-git-dirty"] = strconv.FormatBool(i.Git.Dirty)
+	}
+
+	values := make(map[string]string)
+	for key, value := range fields {
+		if value != "" {
+			values[key] = value
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
@@ -0,0 +1,113 @@
+package buildinfo
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestFromEnvValues(t *testing.T) {
+	env := map[string]string{
+		EnvPipeline: " release ",
+		EnvCommit:   "abc123",
+	}
+	info := FromEnv(func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	})
+
+	values := info.Values()
+	if len(values) != 2 || values["ds-pipeline"] != "release" || values["ds-commit"] != "abc123" {
+		t.Errorf("unexpected values: %v", values)
+	}
+
+	withGit := Info{Git: &Git{SHA: "abc123", Branch: "main"}}.Values()
+	if withGit["ds-git-sha"] != "abc123" || withGit["ds-git-branch"] != "main" || withGit["ds-git-dirty"] != "false" {
+		t.Errorf("unexpected git values: %v", withGit)
+	}
+	if _, ok := withGit["ds-git-tag"]; ok {
+		t.Errorf("expected empty tag to be omitted, got %v", withGit)
+	}
+
+	empty := FromEnv(func(string) (string, bool) { return "", false })
+	if empty.Values() != nil {
+		t.Errorf("expected no values without build context, got %v", empty.Values())
+	}
+}
+
+func TestDetectGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=ci", "GIT_AUTHOR_EMAIL=ci@example.com", "GIT_COMMITTER_NAME=ci", "GIT_COMMITTER_EMAIL=ci@example.com")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q", "-b", "main")
+	if err := os.WriteFile(filepath.Join(dir, "app.txt"), []byte("v1"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	git("add", "app.txt")
+	git("commit", "-q", "-m", "initial")
+	git("tag", "v1.0.0")
+
+	info, err := DetectGit(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("DetectGit returned error: %v", err)
+	}
+	if len(info.SHA) != 40 || info.Branch != "main" || info.Tag != "v1.0.0" || info.Dirty {
+		t.Errorf("unexpected git info: %+v", info)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "app.txt"), []byte("v2"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	info, err = DetectGit(context.Background(), dir)
+	if err != nil || !info.Dirty {
+		t.Errorf("expected dirty checkout, got %+v (%v)", info, err)
+	}
+
+	if _, err := DetectGit(context.Background(), t.TempDir()); err == nil {
+		t.Error("expected error outside a repository")
+	}
+}
+
+func TestCorrelationFromEnv(t *testing.T) {
+	lookup := func(env map[string]string) func(string) (string, bool) {
+		return func(name string) (string, bool) {
+			value, ok := env[name]
+			return value, ok
+		}
+	}
+
+	c := CorrelationFromEnv(lookup(map[string]string{
+		EnvTraceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	}))
+	if c.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || c.Traceparent == "" || c.ID() != c.TraceID {
+		t.Errorf("expected the trace id from the traceparent, got %+v", c)
+	}
+	if fields := c.LogFields(); len(fields) != 2 || fields[0] != "trace_id" {
+		t.Errorf("unexpected log fields %v", fields)
+	}
+
+	c = CorrelationFromEnv(lookup(map[string]string{
+		EnvTraceID:       "trace-1",
+		EnvCorrelationID: " build-42 ",
+		EnvTraceparent:   "not-a-traceparent",
+	}))
+	if c.TraceID != "trace-1" || c.CorrelationID != "build-42" || c.Traceparent != "" || c.ID() != "build-42" {
+		t.Errorf("unexpected correlation %+v", c)
+	}
+
+	if c := CorrelationFromEnv(lookup(map[string]string{EnvCorrelationID: "bad\nvalue"})); c.ID() != "" {
+		t.Errorf("expected a value with control characters to be ignored, got %+v", c)
+	}
+}
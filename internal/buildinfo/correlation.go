@@ -0,0 +1,77 @@
+package buildinfo
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Environment variables carrying the ids the host knows a run by, which let
+// the plugin's logs and S3 requests be correlated with the pipeline run.
+const (
+	EnvTraceID       = "DS_TRACE_ID"
+	EnvCorrelationID = "DS_CORRELATION_ID"
+	// EnvTraceparent holds the W3C trace context of the host span, as
+	// propagated through the environment by OpenTelemetry.
+	EnvTraceparent = "TRACEPARENT"
+)
+
+// CorrelationHeader is the request header carrying the correlation id.
+const CorrelationHeader = "X-Correlation-Id"
+
+var traceparentPattern = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-[0-9a-f]{16}-[0-9a-f]{2}$`)
+
+// Correlation holds the ids of the host run. Empty fields are unknown.
+type Correlation struct {
+	TraceID       string
+	CorrelationID string
+	// Traceparent is the W3C traceparent of the host span.
+	Traceparent string
+}
+
+// CorrelationFromEnv reads the correlation ids through lookup, normally
+// os.LookupEnv. The trace id defaults to the one in the traceparent. Values
+// that cannot be sent as a header are ignored.
+func CorrelationFromEnv(lookup func(string) (string, bool)) Correlation {
+	get := func(name string) string {
+		value, _ := lookup(name)
+		value = strings.TrimSpace(value)
+		for _, r := range value {
+			if r < 0x20 || r > 0x7e {
+				return ""
+			}
+		}
+		return value
+	}
+	c := Correlation{
+		TraceID:       get(EnvTraceID),
+		CorrelationID: get(EnvCorrelationID),
+	}
+	if match := traceparentPattern.FindStringSubmatch(get(EnvTraceparent)); match != nil {
+		c.Traceparent = match[0]
+		if c.TraceID == "" {
+			c.TraceID = match[1]
+		}
+	}
+	return c
+}
+
+// ID returns the id sent in CorrelationHeader: the correlation id, else the
+// trace id.
+func (c Correlation) ID() string {
+	if c.CorrelationID != "" {
+		return c.CorrelationID
+	}
+	return c.TraceID
+}
+
+// LogFields returns the known ids as key/value pairs for hclog.
+func (c Correlation) LogFields() []interface{} {
+	var fields []interface{}
+	if c.TraceID != "" {
+		fields = append(fields, "trace_id", c.TraceID)
+	}
+	if c.CorrelationID != "" {
+		fields = append(fields, "correlation_id", c.CorrelationID)
+	}
+	return fields
+}
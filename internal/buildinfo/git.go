@@ -0,0 +1,58 @@
+package buildinfo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Git describes the state of a local git checkout.
+type Git struct {
+	SHA    string `json:"sha,omitempty"`
+	Branch string `json:"branch,omitempty"`
+	Tag    string `json:"tag,omitempty"`
+	Dirty  bool   `json:"dirty"`
+}
+
+// DetectGit inspects the git checkout containing dir using the git CLI.
+// It fails when git is not installed or dir is not inside a repository.
+func DetectGit(ctx context.Context, dir string) (*Git, error) {
+	sha, err := runGit(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	info := &Git{SHA: sha}
+
+	// A detached HEAD reports "HEAD" instead of a branch name.
+	if branch, err := runGit(ctx, dir, "rev-parse", "--abbrev-ref", "HEAD"); err == nil && branch != "HEAD" {
+		info.Branch = branch
+	}
+	// Only a tag pointing exactly at HEAD describes this build.
+	if tag, err := runGit(ctx, dir, "describe", "--tags", "--exact-match", "HEAD"); err == nil {
+		info.Tag = tag
+	}
+
+	status, err := runGit(ctx, dir, "status", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	info.Dirty = status != ""
+
+	return info, nil
+}
+
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), msg)
+		}
+		return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+)
+
+// GCSEndpoint is the XML API endpoint of Google Cloud Storage, used by the
+// gcs backend when no endpoint is configured.
+const GCSEndpoint = "https://storage.googleapis.com"
+
+// GCSRegion is the region requests to Cloud Storage are signed for when none
+// is configured; Cloud Storage accepts it for buckets in every location.
+const GCSRegion = "auto"
+
+// IsGCS reports whether requests go to Google Cloud Storage through its XML
+// interoperability API, authenticated with HMAC keys as static credentials.
+func (c *Config) IsGCS() bool {
+	return c.Backend == uploader.BackendGCS
+}
+
+// WeakETags reports whether the ETags of the backend do not identify the
+// content of objects, so objects are compared by size instead.
+func (c *Config) WeakETags() bool {
+	return c.Backend == uploader.BackendAzureGateway
+}
+
+// ObjectTags reports whether the bucket supports object tags, which directory
+// buckets and Cloud Storage do not.
+func (c *Config) ObjectTags() bool {
+	return !c.IsDirectoryBucket() && !c.IsGCS()
+}
+
+// applyBackendDefaults points a gcs configuration without endpoint or region
+// at Cloud Storage.
+func (c *Config) applyBackendDefaults() {
+	if !c.IsGCS() {
+		return
+	}
+	if c.Endpoint == "" {
+		c.Endpoint = GCSEndpoint
+	}
+	if c.Region == "" {
+		c.Region = GCSRegion
+	}
+}
+
+// validateGCS rejects settings the XML API of Cloud Storage does not support:
+// access points, object tags, S3 server-side encryption and S3 checksums.
+func (c *Config) validateGCS() error {
+	if c.IsAccessPoint() {
+		return fmt.Errorf("bucket: access point ARNs cannot be used with the gcs backend")
+	}
+	if len(c.CleanupTags) > 0 {
+		return fmt.Errorf("cleanup_tags cannot be used with the gcs backend, which does not support object tags")
+	}
+	if c.Encryption.Mode != "" {
+		return fmt.Errorf("encryption.mode cannot be used with the gcs backend; configure default encryption on the bucket instead")
+	}
+	if c.Policy.RequireEncryption {
+		return fmt.Errorf("policy.require_encryption cannot be used with the gcs backend, which cannot read the bucket encryption")
+	}
+	if c.Checksum.Algorithm != "" || c.Checksum.Type != "" {
+		return fmt.Errorf("checksum_algorithm and checksum_type cannot be used with the gcs backend, which does not support S3 checksums")
+	}
+	return nil
+}
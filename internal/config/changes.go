@@ -0,0 +1,51 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+)
+
+// ChangedSettings lists the keys of the settings whose resolved value differs
+// between previous and c, in Describe order followed by keys previous had and
+// c lacks. Secrets count as changed when their value changed even though
+// Describe redacts them.
+func (c *Config) ChangedSettings(previous *Config) []string {
+	before := make(map[string]interface{})
+	for _, s := range previous.Describe() {
+		before[s.Key] = s.Value
+	}
+	beforeSecrets, afterSecrets := previous.secrets(), c.secrets()
+
+	var changed []string
+	for _, s := range c.Describe() {
+		old, ok := before[s.Key]
+		delete(before, s.Key)
+		if !ok || !reflect.DeepEqual(old, s.Value) || beforeSecrets[s.Key] != afterSecrets[s.Key] {
+			changed = append(changed, s.Key)
+		}
+	}
+	removed := make([]string, 0, len(before))
+	for key := range before {
+		removed = append(removed, key)
+	}
+	sort.Strings(removed)
+	return append(changed, removed...)
+}
+
+// secrets returns the values Describe redacts, by setting key.
+func (c *Config) secrets() map[string]string {
+	secrets := map[string]string{
+		"credentials.access_key_id":     c.Credentials.AccessKeyID,
+		"credentials.secret_access_key": c.Credentials.SecretAccessKey,
+		"credentials.session_token":     c.Credentials.SessionToken,
+		"credentials.external_id":       c.Credentials.ExternalID,
+		"client_encryption.key":         c.ClientEncryption.Key,
+	}
+	for name, target := range c.Targets {
+		prefix := "targets." + name + "."
+		secrets[prefix+"credentials.access_key_id"] = target.Credentials.AccessKeyID
+		secrets[prefix+"credentials.secret_access_key"] = target.Credentials.SecretAccessKey
+		secrets[prefix+"credentials.session_token"] = target.Credentials.SessionToken
+	}
+	return secrets
+}
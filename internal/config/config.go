@@ -2,14 +2,49 @@ package config
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/delivery-station/ds-s3/internal/awsauth"
+	"github.com/delivery-station/ds-s3/internal/diagnostics"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
 	"github.com/delivery-station/ds/pkg/types"
 	"github.com/hashicorp/go-hclog"
 	"github.com/mitchellh/mapstructure"
 )
 
+// DirectoryBucketSuffix ends the name of every S3 Express One Zone directory bucket.
+const DirectoryBucketSuffix = "--x-s3"
+
+// MultiRegionAccessPointSuffix ends the alias of every S3 Multi-Region Access
+// Point.
+const MultiRegionAccessPointSuffix = ".mrap"
+
+var directoryBucketPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*--[a-z0-9-]+--x-s3$`)
+
+var (
+	// awsRegionPattern matches AWS region codes such as eu-west-1,
+	// us-gov-west-1 or eusc-de-east-1.
+	awsRegionPattern = regexp.MustCompile(`^[a-z]{2,4}(-[a-z]+)+-[0-9]{1,2}$`)
+	// bucketNamePattern matches S3 general purpose bucket names.
+	bucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+	// customBucketNamePattern matches the bucket names of S3-compatible
+	// stores and Google Cloud Storage, which are laxer than S3.
+	customBucketNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{1,253}[A-Za-z0-9]$`)
+	// customRegionPattern matches the region names S3-compatible stores
+	// accept, which only need to fit the signing scope.
+	customRegionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+)
+
 // Config captures the resolved plugin configuration.
 type Config struct {
 	Bucket         string
@@ -17,42 +52,872 @@ type Config struct {
 	ContextPath    string
 	Sources        []string
 	Cleanup        bool
+	CleanupTags    map[string]string
 	Overwrite      bool
 	Endpoint       string
 	ForcePathStyle bool
 	SkipTLSVerify  bool
+	HTTP           HTTP
+	DNS            DNS
+	Retry          Retry
 	Profile        string
 	Credentials    Credentials
+	// DebugAWSConfig logs the AWS configuration the SDK resolved; it is set
+	// by --debug-aws-config only.
+	DebugAWSConfig bool
+	Snapshot       Snapshot
+	Targets        map[string]Target
+	Replication    Replication
+	Multipart      Multipart
+	Checksum       Checksum
+	MemoryLimit    int64
+	Concurrency    int
+	StreamPlans    bool
+	FilePolicy     FilePolicy
+	LargeFiles     LargeFiles
+	Limits         Limits
+	MaxDepth       int
+	IgnoreFiles    bool
+	ExtractTar     bool
+	Decompress     bool
+	ManifestKey    string
+	RunID          string
+	FailureReport  string
+	Summary        Summary
+	Progress       Progress
+	Packing        Packing
+	Batch          Batch
+	Inventory      Inventory
+	Sync           Sync
+	BuildContext   BuildContext
+	SecretScan     SecretScan
+	Antivirus      Antivirus
+	Encryption     Encryption
+	Policy         Policy
+	ACL            ACL
 	LogLevel       string
+	// Environment names the overlay selected via ForEnvironment, if any.
+	Environment string
+	// UserAgentSuffix is appended to the User-Agent of every S3 request.
+	UserAgentSuffix string
+	// RequestHeaders are set on every S3 request, e.g. for gateway accounting.
+	RequestHeaders map[string]string
+	// ClientEncryption encrypts objects before they leave the machine.
+	ClientEncryption ClientEncryption
+	// Attestations are published alongside the uploaded files.
+	Attestations Attestations
+	// RespectGitignore leaves out files ignored by the .gitignore chain of
+	// the repository containing each source directory.
+	RespectGitignore bool
+	// WalkConcurrency is how many directories of a source are read at once.
+	WalkConcurrency int
+	// StripComponents removes leading path elements from the keys of
+	// files in source directories.
+	StripComponents int
+	// ShutdownGracePeriod is how long the plugin waits for a canceled
+	// command to clean up after SIGTERM or SIGINT before exiting.
+	ShutdownGracePeriod time.Duration
+	// LocalConfig merges the LocalFileName file of the working directory
+	// over the host settings.
+	LocalConfig bool
+	// StrictSettings rejects settings keys the plugin does not know, such
+	// as misspelled ones, instead of ignoring them.
+	StrictSettings bool
+	// ExitCodes maps classes of failed commands (see diagnostics.Classes) to
+	// the exit code reported for them instead of 1.
+	ExitCodes map[string]int
+	// Backend names the uploader backend requests go through, for
+	// S3-compatible stores with quirks (see uploader.Backends).
+	Backend string
+	// SkipIfExistsKey names a marker object below the context path: an
+	// upload finding it does nothing, and a successful one writes it.
+	SkipIfExistsKey string
+	// LatestKey is where a successful upload stores a pointer to its context
+	// path; unlike the other keys it is not below the context path.
+	LatestKey string
+	// DryRun previews every operation: objects are listed and read, but
+	// nothing is written to or deleted from the bucket.
+	DryRun bool
+	// Logging selects the format of the plugin's log lines.
+	Logging Logging
+	// Audit stores a record of every run of a writing operation.
+	Audit Audit
+	// Throttle slows uploads down during configured windows.
+	Throttle Throttle
+	// Expect fails uploads whose sources hold suspiciously little.
+	Expect Expect
+	// Verify waits for uploaded objects to be visible before an upload
+	// completes.
+	Verify Verify
+
+	// settings keeps the raw plugin settings the Config was decoded from so
+	// that environment and operation overlays can be merged over them. All
+	// three maps are read-only.
+	settings     map[string]interface{}
+	environments map[string]map[string]interface{}
+	operations   map[string]map[string]interface{}
+	// origins records where each setting key was resolved from; see Describe.
+	origins map[string]string
+	// deprecations warns about deprecated settings that were migrated; see
+	// Deprecations.
+	deprecations []string
+}
+
+// HTTP tunes the HTTP transport used for S3 requests. Zero values keep the
+// SDK defaults.
+type HTTP struct {
+	// MaxIdleConnsPerHost caps the idle connections kept per host (SDK default 10).
+	MaxIdleConnsPerHost int
+	DisableHTTP2        bool
+	DisableKeepAlives   bool
+	// IdleConnTimeout closes idle connections after this duration.
+	IdleConnTimeout time.Duration
+}
+
+// DNS controls how the custom endpoint host is resolved. Both options keep
+// connecting to known addresses and re-resolve the host only after every
+// known address failed.
+type DNS struct {
+	// Cache resolves the endpoint host once per run.
+	Cache bool
+	// Pin lists static IP addresses used for the endpoint host instead of DNS.
+	Pin []string
+}
+
+// Enabled reports whether the endpoint host is resolved through the cache.
+func (d DNS) Enabled() bool {
+	return d.Cache || len(d.Pin) > 0
+}
+
+// Retry tunes how failed S3 requests are retried. Zero values keep the SDK
+// defaults (3 attempts, at most 20s between them).
+type Retry struct {
+	MaxAttempts int
+	MaxBackoff  time.Duration
+}
+
+// Checksum selects how S3 checksums uploaded objects.
+type Checksum struct {
+	// Type is ChecksumTypeComposite or ChecksumTypeFullObject; empty leaves
+	// the choice to S3.
+	Type string
+	// Algorithm is one of ChecksumAlgorithms; empty leaves the choice to the SDK.
+	Algorithm string
+	// Metadata stores the SHA-256 of every uploaded file as x-amz-meta-sha256.
+	Metadata bool
+}
+
+// Multipart tunes the multipart upload manager.
+type Multipart struct {
+	PartSize    int64
+	Concurrency int
+}
+
+// Replication lists named targets that receive a copy of every upload.
+type Replication struct {
+	Targets []string
+	// RequireAll fails the run when any replica fails; otherwise replica
+	// failures are reported in the summary only.
+	RequireAll bool
+}
+
+// Target describes an alternate bucket/endpoint that operations can address by name.
+// Empty fields inherit the base configuration.
+type Target struct {
+	Bucket         string
+	Region         string
+	Endpoint       string
+	ForcePathStyle *bool
+	SkipTLSVerify  *bool
+	Profile        string
+	Credentials    Credentials
+	// Backend replaces the backend of the base settings; a different one
+	// does not inherit the base endpoint and region.
+	Backend string
+}
+
+// BuildContext controls stamping uploaded objects with the DS pipeline/build
+// context of the run (pipeline name, run id and triggering commit).
+type BuildContext struct {
+	Enabled  bool
+	Tags     bool
+	Metadata bool
+	// Git adds the state of the local git checkout to the build context.
+	Git bool
+}
+
+// SecretScan configures the opt-in scan of planned files for potential secrets.
+type SecretScan struct {
+	Enabled bool
+	// Mode is ScanModeBlock or ScanModeWarn.
+	Mode string
+	// Patterns adds named regular expressions to the built-in rules.
+	Patterns map[string]string
+	// EntropyThreshold enables the high-entropy token rule when positive.
+	EntropyThreshold float64
+	// MaxFileSize skips larger files; zero scans every file.
+	MaxFileSize int64
+}
+
+// Scan modes decide what happens when a pre-upload scan finds something.
+const (
+	ScanModeBlock = "block"
+	ScanModeWarn  = "warn"
+)
+
+// DefaultScanMaxFileSize is the largest file the secret scanner reads by default.
+const DefaultScanMaxFileSize int64 = 10 * 1024 * 1024
+
+// Antivirus configures the malware scan run on every planned file before upload.
+// Exactly one of Clamd and Command must be set when enabled.
+type Antivirus struct {
+	Enabled bool
+	// Clamd is a clamd address such as unix:///var/run/clamav/clamd.ctl or tcp://host:3310.
+	Clamd string
+	// Command is an external scanner invoked with the file path appended;
+	// exit status 1 means infected.
+	Command []string
+	// Action is AntivirusActionBlock or AntivirusActionQuarantine.
+	Action string
+}
+
+// Antivirus actions decide what happens to an infected file.
+const (
+	AntivirusActionBlock      = "block"
+	AntivirusActionQuarantine = "quarantine"
+)
+
+// Encryption selects the server-side encryption requested for written objects.
+type Encryption struct {
+	// Mode is one of EncryptionModes; empty leaves encryption to the bucket default.
+	Mode string
+	// KMSKeyID names the KMS key for the aws:kms modes; empty uses the AWS managed key.
+	KMSKeyID string
+	// KeyRules replace KMSKeyID for the objects matching their patterns; the
+	// first matching rule applies (see uploader.KMSKeyRule).
+	KeyRules []KMSKeyRule
+	// BucketKey requests an S3 Bucket Key for aws:kms objects, which saves
+	// a KMS request per object; unset leaves it to the bucket configuration.
+	BucketKey bool
+	// Preflight asks KMS, before the first write, whether the uploader may
+	// generate data keys with each configured key.
+	Preflight bool
+	// PreflightStrict fails the command when the preflight is denied a key,
+	// instead of warning. Key policies allowing a key only through S3 deny
+	// the direct call, so a denial does not prove that uploads fail.
+	PreflightStrict bool
+}
+
+// KMSKeyRule selects the KMS key of the objects whose keys match Pattern.
+type KMSKeyRule struct {
+	Pattern  string
+	KMSKeyID string
+}
+
+// EncryptionModes lists the supported encryption.mode values.
+var EncryptionModes = []string{"AES256", "aws:kms", "aws:kms:dsse"}
+
+// ClientEncryption encrypts objects on the client before upload, for artifacts
+// that must stay unreadable to anyone with access to the bucket. Each object
+// gets its own data key, wrapped with exactly one of KMSKeyID and Key.
+type ClientEncryption struct {
+	// KMSKeyID names the KMS key wrapping data keys.
+	KMSKeyID string
+	// Key is a base64-encoded 256-bit key wrapping data keys locally.
+	Key string
+}
+
+// Enabled reports whether client-side encryption is configured.
+func (c ClientEncryption) Enabled() bool {
+	return c.KMSKeyID != "" || c.Key != ""
+}
+
+// DecodedKey returns the raw bytes of Key.
+func (c ClientEncryption) DecodedKey() ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(c.Key)
+	if err != nil {
+		return nil, fmt.Errorf("client_encryption.key must be base64 encoded: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("client_encryption.key must be a 256-bit key, got %d bits", len(key)*8)
+	}
+	return key, nil
+}
+
+// Policy holds guardrails that refuse operations violating organisational rules.
+type Policy struct {
+	// RequireEncryption refuses uploads unless encryption.mode is set or the
+	// bucket has default encryption.
+	RequireEncryption bool
+	// AllowedPrefixes confines every write and delete, in any bucket, to
+	// keys within these prefixes (see uploader.KeyAllowed); empty allows all.
+	AllowedPrefixes []string
+	// ForbiddenPatterns lists patterns of files, such as *.pem, that uploads
+	// refuse to plan (see uploader.PlanPolicy.Forbidden).
+	ForbiddenPatterns []string
+	// MaxObjectSize refuses to plan files larger than this many bytes; zero
+	// disables the limit.
+	MaxObjectSize int64
+}
+
+// CheckPrefix fails unless every key below prefix is within AllowedPrefixes,
+// so that an operation writing there is refused before it starts.
+func (p Policy) CheckPrefix(prefix string) error {
+	if uploader.KeyAllowed(p.AllowedPrefixes, prefix) {
+		return nil
+	}
+	location := prefix
+	if location == "" {
+		location = "the bucket root"
+	}
+	return fmt.Errorf("policy.allowed_prefixes: %s is outside the allowed prefixes %s", location, strings.Join(p.AllowedPrefixes, ", "))
+}
+
+// ACL applies a canned ACL to uploaded, streamed and copied objects. Buckets
+// with Object Ownership set to BucketOwnerEnforced have ACLs disabled and
+// reject every other ACL than bucket-owner-full-control; WhenDisabled decides
+// whether such a bucket fails the command before its first write or the ACL
+// is dropped.
+type ACL struct {
+	// Canned is one of CannedACLs; empty sends no ACL.
+	Canned string
+	// WhenDisabled is ACLDisabledFail, the default, or ACLDisabledDrop.
+	WhenDisabled string
+}
+
+// Logging selects how the plugin writes its log lines. DS parses JSON lines
+// and renders them in its own format; lines in any other format are passed
+// through at the debug level, so the other formats are meant for reading the
+// plugin output directly.
+type Logging struct {
+	// Format is one of LogFormats; empty is LogFormatJSON.
+	Format string
+	// IncludeLocation adds the file and line of the logging call.
+	IncludeLocation bool
+}
+
+// Log formats of the logging.format setting.
+const (
+	LogFormatJSON    = "json"
+	LogFormatLogfmt  = "logfmt"
+	LogFormatConsole = "console"
+)
+
+// LogFormats lists the supported logging.format values.
+var LogFormats = []string{LogFormatJSON, LogFormatLogfmt, LogFormatConsole}
+
+// CannedACLs lists the supported acl.canned values.
+var CannedACLs = []string{"private", "public-read", "public-read-write", "authenticated-read", "aws-exec-read", "bucket-owner-read", "bucket-owner-full-control"}
+
+// ACL actions decide what happens when the bucket has ACLs disabled.
+const (
+	ACLDisabledFail = "fail"
+	ACLDisabledDrop = "drop"
+)
+
+// Snapshot controls point-in-time copies taken before destructive uploads.
+type Snapshot struct {
+	Enabled bool
+	Prefix  string
+}
+
+// Sync makes uploads incremental: files unchanged since the last successful
+// run, according to the state object at StateKey below the context path, are
+// skipped. With CacheDir set the state is kept in a local cache there instead.
+type Sync struct {
+	Enabled  bool
+	StateKey string
+	CacheDir string
+}
+
+// Attestations names supply-chain documents published with every upload.
+// Each is uploaded below AttestationDir and its SHA-256 is tagged onto every
+// uploaded object.
+type Attestations struct {
+	// SBOM is a software bill of materials, such as SPDX or CycloneDX JSON.
+	SBOM string
+	// Provenance is a SLSA provenance statement.
+	Provenance string
+}
+
+// AttestationDir is the directory below the context path holding attestations.
+const AttestationDir = ".attestations"
+
+// FilePolicy decides how uploads treat empty files and special files (FIFOs,
+// sockets, devices) found in the sources.
+type FilePolicy struct {
+	// Empty is FileActionUpload, FileActionSkip or FileActionError.
+	Empty string
+	// Special is FileActionError, FileActionSkip or FileActionUploadEmpty.
+	Special string
+}
+
+// File actions name what happens to an empty or special file.
+const (
+	FileActionUpload      = "upload"
+	FileActionSkip        = "skip"
+	FileActionError       = "error"
+	FileActionUploadEmpty = "upload_empty"
+)
+
+// LargeFiles flags planned files above Threshold, and sparse files, before
+// anything is uploaded.
+type LargeFiles struct {
+	// Threshold is the size in bytes above which a file is flagged; zero
+	// disables the check.
+	Threshold int64
+	// Action is LargeFileActionWarn, LargeFileActionRequireMultipart or
+	// LargeFileActionError.
+	Action string
+}
+
+// Large file actions decide what happens to a flagged file.
+const (
+	LargeFileActionWarn             = "warn"
+	LargeFileActionRequireMultipart = "require_multipart"
+	LargeFileActionError            = "error"
+)
+
+// Limits abort planning when the sources are far larger than expected,
+// typically because a source path such as / or $HOME was misconfigured.
+// Zero disables a limit.
+type Limits struct {
+	MaxFiles     int
+	MaxTotalSize int64
+}
+
+// Summary bounds the upload summary written to stdout. When a run uploads
+// more than MaxObjects objects, the summary lists only the first MaxObjects
+// and the full summary is written to File instead. Zero disables the limit.
+type Summary struct {
+	MaxObjects int
+	File       string
+}
+
+// Progress configures how an upload reports its progress: it logs it every
+// Interval and, unless File is empty, rewrites the checkpoint File for
+// monitors polling it while stdout is buffered.
+type Progress struct {
+	File     string
+	Interval time.Duration
+}
+
+// Packing bundles files of up to MaxFileSize bytes into tar archives of
+// about ChunkSize bytes, uploaded with an index below the context path, so
+// that many tiny files cost a few requests instead of one each.
+type Packing struct {
+	Enabled     bool
+	MaxFileSize int64
+	ChunkSize   int64
+}
+
+// Batch configures the S3 Batch Operations jobs the batch operation submits.
+// RoleARN is the role S3 assumes to run them; AccountID defaults to its
+// account. Manifests and completion reports are written below Prefix in the
+// bucket, outside the context path. Deletes invoke DeleteFunctionARN on every
+// object, as Batch Operations has no delete of its own.
+type Batch struct {
+	RoleARN           string
+	AccountID         string
+	Prefix            string
+	Priority          int
+	PollInterval      time.Duration
+	DeleteFunctionARN string
+}
+
+// Inventory locates the S3 Inventory reports of the bucket, read as the
+// remote state for sync and diff instead of listing prefixes with millions of
+// objects. Prefix is where the reports of one inventory configuration are
+// delivered, <destination prefix>/<source bucket>/<configuration id>, in
+// Bucket, which defaults to the bucket itself. Reports older than MaxAge are
+// not trusted; zero accepts any age.
+type Inventory struct {
+	Bucket string
+	Prefix string
+	MaxAge time.Duration
 }
 
-// Credentials stores optional static credentials.
+// Enabled reports whether reports are read.
+func (i Inventory) Enabled() bool {
+	return i.Prefix != ""
+}
+
+// Audit stores a record of every run of an operation that writes to buckets
+// (who ran it, when, with which flags and result) as an object below Prefix
+// in Bucket, which defaults to the bucket itself. Required fails a run whose
+// record cannot be stored instead of only logging a warning.
+type Audit struct {
+	Bucket   string
+	Prefix   string
+	Required bool
+}
+
+// Enabled reports whether records are stored.
+func (a Audit) Enabled() bool {
+	return a.Prefix != ""
+}
+
+// Expect guards against deploying an empty or truncated build: an upload
+// fails when its sources hold fewer than MinFiles files or add up to less
+// than MinTotalSize bytes. Zero disables a check.
+type Expect struct {
+	MinFiles     int
+	MinTotalSize int64
+}
+
+// Verify makes an upload wait until HeadObject shows its objects, for
+// S3-compatible gateways whose caches lag behind writes, so that the next
+// pipeline stage finds them. Zero Wait disables the check.
+type Verify struct {
+	// Wait is how long to keep retrying before the upload fails.
+	Wait time.Duration
+	// Interval is the pause between attempts.
+	Interval time.Duration
+	// Sample checks that many randomly chosen objects; zero checks all.
+	Sample int
+}
+
+// S3 limits on a single object.
+const (
+	MaxObjectSize  int64 = 5 << 40
+	MaxUploadParts int64 = 10000
+)
+
+// Credentials stores optional static credentials and a role assumed with
+// them, or with the default credential chain when they are empty.
 type Credentials struct {
+	// Source pins where credentials come from (see awsauth.Sources); empty
+	// is awsauth.SourceAuto.
+	Source          string
 	AccessKeyID     string
 	SecretAccessKey string
 	SessionToken    string
+	RoleARN         string
+	RoleSessionName string
+	ExternalID      string
+	RoleDuration    time.Duration
+	// MFASerial is the MFA device the role requires. MFAToken is its
+	// current code, given with --mfa-token for a single run; it is never
+	// read from settings.
+	MFASerial string
+	MFAToken  string
+}
+
+// Role limits of STS AssumeRole sessions.
+const (
+	MinRoleDuration = 15 * time.Minute
+	MaxRoleDuration = 12 * time.Hour
+)
+
+type rawCredentials struct {
+	Source          string `mapstructure:"source"`
+	AccessKeyID     string `mapstructure:"access_key_id"`
+	SecretAccessKey string `mapstructure:"secret_access_key"`
+	SessionToken    string `mapstructure:"session_token"`
+	RoleARN         string `mapstructure:"role_arn"`
+	RoleSessionName string `mapstructure:"role_session_name"`
+	ExternalID      string `mapstructure:"external_id"`
+	RoleDuration    string `mapstructure:"role_duration"`
+	MFASerial       string `mapstructure:"mfa_serial"`
+}
+
+func (r *rawCredentials) credentials() (Credentials, error) {
+	creds := Credentials{
+		Source:          strings.ToLower(strings.TrimSpace(r.Source)),
+		AccessKeyID:     strings.TrimSpace(r.AccessKeyID),
+		SecretAccessKey: strings.TrimSpace(r.SecretAccessKey),
+		SessionToken:    strings.TrimSpace(r.SessionToken),
+		RoleARN:         strings.TrimSpace(r.RoleARN),
+		RoleSessionName: strings.TrimSpace(r.RoleSessionName),
+		ExternalID:      strings.TrimSpace(r.ExternalID),
+		MFASerial:       strings.TrimSpace(r.MFASerial),
+	}
+	if value := strings.TrimSpace(r.RoleDuration); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return Credentials{}, fmt.Errorf("invalid credentials.role_duration: %w", err)
+		}
+		creds.RoleDuration = duration
+	}
+	return creds, nil
 }
 
 type rawSettings struct {
-	Bucket         string   `mapstructure:"bucket"`
-	Region         string   `mapstructure:"region"`
-	ContextPath    string   `mapstructure:"context_path"`
-	Sources        []string `mapstructure:"sources"`
-	Cleanup        *bool    `mapstructure:"cleanup"`
-	Overwrite      *bool    `mapstructure:"overwrite"`
-	Endpoint       string   `mapstructure:"endpoint"`
-	ForcePathStyle *bool    `mapstructure:"force_path_style"`
-	Profile        string   `mapstructure:"profile"`
+	Bucket         string            `mapstructure:"bucket"`
+	Region         string            `mapstructure:"region"`
+	ContextPath    string            `mapstructure:"context_path"`
+	Sources        []string          `mapstructure:"sources"`
+	Cleanup        *bool             `mapstructure:"cleanup"`
+	CleanupTags    map[string]string `mapstructure:"cleanup_tags"`
+	Overwrite      *bool             `mapstructure:"overwrite"`
+	Endpoint       string            `mapstructure:"endpoint"`
+	ForcePathStyle *bool             `mapstructure:"force_path_style"`
+	Profile        string            `mapstructure:"profile"`
+	TLS            *struct {
+		SkipVerify *bool `mapstructure:"skip_verify"`
+	} `mapstructure:"tls"`
+	HTTP *struct {
+		MaxIdleConnsPerHost int    `mapstructure:"max_idle_conns_per_host"`
+		DisableHTTP2        *bool  `mapstructure:"disable_http2"`
+		DisableKeepAlives   *bool  `mapstructure:"disable_keepalives"`
+		IdleConnTimeout     string `mapstructure:"idle_conn_timeout"`
+	} `mapstructure:"http"`
+	DNS *struct {
+		Cache *bool    `mapstructure:"cache"`
+		Pin   []string `mapstructure:"pin"`
+	} `mapstructure:"dns"`
+	UserAgentSuffix string            `mapstructure:"user_agent_suffix"`
+	RequestHeaders  map[string]string `mapstructure:"request_headers"`
+	Retry           *struct {
+		MaxAttempts int    `mapstructure:"max_attempts"`
+		MaxBackoff  string `mapstructure:"max_backoff"`
+	} `mapstructure:"retry"`
+	Credentials *rawCredentials `mapstructure:"credentials"`
+	Snapshot    *struct {
+		Enabled *bool  `mapstructure:"enabled"`
+		Prefix  string `mapstructure:"prefix"`
+	} `mapstructure:"snapshot"`
+	Sync *struct {
+		Enabled  *bool  `mapstructure:"enabled"`
+		StateKey string `mapstructure:"state_key"`
+		CacheDir string `mapstructure:"cache_dir"`
+	} `mapstructure:"sync"`
+	Targets     map[string]rawTarget `mapstructure:"targets"`
+	Replication *struct {
+		Targets    []string `mapstructure:"targets"`
+		RequireAll *bool    `mapstructure:"require_all"`
+	} `mapstructure:"replication"`
+	Multipart *struct {
+		PartSize    string `mapstructure:"part_size"`
+		Concurrency int    `mapstructure:"concurrency"`
+	} `mapstructure:"multipart"`
+	ChecksumType      string `mapstructure:"checksum_type"`
+	ChecksumAlgorithm string `mapstructure:"checksum_algorithm"`
+	ChecksumMetadata  *bool  `mapstructure:"checksum_metadata"`
+	MemoryLimit       string `mapstructure:"memory_limit"`
+	Concurrency       int    `mapstructure:"concurrency"`
+	StreamPlans       *bool  `mapstructure:"stream_plans"`
+	WalkConcurrency   int    `mapstructure:"walk_concurrency"`
+	MaxDepth          int    `mapstructure:"max_depth"`
+	StripComponents   int    `mapstructure:"strip_components"`
+	IgnoreFiles       *bool  `mapstructure:"ignore_files"`
+	RespectGitignore  *bool  `mapstructure:"respect_gitignore"`
+	ExtractTar        *bool  `mapstructure:"extract_tar"`
+	Decompress        *bool  `mapstructure:"decompress"`
+	ManifestKey       string `mapstructure:"manifest_key"`
+	SkipIfExistsKey   string `mapstructure:"skip_if_exists_key"`
+	LatestKey         string `mapstructure:"latest_key"`
+	DryRun            bool   `mapstructure:"dry_run"`
+	RunID             string `mapstructure:"run_id"`
+	FailureReport     string `mapstructure:"failure_report"`
+	BuildContext      *struct {
+		Enabled  *bool `mapstructure:"enabled"`
+		Tags     *bool `mapstructure:"tags"`
+		Metadata *bool `mapstructure:"metadata"`
+		Git      *bool `mapstructure:"git"`
+	} `mapstructure:"build_context"`
+	SecretScan *struct {
+		Enabled          *bool             `mapstructure:"enabled"`
+		Mode             string            `mapstructure:"mode"`
+		Patterns         map[string]string `mapstructure:"patterns"`
+		EntropyThreshold float64           `mapstructure:"entropy_threshold"`
+		MaxFileSize      string            `mapstructure:"max_file_size"`
+	} `mapstructure:"secret_scan"`
+	Antivirus *struct {
+		Enabled *bool    `mapstructure:"enabled"`
+		Clamd   string   `mapstructure:"clamd"`
+		Command []string `mapstructure:"command"`
+		Action  string   `mapstructure:"action"`
+	} `mapstructure:"antivirus"`
+	Encryption *struct {
+		Mode            string `mapstructure:"mode"`
+		KMSKeyID        string `mapstructure:"kms_key_id"`
+		BucketKey       *bool  `mapstructure:"bucket_key"`
+		Preflight       *bool  `mapstructure:"preflight"`
+		PreflightStrict bool   `mapstructure:"preflight_strict"`
+		KeyRules        []struct {
+			Pattern  string `mapstructure:"pattern"`
+			KMSKeyID string `mapstructure:"kms_key_id"`
+		} `mapstructure:"key_rules"`
+	} `mapstructure:"encryption"`
+	FilePolicy *struct {
+		Empty   string `mapstructure:"empty"`
+		Special string `mapstructure:"special"`
+	} `mapstructure:"file_policy"`
+	LargeFiles *struct {
+		Threshold string `mapstructure:"threshold"`
+		Action    string `mapstructure:"action"`
+	} `mapstructure:"large_files"`
+	Limits *struct {
+		MaxFiles     int    `mapstructure:"max_files"`
+		MaxTotalSize string `mapstructure:"max_total_size"`
+	} `mapstructure:"limits"`
+	Summary *struct {
+		MaxObjects *int   `mapstructure:"max_objects"`
+		File       string `mapstructure:"file"`
+	} `mapstructure:"summary"`
+	Progress *struct {
+		File     string `mapstructure:"file"`
+		Interval string `mapstructure:"interval"`
+	} `mapstructure:"progress"`
+	Packing *struct {
+		Enabled     *bool  `mapstructure:"enabled"`
+		MaxFileSize string `mapstructure:"max_file_size"`
+		ChunkSize   string `mapstructure:"chunk_size"`
+	} `mapstructure:"packing"`
+	Batch *struct {
+		RoleARN           string `mapstructure:"role_arn"`
+		AccountID         string `mapstructure:"account_id"`
+		Prefix            string `mapstructure:"prefix"`
+		Priority          *int   `mapstructure:"priority"`
+		PollInterval      string `mapstructure:"poll_interval"`
+		DeleteFunctionARN string `mapstructure:"delete_function_arn"`
+	} `mapstructure:"batch"`
+	Inventory *struct {
+		Bucket string `mapstructure:"bucket"`
+		Prefix string `mapstructure:"prefix"`
+		MaxAge string `mapstructure:"max_age"`
+	} `mapstructure:"inventory"`
+	Audit *struct {
+		Bucket   string `mapstructure:"bucket"`
+		Prefix   string `mapstructure:"prefix"`
+		Required bool   `mapstructure:"required"`
+	} `mapstructure:"audit"`
+	Throttle *struct {
+		Timezone string `mapstructure:"timezone"`
+		Windows  []struct {
+			Days        []string `mapstructure:"days"`
+			Start       string   `mapstructure:"start"`
+			End         string   `mapstructure:"end"`
+			Concurrency int      `mapstructure:"concurrency"`
+			Bandwidth   string   `mapstructure:"bandwidth"`
+		} `mapstructure:"windows"`
+	} `mapstructure:"throttle"`
+	Expect *struct {
+		MinFiles     int    `mapstructure:"min_files"`
+		MinTotalSize string `mapstructure:"min_total_size"`
+	} `mapstructure:"expect"`
+	Verify *struct {
+		Wait     string `mapstructure:"wait"`
+		Interval string `mapstructure:"interval"`
+		Sample   int    `mapstructure:"sample"`
+	} `mapstructure:"verify"`
+	Attestations *struct {
+		SBOM       string `mapstructure:"sbom"`
+		Provenance string `mapstructure:"provenance"`
+	} `mapstructure:"attestations"`
+	ClientEncryption *struct {
+		KMSKeyID string `mapstructure:"kms_key_id"`
+		Key      string `mapstructure:"key"`
+	} `mapstructure:"client_encryption"`
+	Policy *struct {
+		RequireEncryption *bool    `mapstructure:"require_encryption"`
+		AllowedPrefixes   []string `mapstructure:"allowed_prefixes"`
+		ForbiddenPatterns []string `mapstructure:"forbidden_patterns"`
+		MaxObjectSize     string   `mapstructure:"max_object_size"`
+	} `mapstructure:"policy"`
+	ACL *struct {
+		Canned       string `mapstructure:"canned"`
+		WhenDisabled string `mapstructure:"when_disabled"`
+	} `mapstructure:"acl"`
+	Logging *struct {
+		Format          string `mapstructure:"format"`
+		IncludeLocation bool   `mapstructure:"include_location"`
+	} `mapstructure:"logging"`
+	ShutdownGracePeriod string         `mapstructure:"shutdown_grace_period"`
+	LocalConfig         *bool          `mapstructure:"local_config"`
+	StrictSettings      *bool          `mapstructure:"strict_settings"`
+	ExitCodes           map[string]int `mapstructure:"exit_codes"`
+	Backend             string         `mapstructure:"backend"`
+}
+
+type rawTarget struct {
+	Bucket         string `mapstructure:"bucket"`
+	Region         string `mapstructure:"region"`
+	Endpoint       string `mapstructure:"endpoint"`
+	ForcePathStyle *bool  `mapstructure:"force_path_style"`
+	Profile        string `mapstructure:"profile"`
+	Backend        string `mapstructure:"backend"`
 	TLS            *struct {
 		SkipVerify *bool `mapstructure:"skip_verify"`
 	} `mapstructure:"tls"`
-	Credentials *struct {
-		AccessKeyID     string `mapstructure:"access_key_id"`
-		SecretAccessKey string `mapstructure:"secret_access_key"`
-		SessionToken    string `mapstructure:"session_token"`
-	} `mapstructure:"credentials"`
+	Credentials *rawCredentials `mapstructure:"credentials"`
 }
 
+// Multipart defaults mirror the AWS SDK upload manager.
+const (
+	MinPartSize            int64 = 5 * 1024 * 1024
+	DefaultPartConcurrency       = 5
+)
+
+// Checksum types select how S3 combines the part checksums of multipart uploads.
+const (
+	ChecksumTypeComposite  = "composite"
+	ChecksumTypeFullObject = "full-object"
+)
+
+// ChecksumAlgorithms lists the supported checksum_algorithm values.
+var ChecksumAlgorithms = []string{"crc32", "crc32c", "crc64nvme", "sha1", "sha256"}
+
+// DefaultSyncStateKey is the key of the sync state object below the context path.
+const DefaultSyncStateKey = ".ds-sync-state"
+
+// RollbackStateKey is the key of the record of the last rollback below the
+// context path.
+const RollbackStateKey = ".ds-rollback"
+
+// RunStateDir is the directory below the context path holding the state of
+// runs with a stable run id; see RunStateObjectKey.
+const RunStateDir = ".ds-runs"
+
+// maxRunIDLength keeps run state keys well below the S3 key length limit.
+const maxRunIDLength = 128
+
+// DefaultFailureReport is the file a failed command writes its failure report
+// to: the failed S3 requests and, for uploads, the files left out.
+const DefaultFailureReport = "ds-s3-failures.json"
+
+// DefaultSummaryMaxObjects keeps the upload summary of large runs well within
+// what hosts read from a plugin's stdout.
+const DefaultSummaryMaxObjects = 10000
+
+// DefaultSummaryFile is the file the full upload summary is written to when
+// the one on stdout is truncated.
+const DefaultSummaryFile = "ds-s3-summary.json"
+
+// DefaultProgressInterval is how often the progress checkpoint is rewritten.
+const DefaultProgressInterval = 5 * time.Second
+
+// DefaultPackMaxFileSize is the size up to which packing bundles files; the
+// request, rather than the transfer, dominates the cost of files this small.
+const DefaultPackMaxFileSize int64 = 64 << 10
+
+// DefaultPackChunkSize is the size packs are closed at.
+const DefaultPackChunkSize int64 = 64 << 20
+
+// DefaultBatchPrefix is the key prefix batch job manifests and reports are
+// written below.
+const DefaultBatchPrefix = ".ds-batch"
+
+// DefaultBatchPriority is the priority of submitted batch jobs.
+const DefaultBatchPriority = 10
+
+// DefaultBatchPollInterval is how often a submitted batch job is described
+// while waiting for it; jobs take minutes to hours.
+const DefaultBatchPollInterval = 30 * time.Second
+
+// DefaultVerifyInterval is the pause between checks for uploaded objects
+// to be visible.
+const DefaultVerifyInterval = time.Second
+
+// DefaultShutdownGracePeriod leaves a canceled command time to abort its
+// multipart uploads, well within the 30s hosts such as Kubernetes wait before
+// killing a process.
+const DefaultShutdownGracePeriod = 20 * time.Second
+
+// DefaultSnapshotPrefix is the root prefix under which snapshots are stored.
+const DefaultSnapshotPrefix = "snapshots"
+
 // LoadFromHost reads the plugin configuration from the DS host context.
 func LoadFromHost(ctx context.Context, logger hclog.Logger) (*Config, error) {
 	provider, ok := types.HostConfigFromContext(ctx)
@@ -68,14 +933,21 @@ func LoadFromHost(ctx context.Context, logger hclog.Logger) (*Config, error) {
 		return nil, fmt.Errorf("host returned empty configuration payload")
 	}
 
-	settings := resolvePluginSettings(dsCfg.Plugins.Settings)
+	settings, warnings := resolvePluginSettings(dsCfg.Plugins.Settings)
 
 	pluginCfg, err := FromSettingsMap(settings)
 	if err != nil {
 		return nil, err
 	}
+	pluginCfg.deprecations = append(warnings, pluginCfg.deprecations...)
 
 	pluginCfg.LogLevel = strings.TrimSpace(dsCfg.Logging.Level)
+	if pluginCfg.LogLevel != "" {
+		pluginCfg.setOrigin("log_level", SourceHost)
+	}
+	// The host's logging.format is not applied: DS parses the JSON lines of
+	// its plugins and renders them in that format itself, and passes lines in
+	// any other format through at the debug level only.
 
 	return pluginCfg, nil
 }
@@ -87,6 +959,28 @@ func FromSettingsMap(values map[string]interface{}) (*Config, error) {
 		Overwrite:      true,
 		ForcePathStyle: false,
 		SkipTLSVerify:  false,
+		Snapshot:       Snapshot{Prefix: DefaultSnapshotPrefix},
+		Encryption:     Encryption{Preflight: true},
+		Sync:           Sync{StateKey: DefaultSyncStateKey},
+		Replication:    Replication{RequireAll: true},
+		BuildContext:   BuildContext{Tags: true, Metadata: true},
+		SecretScan:     SecretScan{Mode: ScanModeBlock, MaxFileSize: DefaultScanMaxFileSize},
+		Antivirus:      Antivirus{Action: AntivirusActionBlock},
+		FilePolicy:     FilePolicy{Empty: FileActionUpload, Special: FileActionError},
+		LargeFiles:     LargeFiles{Action: LargeFileActionWarn},
+		IgnoreFiles:    true,
+		FailureReport:  DefaultFailureReport,
+		Summary:        Summary{MaxObjects: DefaultSummaryMaxObjects, File: DefaultSummaryFile},
+		Progress:       Progress{Interval: DefaultProgressInterval},
+		Packing:        Packing{MaxFileSize: DefaultPackMaxFileSize, ChunkSize: DefaultPackChunkSize},
+		Batch:          Batch{Prefix: DefaultBatchPrefix, Priority: DefaultBatchPriority, PollInterval: DefaultBatchPollInterval},
+		ACL:            ACL{WhenDisabled: ACLDisabledFail},
+		Logging:        Logging{Format: LogFormatJSON},
+		Verify:         Verify{Interval: DefaultVerifyInterval},
+
+		ShutdownGracePeriod: DefaultShutdownGracePeriod,
+		LocalConfig:         true,
+		Backend:             uploader.BackendS3,
 	}
 
 	if values == nil {
@@ -104,9 +998,32 @@ func FromSettingsMap(values map[string]interface{}) (*Config, error) {
 		return nil, fmt.Errorf("failed to build settings decoder: %w", err)
 	}
 
+	values, cfg.deprecations = migrateSettings(values, "")
 	if err := decoder.Decode(values); err != nil {
 		return nil, fmt.Errorf("failed to decode plugin settings: %w", err)
 	}
+	cfg.recordOrigins(values, "", SourceSettings)
+
+	environments, err := parseOverlays(values["environments"], "environments", "environments")
+	if err != nil {
+		return nil, err
+	}
+	operations, err := parseOverlays(values["operations"], "operations", "environments", "operations")
+	if err != nil {
+		return nil, err
+	}
+	if raw.StrictSettings != nil && *raw.StrictSettings {
+		unknown, err := unknownSettings(values, "")
+		if err != nil {
+			return nil, err
+		}
+		if len(unknown) > 0 {
+			return nil, fmt.Errorf("unknown settings (strict_settings is enabled): %s", strings.Join(unknown, ", "))
+		}
+	}
+	cfg.settings = values
+	cfg.environments = environments
+	cfg.operations = operations
 
 	cfg.Bucket = strings.TrimSpace(raw.Bucket)
 	cfg.Region = strings.TrimSpace(raw.Region)
@@ -118,6 +1035,15 @@ func FromSettingsMap(values map[string]interface{}) (*Config, error) {
 	if raw.Cleanup != nil {
 		cfg.Cleanup = *raw.Cleanup
 	}
+	if len(raw.CleanupTags) > 0 {
+		cfg.CleanupTags = make(map[string]string, len(raw.CleanupTags))
+		for key, value := range raw.CleanupTags {
+			if key = strings.TrimSpace(key); key == "" {
+				return nil, fmt.Errorf("cleanup_tags keys must not be empty")
+			}
+			cfg.CleanupTags[key] = strings.TrimSpace(value)
+		}
+	}
 	if raw.Overwrite != nil {
 		cfg.Overwrite = *raw.Overwrite
 	}
@@ -127,74 +1053,1264 @@ func FromSettingsMap(values map[string]interface{}) (*Config, error) {
 	if raw.TLS != nil && raw.TLS.SkipVerify != nil {
 		cfg.SkipTLSVerify = *raw.TLS.SkipVerify
 	}
+	if raw.HTTP != nil {
+		cfg.HTTP.MaxIdleConnsPerHost = raw.HTTP.MaxIdleConnsPerHost
+		if raw.HTTP.DisableHTTP2 != nil {
+			cfg.HTTP.DisableHTTP2 = *raw.HTTP.DisableHTTP2
+		}
+		if raw.HTTP.DisableKeepAlives != nil {
+			cfg.HTTP.DisableKeepAlives = *raw.HTTP.DisableKeepAlives
+		}
+		if value := strings.TrimSpace(raw.HTTP.IdleConnTimeout); value != "" {
+			timeout, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid http.idle_conn_timeout: %w", err)
+			}
+			cfg.HTTP.IdleConnTimeout = timeout
+		}
+	}
+	if raw.DNS != nil {
+		if raw.DNS.Cache != nil {
+			cfg.DNS.Cache = *raw.DNS.Cache
+		}
+		cfg.DNS.Pin = normalizeSources(raw.DNS.Pin)
+	}
+	cfg.UserAgentSuffix = strings.TrimSpace(raw.UserAgentSuffix)
+	if len(raw.RequestHeaders) > 0 {
+		cfg.RequestHeaders = make(map[string]string, len(raw.RequestHeaders))
+		for name, value := range raw.RequestHeaders {
+			cfg.RequestHeaders[http.CanonicalHeaderKey(strings.TrimSpace(name))] = strings.TrimSpace(value)
+		}
+	}
+	if backend := strings.ToLower(strings.TrimSpace(raw.Backend)); backend != "" {
+		cfg.Backend = backend
+	}
+	if len(raw.ExitCodes) > 0 {
+		cfg.ExitCodes = make(map[string]int, len(raw.ExitCodes))
+		for class, code := range raw.ExitCodes {
+			cfg.ExitCodes[strings.ToLower(strings.TrimSpace(class))] = code
+		}
+	}
+	if value := strings.TrimSpace(raw.ShutdownGracePeriod); value != "" {
+		grace, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid shutdown_grace_period: %w", err)
+		}
+		cfg.ShutdownGracePeriod = grace
+	}
+	if raw.Retry != nil {
+		cfg.Retry.MaxAttempts = raw.Retry.MaxAttempts
+		if value := strings.TrimSpace(raw.Retry.MaxBackoff); value != "" {
+			maxBackoff, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid retry.max_backoff: %w", err)
+			}
+			cfg.Retry.MaxBackoff = maxBackoff
+		}
+	}
 	if raw.Credentials != nil {
-		cfg.Credentials = Credentials{
-			AccessKeyID:     strings.TrimSpace(raw.Credentials.AccessKeyID),
-			SecretAccessKey: strings.TrimSpace(raw.Credentials.SecretAccessKey),
-			SessionToken:    strings.TrimSpace(raw.Credentials.SessionToken),
+		creds, err := raw.Credentials.credentials()
+		if err != nil {
+			return nil, err
 		}
+		cfg.Credentials = creds
 	}
 
-	return cfg, nil
-}
-
-// Validate ensures essential values are present.
-func (c *Config) Validate() error {
-	if strings.TrimSpace(c.Bucket) == "" {
-		return fmt.Errorf("bucket is required")
+	if raw.Snapshot != nil {
+		if raw.Snapshot.Enabled != nil {
+			cfg.Snapshot.Enabled = *raw.Snapshot.Enabled
+		}
+		if prefix := normalizeContextPath(raw.Snapshot.Prefix); prefix != "" {
+			cfg.Snapshot.Prefix = prefix
+		}
 	}
 
-	if c.SkipTLSVerify && strings.TrimSpace(c.Endpoint) == "" {
-		return fmt.Errorf("tls.skip_verify can only be enabled when a custom endpoint is configured")
+	if len(raw.Targets) > 0 {
+		cfg.Targets = make(map[string]Target, len(raw.Targets))
+		for name, rt := range raw.Targets {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				return nil, fmt.Errorf("target names must not be empty")
+			}
+			target := Target{
+				Bucket:         strings.TrimSpace(rt.Bucket),
+				Region:         strings.TrimSpace(rt.Region),
+				Endpoint:       strings.TrimSpace(rt.Endpoint),
+				ForcePathStyle: rt.ForcePathStyle,
+				Profile:        strings.TrimSpace(rt.Profile),
+				Backend:        strings.ToLower(strings.TrimSpace(rt.Backend)),
+			}
+			if rt.TLS != nil {
+				target.SkipTLSVerify = rt.TLS.SkipVerify
+			}
+			if rt.Credentials != nil {
+				creds, err := rt.Credentials.credentials()
+				if err != nil {
+					return nil, fmt.Errorf("targets.%s: %w", name, err)
+				}
+				target.Credentials = creds
+			}
+			cfg.Targets[name] = target
+		}
 	}
 
-	return nil
-}
-
-// Clone returns a shallow copy of the configuration.
-func (c *Config) Clone() *Config {
-	copyCfg := *c
-	copyCfg.Credentials = c.Credentials
-	if c.Sources != nil {
-		copyCfg.Sources = append([]string{}, c.Sources...)
+	if raw.Multipart != nil {
+		partSize, err := ParseByteSize(raw.Multipart.PartSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid multipart.part_size: %w", err)
+		}
+		cfg.Multipart = Multipart{PartSize: partSize, Concurrency: raw.Multipart.Concurrency}
 	}
-	return &copyCfg
-}
-
-func normalizeContextPath(value string) string {
-	trimmed := strings.TrimSpace(value)
-	return strings.Trim(trimmed, "/")
-}
-
-func normalizeSources(values []string) []string {
-	if len(values) == 0 {
-		return nil
+	cfg.Checksum.Type = strings.ToLower(strings.TrimSpace(raw.ChecksumType))
+	cfg.Checksum.Algorithm = strings.ToLower(strings.TrimSpace(raw.ChecksumAlgorithm))
+	if raw.ChecksumMetadata != nil {
+		cfg.Checksum.Metadata = *raw.ChecksumMetadata
 	}
-
-	cleaned := make([]string, 0, len(values))
-	for _, candidate := range values {
-		if trimmed := strings.TrimSpace(candidate); trimmed != "" {
-			cleaned = append(cleaned, trimmed)
+	memoryLimit, err := ParseByteSize(raw.MemoryLimit)
+	if err != nil {
+		return nil, fmt.Errorf("invalid memory_limit: %w", err)
+	}
+	cfg.MemoryLimit = memoryLimit
+	cfg.Concurrency = raw.Concurrency
+	cfg.MaxDepth = raw.MaxDepth
+	cfg.StripComponents = raw.StripComponents
+	cfg.WalkConcurrency = raw.WalkConcurrency
+	if raw.StreamPlans != nil {
+		cfg.StreamPlans = *raw.StreamPlans
+	}
+	if raw.IgnoreFiles != nil {
+		cfg.IgnoreFiles = *raw.IgnoreFiles
+	}
+	if raw.RespectGitignore != nil {
+		cfg.RespectGitignore = *raw.RespectGitignore
+	}
+	if raw.LocalConfig != nil {
+		cfg.LocalConfig = *raw.LocalConfig
+	}
+	if raw.StrictSettings != nil {
+		cfg.StrictSettings = *raw.StrictSettings
+	}
+	if raw.ExtractTar != nil {
+		cfg.ExtractTar = *raw.ExtractTar
+	}
+	if raw.Decompress != nil {
+		cfg.Decompress = *raw.Decompress
+	}
+	cfg.ManifestKey = normalizeContextPath(raw.ManifestKey)
+	cfg.SkipIfExistsKey = normalizeContextPath(raw.SkipIfExistsKey)
+	cfg.LatestKey = normalizeContextPath(raw.LatestKey)
+	cfg.DryRun = raw.DryRun
+	cfg.RunID = strings.TrimSpace(raw.RunID)
+	if report := strings.TrimSpace(raw.FailureReport); report != "" {
+		cfg.FailureReport = report
+	}
+	if raw.Summary != nil {
+		if raw.Summary.MaxObjects != nil {
+			cfg.Summary.MaxObjects = *raw.Summary.MaxObjects
+		}
+		if file := strings.TrimSpace(raw.Summary.File); file != "" {
+			cfg.Summary.File = file
 		}
 	}
-
-	if len(cleaned) == 0 {
-		return nil
+	if raw.Progress != nil {
+		cfg.Progress.File = strings.TrimSpace(raw.Progress.File)
+		if value := strings.TrimSpace(raw.Progress.Interval); value != "" {
+			interval, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid progress.interval: %w", err)
+			}
+			cfg.Progress.Interval = interval
+		}
+	}
+	if raw.Packing != nil {
+		if raw.Packing.Enabled != nil {
+			cfg.Packing.Enabled = *raw.Packing.Enabled
+		}
+		if value := strings.TrimSpace(raw.Packing.MaxFileSize); value != "" {
+			size, err := ParseByteSize(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid packing.max_file_size: %w", err)
+			}
+			cfg.Packing.MaxFileSize = size
+		}
+		if value := strings.TrimSpace(raw.Packing.ChunkSize); value != "" {
+			size, err := ParseByteSize(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid packing.chunk_size: %w", err)
+			}
+			cfg.Packing.ChunkSize = size
+		}
+	}
+	if raw.Batch != nil {
+		cfg.Batch.RoleARN = strings.TrimSpace(raw.Batch.RoleARN)
+		cfg.Batch.AccountID = strings.TrimSpace(raw.Batch.AccountID)
+		cfg.Batch.DeleteFunctionARN = strings.TrimSpace(raw.Batch.DeleteFunctionARN)
+		if prefix := strings.Trim(strings.TrimSpace(raw.Batch.Prefix), "/"); prefix != "" {
+			cfg.Batch.Prefix = prefix
+		}
+		if raw.Batch.Priority != nil {
+			cfg.Batch.Priority = *raw.Batch.Priority
+		}
+		if value := strings.TrimSpace(raw.Batch.PollInterval); value != "" {
+			interval, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid batch.poll_interval: %w", err)
+			}
+			cfg.Batch.PollInterval = interval
+		}
+	}
+	if raw.Inventory != nil {
+		cfg.Inventory.Bucket = strings.TrimSpace(raw.Inventory.Bucket)
+		cfg.Inventory.Prefix = strings.Trim(strings.TrimSpace(raw.Inventory.Prefix), "/")
+		if value := strings.TrimSpace(raw.Inventory.MaxAge); value != "" {
+			age, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid inventory.max_age: %w", err)
+			}
+			cfg.Inventory.MaxAge = age
+		}
+	}
+	if raw.Audit != nil {
+		cfg.Audit.Bucket = strings.TrimSpace(raw.Audit.Bucket)
+		cfg.Audit.Prefix = strings.Trim(strings.TrimSpace(raw.Audit.Prefix), "/")
+		cfg.Audit.Required = raw.Audit.Required
+	}
+	if raw.Expect != nil {
+		size, err := ParseByteSize(raw.Expect.MinTotalSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expect.min_total_size: %w", err)
+		}
+		cfg.Expect.MinFiles = raw.Expect.MinFiles
+		cfg.Expect.MinTotalSize = size
+	}
+	if raw.Verify != nil {
+		if value := strings.TrimSpace(raw.Verify.Wait); value != "" {
+			wait, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid verify.wait: %w", err)
+			}
+			cfg.Verify.Wait = wait
+		}
+		if value := strings.TrimSpace(raw.Verify.Interval); value != "" {
+			interval, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid verify.interval: %w", err)
+			}
+			cfg.Verify.Interval = interval
+		}
+		cfg.Verify.Sample = raw.Verify.Sample
+	}
+	if raw.Throttle != nil {
+		cfg.Throttle.Timezone = strings.TrimSpace(raw.Throttle.Timezone)
+		for i, rawWindow := range raw.Throttle.Windows {
+			days, err := parseWeekdays(rawWindow.Days)
+			if err != nil {
+				return nil, fmt.Errorf("invalid throttle.windows[%d].days: %w", i, err)
+			}
+			start, err := parseTimeOfDay(rawWindow.Start)
+			if err != nil {
+				return nil, fmt.Errorf("invalid throttle.windows[%d].start: %w", i, err)
+			}
+			end, err := parseTimeOfDay(rawWindow.End)
+			if err != nil {
+				return nil, fmt.Errorf("invalid throttle.windows[%d].end: %w", i, err)
+			}
+			bandwidth, err := ParseByteSize(rawWindow.Bandwidth)
+			if err != nil {
+				return nil, fmt.Errorf("invalid throttle.windows[%d].bandwidth: %w", i, err)
+			}
+			cfg.Throttle.Windows = append(cfg.Throttle.Windows, ThrottleWindow{
+				Days:        days,
+				Start:       start,
+				End:         end,
+				Concurrency: rawWindow.Concurrency,
+				Bandwidth:   bandwidth,
+			})
+		}
+	}
+	if raw.Sync != nil {
+		if raw.Sync.Enabled != nil {
+			cfg.Sync.Enabled = *raw.Sync.Enabled
+		}
+		if key := normalizeContextPath(raw.Sync.StateKey); key != "" {
+			cfg.Sync.StateKey = key
+		}
+		cfg.Sync.CacheDir = strings.TrimSpace(raw.Sync.CacheDir)
 	}
 
-	return cleaned
-}
-
-func resolvePluginSettings(settings map[string]map[string]interface{}) map[string]interface{} {
-	if settings == nil {
-		return nil
+	if raw.BuildContext != nil {
+		if raw.BuildContext.Enabled != nil {
+			cfg.BuildContext.Enabled = *raw.BuildContext.Enabled
+		}
+		if raw.BuildContext.Tags != nil {
+			cfg.BuildContext.Tags = *raw.BuildContext.Tags
+		}
+		if raw.BuildContext.Metadata != nil {
+			cfg.BuildContext.Metadata = *raw.BuildContext.Metadata
+		}
+		if raw.BuildContext.Git != nil {
+			cfg.BuildContext.Git = *raw.BuildContext.Git
+		}
 	}
 
-	for _, key := range []string{"s3", "ds-s3", "ds_s3"} {
-		if cfg, ok := settings[key]; ok {
-			return cfg
+	if raw.SecretScan != nil {
+		if raw.SecretScan.Enabled != nil {
+			cfg.SecretScan.Enabled = *raw.SecretScan.Enabled
+		}
+		if mode := strings.ToLower(strings.TrimSpace(raw.SecretScan.Mode)); mode != "" {
+			cfg.SecretScan.Mode = mode
+		}
+		cfg.SecretScan.Patterns = raw.SecretScan.Patterns
+		cfg.SecretScan.EntropyThreshold = raw.SecretScan.EntropyThreshold
+		if strings.TrimSpace(raw.SecretScan.MaxFileSize) != "" {
+			maxFileSize, err := ParseByteSize(raw.SecretScan.MaxFileSize)
+			if err != nil {
+				return nil, fmt.Errorf("invalid secret_scan.max_file_size: %w", err)
+			}
+			cfg.SecretScan.MaxFileSize = maxFileSize
 		}
 	}
 
+	if raw.Antivirus != nil {
+		if raw.Antivirus.Enabled != nil {
+			cfg.Antivirus.Enabled = *raw.Antivirus.Enabled
+		}
+		cfg.Antivirus.Clamd = strings.TrimSpace(raw.Antivirus.Clamd)
+		cfg.Antivirus.Command = normalizeSources(raw.Antivirus.Command)
+		if action := strings.ToLower(strings.TrimSpace(raw.Antivirus.Action)); action != "" {
+			cfg.Antivirus.Action = action
+		}
+	}
+
+	if raw.Encryption != nil {
+		cfg.Encryption.Mode = NormalizeEncryptionMode(raw.Encryption.Mode)
+		cfg.Encryption.KMSKeyID = strings.TrimSpace(raw.Encryption.KMSKeyID)
+		if raw.Encryption.BucketKey != nil {
+			cfg.Encryption.BucketKey = *raw.Encryption.BucketKey
+		}
+		if raw.Encryption.Preflight != nil {
+			cfg.Encryption.Preflight = *raw.Encryption.Preflight
+		}
+		cfg.Encryption.PreflightStrict = raw.Encryption.PreflightStrict
+		for _, rule := range raw.Encryption.KeyRules {
+			cfg.Encryption.KeyRules = append(cfg.Encryption.KeyRules, KMSKeyRule{
+				Pattern:  strings.TrimSpace(rule.Pattern),
+				KMSKeyID: strings.TrimSpace(rule.KMSKeyID),
+			})
+		}
+	}
+	if raw.FilePolicy != nil {
+		if action := strings.ToLower(strings.TrimSpace(raw.FilePolicy.Empty)); action != "" {
+			cfg.FilePolicy.Empty = action
+		}
+		if action := strings.ToLower(strings.TrimSpace(raw.FilePolicy.Special)); action != "" {
+			cfg.FilePolicy.Special = action
+		}
+	}
+	if raw.LargeFiles != nil {
+		threshold, err := ParseByteSize(raw.LargeFiles.Threshold)
+		if err != nil {
+			return nil, fmt.Errorf("invalid large_files.threshold: %w", err)
+		}
+		cfg.LargeFiles.Threshold = threshold
+		if action := strings.ToLower(strings.TrimSpace(raw.LargeFiles.Action)); action != "" {
+			cfg.LargeFiles.Action = action
+		}
+	}
+	if raw.Limits != nil {
+		size, err := ParseByteSize(raw.Limits.MaxTotalSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid limits.max_total_size: %w", err)
+		}
+		cfg.Limits.MaxFiles = raw.Limits.MaxFiles
+		cfg.Limits.MaxTotalSize = size
+	}
+	if raw.Attestations != nil {
+		cfg.Attestations.SBOM = strings.TrimSpace(raw.Attestations.SBOM)
+		cfg.Attestations.Provenance = strings.TrimSpace(raw.Attestations.Provenance)
+	}
+	if raw.ClientEncryption != nil {
+		cfg.ClientEncryption.KMSKeyID = strings.TrimSpace(raw.ClientEncryption.KMSKeyID)
+		cfg.ClientEncryption.Key = strings.TrimSpace(raw.ClientEncryption.Key)
+	}
+	if raw.Policy != nil {
+		if raw.Policy.RequireEncryption != nil {
+			cfg.Policy.RequireEncryption = *raw.Policy.RequireEncryption
+		}
+		for _, prefix := range raw.Policy.AllowedPrefixes {
+			cfg.Policy.AllowedPrefixes = append(cfg.Policy.AllowedPrefixes, strings.Trim(strings.TrimSpace(prefix), "/"))
+		}
+		for _, pattern := range raw.Policy.ForbiddenPatterns {
+			cfg.Policy.ForbiddenPatterns = append(cfg.Policy.ForbiddenPatterns, strings.TrimSpace(pattern))
+		}
+		size, err := ParseByteSize(raw.Policy.MaxObjectSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy.max_object_size: %w", err)
+		}
+		cfg.Policy.MaxObjectSize = size
+	}
+	if raw.ACL != nil {
+		cfg.ACL.Canned = strings.ToLower(strings.TrimSpace(raw.ACL.Canned))
+		if action := strings.ToLower(strings.TrimSpace(raw.ACL.WhenDisabled)); action != "" {
+			cfg.ACL.WhenDisabled = action
+		}
+	}
+	if raw.Logging != nil {
+		if format := strings.ToLower(strings.TrimSpace(raw.Logging.Format)); format != "" {
+			cfg.Logging.Format = format
+		}
+		cfg.Logging.IncludeLocation = raw.Logging.IncludeLocation
+	}
+
+	if raw.Replication != nil {
+		cfg.Replication.Targets = normalizeSources(raw.Replication.Targets)
+		if raw.Replication.RequireAll != nil {
+			cfg.Replication.RequireAll = *raw.Replication.RequireAll
+		}
+	}
+
+	cfg.applyBackendDefaults()
+	return cfg, nil
+}
+
+// ForTarget returns a copy of the configuration with the named target layered on top.
+// An empty name returns an unmodified copy.
+func (c *Config) ForTarget(name string) (*Config, error) {
+	resolved := c.Clone()
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return resolved, nil
+	}
+
+	target, ok := c.Targets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown target %q", name)
+	}
+
+	if target.Backend != "" && target.Backend != c.Backend {
+		resolved.Backend = target.Backend
+		resolved.Endpoint, resolved.Region, resolved.DNS.Pin = "", "", nil
+	}
+	if target.Bucket != "" {
+		resolved.Bucket = target.Bucket
+	}
+	if target.Region != "" {
+		resolved.Region = target.Region
+	}
+	if target.Endpoint != "" {
+		if target.Endpoint != c.Endpoint {
+			// Pinned addresses belong to the base endpoint.
+			resolved.DNS.Pin = nil
+		}
+		resolved.Endpoint = target.Endpoint
+	}
+	if target.ForcePathStyle != nil {
+		resolved.ForcePathStyle = *target.ForcePathStyle
+	}
+	if target.SkipTLSVerify != nil {
+		resolved.SkipTLSVerify = *target.SkipTLSVerify
+	}
+	if target.Profile != "" {
+		resolved.Profile = target.Profile
+	}
+	if target.Credentials.AccessKeyID != "" || target.Credentials.SecretAccessKey != "" {
+		resolved.Credentials = target.Credentials
+	} else {
+		if target.Credentials.Source != "" {
+			// Another source drops the base keys and role.
+			resolved.Credentials = Credentials{Source: target.Credentials.Source}
+		}
+		if target.Credentials.RoleARN != "" {
+			// A target role alone is assumed with the base credentials.
+			resolved.Credentials.RoleARN = target.Credentials.RoleARN
+			resolved.Credentials.RoleSessionName = target.Credentials.RoleSessionName
+			resolved.Credentials.ExternalID = target.Credentials.ExternalID
+			resolved.Credentials.RoleDuration = target.Credentials.RoleDuration
+			resolved.Credentials.MFASerial = target.Credentials.MFASerial
+		}
+	}
+	resolved.applyBackendDefaults()
+
+	return resolved, nil
+}
+
+// SameConnection reports whether two configurations reach storage through the
+// same endpoint with the same credentials, allowing server-side copies between them.
+func SameConnection(a, b *Config) bool {
+	return a.Endpoint == b.Endpoint &&
+		a.Profile == b.Profile &&
+		a.Credentials == b.Credentials &&
+		a.SkipTLSVerify == b.SkipTLSVerify
+}
+
+// Validate ensures essential values are present.
+func (c *Config) Validate() error {
+	if strings.TrimSpace(c.Bucket) == "" {
+		return fmt.Errorf("bucket is required")
+	}
+	if arn.IsARN(c.Bucket) {
+		if err := validateBucketARN(c.Bucket); err != nil {
+			return err
+		}
+		if c.ForcePathStyle {
+			return fmt.Errorf("force_path_style cannot be used with an access point ARN bucket")
+		}
+		if c.IsMultiRegionAccessPoint() && c.Endpoint != "" {
+			return fmt.Errorf("endpoint cannot be used with a multi-region access point, which is reached through the S3 global endpoint")
+		}
+	}
+	if c.IsDirectoryBucket() {
+		if err := c.validateDirectoryBucket(); err != nil {
+			return err
+		}
+	} else if !arn.IsARN(c.Bucket) {
+		if err := c.validateBucketName(); err != nil {
+			return err
+		}
+	}
+	if err := uploader.ValidateKey(c.ContextPath); err != nil {
+		return fmt.Errorf("context_path: %w", err)
+	}
+	for _, source := range c.Sources {
+		if err := uploader.ValidateSource(source); err != nil {
+			return fmt.Errorf("sources: %w", err)
+		}
+	}
+	if c.IsGCS() {
+		if err := c.validateGCS(); err != nil {
+			return err
+		}
+	}
+
+	if err := c.validateEndpoint(); err != nil {
+		return err
+	}
+	if err := c.validateRegion(); err != nil {
+		return err
+	}
+
+	if c.SkipTLSVerify && strings.TrimSpace(c.Endpoint) == "" {
+		return fmt.Errorf("tls.skip_verify can only be enabled when a custom endpoint is configured")
+	}
+
+	for _, name := range c.Replication.Targets {
+		if _, ok := c.Targets[name]; !ok {
+			return fmt.Errorf("replication target %q is not defined under targets", name)
+		}
+	}
+
+	if c.DNS.Enabled() && strings.TrimSpace(c.Endpoint) == "" {
+		return fmt.Errorf("dns.cache and dns.pin require a custom endpoint")
+	}
+	for _, address := range c.DNS.Pin {
+		if net.ParseIP(address) == nil {
+			return fmt.Errorf("dns.pin entry %q is not an IP address", address)
+		}
+	}
+
+	for name := range c.RequestHeaders {
+		if err := validateRequestHeader(name); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Credentials.validate(); err != nil {
+		return err
+	}
+	if c.Credentials.Source == awsauth.SourceProfile && c.Profile == "" {
+		return fmt.Errorf("credentials.source profile requires profile")
+	}
+
+	if c.Retry.MaxAttempts < 0 {
+		return fmt.Errorf("retry.max_attempts must not be negative")
+	}
+	if c.Retry.MaxBackoff < 0 {
+		return fmt.Errorf("retry.max_backoff must not be negative")
+	}
+	if c.ShutdownGracePeriod < 0 {
+		return fmt.Errorf("shutdown_grace_period must not be negative")
+	}
+	if c.Backend != "" && !slices.Contains(uploader.Backends(), c.Backend) {
+		return fmt.Errorf("backend: unknown backend %q (expected one of %s)", c.Backend, strings.Join(uploader.Backends(), ", "))
+	}
+	for class, code := range c.ExitCodes {
+		if !slices.Contains(diagnostics.Classes, class) {
+			return fmt.Errorf("exit_codes: unknown failure class %q (expected one of %s)", class, strings.Join(diagnostics.Classes, ", "))
+		}
+		// 0 is success, and codes above 125 are taken by shells and signals.
+		if code < 1 || code > 125 {
+			return fmt.Errorf("exit_codes.%s must be between 1 and 125", class)
+		}
+	}
+
+	if c.HTTP.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("http.max_idle_conns_per_host must not be negative")
+	}
+	if c.HTTP.IdleConnTimeout < 0 {
+		return fmt.Errorf("http.idle_conn_timeout must not be negative")
+	}
+
+	if c.Multipart.PartSize != 0 && c.Multipart.PartSize < MinPartSize {
+		return fmt.Errorf("multipart.part_size must be at least %d bytes", MinPartSize)
+	}
+	if c.Concurrency < 0 {
+		return fmt.Errorf("concurrency must not be negative")
+	}
+	if c.RunID != "" {
+		if err := ValidateRunID(c.RunID); err != nil {
+			return err
+		}
+	}
+	if c.SkipIfExistsKey != "" && c.SkipIfExistsKey == c.ManifestKey {
+		return fmt.Errorf("skip_if_exists_key must differ from manifest_key, which every upload writes")
+	}
+	if c.LatestKey != "" && c.ContextPath != "" && strings.HasPrefix(c.LatestKey+"/", c.ContextPath+"/") {
+		return fmt.Errorf("latest_key %s must not be below the context path, which changes with every release", c.LatestKey)
+	}
+	if c.WalkConcurrency < 0 {
+		return fmt.Errorf("walk_concurrency must not be negative")
+	}
+	if c.MaxDepth < 0 {
+		return fmt.Errorf("max_depth must not be negative")
+	}
+	if c.StripComponents < 0 {
+		return fmt.Errorf("strip_components must not be negative")
+	}
+	if c.Multipart.Concurrency < 0 {
+		return fmt.Errorf("multipart.concurrency must not be negative")
+	}
+	switch c.Checksum.Type {
+	case "", ChecksumTypeComposite, ChecksumTypeFullObject:
+	default:
+		return fmt.Errorf("checksum_type must be %q or %q", ChecksumTypeComposite, ChecksumTypeFullObject)
+	}
+	if c.Checksum.Algorithm != "" && !slices.Contains(ChecksumAlgorithms, c.Checksum.Algorithm) {
+		return fmt.Errorf("checksum_algorithm must be one of %s", strings.Join(ChecksumAlgorithms, ", "))
+	}
+	if c.Checksum.Type == ChecksumTypeFullObject && strings.HasPrefix(c.Checksum.Algorithm, "sha") {
+		return fmt.Errorf("checksum_type %q requires a CRC checksum_algorithm", ChecksumTypeFullObject)
+	}
+	if c.Checksum.Type == ChecksumTypeComposite && c.Checksum.Algorithm == "crc64nvme" {
+		return fmt.Errorf("checksum_algorithm crc64nvme only supports checksum_type %q", ChecksumTypeFullObject)
+	}
+	if c.MemoryLimit != 0 && c.MemoryLimit < c.EffectivePartSize() {
+		return fmt.Errorf("memory_limit must be at least one part (%d bytes)", c.EffectivePartSize())
+	}
+
+	switch c.SecretScan.Mode {
+	case "", ScanModeBlock, ScanModeWarn:
+	default:
+		return fmt.Errorf("secret_scan.mode must be %q or %q", ScanModeBlock, ScanModeWarn)
+	}
+	if c.SecretScan.EntropyThreshold < 0 || c.SecretScan.EntropyThreshold > 8 {
+		return fmt.Errorf("secret_scan.entropy_threshold must be between 0 and 8 bits per character")
+	}
+	for name, pattern := range c.SecretScan.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid secret_scan.patterns.%s: %w", name, err)
+		}
+	}
+
+	switch c.FilePolicy.Empty {
+	case "", FileActionUpload, FileActionSkip, FileActionError:
+	default:
+		return fmt.Errorf("file_policy.empty must be %q, %q or %q", FileActionUpload, FileActionSkip, FileActionError)
+	}
+	switch c.FilePolicy.Special {
+	case "", FileActionError, FileActionSkip, FileActionUploadEmpty:
+	default:
+		return fmt.Errorf("file_policy.special must be %q, %q or %q", FileActionError, FileActionSkip, FileActionUploadEmpty)
+	}
+
+	switch c.LargeFiles.Action {
+	case "", LargeFileActionWarn, LargeFileActionRequireMultipart, LargeFileActionError:
+	default:
+		return fmt.Errorf("large_files.action must be %q, %q or %q", LargeFileActionWarn, LargeFileActionRequireMultipart, LargeFileActionError)
+	}
+
+	if c.Limits.MaxFiles < 0 {
+		return fmt.Errorf("limits.max_files must not be negative")
+	}
+	if c.Verify.Wait < 0 || c.Verify.Sample < 0 {
+		return fmt.Errorf("verify.wait and verify.sample must not be negative")
+	}
+	if c.Verify.Wait > 0 && c.Verify.Interval <= 0 {
+		return fmt.Errorf("verify.interval must be positive")
+	}
+	if c.Expect.MinFiles < 0 {
+		return fmt.Errorf("expect.min_files must not be negative")
+	}
+	if c.Limits.MaxFiles > 0 && c.Expect.MinFiles > c.Limits.MaxFiles {
+		return fmt.Errorf("expect.min_files must not be above limits.max_files")
+	}
+	if c.Limits.MaxTotalSize > 0 && c.Expect.MinTotalSize > c.Limits.MaxTotalSize {
+		return fmt.Errorf("expect.min_total_size must not be above limits.max_total_size")
+	}
+	if c.Summary.MaxObjects < 0 {
+		return fmt.Errorf("summary.max_objects must not be negative")
+	}
+	if c.Progress.Interval < 0 {
+		return fmt.Errorf("progress.interval must not be negative")
+	}
+	if c.Batch.Priority < 0 {
+		return fmt.Errorf("batch.priority must not be negative")
+	}
+	if c.Batch.PollInterval < 0 {
+		return fmt.Errorf("batch.poll_interval must not be negative")
+	}
+	if c.Inventory.MaxAge < 0 {
+		return fmt.Errorf("inventory.max_age must not be negative")
+	}
+	if c.Inventory.Bucket != "" && !c.Inventory.Enabled() {
+		return fmt.Errorf("inventory.bucket requires inventory.prefix")
+	}
+	if (c.Audit.Bucket != "" || c.Audit.Required) && !c.Audit.Enabled() {
+		return fmt.Errorf("audit.bucket and audit.required require audit.prefix")
+	}
+	for _, prefix := range c.Policy.AllowedPrefixes {
+		if prefix == "" {
+			return fmt.Errorf("policy.allowed_prefixes entries must not be empty, which would allow the whole bucket")
+		}
+	}
+	if _, err := c.Throttle.Location(); err != nil {
+		return err
+	}
+	for i, window := range c.Throttle.Windows {
+		if window.Concurrency < 0 || window.Bandwidth < 0 {
+			return fmt.Errorf("throttle.windows[%d]: concurrency and bandwidth must not be negative", i)
+		}
+		if window.Concurrency == 0 && window.Bandwidth == 0 {
+			return fmt.Errorf("throttle.windows[%d] must set concurrency or bandwidth", i)
+		}
+		if window.Start == window.End || window.Start >= 24*time.Hour {
+			return fmt.Errorf("throttle.windows[%d] must start before 24:00 and end at another time", i)
+		}
+	}
+	for i, pattern := range c.Policy.ForbiddenPatterns {
+		if err := uploader.ValidateForbiddenPattern(pattern); err != nil {
+			return fmt.Errorf("policy.forbidden_patterns[%d]: %w", i, err)
+		}
+	}
+	if c.Audit.Enabled() && (c.Audit.Bucket == "" || c.Audit.Bucket == c.Bucket) && c.ContextPath != "" && strings.HasPrefix(c.Audit.Prefix+"/", c.ContextPath+"/") {
+		return fmt.Errorf("audit.prefix %s must not be below the context path, where cleanups would delete the records", c.Audit.Prefix)
+	}
+	if c.Audit.Enabled() {
+		if err := c.Policy.CheckPrefix(c.Audit.Prefix); err != nil {
+			return fmt.Errorf("audit.prefix: %w", err)
+		}
+	}
+	if c.Packing.Enabled {
+		if c.Packing.MaxFileSize <= 0 || c.Packing.ChunkSize <= 0 {
+			return fmt.Errorf("packing.max_file_size and packing.chunk_size must be positive")
+		}
+		if c.Packing.ChunkSize < c.Packing.MaxFileSize {
+			return fmt.Errorf("packing.chunk_size must not be smaller than packing.max_file_size")
+		}
+	}
+
+	switch c.Antivirus.Action {
+	case "", AntivirusActionBlock, AntivirusActionQuarantine:
+	default:
+		return fmt.Errorf("antivirus.action must be %q or %q", AntivirusActionBlock, AntivirusActionQuarantine)
+	}
+	if c.Antivirus.Enabled && (c.Antivirus.Clamd == "") == (len(c.Antivirus.Command) == 0) {
+		return fmt.Errorf("antivirus requires exactly one of antivirus.clamd or antivirus.command")
+	}
+
+	if c.ACL.Canned != "" && !slices.Contains(CannedACLs, c.ACL.Canned) {
+		return fmt.Errorf("acl.canned must be one of %s", strings.Join(CannedACLs, ", "))
+	}
+	if c.Logging.Format != "" && !slices.Contains(LogFormats, c.Logging.Format) {
+		return fmt.Errorf("logging.format must be one of %s", strings.Join(LogFormats, ", "))
+	}
+	if c.ACL.WhenDisabled != "" && c.ACL.WhenDisabled != ACLDisabledFail && c.ACL.WhenDisabled != ACLDisabledDrop {
+		return fmt.Errorf("acl.when_disabled must be %q or %q", ACLDisabledFail, ACLDisabledDrop)
+	}
+	if c.Encryption.Mode != "" && !slices.Contains(EncryptionModes, c.Encryption.Mode) {
+		return fmt.Errorf("encryption.mode must be one of %s", strings.Join(EncryptionModes, ", "))
+	}
+	if c.Encryption.KMSKeyID != "" && !strings.HasPrefix(c.Encryption.Mode, "aws:kms") {
+		return fmt.Errorf("encryption.kms_key_id requires encryption.mode aws:kms or aws:kms:dsse")
+	}
+	if c.Encryption.BucketKey && c.Encryption.Mode != "aws:kms" {
+		return fmt.Errorf("encryption.bucket_key requires encryption.mode aws:kms")
+	}
+	if len(c.Encryption.KeyRules) > 0 && !strings.HasPrefix(c.Encryption.Mode, "aws:kms") {
+		return fmt.Errorf("encryption.key_rules requires encryption.mode aws:kms or aws:kms:dsse")
+	}
+	for i, rule := range c.Encryption.KeyRules {
+		if err := uploader.ValidateKMSKeyPattern(rule.Pattern); err != nil {
+			return fmt.Errorf("encryption.key_rules[%d]: %w", i, err)
+		}
+		if rule.KMSKeyID == "" {
+			return fmt.Errorf("encryption.key_rules[%d]: kms_key_id is required", i)
+		}
+	}
+	if c.ClientEncryption.KMSKeyID != "" && c.ClientEncryption.Key != "" {
+		return fmt.Errorf("client_encryption accepts only one of kms_key_id and key")
+	}
+	if c.ClientEncryption.Key != "" {
+		if _, err := c.ClientEncryption.DecodedKey(); err != nil {
+			return err
+		}
+	}
+
+	// Tag-filtered cleanup leaves other objects in place for overwrite to
+	// protect; a full cleanup leaves nothing.
+	if c.Cleanup && !c.Overwrite && len(c.CleanupTags) == 0 {
+		return fmt.Errorf("cleanup removes every object beneath the context path before uploading, so overwrite: false has nothing to protect; disable one of them or set cleanup_tags")
+	}
+
+	if c.Sync.Enabled && c.Cleanup {
+		return fmt.Errorf("sync.enabled cannot be combined with cleanup, which removes the objects a sync skips")
+	}
+	if c.Packing.Enabled && c.Sync.Enabled {
+		return fmt.Errorf("packing.enabled cannot be combined with sync.enabled, as packs are rebuilt on every upload")
+	}
+	if c.Packing.Enabled && c.StreamPlans {
+		return fmt.Errorf("packing.enabled cannot be combined with stream_plans, as packing needs every file planned first")
+	}
+	if (c.Expect.MinFiles > 0 || c.Expect.MinTotalSize > 0) && c.StreamPlans && c.Cleanup {
+		return fmt.Errorf("expect.min_files and expect.min_total_size cannot be combined with stream_plans and cleanup, as streamed sources are only counted after cleanup emptied the context path")
+	}
+
+	if c.Snapshot.Enabled && c.Cleanup && strings.TrimSpace(c.ContextPath) == "" {
+		return fmt.Errorf("snapshot.enabled requires a context path when cleanup is enabled, otherwise cleanup would remove the snapshot")
+	}
+	if c.Snapshot.Enabled && c.ContextPath != "" && strings.HasPrefix(c.ContextPath+"/", c.Snapshot.Prefix+"/") {
+		return fmt.Errorf("context path %s must not be below snapshot.prefix %s, whose objects snapshots never copy", c.ContextPath, c.Snapshot.Prefix)
+	}
+
+	return nil
+}
+
+// IsAccessPoint reports whether the bucket is addressed through an access
+// point ARN rather than by name.
+func (c *Config) IsAccessPoint() bool {
+	return arn.IsARN(c.Bucket)
+}
+
+// IsMultiRegionAccessPoint reports whether the bucket is addressed through
+// the ARN of a Multi-Region Access Point, recognised by the .mrap suffix of
+// its alias and the missing region.
+func (c *Config) IsMultiRegionAccessPoint() bool {
+	parsed, err := arn.Parse(c.Bucket)
+	return err == nil && parsed.Region == "" && strings.HasSuffix(parsed.Resource, MultiRegionAccessPointSuffix)
+}
+
+// IsDirectoryBucket reports whether the bucket is an S3 Express One Zone
+// directory bucket, recognised by its --x-s3 name suffix.
+func (c *Config) IsDirectoryBucket() bool {
+	return strings.HasSuffix(c.Bucket, DirectoryBucketSuffix)
+}
+
+// validateDirectoryBucket rejects settings that directory buckets do not
+// support: path-style addressing, object tags and dual-layer KMS encryption.
+func (c *Config) validateDirectoryBucket() error {
+	if !directoryBucketPattern.MatchString(c.Bucket) {
+		return fmt.Errorf("bucket: directory bucket %q must be named <name>--<zone-id>%s", c.Bucket, DirectoryBucketSuffix)
+	}
+	if c.ForcePathStyle {
+		return fmt.Errorf("force_path_style cannot be used with a directory bucket")
+	}
+	if len(c.CleanupTags) > 0 {
+		return fmt.Errorf("cleanup_tags cannot be used with a directory bucket, which does not support object tags")
+	}
+	if c.ACL.Canned != "" {
+		return fmt.Errorf("acl.canned cannot be used with a directory bucket, which does not support ACLs")
+	}
+	if c.Encryption.Mode == "aws:kms:dsse" {
+		return fmt.Errorf("encryption.mode aws:kms:dsse is not supported by directory buckets")
+	}
+	return nil
+}
+
+// validateBucketARN accepts S3 access point and Object Lambda access point
+// ARNs, the only ARN forms S3 accepts in place of a bucket name.
+// validate checks that the static keys fit the source and the role settings
+// the limits of STS AssumeRole.
+func (c Credentials) validate() error {
+	static := c.AccessKeyID != "" || c.SecretAccessKey != ""
+	switch c.Source {
+	case "", awsauth.SourceAuto:
+	case awsauth.SourceStatic:
+		if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+			return fmt.Errorf("credentials.source static requires credentials.access_key_id and credentials.secret_access_key")
+		}
+	default:
+		if !slices.Contains(awsauth.Sources, c.Source) {
+			return fmt.Errorf("credentials.source: unknown source %q (expected one of %s)", c.Source, strings.Join(awsauth.Sources, ", "))
+		}
+		if static {
+			return fmt.Errorf("credentials.access_key_id and credentials.secret_access_key cannot be used with credentials.source %s", c.Source)
+		}
+	}
+	if c.RoleARN == "" {
+		if c.RoleSessionName != "" || c.ExternalID != "" || c.RoleDuration != 0 || c.MFASerial != "" {
+			return fmt.Errorf("credentials.role_session_name, external_id, role_duration and mfa_serial require credentials.role_arn")
+		}
+		return nil
+	}
+	parsed, err := arn.Parse(c.RoleARN)
+	if err != nil || parsed.Service != "iam" || !strings.HasPrefix(parsed.Resource, "role/") {
+		return fmt.Errorf("credentials.role_arn %q is not an IAM role ARN (arn:aws:iam::<account>:role/<name>)", c.RoleARN)
+	}
+	if name := c.RoleSessionName; name != "" && (len(name) < 2 || len(name) > 64) {
+		return fmt.Errorf("credentials.role_session_name must be 2 to 64 characters long")
+	}
+	if c.RoleDuration != 0 && (c.RoleDuration < MinRoleDuration || c.RoleDuration > MaxRoleDuration) {
+		return fmt.Errorf("credentials.role_duration must be between %s and %s", MinRoleDuration, MaxRoleDuration)
+	}
+	return nil
+}
+
+func validateBucketARN(value string) error {
+	parsed, err := arn.Parse(value)
+	if err != nil {
+		return fmt.Errorf("bucket: invalid ARN %q: %w", value, err)
+	}
+	switch parsed.Service {
+	case "s3", "s3-object-lambda":
+	default:
+		return fmt.Errorf("bucket: ARN service %q is not an S3 access point", parsed.Service)
+	}
+	name, ok := strings.CutPrefix(parsed.Resource, "accesspoint/")
+	if !ok {
+		name, ok = strings.CutPrefix(parsed.Resource, "accesspoint:")
+	}
+	if !ok || name == "" || strings.ContainsAny(name, "/:") {
+		return fmt.Errorf("bucket: ARN %q must name an access point (accesspoint/<name>)", value)
+	}
+	if parsed.AccountID == "" {
+		return fmt.Errorf("bucket: access point ARN %q must include an account ID", value)
+	}
+	// Multi-Region Access Points span regions, so their ARNs name none.
+	if strings.HasSuffix(name, MultiRegionAccessPointSuffix) {
+		if parsed.Service != "s3" || parsed.Region != "" {
+			return fmt.Errorf("bucket: multi-region access point ARN %q must have the form arn:aws:s3::<account>:accesspoint/<alias>%s", value, MultiRegionAccessPointSuffix)
+		}
+		return nil
+	}
+	if parsed.Region == "" {
+		return fmt.Errorf("bucket: access point ARN %q must include a region and account ID", value)
+	}
+	return nil
+}
+
+// validateBucketName checks a bucket name against the S3 naming rules, or for
+// custom endpoints and other backends against the characters their names
+// share, naming the rule that is broken. Buckets created in us-east-1 before
+// March 2018 may still follow the legacy rules of that region, which allow
+// uppercase letters, '_' and up to 255 characters.
+func (c *Config) validateBucketName() error {
+	name := c.Bucket
+	if c.Endpoint != "" || c.IsGCS() {
+		if !customBucketNamePattern.MatchString(name) {
+			return fmt.Errorf("bucket: %q must be 3 to 255 letters, digits, '.', '-' or '_', starting and ending with a letter or digit", name)
+		}
+		return nil
+	}
+	// Access point aliases (-s3alias, --ol-s3) stand in for bucket names,
+	// but Multi-Region Access Points are only reachable by ARN.
+	if strings.HasSuffix(name, MultiRegionAccessPointSuffix) {
+		return fmt.Errorf("bucket: %q is a multi-region access point alias; use its ARN (arn:aws:s3::<account>:accesspoint/%s)", name, name)
+	}
+	err := s3BucketNameError(name)
+	if err != nil && c.Region == "us-east-1" && customBucketNamePattern.MatchString(name) {
+		return nil
+	}
+	return err
+}
+
+// s3BucketNameError checks name against the current S3 bucket naming rules.
+func s3BucketNameError(name string) error {
+	switch {
+	case len(name) < 3 || len(name) > 63:
+		return fmt.Errorf("bucket: %q must be between 3 and 63 characters long", name)
+	case strings.ToLower(name) != name:
+		return fmt.Errorf("bucket: %q must not contain uppercase letters; S3 bucket names are lowercase", name)
+	case strings.Contains(name, "_"):
+		return fmt.Errorf("bucket: %q must not contain '_'; use '-' instead", name)
+	case !bucketNamePattern.MatchString(name):
+		return fmt.Errorf("bucket: %q may only contain lowercase letters, digits, '.' and '-', and must start and end with a letter or digit", name)
+	case strings.Contains(name, ".."):
+		return fmt.Errorf("bucket: %q must not contain two adjacent periods", name)
+	case net.ParseIP(name) != nil:
+		return fmt.Errorf("bucket: %q must not be formatted as an IP address", name)
+	}
+	for _, prefix := range []string{"xn--", "sthree-", "amzn-s3-demo-"} {
+		if strings.HasPrefix(name, prefix) {
+			return fmt.Errorf("bucket: %q must not start with %s, which S3 reserves", name, prefix)
+		}
+	}
+	return nil
+}
+
+// validateEndpoint checks that a custom endpoint is an absolute http or https
+// URL, which the SDK requires of a base endpoint.
+func (c *Config) validateEndpoint() error {
+	if c.Endpoint == "" {
+		return nil
+	}
+	endpoint, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return fmt.Errorf("endpoint %q is not a valid URL: %w", c.Endpoint, err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return fmt.Errorf("endpoint %q must start with https:// or http://", c.Endpoint)
+	}
+	if endpoint.Hostname() == "" {
+		return fmt.Errorf("endpoint %q has no host name", c.Endpoint)
+	}
+	if endpoint.RawQuery != "" || endpoint.Fragment != "" || endpoint.User != nil {
+		return fmt.Errorf("endpoint %q must not contain credentials, a query or a fragment", c.Endpoint)
+	}
+	return nil
+}
+
+// validateRegion checks the region against the AWS region format, or for
+// custom endpoints and other backends against what a signing scope accepts.
+// An availability zone in place of its region is called out as such.
+func (c *Config) validateRegion() error {
+	if c.Region == "" {
+		return nil
+	}
+	if c.Endpoint != "" || c.IsGCS() {
+		if !customRegionPattern.MatchString(c.Region) {
+			return fmt.Errorf("region %q may only contain letters, digits, '-' and '_'", c.Region)
+		}
+		return nil
+	}
+	if awsRegionPattern.MatchString(c.Region) {
+		return nil
+	}
+	if zone := strings.TrimRight(c.Region, "abcdefghijklmnopqrstuvwxyz"); zone != c.Region && awsRegionPattern.MatchString(zone) {
+		return fmt.Errorf("region %q is an availability zone; use its region %q", c.Region, zone)
+	}
+	if lower := strings.ToLower(strings.ReplaceAll(c.Region, "_", "-")); awsRegionPattern.MatchString(lower) {
+		return fmt.Errorf("region %q must be written %q", c.Region, lower)
+	}
+	return fmt.Errorf("region %q is not an AWS region code such as eu-west-1", c.Region)
+}
+
+// validateRequestHeader rejects header names that are malformed or that the
+// SDK computes itself, since overriding them breaks signing or transfers.
+func validateRequestHeader(name string) error {
+	if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+		return fmt.Errorf("request_headers: invalid header name %q", name)
+	}
+	lower := strings.ToLower(name)
+	switch lower {
+	case "authorization", "host", "content-length", "content-md5", "content-type", "user-agent", "expect":
+		return fmt.Errorf("request_headers: %s is set by the plugin and cannot be overridden", name)
+	}
+	if strings.HasPrefix(lower, "x-amz-") {
+		return fmt.Errorf("request_headers: %s is reserved for S3 and cannot be set", name)
+	}
+	return nil
+}
+
+// ExitCode returns the exit code of a command that failed with class.
+func (c *Config) ExitCode(class string) int {
+	if code, ok := c.ExitCodes[class]; ok {
+		return code
+	}
+	return 1
+}
+
+// ManifestObjectKey returns the key the upload manifest is stored at, below
+// the context path, or an empty string when manifests are not stored.
+func (c *Config) ManifestObjectKey() string {
+	return c.contextKey(c.ManifestKey)
+}
+
+// MarkerObjectKey returns the key of the completion marker below the context
+// path, or an empty string when uploads do not check for one.
+func (c *Config) MarkerObjectKey() string {
+	return c.contextKey(c.SkipIfExistsKey)
+}
+
+// SyncStateObjectKey returns the key of the sync state object below the
+// context path.
+func (c *Config) SyncStateObjectKey() string {
+	return c.contextKey(c.Sync.StateKey)
+}
+
+// RollbackStateObjectKey returns the key of the rollback record below the
+// context path.
+func (c *Config) RollbackStateObjectKey() string {
+	return c.contextKey(RollbackStateKey)
+}
+
+// RunStateObjectKey returns the key of the state object of the run id below
+// the context path.
+func (c *Config) RunStateObjectKey(id string) string {
+	return c.contextKey(RunStateDir + "/" + id + ".json")
+}
+
+// ValidateRunID checks that id can be used in object keys and metadata: up to
+// 128 letters, digits, dots, dashes and underscores.
+func ValidateRunID(id string) error {
+	if id == "" || len(id) > maxRunIDLength {
+		return fmt.Errorf("run_id must be 1 to %d characters long", maxRunIDLength)
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+		default:
+			return fmt.Errorf("run_id %q may only contain letters, digits, '.', '-' and '_'", id)
+		}
+	}
+	if id == "." || id == ".." {
+		return fmt.Errorf("run_id %q is not a valid name", id)
+	}
 	return nil
 }
+
+// AttestationObjectKey returns the key the attestation at source is
+// published under.
+func (c *Config) AttestationObjectKey(source string) string {
+	return c.contextKey(AttestationDir + "/" + filepath.Base(source))
+}
+
+func (c *Config) contextKey(name string) string {
+	if name == "" || c.ContextPath == "" {
+		return name
+	}
+	return c.ContextPath + "/" + name
+}
+
+// NormalizeEncryptionMode maps an encryption mode to its canonical S3 spelling,
+// accepting any letter case. Unknown modes are returned trimmed for Validate
+// to reject.
+func NormalizeEncryptionMode(value string) string {
+	value = strings.TrimSpace(value)
+	for _, mode := range EncryptionModes {
+		if strings.EqualFold(value, mode) {
+			return mode
+		}
+	}
+	return value
+}
+
+// EffectivePartSize returns the configured multipart part size or the SDK default.
+func (c *Config) EffectivePartSize() int64 {
+	if c.Multipart.PartSize > 0 {
+		return c.Multipart.PartSize
+	}
+	return MinPartSize
+}
+
+// EffectiveConcurrency returns the per-upload part concurrency, reduced so that
+// a single upload's part buffers fit within the memory limit.
+func (c *Config) EffectiveConcurrency() int {
+	concurrency := c.Multipart.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultPartConcurrency
+	}
+	if c.MemoryLimit > 0 {
+		// The upload manager holds one spare part buffer beyond its concurrency.
+		if fit := int(c.MemoryLimit/c.EffectivePartSize()) - 1; fit < concurrency {
+			concurrency = fit
+		}
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return concurrency
+}
+
+// Clone returns a shallow copy of the configuration.
+func (c *Config) Clone() *Config {
+	copyCfg := *c
+	copyCfg.Credentials = c.Credentials
+	if c.Sources != nil {
+		copyCfg.Sources = append([]string{}, c.Sources...)
+	}
+	if c.Targets != nil {
+		copyCfg.Targets = make(map[string]Target, len(c.Targets))
+		for name, target := range c.Targets {
+			copyCfg.Targets[name] = target
+		}
+	}
+	if c.Encryption.KeyRules != nil {
+		copyCfg.Encryption.KeyRules = append([]KMSKeyRule{}, c.Encryption.KeyRules...)
+	}
+	if c.Replication.Targets != nil {
+		copyCfg.Replication.Targets = append([]string{}, c.Replication.Targets...)
+	}
+	if c.Policy.AllowedPrefixes != nil {
+		copyCfg.Policy.AllowedPrefixes = append([]string{}, c.Policy.AllowedPrefixes...)
+	}
+	if c.Throttle.Windows != nil {
+		copyCfg.Throttle.Windows = make([]ThrottleWindow, len(c.Throttle.Windows))
+		for i, window := range c.Throttle.Windows {
+			window.Days = append([]time.Weekday(nil), window.Days...)
+			copyCfg.Throttle.Windows[i] = window
+		}
+	}
+	if c.Policy.ForbiddenPatterns != nil {
+		copyCfg.Policy.ForbiddenPatterns = append([]string{}, c.Policy.ForbiddenPatterns...)
+	}
+	if c.CleanupTags != nil {
+		copyCfg.CleanupTags = make(map[string]string, len(c.CleanupTags))
+		for key, value := range c.CleanupTags {
+			copyCfg.CleanupTags[key] = value
+		}
+	}
+	if c.RequestHeaders != nil {
+		copyCfg.RequestHeaders = make(map[string]string, len(c.RequestHeaders))
+		for name, value := range c.RequestHeaders {
+			copyCfg.RequestHeaders[name] = value
+		}
+	}
+	if c.ExitCodes != nil {
+		copyCfg.ExitCodes = make(map[string]int, len(c.ExitCodes))
+		for class, code := range c.ExitCodes {
+			copyCfg.ExitCodes[class] = code
+		}
+	}
+	if c.DNS.Pin != nil {
+		copyCfg.DNS.Pin = append([]string{}, c.DNS.Pin...)
+	}
+	if c.Antivirus.Command != nil {
+		copyCfg.Antivirus.Command = append([]string{}, c.Antivirus.Command...)
+	}
+	if c.SecretScan.Patterns != nil {
+		copyCfg.SecretScan.Patterns = make(map[string]string, len(c.SecretScan.Patterns))
+		for name, pattern := range c.SecretScan.Patterns {
+			copyCfg.SecretScan.Patterns[name] = pattern
+		}
+	}
+	if c.origins != nil {
+		copyCfg.origins = make(map[string]string, len(c.origins))
+		for key, source := range c.origins {
+			copyCfg.origins[key] = source
+		}
+	}
+	return &copyCfg
+}
+
+func normalizeContextPath(value string) string {
+	trimmed := strings.TrimSpace(value)
+	return strings.Trim(trimmed, "/")
+}
+
+func normalizeSources(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+
+	cleaned := make([]string, 0, len(values))
+	for _, candidate := range values {
+		if trimmed := strings.TrimSpace(candidate); trimmed != "" {
+			cleaned = append(cleaned, trimmed)
+		}
+	}
+
+	if len(cleaned) == 0 {
+		return nil
+	}
+
+	return cleaned
+}
@@ -1,8 +1,17 @@
 package config
 
 import (
+	"cmp"
 	"context"
+	"encoding/base64"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/delivery-station/ds/pkg/types"
 )
@@ -41,6 +50,9 @@ func TestLoadFromHost_Defaults(t *testing.T) {
 	if len(cfg.Sources) != 0 {
 		t.Errorf("expected no default sources, got %v", cfg.Sources)
 	}
+	if cfg.Snapshot.Enabled || cfg.Snapshot.Prefix != DefaultSnapshotPrefix {
+		t.Errorf("unexpected snapshot defaults: %+v", cfg.Snapshot)
+	}
 }
 
 func TestLoadFromHost_WithSettings(t *testing.T) {
@@ -125,4 +137,2126 @@ func TestConfigValidate(t *testing.T) {
 	if err := cfg.Validate(); err != nil {
 		t.Fatalf("expected validation success, got %v", err)
 	}
+
+	cfg = &Config{Bucket: "bucket", Cleanup: true, Overwrite: true, Snapshot: Snapshot{Enabled: true, Prefix: "snapshots"}}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error when snapshotting before a bucket-wide cleanup")
+	}
+
+	cfg = &Config{Bucket: "bucket", ContextPath: "snapshots/app", Snapshot: Snapshot{Enabled: true, Prefix: "snapshots"}}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for a context path below the snapshot prefix")
+	}
+	cfg.ContextPath = "snapshots-app"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected a context path beside the snapshot prefix to validate, got %v", err)
+	}
+}
+
+func TestForTargetLayersOverBase(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket":   "staging",
+		"region":   "us-east-1",
+		"endpoint": "https://minio.internal",
+		"targets": map[string]interface{}{
+			"prod": map[string]interface{}{
+				"bucket":   "production",
+				"endpoint": "https://s3.amazonaws.com",
+				"credentials": map[string]interface{}{
+					"access_key_id":     "id",
+					"secret_access_key": "secret",
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+
+	prod, err := cfg.ForTarget("prod")
+	if err != nil {
+		t.Fatalf("ForTarget returned error: %v", err)
+	}
+	if prod.Bucket != "production" || prod.Region != "us-east-1" || prod.Endpoint != "https://s3.amazonaws.com" {
+		t.Errorf("unexpected target config: %+v", prod)
+	}
+	if SameConnection(cfg, prod) {
+		t.Error("expected different endpoints to require streaming")
+	}
+
+	base, err := cfg.ForTarget("")
+	if err != nil || !SameConnection(cfg, base) {
+		t.Errorf("expected empty target to return base config, got %v", err)
+	}
+
+	if _, err := cfg.ForTarget("missing"); err == nil {
+		t.Error("expected error for unknown target")
+	}
+}
+
+func TestReplicationTargetsMustExist(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "primary",
+		"targets": map[string]interface{}{
+			"mirror": map[string]interface{}{"endpoint": "https://minio.internal"},
+		},
+		"replication": map[string]interface{}{
+			"targets":     []interface{}{"mirror"},
+			"require_all": false,
+		},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if len(cfg.Replication.Targets) != 1 || cfg.Replication.RequireAll {
+		t.Fatalf("unexpected replication config: %+v", cfg.Replication)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+
+	cfg.Replication.Targets = append(cfg.Replication.Targets, "unknown")
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for undefined replication target")
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	cases := map[string]int64{
+		"":       0,
+		"1024":   1024,
+		"64MiB":  64 << 20,
+		"5MB":    5000000,
+		"2g":     2 << 30,
+		"1.5KiB": 1536,
+		// Beyond the 53 bits a float holds exactly.
+		"9007199254740993":    9007199254740993,
+		"9223372036854775807": math.MaxInt64,
+		"8388607TiB":          8388607 << 40,
+	}
+	for input, want := range cases {
+		got, err := ParseByteSize(input)
+		if err != nil {
+			t.Errorf("ParseByteSize(%q) returned error: %v", input, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseByteSize(%q) = %d, want %d", input, got, want)
+		}
+	}
+
+	for _, input := range []string{"lots", "-1", "NaN"} {
+		if _, err := ParseByteSize(input); err == nil {
+			t.Errorf("expected error for invalid size %q", input)
+		}
+	}
+	for _, input := range []string{"9223372036854775808", "8388608TiB", "9.3e18", "1e30KiB"} {
+		if _, err := ParseByteSize(input); err == nil || !strings.Contains(err.Error(), "too large") {
+			t.Errorf("expected %q to overflow, got %v", input, err)
+		}
+	}
+}
+
+func TestFormatByteSize(t *testing.T) {
+	cases := map[int64]string{
+		512:                     "512B",
+		5 << 20:                 "5MiB",
+		3 << 29:                 "1.5GiB",
+		MaxObjectSize:           "5TiB",
+		MaxObjectSize/10000 + 1: "524.3MiB",
+	}
+	for input, want := range cases {
+		if got := FormatByteSize(input); got != want {
+			t.Errorf("FormatByteSize(%d) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestLargeFiles(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "bucket",
+		"large_files": map[string]interface{}{
+			"threshold": "10GiB",
+			"action":    "Require_Multipart",
+		},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if cfg.LargeFiles.Threshold != 10<<30 || cfg.LargeFiles.Action != LargeFileActionRequireMultipart {
+		t.Fatalf("unexpected large_files config: %+v", cfg.LargeFiles)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+
+	cfg.LargeFiles.Action = "ignore"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for unknown large_files.action")
+	}
+
+	if _, err := FromSettingsMap(map[string]interface{}{
+		"bucket":      "bucket",
+		"large_files": map[string]interface{}{"threshold": "huge"},
+	}); err == nil {
+		t.Fatal("expected error for invalid large_files.threshold")
+	}
+}
+
+func TestLimits(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "bucket",
+		"limits": map[string]interface{}{
+			"max_files":      1000,
+			"max_total_size": "50GiB",
+		},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if cfg.Limits.MaxFiles != 1000 || cfg.Limits.MaxTotalSize != 50<<30 {
+		t.Fatalf("unexpected limits config: %+v", cfg.Limits)
+	}
+
+	cfg.Limits.MaxFiles = -1
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for negative limits.max_files")
+	}
+}
+
+func TestRunID(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket":       "bucket",
+		"context_path": "releases/v1",
+		"run_id":       " pipeline-812.2 ",
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+	if got := cfg.RunStateObjectKey(cfg.RunID); got != "releases/v1/.ds-runs/pipeline-812.2.json" {
+		t.Errorf("unexpected run state key %q", got)
+	}
+
+	for _, id := range []string{"a/b", "..", "run id", strings.Repeat("x", 129)} {
+		if err := ValidateRunID(id); err == nil {
+			t.Errorf("expected run id %q to be rejected", id)
+		}
+	}
+}
+
+func TestFailureReport(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{"bucket": "bucket"})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if cfg.FailureReport != DefaultFailureReport {
+		t.Errorf("expected default failure report, got %q", cfg.FailureReport)
+	}
+
+	cfg, err = FromSettingsMap(map[string]interface{}{"bucket": "bucket", "failure_report": " out/failed.json "})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if cfg.FailureReport != "out/failed.json" {
+		t.Errorf("unexpected failure report %q", cfg.FailureReport)
+	}
+}
+
+func TestMemoryLimitReducesConcurrency(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "bucket",
+		"multipart": map[string]interface{}{
+			"part_size":   "16MiB",
+			"concurrency": 10,
+		},
+		"memory_limit": "64MiB",
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+	if got := cfg.EffectiveConcurrency(); got != 3 {
+		t.Errorf("expected concurrency reduced to 3, got %d", got)
+	}
+
+	cfg.Multipart.PartSize = 1024
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for part size below the S3 minimum")
+	}
+}
+
+func TestDescribeRedactsSecretsAndReportsSources(t *testing.T) {
+	ctx := types.WithHostConfigProvider(context.Background(), &stubHostConfigProvider{
+		config: &types.Config{
+			Logging: types.LoggingConfig{Level: "debug"},
+			Plugins: types.PluginsConfig{
+				Settings: map[string]map[string]interface{}{
+					"s3": {
+						"bucket": "my-bucket",
+						"credentials": map[string]interface{}{
+							"access_key_id":     "abc",
+							"secret_access_key": "xyz",
+						},
+					},
+				},
+			},
+		},
+	})
+	cfg, err := LoadFromHost(ctx, nil)
+	if err != nil {
+		t.Fatalf("LoadFromHost returned error: %v", err)
+	}
+
+	overridden := cfg.Clone()
+	overridden.Region = "eu-west-1"
+	settings := MarkOverrides(cfg.Describe(), overridden.Describe(), SourceFlag)
+
+	byKey := make(map[string]Setting, len(settings))
+	for _, s := range settings {
+		byKey[s.Key] = s
+	}
+
+	want := map[string]Setting{
+		"bucket":                        {Key: "bucket", Value: "my-bucket", Source: SourceSettings},
+		"region":                        {Key: "region", Value: "eu-west-1", Source: SourceFlag},
+		"overwrite":                     {Key: "overwrite", Value: true, Source: SourceDefault},
+		"log_level":                     {Key: "log_level", Value: "debug", Source: SourceHost},
+		"credentials.secret_access_key": {Key: "credentials.secret_access_key", Value: Redacted, Source: SourceSettings},
+		"credentials.session_token":     {Key: "credentials.session_token", Value: "", Source: SourceDefault},
+	}
+	for key, expected := range want {
+		if got := byKey[key]; got != expected {
+			t.Errorf("setting %s = %+v, want %+v", key, got, expected)
+		}
+	}
+}
+
+func TestForEnvironmentMergesOverlay(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket":   "artifacts",
+		"endpoint": "https://minio.internal",
+		"multipart": map[string]interface{}{
+			"part_size":   "8MiB",
+			"concurrency": 4,
+		},
+		"environments": map[string]interface{}{
+			"prod": map[interface{}]interface{}{
+				"bucket": "artifacts-prod",
+				"multipart": map[string]interface{}{
+					"part_size": "64MiB",
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if names := cfg.EnvironmentNames(); len(names) != 1 || names[0] != "prod" {
+		t.Fatalf("unexpected environments: %v", names)
+	}
+
+	prod, err := cfg.ForEnvironment("prod")
+	if err != nil {
+		t.Fatalf("ForEnvironment returned error: %v", err)
+	}
+	if prod.Bucket != "artifacts-prod" || prod.Endpoint != "https://minio.internal" {
+		t.Errorf("unexpected environment config: %+v", prod)
+	}
+	if prod.Multipart.PartSize != 64<<20 || prod.Multipart.Concurrency != 4 {
+		t.Errorf("expected nested settings to deep-merge, got %+v", prod.Multipart)
+	}
+	if cfg.Bucket != "artifacts" {
+		t.Errorf("expected base config to stay untouched, got %s", cfg.Bucket)
+	}
+
+	for _, s := range prod.Describe() {
+		if s.Key == "bucket" && s.Source != "environment:prod" {
+			t.Errorf("expected bucket attributed to the overlay, got %s", s.Source)
+		}
+		if s.Key == "endpoint" && s.Source != SourceSettings {
+			t.Errorf("expected endpoint attributed to base settings, got %s", s.Source)
+		}
+	}
+
+	if _, err := cfg.ForEnvironment("missing"); err == nil {
+		t.Error("expected error for unknown environment")
+	}
+}
+
+func TestForOperationAppliesDefaults(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "artifacts",
+		"operations": map[string]interface{}{
+			"upload": map[string]interface{}{
+				"cleanup": true,
+				"sources": []interface{}{"./dist"},
+			},
+		},
+		"environments": map[string]interface{}{
+			"prod": map[string]interface{}{
+				"operations": map[string]interface{}{
+					"upload": map[string]interface{}{"overwrite": false},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+
+	upload, err := cfg.ForOperation("upload")
+	if err != nil {
+		t.Fatalf("ForOperation returned error: %v", err)
+	}
+	if !upload.Cleanup || len(upload.Sources) != 1 || !upload.Overwrite {
+		t.Errorf("unexpected upload defaults: %+v", upload)
+	}
+	if cfg.Cleanup {
+		t.Error("expected base config to stay untouched")
+	}
+
+	snapshot, err := cfg.ForOperation("snapshot")
+	if err != nil || snapshot.Cleanup {
+		t.Errorf("expected operations without defaults to keep base settings, got %+v (%v)", snapshot, err)
+	}
+
+	prod, err := cfg.ForEnvironment("prod")
+	if err != nil {
+		t.Fatalf("ForEnvironment returned error: %v", err)
+	}
+	prodUpload, err := prod.ForOperation("upload")
+	if err != nil {
+		t.Fatalf("ForOperation returned error: %v", err)
+	}
+	if !prodUpload.Cleanup || prodUpload.Overwrite {
+		t.Errorf("expected environment operation defaults to merge, got %+v", prodUpload)
+	}
+	for _, s := range prodUpload.Describe() {
+		if s.Key == "environment" && (s.Value != "prod" || s.Source != "environment:prod") {
+			t.Errorf("expected environment to survive operation defaults, got %+v", s)
+		}
+		if s.Key == "cleanup" && s.Source != "operation:upload" {
+			t.Errorf("expected cleanup attributed to operation defaults, got %s", s.Source)
+		}
+	}
+
+	if _, err := FromSettingsMap(map[string]interface{}{
+		"operations": map[string]interface{}{"upload": "cleanup"},
+	}); err == nil {
+		t.Error("expected error for malformed operation defaults")
+	}
+}
+
+func TestSecretScanSettings(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "artifacts",
+		"secret_scan": map[string]interface{}{
+			"enabled":       true,
+			"mode":          "WARN",
+			"patterns":      map[string]interface{}{"internal-token": "itk_[0-9a-f]{32}"},
+			"max_file_size": "1MiB",
+		},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if !cfg.SecretScan.Enabled || cfg.SecretScan.Mode != ScanModeWarn || cfg.SecretScan.MaxFileSize != 1<<20 {
+		t.Errorf("unexpected secret scan config: %+v", cfg.SecretScan)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+
+	cfg.SecretScan.Patterns["broken"] = "("
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+	cfg.SecretScan.Patterns = nil
+	cfg.SecretScan.Mode = "ignore"
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func TestAntivirusRequiresOneScanner(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "artifacts",
+		"antivirus": map[string]interface{}{
+			"enabled": true,
+			"clamd":   "tcp://clamav:3310",
+			"action":  "Quarantine",
+		},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if cfg.Antivirus.Action != AntivirusActionQuarantine {
+		t.Errorf("expected quarantine action, got %s", cfg.Antivirus.Action)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+
+	cfg.Antivirus.Command = []string{"clamscan"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error when both clamd and command are set")
+	}
+	cfg.Antivirus.Clamd, cfg.Antivirus.Command = "", nil
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error when no scanner is configured")
+	}
+}
+
+func TestChecksumSettings(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket":             "artifacts",
+		"checksum_type":      "Full-Object",
+		"checksum_algorithm": "CRC64NVME",
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if cfg.Checksum.Type != ChecksumTypeFullObject || cfg.Checksum.Algorithm != "crc64nvme" {
+		t.Fatalf("unexpected checksum config: %+v", cfg.Checksum)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+
+	cfg.Checksum.Algorithm = "sha256"
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for full-object checksums with a SHA algorithm")
+	}
+	cfg.Checksum = Checksum{Type: ChecksumTypeComposite, Algorithm: "crc64nvme"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for composite CRC64NVME checksums")
+	}
+	cfg.Checksum = Checksum{Algorithm: "md5"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for unknown algorithm")
+	}
+}
+
+func TestEncryptionSettings(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "artifacts",
+		"encryption": map[string]interface{}{
+			"mode":       "AWS:KMS",
+			"kms_key_id": "alias/artifacts",
+		},
+		"policy": map[string]interface{}{"require_encryption": true},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if cfg.Encryption.Mode != "aws:kms" || cfg.Encryption.KMSKeyID != "alias/artifacts" || !cfg.Policy.RequireEncryption {
+		t.Fatalf("unexpected encryption config: %+v %+v", cfg.Encryption, cfg.Policy)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+
+	cfg.Encryption.Mode = "AES256"
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for a KMS key without a KMS mode")
+	}
+	cfg.Encryption = Encryption{Mode: "rot13"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for unknown encryption mode")
+	}
+}
+
+func TestHTTPSettings(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "artifacts",
+		"http": map[string]interface{}{
+			"max_idle_conns_per_host": 64,
+			"disable_http2":           true,
+			"idle_conn_timeout":       "30s",
+		},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	want := HTTP{MaxIdleConnsPerHost: 64, DisableHTTP2: true, IdleConnTimeout: 30 * time.Second}
+	if cfg.HTTP != want {
+		t.Fatalf("expected %+v, got %+v", want, cfg.HTTP)
+	}
+
+	if _, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "artifacts",
+		"http":   map[string]interface{}{"idle_conn_timeout": "soon"},
+	}); err == nil {
+		t.Error("expected error for invalid idle_conn_timeout")
+	}
+}
+
+func TestRetrySettings(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "artifacts",
+		"retry":  map[string]interface{}{"max_attempts": 8, "max_backoff": "1m"},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if cfg.Retry != (Retry{MaxAttempts: 8, MaxBackoff: time.Minute}) {
+		t.Fatalf("unexpected retry config: %+v", cfg.Retry)
+	}
+
+	cfg.Retry.MaxAttempts = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for negative max_attempts")
+	}
+}
+
+func TestLocalFile(t *testing.T) {
+	base, err := FromSettingsMap(map[string]interface{}{
+		"bucket":          "artifacts",
+		"context_path":    "shared",
+		"request_headers": map[string]interface{}{"x-team": "platform"},
+		"environments":    map[string]interface{}{"prod": map[string]interface{}{"bucket": "artifacts-prod"}},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, LocalFileName)
+	if cfg, applied, err := base.WithLocalFile(path); err != nil || applied || cfg != base {
+		t.Fatalf("expected a missing file to be ignored, got %v, %v", applied, err)
+	}
+
+	local := "context_path: repos/app\nrequest_headers:\n  x-repo: app\nenvironments:\n  prod:\n    context_path: releases/app\n"
+	if err := os.WriteFile(path, []byte(local), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, applied, err := base.WithLocalFile(path)
+	if err != nil || !applied {
+		t.Fatalf("WithLocalFile returned %v, %v", applied, err)
+	}
+	if cfg.Bucket != "artifacts" || cfg.ContextPath != "repos/app" {
+		t.Errorf("unexpected target s3://%s/%s", cfg.Bucket, cfg.ContextPath)
+	}
+	if cfg.RequestHeaders["X-Team"] != "platform" || cfg.RequestHeaders["X-Repo"] != "app" {
+		t.Errorf("expected request headers to be merged, got %v", cfg.RequestHeaders)
+	}
+	for _, s := range cfg.Describe() {
+		if s.Key == "context_path" && s.Source != SourceLocal {
+			t.Errorf("expected context_path attributed to the local file, got %s", s.Source)
+		}
+	}
+
+	prod, err := cfg.ForEnvironment("prod")
+	if err != nil {
+		t.Fatalf("ForEnvironment returned error: %v", err)
+	}
+	if prod.Bucket != "artifacts-prod" || prod.ContextPath != "releases/app" {
+		t.Errorf("unexpected prod target s3://%s/%s", prod.Bucket, prod.ContextPath)
+	}
+
+	disabled, err := FromSettingsMap(map[string]interface{}{"bucket": "artifacts", "local_config": false})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if _, applied, err := disabled.WithLocalFile(path); err != nil || applied {
+		t.Errorf("expected local_config: false to ignore the file, got %v, %v", applied, err)
+	}
+
+	if err := os.WriteFile(path, []byte("local_config: true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := base.WithLocalFile(path); err == nil {
+		t.Error("expected an error for local_config in the local file")
+	}
+
+	for local, key := range map[string]string{
+		"bucket: elsewhere\n":                                            "bucket",
+		"endpoint: https://s3.example.com\n":                             "endpoint",
+		"credentials:\n  role_arn: arn:aws:iam::1:role/x\n":              "credentials.role_arn",
+		"assume_role:\n  mfa_serial: arn:aws:iam::1:mfa/x\n":             "credentials.mfa_serial",
+		"secret_scan:\n  enabled: false\n":                               "secret_scan.enabled",
+		"antivirus:\n  enabled: false\n":                                 "antivirus.enabled",
+		"replication:\n  targets: [mirror]\n":                            "replication.targets",
+		"targets:\n  mirror:\n    bucket: elsewhere\n":                   "targets.mirror.bucket",
+		"environments:\n  prod:\n    endpoint: https://s3.example.com\n": "environments.prod.endpoint",
+		"operations:\n  upload:\n    bucket: elsewhere\n":                "operations.upload.bucket",
+	} {
+		if err := os.WriteFile(path, []byte(local), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := base.WithLocalFile(path); err == nil || !strings.Contains(err.Error(), "must not define "+key) {
+			t.Errorf("expected the local file to be refused defining %s, got %v", key, err)
+		}
+	}
+}
+
+func TestLocalFileCannotLiftRequireEncryption(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "artifacts",
+		"policy": map[string]interface{}{"require_encryption": true},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), LocalFileName)
+	for local, key := range map[string]string{
+		"policy:\n  require_encryption: false\n":                                 "policy.require_encryption",
+		"operations:\n  upload:\n    policy:\n      require_encryption: false\n": "operations.upload.policy.require_encryption",
+		"environments:\n  prod:\n    policy:\n      require_encryption: false\n": "environments.prod.policy.require_encryption",
+	} {
+		if err := os.WriteFile(path, []byte(local), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := cfg.WithLocalFile(path); err == nil || !strings.Contains(err.Error(), "must not define "+key) {
+			t.Errorf("expected the local file to be refused defining %s, got %v", key, err)
+		}
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket":     "artifacts",
+		"exit_codes": map[string]interface{}{"Partial": 2, "auth": "4"},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+	if cfg.ExitCode("partial") != 2 || cfg.ExitCode("auth") != 4 || cfg.ExitCode("throttled") != 1 {
+		t.Errorf("unexpected exit codes %v", cfg.ExitCodes)
+	}
+
+	for _, codes := range []map[string]interface{}{{"flaky": 2}, {"auth": 0}, {"auth": 130}} {
+		cfg, err := FromSettingsMap(map[string]interface{}{"bucket": "artifacts", "exit_codes": codes})
+		if err != nil {
+			t.Fatalf("FromSettingsMap returned error: %v", err)
+		}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected exit_codes %v to be rejected", codes)
+		}
+	}
+}
+
+func TestBackendSetting(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{"bucket": "artifacts"})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if cfg.Backend != "s3" {
+		t.Errorf("expected the s3 backend by default, got %q", cfg.Backend)
+	}
+
+	cfg, err = FromSettingsMap(map[string]interface{}{"bucket": "artifacts", "backend": " GCS "})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if err := cfg.Validate(); err != nil || cfg.Backend != "gcs" {
+		t.Errorf("expected the gcs backend, got %q, %v", cfg.Backend, err)
+	}
+
+	cfg, err = FromSettingsMap(map[string]interface{}{"bucket": "artifacts", "backend": "azure-gateway", "endpoint": "https://s3proxy.internal"})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if err := cfg.Validate(); err != nil || !cfg.WeakETags() {
+		t.Errorf("expected the gateway backend with weak ETags, got %v", err)
+	}
+
+	cfg, err = FromSettingsMap(map[string]interface{}{"bucket": "artifacts", "backend": "swift"})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an unknown backend to be rejected")
+	}
+}
+
+func TestGCSProfile(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket":  "artifacts",
+		"backend": "gcs",
+		"targets": map[string]interface{}{
+			"aws":    map[string]interface{}{"bucket": "artifacts-aws", "backend": "s3", "region": "eu-west-1"},
+			"mirror": map[string]interface{}{"bucket": "artifacts-mirror"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+	if cfg.Endpoint != GCSEndpoint || cfg.Region != GCSRegion || cfg.ObjectTags() {
+		t.Errorf("unexpected gcs profile %q, %q, tags %t", cfg.Endpoint, cfg.Region, cfg.ObjectTags())
+	}
+
+	awsTarget, err := cfg.ForTarget("aws")
+	if err != nil {
+		t.Fatalf("ForTarget returned error: %v", err)
+	}
+	if awsTarget.IsGCS() || awsTarget.Endpoint != "" || awsTarget.Region != "eu-west-1" || !awsTarget.ObjectTags() {
+		t.Errorf("expected the aws target to leave cloud storage, got %q, %q, %q", awsTarget.Backend, awsTarget.Endpoint, awsTarget.Region)
+	}
+	mirror, err := cfg.ForTarget("mirror")
+	if err != nil {
+		t.Fatalf("ForTarget returned error: %v", err)
+	}
+	if !mirror.IsGCS() || mirror.Endpoint != GCSEndpoint {
+		t.Errorf("expected the mirror to stay on cloud storage, got %q, %q", mirror.Backend, mirror.Endpoint)
+	}
+
+	for _, settings := range []map[string]interface{}{
+		{"cleanup_tags": map[string]interface{}{"ephemeral": "true"}},
+		{"encryption": map[string]interface{}{"mode": "aws:kms"}},
+		{"checksum_algorithm": "crc64nvme"},
+		{"policy": map[string]interface{}{"require_encryption": true}},
+	} {
+		settings["bucket"], settings["backend"] = "artifacts", "gcs"
+		cfg, err := FromSettingsMap(settings)
+		if err != nil {
+			t.Fatalf("FromSettingsMap returned error: %v", err)
+		}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected %v to be rejected with the gcs backend", settings)
+		}
+	}
+}
+
+func TestKMSKeyRules(t *testing.T) {
+	settings := func(mode string, rules ...interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"bucket":     "artifacts",
+			"encryption": map[string]interface{}{"mode": mode, "kms_key_id": "alias/artifacts", "key_rules": rules},
+		}
+	}
+	restricted := map[string]interface{}{"pattern": " builds/*/restricted/ ", "kms_key_id": "alias/restricted"}
+
+	cfg, err := FromSettingsMap(settings("aws:kms", restricted))
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+	if len(cfg.Encryption.KeyRules) != 1 || cfg.Encryption.KeyRules[0] != (KMSKeyRule{Pattern: "builds/*/restricted/", KMSKeyID: "alias/restricted"}) {
+		t.Errorf("unexpected key rules %+v", cfg.Encryption.KeyRules)
+	}
+
+	for name, invalid := range map[string]map[string]interface{}{
+		"mode":    settings("AES256", restricted),
+		"pattern": settings("aws:kms", map[string]interface{}{"pattern": "builds/[a-", "kms_key_id": "alias/restricted"}),
+		"key":     settings("aws:kms", map[string]interface{}{"pattern": "builds/"}),
+	} {
+		cfg, err := FromSettingsMap(invalid)
+		if err != nil {
+			t.Fatalf("%s: FromSettingsMap returned error: %v", name, err)
+		}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: expected the key rules to be rejected", name)
+		}
+	}
+}
+
+func TestEncryptionBucketKey(t *testing.T) {
+	settings := func(mode string) map[string]interface{} {
+		return map[string]interface{}{
+			"bucket":     "artifacts",
+			"encryption": map[string]interface{}{"mode": mode, "bucket_key": true},
+		}
+	}
+
+	cfg, err := FromSettingsMap(settings("aws:kms"))
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+	if !cfg.Encryption.BucketKey {
+		t.Error("expected the bucket key to be enabled")
+	}
+
+	for _, mode := range []string{"aws:kms:dsse", "AES256", ""} {
+		cfg, err := FromSettingsMap(settings(mode))
+		if err != nil {
+			t.Fatalf("%q: FromSettingsMap returned error: %v", mode, err)
+		}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%q: expected bucket_key to be rejected", mode)
+		}
+	}
+}
+
+func TestEncryptionPreflight(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{"bucket": "artifacts"})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if !cfg.Encryption.Preflight || cfg.Encryption.PreflightStrict {
+		t.Error("expected the KMS preflight to be enabled and to warn about denied keys by default")
+	}
+
+	cfg, err = FromSettingsMap(map[string]interface{}{
+		"bucket":     "artifacts",
+		"encryption": map[string]interface{}{"mode": "aws:kms", "preflight": false},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if cfg.Encryption.Preflight {
+		t.Error("expected the KMS preflight to be disabled")
+	}
+
+	cfg, err = FromSettingsMap(map[string]interface{}{
+		"bucket":     "artifacts",
+		"encryption": map[string]interface{}{"mode": "aws:kms", "preflight_strict": true},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if !cfg.Encryption.PreflightStrict {
+		t.Error("expected denied keys to fail the strict KMS preflight")
+	}
+}
+
+func TestAssumeRoleCredentials(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "artifacts",
+		"credentials": map[string]interface{}{
+			"access_key_id":     "AKIDSTATIC",
+			"secret_access_key": "secret",
+			"role_arn":          " arn:aws:iam::123456789012:role/publisher ",
+			"role_duration":     "2h",
+			"mfa_serial":        "arn:aws:iam::123456789012:mfa/operator",
+		},
+		"targets": map[string]interface{}{
+			"prod": map[string]interface{}{
+				"credentials": map[string]interface{}{"role_arn": "arn:aws:iam::210987654321:role/prod-publisher", "external_id": "ci"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+	if cfg.Credentials.RoleARN != "arn:aws:iam::123456789012:role/publisher" || cfg.Credentials.RoleDuration != 2*time.Hour || cfg.Credentials.MFASerial != "arn:aws:iam::123456789012:mfa/operator" {
+		t.Errorf("unexpected credentials %+v", cfg.Credentials)
+	}
+
+	prod, err := cfg.ForTarget("prod")
+	if err != nil {
+		t.Fatalf("ForTarget returned error: %v", err)
+	}
+	want := Credentials{AccessKeyID: "AKIDSTATIC", SecretAccessKey: "secret", RoleARN: "arn:aws:iam::210987654321:role/prod-publisher", ExternalID: "ci"}
+	// The target role replaces the base role, including its MFA device.
+	if prod.Credentials != want {
+		t.Errorf("expected the target role to be assumed with the base keys, got %+v", prod.Credentials)
+	}
+
+	for name, creds := range map[string]Credentials{
+		"arn":      {RoleARN: "arn:aws:s3:::artifacts"},
+		"duration": {RoleARN: "arn:aws:iam::123456789012:role/publisher", RoleDuration: 5 * time.Minute},
+		"session":  {RoleARN: "arn:aws:iam::123456789012:role/publisher", RoleSessionName: "x"},
+		"no role":  {ExternalID: "ci"},
+		"mfa":      {MFASerial: "arn:aws:iam::123456789012:mfa/operator"},
+	} {
+		invalid := cfg.Clone()
+		invalid.Credentials = creds
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("%s: expected the credentials to be rejected", name)
+		}
+	}
+
+	if _, err := FromSettingsMap(map[string]interface{}{
+		"bucket":      "artifacts",
+		"credentials": map[string]interface{}{"role_duration": "soon"},
+	}); err == nil {
+		t.Error("expected an invalid role_duration to be rejected")
+	}
+
+	aliased, err := FromSettingsMap(map[string]interface{}{
+		"bucket":          "artifacts",
+		"strict_settings": true,
+		"assume_role": map[string]interface{}{
+			"role_arn":   "arn:aws:iam::123456789012:role/publisher",
+			"mfa_serial": "arn:aws:iam::123456789012:mfa/operator",
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected assume_role to be read, got %v", err)
+	}
+	if aliased.Credentials.RoleARN != "arn:aws:iam::123456789012:role/publisher" || aliased.Credentials.MFASerial != "arn:aws:iam::123456789012:mfa/operator" {
+		t.Errorf("expected assume_role moved into credentials, got %+v", aliased.Credentials)
+	}
+	wantDeprecations := []string{
+		"assume_role.role_arn is deprecated; rename it to credentials.role_arn",
+		"assume_role.mfa_serial is deprecated; rename it to credentials.mfa_serial",
+	}
+	if got := aliased.Deprecations(); strings.Join(got, "\n") != strings.Join(wantDeprecations, "\n") {
+		t.Errorf("unexpected deprecations:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestCredentialsSource(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket":      "artifacts",
+		"credentials": map[string]interface{}{"source": " IMDS "},
+		"targets": map[string]interface{}{
+			"prod": map[string]interface{}{
+				"credentials": map[string]interface{}{"access_key_id": "AKIDPROD", "secret_access_key": "secret"},
+			},
+			"irsa": map[string]interface{}{
+				"credentials": map[string]interface{}{"source": "web_identity"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+	if cfg.Credentials.Source != "imds" {
+		t.Errorf("expected the imds source, got %q", cfg.Credentials.Source)
+	}
+
+	for name, want := range map[string]Credentials{
+		"prod": {AccessKeyID: "AKIDPROD", SecretAccessKey: "secret"},
+		"irsa": {Source: "web_identity"},
+	} {
+		resolved, err := cfg.ForTarget(name)
+		if err != nil {
+			t.Fatalf("%s: ForTarget returned error: %v", name, err)
+		}
+		if resolved.Credentials != want {
+			t.Errorf("%s: expected %+v, got %+v", name, want, resolved.Credentials)
+		}
+		if err := resolved.Validate(); err != nil {
+			t.Errorf("%s: Validate returned error: %v", name, err)
+		}
+	}
+
+	for name, invalid := range map[string]func(*Config){
+		"unknown":         func(c *Config) { c.Credentials.Source = "vault" },
+		"static":          func(c *Config) { c.Credentials.Source = "static" },
+		"keys with imds":  func(c *Config) { c.Credentials.AccessKeyID, c.Credentials.SecretAccessKey = "AKID", "secret" },
+		"profile missing": func(c *Config) { c.Credentials.Source = "profile" },
+	} {
+		clone := cfg.Clone()
+		invalid(clone)
+		if err := clone.Validate(); err == nil {
+			t.Errorf("%s: expected the credentials to be rejected", name)
+		}
+	}
+}
+
+func TestSettingsMigration(t *testing.T) {
+	ctx := types.WithHostConfigProvider(context.Background(), &stubHostConfigProvider{
+		config: &types.Config{
+			Plugins: types.PluginsConfig{
+				Settings: map[string]map[string]interface{}{
+					"ds-s3": {"bucket": "legacy", "region": "eu-west-1"},
+					"s3": {
+						"bucket": "artifacts",
+						"assume_role": map[string]interface{}{
+							"role_arn":   "arn:aws:iam::123456789012:role/publisher",
+							"mfa_serial": "arn:aws:iam::123456789012:mfa/old",
+						},
+						"credentials": map[string]interface{}{"mfa_serial": "arn:aws:iam::123456789012:mfa/ci"},
+						"environments": map[string]interface{}{
+							"prod": map[string]interface{}{
+								"assume_role": map[string]interface{}{"role_arn": "arn:aws:iam::210987654321:role/publisher"},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	cfg, err := LoadFromHost(ctx, nil)
+	if err != nil {
+		t.Fatalf("LoadFromHost returned error: %v", err)
+	}
+	if cfg.Bucket != "artifacts" || cfg.Region != "eu-west-1" {
+		t.Errorf("expected s3 settings over ds-s3 ones, got bucket %q region %q", cfg.Bucket, cfg.Region)
+	}
+	if cfg.Credentials.RoleARN != "arn:aws:iam::123456789012:role/publisher" {
+		t.Errorf("expected the renamed setting to apply, got %+v", cfg.Credentials)
+	}
+	if cfg.Credentials.MFASerial != "arn:aws:iam::123456789012:mfa/ci" {
+		t.Errorf("expected the current mfa_serial to win, got %+v", cfg.Credentials)
+	}
+	for _, s := range cfg.Describe() {
+		if s.Key == "credentials.role_arn" && s.Source != SourceSettings {
+			t.Errorf("expected credentials.role_arn attributed to settings, got %s", s.Source)
+		}
+	}
+
+	want := []string{
+		`plugin settings under "ds-s3" are deprecated; move them under "s3"`,
+		"assume_role.role_arn is deprecated; rename it to credentials.role_arn",
+		"assume_role.mfa_serial is deprecated and ignored because credentials.mfa_serial is also set; remove it",
+		"environments.prod.assume_role.role_arn is deprecated; rename it to environments.prod.credentials.role_arn",
+	}
+	if got := cfg.Deprecations(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected deprecations:\n%s", strings.Join(got, "\n"))
+	}
+
+	prod, err := cfg.ForEnvironment("prod")
+	if err != nil {
+		t.Fatalf("ForEnvironment returned error: %v", err)
+	}
+	if prod.Credentials.RoleARN != "arn:aws:iam::210987654321:role/publisher" || len(prod.Deprecations()) != len(want) {
+		t.Errorf("expected the renamed overlay setting and carried deprecations, got %q, %v", prod.Credentials.RoleARN, prod.Deprecations())
+	}
+
+	for _, old := range []string{"context", "skip_tls_verify", "access_key_id", "sse", "part_size", "snapshot_prefix"} {
+		migrated, warnings := migrateSettings(map[string]interface{}{old: "x"}, "")
+		if _, ok := migrated[old]; !ok || len(warnings) > 0 {
+			t.Errorf("expected %s not to be taken for an old name, got %v, %v", old, migrated, warnings)
+		}
+	}
+}
+
+func TestStrictSettings(t *testing.T) {
+	settings := map[string]interface{}{
+		"bucket":      "artifacts",
+		"contex_path": "builds",
+		"assume_role": map[string]interface{}{"role_arn": "arn:aws:iam::123456789012:role/publisher"},
+		"tls":         map[string]interface{}{"skip_verfy": true},
+		"targets":     map[string]interface{}{"mirror": map[string]interface{}{"bucket": "mirror", "regoin": "eu-west-1"}},
+		"environments": map[string]interface{}{
+			"prod": map[string]interface{}{
+				"bucket":     "artifacts-prod",
+				"operations": map[string]interface{}{"upload": map[string]interface{}{"overwrit": false}},
+			},
+		},
+	}
+	cfg, err := FromSettingsMap(settings)
+	if err != nil || cfg.StrictSettings {
+		t.Fatalf("expected unknown keys to be ignored by default, got %v", err)
+	}
+
+	settings["strict_settings"] = true
+	_, err = FromSettingsMap(settings)
+	if err == nil {
+		t.Fatal("expected unknown keys to be rejected with strict_settings")
+	}
+	want := "unknown settings (strict_settings is enabled): contex_path, environments.prod.operations.upload.overwrit, targets.mirror.regoin, tls.skip_verfy"
+	if err.Error() != want {
+		t.Errorf("unexpected error:\n got %v\nwant %s", err, want)
+	}
+
+	delete(settings, "contex_path")
+	delete(settings, "tls")
+	delete(settings, "targets")
+	delete(settings, "environments")
+	cfg, err = FromSettingsMap(settings)
+	if err != nil || !cfg.StrictSettings || cfg.Credentials.RoleARN == "" {
+		t.Fatalf("expected known and renamed keys to pass, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), LocalFileName)
+	if err := os.WriteFile(path, []byte("contex_path: repos/app\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The local file only takes the keys it may set, so it rejects unknown
+	// ones with or without strict_settings.
+	if _, _, err := cfg.WithLocalFile(path); err == nil || !strings.Contains(err.Error(), path+" must not define contex_path") {
+		t.Errorf("expected the local file to be checked, got %v", err)
+	}
+}
+
+func TestCrossFieldValidation(t *testing.T) {
+	for _, tc := range []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{Endpoint: "minio.internal:9000"}, `endpoint "minio.internal:9000" must start with https:// or http://`},
+		{Config{Endpoint: "https://"}, `endpoint "https://" has no host name`},
+		{Config{Endpoint: "https://minio.internal/?x=1"}, "must not contain credentials, a query or a fragment"},
+		{Config{Region: "eu-west-1a"}, `region "eu-west-1a" is an availability zone; use its region "eu-west-1"`},
+		{Config{Region: "EU_WEST_1"}, `region "EU_WEST_1" must be written "eu-west-1"`},
+		{Config{Region: "frankfurt"}, `region "frankfurt" is not an AWS region code`},
+		{Config{Region: "eu west", Endpoint: "https://minio.internal"}, `region "eu west" may only contain`},
+		{Config{Bucket: "arn:aws:s3:eu-west-1:123456789012:accesspoint/web", ForcePathStyle: true}, "force_path_style cannot be used with an access point ARN"},
+		{Config{Cleanup: true}, "overwrite: false has nothing to protect"},
+		{Config{Sources: []string{"dist=../shared"}, Overwrite: true}, `sources: the key of source "dist=../shared" must not contain '..'`},
+		{Config{Sources: []string{"=bin/app"}, Overwrite: true}, "sources: encountered empty source path entry"},
+	} {
+		cfg := tc.cfg
+		cfg.Bucket = cmp.Or(cfg.Bucket, "artifacts")
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%+v: expected %q, got %v", tc.cfg, tc.want, err)
+		}
+	}
+
+	for _, cfg := range []Config{
+		{Region: "us-gov-west-1"},
+		{Region: "eusc-de-east-1"},
+		{Region: "garage", Endpoint: "http://localhost:3900"},
+		{Endpoint: "https://minio.internal:9000/s3"},
+		{Cleanup: true, Overwrite: true},
+		{Cleanup: true, CleanupTags: map[string]string{"ephemeral": "true"}},
+	} {
+		cfg.Bucket = "artifacts"
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("%+v: unexpected error: %v", cfg, err)
+		}
+	}
+}
+
+func TestBucketNameValidation(t *testing.T) {
+	for bucket, want := range map[string]string{
+		"ab":                 "between 3 and 63 characters",
+		"Artifacts":          "must not contain uppercase letters",
+		"my_artifacts":       "use '-' instead",
+		"-artifacts":         "must start and end with a letter or digit",
+		"build..artifacts":   "two adjacent periods",
+		"192.168.5.4":        "IP address",
+		"xn--artifacts":      "must not start with xn--",
+		"mfzwi23gnjvgw.mrap": "use its ARN",
+	} {
+		cfg := &Config{Bucket: bucket, Overwrite: true}
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q, got %v", bucket, want, err)
+		}
+	}
+
+	for _, cfg := range []*Config{
+		{Bucket: "build.artifacts-2"},
+		{Bucket: "web-ap-abc123xyz-s3alias"},
+		{Bucket: "Legacy_Artifacts", Endpoint: "https://ceph.internal"},
+		{Bucket: "Legacy_Artifacts", Region: "us-east-1"},
+		{Bucket: "artifacts", ContextPath: strings.Repeat("a", 1024)},
+	} {
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("%s: unexpected error: %v", cfg.Bucket, err)
+		}
+	}
+
+	legacy := &Config{Bucket: "Legacy_Artifacts", Region: "eu-west-1"}
+	if err := legacy.Validate(); err == nil || !strings.Contains(err.Error(), "uppercase") {
+		t.Errorf("expected legacy names outside us-east-1 to be rejected, got %v", err)
+	}
+
+	cfg := &Config{Bucket: "artifacts", ContextPath: strings.Repeat("a", 1025)}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "context_path: key too long") {
+		t.Errorf("expected a context path over the key limit to be rejected, got %v", err)
+	}
+}
+
+func TestChangedSettings(t *testing.T) {
+	settings := map[string]interface{}{
+		"bucket":      "artifacts",
+		"credentials": map[string]interface{}{"access_key_id": "abc", "secret_access_key": "xyz"},
+		"targets":     map[string]interface{}{"mirror": map[string]interface{}{"bucket": "mirror"}},
+	}
+	before, err := FromSettingsMap(settings)
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if changed := before.ChangedSettings(before); len(changed) != 0 {
+		t.Errorf("expected no changes, got %v", changed)
+	}
+
+	after, err := FromSettingsMap(map[string]interface{}{
+		"bucket":      "artifacts",
+		"region":      "eu-west-1",
+		"credentials": map[string]interface{}{"access_key_id": "abc", "secret_access_key": "rotated"},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	want := "region,credentials.secret_access_key,targets.mirror.bucket"
+	if changed := after.ChangedSettings(before); strings.Join(changed, ",") != want {
+		t.Errorf("expected %s, got %v", want, changed)
+	}
+}
+
+func TestSummarySettings(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{"bucket": "artifacts"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Summary.MaxObjects != DefaultSummaryMaxObjects || cfg.Summary.File != DefaultSummaryFile {
+		t.Errorf("unexpected summary defaults: %+v", cfg.Summary)
+	}
+
+	cfg, err = FromSettingsMap(map[string]interface{}{
+		"bucket":  "artifacts",
+		"summary": map[string]interface{}{"max_objects": 0, "file": " out/summary.json "},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Summary.MaxObjects != 0 || cfg.Summary.File != "out/summary.json" {
+		t.Errorf("unexpected summary settings: %+v", cfg.Summary)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected max_objects 0 to disable truncation, got %v", err)
+	}
+
+	cfg.Summary.MaxObjects = -1
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "summary.max_objects") {
+		t.Errorf("expected negative max_objects to be rejected, got %v", err)
+	}
+}
+
+func TestProgressSettings(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{"bucket": "artifacts"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Progress.File != "" || cfg.Progress.Interval != DefaultProgressInterval {
+		t.Errorf("unexpected progress defaults: %+v", cfg.Progress)
+	}
+
+	cfg, err = FromSettingsMap(map[string]interface{}{
+		"bucket":   "artifacts",
+		"progress": map[string]interface{}{"file": " progress.json ", "interval": "1s"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Progress.File != "progress.json" || cfg.Progress.Interval != time.Second {
+		t.Errorf("unexpected progress settings: %+v", cfg.Progress)
+	}
+
+	if _, err := FromSettingsMap(map[string]interface{}{
+		"bucket":   "artifacts",
+		"progress": map[string]interface{}{"interval": "often"},
+	}); err == nil || !strings.Contains(err.Error(), "progress.interval") {
+		t.Errorf("expected an invalid interval to be rejected, got %v", err)
+	}
+
+	cfg.Progress.Interval = -time.Second
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "progress.interval") {
+		t.Errorf("expected a negative interval to be rejected, got %v", err)
+	}
+}
+
+func TestPackingSettings(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket":  "artifacts",
+		"packing": map[string]interface{}{"enabled": true, "max_file_size": "16KiB", "chunk_size": "8MiB"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Packing.Enabled || cfg.Packing.MaxFileSize != 16<<10 || cfg.Packing.ChunkSize != 8<<20 {
+		t.Errorf("unexpected packing settings: %+v", cfg.Packing)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	if _, err := FromSettingsMap(map[string]interface{}{
+		"bucket":  "artifacts",
+		"packing": map[string]interface{}{"chunk_size": "lots"},
+	}); err == nil || !strings.Contains(err.Error(), "packing.chunk_size") {
+		t.Errorf("expected an invalid chunk size to be rejected, got %v", err)
+	}
+
+	cfg.Packing.ChunkSize = 1 << 10
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "packing.chunk_size") {
+		t.Errorf("expected a chunk size below the file size to be rejected, got %v", err)
+	}
+	cfg.Packing.ChunkSize = 8 << 20
+	cfg.StreamPlans = true
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "stream_plans") {
+		t.Errorf("expected packing with stream_plans to be rejected, got %v", err)
+	}
+}
+
+func TestBatchSettings(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{"bucket": "artifacts"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Batch.Prefix != DefaultBatchPrefix || cfg.Batch.Priority != DefaultBatchPriority || cfg.Batch.PollInterval != DefaultBatchPollInterval {
+		t.Errorf("unexpected batch defaults: %+v", cfg.Batch)
+	}
+
+	cfg, err = FromSettingsMap(map[string]interface{}{
+		"bucket": "artifacts",
+		"batch": map[string]interface{}{
+			"role_arn":      " arn:aws:iam::123456789012:role/batch ",
+			"prefix":        "/ops/batch/",
+			"priority":      50,
+			"poll_interval": "1m",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Batch.RoleARN != "arn:aws:iam::123456789012:role/batch" || cfg.Batch.Prefix != "ops/batch" || cfg.Batch.Priority != 50 || cfg.Batch.PollInterval != time.Minute {
+		t.Errorf("unexpected batch settings: %+v", cfg.Batch)
+	}
+
+	if _, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "artifacts",
+		"batch":  map[string]interface{}{"poll_interval": "soon"},
+	}); err == nil || !strings.Contains(err.Error(), "batch.poll_interval") {
+		t.Errorf("expected an invalid poll interval to be rejected, got %v", err)
+	}
+	cfg.Batch.Priority = -1
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "batch.priority") {
+		t.Errorf("expected a negative priority to be rejected, got %v", err)
+	}
+}
+
+func TestInventorySettings(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "artifacts",
+		"inventory": map[string]interface{}{
+			"bucket":  "inventories",
+			"prefix":  "/reports/artifacts/daily/",
+			"max_age": "48h",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Inventory.Enabled() || cfg.Inventory.Bucket != "inventories" || cfg.Inventory.Prefix != "reports/artifacts/daily" || cfg.Inventory.MaxAge != 48*time.Hour {
+		t.Errorf("unexpected inventory settings: %+v", cfg.Inventory)
+	}
+
+	cfg.Inventory.MaxAge = -time.Hour
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "inventory.max_age") {
+		t.Errorf("expected a negative max age to be rejected, got %v", err)
+	}
+	cfg.Inventory = Inventory{Bucket: "inventories"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "inventory.prefix") {
+		t.Errorf("expected a bucket without prefix to be rejected, got %v", err)
+	}
+}
+
+func TestAuditSettings(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket":       "artifacts",
+		"context_path": "releases/v1",
+		"audit": map[string]interface{}{
+			"bucket":   "audit-trail",
+			"prefix":   "/ds-s3/artifacts/",
+			"required": true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Audit.Enabled() || cfg.Audit.Bucket != "audit-trail" || cfg.Audit.Prefix != "ds-s3/artifacts" || !cfg.Audit.Required {
+		t.Errorf("unexpected audit settings: %+v", cfg.Audit)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	cfg.Audit = Audit{Prefix: "releases/v1/audit"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "audit.prefix") {
+		t.Errorf("expected records below the context path to be rejected, got %v", err)
+	}
+	cfg.Audit.Bucket = "audit-trail"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected the context path of another bucket to be accepted, got %v", err)
+	}
+	cfg.Audit = Audit{Required: true}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "audit.prefix") {
+		t.Errorf("expected required without prefix to be rejected, got %v", err)
+	}
+
+	cfg.Audit = Audit{Prefix: "ds-s3/artifacts", Required: true}
+	cfg.LocalConfig = true
+	path := filepath.Join(t.TempDir(), LocalFileName)
+	for local, key := range map[string]string{
+		"audit:\n  prefix: \"\"\n":                                      "audit",
+		"audit:\n  bucket: repo-owned\n":                                "audit",
+		"operations:\n  upload:\n    audit:\n      required: false\n":   "operations.upload.audit",
+		"environments:\n  prod:\n    audit:\n      prefix: elsewhere\n": "environments.prod.audit",
+	} {
+		if err := os.WriteFile(path, []byte(local), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := cfg.WithLocalFile(path); err == nil || !strings.Contains(err.Error(), "must not define "+key) {
+			t.Errorf("expected the local file to be refused defining %s, got %v", key, err)
+		}
+	}
+}
+
+func TestAllowedPrefixes(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "shared",
+		"policy": map[string]interface{}{"allowed_prefixes": []interface{}{" /team-a/ ", "ds-audit/team-a"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(cfg.Policy.AllowedPrefixes, []string{"team-a", "ds-audit/team-a"}) {
+		t.Errorf("unexpected allowed prefixes %v", cfg.Policy.AllowedPrefixes)
+	}
+	for prefix, allowed := range map[string]bool{"team-a": true, "team-a/releases": true, "team-ab": false, "": false, "ds-audit": false} {
+		if err := cfg.Policy.CheckPrefix(prefix); (err == nil) != allowed {
+			t.Errorf("CheckPrefix(%q) returned %v", prefix, err)
+		}
+	}
+	if err := (Policy{}).CheckPrefix(""); err != nil {
+		t.Errorf("expected every prefix to be allowed without allowed_prefixes, got %v", err)
+	}
+
+	cfg.Audit.Prefix = "ds-audit/team-b"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "audit.prefix") {
+		t.Errorf("expected an audit prefix outside the allowed prefixes to be rejected, got %v", err)
+	}
+	cfg.Audit.Prefix = "ds-audit/team-a"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected an allowed audit prefix to be accepted, got %v", err)
+	}
+	cfg.Audit.Prefix = ""
+
+	cfg.Policy.AllowedPrefixes = []string{"team-a", ""}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "policy.allowed_prefixes") {
+		t.Errorf("expected an empty allowed prefix to be rejected, got %v", err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, LocalFileName)
+	if err := os.WriteFile(path, []byte("policy:\n  allowed_prefixes: [\"\"]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg.LocalConfig = true
+	if _, _, err := cfg.WithLocalFile(path); err == nil || !strings.Contains(err.Error(), "policy.allowed_prefixes") {
+		t.Errorf("expected the local file to be refused widening the allowed prefixes, got %v", err)
+	}
+
+	// Overlays of the local file are applied after it, so they are refused
+	// too rather than replacing the prefixes of the host.
+	cfg.Policy.AllowedPrefixes = []string{"team-a"}
+	for local, key := range map[string]string{
+		"operations:\n  upload:\n    policy:\n      allowed_prefixes: [team-b]\n":                                 "operations.upload.policy.allowed_prefixes",
+		"environments:\n  prod:\n    policy:\n      allowed_prefixes: [zzz]\n":                                    "environments.prod.policy.allowed_prefixes",
+		"environments:\n  prod:\n    operations:\n      sync:\n        policy:\n          allowed_prefixes: []\n": "environments.prod.operations.sync.policy.allowed_prefixes",
+	} {
+		if err := os.WriteFile(path, []byte(local), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := cfg.WithLocalFile(path); err == nil || !strings.Contains(err.Error(), "must not define "+key) {
+			t.Errorf("expected the local file to be refused defining %s, got %v", key, err)
+		}
+	}
+}
+
+func TestForbiddenPatterns(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "artifacts",
+		"policy": map[string]interface{}{"forbidden_patterns": []interface{}{" *.pem ", "id_rsa*"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(cfg.Policy.ForbiddenPatterns, []string{"*.pem", "id_rsa*"}) {
+		t.Errorf("unexpected forbidden patterns %v", cfg.Policy.ForbiddenPatterns)
+	}
+	clone := cfg.Clone()
+	clone.Policy.ForbiddenPatterns[0] = "*.key"
+	if cfg.Policy.ForbiddenPatterns[0] != "*.pem" {
+		t.Error("expected Clone to copy the forbidden patterns")
+	}
+
+	cfg.Policy.ForbiddenPatterns = []string{"[a-"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "policy.forbidden_patterns[0]") {
+		t.Errorf("expected an invalid pattern to be rejected, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), LocalFileName)
+	if err := os.WriteFile(path, []byte("policy:\n  forbidden_patterns: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Policy.ForbiddenPatterns = []string{"*.pem"}
+	cfg.LocalConfig = true
+	if _, _, err := cfg.WithLocalFile(path); err == nil || !strings.Contains(err.Error(), "policy.forbidden_patterns") {
+		t.Errorf("expected the local file to be refused replacing the forbidden patterns, got %v", err)
+	}
+
+	for _, local := range []string{
+		"operations:\n  upload:\n    policy:\n      forbidden_patterns: []\n",
+		"environments:\n  prod:\n    policy:\n      forbidden_patterns: []\n",
+	} {
+		if err := os.WriteFile(path, []byte(local), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := cfg.WithLocalFile(path); err == nil || !strings.Contains(err.Error(), "policy.forbidden_patterns") {
+			t.Errorf("expected the local file to be refused clearing the forbidden patterns in an overlay, got %v", err)
+		}
+	}
+
+	// Overlays of the local file that leave the policy alone keep the
+	// patterns of the host.
+	if err := os.WriteFile(path, []byte("operations:\n  upload:\n    context_path: repos/app\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	local, _, err := cfg.WithLocalFile(path)
+	if err != nil {
+		t.Fatalf("WithLocalFile returned error: %v", err)
+	}
+	upload, err := local.ForOperation("upload")
+	if err != nil {
+		t.Fatalf("ForOperation returned error: %v", err)
+	}
+	if !slices.Equal(upload.Policy.ForbiddenPatterns, []string{"*.pem", "id_rsa*"}) {
+		t.Errorf("expected the forbidden patterns of the host to survive, got %v", upload.Policy.ForbiddenPatterns)
+	}
+}
+
+func TestThrottleSettings(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "artifacts",
+		"throttle": map[string]interface{}{
+			"timezone": "Europe/Berlin",
+			"windows": []interface{}{
+				map[string]interface{}{"days": []interface{}{"mon-fri"}, "start": "08:00", "end": "18:30", "concurrency": 2, "bandwidth": "20MiB"},
+				map[string]interface{}{"days": []interface{}{"Saturday", "sun"}, "start": "22:00", "end": "06:00", "bandwidth": "100MiB"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []ThrottleWindow{
+		{Days: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}, Start: 8 * time.Hour, End: 18*time.Hour + 30*time.Minute, Concurrency: 2, Bandwidth: 20 << 20},
+		{Days: []time.Weekday{time.Saturday, time.Sunday}, Start: 22 * time.Hour, End: 6 * time.Hour, Bandwidth: 100 << 20},
+	}
+	if !reflect.DeepEqual(cfg.Throttle.Windows, want) {
+		t.Errorf("unexpected throttle windows %+v", cfg.Throttle.Windows)
+	}
+	if location, err := cfg.Throttle.Location(); err != nil || location.String() != "Europe/Berlin" {
+		t.Errorf("unexpected throttle location %v, %v", location, err)
+	}
+	if days, err := parseWeekdays([]string{"fri-mon"}); err != nil || !slices.Equal(days, []time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday}) {
+		t.Errorf("expected a range to wrap around the weekend, got %v, %v", days, err)
+	}
+
+	for _, window := range []map[string]interface{}{
+		{"days": []interface{}{"someday"}, "start": "08:00", "end": "18:00", "concurrency": 1},
+		{"start": "8am", "end": "18:00", "concurrency": 1},
+		{"start": "08:00", "end": "24:30", "concurrency": 1},
+	} {
+		if _, err := FromSettingsMap(map[string]interface{}{
+			"bucket":   "artifacts",
+			"throttle": map[string]interface{}{"windows": []interface{}{window}},
+		}); err == nil || !strings.Contains(err.Error(), "throttle.windows[0]") {
+			t.Errorf("expected window %v to be rejected, got %v", window, err)
+		}
+	}
+
+	cfg.Throttle.Windows = []ThrottleWindow{{Start: 8 * time.Hour, End: 18 * time.Hour}}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "concurrency or bandwidth") {
+		t.Errorf("expected a window without limits to be rejected, got %v", err)
+	}
+	cfg.Throttle.Windows = []ThrottleWindow{{Start: 8 * time.Hour, End: 8 * time.Hour, Concurrency: 1}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an empty window to be rejected")
+	}
+	cfg.Throttle = Throttle{Timezone: "Mars/Olympus_Mons"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "throttle.timezone") {
+		t.Errorf("expected an unknown time zone to be rejected, got %v", err)
+	}
+}
+
+func TestExpectSettings(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "artifacts",
+		"expect": map[string]interface{}{"min_files": 3, "min_total_size": "1MiB"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Expect.MinFiles != 3 || cfg.Expect.MinTotalSize != 1<<20 {
+		t.Errorf("unexpected expectations %+v", cfg.Expect)
+	}
+
+	cfg.Limits.MaxFiles = 2
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "expect.min_files") {
+		t.Errorf("expected min_files above max_files to be rejected, got %v", err)
+	}
+	cfg.Limits = Limits{MaxTotalSize: 1 << 10}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "expect.min_total_size") {
+		t.Errorf("expected min_total_size above max_total_size to be rejected, got %v", err)
+	}
+	cfg.Limits = Limits{}
+	cfg.StreamPlans, cfg.Cleanup = true, true
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "stream_plans and cleanup") {
+		t.Errorf("expected expectations of a streamed upload with cleanup to be rejected, got %v", err)
+	}
+	cfg.Cleanup = false
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected expectations of a streamed upload without cleanup to be accepted, got %v", err)
+	}
+	if _, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "artifacts",
+		"expect": map[string]interface{}{"min_total_size": "lots"},
+	}); err == nil || !strings.Contains(err.Error(), "expect.min_total_size") {
+		t.Errorf("expected an invalid size to be rejected, got %v", err)
+	}
+}
+
+func TestVerifySettings(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{"bucket": "artifacts"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Verify.Wait != 0 || cfg.Verify.Interval != DefaultVerifyInterval {
+		t.Errorf("unexpected verify defaults %+v", cfg.Verify)
+	}
+
+	cfg, err = FromSettingsMap(map[string]interface{}{
+		"bucket": "artifacts",
+		"verify": map[string]interface{}{"wait": "2m", "interval": "250ms", "sample": 20},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Verify != (Verify{Wait: 2 * time.Minute, Interval: 250 * time.Millisecond, Sample: 20}) {
+		t.Errorf("unexpected verify settings %+v", cfg.Verify)
+	}
+
+	cfg.Verify.Interval = 0
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "verify.interval") {
+		t.Errorf("expected a zero interval to be rejected, got %v", err)
+	}
+	if _, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "artifacts",
+		"verify": map[string]interface{}{"wait": "soon"},
+	}); err == nil || !strings.Contains(err.Error(), "verify.wait") {
+		t.Errorf("expected an invalid wait to be rejected, got %v", err)
+	}
+}
+
+func TestMaxObjectSize(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "artifacts",
+		"policy": map[string]interface{}{"max_object_size": "2GiB"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Policy.MaxObjectSize != 2<<30 {
+		t.Errorf("unexpected maximum object size %d", cfg.Policy.MaxObjectSize)
+	}
+	if _, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "artifacts",
+		"policy": map[string]interface{}{"max_object_size": "huge"},
+	}); err == nil || !strings.Contains(err.Error(), "policy.max_object_size") {
+		t.Errorf("expected an invalid size to be rejected, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), LocalFileName)
+	if err := os.WriteFile(path, []byte("policy:\n  max_object_size: 100GiB\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg.LocalConfig = true
+	if _, _, err := cfg.WithLocalFile(path); err == nil || !strings.Contains(err.Error(), "policy.max_object_size") {
+		t.Errorf("expected the local file to be refused raising the maximum object size, got %v", err)
+	}
+
+	for local, key := range map[string]string{
+		"operations:\n  upload:\n    policy:\n      max_object_size: 100GiB\n": "operations.upload.policy.max_object_size",
+		"environments:\n  prod:\n    policy:\n      max_object_size: 0\n":      "environments.prod.policy.max_object_size",
+	} {
+		if err := os.WriteFile(path, []byte(local), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := cfg.WithLocalFile(path); err == nil || !strings.Contains(err.Error(), key) {
+			t.Errorf("expected the local file to be refused defining %s, got %v", key, err)
+		}
+	}
+}
+
+func TestACLSettings(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket": "artifacts",
+		"acl":    map[string]interface{}{"canned": "Public-Read", "when_disabled": "DROP"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ACL.Canned != "public-read" || cfg.ACL.WhenDisabled != ACLDisabledDrop {
+		t.Errorf("unexpected acl settings: %+v", cfg.ACL)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	cfg.ACL.Canned = "world-writable"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "acl.canned") {
+		t.Errorf("expected an unknown canned ACL to be rejected, got %v", err)
+	}
+	cfg.ACL = ACL{Canned: "private", WhenDisabled: "ignore"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "acl.when_disabled") {
+		t.Errorf("expected an unknown when_disabled action to be rejected, got %v", err)
+	}
+	cfg.ACL.WhenDisabled = ACLDisabledFail
+	cfg.Bucket = "artifacts--use1-az4--x-s3"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "acl.canned") {
+		t.Errorf("expected an ACL on a directory bucket to be rejected, got %v", err)
+	}
+}
+
+func TestLoggingSettings(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket":  "artifacts",
+		"logging": map[string]interface{}{"format": " Logfmt ", "include_location": true},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Logging.Format != LogFormatLogfmt || !cfg.Logging.IncludeLocation {
+		t.Errorf("unexpected logging settings: %+v", cfg.Logging)
+	}
+	cfg.Logging.Format = "yaml"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "logging.format") {
+		t.Errorf("expected an unknown log format to be rejected, got %v", err)
+	}
+
+	load := func(settings map[string]interface{}) *Config {
+		t.Helper()
+		ctx := types.WithHostConfigProvider(context.Background(), &stubHostConfigProvider{
+			config: &types.Config{
+				Logging: types.LoggingConfig{Format: "text"},
+				Plugins: types.PluginsConfig{Settings: map[string]map[string]interface{}{"s3": settings}},
+			},
+		})
+		cfg, err := LoadFromHost(ctx, nil)
+		if err != nil {
+			t.Fatalf("LoadFromHost returned error: %v", err)
+		}
+		return cfg
+	}
+	cfg = load(map[string]interface{}{"bucket": "artifacts"})
+	if setting := cfg.setting("logging.format", cfg.Logging.Format); setting.Value != LogFormatJSON || setting.Source != SourceDefault {
+		t.Errorf("expected JSON whatever the host renders its logs in, got %+v", setting)
+	}
+	cfg = load(map[string]interface{}{"bucket": "artifacts", "logging": map[string]interface{}{"format": "console"}})
+	if setting := cfg.setting("logging.format", cfg.Logging.Format); setting.Value != LogFormatConsole || setting.Source != SourceSettings {
+		t.Errorf("expected the plugin log format to take precedence, got %+v", setting)
+	}
+}
+
+func TestShutdownGracePeriod(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{"bucket": "artifacts"})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if cfg.ShutdownGracePeriod != DefaultShutdownGracePeriod {
+		t.Errorf("expected default grace period, got %s", cfg.ShutdownGracePeriod)
+	}
+
+	cfg, err = FromSettingsMap(map[string]interface{}{"bucket": "artifacts", "shutdown_grace_period": "45s"})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if cfg.ShutdownGracePeriod != 45*time.Second {
+		t.Errorf("unexpected grace period %s", cfg.ShutdownGracePeriod)
+	}
+
+	if _, err := FromSettingsMap(map[string]interface{}{"bucket": "artifacts", "shutdown_grace_period": "later"}); err == nil {
+		t.Error("expected error for invalid shutdown_grace_period")
+	}
+}
+
+func TestDNSSettings(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket":   "artifacts",
+		"endpoint": "https://minio.internal:9000",
+		"dns":      map[string]interface{}{"pin": []interface{}{"10.0.0.1", " 10.0.0.2 "}},
+		"targets": map[string]interface{}{
+			"mirror": map[string]interface{}{"endpoint": "https://mirror.internal"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if !cfg.DNS.Enabled() || len(cfg.DNS.Pin) != 2 || cfg.DNS.Pin[1] != "10.0.0.2" {
+		t.Fatalf("unexpected dns config: %+v", cfg.DNS)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+
+	mirror, err := cfg.ForTarget("mirror")
+	if err != nil {
+		t.Fatalf("ForTarget returned error: %v", err)
+	}
+	if len(mirror.DNS.Pin) != 0 {
+		t.Errorf("expected pinned addresses to stay with the base endpoint, got %v", mirror.DNS.Pin)
+	}
+
+	cfg.DNS.Pin = []string{"minio.internal"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for a pinned host name")
+	}
+	cfg.DNS = DNS{Cache: true}
+	cfg.Endpoint = ""
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for dns caching without a custom endpoint")
+	}
+}
+
+func TestRequestHeaderSettings(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket":            "artifacts",
+		"user_agent_suffix": " team/payments ",
+		"request_headers":   map[string]interface{}{"x-team-id": "payments"},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if cfg.UserAgentSuffix != "team/payments" || cfg.RequestHeaders["X-Team-Id"] != "payments" {
+		t.Fatalf("unexpected request decorations: %q %v", cfg.UserAgentSuffix, cfg.RequestHeaders)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+
+	for _, name := range []string{"Authorization", "X-Amz-Date", "Bad Header"} {
+		cfg.RequestHeaders = map[string]string{name: "value"}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected error for header %q", name)
+		}
+	}
+}
+
+func TestAccessPointBucketValidation(t *testing.T) {
+	valid := []string{
+		"arn:aws:s3:eu-west-1:123456789012:accesspoint/artifacts",
+		"arn:aws:s3-object-lambda:eu-west-1:123456789012:accesspoint/redacted",
+		"arn:aws:s3::123456789012:accesspoint/mfzwi23gnjvgw.mrap",
+	}
+	for _, bucket := range valid {
+		cfg := &Config{Bucket: bucket}
+		if !cfg.IsAccessPoint() {
+			t.Errorf("expected %s to be treated as an access point", bucket)
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("expected %s to be valid, got %v", bucket, err)
+		}
+	}
+
+	invalid := []string{
+		"arn:aws:s3:::artifacts",
+		"arn:aws:iam::123456789012:accesspoint/artifacts",
+		"arn:aws:s3:eu-west-1:123456789012:bucket/artifacts",
+		"arn:aws:s3:eu-west-1:123456789012:accesspoint/mfzwi23gnjvgw.mrap",
+		"arn:aws:s3-object-lambda::123456789012:accesspoint/mfzwi23gnjvgw.mrap",
+		"arn:aws:s3:::accesspoint/mfzwi23gnjvgw.mrap",
+	}
+	for _, bucket := range invalid {
+		if err := (&Config{Bucket: bucket}).Validate(); err == nil {
+			t.Errorf("expected %s to be rejected", bucket)
+		}
+	}
+
+	cfg := &Config{Bucket: valid[0], ForcePathStyle: true}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected force_path_style to be rejected for access point buckets")
+	}
+
+	mrap := &Config{Bucket: valid[2]}
+	if !mrap.IsMultiRegionAccessPoint() || (&Config{Bucket: valid[0]}).IsMultiRegionAccessPoint() {
+		t.Error("expected only the .mrap ARN to be a multi-region access point")
+	}
+	mrap.Endpoint = "https://s3.eu-west-1.amazonaws.com"
+	if err := mrap.Validate(); err == nil {
+		t.Error("expected endpoint to be rejected for multi-region access points")
+	}
+}
+
+func TestDirectoryBucketValidation(t *testing.T) {
+	cfg := &Config{Bucket: "artifact-cache--use1-az4--x-s3"}
+	if !cfg.IsDirectoryBucket() {
+		t.Fatal("expected a directory bucket")
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+
+	invalid := []*Config{
+		{Bucket: "artifact-cache--x-s3"},
+		{Bucket: "Artifact--use1-az4--x-s3"},
+		{Bucket: "artifact-cache--use1-az4--x-s3", ForcePathStyle: true},
+		{Bucket: "artifact-cache--use1-az4--x-s3", CleanupTags: map[string]string{"lifecycle": "temp"}},
+		{Bucket: "artifact-cache--use1-az4--x-s3", Encryption: Encryption{Mode: "aws:kms:dsse"}},
+	}
+	for _, cfg := range invalid {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", cfg)
+		}
+	}
+}
+
+func TestChecksumMetadataSetting(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket":            "artifacts",
+		"checksum_metadata": true,
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if !cfg.Checksum.Metadata {
+		t.Fatal("expected checksum_metadata to be enabled")
+	}
+}
+
+func TestManifestObjectKey(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket":       "artifacts",
+		"context_path": "releases/",
+		"manifest_key": "/manifest.json",
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if got := cfg.ManifestObjectKey(); got != "releases/manifest.json" {
+		t.Errorf("ManifestObjectKey = %q", got)
+	}
+	cfg.ContextPath = ""
+	if got := cfg.ManifestObjectKey(); got != "manifest.json" {
+		t.Errorf("ManifestObjectKey without context = %q", got)
+	}
+	cfg.ManifestKey = ""
+	if got := cfg.ManifestObjectKey(); got != "" {
+		t.Errorf("expected no manifest key, got %q", got)
+	}
+}
+
+func TestMarkerObjectKey(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket":             "artifacts",
+		"context_path":       "releases/v1",
+		"skip_if_exists_key": "/.complete",
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if got := cfg.MarkerObjectKey(); got != "releases/v1/.complete" {
+		t.Errorf("MarkerObjectKey = %q", got)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+	cfg.ManifestKey = ".complete"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "skip_if_exists_key") {
+		t.Errorf("expected the manifest key to be rejected as marker, got %v", err)
+	}
+	cfg.SkipIfExistsKey = ""
+	if got := cfg.MarkerObjectKey(); got != "" {
+		t.Errorf("expected no marker key, got %q", got)
+	}
+}
+
+func TestLatestKey(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket":       "artifacts",
+		"context_path": "releases/v1",
+		"latest_key":   "/releases/latest.json",
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if cfg.LatestKey != "releases/latest.json" {
+		t.Errorf("LatestKey = %q", cfg.LatestKey)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+	cfg.LatestKey = "releases/v1/latest.json"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "latest_key") {
+		t.Errorf("expected a pointer below the context path to be rejected, got %v", err)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{"bucket": "artifacts", "dry_run": true})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if !cfg.DryRun || !cfg.Clone().DryRun {
+		t.Error("expected dry_run to be parsed and kept by Clone")
+	}
+}
+
+func TestSyncSettings(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket":       "artifacts",
+		"context_path": "site",
+		"sync":         map[string]interface{}{"enabled": true},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if !cfg.Sync.Enabled || cfg.SyncStateObjectKey() != "site/"+DefaultSyncStateKey {
+		t.Fatalf("unexpected sync settings %+v (state at %q)", cfg.Sync, cfg.SyncStateObjectKey())
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+
+	cfg.Cleanup = true
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected sync with cleanup to be rejected")
+	}
+}
+
+func TestClientEncryptionValidation(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	cases := map[string]struct {
+		settings map[string]interface{}
+		wantErr  bool
+	}{
+		"local key":  {settings: map[string]interface{}{"key": key}},
+		"kms key":    {settings: map[string]interface{}{"kms_key_id": "alias/artifacts"}},
+		"both":       {settings: map[string]interface{}{"key": key, "kms_key_id": "alias/artifacts"}, wantErr: true},
+		"short key":  {settings: map[string]interface{}{"key": base64.StdEncoding.EncodeToString(make([]byte, 16))}, wantErr: true},
+		"not base64": {settings: map[string]interface{}{"key": "not base64!"}, wantErr: true},
+	}
+	for name, tc := range cases {
+		cfg, err := FromSettingsMap(map[string]interface{}{
+			"bucket":            "artifacts",
+			"client_encryption": tc.settings,
+		})
+		if err != nil {
+			t.Fatalf("%s: FromSettingsMap returned error: %v", name, err)
+		}
+		if !cfg.ClientEncryption.Enabled() {
+			t.Errorf("%s: expected client encryption to be enabled", name)
+		}
+		if err := cfg.Validate(); (err != nil) != tc.wantErr {
+			t.Errorf("%s: Validate() error = %v, wantErr %v", name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestAttestationObjectKey(t *testing.T) {
+	cfg, err := FromSettingsMap(map[string]interface{}{
+		"bucket":       "artifacts",
+		"context_path": "releases/1.2.0",
+		"attestations": map[string]interface{}{"sbom": " dist/sbom.spdx.json "},
+	})
+	if err != nil {
+		t.Fatalf("FromSettingsMap returned error: %v", err)
+	}
+	if cfg.Attestations.SBOM != "dist/sbom.spdx.json" {
+		t.Fatalf("unexpected sbom path %q", cfg.Attestations.SBOM)
+	}
+	if got := cfg.AttestationObjectKey(cfg.Attestations.SBOM); got != "releases/1.2.0/.attestations/sbom.spdx.json" {
+		t.Errorf("AttestationObjectKey = %q", got)
+	}
 }
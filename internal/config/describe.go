@@ -0,0 +1,293 @@
+package config
+
+import (
+	"cmp"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/delivery-station/ds-s3/internal/awsauth"
+)
+
+// Value sources reported by Describe.
+const (
+	SourceDefault  = "default"
+	SourceSettings = "settings"
+	SourceLocal    = "local"
+	SourceHost     = "host"
+	SourceFlag     = "flag"
+)
+
+// Redacted replaces secret values in Describe output.
+const Redacted = "<redacted>"
+
+// Setting is one resolved configuration value together with where it came from.
+type Setting struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// Describe lists every resolved setting in a stable order with secrets redacted.
+func (c *Config) Describe() []Setting {
+	settings := []Setting{
+		c.setting("environment", c.Environment),
+		c.setting("bucket", c.Bucket),
+		c.setting("region", c.Region),
+		c.setting("context_path", c.ContextPath),
+		c.setting("sources", c.Sources),
+		c.setting("cleanup", c.Cleanup),
+		c.setting("cleanup_tags", c.CleanupTags),
+		c.setting("overwrite", c.Overwrite),
+		c.setting("endpoint", c.Endpoint),
+		c.setting("force_path_style", c.ForcePathStyle),
+		c.setting("tls.skip_verify", c.SkipTLSVerify),
+		c.setting("http.max_idle_conns_per_host", c.HTTP.MaxIdleConnsPerHost),
+		c.setting("http.disable_http2", c.HTTP.DisableHTTP2),
+		c.setting("http.disable_keepalives", c.HTTP.DisableKeepAlives),
+		c.setting("http.idle_conn_timeout", c.HTTP.IdleConnTimeout.String()),
+		c.setting("dns.cache", c.DNS.Cache),
+		c.setting("dns.pin", c.DNS.Pin),
+		c.setting("retry.max_attempts", c.Retry.MaxAttempts),
+		c.setting("retry.max_backoff", c.Retry.MaxBackoff.String()),
+		c.setting("user_agent_suffix", c.UserAgentSuffix),
+		c.setting("request_headers", c.RequestHeaders),
+		c.setting("profile", c.Profile),
+		c.setting("credentials.source", cmp.Or(c.Credentials.Source, awsauth.SourceAuto)),
+		c.setting("credentials.access_key_id", redact(c.Credentials.AccessKeyID)),
+		c.setting("credentials.secret_access_key", redact(c.Credentials.SecretAccessKey)),
+		c.setting("credentials.session_token", redact(c.Credentials.SessionToken)),
+		c.setting("credentials.role_arn", c.Credentials.RoleARN),
+		c.setting("credentials.role_session_name", c.Credentials.RoleSessionName),
+		c.setting("credentials.external_id", redact(c.Credentials.ExternalID)),
+		c.setting("credentials.role_duration", c.Credentials.RoleDuration.String()),
+		c.setting("credentials.mfa_serial", c.Credentials.MFASerial),
+		c.setting("snapshot.enabled", c.Snapshot.Enabled),
+		c.setting("snapshot.prefix", c.Snapshot.Prefix),
+		c.setting("replication.targets", c.Replication.Targets),
+		c.setting("replication.require_all", c.Replication.RequireAll),
+		c.setting("multipart.part_size", c.Multipart.PartSize),
+		c.setting("multipart.concurrency", c.Multipart.Concurrency),
+		c.setting("checksum_type", c.Checksum.Type),
+		c.setting("checksum_algorithm", c.Checksum.Algorithm),
+		c.setting("checksum_metadata", c.Checksum.Metadata),
+		c.setting("memory_limit", c.MemoryLimit),
+		c.setting("concurrency", c.Concurrency),
+		c.setting("stream_plans", c.StreamPlans),
+		c.setting("walk_concurrency", c.WalkConcurrency),
+		c.setting("max_depth", c.MaxDepth),
+		c.setting("strip_components", c.StripComponents),
+		c.setting("ignore_files", c.IgnoreFiles),
+		c.setting("respect_gitignore", c.RespectGitignore),
+		c.setting("file_policy.empty", c.FilePolicy.Empty),
+		c.setting("file_policy.special", c.FilePolicy.Special),
+		c.setting("large_files.threshold", c.LargeFiles.Threshold),
+		c.setting("large_files.action", c.LargeFiles.Action),
+		c.setting("limits.max_files", c.Limits.MaxFiles),
+		c.setting("limits.max_total_size", c.Limits.MaxTotalSize),
+		c.setting("expect.min_files", c.Expect.MinFiles),
+		c.setting("expect.min_total_size", c.Expect.MinTotalSize),
+		c.setting("verify.wait", c.Verify.Wait.String()),
+		c.setting("verify.interval", c.Verify.Interval.String()),
+		c.setting("verify.sample", c.Verify.Sample),
+		c.setting("extract_tar", c.ExtractTar),
+		c.setting("decompress", c.Decompress),
+		c.setting("manifest_key", c.ManifestKey),
+		c.setting("skip_if_exists_key", c.SkipIfExistsKey),
+		c.setting("latest_key", c.LatestKey),
+		c.setting("dry_run", c.DryRun),
+		c.setting("run_id", c.RunID),
+		c.setting("failure_report", c.FailureReport),
+		c.setting("summary.max_objects", c.Summary.MaxObjects),
+		c.setting("summary.file", c.Summary.File),
+		c.setting("progress.file", c.Progress.File),
+		c.setting("progress.interval", c.Progress.Interval.String()),
+		c.setting("packing.enabled", c.Packing.Enabled),
+		c.setting("packing.max_file_size", c.Packing.MaxFileSize),
+		c.setting("packing.chunk_size", c.Packing.ChunkSize),
+		c.setting("batch.role_arn", c.Batch.RoleARN),
+		c.setting("batch.account_id", c.Batch.AccountID),
+		c.setting("batch.prefix", c.Batch.Prefix),
+		c.setting("batch.priority", c.Batch.Priority),
+		c.setting("batch.poll_interval", c.Batch.PollInterval.String()),
+		c.setting("batch.delete_function_arn", c.Batch.DeleteFunctionARN),
+		c.setting("inventory.bucket", c.Inventory.Bucket),
+		c.setting("inventory.prefix", c.Inventory.Prefix),
+		c.setting("inventory.max_age", c.Inventory.MaxAge.String()),
+		c.setting("audit.bucket", c.Audit.Bucket),
+		c.setting("audit.prefix", c.Audit.Prefix),
+		c.setting("audit.required", c.Audit.Required),
+		c.setting("throttle.timezone", c.Throttle.Timezone),
+		c.setting("throttle.windows", c.Throttle.Windows),
+		c.setting("shutdown_grace_period", c.ShutdownGracePeriod.String()),
+		c.setting("local_config", c.LocalConfig),
+		c.setting("strict_settings", c.StrictSettings),
+		c.setting("exit_codes", c.ExitCodes),
+		c.setting("backend", c.Backend),
+		c.setting("sync.enabled", c.Sync.Enabled),
+		c.setting("sync.state_key", c.Sync.StateKey),
+		c.setting("sync.cache_dir", c.Sync.CacheDir),
+		c.setting("build_context.enabled", c.BuildContext.Enabled),
+		c.setting("build_context.tags", c.BuildContext.Tags),
+		c.setting("build_context.metadata", c.BuildContext.Metadata),
+		c.setting("build_context.git", c.BuildContext.Git),
+		c.setting("secret_scan.enabled", c.SecretScan.Enabled),
+		c.setting("secret_scan.mode", c.SecretScan.Mode),
+		c.setting("secret_scan.patterns", c.SecretScan.Patterns),
+		c.setting("secret_scan.entropy_threshold", c.SecretScan.EntropyThreshold),
+		c.setting("secret_scan.max_file_size", c.SecretScan.MaxFileSize),
+		c.setting("antivirus.enabled", c.Antivirus.Enabled),
+		c.setting("antivirus.clamd", c.Antivirus.Clamd),
+		c.setting("antivirus.command", c.Antivirus.Command),
+		c.setting("antivirus.action", c.Antivirus.Action),
+		c.setting("encryption.mode", c.Encryption.Mode),
+		c.setting("encryption.kms_key_id", c.Encryption.KMSKeyID),
+		c.setting("encryption.key_rules", c.Encryption.KeyRules),
+		c.setting("encryption.bucket_key", c.Encryption.BucketKey),
+		c.setting("encryption.preflight", c.Encryption.Preflight),
+		c.setting("encryption.preflight_strict", c.Encryption.PreflightStrict),
+		c.setting("attestations.sbom", c.Attestations.SBOM),
+		c.setting("attestations.provenance", c.Attestations.Provenance),
+		c.setting("client_encryption.kms_key_id", c.ClientEncryption.KMSKeyID),
+		c.setting("client_encryption.key", redact(c.ClientEncryption.Key)),
+		c.setting("policy.require_encryption", c.Policy.RequireEncryption),
+		c.setting("policy.allowed_prefixes", c.Policy.AllowedPrefixes),
+		c.setting("policy.forbidden_patterns", c.Policy.ForbiddenPatterns),
+		c.setting("policy.max_object_size", c.Policy.MaxObjectSize),
+		c.setting("acl.canned", c.ACL.Canned),
+		c.setting("acl.when_disabled", c.ACL.WhenDisabled),
+		c.setting("log_level", c.LogLevel),
+		c.setting("logging.format", c.Logging.Format),
+		c.setting("logging.include_location", c.Logging.IncludeLocation),
+	}
+
+	names := make([]string, 0, len(c.Targets))
+	for name := range c.Targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		target := c.Targets[name]
+		prefix := "targets." + name + "."
+		for _, field := range []struct {
+			key   string
+			value interface{}
+		}{
+			{"bucket", target.Bucket},
+			{"region", target.Region},
+			{"endpoint", target.Endpoint},
+			{"force_path_style", target.ForcePathStyle},
+			{"tls.skip_verify", target.SkipTLSVerify},
+			{"profile", target.Profile},
+			{"backend", target.Backend},
+			{"credentials.source", target.Credentials.Source},
+			{"credentials.access_key_id", redact(target.Credentials.AccessKeyID)},
+			{"credentials.secret_access_key", redact(target.Credentials.SecretAccessKey)},
+			{"credentials.session_token", redact(target.Credentials.SessionToken)},
+			{"credentials.role_arn", target.Credentials.RoleARN},
+		} {
+			if isZero(field.value) {
+				continue
+			}
+			setting := c.setting(prefix+field.key, field.value)
+			if ptr, ok := field.value.(*bool); ok {
+				setting.Value = *ptr
+			}
+			settings = append(settings, setting)
+		}
+	}
+
+	return settings
+}
+
+// MarkOverrides returns the settings of after, attributing every value that
+// differs from before to source and keeping the previous source otherwise.
+// It is used to report CLI flag and target overrides.
+func MarkOverrides(before, after []Setting, source string) []Setting {
+	previous := make(map[string]Setting, len(before))
+	for _, s := range before {
+		previous[s.Key] = s
+	}
+
+	marked := make([]Setting, len(after))
+	for i, s := range after {
+		if old, ok := previous[s.Key]; !ok || !reflect.DeepEqual(old.Value, s.Value) {
+			s.Source = source
+		} else {
+			s.Source = old.Source
+		}
+		marked[i] = s
+	}
+	return marked
+}
+
+func (c *Config) setting(key string, value interface{}) Setting {
+	source := SourceDefault
+	if origin, ok := c.origins[key]; ok {
+		source = origin
+	} else {
+		// Map-valued settings are recorded per entry; report the most recent layer.
+		for path, origin := range c.origins {
+			if strings.HasPrefix(path, key+".") && sourceRank(origin) > sourceRank(source) {
+				source = origin
+			}
+		}
+	}
+	return Setting{Key: key, Value: value, Source: source}
+}
+
+// sourceRank orders sources by precedence so merged map settings report the
+// highest layer that contributed an entry.
+func sourceRank(source string) int {
+	switch {
+	case source == SourceDefault:
+		return 0
+	case source == SourceSettings:
+		return 1
+	case strings.HasPrefix(source, "environment:"):
+		return 2
+	case strings.HasPrefix(source, "operation:"):
+		return 3
+	default:
+		return 4
+	}
+}
+
+func (c *Config) hasOrigin(key string) bool {
+	_, ok := c.origins[key]
+	return ok
+}
+
+func (c *Config) setOrigin(key, source string) {
+	if c.origins == nil {
+		c.origins = make(map[string]string)
+	}
+	c.origins[key] = source
+}
+
+// recordOrigins marks every key present in the raw settings map as coming from source.
+func (c *Config) recordOrigins(values map[string]interface{}, prefix, source string) {
+	for key, value := range values {
+		path := prefix + key
+		if nested, ok := stringMap(value); ok {
+			c.recordOrigins(nested, path+".", source)
+			continue
+		}
+		c.setOrigin(path, source)
+	}
+}
+
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return Redacted
+}
+
+func isZero(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	return v.IsZero()
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EnvironmentVariable names the variable DS pipelines set to select an
+// environment overlay when --env is not given.
+const EnvironmentVariable = "DS_ENV"
+
+// EnvironmentNames returns the configured environment overlays in sorted order.
+func (c *Config) EnvironmentNames() []string {
+	return sortedKeys(c.environments)
+}
+
+// HasEnvironment reports whether an overlay with the given name is configured.
+func (c *Config) HasEnvironment(name string) bool {
+	_, ok := c.environments[strings.TrimSpace(name)]
+	return ok
+}
+
+// ForEnvironment returns the configuration with the named environment overlay
+// merged over the base settings. Values from the overlay win over the base
+// settings and defaults; CLI flags are applied on top by the caller.
+// An empty name returns an unmodified copy.
+func (c *Config) ForEnvironment(name string) (*Config, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return c.Clone(), nil
+	}
+	if c.Environment != "" {
+		return nil, fmt.Errorf("environment %q is already applied", c.Environment)
+	}
+
+	overlay, ok := c.environments[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown environment %q", name)
+	}
+
+	source := "environment:" + name
+	resolved, err := c.withOverlay(overlay, source)
+	if err != nil {
+		return nil, fmt.Errorf("environment %q: %w", name, err)
+	}
+	resolved.Environment = name
+	resolved.setOrigin("environment", source)
+
+	return resolved, nil
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LocalFileName is the optional settings file read from the working
+// directory, letting a repository carry its own prefix, header and ignore
+// rules next to its sources.
+const LocalFileName = ".ds-s3.yaml"
+
+// WithLocalFile returns the configuration with the settings of the local file
+// at path deep-merged over the host settings. Environment overlays, operation
+// defaults and CLI flags are still applied on top by the caller. A missing
+// file, or local_config disabled by the host, returns c unchanged and false;
+// a file defining settings outside localKeys is an error.
+func (c *Config) WithLocalFile(path string) (*Config, bool, error) {
+	if !c.LocalConfig {
+		return c, false, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var overlay map[string]interface{}
+	if err := yaml.Unmarshal(data, &overlay); err != nil {
+		return nil, false, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(overlay) == 0 {
+		return c, false, nil
+	}
+	overlay, warnings := migrateSettings(overlay, "")
+	// A checked-in file must not send artifacts or credentials elsewhere or
+	// lift the checks of the host, including through its own environment and
+	// operation overlays, so it may only set what describes the repository.
+	if key, ok := localKey(overlay, ""); ok {
+		return nil, false, fmt.Errorf("%s must not define %s", path, key)
+	}
+
+	resolved, err := c.withOverlay(overlay, SourceLocal)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, warning := range warnings {
+		resolved.deprecations = append(resolved.deprecations, path+": "+warning)
+	}
+	return resolved, true, nil
+}
+
+// localKeys are the top-level settings the local file may define, besides
+// environments and operations overlays holding them: where the repository's
+// artifacts go below the bucket of the host, how its sources are planned and
+// what its uploads carry.
+var localKeys = []string{
+	"context_path",
+	"sources",
+	"request_headers",
+	"user_agent_suffix",
+	"max_depth",
+	"strip_components",
+	"ignore_files",
+	"respect_gitignore",
+	"extract_tar",
+	"decompress",
+	"manifest_key",
+	"latest_key",
+	"skip_if_exists_key",
+	"build_context",
+	"expect",
+}
+
+// localKey returns the first setting outside localKeys defined in settings or
+// in the environments and operations overlays nested within them, as a dotted
+// path below block that leads to a value.
+func localKey(settings map[string]interface{}, block string) (string, bool) {
+	for _, key := range slices.Sorted(maps.Keys(settings)) {
+		if slices.Contains(localKeys, key) {
+			continue
+		}
+		entries, ok := stringMap(settings[key])
+		if key != "environments" && key != "operations" {
+			return leafKey(entries, block+key), true
+		}
+		if !ok {
+			return block + key, true
+		}
+		for _, name := range slices.Sorted(maps.Keys(entries)) {
+			overlay, ok := stringMap(entries[name])
+			if !ok {
+				return block + key + "." + name, true
+			}
+			if nested, ok := localKey(overlay, block+key+"."+name+"."); ok {
+				return nested, true
+			}
+		}
+	}
+	return "", false
+}
+
+// leafKey extends key by the first path through settings, if it is a block,
+// to name the setting the error is about.
+func leafKey(settings map[string]interface{}, key string) string {
+	for len(settings) > 0 {
+		name := slices.Sorted(maps.Keys(settings))[0]
+		key += "." + name
+		settings, _ = stringMap(settings[name])
+	}
+	return key
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PluginSettingsKey is the key under plugins.settings the plugin reads its
+// settings from. LegacyPluginSettingsKeys are still read but deprecated.
+const PluginSettingsKey = "s3"
+
+// LegacyPluginSettingsKeys are the plugin settings keys older releases
+// accepted besides PluginSettingsKey, in increasing precedence.
+var LegacyPluginSettingsKeys = []string{"ds_s3", "ds-s3"}
+
+// Rename maps a setting name older plugin versions accepted onto the current
+// one. Both are dotted paths into the settings map.
+type Rename struct {
+	Old string
+	New string
+}
+
+// Renames lists the renamed settings still read from plugin settings,
+// environment and operation overlays and the local settings file. The
+// schema advertises the old names as deprecated.
+var Renames = []Rename{
+	{Old: "assume_role.role_arn", New: "credentials.role_arn"},
+	{Old: "assume_role.mfa_serial", New: "credentials.mfa_serial"},
+}
+
+// Deprecations lists the deprecated settings c was built from, each with what
+// to change, so that callers can warn about them.
+func (c *Config) Deprecations() []string {
+	return c.deprecations
+}
+
+// migrateSettings returns values with every renamed setting moved to its
+// current name, recursing into environment and operation overlays, and a
+// warning for each one moved. A setting given under both names keeps the
+// current value. values itself is not modified.
+func migrateSettings(values map[string]interface{}, path string) (map[string]interface{}, []string) {
+	if values == nil {
+		return nil, nil
+	}
+	migrated := mergeSettings(nil, values)
+	var warnings []string
+	for _, rename := range Renames {
+		value, ok := lookupSetting(migrated, rename.Old)
+		if !ok {
+			continue
+		}
+		migrated = deleteSetting(migrated, rename.Old)
+		if _, exists := lookupSetting(migrated, rename.New); exists {
+			warnings = append(warnings, fmt.Sprintf("%s%s is deprecated and ignored because %s%s is also set; remove it",
+				path, rename.Old, path, rename.New))
+			continue
+		}
+		migrated = setSetting(migrated, rename.New, value)
+		warnings = append(warnings, fmt.Sprintf("%s%s is deprecated; rename it to %s%s", path, rename.Old, path, rename.New))
+	}
+
+	for _, block := range []string{"environments", "operations"} {
+		entries, ok := stringMap(migrated[block])
+		if !ok {
+			continue
+		}
+		names := make([]string, 0, len(entries))
+		for name := range entries {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		overlays := make(map[string]interface{}, len(entries))
+		for _, name := range names {
+			overlay, ok := stringMap(entries[name])
+			if !ok {
+				// Left for parseOverlays to reject.
+				overlays[name] = entries[name]
+				continue
+			}
+			overlay, overlayWarnings := migrateSettings(overlay, path+block+"."+name+".")
+			overlays[name] = overlay
+			warnings = append(warnings, overlayWarnings...)
+		}
+		migrated[block] = overlays
+	}
+	return migrated, warnings
+}
+
+// lookupSetting reads the dotted path key from values.
+func lookupSetting(values map[string]interface{}, key string) (interface{}, bool) {
+	head, rest, nested := strings.Cut(key, ".")
+	value, ok := values[head]
+	if !ok || !nested {
+		return value, ok
+	}
+	child, ok := stringMap(value)
+	if !ok {
+		return nil, false
+	}
+	return lookupSetting(child, rest)
+}
+
+// deleteSetting returns values without the dotted path key. Maps left empty
+// on the way are dropped too; values itself is not modified.
+func deleteSetting(values map[string]interface{}, key string) map[string]interface{} {
+	head, rest, nested := strings.Cut(key, ".")
+	if _, ok := values[head]; !ok {
+		return values
+	}
+	trimmed := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		trimmed[k] = v
+	}
+	if !nested {
+		delete(trimmed, head)
+		return trimmed
+	}
+	child, ok := stringMap(values[head])
+	if !ok {
+		return values
+	}
+	if child = deleteSetting(child, rest); len(child) == 0 {
+		delete(trimmed, head)
+	} else {
+		trimmed[head] = child
+	}
+	return trimmed
+}
+
+// setSetting stores value under the dotted path key, creating the maps on
+// the way.
+func setSetting(values map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	overlay := map[string]interface{}{}
+	leaf := overlay
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		child := map[string]interface{}{}
+		leaf[part] = child
+		leaf = child
+	}
+	leaf[parts[len(parts)-1]] = value
+	return mergeSettings(values, overlay)
+}
+
+// resolvePluginSettings picks the plugin settings out of the host's plugin
+// settings. Settings under a legacy key are merged beneath those under
+// PluginSettingsKey with a warning.
+func resolvePluginSettings(settings map[string]map[string]interface{}) (map[string]interface{}, []string) {
+	if settings == nil {
+		return nil, nil
+	}
+
+	var resolved map[string]interface{}
+	var warnings []string
+	for _, key := range LegacyPluginSettingsKeys {
+		legacy, ok := settings[key]
+		if !ok {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("plugin settings under %q are deprecated; move them under %q", key, PluginSettingsKey))
+		resolved = mergeSettings(resolved, legacy)
+	}
+	if current, ok := settings[PluginSettingsKey]; ok {
+		if resolved == nil {
+			return current, warnings
+		}
+		resolved = mergeSettings(resolved, current)
+	}
+	return resolved, warnings
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ForOperation returns the configuration with the defaults configured under
+// operations.<name> merged over the current settings. They take precedence
+// over the base settings and the selected environment; CLI flags are applied
+// on top by the caller. Operations without defaults return an unmodified copy.
+func (c *Config) ForOperation(name string) (*Config, error) {
+	name = strings.TrimSpace(name)
+	overlay, ok := c.operations[name]
+	if !ok {
+		return c.Clone(), nil
+	}
+
+	resolved, err := c.withOverlay(overlay, "operation:"+name)
+	if err != nil {
+		return nil, fmt.Errorf("operations.%s: %w", name, err)
+	}
+	return resolved, nil
+}
+
+// OperationNames returns the operations that carry configured defaults in sorted order.
+func (c *Config) OperationNames() []string {
+	return sortedKeys(c.operations)
+}
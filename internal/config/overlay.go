@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// withOverlay decodes the settings c was built from with overlay deep-merged
+// on top, attributing every overlaid key to source. Earlier attributions, the
+// selected environment, host-provided values and deprecation warnings are
+// carried over.
+func (c *Config) withOverlay(overlay map[string]interface{}, source string) (*Config, error) {
+	resolved, err := FromSettingsMap(mergeSettings(c.settings, overlay))
+	if err != nil {
+		return nil, err
+	}
+
+	resolved.origins = c.Clone().origins
+	resolved.recordOrigins(overlay, "", source)
+	resolved.Environment = c.Environment
+	resolved.LogLevel = c.LogLevel
+	resolved.deprecations = append(append([]string{}, c.deprecations...), resolved.deprecations...)
+	return resolved, nil
+}
+
+// parseOverlays extracts a block of named settings overlays (such as
+// environments or operations) from raw plugin settings. Overlays must not
+// contain any of the forbidden top-level keys.
+func parseOverlays(value interface{}, block string, forbidden ...string) (map[string]map[string]interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	entries, ok := stringMap(value)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a map of names to settings", block)
+	}
+
+	overlays := make(map[string]map[string]interface{}, len(entries))
+	for name, entry := range entries {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("%s names must not be empty", block)
+		}
+		overlay, ok := stringMap(entry)
+		if !ok {
+			return nil, fmt.Errorf("%s.%s must be a map of settings", block, name)
+		}
+		for _, key := range forbidden {
+			if _, nested := overlay[key]; nested {
+				return nil, fmt.Errorf("%s.%s must not define %s", block, name, key)
+			}
+		}
+		overlays[name] = overlay
+	}
+	return overlays, nil
+}
+
+// mergeSettings deep-merges overlay over base without modifying either map.
+func mergeSettings(base, overlay map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(overlay))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overlay {
+		if nested, ok := stringMap(value); ok {
+			if existing, ok := stringMap(merged[key]); ok {
+				merged[key] = mergeSettings(existing, nested)
+				continue
+			}
+		}
+		merged[key] = value
+	}
+	return merged
+}
+
+// stringMap normalises the map shapes produced by YAML and JSON decoders.
+func stringMap(value interface{}) (map[string]interface{}, bool) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		return typed, true
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(typed))
+		for k, v := range typed {
+			converted[fmt.Sprint(k)] = v
+		}
+		return converted, true
+	default:
+		return nil, false
+	}
+}
+
+func sortedKeys(overlays map[string]map[string]interface{}) []string {
+	names := make([]string, 0, len(overlays))
+	for name := range overlays {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
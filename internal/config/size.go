@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"kib", 1 << 10},
+	{"mib", 1 << 20},
+	{"gib", 1 << 30},
+	{"tib", 1 << 40},
+	{"kb", 1000},
+	{"mb", 1000 * 1000},
+	{"gb", 1000 * 1000 * 1000},
+	{"tb", 1000 * 1000 * 1000 * 1000},
+	{"k", 1 << 10},
+	{"m", 1 << 20},
+	{"g", 1 << 30},
+	{"t", 1 << 40},
+	{"b", 1},
+}
+
+// ParseByteSize parses sizes such as "1048576", "64MiB", "5MB" or "2g".
+// Binary suffixes (KiB, MiB, GiB, TiB and the single-letter forms) are powers
+// of 1024; KB, MB, GB and TB are powers of 1000. An empty value parses as zero.
+func ParseByteSize(value string) (int64, error) {
+	trimmed := strings.ToLower(strings.TrimSpace(value))
+	if trimmed == "" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(trimmed, unit.suffix) {
+			multiplier = unit.multiplier
+			trimmed = strings.TrimSpace(strings.TrimSuffix(trimmed, unit.suffix))
+			break
+		}
+	}
+
+	if number, err := strconv.ParseInt(trimmed, 10, 64); err == nil {
+		if number < 0 {
+			return 0, fmt.Errorf("invalid size %q", value)
+		}
+		if number > math.MaxInt64/multiplier {
+			return 0, fmt.Errorf("size %q is too large", value)
+		}
+		return number * multiplier, nil
+	}
+
+	// Fractions such as "1.5GiB" go through a float, which is exact for
+	// every size that fits.
+	number, err := strconv.ParseFloat(trimmed, 64)
+	if err != nil || number < 0 || math.IsNaN(number) {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	size := number * float64(multiplier)
+	if size >= math.MaxInt64 {
+		return 0, fmt.Errorf("size %q is too large", value)
+	}
+	return int64(size), nil
+}
+
+// FormatByteSize renders n with the largest binary unit it reaches and one
+// decimal, e.g. "1.5GiB", for messages.
+func FormatByteSize(n int64) string {
+	units := []struct {
+		suffix string
+		size   int64
+	}{{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}}
+	for _, unit := range units {
+		if n >= unit.size {
+			value := strconv.FormatFloat(float64(n)/float64(unit.size), 'f', 1, 64)
+			return strings.TrimSuffix(value, ".0") + unit.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10) + "B"
+}
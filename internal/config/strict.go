@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// overlayBlocks are the settings blocks holding named settings overlays,
+// which are checked key by key rather than decoded as a whole.
+var overlayBlocks = []string{"environments", "operations"}
+
+// mapIndex matches the [name] mapstructure writes for entries of maps such
+// as targets, reported as .name like every other path.
+var mapIndex = regexp.MustCompile(`\[([^\]]*)\]`)
+
+// unknownSettings lists the keys of values, and of the environment and
+// operation overlays in it, that no setting decodes, as sorted dotted paths
+// prefixed with path. Renamed settings must already be migrated.
+func unknownSettings(values map[string]interface{}, path string) ([]string, error) {
+	var metadata mapstructure.Metadata
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		TagName:              "mapstructure",
+		Result:               &rawSettings{},
+		Metadata:             &metadata,
+		WeaklyTypedInput:     true,
+		IgnoreUntaggedFields: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build settings decoder: %w", err)
+	}
+	if err := decoder.Decode(values); err != nil {
+		return nil, fmt.Errorf("failed to decode plugin settings: %w", err)
+	}
+
+	var unknown []string
+	for _, key := range metadata.Unused {
+		if !isOverlayBlock(key) {
+			unknown = append(unknown, path+mapIndex.ReplaceAllString(key, ".$1"))
+		}
+	}
+	for _, block := range overlayBlocks {
+		entries, _ := stringMap(values[block])
+		for name, entry := range entries {
+			overlay, ok := stringMap(entry)
+			if !ok {
+				continue
+			}
+			nested, err := unknownSettings(overlay, fmt.Sprintf("%s%s.%s.", path, block, name))
+			if err != nil {
+				return nil, err
+			}
+			unknown = append(unknown, nested...)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown, nil
+}
+
+func isOverlayBlock(key string) bool {
+	for _, block := range overlayBlocks {
+		if key == block {
+			return true
+		}
+	}
+	return false
+}
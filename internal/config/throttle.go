@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	// Windows name IANA zones, which minimal images often lack.
+	_ "time/tzdata"
+)
+
+// Throttle slows uploads down during recurring windows, such as business
+// hours on a link shared with production traffic, and lets them run at full
+// speed otherwise.
+type Throttle struct {
+	// Timezone is the IANA zone the windows are in; empty is the zone of
+	// the host.
+	Timezone string
+	// Windows are checked in order; the first active one applies.
+	Windows []ThrottleWindow
+}
+
+// Location returns the zone of the windows.
+func (t Throttle) Location() (*time.Location, error) {
+	if t.Timezone == "" {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(t.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid throttle.timezone: %w", err)
+	}
+	return location, nil
+}
+
+// ThrottleWindow limits uploads from Start to End on Days.
+type ThrottleWindow struct {
+	// Days the window starts on; empty means every day.
+	Days []time.Weekday
+	// Start and End are offsets from midnight; an End not after Start ends
+	// on the following day.
+	Start time.Duration
+	End   time.Duration
+	// Concurrency caps the files uploaded at once; zero leaves it unchanged.
+	Concurrency int
+	// Bandwidth caps the bytes per second sent by all uploads together;
+	// zero leaves it unlimited.
+	Bandwidth int64
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseWeekdays parses days such as "mon", "Friday" or ranges such as
+// "mon-fri", which may wrap around the weekend ("fri-mon").
+func parseWeekdays(values []string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	for _, value := range values {
+		first, last, isRange := strings.Cut(value, "-")
+		from, err := parseWeekday(first)
+		if err != nil {
+			return nil, err
+		}
+		to := from
+		if isRange {
+			if to, err = parseWeekday(last); err != nil {
+				return nil, err
+			}
+		}
+		for day := from; ; day = (day + 1) % 7 {
+			days = append(days, day)
+			if day == to {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func parseWeekday(value string) (time.Weekday, error) {
+	name := strings.ToLower(strings.TrimSpace(value))
+	if len(name) >= 3 {
+		if day, ok := weekdays[name[:3]]; ok && strings.HasPrefix(strings.ToLower(day.String()), name) {
+			return day, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid day %q", value)
+}
+
+// parseTimeOfDay parses a 24-hour time such as "08:00" or "17:30" into an
+// offset from midnight; "24:00" is the end of the day.
+func parseTimeOfDay(value string) (time.Duration, error) {
+	hours, minutes, ok := strings.Cut(strings.TrimSpace(value), ":")
+	h, hErr := strconv.Atoi(hours)
+	m, mErr := strconv.Atoi(minutes)
+	if !ok || hErr != nil || mErr != nil || h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
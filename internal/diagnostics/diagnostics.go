@@ -0,0 +1,299 @@
+// Package diagnostics records the S3 requests that failed during a run, with
+// the details support needs to debug them without a re-run at trace level.
+package diagnostics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/delivery-station/ds-s3/internal/backoff"
+)
+
+// Error classes reported for failures.
+const (
+	ClassThrottled = "throttled"
+	ClassAuth      = "auth"
+	ClassNotFound  = "not_found"
+	ClassConflict  = "conflict"
+	ClassClient    = "client"
+	ClassServer    = "server"
+	ClassNetwork   = "network"
+	ClassTimeout   = "timeout"
+	ClassCanceled  = "canceled"
+	ClassUnknown   = "unknown"
+)
+
+// Classes of failed commands whose error is not an S3 failure.
+const (
+	// ClassPartial is an upload that stored some files, or its primary
+	// target, before failing.
+	ClassPartial = "partial"
+	// ClassConfig is a command rejected for its settings or flags.
+	ClassConfig = "config"
+)
+
+// Classes lists every class a failed command can be sorted into.
+var Classes = []string{
+	ClassPartial, ClassConfig, ClassThrottled, ClassAuth, ClassNotFound, ClassConflict,
+	ClassClient, ClassServer, ClassNetwork, ClassTimeout, ClassCanceled, ClassUnknown,
+}
+
+// MaxFailures caps how many failures a Recorder keeps. A run failing on
+// thousands of objects usually fails the same way for all of them, and the
+// latest failures are the ones that ended it.
+const MaxFailures = 100
+
+// Failure describes one failed S3 operation after all its retries.
+type Failure struct {
+	Time       time.Time `json:"time"`
+	Operation  string    `json:"operation"`
+	Bucket     string    `json:"bucket,omitempty"`
+	Key        string    `json:"key,omitempty"`
+	ErrorClass string    `json:"error_class"`
+	ErrorCode  string    `json:"error_code,omitempty"`
+	HTTPStatus int       `json:"http_status,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+	// HostID is S3's extended request id (x-amz-id-2), which AWS support
+	// asks for together with the request id.
+	HostID  string `json:"host_id,omitempty"`
+	Retries int    `json:"retries"`
+	Message string `json:"message"`
+}
+
+// RequestError attaches the ids S3 assigned to a request, x-amz-request-id
+// and x-amz-id-2, to an error that happened after its response arrived, such
+// as a download breaking off. Errors returned by the SDK carry them already.
+type RequestError struct {
+	Err       error
+	RequestID string
+	HostID    string
+}
+
+func (e *RequestError) Error() string {
+	if e.HostID == "" {
+		return fmt.Sprintf("%v (request id %s)", e.Err, e.RequestID)
+	}
+	return fmt.Sprintf("%v (request id %s, host id %s)", e.Err, e.RequestID, e.HostID)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// ServiceRequestID returns the x-amz-request-id of the request, like the
+// response errors of the SDK.
+func (e *RequestError) ServiceRequestID() string {
+	return e.RequestID
+}
+
+// ServiceHostID returns the x-amz-id-2 of the request.
+func (e *RequestError) ServiceHostID() string {
+	return e.HostID
+}
+
+// Recorder collects failed operations of the S3 clients it is installed on.
+// It is safe for concurrent use.
+type Recorder struct {
+	mu       sync.Mutex
+	failures []Failure
+	dropped  int
+}
+
+// NewRecorder returns an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Middleware returns the API option installing the recorder on an S3 client.
+// Besides failed requests it records GetObject response bodies that break off
+// while being read, whose read errors it wraps in a RequestError.
+func (r *Recorder) Middleware() func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		// After the service metadata, so the operation name is known.
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("FailureDiagnostics", r.handle), middleware.After)
+	}
+}
+
+func (r *Recorder) handle(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	out, metadata, err := next.HandleInitialize(ctx, in)
+	failure := Failure{
+		Operation: awsmiddleware.GetOperationName(ctx),
+		Bucket:    stringField(in.Parameters, "Bucket"),
+		Key:       stringField(in.Parameters, "Key"),
+	}
+	if attempts, ok := retry.GetAttemptResults(metadata); ok && len(attempts.Results) > 0 {
+		failure.Retries = len(attempts.Results) - 1
+	}
+	if err != nil {
+		failure.describe(err)
+		if !probe(failure) {
+			r.add(failure)
+		}
+		return out, metadata, err
+	}
+	if object, ok := out.Result.(*s3.GetObjectOutput); ok && object.Body != nil {
+		failure.RequestID, _ = awsmiddleware.GetRequestIDMetadata(metadata)
+		failure.HostID, _ = s3.GetHostIDMetadata(metadata)
+		object.Body = &body{ReadCloser: object.Body, recorder: r, failure: failure}
+	}
+	return out, metadata, err
+}
+
+// body records the response body of a GetObject request breaking off.
+type body struct {
+	io.ReadCloser
+	recorder *Recorder
+	failure  Failure
+	failed   bool
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == nil || err == io.EOF || b.failed {
+		return n, err
+	}
+	b.failed = true
+	if b.failure.RequestID != "" || b.failure.HostID != "" {
+		err = &RequestError{Err: err, RequestID: b.failure.RequestID, HostID: b.failure.HostID}
+	}
+	failure := b.failure
+	failure.describe(err)
+	b.recorder.add(failure)
+	return n, err
+}
+
+func (r *Recorder) add(failure Failure) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.failures) >= MaxFailures {
+		r.failures = r.failures[1:]
+		r.dropped++
+	}
+	r.failures = append(r.failures, failure)
+}
+
+// probe reports whether failure is the lookup of a missing object, which is
+// how callers check whether an object exists rather than a failure.
+func probe(failure Failure) bool {
+	switch failure.Operation {
+	case "HeadObject", "GetObject":
+		return failure.ErrorClass == ClassNotFound && failure.ErrorCode != "NoSuchBucket"
+	}
+	return false
+}
+
+// Failures returns the latest recorded failures in the order they happened
+// and how many earlier ones were dropped beyond MaxFailures.
+func (r *Recorder) Failures() ([]Failure, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Failure(nil), r.failures...), r.dropped
+}
+
+// Describe returns what err tells about a failure: its class, the S3 error
+// code, HTTP status and request ids when a response was received.
+func Describe(err error) Failure {
+	var failure Failure
+	failure.describe(err)
+	return failure
+}
+
+func (f *Failure) describe(err error) {
+	f.Time = time.Now().UTC()
+	f.ErrorClass = Classify(err)
+	f.Message = err.Error()
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		f.ErrorCode = apiErr.ErrorCode()
+	}
+	var withStatus interface{ HTTPStatusCode() int }
+	if errors.As(err, &withStatus) {
+		f.HTTPStatus = withStatus.HTTPStatusCode()
+	}
+	var withRequestID interface{ ServiceRequestID() string }
+	if errors.As(err, &withRequestID) {
+		f.RequestID = withRequestID.ServiceRequestID()
+	}
+	var withHostID interface{ ServiceHostID() string }
+	if errors.As(err, &withHostID) {
+		f.HostID = withHostID.ServiceHostID()
+	}
+}
+
+// Classify sorts err into one of the error classes.
+func Classify(err error) string {
+	if errors.Is(err, context.Canceled) {
+		return ClassCanceled
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ClassTimeout
+	}
+	if backoff.IsThrottle(err) {
+		return ClassThrottled
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch", "ExpiredToken", "InvalidToken", "AllAccessDisabled":
+			return ClassAuth
+		case "NoSuchBucket", "NoSuchKey", "NoSuchUpload", "NotFound":
+			return ClassNotFound
+		case "PreconditionFailed", "ConditionalRequestConflict", "OperationAborted":
+			return ClassConflict
+		}
+	}
+	var withStatus interface{ HTTPStatusCode() int }
+	if errors.As(err, &withStatus) {
+		switch status := withStatus.HTTPStatusCode(); {
+		case status == http.StatusUnauthorized || status == http.StatusForbidden:
+			return ClassAuth
+		case status == http.StatusNotFound:
+			return ClassNotFound
+		case status == http.StatusConflict || status == http.StatusPreconditionFailed:
+			return ClassConflict
+		case status >= 500:
+			return ClassServer
+		case status >= 400:
+			return ClassClient
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ClassTimeout
+		}
+		return ClassNetwork
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return ClassNetwork
+	}
+	return ClassUnknown
+}
+
+// stringField returns the *string field name of the operation input params,
+// such as the Bucket or Key most S3 inputs carry.
+func stringField(params interface{}, name string) string {
+	value := reflect.ValueOf(params)
+	if value.Kind() != reflect.Pointer || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return ""
+	}
+	field := value.Elem().FieldByName(name)
+	if !field.IsValid() || field.Kind() != reflect.Pointer || field.IsNil() || field.Elem().Kind() != reflect.String {
+		return ""
+	}
+	return field.Elem().String()
+}
@@ -0,0 +1,161 @@
+package diagnostics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+func TestRecorderCapturesFailedOperations(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-amz-request-id", "REQ123")
+		w.Header().Set("x-amz-id-2", "HOST456")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`<Error><Code>SlowDown</Code><Message>Please reduce your request rate.</Message></Error>`))
+	}))
+	defer server.Close()
+
+	recorder := NewRecorder()
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		Retryer: retry.NewStandard(func(o *retry.StandardOptions) {
+			o.MaxAttempts = 3
+			o.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+		}),
+		APIOptions: []func(*middleware.Stack) error{recorder.Middleware()},
+	})
+
+	_, err := client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String("artifacts"),
+		Key:    aws.String("releases/app.tar"),
+		Body:   strings.NewReader("data"),
+	})
+	if err == nil {
+		t.Fatal("expected PutObject to fail")
+	}
+
+	failures, dropped := recorder.Failures()
+	if len(failures) != 1 || dropped != 0 {
+		t.Fatalf("expected one recorded failure, got %d (%d dropped)", len(failures), dropped)
+	}
+	got := failures[0]
+	if got.Operation != "PutObject" || got.Bucket != "artifacts" || got.Key != "releases/app.tar" {
+		t.Errorf("unexpected operation %+v", got)
+	}
+	if got.ErrorClass != ClassThrottled || got.ErrorCode != "SlowDown" || got.HTTPStatus != http.StatusServiceUnavailable {
+		t.Errorf("unexpected classification %+v", got)
+	}
+	if got.RequestID != "REQ123" || got.HostID != "HOST456" {
+		t.Errorf("unexpected request ids %+v", got)
+	}
+	if got.Retries != 2 {
+		t.Errorf("expected 2 retries, got %d", got.Retries)
+	}
+}
+
+func TestRecorderCapturesBrokenDownloads(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-amz-request-id", "REQ789")
+		w.Header().Set("x-amz-id-2", "HOST012")
+		w.Header().Set("Content-Length", "1024")
+		_, _ = w.Write([]byte("partial"))
+	}))
+	defer server.Close()
+
+	recorder := NewRecorder()
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		APIOptions:   []func(*middleware.Stack) error{recorder.Middleware()},
+	})
+
+	out, err := client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("artifacts"),
+		Key:    aws.String("releases/app.tar"),
+	})
+	if err != nil {
+		t.Fatalf("GetObject returned error: %v", err)
+	}
+	defer func() {
+		_ = out.Body.Close()
+	}()
+	_, err = io.ReadAll(out.Body)
+	if err == nil || !strings.Contains(err.Error(), "request id REQ789, host id HOST012") {
+		t.Fatalf("expected the read error to carry the request ids, got %v", err)
+	}
+
+	failures, _ := recorder.Failures()
+	if len(failures) != 1 {
+		t.Fatalf("expected one recorded failure, got %d", len(failures))
+	}
+	if got := failures[0]; got.Operation != "GetObject" || got.Key != "releases/app.tar" || got.RequestID != "REQ789" || got.ErrorClass != ClassNetwork {
+		t.Errorf("unexpected failure %+v", got)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	response := func(status int, code string) error {
+		return &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+			Err:      &smithy.GenericAPIError{Code: code},
+		}
+	}
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{response(http.StatusForbidden, "AccessDenied"), ClassAuth},
+		{response(http.StatusNotFound, "NoSuchBucket"), ClassNotFound},
+		{response(http.StatusPreconditionFailed, "PreconditionFailed"), ClassConflict},
+		{response(http.StatusTooManyRequests, ""), ClassThrottled},
+		{response(http.StatusBadGateway, ""), ClassServer},
+		{response(http.StatusBadRequest, "InvalidArgument"), ClassClient},
+		{context.Canceled, ClassCanceled},
+		{context.DeadlineExceeded, ClassTimeout},
+		{errors.New("boom"), ClassUnknown},
+	}
+	for _, tc := range cases {
+		if got := Classify(tc.err); got != tc.want {
+			t.Errorf("Classify(%v) = %q, want %q", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestRecorderKeepsLatestFailures(t *testing.T) {
+	recorder := NewRecorder()
+	recorder.add(Failure{Operation: "HeadObject", ErrorClass: ClassNotFound})
+	for i := 0; i < MaxFailures+5; i++ {
+		recorder.add(Failure{Operation: "PutObject", Retries: i})
+	}
+	failures, dropped := recorder.Failures()
+	if len(failures) != MaxFailures || dropped != 6 {
+		t.Fatalf("expected %d failures and 6 dropped, got %d and %d", MaxFailures, len(failures), dropped)
+	}
+	if last := failures[len(failures)-1]; last.Retries != MaxFailures+4 {
+		t.Errorf("expected the latest failure last, got %+v", last)
+	}
+	if !probe(Failure{Operation: "HeadObject", ErrorClass: ClassNotFound, ErrorCode: "NotFound"}) {
+		t.Error("expected a missing object lookup to count as a probe")
+	}
+	if probe(Failure{Operation: "GetObject", ErrorClass: ClassNotFound, ErrorCode: "NoSuchBucket"}) {
+		t.Error("expected a missing bucket not to count as a probe")
+	}
+}
@@ -0,0 +1,62 @@
+package diagnostics
+
+import (
+	"context"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/hashicorp/go-hclog"
+)
+
+// Trace returns the API option logging every S3 request at trace level with
+// its operation, bucket, key, duration, HTTP status, retries and request id.
+// The duration includes the time spent retrying.
+func Trace(logger hclog.Logger) func(*middleware.Stack) error {
+	handle := func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		started := time.Now()
+		out, metadata, err := next.HandleInitialize(ctx, in)
+
+		fields := []interface{}{
+			"operation", awsmiddleware.GetOperationName(ctx),
+			"bucket", stringField(in.Parameters, "Bucket"),
+		}
+		if key := stringField(in.Parameters, "Key"); key != "" {
+			fields = append(fields, "key", key)
+		}
+		fields = append(fields, "duration", time.Since(started))
+
+		var failure Failure
+		if err != nil {
+			failure.describe(err)
+		}
+		status := failure.HTTPStatus
+		if response, ok := awsmiddleware.GetRawResponse(metadata).(*smithyhttp.Response); ok && response != nil {
+			status = response.StatusCode
+		}
+		if status != 0 {
+			fields = append(fields, "status", status)
+		}
+		if attempts, ok := retry.GetAttemptResults(metadata); ok && len(attempts.Results) > 0 {
+			fields = append(fields, "retries", len(attempts.Results)-1)
+		}
+		requestID, _ := awsmiddleware.GetRequestIDMetadata(metadata)
+		if requestID == "" {
+			requestID = failure.RequestID
+		}
+		if requestID != "" {
+			fields = append(fields, "request_id", requestID)
+		}
+		if err != nil {
+			fields = append(fields, "error_class", failure.ErrorClass, "error", err)
+		}
+		logger.Trace("S3 request", fields...)
+		return out, metadata, err
+	}
+	return func(stack *middleware.Stack) error {
+		// After the service metadata, so the operation name is known.
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("RequestTrace", handle), middleware.After)
+	}
+}
@@ -0,0 +1,65 @@
+package diagnostics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestTraceLogsEveryRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-amz-request-id", "REQ123")
+		w.Header().Set("Content-Length", "4")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var output bytes.Buffer
+	logger := hclog.New(&hclog.LoggerOptions{Output: &output, Level: hclog.Trace, JSONFormat: true})
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		APIOptions:   []func(*middleware.Stack) error{Trace(logger)},
+	})
+
+	if _, err := client.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("artifacts"),
+		Key:    aws.String("releases/app.tar"),
+	}); err != nil {
+		t.Fatalf("HeadObject returned error: %v", err)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(output.Bytes(), &entry); err != nil {
+		t.Fatalf("expected one JSON log entry, got %q: %v", output.String(), err)
+	}
+	want := map[string]interface{}{
+		"@level":     "trace",
+		"@message":   "S3 request",
+		"operation":  "HeadObject",
+		"bucket":     "artifacts",
+		"key":        "releases/app.tar",
+		"status":     float64(http.StatusOK),
+		"retries":    float64(0),
+		"request_id": "REQ123",
+	}
+	for field, value := range want {
+		if entry[field] != value {
+			t.Errorf("expected %s %v, got %v", field, value, entry[field])
+		}
+	}
+	if _, ok := entry["duration"]; !ok {
+		t.Error("expected the duration to be logged")
+	}
+}
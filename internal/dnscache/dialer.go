@@ -0,0 +1,124 @@
+// Package dnscache provides a dialer that resolves a storage endpoint once,
+// or pins it to static addresses, and re-resolves only when dialing fails.
+package dnscache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// DialFunc matches net.Dialer.DialContext.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// LookupFunc matches net.Resolver.LookupHost.
+type LookupFunc func(ctx context.Context, host string) ([]string, error)
+
+// Dialer caches the addresses of one endpoint host. Connections to other hosts,
+// such as credential providers, are dialed unchanged.
+type Dialer struct {
+	host   string
+	dial   DialFunc
+	lookup LookupFunc
+
+	mu     sync.Mutex
+	cached []string
+}
+
+// NewDialer returns a Dialer for host and its subdomains (virtual-hosted
+// bucket names). Pinned addresses are used instead of DNS until none of them
+// accepts a connection.
+func NewDialer(host string, pinned []string, dial DialFunc, lookup LookupFunc) *Dialer {
+	return &Dialer{
+		host:   strings.ToLower(strings.TrimSuffix(host, ".")),
+		dial:   dial,
+		lookup: lookup,
+		cached: append([]string{}, pinned...),
+	}
+}
+
+// DialContext connects to address, substituting the cached addresses of the
+// endpoint host. When every cached address fails the host is resolved again
+// and the fresh addresses are tried and cached.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || !d.matches(host) {
+		return d.dial(ctx, network, address)
+	}
+
+	cached, err := d.addresses(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	conn, dialErr := d.dialAny(ctx, network, cached, port)
+	if dialErr == nil {
+		return conn, nil
+	}
+	if ctx.Err() != nil {
+		return nil, dialErr
+	}
+
+	fresh, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, errors.Join(dialErr, fmt.Errorf("re-resolving %s: %w", host, err))
+	}
+	d.store(fresh)
+	conn, err = d.dialAny(ctx, network, fresh, port)
+	if err != nil {
+		return nil, errors.Join(dialErr, err)
+	}
+	return conn, nil
+}
+
+func (d *Dialer) matches(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	return host == d.host || strings.HasSuffix(host, "."+d.host)
+}
+
+// addresses returns the cached addresses, resolving host on first use.
+func (d *Dialer) addresses(ctx context.Context, host string) ([]string, error) {
+	d.mu.Lock()
+	cached := d.cached
+	d.mu.Unlock()
+	if len(cached) > 0 {
+		return cached, nil
+	}
+
+	resolved, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", host, err)
+	}
+	d.store(resolved)
+	return resolved, nil
+}
+
+func (d *Dialer) store(addresses []string) {
+	if len(addresses) == 0 {
+		return
+	}
+	d.mu.Lock()
+	d.cached = append([]string{}, addresses...)
+	d.mu.Unlock()
+}
+
+func (d *Dialer) dialAny(ctx context.Context, network string, addresses []string, port string) (net.Conn, error) {
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no addresses for %s", d.host)
+	}
+
+	var errs []error
+	for _, address := range addresses {
+		conn, err := d.dial(ctx, network, net.JoinHostPort(address, port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,107 @@
+package dnscache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+)
+
+type recorder struct {
+	mu      sync.Mutex
+	dialed  []string
+	lookups int
+	refuse  map[string]bool
+	answers [][]string
+}
+
+func (r *recorder) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dialed = append(r.dialed, address)
+	host, _, _ := net.SplitHostPort(address)
+	if r.refuse[host] {
+		return nil, errors.New("connection refused")
+	}
+	client, server := net.Pipe()
+	_ = server.Close()
+	return client, nil
+}
+
+func (r *recorder) lookup(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lookups >= len(r.answers) {
+		return nil, errors.New("no such host")
+	}
+	answer := r.answers[r.lookups]
+	r.lookups++
+	return answer, nil
+}
+
+func TestDialerResolvesOnce(t *testing.T) {
+	rec := &recorder{answers: [][]string{{"10.0.0.1"}, {"10.0.0.2"}}}
+	dialer := NewDialer("minio.internal", nil, rec.dial, rec.lookup)
+
+	for i := 0; i < 3; i++ {
+		conn, err := dialer.DialContext(context.Background(), "tcp", "minio.internal:9000")
+		if err != nil {
+			t.Fatalf("dial %d failed: %v", i, err)
+		}
+		_ = conn.Close()
+	}
+
+	if rec.lookups != 1 {
+		t.Fatalf("expected a single lookup, got %d", rec.lookups)
+	}
+	for _, address := range rec.dialed {
+		if address != "10.0.0.1:9000" {
+			t.Fatalf("expected cached address, dialed %s", address)
+		}
+	}
+}
+
+func TestDialerReResolvesWhenPinnedAddressesFail(t *testing.T) {
+	rec := &recorder{
+		refuse:  map[string]bool{"10.0.0.1": true, "10.0.0.2": true},
+		answers: [][]string{{"10.0.0.3"}},
+	}
+	dialer := NewDialer("minio.internal", []string{"10.0.0.1", "10.0.0.2"}, rec.dial, rec.lookup)
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", "bucket.minio.internal:443")
+	if err != nil {
+		t.Fatalf("expected fallback dial to succeed: %v", err)
+	}
+	_ = conn.Close()
+
+	want := []string{"10.0.0.1:443", "10.0.0.2:443", "10.0.0.3:443"}
+	if len(rec.dialed) != len(want) {
+		t.Fatalf("expected dials %v, got %v", want, rec.dialed)
+	}
+	for i := range want {
+		if rec.dialed[i] != want[i] {
+			t.Fatalf("expected dials %v, got %v", want, rec.dialed)
+		}
+	}
+
+	// The re-resolved address is cached for later connections.
+	if _, err := dialer.DialContext(context.Background(), "tcp", "minio.internal:443"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.lookups != 1 || rec.dialed[len(rec.dialed)-1] != "10.0.0.3:443" {
+		t.Fatalf("expected the fresh address to be reused, got %v after %d lookups", rec.dialed, rec.lookups)
+	}
+}
+
+func TestDialerLeavesOtherHostsAlone(t *testing.T) {
+	rec := &recorder{}
+	dialer := NewDialer("minio.internal", []string{"10.0.0.1"}, rec.dial, rec.lookup)
+
+	if _, err := dialer.DialContext(context.Background(), "tcp", "sts.amazonaws.com:443"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rec.dialed) != 1 || rec.dialed[0] != "sts.amazonaws.com:443" {
+		t.Fatalf("expected other hosts to be dialed unchanged, got %v", rec.dialed)
+	}
+}
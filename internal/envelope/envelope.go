@@ -0,0 +1,269 @@
+// Package envelope implements client-side envelope encryption: every object is
+// sealed with its own random AES-256-GCM data key, and the data key is stored
+// next to the object in its metadata, wrapped with a master key that never
+// leaves KMS or the machine running the plugin.
+package envelope
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// Metadata keys (stored as x-amz-meta-*) describing an encrypted object.
+const (
+	// MetadataKey holds the wrapped data key, base64 encoded.
+	MetadataKey = "ds-envelope-key"
+	// MetadataWrap names the KeyWrapper that wrapped the data key.
+	MetadataWrap = "ds-envelope-wrap"
+	// MetadataSize holds the length of the plaintext.
+	MetadataSize = "ds-envelope-size"
+)
+
+const (
+	formatVersion = 1
+	dataKeySize   = 32
+	prefixSize    = 7
+	headerSize    = 1 + prefixSize
+	chunkSize     = 64 * 1024
+	tagSize       = 16
+)
+
+// ErrAuthentication is returned when ciphertext was modified, truncated or
+// sealed with a different key.
+var ErrAuthentication = errors.New("encrypted content failed authentication")
+
+// KeyWrapper protects data keys with a master key.
+type KeyWrapper interface {
+	// Name identifies the wrapping scheme in object metadata.
+	Name() string
+	Wrap(ctx context.Context, dataKey []byte) ([]byte, error)
+	Unwrap(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// Envelope encrypts and decrypts object content with data keys protected by
+// its KeyWrapper.
+type Envelope struct {
+	wrapper KeyWrapper
+}
+
+// New returns an Envelope wrapping data keys with wrapper.
+func New(wrapper KeyWrapper) *Envelope {
+	return &Envelope{wrapper: wrapper}
+}
+
+// Encrypt returns a reader producing the ciphertext of the size bytes read
+// from plain, the length of that ciphertext and the metadata to store with
+// the object. Content is sealed in 64 KiB chunks as it is read, so objects of
+// any size are encrypted without buffering them.
+func (e *Envelope) Encrypt(ctx context.Context, plain io.Reader, size int64) (io.Reader, int64, map[string]string, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	wrapped, err := e.wrapper.Wrap(ctx, dataKey)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	header := make([]byte, headerSize, headerSize+chunkSize+tagSize)
+	header[0] = formatVersion
+	if _, err := rand.Read(header[1:]); err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	reader := &sealReader{
+		stream: stream{aead: aead, src: bufio.NewReader(plain)},
+		plain:  make([]byte, chunkSize),
+		out:    header,
+	}
+	copy(reader.prefix[:], header[1:])
+
+	metadata := map[string]string{
+		MetadataKey:  base64.StdEncoding.EncodeToString(wrapped),
+		MetadataWrap: e.wrapper.Name(),
+		MetadataSize: strconv.FormatInt(size, 10),
+	}
+	return reader, CiphertextSize(size), metadata, nil
+}
+
+// Decrypt returns a reader producing the plaintext of an object encrypted by
+// Encrypt, given the object's metadata. Reads fail with ErrAuthentication as
+// soon as a modified or truncated chunk is found.
+func (e *Envelope) Decrypt(ctx context.Context, ciphertext io.Reader, metadata map[string]string) (io.Reader, error) {
+	if wrap := metadata[MetadataWrap]; wrap != e.wrapper.Name() {
+		return nil, fmt.Errorf("data key is wrapped with %q, but %q is configured", wrap, e.wrapper.Name())
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(metadata[MetadataKey])
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrapped data key: %w", err)
+	}
+	dataKey, err := e.wrapper.Unwrap(ctx, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	src := bufio.NewReader(ciphertext)
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return nil, ErrAuthentication
+	}
+	if header[0] != formatVersion {
+		return nil, fmt.Errorf("unsupported encryption format version %d", header[0])
+	}
+
+	reader := &openReader{
+		stream: stream{aead: aead, src: src},
+		sealed: make([]byte, chunkSize+tagSize),
+	}
+	copy(reader.prefix[:], header[1:])
+	return reader, nil
+}
+
+// IsEncrypted reports whether metadata describes an object sealed by Encrypt.
+func IsEncrypted(metadata map[string]string) bool {
+	_, ok := metadata[MetadataKey]
+	return ok
+}
+
+// Encrypted reports whether an object stored with metadata was encrypted by
+// an Envelope; see IsEncrypted.
+func (e *Envelope) Encrypted(metadata map[string]string) bool {
+	return IsEncrypted(metadata)
+}
+
+// CiphertextSize returns the length of the ciphertext of size plaintext bytes.
+func CiphertextSize(size int64) int64 {
+	chunks := (size + chunkSize - 1) / chunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	return headerSize + size + chunks*tagSize
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// stream holds the state shared by both directions. Each chunk is sealed
+// under the nonce prefix || chunk counter || last-chunk flag, so reordered,
+// dropped or truncated chunks fail authentication.
+type stream struct {
+	aead    cipher.AEAD
+	src     *bufio.Reader
+	prefix  [prefixSize]byte
+	counter uint32
+	nonce   [12]byte
+}
+
+func (s *stream) chunkNonce(last bool) ([]byte, error) {
+	if s.counter == math.MaxUint32 {
+		return nil, errors.New("encrypted content exceeds the maximum size")
+	}
+	copy(s.nonce[:], s.prefix[:])
+	binary.BigEndian.PutUint32(s.nonce[prefixSize:], s.counter)
+	s.nonce[11] = 0
+	if last {
+		s.nonce[11] = 1
+	}
+	s.counter++
+	return s.nonce[:], nil
+}
+
+// readChunk fills buf from the source and reports whether it was the final
+// chunk of the stream.
+func (s *stream) readChunk(buf []byte) (int, bool, error) {
+	n, err := io.ReadFull(s.src, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return n, true, nil
+	}
+	if err != nil {
+		return n, false, err
+	}
+	if _, err := s.src.Peek(1); err != nil {
+		if errors.Is(err, io.EOF) {
+			return n, true, nil
+		}
+		return n, false, err
+	}
+	return n, false, nil
+}
+
+type sealReader struct {
+	stream
+	plain []byte
+	out   []byte
+	done  bool
+}
+
+func (r *sealReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		n, last, err := r.readChunk(r.plain)
+		if err != nil {
+			return 0, err
+		}
+		nonce, err := r.chunkNonce(last)
+		if err != nil {
+			return 0, err
+		}
+		r.out = r.aead.Seal(r.out[:0], nonce, r.plain[:n], nil)
+		r.done = last
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+type openReader struct {
+	stream
+	sealed []byte
+	out    []byte
+	done   bool
+}
+
+func (r *openReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		n, last, err := r.readChunk(r.sealed)
+		if err != nil {
+			return 0, err
+		}
+		nonce, err := r.chunkNonce(last)
+		if err != nil {
+			return 0, err
+		}
+		if r.out, err = r.aead.Open(r.out[:0], nonce, r.sealed[:n], nil); err != nil {
+			return 0, ErrAuthentication
+		}
+		r.done = last
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
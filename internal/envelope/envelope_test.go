@@ -0,0 +1,99 @@
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+func testEnvelope(t *testing.T) *Envelope {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	wrapper, err := NewAESWrapper(key)
+	if err != nil {
+		t.Fatalf("NewAESWrapper returned error: %v", err)
+	}
+	return New(wrapper)
+}
+
+func seal(t *testing.T, e *Envelope, plain []byte) ([]byte, map[string]string) {
+	t.Helper()
+	reader, size, metadata, err := e.Encrypt(context.Background(), bytes.NewReader(plain), int64(len(plain)))
+	if err != nil {
+		t.Fatalf("Encrypt returned error: %v", err)
+	}
+	sealed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to read ciphertext: %v", err)
+	}
+	if int64(len(sealed)) != size {
+		t.Fatalf("ciphertext is %d bytes, expected %d", len(sealed), size)
+	}
+	return sealed, metadata
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	e := testEnvelope(t)
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 17} {
+		plain := make([]byte, size)
+		if _, err := rand.Read(plain); err != nil {
+			t.Fatalf("failed to generate content: %v", err)
+		}
+
+		sealed, metadata := seal(t, e, plain)
+		if size > 0 && bytes.Contains(sealed, plain) {
+			t.Fatalf("ciphertext of %d bytes contains the plaintext", size)
+		}
+		if !IsEncrypted(metadata) || metadata[MetadataWrap] != WrapAESGCM {
+			t.Fatalf("unexpected metadata %v", metadata)
+		}
+
+		reader, err := e.Decrypt(context.Background(), bytes.NewReader(sealed), metadata)
+		if err != nil {
+			t.Fatalf("Decrypt returned error: %v", err)
+		}
+		opened, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("failed to decrypt %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(opened, plain) {
+			t.Fatalf("round trip of %d bytes changed the content", size)
+		}
+	}
+}
+
+func TestEnvelopeDetectsTampering(t *testing.T) {
+	e := testEnvelope(t)
+	plain := bytes.Repeat([]byte("artifact"), chunkSize/4)
+	sealed, metadata := seal(t, e, plain)
+
+	cases := map[string][]byte{
+		"modified":  append(append([]byte{}, sealed[:headerSize+10]...), append([]byte{sealed[headerSize+10] ^ 1}, sealed[headerSize+11:]...)...),
+		"truncated": sealed[:headerSize+chunkSize+tagSize],
+	}
+	for name, ciphertext := range cases {
+		reader, err := e.Decrypt(context.Background(), bytes.NewReader(ciphertext), metadata)
+		if err != nil {
+			t.Fatalf("%s: Decrypt returned error: %v", name, err)
+		}
+		if _, err := io.ReadAll(reader); !errors.Is(err, ErrAuthentication) {
+			t.Errorf("%s: expected ErrAuthentication, got %v", name, err)
+		}
+	}
+
+	if _, err := testEnvelope(t).Decrypt(context.Background(), bytes.NewReader(sealed), metadata); err == nil {
+		t.Error("expected a different key to fail unwrapping the data key")
+	}
+}
+
+func TestNewAESWrapperRejectsShortKeys(t *testing.T) {
+	if _, err := NewAESWrapper(make([]byte, 16)); err == nil {
+		t.Fatal("expected a 16-byte key to be rejected")
+	}
+}
@@ -0,0 +1,105 @@
+package envelope
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+// Names of the supported KeyWrapper schemes.
+const (
+	WrapKMS    = "kms"
+	WrapAESGCM = "aes-gcm"
+)
+
+// KMSClient is the subset of the KMS API used to wrap data keys.
+type KMSClient interface {
+	Encrypt(ctx context.Context, params *kms.EncryptInput, optFns ...func(*kms.Options)) (*kms.EncryptOutput, error)
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+type kmsWrapper struct {
+	client KMSClient
+	keyID  string
+}
+
+// NewKMSWrapper wraps data keys with the KMS key keyID, which may be a key id,
+// key ARN, alias name or alias ARN.
+func NewKMSWrapper(client KMSClient, keyID string) KeyWrapper {
+	return &kmsWrapper{client: client, keyID: keyID}
+}
+
+func (w *kmsWrapper) Name() string {
+	return WrapKMS
+}
+
+func (w *kmsWrapper) Wrap(ctx context.Context, dataKey []byte) ([]byte, error) {
+	response, err := w.client.Encrypt(ctx, &kms.EncryptInput{
+		KeyId:     aws.String(w.keyID),
+		Plaintext: dataKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response.CiphertextBlob, nil
+}
+
+// Unwrap passes the configured key along, so KMS refuses data keys wrapped by
+// any other key instead of silently using it.
+func (w *kmsWrapper) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	response, err := w.client.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:          aws.String(w.keyID),
+		CiphertextBlob: wrapped,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response.Plaintext, nil
+}
+
+type aesWrapper struct {
+	key []byte
+}
+
+// NewAESWrapper wraps data keys with AES-256-GCM under key, which must be 32
+// bytes long.
+func NewAESWrapper(key []byte) (KeyWrapper, error) {
+	if len(key) != dataKeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", dataKeySize, len(key))
+	}
+	return &aesWrapper{key: key}, nil
+}
+
+func (w *aesWrapper) Name() string {
+	return WrapAESGCM
+}
+
+func (w *aesWrapper) Wrap(ctx context.Context, dataKey []byte) ([]byte, error) {
+	aead, err := newAEAD(w.key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(dataKey)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, dataKey, nil), nil
+}
+
+func (w *aesWrapper) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	aead, err := newAEAD(w.key)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrAuthentication
+	}
+	dataKey, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrAuthentication
+	}
+	return dataKey, nil
+}
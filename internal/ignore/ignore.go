@@ -0,0 +1,160 @@
+// Package ignore matches paths against rules written in gitignore syntax, as
+// found in the .s3ignore and .dsignore files of upload sources.
+package ignore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+type rule struct {
+	// base is the directory holding the ignore file, relative to the source
+	// root and slash separated; empty for the root itself.
+	base     string
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// Matcher decides whether paths below a source root are ignored. Rules are
+// evaluated in the order they were added and the last matching rule wins, so
+// ignore files of a directory must be added after those of its parents. A
+// Matcher must not be modified while it is used concurrently.
+type Matcher struct {
+	rules []rule
+}
+
+// Clone returns a copy of m that rules can be added to without affecting m,
+// such as the matcher of a subdirectory.
+func (m *Matcher) Clone() *Matcher {
+	return &Matcher{rules: m.rules[:len(m.rules):len(m.rules)]}
+}
+
+// AddFile adds the rules of the ignore file at file, which lives in the
+// directory base relative to the source root. A missing file adds nothing.
+func (m *Matcher) AddFile(base, file string) error {
+	handle, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open ignore file %s: %w", file, err)
+	}
+	defer func() {
+		_ = handle.Close()
+	}()
+	if err := m.Add(base, handle); err != nil {
+		return fmt.Errorf("failed to read ignore file %s: %w", file, err)
+	}
+	return nil
+}
+
+// Add parses rules in gitignore syntax from r and adds them for the directory
+// base relative to the source root.
+func (m *Matcher) Add(base string, r io.Reader) error {
+	base = strings.Trim(base, "/")
+	if base == "." {
+		base = ""
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if parsed, ok := parseRule(scanner.Text()); ok {
+			parsed.base = base
+			m.rules = append(m.rules, parsed)
+		}
+	}
+	return scanner.Err()
+}
+
+// Ignored reports whether the slash-separated path rel, relative to the source
+// root, is ignored. dir tells whether rel is a directory.
+func (m *Matcher) Ignored(rel string, dir bool) bool {
+	if m == nil {
+		return false
+	}
+	ignored := false
+	for _, r := range m.rules {
+		if r.dirOnly && !dir {
+			continue
+		}
+		name := rel
+		if r.base != "" {
+			if !strings.HasPrefix(rel, r.base+"/") {
+				continue
+			}
+			name = rel[len(r.base)+1:]
+		}
+		if match(r.segments, strings.Split(name, "/")) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+func parseRule(line string) (rule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	// Trailing spaces are dropped unless escaped with a backslash.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule{}, false
+	}
+
+	var parsed rule
+	// A leading \! or \# stays escaped, which path.Match understands.
+	if strings.HasPrefix(line, "!") {
+		parsed.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		parsed.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule{}, false
+	}
+
+	// Patterns with a slash at the start or in the middle are relative to
+	// the directory of the ignore file; others match at any depth.
+	anchored := strings.Contains(line, "/")
+	parsed.segments = strings.Split(strings.TrimPrefix(line, "/"), "/")
+	if !anchored {
+		parsed.segments = append([]string{"**"}, parsed.segments...)
+	}
+	return parsed, true
+}
+
+// match reports whether the path segments name match the pattern segments,
+// where a ** segment matches any number of path segments. A trailing **
+// matches everything inside a directory but not the directory itself.
+func match(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			if len(rest) == 0 {
+				return len(name) > 0
+			}
+			for i := 0; i <= len(name); i++ {
+				if match(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
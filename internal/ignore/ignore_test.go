@@ -0,0 +1,77 @@
+package ignore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatcherFollowsGitignoreSyntax(t *testing.T) {
+	var m Matcher
+	rules := `
+# comment
+*.log
+!keep.log
+build/
+/top.txt
+docs/**/*.tmp
+cache/**
+\#literal
+`
+	if err := m.Add("", strings.NewReader(rules+"trailing\\ \nspaced.txt  \n")); err != nil {
+		t.Fatalf("Add returned error: %v", err)
+	}
+
+	cases := []struct {
+		path    string
+		dir     bool
+		ignored bool
+	}{
+		{"app.log", false, true},
+		{"nested/deep/app.log", false, true},
+		{"keep.log", false, false},
+		{"nested/keep.log", false, false},
+		{"build", true, true},
+		{"src/build", true, true},
+		{"build", false, false},
+		{"top.txt", false, true},
+		{"nested/top.txt", false, false},
+		{"docs/a.tmp", false, true},
+		{"docs/x/y/a.tmp", false, true},
+		{"other/a.tmp", false, false},
+		{"cache", true, false},
+		{"cache/entry", false, true},
+		{"#literal", false, true},
+		{"trailing ", false, true},
+		{"spaced.txt", false, true},
+		{"comment", false, false},
+		{"app.txt", false, false},
+	}
+	for _, tc := range cases {
+		if got := m.Ignored(tc.path, tc.dir); got != tc.ignored {
+			t.Errorf("Ignored(%q, %v) = %v, want %v", tc.path, tc.dir, got, tc.ignored)
+		}
+	}
+}
+
+func TestMatcherScopesRulesToTheirDirectory(t *testing.T) {
+	var m Matcher
+	if err := m.Add("", strings.NewReader("*.bin\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Add("sub", strings.NewReader("!firmware.bin\n/local.txt\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if !m.Ignored("firmware.bin", false) {
+		t.Error("expected root rule to ignore firmware.bin")
+	}
+	if m.Ignored("sub/firmware.bin", false) {
+		t.Error("expected nested rule to re-include sub/firmware.bin")
+	}
+	if !m.Ignored("sub/local.txt", false) {
+		t.Error("expected anchored nested rule to ignore sub/local.txt")
+	}
+	if m.Ignored("local.txt", false) || m.Ignored("other/local.txt", false) {
+		t.Error("expected nested rule not to apply outside its directory")
+	}
+}
@@ -0,0 +1,338 @@
+// Package inventory reads S3 Inventory reports, which list every object of a
+// bucket once a day or week, as a cheap snapshot of what a bucket holds where
+// listing it would take millions of requests.
+package inventory
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/parquet-go/parquet-go"
+)
+
+// Report formats.
+const (
+	FormatCSV     = "CSV"
+	FormatParquet = "Parquet"
+)
+
+// manifestName is the manifest S3 writes into the dated folder of a report
+// once all of its data files are delivered.
+const manifestName = "manifest.json"
+
+// Client is the subset of the S3 API used to read reports.
+type Client interface {
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// Manifest describes a delivered report.
+type Manifest struct {
+	SourceBucket      string `json:"sourceBucket"`
+	DestinationBucket string `json:"destinationBucket"`
+	Version           string `json:"version"`
+	CreationTimestamp string `json:"creationTimestamp"`
+	FileFormat        string `json:"fileFormat"`
+	FileSchema        string `json:"fileSchema"`
+	Files             []File `json:"files"`
+	// Key is where the manifest was read from.
+	Key string `json:"-"`
+}
+
+// File is a data file of a report.
+type File struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+}
+
+// Created returns when S3 started taking the report; objects written later
+// may be missing from it.
+func (m *Manifest) Created() time.Time {
+	millis, err := strconv.ParseInt(m.CreationTimestamp, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(millis).UTC()
+}
+
+// Object is the current version of an object as listed in a report.
+type Object struct {
+	Key          string
+	Size         int64
+	ETag         string
+	StorageClass string
+	LastModified time.Time
+}
+
+// Latest returns the manifest of the newest report delivered to bucket below
+// prefix, the location S3 writes the dated folders of one inventory
+// configuration to: <destination prefix>/<source bucket>/<configuration id>.
+func Latest(ctx context.Context, client Client, bucket, prefix string) (*Manifest, error) {
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	var folders []string
+	var token *string
+	for {
+		response, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(bucket),
+			Prefix:            aws.String(prefix),
+			Delimiter:         aws.String("/"),
+			ContinuationToken: token,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list inventory reports in s3://%s/%s: %w", bucket, prefix, err)
+		}
+		for _, common := range response.CommonPrefixes {
+			folder := strings.TrimSuffix(strings.TrimPrefix(aws.ToString(common.Prefix), prefix), "/")
+			// Dated folders are named like 2026-01-17T01-00Z; data/ and
+			// hive/ hold the files they refer to.
+			if len(folder) > 0 && folder[0] >= '0' && folder[0] <= '9' {
+				folders = append(folders, folder)
+			}
+		}
+		if !aws.ToBool(response.IsTruncated) || response.NextContinuationToken == nil {
+			break
+		}
+		token = response.NextContinuationToken
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(folders)))
+
+	// The newest folder lacks a manifest while its report is delivered.
+	for _, folder := range folders {
+		key := prefix + folder + "/" + manifestName
+		manifest, err := readManifest(ctx, client, bucket, key)
+		if err != nil {
+			return nil, err
+		}
+		if manifest != nil {
+			return manifest, nil
+		}
+	}
+	return nil, fmt.Errorf("no inventory report found in s3://%s/%s", bucket, prefix)
+}
+
+// readManifest reads the manifest at key, or returns nil when there is none.
+func readManifest(ctx context.Context, client Client, bucket, key string) (*Manifest, error) {
+	response, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "NoSuchKey" || apiErr.ErrorCode() == "NotFound") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read inventory manifest %s: %w", key, err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	var manifest Manifest
+	if err := json.NewDecoder(response.Body).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse inventory manifest %s: %w", key, err)
+	}
+	manifest.Key = key
+	switch manifest.FileFormat {
+	case FormatCSV, FormatParquet:
+	default:
+		return nil, fmt.Errorf("inventory report %s is in %s format; only CSV and Parquet reports can be read", key, manifest.FileFormat)
+	}
+	return &manifest, nil
+}
+
+// Objects returns the current objects of the report whose keys start with
+// prefix, by key. Data files are read from bucket, where the manifest was
+// found. Delete markers and noncurrent versions of versioned inventories are
+// left out.
+func Objects(ctx context.Context, client Client, bucket string, manifest *Manifest, prefix string) (map[string]Object, error) {
+	objects := make(map[string]Object)
+	add := func(obj Object, current bool) {
+		if current && strings.HasPrefix(obj.Key, prefix) {
+			objects[obj.Key] = obj
+		}
+	}
+	for _, file := range manifest.Files {
+		var err error
+		if manifest.FileFormat == FormatParquet {
+			err = readParquet(ctx, client, bucket, file.Key, add)
+		} else {
+			err = readCSV(ctx, client, bucket, file.Key, manifest.FileSchema, add)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
+
+// row collects the fields of one listed object version.
+type row struct {
+	Object
+	latest       bool
+	deleteMarker bool
+}
+
+func (r row) current() bool {
+	return r.latest && !r.deleteMarker
+}
+
+func readCSV(ctx context.Context, client Client, bucket, key, schema string, add func(Object, bool)) error {
+	columns := make(map[string]int)
+	for i, name := range strings.Split(schema, ",") {
+		columns[strings.TrimSpace(name)] = i
+	}
+	keyColumn, ok := columns["Key"]
+	if !ok {
+		return fmt.Errorf("inventory schema %q has no Key field", schema)
+	}
+
+	response, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return fmt.Errorf("failed to read inventory file %s: %w", key, err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	var body io.Reader = response.Body
+	if strings.HasSuffix(key, ".gz") {
+		reader, err := gzip.NewReader(body)
+		if err != nil {
+			return fmt.Errorf("failed to decompress inventory file %s: %w", key, err)
+		}
+		defer func() {
+			_ = reader.Close()
+		}()
+		body = reader
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+	records := csv.NewReader(body)
+	records.FieldsPerRecord = -1
+	for {
+		record, err := records.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse inventory file %s: %w", key, err)
+		}
+		if keyColumn >= len(record) {
+			continue
+		}
+		// Keys are URL-encoded in CSV reports.
+		objectKey, err := url.QueryUnescape(record[keyColumn])
+		if err != nil {
+			return fmt.Errorf("invalid key %q in inventory file %s: %w", record[keyColumn], key, err)
+		}
+		r := row{Object: Object{Key: objectKey, ETag: field(record, "ETag"), StorageClass: field(record, "StorageClass")}, latest: true}
+		r.Size, _ = strconv.ParseInt(field(record, "Size"), 10, 64)
+		r.LastModified, _ = time.Parse(time.RFC3339, field(record, "LastModifiedDate"))
+		if value := field(record, "IsLatest"); value != "" {
+			r.latest = value == "true"
+		}
+		r.deleteMarker = field(record, "IsDeleteMarker") == "true"
+		add(r.Object, r.current())
+	}
+}
+
+func readParquet(ctx context.Context, client Client, bucket, key string, add func(Object, bool)) error {
+	// Parquet is read from the footer backwards, so the file is buffered on
+	// disk first.
+	tmp, err := os.CreateTemp("", "ds-s3-inventory-*"+path.Ext(key))
+	if err != nil {
+		return fmt.Errorf("failed to buffer inventory file %s: %w", key, err)
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	response, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return fmt.Errorf("failed to read inventory file %s: %w", key, err)
+	}
+	size, err := io.Copy(tmp, response.Body)
+	_ = response.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read inventory file %s: %w", key, err)
+	}
+	return parseParquet(tmp, size, key, add)
+}
+
+func parseParquet(input io.ReaderAt, size int64, key string, add func(Object, bool)) error {
+	file, err := parquet.OpenFile(input, size)
+	if err != nil {
+		return fmt.Errorf("failed to open inventory file %s: %w", key, err)
+	}
+	schema := file.Schema()
+	column := func(name string) int {
+		if leaf, ok := schema.Lookup(name); ok {
+			return leaf.ColumnIndex
+		}
+		return -1
+	}
+	keyColumn := column("key")
+	if keyColumn < 0 {
+		return fmt.Errorf("inventory file %s has no key column", key)
+	}
+	sizeColumn, etagColumn, classColumn := column("size"), column("e_tag"), column("storage_class")
+	modifiedColumn, latestColumn, markerColumn := column("last_modified_date"), column("is_latest"), column("is_delete_marker")
+
+	reader := parquet.NewReader(file)
+	defer func() {
+		_ = reader.Close()
+	}()
+	rows := make([]parquet.Row, 1024)
+	for {
+		n, err := reader.ReadRows(rows)
+		for _, values := range rows[:n] {
+			r := row{latest: true}
+			for _, value := range values {
+				if value.IsNull() {
+					continue
+				}
+				switch value.Column() {
+				case keyColumn:
+					r.Key = string(value.ByteArray())
+				case sizeColumn:
+					r.Size = value.Int64()
+				case etagColumn:
+					r.ETag = string(value.ByteArray())
+				case classColumn:
+					r.StorageClass = string(value.ByteArray())
+				case modifiedColumn:
+					r.LastModified = time.UnixMilli(value.Int64()).UTC()
+				case latestColumn:
+					r.latest = value.Boolean()
+				case markerColumn:
+					r.deleteMarker = value.Boolean()
+				}
+			}
+			add(r.Object, r.current())
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read inventory file %s: %w", key, err)
+		}
+	}
+}
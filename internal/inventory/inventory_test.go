@@ -0,0 +1,141 @@
+package inventory
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/parquet-go/parquet-go"
+)
+
+type fakeClient struct {
+	prefixes []string
+	objects  map[string][]byte
+}
+
+func (f *fakeClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	out := &s3.ListObjectsV2Output{}
+	for _, prefix := range f.prefixes {
+		out.CommonPrefixes = append(out.CommonPrefixes, s3types.CommonPrefix{Prefix: aws.String(aws.ToString(params.Prefix) + prefix)})
+	}
+	return out, nil
+}
+
+func (f *fakeClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	data, ok := f.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &s3types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func gzipped(t *testing.T, content string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write([]byte(content)); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestLatestSkipsReportsBeingDelivered(t *testing.T) {
+	client := &fakeClient{
+		prefixes: []string{"2026-01-16T01-00Z/", "2026-01-17T01-00Z/", "data/", "hive/"},
+		objects: map[string][]byte{
+			"inv/artifacts/daily/2026-01-16T01-00Z/manifest.json": []byte(`{"fileFormat":"CSV","creationTimestamp":"1768525200000","fileSchema":"Bucket, Key, Size","files":[]}`),
+		},
+	}
+	manifest, err := Latest(context.Background(), client, "inventories", "/inv/artifacts/daily/")
+	if err != nil {
+		t.Fatalf("Latest returned error: %v", err)
+	}
+	if manifest.Key != "inv/artifacts/daily/2026-01-16T01-00Z/manifest.json" {
+		t.Errorf("unexpected manifest %s", manifest.Key)
+	}
+	if want := time.Date(2026, 1, 16, 1, 0, 0, 0, time.UTC); !manifest.Created().Equal(want) {
+		t.Errorf("Created = %s, want %s", manifest.Created(), want)
+	}
+}
+
+func TestLatestRejectsORC(t *testing.T) {
+	client := &fakeClient{
+		prefixes: []string{"2026-01-17T01-00Z/"},
+		objects:  map[string][]byte{"inv/2026-01-17T01-00Z/manifest.json": []byte(`{"fileFormat":"ORC"}`)},
+	}
+	if _, err := Latest(context.Background(), client, "inventories", "inv"); err == nil || !strings.Contains(err.Error(), "ORC") {
+		t.Errorf("expected ORC reports to be rejected, got %v", err)
+	}
+}
+
+func TestObjectsFromCSV(t *testing.T) {
+	data := strings.Join([]string{
+		`"artifacts","releases/app+v1/index.html","","true","false","120","2026-01-16T10:00:00.000Z","abc","STANDARD"`,
+		`"artifacts","releases/app+v1/old.js","v1","false","false","10","2026-01-10T10:00:00.000Z","def","STANDARD"`,
+		`"artifacts","releases/gone.js","v2","true","true","","2026-01-15T10:00:00.000Z","","STANDARD"`,
+		`"artifacts","other/readme.md","","true","false","5","2026-01-16T10:00:00.000Z","ghi","STANDARD"`,
+		`"artifacts","releases/a%2Bb.txt","","true","false","7","2026-01-16T10:00:00.000Z","jkl","GLACIER"`,
+	}, "\n") + "\n"
+	client := &fakeClient{objects: map[string][]byte{"inv/data/1.csv.gz": gzipped(t, data)}}
+	manifest := &Manifest{
+		FileFormat: FormatCSV,
+		FileSchema: "Bucket, Key, VersionId, IsLatest, IsDeleteMarker, Size, LastModifiedDate, ETag, StorageClass",
+		Files:      []File{{Key: "inv/data/1.csv.gz"}},
+	}
+
+	objects, err := Objects(context.Background(), client, "inventories", manifest, "releases/")
+	if err != nil {
+		t.Fatalf("Objects returned error: %v", err)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("expected 2 current objects below the prefix, got %+v", objects)
+	}
+	index := objects["releases/app v1/index.html"]
+	if index.Size != 120 || index.ETag != "abc" || index.LastModified.IsZero() {
+		t.Errorf("unexpected object %+v", index)
+	}
+	if objects["releases/a+b.txt"].StorageClass != "GLACIER" {
+		t.Errorf("expected the encoded plus to be decoded, got %+v", objects)
+	}
+}
+
+type parquetRow struct {
+	Bucket         string `parquet:"bucket"`
+	Key            string `parquet:"key"`
+	IsLatest       bool   `parquet:"is_latest"`
+	IsDeleteMarker bool   `parquet:"is_delete_marker"`
+	Size           *int64 `parquet:"size,optional"`
+	ETag           string `parquet:"e_tag"`
+}
+
+func TestObjectsFromParquet(t *testing.T) {
+	size := int64(42)
+	var buf bytes.Buffer
+	rows := []parquetRow{
+		{Bucket: "artifacts", Key: "releases/app.js", IsLatest: true, Size: &size, ETag: "abc"},
+		{Bucket: "artifacts", Key: "releases/gone.js", IsLatest: true, IsDeleteMarker: true},
+	}
+	if err := parquet.Write(&buf, rows); err != nil {
+		t.Fatalf("failed to write parquet: %v", err)
+	}
+	client := &fakeClient{objects: map[string][]byte{"inv/data/1.parquet": buf.Bytes()}}
+	manifest := &Manifest{FileFormat: FormatParquet, Files: []File{{Key: "inv/data/1.parquet"}}}
+
+	objects, err := Objects(context.Background(), client, "inventories", manifest, "")
+	if err != nil {
+		t.Fatalf("Objects returned error: %v", err)
+	}
+	if len(objects) != 1 || objects["releases/app.js"].Size != 42 || objects["releases/app.js"].ETag != "abc" {
+		t.Errorf("unexpected objects %+v", objects)
+	}
+}
@@ -0,0 +1,189 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Verdict is the outcome of a malware scan.
+type Verdict struct {
+	Infected  bool
+	Signature string
+}
+
+// VirusScanner checks file content for malware.
+type VirusScanner interface {
+	ScanFile(ctx context.Context, path string) (Verdict, error)
+}
+
+// ClamdScanner streams files to a clamd daemon using the INSTREAM command.
+type ClamdScanner struct {
+	network string
+	address string
+}
+
+// clamdChunkSize is the size of each INSTREAM chunk sent to clamd.
+const clamdChunkSize = 64 * 1024
+
+// NewClamdScanner parses a clamd address of the form unix:///path/to/clamd.sock
+// or tcp://host:port.
+func NewClamdScanner(address string) (*ClamdScanner, error) {
+	parsed, err := url.Parse(strings.TrimSpace(address))
+	if err != nil {
+		return nil, fmt.Errorf("invalid clamd address %q: %w", address, err)
+	}
+	switch parsed.Scheme {
+	case "unix":
+		if parsed.Path == "" {
+			return nil, fmt.Errorf("invalid clamd address %q: missing socket path", address)
+		}
+		return &ClamdScanner{network: "unix", address: parsed.Path}, nil
+	case "tcp":
+		if parsed.Host == "" {
+			return nil, fmt.Errorf("invalid clamd address %q: missing host", address)
+		}
+		return &ClamdScanner{network: "tcp", address: parsed.Host}, nil
+	default:
+		return nil, fmt.Errorf("invalid clamd address %q: scheme must be unix or tcp", address)
+	}
+}
+
+// ScanFile streams the file at path to clamd and parses its reply.
+func (c *ClamdScanner) ScanFile(ctx context.Context, path string) (Verdict, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	if err := writeInstream(conn, file); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return Verdict{}, ctxErr
+		}
+		return Verdict{}, fmt.Errorf("failed to stream %s to clamd: %w", path, err)
+	}
+
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return Verdict{}, ctxErr
+		}
+		return Verdict{}, fmt.Errorf("failed to read clamd reply for %s: %w", path, err)
+	}
+	return parseClamdReply(string(bytes.TrimRight(reply, "\x00\n")))
+}
+
+func writeInstream(w io.Writer, r io.Reader) error {
+	if _, err := io.WriteString(w, "zINSTREAM\x00"); err != nil {
+		return err
+	}
+
+	buffer := make([]byte, clamdChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := r.Read(buffer)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, werr := w.Write(size); werr != nil {
+				return werr
+			}
+			if _, werr := w.Write(buffer[:n]); werr != nil {
+				return werr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	binary.BigEndian.PutUint32(size, 0)
+	_, err := w.Write(size)
+	return err
+}
+
+// parseClamdReply interprets replies such as "stream: OK" and
+// "stream: Eicar-Signature FOUND".
+func parseClamdReply(reply string) (Verdict, error) {
+	result := strings.TrimSpace(reply)
+	if idx := strings.Index(result, ": "); idx >= 0 {
+		result = result[idx+2:]
+	}
+	switch {
+	case result == "OK":
+		return Verdict{}, nil
+	case strings.HasSuffix(result, " FOUND"):
+		return Verdict{Infected: true, Signature: strings.TrimSuffix(result, " FOUND")}, nil
+	default:
+		return Verdict{}, fmt.Errorf("clamd error: %s", strings.TrimSpace(reply))
+	}
+}
+
+// CommandScanner runs an external scanner with the file path appended to its
+// arguments, following the clamscan convention: exit status 0 means clean and
+// 1 means infected, with the last output line naming the detection.
+type CommandScanner struct {
+	args []string
+}
+
+// NewCommandScanner builds a scanner for the given command line.
+func NewCommandScanner(args []string) (*CommandScanner, error) {
+	if len(args) == 0 || strings.TrimSpace(args[0]) == "" {
+		return nil, fmt.Errorf("antivirus command must not be empty")
+	}
+	return &CommandScanner{args: append([]string{}, args...)}, nil
+}
+
+// ScanFile runs the command against the file at path.
+func (c *CommandScanner) ScanFile(ctx context.Context, path string) (Verdict, error) {
+	// #nosec G204 - the scanner command is taken from plugin configuration
+	cmd := exec.CommandContext(ctx, c.args[0], append(c.args[1:], path)...)
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		return Verdict{}, nil
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return Verdict{Infected: true, Signature: lastLine(string(output))}, nil
+	}
+	if msg := lastLine(string(output)); msg != "" {
+		return Verdict{}, fmt.Errorf("antivirus command failed for %s: %s", path, msg)
+	}
+	return Verdict{}, fmt.Errorf("antivirus command failed for %s: %w", path, err)
+}
+
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,147 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeClamd accepts one INSTREAM session and flags content containing "EICAR".
+func fakeClamd(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer func() { _ = conn.Close() }()
+				command := make([]byte, len("zINSTREAM\x00"))
+				if _, err := io.ReadFull(conn, command); err != nil {
+					return
+				}
+				var data bytes.Buffer
+				size := make([]byte, 4)
+				for {
+					if _, err := io.ReadFull(conn, size); err != nil {
+						return
+					}
+					n := binary.BigEndian.Uint32(size)
+					if n == 0 {
+						break
+					}
+					if _, err := io.CopyN(&data, conn, int64(n)); err != nil {
+						return
+					}
+				}
+				reply := "stream: OK"
+				if bytes.Contains(data.Bytes(), []byte("EICAR")) {
+					reply = "stream: Eicar-Signature FOUND"
+				}
+				_, _ = conn.Write([]byte(reply + "\x00"))
+			}(conn)
+		}
+	}()
+
+	return "tcp://" + listener.Addr().String()
+}
+
+func TestClamdScanner(t *testing.T) {
+	scanner, err := NewClamdScanner(fakeClamd(t))
+	if err != nil {
+		t.Fatalf("NewClamdScanner returned error: %v", err)
+	}
+
+	dir := t.TempDir()
+	clean := filepath.Join(dir, "clean.txt")
+	infected := filepath.Join(dir, "infected.txt")
+	if err := os.WriteFile(clean, bytes.Repeat([]byte("a"), clamdChunkSize+10), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.WriteFile(infected, []byte("X5O!P%@AP EICAR test"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	verdict, err := scanner.ScanFile(context.Background(), clean)
+	if err != nil || verdict.Infected {
+		t.Errorf("expected clean verdict, got %+v (%v)", verdict, err)
+	}
+	verdict, err = scanner.ScanFile(context.Background(), infected)
+	if err != nil || !verdict.Infected || verdict.Signature != "Eicar-Signature" {
+		t.Errorf("expected infected verdict, got %+v (%v)", verdict, err)
+	}
+}
+
+func TestNewClamdScannerRejectsBadAddresses(t *testing.T) {
+	for _, address := range []string{"", "clamd:3310", "unix://", "tcp:///socket"} {
+		if _, err := NewClamdScanner(address); err == nil {
+			t.Errorf("expected error for %q", address)
+		}
+	}
+}
+
+func TestParseClamdReplyError(t *testing.T) {
+	if _, err := parseClamdReply("INSTREAM size limit exceeded. ERROR"); err == nil {
+		t.Error("expected error reply to fail")
+	}
+}
+
+// TestHelperScanner is run as a subprocess by TestCommandScanner.
+func TestHelperScanner(t *testing.T) {
+	if os.Getenv("DS_S3_HELPER_SCANNER") != "1" {
+		return
+	}
+	data, err := os.ReadFile(os.Args[len(os.Args)-1])
+	if err != nil {
+		fmt.Println("read error")
+		os.Exit(2)
+	}
+	if bytes.Contains(data, []byte("EICAR")) {
+		fmt.Println("file: Eicar-Signature FOUND")
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func TestCommandScanner(t *testing.T) {
+	t.Setenv("DS_S3_HELPER_SCANNER", "1")
+	scanner, err := NewCommandScanner([]string{os.Args[0], "-test.run=TestHelperScanner", "--"})
+	if err != nil {
+		t.Fatalf("NewCommandScanner returned error: %v", err)
+	}
+
+	dir := t.TempDir()
+	clean := filepath.Join(dir, "clean.txt")
+	infected := filepath.Join(dir, "infected.txt")
+	if err := os.WriteFile(clean, []byte("hello"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.WriteFile(infected, []byte("EICAR"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	verdict, err := scanner.ScanFile(context.Background(), clean)
+	if err != nil || verdict.Infected {
+		t.Errorf("expected clean verdict, got %+v (%v)", verdict, err)
+	}
+	verdict, err = scanner.ScanFile(context.Background(), infected)
+	if err != nil || !verdict.Infected || verdict.Signature != "file: Eicar-Signature FOUND" {
+		t.Errorf("expected infected verdict, got %+v (%v)", verdict, err)
+	}
+	if _, err := scanner.ScanFile(context.Background(), filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected scanner failure to surface as an error")
+	}
+}
@@ -0,0 +1,149 @@
+package scan
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+)
+
+// Rule is a named pattern that identifies a potential secret. When MinEntropy
+// is positive a match only counts if its Shannon entropy (bits per character)
+// reaches it, which filters out long but predictable strings.
+type Rule struct {
+	Name       string
+	Pattern    *regexp.Regexp
+	MinEntropy float64
+}
+
+// DefaultRules detects well-known credential formats.
+func DefaultRules() []Rule {
+	return []Rule{
+		{Name: "aws-access-key-id", Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+		{Name: "aws-secret-access-key", Pattern: regexp.MustCompile(`(?i)aws_?secret_?access_?key["'\s]*[:=]\s*["']?[A-Za-z0-9/+=]{40}`)},
+		{Name: "private-key", Pattern: regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )?PRIVATE KEY-----`)},
+		{Name: "github-token", Pattern: regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+		{Name: "slack-token", Pattern: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	}
+}
+
+// EntropyRule flags long token-like strings whose entropy reaches threshold.
+func EntropyRule(threshold float64) Rule {
+	return Rule{
+		Name:       "high-entropy-token",
+		Pattern:    regexp.MustCompile(`[A-Za-z0-9+/=_-]{32,}`),
+		MinEntropy: threshold,
+	}
+}
+
+// CompileRules turns named regular expressions into rules, sorted by name.
+func CompileRules(patterns map[string]string) ([]Rule, error) {
+	names := make([]string, 0, len(patterns))
+	for name := range patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rules := make([]Rule, 0, len(names))
+	for _, name := range names {
+		pattern, err := regexp.Compile(patterns[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret pattern %q: %w", name, err)
+		}
+		rules = append(rules, Rule{Name: name, Pattern: pattern})
+	}
+	return rules, nil
+}
+
+// Finding reports a potential secret. The matched text itself is never
+// recorded so findings are safe to print.
+type Finding struct {
+	Source string `json:"source"`
+	Key    string `json:"key,omitempty"`
+	Rule   string `json:"rule"`
+	Line   int    `json:"line"`
+}
+
+// SecretScanner checks files for potential secrets.
+type SecretScanner struct {
+	rules   []Rule
+	maxSize int64
+}
+
+// NewSecretScanner builds a scanner for rules. Files larger than maxSize bytes
+// are skipped; a maxSize of zero scans every file.
+func NewSecretScanner(rules []Rule, maxSize int64) *SecretScanner {
+	return &SecretScanner{rules: rules, maxSize: maxSize}
+}
+
+// binaryProbe is how many leading bytes are checked for NUL to detect binaries.
+const binaryProbe = 8000
+
+// ScanFile returns the findings in the file at path. Binary files and files
+// above the size limit are skipped.
+func (s *SecretScanner) ScanFile(path string) ([]Finding, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if s.maxSize > 0 && info.Size() > s.maxSize {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	probe := data
+	if len(probe) > binaryProbe {
+		probe = probe[:binaryProbe]
+	}
+	if bytes.IndexByte(probe, 0) >= 0 {
+		return nil, nil
+	}
+
+	var findings []Finding
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		for _, rule := range s.rules {
+			if rule.matches(line) {
+				findings = append(findings, Finding{Source: path, Rule: rule.Name, Line: i + 1})
+			}
+		}
+	}
+	return findings, nil
+}
+
+func (r Rule) matches(line []byte) bool {
+	if r.MinEntropy <= 0 {
+		return r.Pattern.Match(line)
+	}
+	for _, match := range r.Pattern.FindAll(line, -1) {
+		if entropy(match) >= r.MinEntropy {
+			return true
+		}
+	}
+	return false
+}
+
+// entropy returns the Shannon entropy of data in bits per byte.
+func entropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+	total := float64(len(data))
+	bits := 0.0
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / total
+		bits -= p * math.Log2(p)
+	}
+	return bits
+}
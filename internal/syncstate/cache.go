@@ -0,0 +1,111 @@
+package syncstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// CacheFile is the name of the cache database inside the cache directory.
+const CacheFile = "ds-s3-sync.db"
+
+// lockTimeout bounds how long a run waits for another run on the same
+// machine to release the cache.
+const lockTimeout = 30 * time.Second
+
+// Cache keeps the sync state of every target in a local bolt database, so a
+// persistent agent decides what to upload without reading state from the
+// bucket. The database is only opened while loading or saving, so parallel
+// runs on the same machine merely serialise those steps.
+type Cache struct {
+	path string
+}
+
+// NewCache returns the cache stored in dir, creating the directory if needed.
+func NewCache(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create sync cache directory: %w", err)
+	}
+	return &Cache{path: filepath.Join(dir, CacheFile)}, nil
+}
+
+// Load returns the state recorded for target, or nil when there is none.
+func (c *Cache) Load(target string) (*State, error) {
+	db, err := c.open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	var state *State
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(target))
+		if bucket == nil {
+			return nil
+		}
+		state = New()
+		return bucket.ForEach(func(key, value []byte) error {
+			var entry Entry
+			if err := json.Unmarshal(value, &entry); err != nil {
+				return fmt.Errorf("invalid sync cache entry %s: %w", key, err)
+			}
+			state.Files[string(key)] = entry
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync cache: %w", err)
+	}
+	return state, nil
+}
+
+// Save replaces the state recorded for target.
+func (c *Cache) Save(target string, state *State) error {
+	db, err := c.open()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(target)) != nil {
+			if err := tx.DeleteBucket([]byte(target)); err != nil {
+				return err
+			}
+		}
+		bucket, err := tx.CreateBucket([]byte(target))
+		if err != nil {
+			return err
+		}
+		for key, entry := range state.Files {
+			value, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(key), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write sync cache: %w", err)
+	}
+	return nil
+}
+
+func (c *Cache) open() (*bolt.DB, error) {
+	db, err := bolt.Open(c.path, 0o600, &bolt.Options{Timeout: lockTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sync cache %s: %w", c.path, err)
+	}
+	return db, nil
+}
@@ -0,0 +1,173 @@
+// Package syncstate records what an incremental upload last sent to a bucket,
+// so later runs only upload files whose content changed.
+package syncstate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// formatVersion identifies the encoding written by Encode.
+const formatVersion = 1
+
+// Entry describes a file as it was when its object was last uploaded.
+type Entry struct {
+	Size    int64  `json:"s"`
+	ModTime int64  `json:"m"`
+	SHA256  string `json:"h"`
+	// Uploaded is when, in Unix nanoseconds, the run that last uploaded the
+	// file started; zero in states written before it was recorded.
+	Uploaded int64 `json:"u,omitempty"`
+}
+
+// State maps object keys to the files last uploaded to them.
+type State struct {
+	Version int              `json:"v"`
+	Files   map[string]Entry `json:"f"`
+}
+
+// New returns an empty state.
+func New() *State {
+	return &State{Version: formatVersion, Files: make(map[string]Entry)}
+}
+
+// Decode parses a state written by Encode.
+func Decode(data []byte) (*State, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid sync state: %w", err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	state := New()
+	if err := json.NewDecoder(reader).Decode(state); err != nil {
+		return nil, fmt.Errorf("invalid sync state: %w", err)
+	}
+	if state.Version != formatVersion {
+		return nil, fmt.Errorf("unsupported sync state version %d", state.Version)
+	}
+	if state.Files == nil {
+		state.Files = make(map[string]Entry)
+	}
+	return state, nil
+}
+
+// Encode renders the state as gzip-compressed JSON.
+func (s *State) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(writer).Encode(s); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Tracker compares the files of a run with the previous state and collects
+// the state to record once the run succeeded. It is safe for concurrent use.
+type Tracker struct {
+	previous *State
+	started  int64
+	remote   func(key string, previous Entry) bool
+
+	mu      sync.Mutex
+	next    *State
+	skipped int
+}
+
+// NewTracker starts a run against the previous state, which may be nil.
+func NewTracker(previous *State) *Tracker {
+	if previous == nil {
+		previous = New()
+	}
+	return &Tracker{previous: previous, started: time.Now().UnixNano(), next: New()}
+}
+
+// SetRemote makes the tracker confirm that the object of an unchanged file
+// is still in the bucket by calling present, and treat the file as changed
+// when it is not. It must be called before Changed.
+func (t *Tracker) SetRemote(present func(key string, previous Entry) bool) {
+	t.remote = present
+}
+
+// Changed reports whether the file at source differs from the one last
+// uploaded to key, and records it for the next state. Files whose size and
+// modification time are unchanged are trusted without reading them; others
+// are hashed, so a fresh checkout with new timestamps is still recognised.
+func (t *Tracker) Changed(key, source string) (bool, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat %s: %w", source, err)
+	}
+	entry := Entry{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+
+	previous, known := t.previous.Files[key]
+	changed := true
+	if known && previous.Size == entry.Size && previous.ModTime == entry.ModTime {
+		entry.SHA256 = previous.SHA256
+		changed = false
+	} else {
+		if entry.SHA256, err = hashFile(source); err != nil {
+			return false, err
+		}
+		changed = !known || previous.Size != entry.Size || previous.SHA256 != entry.SHA256
+	}
+	if !changed && t.remote != nil && !t.remote(key, previous) {
+		changed = true
+	}
+	entry.Uploaded = t.started
+	if !changed {
+		entry.Uploaded = previous.Uploaded
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.next.Files[key] = entry
+	if !changed {
+		t.skipped++
+	}
+	return changed, nil
+}
+
+// Skipped returns how many files were found unchanged.
+func (t *Tracker) Skipped() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.skipped
+}
+
+// State returns the state describing every file seen during the run. Keys
+// whose files were not part of the run are dropped.
+func (t *Tracker) State() *State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.next
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
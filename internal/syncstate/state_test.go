@@ -0,0 +1,151 @@
+package syncstate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTrackerDetectsChanges(t *testing.T) {
+	dir := t.TempDir()
+	same := filepath.Join(dir, "same.txt")
+	touched := filepath.Join(dir, "touched.txt")
+	edited := filepath.Join(dir, "edited.txt")
+	for _, path := range []string{same, touched, edited} {
+		if err := os.WriteFile(path, []byte("v1"), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+
+	first := NewTracker(nil)
+	for key, path := range map[string]string{"same": same, "touched": touched, "edited": edited} {
+		changed, err := first.Changed(key, path)
+		if err != nil || !changed {
+			t.Fatalf("expected %s to be new, got changed=%v err=%v", key, changed, err)
+		}
+	}
+
+	// Round-trip through the stored encoding, as a stateless runner would.
+	data, err := first.State().Encode()
+	if err != nil {
+		t.Fatalf("Encode returned error: %v", err)
+	}
+	previous, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode returned error: %v", err)
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(touched, later, later); err != nil {
+		t.Fatalf("failed to touch file: %v", err)
+	}
+	if err := os.WriteFile(edited, []byte("v2"), 0o644); err != nil {
+		t.Fatalf("failed to edit file: %v", err)
+	}
+
+	second := NewTracker(previous)
+	for key, want := range map[string]bool{"same": false, "touched": false, "edited": true} {
+		path := filepath.Join(dir, key+".txt")
+		changed, err := second.Changed(key, path)
+		if err != nil {
+			t.Fatalf("Changed(%s) returned error: %v", key, err)
+		}
+		if changed != want {
+			t.Errorf("Changed(%s) = %v, want %v", key, changed, want)
+		}
+	}
+	if second.Skipped() != 2 {
+		t.Errorf("expected 2 skipped files, got %d", second.Skipped())
+	}
+	if got := second.State().Files["touched"].ModTime; got != later.UnixNano() {
+		t.Errorf("expected the new modification time to be recorded, got %d", got)
+	}
+}
+
+func TestTrackerConfirmsRemoteObjects(t *testing.T) {
+	dir := t.TempDir()
+	previous := New()
+	for _, key := range []string{"kept", "deleted"} {
+		path := filepath.Join(dir, key)
+		if err := os.WriteFile(path, []byte("v1"), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+		first := NewTracker(nil)
+		if _, err := first.Changed(key, path); err != nil {
+			t.Fatalf("Changed(%s) returned error: %v", key, err)
+		}
+		previous.Files[key] = first.State().Files[key]
+	}
+	if previous.Files["kept"].Uploaded == 0 {
+		t.Fatal("expected the upload time of a new file to be recorded")
+	}
+
+	tracker := NewTracker(previous)
+	tracker.SetRemote(func(key string, entry Entry) bool {
+		return key == "kept" && entry.Uploaded == previous.Files["kept"].Uploaded
+	})
+	for key, want := range map[string]bool{"kept": false, "deleted": true} {
+		changed, err := tracker.Changed(key, filepath.Join(dir, key))
+		if err != nil {
+			t.Fatalf("Changed(%s) returned error: %v", key, err)
+		}
+		if changed != want {
+			t.Errorf("Changed(%s) = %v, want %v", key, changed, want)
+		}
+	}
+	state := tracker.State()
+	if state.Files["kept"].Uploaded != previous.Files["kept"].Uploaded {
+		t.Error("expected an unchanged file to keep its upload time")
+	}
+	if state.Files["deleted"].Uploaded == previous.Files["deleted"].Uploaded {
+		t.Error("expected a re-uploaded file to record the new upload time")
+	}
+}
+
+func TestDecodeRejectsGarbage(t *testing.T) {
+	if _, err := Decode([]byte("not gzip")); err == nil {
+		t.Fatal("expected an error for invalid state")
+	}
+}
+
+func TestCacheKeepsStatePerTarget(t *testing.T) {
+	cache, err := NewCache(filepath.Join(t.TempDir(), "cache"))
+	if err != nil {
+		t.Fatalf("NewCache returned error: %v", err)
+	}
+
+	if state, err := cache.Load("prod"); err != nil || state != nil {
+		t.Fatalf("expected no state for an unknown target, got %v (%v)", state, err)
+	}
+
+	prod := New()
+	prod.Files["app/a.bin"] = Entry{Size: 3, ModTime: 1, SHA256: "aa"}
+	prod.Files["app/b.bin"] = Entry{Size: 4, ModTime: 2, SHA256: "bb"}
+	if err := cache.Save("prod", prod); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	staging := New()
+	staging.Files["app/a.bin"] = Entry{Size: 5, ModTime: 3, SHA256: "cc"}
+	if err := cache.Save("staging", staging); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+
+	// Saving replaces the previous state, dropping keys no longer present.
+	delete(prod.Files, "app/b.bin")
+	if err := cache.Save("prod", prod); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+
+	loaded, err := cache.Load("prod")
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if len(loaded.Files) != 1 || loaded.Files["app/a.bin"].SHA256 != "aa" {
+		t.Errorf("unexpected prod state %+v", loaded.Files)
+	}
+	loaded, err = cache.Load("staging")
+	if err != nil || loaded.Files["app/a.bin"].SHA256 != "cc" {
+		t.Errorf("unexpected staging state %+v (%v)", loaded, err)
+	}
+}
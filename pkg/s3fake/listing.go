@@ -0,0 +1,279 @@
+package s3fake
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ListObjectsV2 lists the current objects under a prefix in key order, rolling
+// keys up into common prefixes at the delimiter, one page at a time.
+func (f *S3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("ListObjectsV2", ""); err != nil {
+		return nil, err
+	}
+	b, err := f.lookup("ListObjectsV2", params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, delimiter := aws.ToString(params.Prefix), aws.ToString(params.Delimiter)
+	// The continuation token is the last key or common prefix returned,
+	// which S3 keeps opaque.
+	after := aws.ToString(params.StartAfter)
+	if token := aws.ToString(params.ContinuationToken); token != "" {
+		after = token
+	}
+	limit := f.pageSize(params.MaxKeys)
+
+	out := &s3.ListObjectsV2Output{
+		Name:              params.Bucket,
+		Prefix:            params.Prefix,
+		Delimiter:         params.Delimiter,
+		ContinuationToken: params.ContinuationToken,
+		StartAfter:        params.StartAfter,
+		MaxKeys:           aws.Int32(int32(limit)),
+	}
+	var last string
+	count := 0
+	for _, key := range b.keys(prefix) {
+		entry := key
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				entry = key[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		if entry <= after || entry == last {
+			continue
+		}
+		if count == limit {
+			out.IsTruncated = aws.Bool(true)
+			out.NextContinuationToken = aws.String(last)
+			break
+		}
+		if entry != key {
+			out.CommonPrefixes = append(out.CommonPrefixes, s3types.CommonPrefix{Prefix: aws.String(entry)})
+		} else {
+			object := b.latest(key)
+			out.Contents = append(out.Contents, s3types.Object{
+				Key:          aws.String(key),
+				Size:         aws.Int64(int64(len(object.Body))),
+				ETag:         aws.String(object.ETag),
+				LastModified: aws.Time(object.LastModified),
+				StorageClass: s3types.ObjectStorageClassStandard,
+			})
+		}
+		last = entry
+		count++
+	}
+	if out.IsTruncated == nil {
+		out.IsTruncated = aws.Bool(false)
+	}
+	out.KeyCount = aws.Int32(int32(count))
+	return out, nil
+}
+
+// ListObjectVersions lists the versions and delete markers under a prefix,
+// by key and newest first, one page at a time. Objects of buckets without
+// versioning have the version id "null".
+func (f *S3) ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("ListObjectVersions", ""); err != nil {
+		return nil, err
+	}
+	b, err := f.lookup("ListObjectVersions", params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := aws.ToString(params.Prefix)
+	keys := make([]string, 0, len(b.objects))
+	for key := range b.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	keyMarker, versionMarker := aws.ToString(params.KeyMarker), aws.ToString(params.VersionIdMarker)
+	limit := f.pageSize(params.MaxKeys)
+	out := &s3.ListObjectVersionsOutput{
+		Name:            params.Bucket,
+		Prefix:          params.Prefix,
+		KeyMarker:       params.KeyMarker,
+		VersionIdMarker: params.VersionIdMarker,
+		MaxKeys:         aws.Int32(int32(limit)),
+		IsTruncated:     aws.Bool(false),
+	}
+	count := 0
+	for _, key := range keys {
+		if keyMarker != "" && key < keyMarker {
+			continue
+		}
+		versions := b.objects[key]
+		// Resuming within the key of the marker starts after its version;
+		// without a version marker the whole key was listed.
+		skipping := keyMarker != "" && key == keyMarker
+		for i := len(versions) - 1; i >= 0; i-- {
+			v := versions[i]
+			versionID := v.VersionID
+			if versionID == "" {
+				versionID = "null"
+			}
+			if skipping {
+				if versionMarker != "" && versionID == versionMarker {
+					skipping = false
+				}
+				continue
+			}
+			if count == limit {
+				out.IsTruncated = aws.Bool(true)
+				return out, nil
+			}
+			latest := i == len(versions)-1
+			if v.deleteMarker {
+				out.DeleteMarkers = append(out.DeleteMarkers, s3types.DeleteMarkerEntry{
+					Key:          aws.String(key),
+					VersionId:    aws.String(versionID),
+					IsLatest:     aws.Bool(latest),
+					LastModified: aws.Time(v.LastModified),
+				})
+			} else {
+				out.Versions = append(out.Versions, s3types.ObjectVersion{
+					Key:          aws.String(key),
+					VersionId:    aws.String(versionID),
+					IsLatest:     aws.Bool(latest),
+					Size:         aws.Int64(int64(len(v.Body))),
+					ETag:         aws.String(v.ETag),
+					LastModified: aws.Time(v.LastModified),
+					StorageClass: s3types.ObjectVersionStorageClassStandard,
+				})
+			}
+			out.NextKeyMarker = aws.String(key)
+			out.NextVersionIdMarker = aws.String(versionID)
+			count++
+		}
+	}
+	out.NextKeyMarker, out.NextVersionIdMarker = nil, nil
+	return out, nil
+}
+
+// ListMultipartUploads lists the incomplete multipart uploads under a prefix
+// by key and upload id, one page at a time.
+func (f *S3) ListMultipartUploads(ctx context.Context, params *s3.ListMultipartUploadsInput, optFns ...func(*s3.Options)) (*s3.ListMultipartUploadsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("ListMultipartUploads", ""); err != nil {
+		return nil, err
+	}
+	b, err := f.lookup("ListMultipartUploads", params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	uploads := append([]*multipartUpload(nil), b.uploads...)
+	sort.SliceStable(uploads, func(i, j int) bool {
+		if uploads[i].key != uploads[j].key {
+			return uploads[i].key < uploads[j].key
+		}
+		return uploads[i].uploadID < uploads[j].uploadID
+	})
+
+	prefix := aws.ToString(params.Prefix)
+	keyMarker, uploadMarker := aws.ToString(params.KeyMarker), aws.ToString(params.UploadIdMarker)
+	limit := f.pageSize(params.MaxUploads)
+	out := &s3.ListMultipartUploadsOutput{
+		Bucket:         params.Bucket,
+		Prefix:         params.Prefix,
+		KeyMarker:      params.KeyMarker,
+		UploadIdMarker: params.UploadIdMarker,
+		MaxUploads:     aws.Int32(int32(limit)),
+		IsTruncated:    aws.Bool(false),
+	}
+	for _, upload := range uploads {
+		if !strings.HasPrefix(upload.key, prefix) {
+			continue
+		}
+		if keyMarker != "" && (upload.key < keyMarker || (upload.key == keyMarker && (uploadMarker == "" || upload.uploadID <= uploadMarker))) {
+			continue
+		}
+		if len(out.Uploads) == limit {
+			out.IsTruncated = aws.Bool(true)
+			last := out.Uploads[len(out.Uploads)-1]
+			out.NextKeyMarker, out.NextUploadIdMarker = last.Key, last.UploadId
+			break
+		}
+		out.Uploads = append(out.Uploads, s3types.MultipartUpload{
+			Key:          aws.String(upload.key),
+			UploadId:     aws.String(upload.uploadID),
+			Initiated:    aws.Time(upload.initiated),
+			StorageClass: s3types.StorageClassStandard,
+		})
+	}
+	return out, nil
+}
+
+// ListParts lists the parts of an incomplete multipart upload, one page at a
+// time, or fails with NoSuchUpload.
+func (f *S3) ListParts(ctx context.Context, params *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("ListParts", aws.ToString(params.Key)); err != nil {
+		return nil, err
+	}
+	b, err := f.lookup("ListParts", params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	var upload *multipartUpload
+	for _, candidate := range b.uploads {
+		if candidate.key == aws.ToString(params.Key) && candidate.uploadID == aws.ToString(params.UploadId) {
+			upload = candidate
+		}
+	}
+	if upload == nil {
+		return nil, operationError("ListParts", responseError(http.StatusNotFound, &s3types.NoSuchUpload{Message: params.UploadId}))
+	}
+
+	marker := 0
+	if value := aws.ToString(params.PartNumberMarker); value != "" {
+		if marker, err = strconv.Atoi(value); err != nil {
+			return nil, operationError("ListParts", APIError("InvalidArgument", http.StatusBadRequest))
+		}
+	}
+	limit := f.pageSize(params.MaxParts)
+	out := &s3.ListPartsOutput{
+		Bucket:           params.Bucket,
+		Key:              params.Key,
+		UploadId:         params.UploadId,
+		PartNumberMarker: params.PartNumberMarker,
+		MaxParts:         aws.Int32(int32(limit)),
+		IsTruncated:      aws.Bool(false),
+	}
+	for i, size := range upload.parts {
+		number := i + 1
+		if number <= marker {
+			continue
+		}
+		if len(out.Parts) == limit {
+			out.IsTruncated = aws.Bool(true)
+			out.NextPartNumberMarker = aws.String(strconv.Itoa(number - 1))
+			break
+		}
+		out.Parts = append(out.Parts, s3types.Part{
+			PartNumber:   aws.Int32(int32(number)),
+			Size:         aws.Int64(size),
+			LastModified: aws.Time(upload.initiated),
+		})
+	}
+	return out, nil
+}
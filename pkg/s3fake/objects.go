@@ -0,0 +1,448 @@
+package s3fake
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// crc64NVME is the reflected CRC-64/NVME polynomial S3 uses for crc64nvme.
+var crc64NVME = crc64.MakeTable(0x9a6c9329ac4bc9b5)
+
+// HeadObject returns the metadata of the latest or the given version of an
+// object, or NotFound.
+func (f *S3) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := aws.ToString(params.Key)
+	if err := f.begin("HeadObject", key); err != nil {
+		return nil, err
+	}
+	b, err := f.lookup("HeadObject", params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	object := b.version(key, aws.ToString(params.VersionId))
+	if object == nil {
+		return nil, operationError("HeadObject", responseError(http.StatusNotFound, &s3types.NotFound{}))
+	}
+
+	out := &s3.HeadObjectOutput{
+		ContentLength:   aws.Int64(int64(len(object.Body))),
+		ContentType:     optional(object.ContentType),
+		ContentEncoding: optional(object.ContentEncoding),
+		ETag:            aws.String(object.ETag),
+		LastModified:    aws.Time(object.LastModified),
+		Metadata:        cloneMap(object.Metadata),
+		VersionId:       optional(object.VersionID),
+	}
+	if params.ChecksumMode == s3types.ChecksumModeEnabled {
+		out.ChecksumCRC64NVME, out.ChecksumCRC32C, out.ChecksumCRC32, out.ChecksumSHA256, out.ChecksumSHA1 = checksumFields(object.Checksums)
+	}
+	return out, nil
+}
+
+// GetObject returns the latest or the given version of an object, or
+// NoSuchKey.
+func (f *S3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := aws.ToString(params.Key)
+	if err := f.begin("GetObject", key); err != nil {
+		return nil, err
+	}
+	b, err := f.lookup("GetObject", params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	object := b.version(key, aws.ToString(params.VersionId))
+	if object == nil {
+		return nil, operationError("GetObject", responseError(http.StatusNotFound, &s3types.NoSuchKey{Message: params.Key}))
+	}
+
+	out := &s3.GetObjectOutput{
+		Body:            io.NopCloser(bytes.NewReader(bytes.Clone(object.Body))),
+		ContentLength:   aws.Int64(int64(len(object.Body))),
+		ContentType:     optional(object.ContentType),
+		ContentEncoding: optional(object.ContentEncoding),
+		ETag:            aws.String(object.ETag),
+		LastModified:    aws.Time(object.LastModified),
+		Metadata:        cloneMap(object.Metadata),
+		VersionId:       optional(object.VersionID),
+	}
+	if params.ChecksumMode == s3types.ChecksumModeEnabled {
+		out.ChecksumCRC64NVME, out.ChecksumCRC32C, out.ChecksumCRC32, out.ChecksumSHA256, out.ChecksumSHA1 = checksumFields(object.Checksums)
+	}
+	return out, nil
+}
+
+// Upload stores the object of a PutObject request in one piece, honouring
+// its write conditions and computing the checksum it asks for. The uploader
+// options are ignored. Faults match it as "PutObject".
+func (f *S3) Upload(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error) {
+	key := aws.ToString(input.Key)
+	var body []byte
+	if input.Body != nil {
+		// Read outside the lock, as bodies may be slow pipes.
+		data, err := io.ReadAll(input.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read body of %s: %w", key, err)
+		}
+		body = data
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("PutObject", key); err != nil {
+		return nil, err
+	}
+	b, err := f.lookup("PutObject", input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if b.aclRejected(input.ACL) {
+		return nil, operationError("PutObject", APIError("AccessControlListNotSupported", http.StatusBadRequest))
+	}
+	current := b.latest(key)
+	if aws.ToString(input.IfNoneMatch) == "*" && current != nil {
+		return nil, operationError("PutObject", APIError("PreconditionFailed", http.StatusPreconditionFailed))
+	}
+	if etag := aws.ToString(input.IfMatch); etag != "" {
+		if current == nil {
+			return nil, operationError("PutObject", responseError(http.StatusNotFound, &s3types.NoSuchKey{Message: input.Key}))
+		}
+		if etag != current.ETag {
+			return nil, operationError("PutObject", APIError("PreconditionFailed", http.StatusPreconditionFailed))
+		}
+	}
+	tags, err := parseTagging(aws.ToString(input.Tagging))
+	if err != nil {
+		return nil, operationError("PutObject", APIError("InvalidArgument", http.StatusBadRequest))
+	}
+
+	object := Object{
+		Key:             key,
+		Body:            body,
+		ContentType:     aws.ToString(input.ContentType),
+		ContentEncoding: aws.ToString(input.ContentEncoding),
+		Metadata:        cloneMap(input.Metadata),
+		Tags:            tags,
+	}
+	if input.ChecksumAlgorithm != "" {
+		object.Checksums = map[s3types.ChecksumAlgorithm]string{input.ChecksumAlgorithm: checksum(input.ChecksumAlgorithm, body)}
+	}
+	stored := f.store(b, object)
+
+	out := &manager.UploadOutput{
+		Location:             "https://" + aws.ToString(input.Bucket) + ".s3.amazonaws.com/" + key,
+		Key:                  aws.String(key),
+		ETag:                 aws.String(stored.ETag),
+		VersionID:            optional(stored.VersionID),
+		ServerSideEncryption: input.ServerSideEncryption,
+		SSEKMSKeyId:          input.SSEKMSKeyId,
+	}
+	out.ChecksumCRC64NVME, out.ChecksumCRC32C, out.ChecksumCRC32, out.ChecksumSHA256, out.ChecksumSHA1 = checksumFields(stored.Checksums)
+	if len(stored.Checksums) > 0 {
+		out.ChecksumType = s3types.ChecksumTypeFullObject
+	}
+	return out, nil
+}
+
+// CopyObject copies an object, or a version of it, within or between buckets.
+// Metadata and tags are copied unless the request replaces them.
+func (f *S3) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := aws.ToString(params.Key)
+	if err := f.begin("CopyObject", key); err != nil {
+		return nil, err
+	}
+	b, err := f.lookup("CopyObject", params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if b.aclRejected(params.ACL) {
+		return nil, operationError("CopyObject", APIError("AccessControlListNotSupported", http.StatusBadRequest))
+	}
+	sourceBucket, sourceKey, versionID, err := parseCopySource(aws.ToString(params.CopySource))
+	if err != nil {
+		return nil, operationError("CopyObject", APIError("InvalidArgument", http.StatusBadRequest))
+	}
+	from, err := f.lookup("CopyObject", &sourceBucket)
+	if err != nil {
+		return nil, err
+	}
+	source := from.version(sourceKey, versionID)
+	if source == nil {
+		return nil, operationError("CopyObject", responseError(http.StatusNotFound, &s3types.NoSuchKey{Message: aws.String(sourceKey)}))
+	}
+
+	object := clone(source)
+	object.Key = key
+	if params.MetadataDirective == s3types.MetadataDirectiveReplace {
+		object.Metadata = cloneMap(params.Metadata)
+		object.ContentType = aws.ToString(params.ContentType)
+		object.ContentEncoding = aws.ToString(params.ContentEncoding)
+	}
+	if params.TaggingDirective == s3types.TaggingDirectiveReplace {
+		tags, err := parseTagging(aws.ToString(params.Tagging))
+		if err != nil {
+			return nil, operationError("CopyObject", APIError("InvalidArgument", http.StatusBadRequest))
+		}
+		object.Tags = tags
+	}
+	stored := f.store(b, object)
+
+	return &s3.CopyObjectOutput{
+		CopyObjectResult: &s3types.CopyObjectResult{
+			ETag:         aws.String(stored.ETag),
+			LastModified: aws.Time(stored.LastModified),
+		},
+		VersionId:           optional(stored.VersionID),
+		CopySourceVersionId: optional(source.VersionID),
+	}, nil
+}
+
+// DeleteObjects deletes the listed objects, leaving delete markers in
+// versioned buckets unless a version is given. Keys that do not exist are
+// reported as deleted, as S3 does.
+func (f *S3) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var identifiers []s3types.ObjectIdentifier
+	if params.Delete != nil {
+		identifiers = params.Delete.Objects
+	}
+	if err := f.begin("DeleteObjects", ""); err != nil {
+		return nil, err
+	}
+	b, err := f.lookup("DeleteObjects", params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if len(identifiers) > MaxPageSize {
+		return nil, operationError("DeleteObjects", APIError("MalformedXML", http.StatusBadRequest))
+	}
+
+	out := &s3.DeleteObjectsOutput{}
+	for _, identifier := range identifiers {
+		key := aws.ToString(identifier.Key)
+		// Faults for a key fail its entry rather than the request.
+		if err := f.fault("DeleteObjects", key); err != nil {
+			out.Errors = append(out.Errors, deleteError(key, err))
+			continue
+		}
+		f.remove(b, key, aws.ToString(identifier.VersionId))
+		out.Deleted = append(out.Deleted, s3types.DeletedObject{Key: aws.String(key), VersionId: identifier.VersionId})
+	}
+	return out, nil
+}
+
+// DeleteObject deletes a single object like an entry of DeleteObjects.
+func (f *S3) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := aws.ToString(params.Key)
+	if err := f.begin("DeleteObject", key); err != nil {
+		return nil, err
+	}
+	b, err := f.lookup("DeleteObject", params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	f.remove(b, key, aws.ToString(params.VersionId))
+	return &s3.DeleteObjectOutput{VersionId: params.VersionId}, nil
+}
+
+// GetObjectTagging returns the tags of the latest or the given version of an
+// object in key order.
+func (f *S3) GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := aws.ToString(params.Key)
+	if err := f.begin("GetObjectTagging", key); err != nil {
+		return nil, err
+	}
+	b, err := f.lookup("GetObjectTagging", params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	object := b.version(key, aws.ToString(params.VersionId))
+	if object == nil {
+		return nil, operationError("GetObjectTagging", responseError(http.StatusNotFound, &s3types.NoSuchKey{Message: params.Key}))
+	}
+
+	names := make([]string, 0, len(object.Tags))
+	for name := range object.Tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := &s3.GetObjectTaggingOutput{TagSet: make([]s3types.Tag, 0, len(names)), VersionId: optional(object.VersionID)}
+	for _, name := range names {
+		out.TagSet = append(out.TagSet, s3types.Tag{Key: aws.String(name), Value: aws.String(object.Tags[name])})
+	}
+	return out, nil
+}
+
+// GetBucketEncryption returns the default encryption set with
+// SetBucketEncryption, or the error S3 returns for buckets without one.
+func (f *S3) GetBucketEncryption(ctx context.Context, params *s3.GetBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.GetBucketEncryptionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("GetBucketEncryption", ""); err != nil {
+		return nil, err
+	}
+	b, err := f.lookup("GetBucketEncryption", params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if b.encryption == "" {
+		return nil, operationError("GetBucketEncryption", APIError("ServerSideEncryptionConfigurationNotFoundError", http.StatusNotFound))
+	}
+	return &s3.GetBucketEncryptionOutput{
+		ServerSideEncryptionConfiguration: &s3types.ServerSideEncryptionConfiguration{
+			Rules: []s3types.ServerSideEncryptionRule{{
+				ApplyServerSideEncryptionByDefault: &s3types.ServerSideEncryptionByDefault{SSEAlgorithm: b.encryption},
+			}},
+		},
+	}, nil
+}
+
+// GetBucketOwnershipControls returns the Object Ownership set with
+// SetBucketOwnership, or the error S3 returns for buckets without one.
+func (f *S3) GetBucketOwnershipControls(ctx context.Context, params *s3.GetBucketOwnershipControlsInput, optFns ...func(*s3.Options)) (*s3.GetBucketOwnershipControlsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("GetBucketOwnershipControls", ""); err != nil {
+		return nil, err
+	}
+	b, err := f.lookup("GetBucketOwnershipControls", params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if b.ownership == "" {
+		return nil, operationError("GetBucketOwnershipControls", APIError("OwnershipControlsNotFoundError", http.StatusNotFound))
+	}
+	return &s3.GetBucketOwnershipControlsOutput{
+		OwnershipControls: &s3types.OwnershipControls{
+			Rules: []s3types.OwnershipControlsRule{{ObjectOwnership: b.ownership}},
+		},
+	}, nil
+}
+
+func deleteError(key string, err error) s3types.Error {
+	code, message := "InternalError", err.Error()
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		code, message = apiErr.ErrorCode(), apiErr.ErrorMessage()
+	}
+	return s3types.Error{Key: aws.String(key), Code: aws.String(code), Message: aws.String(message)}
+}
+
+// parseCopySource splits a CopySource into bucket, key and version id. Access
+// points are addressed as <access point ARN>/object/<key>.
+func parseCopySource(source string) (string, string, string, error) {
+	path, query, _ := strings.Cut(source, "?")
+	var versionID string
+	if query != "" {
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			return "", "", "", err
+		}
+		versionID = values.Get("versionId")
+	}
+	path = strings.TrimPrefix(path, "/")
+
+	var bucket, key string
+	if strings.HasPrefix(path, "arn:") {
+		var ok bool
+		if bucket, key, ok = strings.Cut(path, "/object/"); !ok {
+			return "", "", "", fmt.Errorf("copy source %q names no object", source)
+		}
+	} else {
+		var ok bool
+		if bucket, key, ok = strings.Cut(path, "/"); !ok {
+			return "", "", "", fmt.Errorf("copy source %q names no object", source)
+		}
+	}
+	key, err := url.PathUnescape(key)
+	if err != nil {
+		return "", "", "", err
+	}
+	return bucket, key, versionID, nil
+}
+
+// parseTagging decodes the URL-encoded tag set of a request.
+func parseTagging(tagging string) (map[string]string, error) {
+	if tagging == "" {
+		return nil, nil
+	}
+	values, err := url.ParseQuery(tagging)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(values))
+	for name := range values {
+		tags[name] = values.Get(name)
+	}
+	return tags, nil
+}
+
+// checksum returns the base64-encoded checksum of body with algorithm.
+func checksum(algorithm s3types.ChecksumAlgorithm, body []byte) string {
+	var h hash.Hash
+	switch algorithm {
+	case s3types.ChecksumAlgorithmCrc32:
+		h = crc32.NewIEEE()
+	case s3types.ChecksumAlgorithmCrc32c:
+		h = crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	case s3types.ChecksumAlgorithmCrc64nvme:
+		sum := make([]byte, 8)
+		binary.BigEndian.PutUint64(sum, crc64.Checksum(body, crc64NVME))
+		return base64.StdEncoding.EncodeToString(sum)
+	case s3types.ChecksumAlgorithmSha1:
+		h = sha1.New()
+	case s3types.ChecksumAlgorithmSha256:
+		h = sha256.New()
+	default:
+		return ""
+	}
+	h.Write(body)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// checksumFields returns the checksums in the order of the SDK output fields
+// CRC64NVME, CRC32C, CRC32, SHA256 and SHA1.
+func checksumFields(checksums map[s3types.ChecksumAlgorithm]string) (*string, *string, *string, *string, *string) {
+	return optional(checksums[s3types.ChecksumAlgorithmCrc64nvme]),
+		optional(checksums[s3types.ChecksumAlgorithmCrc32c]),
+		optional(checksums[s3types.ChecksumAlgorithmCrc32]),
+		optional(checksums[s3types.ChecksumAlgorithmSha256]),
+		optional(checksums[s3types.ChecksumAlgorithmSha1])
+}
+
+func optional(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return aws.String(value)
+}
@@ -0,0 +1,425 @@
+// Package s3fake is an in-memory S3 implementing the uploader.Client and
+// uploader.PutUploader interfaces, so uploads, downloads, cleanup, listings
+// and rollbacks can be tested without an S3-compatible server. It keeps
+// buckets with objects, versions, tags and incomplete multipart uploads,
+// pages listings like S3 does, and fails requests on demand.
+//
+// Errors have the shape of AWS SDK errors: an operation error wrapping a
+// response error with HTTP status and request id, around the modeled error
+// type where S3 has one, so callers classify them as they would real ones.
+package s3fake
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+)
+
+var (
+	_ uploader.Client        = (*S3)(nil)
+	_ uploader.PutUploader   = (*S3)(nil)
+	_ uploader.ObjectDeleter = (*S3)(nil)
+)
+
+// MaxPageSize is the most entries S3 returns in one listing page.
+const MaxPageSize = 1000
+
+// Object is an object stored in the fake. Seeded objects only need Key and
+// Body; the fake fills in the rest.
+type Object struct {
+	Key             string
+	Body            []byte
+	ContentType     string
+	ContentEncoding string
+	Metadata        map[string]string
+	Tags            map[string]string
+	// ETag is the quoted MD5 of the body, like S3 reports for single-part
+	// uploads.
+	ETag string
+	// VersionID is empty in buckets without versioning.
+	VersionID    string
+	LastModified time.Time
+	// Checksums holds the checksums requested when the object was uploaded,
+	// base64-encoded by algorithm.
+	Checksums map[s3types.ChecksumAlgorithm]string
+}
+
+// Fault makes matching requests fail with Err.
+type Fault struct {
+	// Operation is the S3 operation name, such as "PutObject" or
+	// "ListObjectsV2"; empty matches every operation. Uploads are
+	// "PutObject".
+	Operation string
+	// Key matches the object key of the request; empty matches every
+	// request, including listings.
+	Key string
+	// Err is returned wrapped in an operation error, like the SDK does. See
+	// APIError for errors S3 would return.
+	Err error
+	// Times is how many requests fail before the fault is spent; 0 fails
+	// every matching request.
+	Times int
+}
+
+// S3 is the in-memory S3. The zero value is not usable; see New. It is safe
+// for concurrent use.
+type S3 struct {
+	// PageSize caps the entries of every listing page below MaxPageSize, so
+	// pagination can be exercised with a handful of objects. It must be set
+	// before the fake is used.
+	PageSize int
+
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	faults   []*Fault
+	calls    map[string]int
+	sequence int
+	last     time.Time
+}
+
+type bucket struct {
+	versioned  bool
+	encryption s3types.ServerSideEncryption
+	ownership  s3types.ObjectOwnership
+	// objects holds the versions of every key, latest last.
+	objects map[string][]*version
+	uploads []*multipartUpload
+}
+
+// version is a version of an object, or a delete marker hiding the earlier
+// ones in a versioned bucket.
+type version struct {
+	Object
+	deleteMarker bool
+}
+
+type multipartUpload struct {
+	key       string
+	uploadID  string
+	initiated time.Time
+	parts     []int64
+}
+
+// New returns an empty fake without buckets.
+func New() *S3 {
+	return &S3{buckets: make(map[string]*bucket), calls: make(map[string]int)}
+}
+
+// CreateBucket adds an empty bucket unless it exists.
+func (f *S3) CreateBucket(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.bucket(name)
+}
+
+// EnableVersioning keeps every version of the objects in the bucket, which
+// is created if needed.
+func (f *S3) EnableVersioning(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.bucket(name).versioned = true
+}
+
+// SetBucketEncryption sets the default encryption GetBucketEncryption reports
+// for the bucket, which is created if needed.
+func (f *S3) SetBucketEncryption(name string, mode s3types.ServerSideEncryption) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.bucket(name).encryption = mode
+}
+
+// SetBucketOwnership sets the Object Ownership GetBucketOwnershipControls
+// reports for the bucket, which is created if needed. With
+// BucketOwnerEnforced, writes carrying an ACL other than
+// bucket-owner-full-control fail like they do on S3.
+func (f *S3) SetBucketOwnership(name string, ownership s3types.ObjectOwnership) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.bucket(name).ownership = ownership
+}
+
+// aclRejected reports whether the bucket refuses writes with acl because it
+// has ACLs disabled.
+func (b *bucket) aclRejected(acl s3types.ObjectCannedACL) bool {
+	return b.ownership == s3types.ObjectOwnershipBucketOwnerEnforced && acl != "" && acl != s3types.ObjectCannedACLBucketOwnerFullControl
+}
+
+// Put stores object in the bucket, which is created if needed, and returns it
+// as stored.
+func (f *S3) Put(name string, object Object) Object {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return *f.store(f.bucket(name), object)
+}
+
+// Object returns the latest version of key, unless the bucket does not have
+// it or it was deleted.
+func (f *S3) Object(name, key string) (Object, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b, ok := f.buckets[name]
+	if !ok {
+		return Object{}, false
+	}
+	object := b.latest(key)
+	if object == nil {
+		return Object{}, false
+	}
+	return clone(object), true
+}
+
+// Keys returns the keys of the objects in the bucket in lexical order.
+func (f *S3) Keys(name string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b, ok := f.buckets[name]
+	if !ok {
+		return nil
+	}
+	return b.keys("")
+}
+
+// StartMultipartUpload adds an incomplete multipart upload of key with parts
+// of the given sizes to the bucket, which is created if needed, and returns
+// its upload id.
+func (f *S3) StartMultipartUpload(name, key string, partSizes ...int64) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	upload := &multipartUpload{
+		key:       key,
+		uploadID:  f.nextID("upload"),
+		initiated: f.now(),
+		parts:     append([]int64(nil), partSizes...),
+	}
+	b := f.bucket(name)
+	b.uploads = append(b.uploads, upload)
+	return upload.uploadID
+}
+
+// Inject makes requests matching fault fail until it is spent. Faults are
+// checked in the order they were injected.
+func (f *S3) Inject(fault Fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = append(f.faults, &fault)
+}
+
+// Calls returns how many requests of operation the fake received, including
+// failed ones.
+func (f *S3) Calls(operation string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[operation]
+}
+
+// APIError returns the error S3 responds with for code and HTTP status, such
+// as APIError("SlowDown", 503) for throttling.
+func APIError(code string, status int) error {
+	return responseError(status, &smithy.GenericAPIError{Code: code, Message: http.StatusText(status)})
+}
+
+// begin records a request and returns the error of the first matching fault.
+// f.mu must be held.
+func (f *S3) begin(operation, key string) error {
+	f.calls[operation]++
+	return f.fault(operation, key)
+}
+
+// fault returns the error of the first fault matching a request, and spends
+// it. f.mu must be held.
+func (f *S3) fault(operation, key string) error {
+	for i, fault := range f.faults {
+		if (fault.Operation != "" && fault.Operation != operation) || (fault.Key != "" && fault.Key != key) {
+			continue
+		}
+		if fault.Times > 0 {
+			fault.Times--
+			if fault.Times == 0 {
+				f.faults = append(f.faults[:i:i], f.faults[i+1:]...)
+			}
+		}
+		return operationError(operation, fault.Err)
+	}
+	return nil
+}
+
+// lookup returns the named bucket or the NoSuchBucket error of operation.
+// f.mu must be held.
+func (f *S3) lookup(operation string, name *string) (*bucket, error) {
+	if name != nil {
+		if b, ok := f.buckets[*name]; ok {
+			return b, nil
+		}
+	}
+	return nil, operationError(operation, responseError(http.StatusNotFound, &s3types.NoSuchBucket{Message: name}))
+}
+
+// bucket returns the named bucket, creating it if needed. f.mu must be held.
+func (f *S3) bucket(name string) *bucket {
+	b, ok := f.buckets[name]
+	if !ok {
+		b = &bucket{objects: make(map[string][]*version)}
+		f.buckets[name] = b
+	}
+	return b
+}
+
+// store adds object as the latest version of its key. f.mu must be held.
+func (f *S3) store(b *bucket, object Object) *Object {
+	stored := clone(&object)
+	sum := md5.Sum(stored.Body)
+	stored.ETag = `"` + hex.EncodeToString(sum[:]) + `"`
+	stored.LastModified = f.now()
+	stored.VersionID = ""
+	if b.versioned {
+		stored.VersionID = f.nextID("v")
+		b.objects[stored.Key] = append(b.objects[stored.Key], &version{Object: stored})
+	} else {
+		b.objects[stored.Key] = []*version{{Object: stored}}
+	}
+	return &stored
+}
+
+// remove deletes the latest version of key, which hides it behind a delete
+// marker in a versioned bucket, or the given version for good. f.mu must be
+// held.
+func (f *S3) remove(b *bucket, key, versionID string) {
+	versions := b.objects[key]
+	switch {
+	case versionID != "":
+		for i, v := range versions {
+			if v.VersionID == versionID {
+				versions = append(versions[:i:i], versions[i+1:]...)
+				break
+			}
+		}
+	case b.versioned:
+		versions = append(versions, &version{
+			Object:       Object{Key: key, VersionID: f.nextID("v"), LastModified: f.now()},
+			deleteMarker: true,
+		})
+	default:
+		versions = nil
+	}
+	if len(versions) == 0 {
+		delete(b.objects, key)
+		return
+	}
+	b.objects[key] = versions
+}
+
+// now returns the current time, later than any time returned before so that
+// versions written in quick succession keep their order. f.mu must be held.
+func (f *S3) now() time.Time {
+	now := time.Now().UTC()
+	if !now.After(f.last) {
+		now = f.last.Add(time.Microsecond)
+	}
+	f.last = now
+	return now
+}
+
+// nextID returns a new id; ids sort in the order they were handed out.
+// f.mu must be held.
+func (f *S3) nextID(prefix string) string {
+	f.sequence++
+	return fmt.Sprintf("%s%08d", prefix, f.sequence)
+}
+
+// latest returns the current version of key, or nil when it is missing or
+// deleted.
+func (b *bucket) latest(key string) *Object {
+	versions := b.objects[key]
+	if len(versions) == 0 || versions[len(versions)-1].deleteMarker {
+		return nil
+	}
+	return &versions[len(versions)-1].Object
+}
+
+// version returns the given version of key, or the latest one.
+func (b *bucket) version(key, versionID string) *Object {
+	if versionID == "" {
+		return b.latest(key)
+	}
+	for _, v := range b.objects[key] {
+		if v.VersionID == versionID && !v.deleteMarker {
+			return &v.Object
+		}
+	}
+	return nil
+}
+
+// keys returns the current keys starting with prefix in lexical order.
+func (b *bucket) keys(prefix string) []string {
+	keys := make([]string, 0, len(b.objects))
+	for key := range b.objects {
+		if strings.HasPrefix(key, prefix) && b.latest(key) != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *S3) pageSize(requested *int32) int {
+	size := MaxPageSize
+	if f.PageSize > 0 && f.PageSize < size {
+		size = f.PageSize
+	}
+	if requested != nil && *requested > 0 && int(*requested) < size {
+		size = int(*requested)
+	}
+	return size
+}
+
+func clone(object *Object) Object {
+	copied := *object
+	copied.Body = bytes.Clone(object.Body)
+	copied.Metadata = cloneMap(object.Metadata)
+	copied.Tags = cloneMap(object.Tags)
+	if object.Checksums != nil {
+		copied.Checksums = make(map[s3types.ChecksumAlgorithm]string, len(object.Checksums))
+		for algorithm, value := range object.Checksums {
+			copied.Checksums[algorithm] = value
+		}
+	}
+	return copied
+}
+
+func cloneMap(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(values))
+	for key, value := range values {
+		copied[key] = value
+	}
+	return copied
+}
+
+// responseError wraps err like the SDK wraps the errors of S3 responses.
+func responseError(status int, err error) error {
+	return &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status, Header: http.Header{}}},
+			Err:      err,
+		},
+		RequestID: "S3FAKE",
+	}
+}
+
+func operationError(operation string, err error) error {
+	return &smithy.OperationError{ServiceID: "S3", OperationName: operation, Err: err}
+}
@@ -0,0 +1,391 @@
+package s3fake_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/delivery-station/ds-s3/internal/diagnostics"
+	"github.com/delivery-station/ds-s3/pkg/s3fake"
+	"github.com/delivery-station/ds-s3/pkg/uploader"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestTransportAgainstFake(t *testing.T) {
+	ctx := context.Background()
+	fake := s3fake.New()
+	fake.PageSize = 1
+	fake.CreateBucket("artifacts")
+	fake.Put("artifacts", s3fake.Object{Key: "releases/stale.txt", Body: []byte("old")})
+
+	dir := writeFiles(t, map[string]string{"app.js": "console.log(1)", "css/site.css": "body{}", "css/print.css": "@media print{}"})
+	plans, err := uploader.BuildPlans([]string{dir + "/"}, "releases", uploader.PlanPolicy{})
+	if err != nil {
+		t.Fatalf("BuildPlans returned error: %v", err)
+	}
+	transfer := uploader.NewTransport(fake, fake, "artifacts", true,
+		uploader.WithChecksumAlgorithm(s3types.ChecksumAlgorithmCrc64nvme),
+		uploader.WithObjectAnnotations(nil, map[string]string{"team": "web"}),
+	)
+
+	if removed, err := transfer.Cleanup(ctx, "releases"); err != nil || removed != 1 {
+		t.Fatalf("Cleanup returned %d, %v", removed, err)
+	}
+	results, err := transfer.Upload(ctx, plans)
+	if err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+	if len(results) != 3 || results[0].Checksum == "" {
+		t.Fatalf("unexpected results %+v", results)
+	}
+
+	listing, err := transfer.List(ctx, "releases", "/")
+	if err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+	if len(listing.Objects) != 1 || listing.Objects[0].Key != "releases/app.js" || len(listing.Prefixes) != 1 || listing.Prefixes[0] != "releases/css/" {
+		t.Errorf("unexpected listing %+v", listing)
+	}
+	if calls := fake.Calls("ListObjectsV2"); calls < 3 {
+		t.Errorf("expected paged listings, got %d requests", calls)
+	}
+
+	object, ok := fake.Object("artifacts", "releases/css/site.css")
+	if !ok || string(object.Body) != "body{}" || object.Tags["team"] != "web" {
+		t.Errorf("unexpected stored object %+v", object)
+	}
+	data, err := transfer.ReadObject(ctx, "releases/app.js")
+	if err != nil || string(data) != "console.log(1)" {
+		t.Errorf("ReadObject returned %q, %v", data, err)
+	}
+	if data, err := transfer.ReadObject(ctx, "releases/missing.js"); err != nil || data != nil {
+		t.Errorf("expected a missing object to read as nil, got %q, %v", data, err)
+	}
+}
+
+func TestFaultsFailMatchingRequests(t *testing.T) {
+	ctx := context.Background()
+	fake := s3fake.New()
+	fake.CreateBucket("artifacts")
+	fake.Inject(s3fake.Fault{Operation: "PutObject", Key: "releases/app.js", Err: s3fake.APIError("SlowDown", http.StatusServiceUnavailable), Times: 1})
+	transfer := uploader.NewTransport(fake, fake, "artifacts", true)
+
+	if err := transfer.WriteObject(ctx, "releases/app.js", []byte("one"), "text/javascript"); err == nil {
+		t.Fatal("expected the first write to fail")
+	} else if class := diagnostics.Classify(err); class != diagnostics.ClassThrottled {
+		t.Errorf("expected a throttling error, got %s: %v", class, err)
+	}
+	if err := transfer.WriteObject(ctx, "releases/app.js", []byte("two"), "text/javascript"); err != nil {
+		t.Fatalf("expected the fault to be spent, got %v", err)
+	}
+	if fake.Calls("PutObject") != 2 {
+		t.Errorf("expected 2 PutObject requests, got %d", fake.Calls("PutObject"))
+	}
+
+	_, err := fake.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String("missing"), Key: aws.String("key")})
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "NoSuchBucket" {
+		t.Errorf("expected NoSuchBucket, got %v", err)
+	}
+}
+
+func TestVersionedRollback(t *testing.T) {
+	ctx := context.Background()
+	fake := s3fake.New()
+	fake.PageSize = 1
+	fake.EnableVersioning("artifacts")
+	first := fake.Put("artifacts", s3fake.Object{Key: "releases/app.js", Body: []byte("v1")})
+	fake.Put("artifacts", s3fake.Object{Key: "releases/app.js", Body: []byte("v2")})
+	fake.Put("artifacts", s3fake.Object{Key: "releases/new.js", Body: []byte("new")})
+	transfer := uploader.NewTransport(fake, fake, "artifacts", true)
+
+	versions, err := transfer.ListVersions(ctx, "releases")
+	if err != nil || len(versions) != 3 {
+		t.Fatalf("ListVersions returned %d versions, %v", len(versions), err)
+	}
+	if _, err := transfer.Rollback(ctx, "releases", uploader.RollbackOptions{}); err != nil {
+		t.Fatalf("Rollback returned error: %v", err)
+	}
+
+	object, ok := fake.Object("artifacts", "releases/app.js")
+	if !ok || string(object.Body) != "v1" || object.VersionID == first.VersionID {
+		t.Errorf("expected v1 restored as a new version, got %+v", object)
+	}
+	if _, ok := fake.Object("artifacts", "releases/new.js"); ok {
+		t.Error("expected the object without a previous version to be deleted")
+	}
+	if keys := fake.Keys("artifacts"); len(keys) != 1 {
+		t.Errorf("unexpected keys %v", keys)
+	}
+}
+
+func TestDryRunWritesNothing(t *testing.T) {
+	ctx := context.Background()
+	fake := s3fake.New()
+	fake.EnableVersioning("artifacts")
+	fake.Put("artifacts", s3fake.Object{Key: "releases/app.js", Body: []byte("v1")})
+	fake.Put("artifacts", s3fake.Object{Key: "releases/app.js", Body: []byte("v2")})
+	fake.Put("artifacts", s3fake.Object{Key: "releases/stale.txt", Body: []byte("old")})
+	before := fake.Keys("artifacts")
+
+	dir := writeFiles(t, map[string]string{"app.js": "console.log(2)", "site.css": "body{}"})
+	plans, err := uploader.BuildPlans([]string{dir + "/"}, "releases", uploader.PlanPolicy{})
+	if err != nil {
+		t.Fatalf("BuildPlans returned error: %v", err)
+	}
+	transfer := uploader.NewTransport(fake, fake, "artifacts", true, uploader.WithDryRun(true))
+
+	if removed, err := transfer.Cleanup(ctx, "releases"); err != nil || removed != 2 {
+		t.Errorf("Cleanup returned %d, %v", removed, err)
+	}
+	if results, err := transfer.Upload(ctx, plans); err != nil || len(results) != 2 {
+		t.Errorf("Upload returned %+v, %v", results, err)
+	}
+	if _, copied, err := transfer.Snapshot(ctx, "releases", "snapshots", time.Now()); err != nil || len(copied) != 2 {
+		t.Errorf("Snapshot returned %+v, %v", copied, err)
+	}
+	if results, err := uploader.Promote(ctx, transfer, "releases", transfer, "production", uploader.PromoteOptions{Verify: true}); err != nil || len(results) != 2 {
+		t.Errorf("Promote returned %+v, %v", results, err)
+	}
+	if results, err := transfer.Rollback(ctx, "releases", uploader.RollbackOptions{}); err != nil || len(results) == 0 {
+		t.Errorf("Rollback returned %+v, %v", results, err)
+	}
+	if err := transfer.WriteObject(ctx, "releases/manifest.json", []byte("{}"), "application/json"); err != nil {
+		t.Errorf("WriteObject returned error: %v", err)
+	}
+	target := t.TempDir()
+	if results, err := transfer.Download(ctx, "releases", target); err != nil || len(results) != 2 {
+		t.Errorf("Download returned %+v, %v", results, err)
+	}
+
+	if after := fake.Keys("artifacts"); !reflect.DeepEqual(after, before) {
+		t.Errorf("expected the bucket to stay %v, got %v", before, after)
+	}
+	for _, operation := range []string{"PutObject", "CopyObject", "DeleteObjects", "DeleteObject"} {
+		if calls := fake.Calls(operation); calls != 0 {
+			t.Errorf("expected no %s requests, got %d", operation, calls)
+		}
+	}
+	if entries, err := os.ReadDir(target); err != nil || len(entries) != 0 {
+		t.Errorf("expected no downloaded files, got %v, %v", entries, err)
+	}
+}
+
+func TestMultipartUploadListing(t *testing.T) {
+	fake := s3fake.New()
+	fake.PageSize = 1
+	fake.StartMultipartUpload("artifacts", "releases/big.iso", 5<<20, 5<<20, 1024)
+	fake.StartMultipartUpload("artifacts", "releases/other.iso", 5<<20)
+	transfer := uploader.NewTransport(fake, fake, "artifacts", true)
+
+	uploads, err := transfer.ListMultipartUploads(context.Background(), "releases", true)
+	if err != nil {
+		t.Fatalf("ListMultipartUploads returned error: %v", err)
+	}
+	if len(uploads) != 2 || uploads[0].Parts != 3 || uploads[0].Size != 10<<20+1024 {
+		t.Errorf("unexpected uploads %+v", uploads)
+	}
+}
+
+func TestGCSBackend(t *testing.T) {
+	ctx := context.Background()
+	fake := s3fake.New()
+	for _, key := range []string{"releases/a.txt", "releases/b.txt", "other/c.txt"} {
+		fake.Put("artifacts", s3fake.Object{Key: key, Body: []byte(key)})
+	}
+	backend, err := uploader.NewBackend(uploader.BackendGCS, fake, fake)
+	if err != nil {
+		t.Fatalf("NewBackend returned error: %v", err)
+	}
+	transfer := uploader.NewTransport(fake, fake, "artifacts", true,
+		uploader.WithBackend(backend),
+		uploader.WithObjectAnnotations(map[string]string{"run": "7"}, map[string]string{"team": "web"}),
+		uploader.WithChecksumAlgorithm(s3types.ChecksumAlgorithmSha256),
+	)
+
+	plans, err := uploader.BuildPlans([]string{writeFiles(t, map[string]string{"d.txt": "d"}) + "/"}, "other", uploader.PlanPolicy{})
+	if err != nil {
+		t.Fatalf("BuildPlans returned error: %v", err)
+	}
+	if _, err := transfer.Upload(ctx, plans); err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+	object, ok := fake.Object("artifacts", "other/d.txt")
+	if !ok || object.Metadata["run"] != "7" || len(object.Tags) != 0 || len(object.Checksums) != 0 {
+		t.Errorf("expected metadata without tags and checksums, got %+v", object)
+	}
+
+	if removed, err := transfer.Cleanup(ctx, "releases"); err != nil || removed != 2 {
+		t.Fatalf("Cleanup returned %d, %v", removed, err)
+	}
+	if fake.Calls("DeleteObjects") != 0 || fake.Calls("DeleteObject") != 2 {
+		t.Errorf("expected single deletes, got %d batch and %d single requests", fake.Calls("DeleteObjects"), fake.Calls("DeleteObject"))
+	}
+	if keys := fake.Keys("artifacts"); len(keys) != 2 || keys[0] != "other/c.txt" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+}
+
+func TestAzureGatewayBackend(t *testing.T) {
+	ctx := context.Background()
+	fake := s3fake.New()
+	fake.Put("artifacts", s3fake.Object{Key: "staging/app.js", Body: []byte("app")})
+	fake.Put("artifacts", s3fake.Object{Key: "staging/old.js", Body: []byte("old")})
+	backend, err := uploader.NewBackend(uploader.BackendAzureGateway, fake, fake)
+	if err != nil {
+		t.Fatalf("NewBackend returned error: %v", err)
+	}
+	if weak, ok := backend.(uploader.WeakETagBackend); !ok || !weak.WeakETags() {
+		t.Fatal("expected the gateway backend to report weak ETags")
+	}
+	transfer := uploader.NewTransport(fake, fake, "artifacts", true, uploader.WithBackend(backend))
+
+	if removed, err := transfer.Cleanup(ctx, "staging"); err != nil || removed != 2 {
+		t.Fatalf("Cleanup returned %d, %v", removed, err)
+	}
+	if fake.Calls("DeleteObjects") != 0 || fake.Calls("DeleteObject") != 2 {
+		t.Errorf("expected single deletes, got %d batch and %d single requests", fake.Calls("DeleteObjects"), fake.Calls("DeleteObject"))
+	}
+}
+
+func TestAllowedPrefixesConfineWrites(t *testing.T) {
+	ctx := context.Background()
+	fake := s3fake.New()
+	fake.Put("artifacts", s3fake.Object{Key: "team-a/app.js", Body: []byte("a")})
+	fake.Put("artifacts", s3fake.Object{Key: "team-b/app.js", Body: []byte("b")})
+
+	transfer := uploader.NewTransport(fake, fake, "artifacts", true, uploader.WithAllowedPrefixes([]string{"team-a"}))
+	if err := transfer.WriteObject(ctx, "team-a/manifest.json", []byte("{}"), "application/json"); err != nil {
+		t.Errorf("expected a write within the allowed prefixes, got %v", err)
+	}
+	if err := transfer.WriteObject(ctx, "team-ab/manifest.json", []byte("{}"), "application/json"); !errors.Is(err, uploader.ErrKeyNotAllowed) {
+		t.Errorf("expected a write outside the allowed prefixes to be refused, got %v", err)
+	}
+	if _, err := transfer.Cleanup(ctx, "team-b"); !errors.Is(err, uploader.ErrKeyNotAllowed) {
+		t.Errorf("expected a cleanup outside the allowed prefixes to be refused, got %v", err)
+	}
+	if _, err := transfer.CopyPrefix(ctx, "team-a", "team-b/copy"); !errors.Is(err, uploader.ErrKeyNotAllowed) {
+		t.Errorf("expected a copy outside the allowed prefixes to be refused, got %v", err)
+	}
+
+	if keys := fake.Keys("artifacts"); !reflect.DeepEqual(keys, []string{"team-a/app.js", "team-a/manifest.json", "team-b/app.js"}) {
+		t.Errorf("unexpected keys %v", keys)
+	}
+}
+
+// laggingBackend hides every object from the first heads of its key, like a
+// caching gateway that has not seen the upload yet.
+type laggingBackend struct {
+	uploader.Backend
+	lag int
+
+	mu    sync.Mutex
+	heads map[string]int
+}
+
+func (b *laggingBackend) Head(ctx context.Context, input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	b.mu.Lock()
+	b.heads[aws.ToString(input.Key)]++
+	hidden := b.heads[aws.ToString(input.Key)] <= b.lag
+	b.mu.Unlock()
+	if hidden {
+		return nil, &s3types.NotFound{}
+	}
+	return b.Backend.Head(ctx, input)
+}
+
+func TestWaitVisibleRetriesUntilObjectsAppear(t *testing.T) {
+	ctx := context.Background()
+	fake := s3fake.New()
+	fake.CreateBucket("artifacts")
+	backend := &laggingBackend{Backend: uploader.S3Backend{Client: fake, Uploader: fake}, lag: 2, heads: map[string]int{}}
+	transfer := uploader.NewTransport(fake, fake, "artifacts", true, uploader.WithBackend(backend))
+
+	plans, err := uploader.BuildPlans([]string{writeFiles(t, map[string]string{"a.txt": "a", "b.txt": "b"}) + "/"}, "releases", uploader.PlanPolicy{})
+	if err != nil {
+		t.Fatalf("BuildPlans returned error: %v", err)
+	}
+	results, err := transfer.Upload(ctx, plans)
+	if err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+
+	missing, err := transfer.WaitVisible(ctx, results, time.Millisecond, time.Second)
+	if err != nil || len(missing) != 0 {
+		t.Fatalf("expected every object to become visible, got %v, %v", missing, err)
+	}
+	if heads := backend.heads["releases/a.txt"]; heads != 3 {
+		t.Errorf("expected three heads of a.txt, got %d", heads)
+	}
+
+	// An object still showing its old content is not visible yet.
+	stale := []uploader.UploadResult{{Key: "releases/a.txt", ETag: `"new"`}, {Key: "releases/gone.txt"}}
+	missing, err = transfer.WaitVisible(ctx, stale, time.Millisecond, 10*time.Millisecond)
+	if err != nil || !reflect.DeepEqual(missing, []string{"releases/a.txt", "releases/gone.txt"}) {
+		t.Errorf("expected both objects to be reported, got %v, %v", missing, err)
+	}
+}
+
+func TestThrottleCapsTransportsTogether(t *testing.T) {
+	ctx := context.Background()
+	fake := s3fake.New()
+	fake.CreateBucket("primary")
+	fake.CreateBucket("replica")
+
+	// The bucket of the throttle holds one second of data, which each upload
+	// alone fits in; together they have to wait for another second.
+	const rate = 64 << 10
+	throttle := uploader.NewThrottle(uploader.ThrottleSchedule{
+		Windows: []uploader.ThrottleWindow{{Bandwidth: rate, Start: 0, End: 24 * time.Hour}},
+	})
+	dir := writeFiles(t, map[string]string{"app.bin": string(make([]byte, rate))})
+	plans, err := uploader.BuildPlans([]string{dir + "/"}, "releases", uploader.PlanPolicy{})
+	if err != nil {
+		t.Fatalf("BuildPlans returned error: %v", err)
+	}
+
+	started := time.Now()
+	var wg sync.WaitGroup
+	for _, bucket := range []string{"primary", "replica"} {
+		transfer := uploader.NewTransport(fake, fake, bucket, true, uploader.WithThrottle(throttle))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := transfer.Upload(ctx, plans); err != nil {
+				t.Errorf("Upload to %s returned error: %v", bucket, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(started); elapsed < 900*time.Millisecond {
+		t.Errorf("expected %d bytes to take about a second at %d bytes/s combined, took %s", 2*rate, rate, elapsed)
+	}
+
+	if uploader.NewThrottle(uploader.ThrottleSchedule{}) != nil {
+		t.Error("expected no throttle without windows")
+	}
+}
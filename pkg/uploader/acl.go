@@ -0,0 +1,49 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// SetACL applies the canned ACL to uploaded, streamed, copied and restored
+// objects. Objects the plugin writes for itself, such as manifests and state,
+// get none. An empty ACL sends none.
+func (t *Transport) SetACL(acl s3types.ObjectCannedACL) {
+	t.acl = acl
+}
+
+// ACL returns the canned ACL applied to written objects.
+func (t *Transport) ACL() s3types.ObjectCannedACL {
+	return t.acl
+}
+
+// BucketOwnership returns the Object Ownership setting of the bucket, or an
+// empty value when the bucket has no ownership controls, as in buckets
+// created before ACLs were disabled by default.
+func (t *Transport) BucketOwnership(ctx context.Context) (s3types.ObjectOwnership, error) {
+	response, err := t.backend.OwnershipControls(ctx, &s3.GetBucketOwnershipControlsInput{
+		Bucket: aws.String(t.bucket),
+	})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "OwnershipControlsNotFoundError" {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read object ownership of bucket %s: %w", t.bucket, err)
+	}
+	if response.OwnershipControls == nil {
+		return "", nil
+	}
+	for _, rule := range response.OwnershipControls.Rules {
+		if rule.ObjectOwnership != "" {
+			return rule.ObjectOwnership, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,60 @@
+package uploader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestUploadAndCopyRequestACL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.tar")
+	if err := os.WriteFile(path, []byte("payload"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	stub := &stubUploader{}
+	client := &fakeClient{
+		listOutputs: []*s3.ListObjectsV2Output{
+			{Contents: []s3types.Object{{Key: aws.String("releases/app.tar"), Size: aws.Int64(7)}}},
+		},
+	}
+	transport := NewTransport(client, stub, "bucket", true, WithACL(s3types.ObjectCannedACLPublicRead))
+
+	if _, err := transport.Upload(context.Background(), []FilePlan{{Source: path, Key: "releases/app.tar", Size: 7}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := stub.uploads[0].ACL; got != s3types.ObjectCannedACLPublicRead {
+		t.Errorf("expected the upload to request public-read, got %q", got)
+	}
+	if err := transport.WriteObject(context.Background(), "releases/manifest.json", []byte("{}"), "application/json"); err != nil {
+		t.Fatalf("WriteObject returned error: %v", err)
+	}
+	if got := stub.uploads[1].ACL; got != "" {
+		t.Errorf("expected state objects to be written without ACL, got %q", got)
+	}
+
+	if _, _, err := transport.Snapshot(context.Background(), "releases", "snapshots", time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)); err != nil {
+		t.Fatalf("Snapshot returned error: %v", err)
+	}
+	if got := client.copyInputs[0].ACL; got != s3types.ObjectCannedACLPublicRead {
+		t.Errorf("expected the copy to request public-read, got %q", got)
+	}
+}
+
+func TestBucketOwnership(t *testing.T) {
+	transport := NewTransport(&fakeClient{}, &stubUploader{}, "bucket", true)
+	if ownership, err := transport.BucketOwnership(context.Background()); err != nil || ownership != "" {
+		t.Fatalf("expected no ownership controls, got %q (%v)", ownership, err)
+	}
+
+	transport = NewTransport(&fakeClient{bucketOwnership: s3types.ObjectOwnershipBucketOwnerEnforced}, &stubUploader{}, "bucket", true)
+	if ownership, err := transport.BucketOwnership(context.Background()); err != nil || ownership != s3types.ObjectOwnershipBucketOwnerEnforced {
+		t.Fatalf("expected BucketOwnerEnforced, got %q (%v)", ownership, err)
+	}
+}
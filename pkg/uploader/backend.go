@@ -0,0 +1,266 @@
+package uploader
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Backend is the object store a Transport reads and writes through. It
+// carries every request of a Transport, so a store with quirks can be
+// supported by a Backend that adjusts them instead of by changing the upload
+// logic. Copies in parts and single-object deletes, which only some stores
+// need, go to the Client through optional interfaces such as PartCopier.
+type Backend interface {
+	Put(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error)
+	Head(ctx context.Context, input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error)
+	List(ctx context.Context, input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error)
+	Delete(ctx context.Context, input *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error)
+	Copy(ctx context.Context, input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error)
+	Get(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error)
+	GetTagging(ctx context.Context, input *s3.GetObjectTaggingInput) (*s3.GetObjectTaggingOutput, error)
+	ListVersions(ctx context.Context, input *s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error)
+	ListUploads(ctx context.Context, input *s3.ListMultipartUploadsInput) (*s3.ListMultipartUploadsOutput, error)
+	ListParts(ctx context.Context, input *s3.ListPartsInput) (*s3.ListPartsOutput, error)
+	BucketEncryption(ctx context.Context, input *s3.GetBucketEncryptionInput) (*s3.GetBucketEncryptionOutput, error)
+	OwnershipControls(ctx context.Context, input *s3.GetBucketOwnershipControlsInput) (*s3.GetBucketOwnershipControlsOutput, error)
+}
+
+// BackendFactory builds a Backend over the client and uploader of a Transport.
+type BackendFactory func(client Client, uploader PutUploader) (Backend, error)
+
+// Names of the built-in backends.
+const (
+	BackendS3           = "s3"
+	BackendGCS          = "gcs"
+	BackendAzureGateway = "azure-gateway"
+)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]BackendFactory{
+		BackendS3: func(client Client, uploader PutUploader) (Backend, error) {
+			return S3Backend{Client: client, Uploader: uploader}, nil
+		},
+		BackendGCS:          newGCSBackend,
+		BackendAzureGateway: newAzureGatewayBackend,
+	}
+)
+
+// RegisterBackend makes a backend selectable by name with NewBackend,
+// replacing any backend registered under the same name.
+func RegisterBackend(name string, factory BackendFactory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[name] = factory
+}
+
+// Backends returns the names of the registered backends in lexical order.
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewBackend builds the backend registered under name. An empty name selects
+// BackendS3.
+func NewBackend(name string, client Client, uploader PutUploader) (Backend, error) {
+	if name == "" {
+		name = BackendS3
+	}
+	backendsMu.RLock()
+	factory, ok := backends[name]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %q", name)
+	}
+	return factory(client, uploader)
+}
+
+// S3Backend is the default Backend, sending every request to S3 as is.
+type S3Backend struct {
+	Client   Client
+	Uploader PutUploader
+}
+
+// Put uploads an object with the uploader.
+func (b S3Backend) Put(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error) {
+	return b.Uploader.Upload(ctx, input, opts...)
+}
+
+// Head sends a HeadObject request.
+func (b S3Backend) Head(ctx context.Context, input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	return b.Client.HeadObject(ctx, input)
+}
+
+// List sends a ListObjectsV2 request.
+func (b S3Backend) List(ctx context.Context, input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+	return b.Client.ListObjectsV2(ctx, input)
+}
+
+// Delete sends a DeleteObjects request.
+func (b S3Backend) Delete(ctx context.Context, input *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+	return b.Client.DeleteObjects(ctx, input)
+}
+
+// Copy sends a CopyObject request.
+func (b S3Backend) Copy(ctx context.Context, input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	return b.Client.CopyObject(ctx, input)
+}
+
+// Get sends a GetObject request.
+func (b S3Backend) Get(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	return b.Client.GetObject(ctx, input)
+}
+
+// GetTagging sends a GetObjectTagging request.
+func (b S3Backend) GetTagging(ctx context.Context, input *s3.GetObjectTaggingInput) (*s3.GetObjectTaggingOutput, error) {
+	return b.Client.GetObjectTagging(ctx, input)
+}
+
+// ListVersions sends a ListObjectVersions request.
+func (b S3Backend) ListVersions(ctx context.Context, input *s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error) {
+	return b.Client.ListObjectVersions(ctx, input)
+}
+
+// ListUploads sends a ListMultipartUploads request.
+func (b S3Backend) ListUploads(ctx context.Context, input *s3.ListMultipartUploadsInput) (*s3.ListMultipartUploadsOutput, error) {
+	return b.Client.ListMultipartUploads(ctx, input)
+}
+
+// ListParts sends a ListParts request.
+func (b S3Backend) ListParts(ctx context.Context, input *s3.ListPartsInput) (*s3.ListPartsOutput, error) {
+	return b.Client.ListParts(ctx, input)
+}
+
+// BucketEncryption sends a GetBucketEncryption request.
+func (b S3Backend) BucketEncryption(ctx context.Context, input *s3.GetBucketEncryptionInput) (*s3.GetBucketEncryptionOutput, error) {
+	return b.Client.GetBucketEncryption(ctx, input)
+}
+
+// OwnershipControls sends a GetBucketOwnershipControls request.
+func (b S3Backend) OwnershipControls(ctx context.Context, input *s3.GetBucketOwnershipControlsInput) (*s3.GetBucketOwnershipControlsOutput, error) {
+	return b.Client.GetBucketOwnershipControls(ctx, input)
+}
+
+// WeakETagBackend is implemented by backends whose ETags do not identify the
+// content of objects, so the same content may carry different ETags. Objects
+// stored through them are compared by size where ETags would be compared.
+type WeakETagBackend interface {
+	Backend
+	WeakETags() bool
+}
+
+// ObjectDeleter deletes single objects; *s3.Client implements it.
+type ObjectDeleter interface {
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+// gcsBackend talks to the XML interoperability API of Google Cloud Storage.
+// It has no multi-object delete, so batches are deleted one object at a time,
+// and puts and copies leave out the object tags, canned ACLs and S3 checksums
+// Cloud Storage rejects.
+type gcsBackend struct {
+	S3Backend
+	deleter ObjectDeleter
+}
+
+func newGCSBackend(client Client, uploader PutUploader) (Backend, error) {
+	deleter, err := objectDeleter(BackendGCS, client)
+	if err != nil {
+		return nil, err
+	}
+	return gcsBackend{S3Backend: S3Backend{Client: client, Uploader: uploader}, deleter: deleter}, nil
+}
+
+// Put uploads an object without tags, canned ACL and S3 checksum.
+func (b gcsBackend) Put(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error) {
+	input.Tagging = nil
+	input.ACL = ""
+	input.ChecksumAlgorithm = ""
+	return b.S3Backend.Put(ctx, input, opts...)
+}
+
+// Copy copies an object without tags, canned ACL and S3 checksum.
+func (b gcsBackend) Copy(ctx context.Context, input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	input.Tagging = nil
+	input.TaggingDirective = ""
+	input.ACL = ""
+	input.ChecksumAlgorithm = ""
+	return b.S3Backend.Copy(ctx, input)
+}
+
+// Delete deletes the objects of the batch one by one.
+func (b gcsBackend) Delete(ctx context.Context, input *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+	return deleteEach(ctx, b.deleter, input)
+}
+
+// azureGatewayBackend talks to Azure Blob Storage through an S3 gateway such
+// as s3proxy or the MinIO gateway. Those have no multi-object delete, and
+// their ETags are Azure's, which change with every write of the same content.
+type azureGatewayBackend struct {
+	S3Backend
+	deleter ObjectDeleter
+}
+
+func newAzureGatewayBackend(client Client, uploader PutUploader) (Backend, error) {
+	deleter, err := objectDeleter(BackendAzureGateway, client)
+	if err != nil {
+		return nil, err
+	}
+	return azureGatewayBackend{S3Backend: S3Backend{Client: client, Uploader: uploader}, deleter: deleter}, nil
+}
+
+// Delete deletes the objects of the batch one by one.
+func (b azureGatewayBackend) Delete(ctx context.Context, input *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+	return deleteEach(ctx, b.deleter, input)
+}
+
+// WeakETags reports that gateway ETags do not identify content.
+func (azureGatewayBackend) WeakETags() bool {
+	return true
+}
+
+func objectDeleter(backend string, client Client) (ObjectDeleter, error) {
+	deleter, ok := client.(ObjectDeleter)
+	if !ok {
+		return nil, fmt.Errorf("the %s backend needs a client that can delete single objects", backend)
+	}
+	return deleter, nil
+}
+
+// deleteEach deletes the objects of a batch one request at a time, reporting
+// failures as the errors of a DeleteObjects response would.
+func deleteEach(ctx context.Context, deleter ObjectDeleter, input *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+	output := &s3.DeleteObjectsOutput{}
+	for _, object := range input.Delete.Objects {
+		if _, err := deleter.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket:    input.Bucket,
+			Key:       object.Key,
+			VersionId: object.VersionId,
+		}); err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			output.Errors = append(output.Errors, s3types.Error{
+				Key:       object.Key,
+				VersionId: object.VersionId,
+				Message:   aws.String(err.Error()),
+			})
+			continue
+		}
+		output.Deleted = append(output.Deleted, s3types.DeletedObject{Key: object.Key, VersionId: object.VersionId})
+	}
+	return output, nil
+}
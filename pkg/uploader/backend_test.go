@@ -0,0 +1,79 @@
+package uploader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type recordingBackend struct {
+	S3Backend
+	puts, gets, versions int
+}
+
+func (b *recordingBackend) Put(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error) {
+	b.puts++
+	return b.S3Backend.Put(ctx, input, opts...)
+}
+
+func (b *recordingBackend) Get(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	b.gets++
+	return b.S3Backend.Get(ctx, input)
+}
+
+func (b *recordingBackend) ListVersions(ctx context.Context, input *s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error) {
+	b.versions++
+	return b.S3Backend.ListVersions(ctx, input)
+}
+
+func TestNewBackend(t *testing.T) {
+	if backend, err := NewBackend("", &fakeClient{}, &stubUploader{}); err != nil {
+		t.Fatalf("NewBackend returned error: %v", err)
+	} else if _, ok := backend.(S3Backend); !ok {
+		t.Errorf("expected the S3 backend by default, got %T", backend)
+	}
+	if _, err := NewBackend("swift", &fakeClient{}, &stubUploader{}); err == nil {
+		t.Error("expected an unknown backend to be rejected")
+	}
+	for _, name := range []string{BackendGCS, BackendAzureGateway} {
+		if _, err := NewBackend(name, &fakeClient{}, &stubUploader{}); err == nil {
+			t.Errorf("expected the %s backend to require single-object deletes", name)
+		}
+	}
+
+	recorder := &recordingBackend{}
+	RegisterBackend("recording", func(client Client, uploader PutUploader) (Backend, error) {
+		recorder.S3Backend = S3Backend{Client: client, Uploader: uploader}
+		return recorder, nil
+	})
+	defer func() {
+		backendsMu.Lock()
+		delete(backends, "recording")
+		backendsMu.Unlock()
+	}()
+
+	client, putter := &fakeClient{}, &stubUploader{}
+	backend, err := NewBackend("recording", client, putter)
+	if err != nil {
+		t.Fatalf("NewBackend returned error: %v", err)
+	}
+	transport := NewTransport(client, putter, "bucket", true, WithBackend(backend))
+	if err := transport.WriteObject(context.Background(), "releases/notes.txt", []byte("notes"), "text/plain"); err != nil {
+		t.Fatalf("WriteObject returned error: %v", err)
+	}
+	if recorder.puts != 1 || len(putter.uploads) != 1 {
+		t.Errorf("expected the put to go through the registered backend, got %d puts and %d uploads", recorder.puts, len(putter.uploads))
+	}
+
+	if _, err := transport.ReadObject(context.Background(), "releases/notes.txt"); err != nil {
+		t.Fatalf("ReadObject returned error: %v", err)
+	}
+	if _, err := transport.ListVersions(context.Background(), "releases"); err != nil {
+		t.Fatalf("ListVersions returned error: %v", err)
+	}
+	if recorder.gets != 1 || recorder.versions != 1 {
+		t.Errorf("expected reads to go through the registered backend, got %d gets and %d version listings", recorder.gets, recorder.versions)
+	}
+}
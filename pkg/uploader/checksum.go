@@ -0,0 +1,245 @@
+package uploader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// SetChecksumType selects how S3 combines part checksums of multipart
+// uploads: composite (a checksum of the part checksums) or full-object (a
+// checksum of the whole content, comparable with a locally computed CRC).
+// Full-object checksums require a CRC algorithm, so CRC32 is requested when
+// no algorithm is set. An empty type leaves the choice to S3.
+func (t *Transport) SetChecksumType(checksumType s3types.ChecksumType) {
+	t.checksumType = checksumType
+}
+
+// SetChecksumAlgorithm selects the algorithm S3 uses to checksum uploaded
+// objects, e.g. CRC64NVME. An empty algorithm leaves the choice to the SDK.
+func (t *Transport) SetChecksumAlgorithm(algorithm s3types.ChecksumAlgorithm) {
+	t.checksumAlgorithm = algorithm
+}
+
+// SHA256MetadataKey is the user metadata key (x-amz-meta-sha256) holding the
+// hex SHA-256 of an uploaded file.
+const SHA256MetadataKey = "sha256"
+
+// SetChecksumMetadata stores the hex SHA-256 of every uploaded file as
+// x-amz-meta-sha256. Unlike ETags, which depend on the multipart layout, and
+// S3 checksums, which depend on the configured algorithm, it can be compared
+// with any local copy using standard tools.
+func (t *Transport) SetChecksumMetadata(enabled bool) {
+	t.checksumMetadata = enabled
+}
+
+// fileSHA256 returns the hex SHA-256 of the file and rewinds it.
+func fileSHA256(file *os.File) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// queuedPlan is a plan on its way to an upload worker, with the SHA-256 of
+// its file when it was hashed ahead of the upload.
+type queuedPlan struct {
+	FilePlan
+	digest  string
+	hashErr error
+}
+
+// enqueue passes plans on to the upload workers unchanged.
+func enqueue(plans <-chan FilePlan) <-chan queuedPlan {
+	queue := make(chan queuedPlan)
+	go func() {
+		defer close(queue)
+		for plan := range plans {
+			queue <- queuedPlan{FilePlan: plan}
+		}
+	}()
+	return queue
+}
+
+// hashAhead hashes the files of plans for checksum metadata on up to
+// GOMAXPROCS goroutines while the upload workers transfer earlier files, so
+// that the CPU time of hashing hides behind network I/O instead of delaying
+// each upload. It runs at most lookahead plans ahead of the workers, plus the
+// ones being hashed, and may reorder plans. Once ctx is done plans are passed
+// on unhashed, so that the channel is still drained.
+func (t *Transport) hashAhead(ctx context.Context, plans <-chan FilePlan, lookahead int) <-chan queuedPlan {
+	queue := make(chan queuedPlan, lookahead)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for plan := range plans {
+				queued := queuedPlan{FilePlan: plan}
+				if ctx.Err() == nil && t.hashesFile(plan) {
+					queued.digest, queued.hashErr = hashFile(plan.Source)
+				}
+				queue <- queued
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(queue)
+	}()
+	return queue
+}
+
+// hashesFile reports whether uploading plan stores the SHA-256 of its file,
+// which placeholders and extracted tar archives do not.
+func (t *Transport) hashesFile(plan FilePlan) bool {
+	return !plan.Placeholder && !(t.extractTar && IsTarArchive(plan.Source))
+}
+
+// hashFile returns the hex SHA-256 of the file at path.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	return fileSHA256(file)
+}
+
+// withMetadata returns a copy of metadata with key set, leaving the shared
+// map untouched.
+func withMetadata(metadata map[string]string, key, value string) map[string]string {
+	merged := make(map[string]string, len(metadata)+1)
+	for k, v := range metadata {
+		merged[k] = v
+	}
+	merged[key] = value
+	return merged
+}
+
+// applyChecksum prepares the upload input and returns the upload manager
+// options needed for the configured checksum algorithm and type.
+func (t *Transport) applyChecksum(input *s3.PutObjectInput) []func(*manager.Uploader) {
+	if t.checksumAlgorithm != "" {
+		input.ChecksumAlgorithm = t.checksumAlgorithm
+	}
+	if t.checksumType == "" {
+		return nil
+	}
+	if t.checksumType == s3types.ChecksumTypeFullObject && input.ChecksumAlgorithm == "" {
+		input.ChecksumAlgorithm = s3types.ChecksumAlgorithmCrc32
+	}
+	return []func(*manager.Uploader){withChecksumType(t.checksumType)}
+}
+
+// withChecksumType sets the checksum type on the multipart requests issued by
+// the upload manager, which does not forward it from PutObjectInput. Single
+// part uploads always carry a full-object checksum and are left untouched.
+func withChecksumType(checksumType s3types.ChecksumType) func(*manager.Uploader) {
+	return withInitializeMiddleware(checksumTypeMiddleware(checksumType))
+}
+
+func checksumTypeMiddleware(checksumType s3types.ChecksumType) middleware.InitializeMiddleware {
+	return middleware.InitializeMiddlewareFunc("ChecksumType", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		switch params := in.Parameters.(type) {
+		case *s3.CreateMultipartUploadInput:
+			params.ChecksumType = checksumType
+		case *s3.CompleteMultipartUploadInput:
+			params.ChecksumType = checksumType
+		}
+		return next.HandleInitialize(ctx, in)
+	})
+}
+
+// checksums holds the object-level checksums S3 reports for an object.
+type checksums struct {
+	CRC64NVME *string
+	CRC32C    *string
+	CRC32     *string
+	SHA256    *string
+	SHA1      *string
+}
+
+func uploadChecksums(output *manager.UploadOutput) checksums {
+	return checksums{
+		CRC64NVME: output.ChecksumCRC64NVME,
+		CRC32C:    output.ChecksumCRC32C,
+		CRC32:     output.ChecksumCRC32,
+		SHA256:    output.ChecksumSHA256,
+		SHA1:      output.ChecksumSHA1,
+	}
+}
+
+func headChecksums(output *s3.HeadObjectOutput) checksums {
+	return checksums{
+		CRC64NVME: output.ChecksumCRC64NVME,
+		CRC32C:    output.ChecksumCRC32C,
+		CRC32:     output.ChecksumCRC32,
+		SHA256:    output.ChecksumSHA256,
+		SHA1:      output.ChecksumSHA1,
+	}
+}
+
+// values lists the reported checksums, strongest CRC first.
+func (c checksums) values() []checksumValue {
+	all := []checksumValue{
+		{s3types.ChecksumAlgorithmCrc64nvme, c.CRC64NVME},
+		{s3types.ChecksumAlgorithmCrc32c, c.CRC32C},
+		{s3types.ChecksumAlgorithmCrc32, c.CRC32},
+		{s3types.ChecksumAlgorithmSha256, c.SHA256},
+		{s3types.ChecksumAlgorithmSha1, c.SHA1},
+	}
+	reported := make([]checksumValue, 0, len(all))
+	for _, value := range all {
+		if value.value != nil {
+			reported = append(reported, value)
+		}
+	}
+	return reported
+}
+
+// pick returns the checksum of the requested algorithm, or the first one
+// reported when S3 used another algorithm.
+func (c checksums) pick(requested s3types.ChecksumAlgorithm) (s3types.ChecksumAlgorithm, string) {
+	reported := c.values()
+	for _, value := range reported {
+		if value.algorithm == requested {
+			return value.algorithm, aws.ToString(value.value)
+		}
+	}
+	if len(reported) > 0 {
+		return reported[0].algorithm, aws.ToString(reported[0].value)
+	}
+	return "", ""
+}
+
+// get returns the checksum reported for algorithm, or an empty string.
+func (c checksums) get(algorithm s3types.ChecksumAlgorithm) string {
+	for _, value := range c.values() {
+		if value.algorithm == algorithm {
+			return aws.ToString(value.value)
+		}
+	}
+	return ""
+}
+
+type checksumValue struct {
+	algorithm s3types.ChecksumAlgorithm
+	value     *string
+}
@@ -0,0 +1,259 @@
+package uploader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+func TestUploadReportsFullObjectChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.tar")
+	if err := os.WriteFile(path, []byte("payload"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	stub := &stubUploader{output: &manager.UploadOutput{
+		ETag:          aws.String("\"abc-3\""),
+		ChecksumSHA1:  aws.String("sha1"),
+		ChecksumCRC32: aws.String("crc32=="),
+		ChecksumType:  s3types.ChecksumTypeFullObject,
+	}}
+	transport := NewTransport(&fakeClient{}, stub, "bucket", true)
+	transport.SetChecksumType(s3types.ChecksumTypeFullObject)
+
+	results, err := transport.Upload(context.Background(), []FilePlan{{Source: path, Key: "app.tar", Size: 7}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := stub.uploads[0].ChecksumAlgorithm; got != s3types.ChecksumAlgorithmCrc32 {
+		t.Fatalf("expected CRC32 to be requested for full-object checksums, got %q", got)
+	}
+	if len(stub.options[0]) != 1 {
+		t.Fatalf("expected the checksum type option to be passed to the upload manager, got %d options", len(stub.options[0]))
+	}
+
+	result := results[0]
+	if result.Checksum != "crc32==" || result.ChecksumAlgorithm != "CRC32" || result.ChecksumType != "FULL_OBJECT" {
+		t.Fatalf("unexpected checksum in result: %+v", result)
+	}
+}
+
+func TestUploadWithoutChecksumTypeLeavesDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.tar")
+	if err := os.WriteFile(path, []byte("payload"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	stub := &stubUploader{}
+	transport := NewTransport(&fakeClient{}, stub, "bucket", true)
+
+	if _, err := transport.Upload(context.Background(), []FilePlan{{Source: path, Key: "app.tar", Size: 7}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stub.uploads[0].ChecksumAlgorithm != "" || len(stub.options[0]) != 0 {
+		t.Fatalf("expected no checksum settings, got algorithm %q and %d options", stub.uploads[0].ChecksumAlgorithm, len(stub.options[0]))
+	}
+}
+
+func TestChecksumTypeMiddlewareSetsMultipartRequests(t *testing.T) {
+	mw := checksumTypeMiddleware(s3types.ChecksumTypeFullObject)
+	next := middleware.InitializeHandlerFunc(func(ctx context.Context, in middleware.InitializeInput) (middleware.InitializeOutput, middleware.Metadata, error) {
+		return middleware.InitializeOutput{}, middleware.Metadata{}, nil
+	})
+
+	create := &s3.CreateMultipartUploadInput{}
+	complete := &s3.CompleteMultipartUploadInput{}
+	for _, params := range []interface{}{create, complete, &s3.UploadPartInput{}} {
+		if _, _, err := mw.HandleInitialize(context.Background(), middleware.InitializeInput{Parameters: params}, next); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if create.ChecksumType != s3types.ChecksumTypeFullObject || complete.ChecksumType != s3types.ChecksumTypeFullObject {
+		t.Fatalf("expected checksum type on create and complete, got %q and %q", create.ChecksumType, complete.ChecksumType)
+	}
+}
+
+func TestWithChecksumTypeCopiesClientOptions(t *testing.T) {
+	shared := make([]func(*s3.Options), 1, 4)
+	shared[0] = func(*s3.Options) {}
+
+	first := &manager.Uploader{ClientOptions: shared}
+	second := &manager.Uploader{ClientOptions: shared}
+	withChecksumType(s3types.ChecksumTypeComposite)(first)
+	withChecksumType(s3types.ChecksumTypeFullObject)(second)
+
+	if len(first.ClientOptions) != 2 || len(second.ClientOptions) != 2 {
+		t.Fatalf("expected one option to be appended, got %d and %d", len(first.ClientOptions), len(second.ClientOptions))
+	}
+	if &first.ClientOptions[0] == &shared[0] || &second.ClientOptions[0] == &shared[0] {
+		t.Fatalf("expected the shared option slice to be copied before appending")
+	}
+
+	var options s3.Options
+	first.ClientOptions[1](&options)
+	if len(options.APIOptions) != 1 {
+		t.Fatalf("expected the middleware to be registered, got %d api options", len(options.APIOptions))
+	}
+}
+
+func TestUploadRequestsConfiguredAlgorithm(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk.img")
+	if err := os.WriteFile(path, []byte("payload"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	stub := &stubUploader{output: &manager.UploadOutput{
+		ChecksumCRC32:     aws.String("crc32=="),
+		ChecksumCRC64NVME: aws.String("nvme=="),
+		ChecksumType:      s3types.ChecksumTypeFullObject,
+	}}
+	transport := NewTransport(&fakeClient{}, stub, "bucket", true)
+	transport.SetChecksumAlgorithm(s3types.ChecksumAlgorithmCrc64nvme)
+	transport.SetChecksumType(s3types.ChecksumTypeFullObject)
+
+	results, err := transport.Upload(context.Background(), []FilePlan{{Source: path, Key: "disk.img", Size: 7}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := stub.uploads[0].ChecksumAlgorithm; got != s3types.ChecksumAlgorithmCrc64nvme {
+		t.Fatalf("expected CRC64NVME to be requested, got %q", got)
+	}
+	if results[0].Checksum != "nvme==" || results[0].ChecksumAlgorithm != "CRC64NVME" {
+		t.Fatalf("expected the CRC64NVME checksum to be reported, got %+v", results[0])
+	}
+}
+
+func TestUploadStoresSHA256Metadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.tar")
+	if err := os.WriteFile(path, []byte("payload"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	stub := &stubUploader{}
+	transport := NewTransport(&fakeClient{}, stub, "bucket", true)
+	shared := map[string]string{"ds-run-id": "42"}
+	transport.SetObjectAnnotations(shared, nil)
+	transport.SetChecksumMetadata(true)
+
+	results, err := transport.Upload(context.Background(), []FilePlan{{Source: path, Key: "app.tar", Size: 7}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	const want = "239f59ed55e737c77147cf55ad0c1b030b6d7ee748a7426952f9b852d5a935e5"
+	metadata := stub.uploads[0].Metadata
+	if metadata[SHA256MetadataKey] != want || metadata["ds-run-id"] != "42" {
+		t.Fatalf("unexpected metadata %v", metadata)
+	}
+	if results[0].SHA256 != want {
+		t.Errorf("expected sha256 in result, got %q", results[0].SHA256)
+	}
+	if _, ok := shared[SHA256MetadataKey]; ok {
+		t.Error("expected the shared annotation metadata to stay untouched")
+	}
+}
+
+func TestHashAheadHashesPlannedFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.tar")
+	if err := os.WriteFile(path, []byte("payload"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	plans := []FilePlan{
+		{Source: path, Key: "app.tar", Size: 7},
+		{Source: filepath.Join(dir, "fifo"), Key: "fifo", Placeholder: true},
+		{Source: filepath.Join(dir, "missing"), Key: "missing"},
+	}
+	feed := func() <-chan FilePlan {
+		ch := make(chan FilePlan, len(plans))
+		for _, plan := range plans {
+			ch <- plan
+		}
+		close(ch)
+		return ch
+	}
+	transport := NewTransport(&fakeClient{}, &stubUploader{}, "bucket", true)
+
+	queued := make(map[string]queuedPlan)
+	for plan := range transport.hashAhead(context.Background(), feed(), 1) {
+		queued[plan.Key] = plan
+	}
+	const want = "239f59ed55e737c77147cf55ad0c1b030b6d7ee748a7426952f9b852d5a935e5"
+	if len(queued) != 3 || queued["app.tar"].digest != want || queued["app.tar"].hashErr != nil {
+		t.Fatalf("expected app.tar to be hashed, got %+v", queued)
+	}
+	if queued["fifo"].digest != "" || queued["fifo"].hashErr != nil {
+		t.Errorf("expected the placeholder to be passed on unhashed, got %+v", queued["fifo"])
+	}
+	if queued["missing"].hashErr == nil {
+		t.Error("expected hashing a missing file to fail")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	count := 0
+	for plan := range transport.hashAhead(ctx, feed(), 1) {
+		count++
+		if plan.digest != "" || plan.hashErr != nil {
+			t.Errorf("expected %s to be passed on unhashed after cancellation, got %+v", plan.Key, plan)
+		}
+	}
+	if count != 3 {
+		t.Errorf("expected every plan to be drained, got %d", count)
+	}
+}
+
+func TestUploadStoresSHA256MetadataOfConcurrentUploads(t *testing.T) {
+	dir := t.TempDir()
+	want := make(map[string]string)
+	var plans []FilePlan
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("file-%02d", i)
+		content := []byte(strings.Repeat(name, i+1))
+		source := filepath.Join(dir, name)
+		if err := os.WriteFile(source, content, 0o644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		sum := sha256.Sum256(content)
+		want[name] = hex.EncodeToString(sum[:])
+		plans = append(plans, FilePlan{Source: source, Key: name, Size: int64(len(content))})
+	}
+
+	stub := &stubUploader{}
+	transport := NewTransport(&fakeClient{}, stub, "bucket", true)
+	transport.SetChecksumMetadata(true)
+	transport.SetConcurrency(4)
+
+	results, err := transport.Upload(context.Background(), plans)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != len(plans) {
+		t.Fatalf("expected %d results, got %d", len(plans), len(results))
+	}
+	for _, result := range results {
+		if result.SHA256 != want[result.Key] {
+			t.Errorf("%s: expected sha256 %s, got %s", result.Key, want[result.Key], result.SHA256)
+		}
+	}
+	for _, upload := range stub.uploads {
+		key := aws.ToString(upload.Key)
+		if upload.Metadata[SHA256MetadataKey] != want[key] {
+			t.Errorf("%s: unexpected sha256 metadata %q", key, upload.Metadata[SHA256MetadataKey])
+		}
+	}
+}
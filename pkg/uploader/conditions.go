@@ -0,0 +1,109 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// ErrConditionFailed is returned by WriteObjectIf when the object changed
+// since it was read.
+var ErrConditionFailed = errors.New("object changed since it was read")
+
+// SetIfMatch makes uploads replace an object only while its ETag still equals
+// etag, turning the upload into a compare-and-swap. An upload whose object
+// changed in the meantime fails instead of overwriting the newer content. An
+// empty etag disables the condition.
+func (t *Transport) SetIfMatch(etag string) {
+	t.ifMatch = quoteETag(strings.TrimSpace(etag))
+}
+
+// applyConditions makes the upload conditional: If-Match when an ETag is
+// expected, otherwise If-None-Match: * when overwrite is disabled, so S3
+// rejects the write atomically instead of the caller checking beforehand.
+func (t *Transport) applyConditions(input *s3.PutObjectInput) []func(*manager.Uploader) {
+	switch {
+	case t.ifMatch != "":
+		input.IfMatch = aws.String(t.ifMatch)
+	case !t.overwrite:
+		input.IfNoneMatch = aws.String("*")
+	default:
+		return nil
+	}
+	return []func(*manager.Uploader){withConditions(input.IfMatch, input.IfNoneMatch)}
+}
+
+// withConditions sets the write conditions on CompleteMultipartUpload, which
+// the upload manager does not forward from PutObjectInput.
+func withConditions(ifMatch, ifNoneMatch *string) func(*manager.Uploader) {
+	return withInitializeMiddleware(conditionsMiddleware(ifMatch, ifNoneMatch))
+}
+
+func conditionsMiddleware(ifMatch, ifNoneMatch *string) middleware.InitializeMiddleware {
+	return middleware.InitializeMiddlewareFunc("WriteConditions", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		if params, ok := in.Parameters.(*s3.CompleteMultipartUploadInput); ok {
+			params.IfMatch = ifMatch
+			params.IfNoneMatch = ifNoneMatch
+		}
+		return next.HandleInitialize(ctx, in)
+	})
+}
+
+// withInitializeMiddleware adds m to every request issued by the upload manager.
+func withInitializeMiddleware(m middleware.InitializeMiddleware) func(*manager.Uploader) {
+	return func(u *manager.Uploader) {
+		// Copy before appending so concurrent uploads sharing the manager's
+		// option slice never write into the same backing array.
+		options := make([]func(*s3.Options), 0, len(u.ClientOptions)+1)
+		options = append(options, u.ClientOptions...)
+		u.ClientOptions = append(options, func(o *s3.Options) {
+			o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+				return stack.Initialize.Add(m, middleware.Before)
+			})
+		})
+	}
+}
+
+// conditionError explains a write rejected because of its conditions, or
+// returns nil when err has another cause.
+func (t *Transport) conditionError(key string, err error) error {
+	if !isPreconditionFailed(err) {
+		return nil
+	}
+	if t.ifMatch != "" {
+		return fmt.Errorf("object %s no longer matches ETag %s: %w", key, t.ifMatch, err)
+	}
+	return fmt.Errorf("object %s already exists and overwrite is disabled: %w", key, err)
+}
+
+// isPreconditionFailed reports whether S3 rejected a conditional write, either
+// because the condition did not hold (412) or because a concurrent conditional
+// write to the same key won (409 ConditionalRequestConflict).
+func isPreconditionFailed(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "PreconditionFailed", "ConditionalRequestConflict":
+			return true
+		}
+	}
+	var respErr *smithyhttp.ResponseError
+	return errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusPreconditionFailed
+}
+
+// quoteETag wraps a bare ETag in the quotes S3 compares against.
+func quoteETag(etag string) string {
+	if etag == "" || strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
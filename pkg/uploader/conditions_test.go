@@ -0,0 +1,57 @@
+package uploader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+)
+
+func TestTransportUploadIfMatch(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "manifest.json")
+	if err := os.WriteFile(source, []byte("{}"), 0o644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	plans := []FilePlan{{Source: source, Key: "manifest.json", Size: 2}}
+
+	uploader := &stubUploader{}
+	transport := NewTransport(&fakeClient{}, uploader, "bucket", false)
+	transport.SetIfMatch("abc123")
+
+	if _, err := transport.Upload(context.Background(), plans); err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+	input := uploader.uploads[0]
+	if got := aws.ToString(input.IfMatch); got != `"abc123"` {
+		t.Errorf("expected quoted If-Match ETag, got %q", got)
+	}
+	if input.IfNoneMatch != nil {
+		t.Errorf("expected no If-None-Match alongside If-Match, got %q", aws.ToString(input.IfNoneMatch))
+	}
+
+	uploader.err = &stubAPIError{code: "PreconditionFailed"}
+	_, err := transport.Upload(context.Background(), plans)
+	if err == nil || !strings.Contains(err.Error(), `no longer matches ETag "abc123"`) {
+		t.Fatalf("expected ETag mismatch error, got %v", err)
+	}
+}
+
+func TestConditionsMiddlewareSetsCompleteMultipartUpload(t *testing.T) {
+	mw := conditionsMiddleware(nil, aws.String("*"))
+	next := middleware.InitializeHandlerFunc(func(ctx context.Context, in middleware.InitializeInput) (middleware.InitializeOutput, middleware.Metadata, error) {
+		return middleware.InitializeOutput{}, middleware.Metadata{}, nil
+	})
+
+	params := &s3.CompleteMultipartUploadInput{}
+	if _, _, err := mw.HandleInitialize(context.Background(), middleware.InitializeInput{Parameters: params}, next); err != nil {
+		t.Fatalf("HandleInitialize returned error: %v", err)
+	}
+	if aws.ToString(params.IfNoneMatch) != "*" || params.IfMatch != nil {
+		t.Errorf("unexpected conditions on CompleteMultipartUpload: if-match %q, if-none-match %q", aws.ToString(params.IfMatch), aws.ToString(params.IfNoneMatch))
+	}
+}
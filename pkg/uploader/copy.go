@@ -0,0 +1,223 @@
+package uploader
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// SnapshotTimeFormat is the layout of the timestamp segment in snapshot keys.
+const SnapshotTimeFormat = "20060102T150405Z"
+
+// CopyResult describes a server-side copy performed by Transport.
+type CopyResult struct {
+	Source string `json:"source"`
+	Key    string `json:"key"`
+	Size   int64  `json:"size"`
+}
+
+// CopyPrefix server-side copies every object under src to the same relative key under dst.
+// Keys that already live beneath dst are skipped so a destination nested in the source is safe.
+func (t *Transport) CopyPrefix(ctx context.Context, src, dst string) ([]CopyResult, error) {
+	return t.copyPrefix(ctx, src, dst, dst)
+}
+
+// Snapshot copies everything under prefix to <root>/<timestamp>/<prefix> and returns
+// the snapshot location. Existing snapshots beneath root are never copied again.
+func (t *Transport) Snapshot(ctx context.Context, prefix, root string, at time.Time) (string, []CopyResult, error) {
+	base := normalizePrefix(root)
+	if base == "" {
+		return "", nil, fmt.Errorf("snapshot root prefix is required")
+	}
+
+	location := joinKey(base+"/"+at.UTC().Format(SnapshotTimeFormat), normalizePrefix(prefix))
+	results, err := t.copyPrefix(ctx, prefix, location, base)
+	return location, results, err
+}
+
+func (t *Transport) copyPrefix(ctx context.Context, src, dst, exclude string) ([]CopyResult, error) {
+	source := normalizePrefix(src)
+	destination := normalizePrefix(dst)
+	if source == destination {
+		return nil, fmt.Errorf("source and destination prefixes must differ")
+	}
+
+	listPrefix := source
+	if listPrefix != "" {
+		listPrefix += "/"
+	}
+	excluded := normalizePrefix(exclude)
+
+	results := make([]CopyResult, 0)
+	err := t.walkObjects(ctx, listPrefix, func(obj s3types.Object) error {
+		key := aws.ToString(obj.Key)
+		if excluded != "" && strings.HasPrefix(key, excluded+"/") {
+			return nil
+		}
+
+		target := joinKey(destination, strings.TrimPrefix(key, listPrefix))
+		input := &s3.CopyObjectInput{
+			Bucket:     aws.String(t.bucket),
+			Key:        aws.String(target),
+			CopySource: aws.String(copySource(t.bucket, key, "")),
+			ACL:        t.acl,
+		}
+		t.encryptCopy(input)
+		if err := t.copyObject(ctx, input, key, aws.ToInt64(obj.Size)); err != nil {
+			return fmt.Errorf("failed to copy %s to %s: %w", key, target, err)
+		}
+
+		results = append(results, CopyResult{Source: key, Key: target, Size: aws.ToInt64(obj.Size)})
+		return nil
+	})
+	// Directory buckets list keys in no particular order.
+	sort.Slice(results, func(i, j int) bool { return results[i].Source < results[j].Source })
+	return results, err
+}
+
+// MaxCopyObjectSize is the largest object a single CopyObject request copies;
+// larger objects are copied in parts.
+const MaxCopyObjectSize int64 = 5 << 30
+
+// copyPartSize is the smallest part larger objects are copied in. Parts grow
+// so that no copy needs more than maxCopyParts of them.
+const (
+	copyPartSize int64 = 512 << 20
+	maxCopyParts int64 = 10000
+)
+
+// PartCopier copies objects in parts; *s3.Client implements it.
+type PartCopier interface {
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPartCopy(ctx context.Context, params *s3.UploadPartCopyInput, optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+}
+
+// copyObject copies the object at source, size bytes long, as input asks with
+// a single CopyObject request, or in parts above MaxCopyObjectSize.
+func (t *Transport) copyObject(ctx context.Context, input *s3.CopyObjectInput, source string, size int64) error {
+	if size <= MaxCopyObjectSize {
+		_, err := t.backend.Copy(ctx, input)
+		return err
+	}
+	return t.copyParts(ctx, input, source, size)
+}
+
+// copyParts copies the object at source in parts with UploadPartCopy. Like
+// Copy through the backend, it honors the allowed prefixes and dry runs.
+func (t *Transport) copyParts(ctx context.Context, input *s3.CopyObjectInput, source string, size int64) error {
+	key := aws.ToString(input.Key)
+	if len(t.allowedPrefixes) > 0 && !KeyAllowed(t.allowedPrefixes, key) {
+		return fmt.Errorf("refusing to copy to %s: %w", key, ErrKeyNotAllowed)
+	}
+	if t.dryRun {
+		return nil
+	}
+	copier, ok := t.client.(PartCopier)
+	if !ok {
+		return fmt.Errorf("copying objects above %d bytes needs a client that can copy parts", MaxCopyObjectSize)
+	}
+
+	// Unlike CopyObject, a copy in parts does not carry over the metadata
+	// and content headers of the source.
+	head, err := t.backend.Head(ctx, &s3.HeadObjectInput{Bucket: input.Bucket, Key: aws.String(source)})
+	if err != nil {
+		return err
+	}
+	created, err := copier.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:               input.Bucket,
+		Key:                  input.Key,
+		ACL:                  input.ACL,
+		ServerSideEncryption: input.ServerSideEncryption,
+		SSEKMSKeyId:          input.SSEKMSKeyId,
+		BucketKeyEnabled:     input.BucketKeyEnabled,
+		Metadata:             head.Metadata,
+		ContentType:          head.ContentType,
+		ContentEncoding:      head.ContentEncoding,
+		ContentDisposition:   head.ContentDisposition,
+		CacheControl:         head.CacheControl,
+	})
+	if err != nil {
+		return err
+	}
+	uploadID := created.UploadId
+
+	partSize := max(copyPartSize, (size+maxCopyParts-1)/maxCopyParts)
+	parts := make([]s3types.CompletedPart, 0, (size+partSize-1)/partSize)
+	for start := int64(0); start < size; start += partSize {
+		number := aws.Int32(int32(len(parts) + 1))
+		part, err := copier.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+			Bucket:          input.Bucket,
+			Key:             input.Key,
+			UploadId:        uploadID,
+			PartNumber:      number,
+			CopySource:      input.CopySource,
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", start, min(start+partSize, size)-1)),
+		})
+		if err != nil {
+			t.abortCopy(ctx, copier, input, uploadID)
+			return fmt.Errorf("part %d: %w", len(parts)+1, err)
+		}
+		completed := s3types.CompletedPart{PartNumber: number}
+		if part.CopyPartResult != nil {
+			completed.ETag = part.CopyPartResult.ETag
+		}
+		parts = append(parts, completed)
+	}
+
+	if _, err := copier.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          input.Bucket,
+		Key:             input.Key,
+		UploadId:        uploadID,
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: parts},
+	}); err != nil {
+		t.abortCopy(ctx, copier, input, uploadID)
+		return err
+	}
+	return nil
+}
+
+// abortCopy aborts a failed copy in parts so that its parts are not left
+// behind, even when ctx was canceled.
+func (t *Transport) abortCopy(ctx context.Context, copier PartCopier, input *s3.CopyObjectInput, uploadID *string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortTimeout)
+	defer cancel()
+	_, _ = copier.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   input.Bucket,
+		Key:      input.Key,
+		UploadId: uploadID,
+	})
+}
+
+// walkObjects invokes fn for every object under the raw listing prefix, following pagination.
+func (t *Transport) walkObjects(ctx context.Context, prefix string, fn func(obj s3types.Object) error) error {
+	var token *string
+	for {
+		response, err := t.backend.List(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(t.bucket),
+			Prefix:            stringPointer(prefix),
+			ContinuationToken: token,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list objects under %q: %w", prefix, err)
+		}
+
+		for _, obj := range response.Contents {
+			if err := fn(obj); err != nil {
+				return err
+			}
+		}
+
+		if response.NextContinuationToken == nil {
+			return nil
+		}
+		token = response.NextContinuationToken
+	}
+}
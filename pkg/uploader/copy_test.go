@@ -0,0 +1,163 @@
+package uploader
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestSnapshotCopiesPrefixToTimestampedLocation(t *testing.T) {
+	client := &fakeClient{
+		listOutputs: []*s3.ListObjectsV2Output{
+			{
+				Contents: []s3types.Object{
+					{Key: aws.String("releases/app.bin"), Size: aws.Int64(3)},
+					{Key: aws.String("releases/docs/readme.md"), Size: aws.Int64(5)},
+				},
+			},
+		},
+	}
+	transport := NewTransport(client, &stubUploader{}, "bucket", true)
+
+	at := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	location, results, err := transport.Snapshot(context.Background(), "releases", "snapshots", at)
+	if err != nil {
+		t.Fatalf("Snapshot returned error: %v", err)
+	}
+
+	if location != "snapshots/20240506T070809Z/releases" {
+		t.Fatalf("unexpected snapshot location %s", location)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 copies, got %d", len(results))
+	}
+	if results[1].Key != "snapshots/20240506T070809Z/releases/docs/readme.md" {
+		t.Errorf("unexpected copy target %s", results[1].Key)
+	}
+	if aws.ToString(client.copyInputs[0].CopySource) != "bucket/releases/app.bin" {
+		t.Errorf("unexpected copy source %s", aws.ToString(client.copyInputs[0].CopySource))
+	}
+}
+
+func TestSnapshotSkipsExistingSnapshots(t *testing.T) {
+	client := &fakeClient{
+		listOutputs: []*s3.ListObjectsV2Output{
+			{
+				Contents: []s3types.Object{
+					{Key: aws.String("app.bin")},
+					{Key: aws.String("snapshots/20240101T000000Z/app.bin")},
+				},
+			},
+		},
+	}
+	transport := NewTransport(client, &stubUploader{}, "bucket", true)
+
+	_, results, err := transport.Snapshot(context.Background(), "", "snapshots", time.Now())
+	if err != nil {
+		t.Fatalf("Snapshot returned error: %v", err)
+	}
+	if len(results) != 1 || results[0].Source != "app.bin" {
+		t.Fatalf("expected only app.bin to be copied, got %+v", results)
+	}
+}
+
+func TestCopyPrefixOrdersUnsortedListings(t *testing.T) {
+	client := &fakeClient{
+		listOutputs: []*s3.ListObjectsV2Output{
+			{
+				Contents: []s3types.Object{
+					{Key: aws.String("cache/b.bin")},
+					{Key: aws.String("cache/a.bin")},
+				},
+			},
+		},
+	}
+	transport := NewTransport(client, &stubUploader{}, "cache--use1-az4--x-s3", true)
+
+	results, err := transport.CopyPrefix(context.Background(), "cache", "backup")
+	if err != nil {
+		t.Fatalf("CopyPrefix returned error: %v", err)
+	}
+	if len(results) != 2 || results[0].Source != "cache/a.bin" || results[1].Source != "cache/b.bin" {
+		t.Errorf("expected results ordered by source key, got %+v", results)
+	}
+}
+
+// partCopyClient is a fakeClient that also copies objects in parts.
+type partCopyClient struct {
+	fakeClient
+	created   *s3.CreateMultipartUploadInput
+	ranges    []string
+	completed *s3.CompleteMultipartUploadInput
+}
+
+func (c *partCopyClient) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	c.created = params
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload")}, nil
+}
+
+func (c *partCopyClient) UploadPartCopy(ctx context.Context, params *s3.UploadPartCopyInput, optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+	c.ranges = append(c.ranges, aws.ToString(params.CopySourceRange))
+	return &s3.UploadPartCopyOutput{CopyPartResult: &s3types.CopyPartResult{ETag: aws.String(aws.ToString(params.CopySourceRange))}}, nil
+}
+
+func (c *partCopyClient) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	c.completed = params
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (c *partCopyClient) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func TestSnapshotCopiesLargeObjectsInParts(t *testing.T) {
+	size := MaxCopyObjectSize + copyPartSize/2
+	client := &partCopyClient{fakeClient: fakeClient{
+		listOutputs: []*s3.ListObjectsV2Output{
+			{
+				Contents: []s3types.Object{
+					{Key: aws.String("releases/disk.img"), Size: aws.Int64(size)},
+					{Key: aws.String("releases/app.bin"), Size: aws.Int64(3)},
+				},
+			},
+		},
+		headOutputs: map[string]*s3.HeadObjectOutput{
+			"releases/disk.img": {ContentType: aws.String("application/x-raw-disk-image"), Metadata: map[string]string{"sha256": "abc"}},
+		},
+	}}
+	transport := NewTransport(client, &stubUploader{}, "bucket", true)
+
+	at := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	_, results, err := transport.Snapshot(context.Background(), "releases", "snapshots", at)
+	if err != nil {
+		t.Fatalf("Snapshot returned error: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 copies, got %+v", results)
+	}
+	if len(client.copyInputs) != 1 || aws.ToString(client.copyInputs[0].Key) != "snapshots/20240506T070809Z/releases/app.bin" {
+		t.Fatalf("expected only the small object to be copied at once, got %d copies", len(client.copyInputs))
+	}
+
+	if aws.ToString(client.created.Key) != "snapshots/20240506T070809Z/releases/disk.img" {
+		t.Errorf("unexpected multipart key %s", aws.ToString(client.created.Key))
+	}
+	if aws.ToString(client.created.ContentType) != "application/x-raw-disk-image" || client.created.Metadata["sha256"] != "abc" {
+		t.Errorf("expected the source headers to be carried over, got %+v", client.created)
+	}
+	parts := int(size / copyPartSize)
+	if len(client.ranges) != parts+1 {
+		t.Fatalf("expected %d parts, got %d", parts+1, len(client.ranges))
+	}
+	if last := fmt.Sprintf("bytes=%d-%d", int64(parts)*copyPartSize, size-1); client.ranges[parts] != last {
+		t.Errorf("expected the last part to cover %s, got %s", last, client.ranges[parts])
+	}
+	if got := len(client.completed.MultipartUpload.Parts); got != parts+1 {
+		t.Errorf("expected %d completed parts, got %d", parts+1, got)
+	}
+}
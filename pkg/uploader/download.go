@@ -0,0 +1,197 @@
+package uploader
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// gzipSuffix marks keys holding gzip-compressed content.
+const gzipSuffix = ".gz"
+
+// DownloadResult describes a single object written to disk by Download.
+type DownloadResult struct {
+	Key  string `json:"key"`
+	Path string `json:"path"`
+	// Size is the number of bytes written, after decryption and decompression.
+	Size         int64 `json:"size"`
+	Decrypted    bool  `json:"decrypted,omitempty"`
+	Decompressed bool  `json:"decompressed,omitempty"`
+	// Pack is the pack the file was extracted from; see Pack.
+	Pack string `json:"pack,omitempty"`
+}
+
+// SetDecompress makes Download gunzip objects stored with
+// Content-Encoding: gzip or under a .gz key, writing the latter to their
+// original file name without the suffix.
+func (t *Transport) SetDecompress(enabled bool) {
+	t.decompress = enabled
+}
+
+// Download writes every object under prefix to dir, recreating the key
+// hierarchy below the prefix. Files are written next to their destination
+// first and renamed into place, so an interrupted run leaves no partial files.
+// Files bundled by Pack are extracted from their packs in place of the packs,
+// including those packed by uploads to a prefix above prefix, whose index is
+// looked up there.
+func (t *Transport) Download(ctx context.Context, prefix, dir string) ([]DownloadResult, error) {
+	listing, err := t.List(ctx, prefix, "")
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := normalizePrefix(prefix)
+	packed := make(map[string]string)
+	for _, object := range listing.Objects {
+		if base, ok := isPackIndex(object.Key); ok {
+			packed[joinKey(base, PackDir)+"/"] = object.Key
+		}
+	}
+	// The packs of uploads above the prefix are not below it, so only their
+	// indexes are read and not listed.
+	indexKeys := packIndexKeysAbove(resolved)
+
+	results := make([]DownloadResult, 0, len(listing.Objects))
+	for _, object := range listing.Objects {
+		if inPackDir(object.Key, packed) {
+			continue
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(object.Key, resolved), "/")
+		// Zero-byte keys ending in / are folder markers created by consoles.
+		if rel == "" || strings.HasSuffix(rel, "/") {
+			continue
+		}
+		rel = strings.TrimPrefix(path.Clean("/"+rel), "/")
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+		if t.dryRun {
+			results = append(results, DownloadResult{Key: object.Key, Path: target, Size: object.Size})
+			continue
+		}
+
+		result, err := t.downloadObject(ctx, object.Key, target)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+
+	dirs := make([]string, 0, len(packed))
+	for packDir := range packed {
+		dirs = append(dirs, packDir)
+	}
+	sort.Strings(dirs)
+	for _, packDir := range dirs {
+		indexKeys = append(indexKeys, packed[packDir])
+	}
+	for _, indexKey := range indexKeys {
+		index, err := t.readPackIndex(ctx, indexKey)
+		if err != nil {
+			return results, err
+		}
+		if index == nil {
+			continue
+		}
+		base, _ := isPackIndex(indexKey)
+		extracted, err := t.extractPacks(ctx, index.under(resolved), base, resolved, dir)
+		results = append(results, extracted...)
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// inPackDir reports whether key is stored in one of the pack directories.
+func inPackDir(key string, packDirs map[string]string) bool {
+	for packDir := range packDirs {
+		if strings.HasPrefix(key, packDir) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Transport) downloadObject(ctx context.Context, key, target string) (DownloadResult, error) {
+	response, err := t.backend.Get(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(t.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return DownloadResult{}, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	result := DownloadResult{Key: key, Path: target}
+	body, decrypted, err := t.open(ctx, key, response.Body, response.Metadata)
+	if err != nil {
+		return DownloadResult{}, err
+	}
+	result.Decrypted = decrypted
+	if t.decompress && isGzip(key, aws.ToString(response.ContentEncoding)) {
+		reader, err := gzip.NewReader(body)
+		if err != nil {
+			return DownloadResult{}, fmt.Errorf("failed to decompress %s: %w", key, err)
+		}
+		defer func() {
+			_ = reader.Close()
+		}()
+		body = reader
+		result.Decompressed = true
+		if strings.HasSuffix(strings.ToLower(target), gzipSuffix) && len(target) > len(gzipSuffix) {
+			result.Path = target[:len(target)-len(gzipSuffix)]
+		}
+	}
+
+	if result.Size, err = writeFile(result.Path, body); err != nil {
+		return DownloadResult{}, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	return result, nil
+}
+
+// isGzip reports whether an object holds gzip content, judging by its
+// Content-Encoding header or, failing that, its key.
+func isGzip(key, contentEncoding string) bool {
+	for _, encoding := range strings.Split(contentEncoding, ",") {
+		if strings.EqualFold(strings.TrimSpace(encoding), "gzip") {
+			return true
+		}
+	}
+	return strings.HasSuffix(strings.ToLower(key), gzipSuffix)
+}
+
+func writeFile(target string, body io.Reader) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return 0, err
+	}
+	file, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = os.Remove(file.Name())
+	}()
+
+	written, err := io.Copy(file, body)
+	if err != nil {
+		_ = file.Close()
+		return 0, err
+	}
+	if err := file.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(file.Name(), target); err != nil {
+		return 0, err
+	}
+	return written, nil
+}
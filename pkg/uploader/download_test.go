@@ -0,0 +1,100 @@
+package uploader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func gzipString(t *testing.T, content string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write([]byte(content)); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	return buf.String()
+}
+
+func downloadClient(t *testing.T) *fakeClient {
+	t.Helper()
+	return &fakeClient{
+		listOutputs: []*s3.ListObjectsV2Output{{
+			Contents: []s3types.Object{
+				{Key: aws.String("releases/")},
+				{Key: aws.String("releases/app/index.html")},
+				{Key: aws.String("releases/logs/build.log.gz")},
+				{Key: aws.String("releases/app/main.js")},
+			},
+		}},
+		objects: map[string]string{
+			"releases/app/index.html":    "<html></html>",
+			"releases/logs/build.log.gz": gzipString(t, "build ok"),
+			"releases/app/main.js":       gzipString(t, "console.log(1)"),
+		},
+		encodings: map[string]string{"releases/app/main.js": "gzip"},
+	}
+}
+
+func TestDownloadDecompressesGzipObjects(t *testing.T) {
+	dir := t.TempDir()
+	transport := NewTransport(downloadClient(t), &stubUploader{}, "bucket", true)
+	transport.SetDecompress(true)
+
+	results, err := transport.Download(context.Background(), "releases", dir)
+	if err != nil {
+		t.Fatalf("Download returned error: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 downloads, got %+v", results)
+	}
+
+	want := map[string]string{
+		"app/index.html": "<html></html>",
+		"app/main.js":    "console.log(1)",
+		"logs/build.log": "build ok",
+	}
+	for rel, content := range want {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			t.Fatalf("expected %s to be written: %v", rel, err)
+		}
+		if string(data) != content {
+			t.Errorf("%s = %q, want %q", rel, data, content)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "logs", "build.log.gz")); !os.IsNotExist(err) {
+		t.Errorf("expected the .gz suffix to be dropped, got %v", err)
+	}
+	for _, result := range results {
+		if result.Decompressed != (result.Key != "releases/app/index.html") {
+			t.Errorf("unexpected decompressed flag for %+v", result)
+		}
+	}
+}
+
+func TestDownloadKeepsCompressedObjectsByDefault(t *testing.T) {
+	dir := t.TempDir()
+	transport := NewTransport(downloadClient(t), &stubUploader{}, "bucket", true)
+
+	if _, err := transport.Download(context.Background(), "releases", dir); err != nil {
+		t.Fatalf("Download returned error: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "logs", "build.log.gz"))
+	if err != nil {
+		t.Fatalf("expected the object to keep its name: %v", err)
+	}
+	if string(data) != gzipString(t, "build ok") {
+		t.Error("expected the compressed content to be written unchanged")
+	}
+}
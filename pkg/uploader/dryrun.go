@@ -0,0 +1,54 @@
+package uploader
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// SetDryRun makes the transport a preview: puts, copies and deletes succeed
+// without being sent, so uploads, cleanups, snapshots, promotions and
+// rollbacks report what they would change, while heads and listings still
+// read the bucket. Downloads list the files they would write. Results of
+// writes carry no ETag, version or checksum.
+func (t *Transport) SetDryRun(enabled bool) {
+	t.dryRun = enabled
+	t.SetBackend(t.base)
+}
+
+// DryRun reports whether the transport only previews writes.
+func (t *Transport) DryRun() bool {
+	return t.dryRun
+}
+
+// dryRunBackend passes reads to the wrapped backend and drops writes.
+type dryRunBackend struct {
+	Backend
+}
+
+// Put reports the object as uploaded without reading its body.
+func (b dryRunBackend) Put(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error) {
+	return &manager.UploadOutput{Key: input.Key}, nil
+}
+
+// Delete reports every object of the batch as deleted.
+func (b dryRunBackend) Delete(ctx context.Context, input *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+	output := &s3.DeleteObjectsOutput{}
+	for _, object := range input.Delete.Objects {
+		output.Deleted = append(output.Deleted, s3types.DeletedObject{Key: object.Key, VersionId: object.VersionId})
+	}
+	return output, nil
+}
+
+// Copy reports the object as copied.
+func (b dryRunBackend) Copy(ctx context.Context, input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	return &s3.CopyObjectOutput{}, nil
+}
+
+// WeakETags reports whether the wrapped backend has weak ETags.
+func (b dryRunBackend) WeakETags() bool {
+	weak, ok := b.Backend.(WeakETagBackend)
+	return ok && weak.WeakETags()
+}
@@ -0,0 +1,196 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// SetEncryption requests server-side encryption for every object written by
+// the transport. kmsKeyID is only sent with the KMS modes; an empty mode leaves
+// encryption to the bucket default.
+func (t *Transport) SetEncryption(mode s3types.ServerSideEncryption, kmsKeyID string) {
+	t.sse = mode
+	t.sseKMSKeyID = kmsKeyID
+}
+
+// SetBucketKey makes objects written with aws:kms use an S3 Bucket Key, so S3
+// derives their data keys from a bucket-level key instead of calling KMS for
+// every object. Unset leaves the choice to the bucket configuration.
+func (t *Transport) SetBucketKey(enabled bool) {
+	t.bucketKey = enabled
+}
+
+// KMSKeyRule encrypts the objects whose keys match Pattern with KMSKeyID
+// instead of the key given to SetEncryption. A pattern without a slash
+// matches any segment of the key, such as a file name; one with a slash is
+// anchored at the start of the key and also matches the objects below it.
+// Segments are matched with path.Match, so * does not cross slashes.
+type KMSKeyRule struct {
+	Pattern  string
+	KMSKeyID string
+}
+
+// Matches reports whether the rule applies to the object at key.
+func (r KMSKeyRule) Matches(key string) bool {
+	return matchPattern(r.Pattern, key)
+}
+
+// ValidateKMSKeyPattern reports whether pattern is a valid rule pattern.
+func ValidateKMSKeyPattern(pattern string) error {
+	return validatePattern(pattern)
+}
+
+// matchPattern reports whether pattern matches name, a slash-separated path.
+// A pattern without a slash matches any segment of name; one with a slash is
+// anchored at the start of name and also matches the paths below it.
+func matchPattern(pattern, name string) bool {
+	pattern = strings.Trim(pattern, "/")
+	if pattern == "" {
+		return false
+	}
+	segments := strings.Split(name, "/")
+	if !strings.Contains(pattern, "/") {
+		for _, segment := range segments {
+			if ok, _ := path.Match(pattern, segment); ok {
+				return true
+			}
+		}
+		return false
+	}
+	parts := strings.Split(pattern, "/")
+	if len(parts) > len(segments) {
+		return false
+	}
+	for i, part := range parts {
+		if ok, _ := path.Match(part, segments[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func validatePattern(pattern string) error {
+	if strings.Trim(pattern, "/") == "" {
+		return errors.New("pattern must not be empty")
+	}
+	for _, part := range strings.Split(strings.Trim(pattern, "/"), "/") {
+		if _, err := path.Match(part, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// SetKMSKeyRules selects the KMS key of each object written with a KMS mode
+// by the first matching rule, falling back to the key given to SetEncryption.
+func (t *Transport) SetKMSKeyRules(rules []KMSKeyRule) {
+	t.kmsKeyRules = rules
+}
+
+// KMSKeys returns the KMS keys objects written with a KMS mode may be
+// encrypted with: the key given to SetEncryption followed by those of the
+// rules, each once. The AWS managed key S3 falls back to is left out.
+func (t *Transport) KMSKeys() []string {
+	if !t.kmsEncrypted() {
+		return nil
+	}
+	var keys []string
+	seen := map[string]bool{"": true}
+	for _, key := range append([]string{t.sseKMSKeyID}, kmsRuleKeys(t.kmsKeyRules)...) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func kmsRuleKeys(rules []KMSKeyRule) []string {
+	keys := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		keys = append(keys, rule.KMSKeyID)
+	}
+	return keys
+}
+
+// Encrypted reports whether the transport requests server-side encryption.
+func (t *Transport) Encrypted() bool {
+	return t.sse != ""
+}
+
+// BucketEncryption returns the default server-side encryption configured on
+// the bucket, or an empty value when the bucket has none.
+func (t *Transport) BucketEncryption(ctx context.Context) (s3types.ServerSideEncryption, error) {
+	response, err := t.backend.BucketEncryption(ctx, &s3.GetBucketEncryptionInput{
+		Bucket: aws.String(t.bucket),
+	})
+	if err != nil {
+		if isEncryptionNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read default encryption of bucket %s: %w", t.bucket, err)
+	}
+
+	if response.ServerSideEncryptionConfiguration == nil {
+		return "", nil
+	}
+	for _, rule := range response.ServerSideEncryptionConfiguration.Rules {
+		if rule.ApplyServerSideEncryptionByDefault != nil && rule.ApplyServerSideEncryptionByDefault.SSEAlgorithm != "" {
+			return rule.ApplyServerSideEncryptionByDefault.SSEAlgorithm, nil
+		}
+	}
+	return "", nil
+}
+
+func (t *Transport) encryptPut(input *s3.PutObjectInput) {
+	input.ServerSideEncryption = t.sse
+	if t.kmsEncrypted() {
+		input.SSEKMSKeyId = stringPointer(t.kmsKeyFor(aws.ToString(input.Key)))
+	}
+	if t.bucketKeyEnabled() {
+		input.BucketKeyEnabled = aws.Bool(true)
+	}
+}
+
+func (t *Transport) encryptCopy(input *s3.CopyObjectInput) {
+	input.ServerSideEncryption = t.sse
+	if t.kmsEncrypted() {
+		input.SSEKMSKeyId = stringPointer(t.kmsKeyFor(aws.ToString(input.Key)))
+	}
+	if t.bucketKeyEnabled() {
+		input.BucketKeyEnabled = aws.Bool(true)
+	}
+}
+
+// bucketKeyEnabled reports whether writes request an S3 Bucket Key, which
+// only aws:kms supports.
+func (t *Transport) bucketKeyEnabled() bool {
+	return t.bucketKey && t.sse == s3types.ServerSideEncryptionAwsKms
+}
+
+// kmsKeyFor returns the KMS key id of the object at key.
+func (t *Transport) kmsKeyFor(key string) string {
+	for _, rule := range t.kmsKeyRules {
+		if rule.Matches(key) {
+			return rule.KMSKeyID
+		}
+	}
+	return t.sseKMSKeyID
+}
+
+func (t *Transport) kmsEncrypted() bool {
+	return t.sse == s3types.ServerSideEncryptionAwsKms || t.sse == s3types.ServerSideEncryptionAwsKmsDsse
+}
+
+func isEncryptionNotFound(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "ServerSideEncryptionConfigurationNotFoundError"
+}
@@ -0,0 +1,134 @@
+package uploader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestUploadRequestsEncryption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.tar")
+	if err := os.WriteFile(path, []byte("payload"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	stub := &stubUploader{}
+	transport := NewTransport(&fakeClient{}, stub, "bucket", true)
+	transport.SetEncryption(s3types.ServerSideEncryptionAwsKms, "alias/artifacts")
+
+	if _, err := transport.Upload(context.Background(), []FilePlan{{Source: path, Key: "app.tar", Size: 7}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	input := stub.uploads[0]
+	if input.ServerSideEncryption != s3types.ServerSideEncryptionAwsKms || aws.ToString(input.SSEKMSKeyId) != "alias/artifacts" {
+		t.Fatalf("expected KMS encryption with key, got %q %q", input.ServerSideEncryption, aws.ToString(input.SSEKMSKeyId))
+	}
+}
+
+func TestUploadRequestsBucketKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.tar")
+	if err := os.WriteFile(path, []byte("payload"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	for mode, want := range map[s3types.ServerSideEncryption]bool{
+		s3types.ServerSideEncryptionAwsKms:     true,
+		s3types.ServerSideEncryptionAwsKmsDsse: false,
+		s3types.ServerSideEncryptionAes256:     false,
+	} {
+		stub := &stubUploader{}
+		transport := NewTransport(&fakeClient{}, stub, "bucket", true,
+			WithEncryption(mode, "alias/artifacts"),
+			WithBucketKey(true),
+		)
+		if _, err := transport.Upload(context.Background(), []FilePlan{{Source: path, Key: "app.tar", Size: 7}}); err != nil {
+			t.Fatalf("%s: unexpected error: %v", mode, err)
+		}
+		if got := aws.ToBool(stub.uploads[0].BucketKeyEnabled); got != want {
+			t.Errorf("%s: expected BucketKeyEnabled %v, got %v", mode, want, got)
+		}
+	}
+}
+
+func TestBucketEncryption(t *testing.T) {
+	transport := NewTransport(&fakeClient{}, &stubUploader{}, "bucket", true)
+	if mode, err := transport.BucketEncryption(context.Background()); err != nil || mode != "" {
+		t.Fatalf("expected no default encryption, got %q (%v)", mode, err)
+	}
+
+	transport = NewTransport(&fakeClient{bucketEncryption: s3types.ServerSideEncryptionAes256}, &stubUploader{}, "bucket", true)
+	if mode, err := transport.BucketEncryption(context.Background()); err != nil || mode != s3types.ServerSideEncryptionAes256 {
+		t.Fatalf("expected AES256 default encryption, got %q (%v)", mode, err)
+	}
+}
+
+func TestKMSKeyRules(t *testing.T) {
+	dir := t.TempDir()
+	var plans []FilePlan
+	for _, key := range []string{"releases/public/app.js", "releases/restricted/db.dump", "releases/certs/server.pem"} {
+		path := filepath.Join(dir, filepath.Base(key))
+		if err := os.WriteFile(path, []byte("payload"), 0o644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		plans = append(plans, FilePlan{Source: path, Key: key, Size: 7})
+	}
+
+	stub := &stubUploader{}
+	transport := NewTransport(&fakeClient{}, stub, "bucket", true,
+		WithEncryption(s3types.ServerSideEncryptionAwsKms, "alias/artifacts"),
+		WithKMSKeyRules([]KMSKeyRule{
+			{Pattern: "releases/restricted/", KMSKeyID: "alias/restricted"},
+			{Pattern: "*.pem", KMSKeyID: "alias/secrets"},
+		}),
+	)
+	if _, err := transport.Upload(context.Background(), plans); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]string{
+		"releases/public/app.js":      "alias/artifacts",
+		"releases/restricted/db.dump": "alias/restricted",
+		"releases/certs/server.pem":   "alias/secrets",
+	}
+	for _, input := range stub.uploads {
+		if key := aws.ToString(input.Key); aws.ToString(input.SSEKMSKeyId) != want[key] {
+			t.Errorf("expected %s to use %s, got %s", key, want[key], aws.ToString(input.SSEKMSKeyId))
+		}
+	}
+
+	rule := KMSKeyRule{Pattern: "builds/*/restricted", KMSKeyID: "alias/restricted"}
+	if !rule.Matches("builds/api/restricted/db.dump") || rule.Matches("builds/api/public/restricted.txt") || rule.Matches("builds/restricted") {
+		t.Error("unexpected matches of an anchored pattern")
+	}
+	if ValidateKMSKeyPattern("releases/[a-") == nil || ValidateKMSKeyPattern("/") == nil {
+		t.Error("expected malformed and empty patterns to be rejected")
+	}
+}
+
+func TestKMSKeys(t *testing.T) {
+	transport := NewTransport(&fakeClient{}, &stubUploader{}, "bucket", true,
+		WithEncryption(s3types.ServerSideEncryptionAwsKms, "alias/artifacts"),
+		WithKMSKeyRules([]KMSKeyRule{
+			{Pattern: "restricted/", KMSKeyID: "alias/restricted"},
+			{Pattern: "*.pem", KMSKeyID: "alias/artifacts"},
+		}),
+	)
+	if keys := transport.KMSKeys(); !reflect.DeepEqual(keys, []string{"alias/artifacts", "alias/restricted"}) {
+		t.Errorf("unexpected keys %v", keys)
+	}
+
+	transport.SetEncryption(s3types.ServerSideEncryptionAwsKms, "")
+	if keys := transport.KMSKeys(); !reflect.DeepEqual(keys, []string{"alias/restricted", "alias/artifacts"}) {
+		t.Errorf("expected the AWS managed key to be left out, got %v", keys)
+	}
+	transport.SetEncryption(s3types.ServerSideEncryptionAes256, "")
+	if keys := transport.KMSKeys(); keys != nil {
+		t.Errorf("expected no keys without a KMS mode, got %v", keys)
+	}
+}
@@ -0,0 +1,70 @@
+package uploader
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/delivery-station/ds-s3/internal/envelope"
+)
+
+// Envelope encrypts object content on the client. Decrypt reverses Encrypt,
+// and Encrypted recognises the metadata Encrypt returns.
+type Envelope interface {
+	// Encrypt returns a reader producing the ciphertext of the size bytes
+	// read from plain, the length of that ciphertext and the metadata to
+	// store with the object.
+	Encrypt(ctx context.Context, plain io.Reader, size int64) (io.Reader, int64, map[string]string, error)
+	// Decrypt returns a reader producing the plaintext of ciphertext, stored
+	// with metadata.
+	Decrypt(ctx context.Context, ciphertext io.Reader, metadata map[string]string) (io.Reader, error)
+	// Encrypted reports whether an object stored with metadata was encrypted
+	// by Encrypt.
+	Encrypted(metadata map[string]string) bool
+}
+
+// SetEnvelope encrypts every uploaded object on the client with e before it
+// leaves the machine, and decrypts such objects on download. A nil envelope
+// disables client-side encryption.
+func (t *Transport) SetEnvelope(e Envelope) {
+	t.envelope = e
+}
+
+// seal encrypts an upload body when client-side encryption is enabled,
+// returning the body and metadata to send.
+func (t *Transport) seal(ctx context.Context, source string, body io.Reader, size int64, metadata map[string]string) (io.Reader, map[string]string, error) {
+	if t.envelope == nil {
+		return body, metadata, nil
+	}
+	sealed, _, extra, err := t.envelope.Encrypt(ctx, body, size)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encrypt %s: %w", source, err)
+	}
+	merged := make(map[string]string, len(metadata)+len(extra))
+	for key, value := range metadata {
+		merged[key] = value
+	}
+	for key, value := range extra {
+		merged[key] = value
+	}
+	return sealed, merged, nil
+}
+
+// open decrypts a downloaded body when its metadata marks it as encrypted on
+// the client.
+func (t *Transport) open(ctx context.Context, key string, body io.Reader, metadata map[string]string) (io.Reader, bool, error) {
+	if t.envelope == nil {
+		if envelope.IsEncrypted(metadata) {
+			return nil, false, fmt.Errorf("%s is encrypted on the client; configure client_encryption to download it", key)
+		}
+		return body, false, nil
+	}
+	if !t.envelope.Encrypted(metadata) {
+		return body, false, nil
+	}
+	opened, err := t.envelope.Decrypt(ctx, body, metadata)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decrypt %s: %w", key, err)
+	}
+	return opened, true, nil
+}
@@ -0,0 +1,138 @@
+package uploader
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/delivery-station/ds-s3/internal/envelope"
+)
+
+// storingUploader keeps what was uploaded so it can be downloaded again.
+type storingUploader struct {
+	mu     sync.Mutex
+	client *fakeClient
+}
+
+func (s *storingUploader) Upload(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*manager.Uploader)) (*manager.UploadOutput, error) {
+	data, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := aws.ToString(input.Key)
+	s.client.objects[key] = string(data)
+	s.client.objectMetadata[key] = input.Metadata
+	s.client.listOutputs[0].Contents = append(s.client.listOutputs[0].Contents, s3types.Object{Key: input.Key})
+	return &manager.UploadOutput{ETag: aws.String("etag")}, nil
+}
+
+func TestEnvelopeEncryptsUploadsAndDecryptsDownloads(t *testing.T) {
+	wrapper, err := envelope.NewAESWrapper([]byte(strings.Repeat("k", 32)))
+	if err != nil {
+		t.Fatalf("NewAESWrapper returned error: %v", err)
+	}
+	client := &fakeClient{
+		listOutputs:    []*s3.ListObjectsV2Output{{}},
+		objects:        map[string]string{},
+		objectMetadata: map[string]map[string]string{},
+	}
+	transport := NewTransport(client, &storingUploader{client: client}, "bucket", true)
+	transport.SetEnvelope(envelope.New(wrapper))
+
+	source := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(source, []byte("top secret artifact"), 0o644); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+	if _, err := transport.Upload(context.Background(), []FilePlan{{Source: source, Key: "vault/secret.txt", Size: 19}}); err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+	if stored := client.objects["vault/secret.txt"]; strings.Contains(stored, "top secret") {
+		t.Fatal("expected the stored object to be encrypted")
+	}
+	if client.objectMetadata["vault/secret.txt"][envelope.MetadataWrap] != envelope.WrapAESGCM {
+		t.Fatalf("expected envelope metadata, got %v", client.objectMetadata["vault/secret.txt"])
+	}
+
+	dir := t.TempDir()
+	results, err := transport.Download(context.Background(), "vault", dir)
+	if err != nil {
+		t.Fatalf("Download returned error: %v", err)
+	}
+	if len(results) != 1 || !results[0].Decrypted {
+		t.Fatalf("expected one decrypted download, got %+v", results)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "secret.txt"))
+	if err != nil || string(data) != "top secret artifact" {
+		t.Fatalf("unexpected downloaded content %q (%v)", data, err)
+	}
+
+	client.listCallIndex = 0
+	plain := NewTransport(client, &stubUploader{}, "bucket", true)
+	if _, err := plain.Download(context.Background(), "vault", t.TempDir()); err == nil {
+		t.Fatal("expected downloading an encrypted object without a key to fail")
+	}
+}
+
+// base64Envelope stands in for an Envelope implemented outside this module.
+type base64Envelope struct{}
+
+func (base64Envelope) Encrypt(ctx context.Context, plain io.Reader, size int64) (io.Reader, int64, map[string]string, error) {
+	data, err := io.ReadAll(plain)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+	return strings.NewReader(encoded), int64(len(encoded)), map[string]string{"test-envelope": "base64"}, nil
+}
+
+func (base64Envelope) Decrypt(ctx context.Context, ciphertext io.Reader, metadata map[string]string) (io.Reader, error) {
+	return base64.NewDecoder(base64.StdEncoding, ciphertext), nil
+}
+
+func (base64Envelope) Encrypted(metadata map[string]string) bool {
+	return metadata["test-envelope"] == "base64"
+}
+
+func TestEnvelopeAcceptsOtherImplementations(t *testing.T) {
+	client := &fakeClient{
+		listOutputs:    []*s3.ListObjectsV2Output{{}},
+		objects:        map[string]string{},
+		objectMetadata: map[string]map[string]string{},
+	}
+	transport := NewTransport(client, &storingUploader{client: client}, "bucket", true)
+	transport.SetEnvelope(base64Envelope{})
+
+	source := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(source, []byte("release notes"), 0o644); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+	if _, err := transport.Upload(context.Background(), []FilePlan{{Source: source, Key: "docs/notes.txt", Size: 13}}); err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+	if stored := client.objects["docs/notes.txt"]; stored != base64.StdEncoding.EncodeToString([]byte("release notes")) {
+		t.Fatalf("expected the envelope to encode the object, got %q", stored)
+	}
+
+	dir := t.TempDir()
+	results, err := transport.Download(context.Background(), "docs", dir)
+	if err != nil {
+		t.Fatalf("Download returned error: %v", err)
+	}
+	if len(results) != 1 || !results[0].Decrypted {
+		t.Fatalf("expected one decrypted download, got %+v", results)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "notes.txt")); err != nil || string(data) != "release notes" {
+		t.Fatalf("unexpected downloaded content %q (%v)", data, err)
+	}
+}
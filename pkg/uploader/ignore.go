@@ -0,0 +1,127 @@
+package uploader
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/delivery-station/ds-s3/internal/ignore"
+)
+
+// IgnoreFileNames are the ignore files read by default, in order of
+// precedence from lowest to highest.
+var IgnoreFileNames = []string{".dsignore", ".s3ignore"}
+
+// gitignoreFile is read in every directory when PlanPolicy.Gitignore is set.
+const gitignoreFile = ".gitignore"
+
+// ignoreScope evaluates the ignore rules of one source directory. Rules match
+// paths relative to the source directory or, when honouring .gitignore inside
+// a git repository, relative to the repository root.
+type ignoreScope struct {
+	policy  PlanPolicy
+	matcher *ignore.Matcher
+	// prefix is the source directory relative to the repository root, slash
+	// separated; empty when rules are relative to the source directory.
+	prefix string
+}
+
+// newIgnoreScope prepares the rules for walking root. With Gitignore set, the
+// repository's exclude file and the .gitignore files of the directories
+// between the repository root and root apply from the start. root itself is
+// always walked, even when git ignores it, as build outputs usually are.
+func (p PlanPolicy) newIgnoreScope(root string) (*ignoreScope, error) {
+	scope := &ignoreScope{policy: p, matcher: &ignore.Matcher{}}
+	if !p.Gitignore {
+		return scope, nil
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	repo := findRepository(abs)
+	if repo == "" {
+		return scope, nil
+	}
+	rel, err := filepath.Rel(repo, abs)
+	if err != nil {
+		return nil, err
+	}
+	if rel != "." {
+		scope.prefix = filepath.ToSlash(rel)
+	}
+
+	if info, err := os.Stat(filepath.Join(repo, ".git")); err == nil && info.IsDir() {
+		if err := scope.matcher.AddFile("", filepath.Join(repo, ".git", "info", "exclude")); err != nil {
+			return nil, err
+		}
+	}
+	if scope.prefix != "" {
+		parts := strings.Split(scope.prefix, "/")
+		for i := range parts {
+			base := strings.Join(parts[:i], "/")
+			if err := scope.matcher.AddFile(base, filepath.Join(repo, filepath.FromSlash(base), gitignoreFile)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return scope, nil
+}
+
+// enter returns the scope for dir, at rel below the source directory, adding
+// its ignore files to the rules of its parents.
+func (s *ignoreScope) enter(rel, dir string) (*ignoreScope, error) {
+	if !s.policy.Gitignore && len(s.policy.IgnoreFiles) == 0 {
+		return s, nil
+	}
+	child := &ignoreScope{policy: s.policy, matcher: s.matcher.Clone(), prefix: s.prefix}
+	base := s.path(rel)
+	if s.policy.Gitignore {
+		if err := child.matcher.AddFile(base, filepath.Join(dir, gitignoreFile)); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range s.policy.IgnoreFiles {
+		if err := child.matcher.AddFile(base, filepath.Join(dir, name)); err != nil {
+			return nil, err
+		}
+	}
+	return child, nil
+}
+
+// ignored reports whether the entry at rel below the source directory is
+// left out.
+func (s *ignoreScope) ignored(rel string, dir bool) bool {
+	if s.policy.Gitignore && path.Base(rel) == ".git" {
+		return true
+	}
+	return s.matcher.Ignored(s.path(rel), dir)
+}
+
+func (s *ignoreScope) path(rel string) string {
+	switch {
+	case s.prefix == "":
+		return rel
+	case rel == "." || rel == "":
+		return s.prefix
+	default:
+		return s.prefix + "/" + rel
+	}
+}
+
+// findRepository returns the root of the git repository containing the
+// absolute path dir, or an empty string when there is none.
+func findRepository(dir string) string {
+	current := dir
+	for {
+		if _, err := os.Lstat(filepath.Join(current, ".git")); err == nil {
+			return current
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return ""
+		}
+		current = parent
+	}
+}
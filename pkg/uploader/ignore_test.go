@@ -0,0 +1,56 @@
+package uploader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildPlansRespectsGitignoreChain(t *testing.T) {
+	repo := t.TempDir()
+	files := map[string]string{
+		".git/HEAD":                  "ref: refs/heads/main\n",
+		".git/info/exclude":          "*.swp\n",
+		".gitignore":                 "dist/\nnode_modules/\n",
+		"web/.gitignore":             "*.map\n",
+		"web/dist/app.js":            "app",
+		"web/dist/app.js.map":        "map",
+		"web/dist/.app.js.swp":       "swap",
+		"web/dist/node_modules/x.js": "dep",
+		"web/dist/lib/.git/HEAD":     "nested",
+		"web/dist/.gitignore":        "!keep.map\n",
+		"web/dist/keep.map":          "map",
+	}
+	for name, content := range files {
+		path := filepath.Join(repo, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+	source := filepath.Join(repo, "web", "dist")
+
+	plans, err := BuildPlans([]string{source}, "", PlanPolicy{Gitignore: true})
+	if err != nil {
+		t.Fatalf("BuildPlans returned error: %v", err)
+	}
+	var keys []string
+	for _, plan := range plans {
+		keys = append(keys, plan.Key)
+	}
+	want := ".gitignore,app.js,keep.map"
+	if strings.Join(keys, ",") != want {
+		t.Errorf("expected %s, got %v", want, keys)
+	}
+
+	plans, err = BuildPlans([]string{source}, "", PlanPolicy{})
+	if err != nil {
+		t.Fatalf("BuildPlans returned error: %v", err)
+	}
+	if len(plans) != 7 {
+		t.Errorf("expected .gitignore to be disabled by default, got %d plans", len(plans))
+	}
+}
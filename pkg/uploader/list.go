@@ -0,0 +1,83 @@
+package uploader
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ObjectEntry describes a single object returned by List.
+type ObjectEntry struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag,omitempty"`
+	StorageClass string    `json:"storage_class,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// Listing is the result of List: the objects found and, when a delimiter was
+// given, the common prefixes grouping the keys below them.
+type Listing struct {
+	Objects  []ObjectEntry `json:"objects"`
+	Prefixes []string      `json:"prefixes,omitempty"`
+}
+
+// List returns the objects under the prefix sorted by key. With a delimiter,
+// keys containing it after the prefix are rolled up into common prefixes
+// instead, so only one level of the hierarchy is listed, like a directory.
+// Objects not matching the selector are left out; prefixes are not.
+func (t *Transport) List(ctx context.Context, prefix, delimiter string) (Listing, error) {
+	resolved := normalizePrefix(prefix)
+	if resolved != "" {
+		resolved += "/"
+	}
+
+	listing := Listing{Objects: make([]ObjectEntry, 0)}
+	var token *string
+
+	for {
+		response, err := t.backend.List(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(t.bucket),
+			Prefix:            stringPointer(resolved),
+			Delimiter:         stringPointer(delimiter),
+			ContinuationToken: token,
+		})
+		if err != nil {
+			return Listing{}, fmt.Errorf("failed to list objects under %q: %w", resolved, err)
+		}
+
+		for _, obj := range response.Contents {
+			matched, err := t.selected(ctx, aws.ToString(obj.Key))
+			if err != nil {
+				return Listing{}, err
+			}
+			if !matched {
+				continue
+			}
+			listing.Objects = append(listing.Objects, ObjectEntry{
+				Key:          aws.ToString(obj.Key),
+				Size:         aws.ToInt64(obj.Size),
+				ETag:         aws.ToString(obj.ETag),
+				StorageClass: string(obj.StorageClass),
+				LastModified: aws.ToTime(obj.LastModified),
+			})
+		}
+		for _, common := range response.CommonPrefixes {
+			listing.Prefixes = append(listing.Prefixes, aws.ToString(common.Prefix))
+		}
+
+		if response.NextContinuationToken == nil {
+			break
+		}
+		token = response.NextContinuationToken
+	}
+
+	// Directory buckets list keys in no particular order.
+	sort.Slice(listing.Objects, func(i, j int) bool { return listing.Objects[i].Key < listing.Objects[j].Key })
+	sort.Strings(listing.Prefixes)
+	return listing, nil
+}
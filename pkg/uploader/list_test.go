@@ -0,0 +1,63 @@
+package uploader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestListRollsUpCommonPrefixes(t *testing.T) {
+	client := &fakeClient{
+		listOutputs: []*s3.ListObjectsV2Output{
+			{
+				Contents:              []s3types.Object{{Key: aws.String("releases/index.json"), Size: aws.Int64(2)}},
+				CommonPrefixes:        []s3types.CommonPrefix{{Prefix: aws.String("releases/v2/")}},
+				NextContinuationToken: aws.String("next"),
+			},
+			{
+				CommonPrefixes: []s3types.CommonPrefix{{Prefix: aws.String("releases/v1/")}},
+			},
+		},
+	}
+	transport := NewTransport(client, &stubUploader{}, "bucket", true)
+
+	listing, err := transport.List(context.Background(), "releases", "/")
+	if err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+
+	if len(client.listInputs) != 2 {
+		t.Fatalf("expected 2 list calls, got %d", len(client.listInputs))
+	}
+	if aws.ToString(client.listInputs[0].Delimiter) != "/" || aws.ToString(client.listInputs[0].Prefix) != "releases/" {
+		t.Errorf("unexpected list input prefix %q delimiter %q", aws.ToString(client.listInputs[0].Prefix), aws.ToString(client.listInputs[0].Delimiter))
+	}
+	if aws.ToString(client.listInputs[1].ContinuationToken) != "next" {
+		t.Errorf("expected continuation token on second call")
+	}
+	if len(listing.Objects) != 1 || listing.Objects[0].Key != "releases/index.json" {
+		t.Errorf("unexpected objects %+v", listing.Objects)
+	}
+	if len(listing.Prefixes) != 2 || listing.Prefixes[0] != "releases/v1/" || listing.Prefixes[1] != "releases/v2/" {
+		t.Errorf("unexpected prefixes %v", listing.Prefixes)
+	}
+}
+
+func TestListWithoutDelimiterListsRecursively(t *testing.T) {
+	client := &fakeClient{}
+	transport := NewTransport(client, &stubUploader{}, "bucket", true)
+
+	listing, err := transport.List(context.Background(), "", "")
+	if err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+	if client.listInputs[0].Delimiter != nil || client.listInputs[0].Prefix != nil {
+		t.Errorf("expected no prefix or delimiter, got %+v", client.listInputs[0])
+	}
+	if listing.Objects == nil {
+		t.Error("expected an empty, non-nil object list")
+	}
+}
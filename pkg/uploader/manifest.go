@@ -0,0 +1,181 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ManifestChange describes a key whose object differs between two manifests.
+type ManifestChange struct {
+	Key      string       `json:"key"`
+	Previous UploadResult `json:"previous"`
+	Current  UploadResult `json:"current"`
+}
+
+// ManifestDiff lists the keys added, removed and changed between two runs,
+// each sorted by key.
+type ManifestDiff struct {
+	Added     []UploadResult   `json:"added"`
+	Removed   []UploadResult   `json:"removed"`
+	Changed   []ManifestChange `json:"changed"`
+	Unchanged int              `json:"unchanged"`
+}
+
+// Empty reports whether the manifests describe the same artifact set.
+func (d ManifestDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffOption adjusts how DiffManifests compares objects.
+type DiffOption func(*diffOptions)
+
+type diffOptions struct {
+	ignoreETags bool
+}
+
+// IgnoreETags compares objects without a digest by size alone, for manifests
+// of a backend with weak ETags (see WeakETagBackend).
+func IgnoreETags() DiffOption {
+	return func(o *diffOptions) { o.ignoreETags = true }
+}
+
+// DiffManifests compares the objects uploaded by two runs.
+func DiffManifests(previous, current []UploadResult, opts ...DiffOption) ManifestDiff {
+	var options diffOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	before := make(map[string]UploadResult, len(previous))
+	for _, obj := range previous {
+		before[obj.Key] = obj
+	}
+
+	diff := ManifestDiff{
+		Added:   make([]UploadResult, 0),
+		Removed: make([]UploadResult, 0),
+		Changed: make([]ManifestChange, 0),
+	}
+	seen := make(map[string]bool, len(current))
+	for _, obj := range current {
+		seen[obj.Key] = true
+		old, ok := before[obj.Key]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, obj)
+		case contentChanged(old, obj, options.ignoreETags):
+			diff.Changed = append(diff.Changed, ManifestChange{Key: obj.Key, Previous: old, Current: obj})
+		default:
+			diff.Unchanged++
+		}
+	}
+	for _, obj := range previous {
+		if !seen[obj.Key] {
+			diff.Removed = append(diff.Removed, obj)
+		}
+	}
+
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].Key < diff.Added[j].Key })
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].Key < diff.Removed[j].Key })
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Key < diff.Changed[j].Key })
+	return diff
+}
+
+// contentChanged compares two uploads of the same key by the strongest
+// evidence both carry: the SHA-256 metadata, an S3 checksum of the same
+// algorithm and type, or else size and ETag. Multipart ETags also change when
+// only the part size does, so the ETag is the last resort, and skipped with
+// ignoreETags.
+func contentChanged(a, b UploadResult, ignoreETags bool) bool {
+	if a.Size != b.Size {
+		return true
+	}
+	if a.SHA256 != "" && b.SHA256 != "" {
+		return a.SHA256 != b.SHA256
+	}
+	if a.Checksum != "" && a.ChecksumAlgorithm == b.ChecksumAlgorithm && a.ChecksumType == b.ChecksumType {
+		return a.Checksum != b.Checksum
+	}
+	return !ignoreETags && a.ETag != b.ETag
+}
+
+// ReadObject returns the content of the object at key, or nil when it does
+// not exist.
+func (t *Transport) ReadObject(ctx context.Context, key string) ([]byte, error) {
+	data, _, err := t.ReadObjectETag(ctx, key)
+	return data, err
+}
+
+// ReadObjectETag returns the content of the object at key and its ETag, for
+// a later WriteObjectIf, or nil and an empty ETag when it does not exist.
+func (t *Transport) ReadObjectETag(ctx context.Context, key string) ([]byte, string, error) {
+	response, err := t.backend.Get(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(t.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, "", nil
+		}
+		return nil, "", fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return data, aws.ToString(response.ETag), nil
+}
+
+// WriteObject stores data at key, replacing any existing object regardless of
+// the overwrite setting.
+func (t *Transport) WriteObject(ctx context.Context, key string, data []byte, contentType string) error {
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(t.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: stringPointer(contentType),
+	}
+	t.encryptPut(input)
+	if _, err := t.backend.Put(ctx, input, t.applyChecksum(input)...); err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	return nil
+}
+
+// WriteObjectIf stores data at key like WriteObject, but only while the
+// object still has the ETag read with ReadObjectETag, or, for an empty etag,
+// while there is no object at key. A write losing to a concurrent one fails
+// with ErrConditionFailed, and the caller reads the object again.
+func (t *Transport) WriteObjectIf(ctx context.Context, key string, data []byte, contentType, etag string) error {
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(t.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: stringPointer(contentType),
+	}
+	if etag != "" {
+		input.IfMatch = aws.String(quoteETag(etag))
+	} else {
+		input.IfNoneMatch = aws.String("*")
+	}
+	t.encryptPut(input)
+	opts := append(t.applyChecksum(input), withConditions(input.IfMatch, input.IfNoneMatch))
+	if _, err := t.backend.Put(ctx, input, opts...); err != nil {
+		// S3 answers If-Match for a deleted object with 404.
+		if isPreconditionFailed(err) || (etag != "" && isNotFound(err)) {
+			return fmt.Errorf("failed to write %s: %w: %w", key, ErrConditionFailed, err)
+		}
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package uploader
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDiffManifests(t *testing.T) {
+	previous := []UploadResult{
+		{Key: "app/a.bin", Size: 3, ETag: "a1"},
+		{Key: "app/b.bin", Size: 3, ETag: "b1-2", SHA256: "bb"},
+		{Key: "app/c.bin", Size: 3, ETag: "c1", Checksum: "c==", ChecksumAlgorithm: "CRC32", ChecksumType: "FULL_OBJECT"},
+		{Key: "app/old.bin", Size: 1},
+	}
+	current := []UploadResult{
+		{Key: "app/new.bin", Size: 1},
+		{Key: "app/c.bin", Size: 3, ETag: "c2", Checksum: "c==", ChecksumAlgorithm: "CRC32", ChecksumType: "FULL_OBJECT"},
+		{Key: "app/b.bin", Size: 3, ETag: "b2-3", SHA256: "bb"},
+		{Key: "app/a.bin", Size: 3, ETag: "a2"},
+	}
+
+	diff := DiffManifests(previous, current)
+
+	if len(diff.Added) != 1 || diff.Added[0].Key != "app/new.bin" {
+		t.Errorf("unexpected added %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Key != "app/old.bin" {
+		t.Errorf("unexpected removed %+v", diff.Removed)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].Key != "app/a.bin" || diff.Changed[0].Previous.ETag != "a1" {
+		t.Errorf("expected only a.bin to change, got %+v", diff.Changed)
+	}
+	if diff.Unchanged != 2 {
+		t.Errorf("expected multipart re-uploads with equal checksums to be unchanged, got %d", diff.Unchanged)
+	}
+	if diff.Empty() {
+		t.Error("expected a non-empty diff")
+	}
+	if !DiffManifests(current, current).Empty() {
+		t.Error("expected identical manifests to produce an empty diff")
+	}
+	if weak := DiffManifests(previous, current, IgnoreETags()); len(weak.Changed) != 0 || weak.Unchanged != 3 {
+		t.Errorf("expected equal sizes to be unchanged without ETags, got %+v", weak.Changed)
+	}
+}
+
+func TestReadObjectReportsMissingAsNil(t *testing.T) {
+	client := &fakeClient{objects: map[string]string{"app/manifest.json": "{}"}}
+	transport := NewTransport(client, &stubUploader{}, "bucket", true)
+
+	data, err := transport.ReadObject(context.Background(), "app/manifest.json")
+	if err != nil || string(data) != "{}" {
+		t.Fatalf("unexpected manifest %q (%v)", data, err)
+	}
+	data, err = transport.ReadObject(context.Background(), "app/missing.json")
+	if err != nil || data != nil {
+		t.Fatalf("expected nil for a missing object, got %q (%v)", data, err)
+	}
+}
@@ -0,0 +1,111 @@
+package uploader
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+)
+
+// MemoryBudget caps the bytes that concurrent uploads may hold in part buffers.
+// A single budget is shared by every Transport in a run so that replicas and
+// streamed transfers cannot multiply the memory footprint. File parts are
+// buffered through a BufferPool drawing from it; streams, which the upload
+// manager buffers itself, reserve their share up front. A nil budget is
+// unlimited.
+type MemoryBudget struct {
+	mu     sync.Mutex
+	limit  int64
+	used   int64
+	notify chan struct{}
+}
+
+// NewMemoryBudget returns a budget of limit bytes, or nil when limit is not positive.
+func NewMemoryBudget(limit int64) *MemoryBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &MemoryBudget{limit: limit, notify: make(chan struct{})}
+}
+
+// Acquire blocks until n bytes are available or the context is cancelled.
+// Requests larger than the whole budget are clamped to it.
+func (b *MemoryBudget) Acquire(ctx context.Context, n int64) (int64, error) {
+	if b == nil {
+		return 0, nil
+	}
+	if n > b.limit {
+		n = b.limit
+	}
+
+	for {
+		b.mu.Lock()
+		if b.used+n <= b.limit {
+			b.used += n
+			b.mu.Unlock()
+			return n, nil
+		}
+		wait := b.notify
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-wait:
+		}
+	}
+}
+
+// Release returns n bytes previously obtained from Acquire.
+func (b *MemoryBudget) Release(n int64) {
+	if b == nil || n == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	b.used -= n
+	close(b.notify)
+	b.notify = make(chan struct{})
+	b.mu.Unlock()
+}
+
+// BufferPool is the manager.Uploader BufferProvider of a Transport: it reads
+// every part of a file into a pooled buffer of the part size, whose bytes are
+// drawn from a MemoryBudget until the part is sent. The upload manager asks
+// for a buffer without a context, so GetWriteTo waits for a free share of the
+// budget for as long as it takes; parts already sent always return theirs.
+type BufferPool struct {
+	budget *MemoryBudget
+	size   int64
+	pool   sync.Pool
+}
+
+// NewBufferPool returns a pool of part buffers of size bytes drawing from
+// budget, or nil when budget is nil, which leaves the manager unbuffered.
+func NewBufferPool(budget *MemoryBudget, size int64) *BufferPool {
+	if budget == nil || size <= 0 {
+		return nil
+	}
+	if size > budget.limit {
+		size = budget.limit
+	}
+	p := &BufferPool{budget: budget, size: size}
+	p.pool.New = func() interface{} {
+		buffer := make([]byte, size)
+		return &buffer
+	}
+	return p
+}
+
+// GetWriteTo wraps part in a buffer of the pool; cleanup returns the buffer
+// and its share of the budget.
+func (p *BufferPool) GetWriteTo(part io.ReadSeeker) (manager.ReadSeekerWriteTo, func()) {
+	acquired, _ := p.budget.Acquire(context.Background(), p.size)
+	buffer := p.pool.Get().(*[]byte)
+	reader := &manager.BufferedReadSeekerWriteTo{BufferedReadSeeker: manager.NewBufferedReadSeeker(part, *buffer)}
+	return reader, func() {
+		p.pool.Put(buffer)
+		p.budget.Release(acquired)
+	}
+}
@@ -0,0 +1,103 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryBudgetBlocksUntilReleased(t *testing.T) {
+	budget := NewMemoryBudget(10)
+
+	first, err := budget.Acquire(context.Background(), 8)
+	if err != nil {
+		t.Fatalf("Acquire returned error: %v", err)
+	}
+
+	acquired := make(chan int64)
+	go func() {
+		n, err := budget.Acquire(context.Background(), 5)
+		if err != nil {
+			t.Errorf("Acquire returned error: %v", err)
+		}
+		acquired <- n
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("expected second acquire to block while budget is exhausted")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	budget.Release(first)
+
+	select {
+	case n := <-acquired:
+		if n != 5 {
+			t.Fatalf("expected 5 bytes acquired, got %d", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected second acquire to proceed after release")
+	}
+}
+
+func TestMemoryBudgetClampsAndHonoursContext(t *testing.T) {
+	budget := NewMemoryBudget(4)
+
+	n, err := budget.Acquire(context.Background(), 100)
+	if err != nil || n != 4 {
+		t.Fatalf("expected oversized request to be clamped to 4, got %d (%v)", n, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := budget.Acquire(ctx, 1); err == nil {
+		t.Fatal("expected cancelled context to abort acquire")
+	}
+
+	var unlimited *MemoryBudget
+	if n, err := unlimited.Acquire(context.Background(), 1<<40); err != nil || n != 0 {
+		t.Fatalf("expected nil budget to be unlimited, got %d (%v)", n, err)
+	}
+}
+
+func TestBufferPoolDrawsPartsFromTheBudget(t *testing.T) {
+	if pool := NewBufferPool(nil, 8); pool != nil {
+		t.Fatal("expected no pool without a budget")
+	}
+
+	budget := NewMemoryBudget(16)
+	pool := NewBufferPool(budget, 8)
+	first, releaseFirst := pool.GetWriteTo(strings.NewReader("first part"))
+	_, releaseSecond := pool.GetWriteTo(strings.NewReader("second part"))
+
+	var body bytes.Buffer
+	if _, err := first.WriteTo(&body); err != nil || body.String() != "first part" {
+		t.Fatalf("expected the part to be read through the buffer, got %q (%v)", body.String(), err)
+	}
+
+	got := make(chan struct{})
+	go func() {
+		_, release := pool.GetWriteTo(strings.NewReader("third part"))
+		release()
+		close(got)
+	}()
+	select {
+	case <-got:
+		t.Fatal("expected a third buffer to wait while two exhaust the budget")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	releaseFirst()
+	select {
+	case <-got:
+	case <-time.After(time.Second):
+		t.Fatal("expected the third buffer once a part was sent")
+	}
+	releaseSecond()
+	if n, err := budget.Acquire(context.Background(), 16); err != nil || n != 16 {
+		t.Errorf("expected every buffer to return its share, got %d (%v)", n, err)
+	}
+}
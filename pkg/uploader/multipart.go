@@ -0,0 +1,151 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// abortTimeout bounds aborting a multipart upload whose context was canceled.
+const abortTimeout = 10 * time.Second
+
+// abortDetached makes the upload manager abort multipart uploads even when
+// they failed because their context was canceled, such as on shutdown. The
+// manager aborts with the context of the upload, which would leave the parts
+// behind in the bucket.
+type abortDetached struct {
+	manager.UploadAPIClient
+}
+
+// AbortDetached wraps client for the upload manager so that canceled multipart
+// uploads are still aborted.
+func AbortDetached(client manager.UploadAPIClient) manager.UploadAPIClient {
+	return abortDetached{UploadAPIClient: client}
+}
+
+func (c abortDetached) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.WithoutCancel(ctx), abortTimeout)
+		defer cancel()
+	}
+	return c.UploadAPIClient.AbortMultipartUpload(ctx, params, optFns...)
+}
+
+// MultipartUpload describes an incomplete multipart upload.
+type MultipartUpload struct {
+	Key          string    `json:"key"`
+	UploadID     string    `json:"upload_id"`
+	Initiated    time.Time `json:"initiated"`
+	StorageClass string    `json:"storage_class,omitempty"`
+	// Parts and Size cover the parts uploaded so far; they are only filled
+	// in when parts are requested.
+	Parts int   `json:"parts"`
+	Size  int64 `json:"size"`
+}
+
+// ListMultipartUploads returns the incomplete multipart uploads under the
+// prefix, oldest first. With parts set, every upload's parts are listed to
+// report how far it got.
+func (t *Transport) ListMultipartUploads(ctx context.Context, prefix string, parts bool) ([]MultipartUpload, error) {
+	resolved := normalizePrefix(prefix)
+	if resolved != "" {
+		resolved += "/"
+	}
+
+	uploads := make([]MultipartUpload, 0)
+	var keyMarker, uploadIDMarker *string
+
+	for {
+		response, err := t.backend.ListUploads(ctx, &s3.ListMultipartUploadsInput{
+			Bucket:         aws.String(t.bucket),
+			Prefix:         stringPointer(resolved),
+			KeyMarker:      keyMarker,
+			UploadIdMarker: uploadIDMarker,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list multipart uploads: %w", err)
+		}
+
+		for _, u := range response.Uploads {
+			uploads = append(uploads, MultipartUpload{
+				Key:          aws.ToString(u.Key),
+				UploadID:     aws.ToString(u.UploadId),
+				Initiated:    aws.ToTime(u.Initiated),
+				StorageClass: string(u.StorageClass),
+			})
+		}
+
+		if !aws.ToBool(response.IsTruncated) {
+			break
+		}
+		keyMarker = response.NextKeyMarker
+		uploadIDMarker = response.NextUploadIdMarker
+	}
+
+	if parts {
+		for i := range uploads {
+			count, size, err := t.uploadedParts(ctx, uploads[i].Key, uploads[i].UploadID)
+			if err != nil {
+				return nil, err
+			}
+			uploads[i].Parts = count
+			uploads[i].Size = size
+		}
+	}
+
+	sort.SliceStable(uploads, func(i, j int) bool {
+		return uploads[i].Initiated.Before(uploads[j].Initiated)
+	})
+	return uploads, nil
+}
+
+// uploadedParts counts the parts of a multipart upload and their total size.
+func (t *Transport) uploadedParts(ctx context.Context, key, uploadID string) (int, int64, error) {
+	count := 0
+	var size int64
+	var marker *string
+
+	for {
+		response, err := t.backend.ListParts(ctx, &s3.ListPartsInput{
+			Bucket:           aws.String(t.bucket),
+			Key:              aws.String(key),
+			UploadId:         aws.String(uploadID),
+			PartNumberMarker: marker,
+		})
+		if err != nil {
+			if isNoSuchUpload(err) {
+				// Completed or aborted since it was listed.
+				return count, size, nil
+			}
+			return 0, 0, fmt.Errorf("failed to list parts of %s (upload %s): %w", key, uploadID, err)
+		}
+
+		for _, part := range response.Parts {
+			count++
+			size += aws.ToInt64(part.Size)
+		}
+
+		if !aws.ToBool(response.IsTruncated) {
+			return count, size, nil
+		}
+		marker = response.NextPartNumberMarker
+	}
+}
+
+func isNoSuchUpload(err error) bool {
+	var nu *s3types.NoSuchUpload
+	if errors.As(err, &nu) {
+		return true
+	}
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchUpload"
+}
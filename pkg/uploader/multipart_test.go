@@ -0,0 +1,86 @@
+package uploader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestListMultipartUploadsCountsParts(t *testing.T) {
+	now := time.Now()
+	client := &fakeClient{
+		multipartOutputs: []*s3.ListMultipartUploadsOutput{
+			{
+				Uploads: []s3types.MultipartUpload{
+					{Key: aws.String("app/big.iso"), UploadId: aws.String("u2"), Initiated: aws.Time(now)},
+				},
+				IsTruncated:        aws.Bool(true),
+				NextKeyMarker:      aws.String("app/big.iso"),
+				NextUploadIdMarker: aws.String("u2"),
+			},
+			{
+				Uploads: []s3types.MultipartUpload{
+					{Key: aws.String("app/old.tar"), UploadId: aws.String("u1"), Initiated: aws.Time(now.Add(-time.Hour))},
+					{Key: aws.String("app/gone.tar"), UploadId: aws.String("u3"), Initiated: aws.Time(now.Add(time.Minute))},
+				},
+			},
+		},
+		parts: map[string][]*s3.ListPartsOutput{
+			"u1": {
+				{
+					Parts:                []s3types.Part{{Size: aws.Int64(5 << 20)}, {Size: aws.Int64(5 << 20)}},
+					IsTruncated:          aws.Bool(true),
+					NextPartNumberMarker: aws.String("1"),
+				},
+				{Parts: []s3types.Part{{Size: aws.Int64(1024)}}},
+			},
+			"u2": {{}},
+		},
+	}
+	transport := NewTransport(client, &stubUploader{}, "bucket", true)
+
+	uploads, err := transport.ListMultipartUploads(context.Background(), "app", true)
+	if err != nil {
+		t.Fatalf("ListMultipartUploads returned error: %v", err)
+	}
+	if len(uploads) != 3 {
+		t.Fatalf("expected 3 uploads, got %d", len(uploads))
+	}
+	if uploads[0].UploadID != "u1" || uploads[0].Parts != 3 || uploads[0].Size != 10<<20+1024 {
+		t.Errorf("expected oldest upload with its parts first, got %+v", uploads[0])
+	}
+	if uploads[1].UploadID != "u2" || uploads[1].Parts != 0 {
+		t.Errorf("unexpected second upload: %+v", uploads[1])
+	}
+	if uploads[2].UploadID != "u3" || uploads[2].Parts != 0 {
+		t.Errorf("expected upload finished since listing to report no parts, got %+v", uploads[2])
+	}
+}
+
+type abortRecorder struct {
+	manager.UploadAPIClient
+	ctxErr error
+}
+
+func (a *abortRecorder) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	a.ctxErr = ctx.Err()
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func TestAbortDetachedAbortsCanceledUploads(t *testing.T) {
+	recorder := &abortRecorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := AbortDetached(recorder).AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{UploadId: aws.String("u1")}); err != nil {
+		t.Fatalf("AbortMultipartUpload returned error: %v", err)
+	}
+	if recorder.ctxErr != nil {
+		t.Errorf("expected the abort to run with a live context, got %v", recorder.ctxErr)
+	}
+}
@@ -0,0 +1,114 @@
+package uploader
+
+import (
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Option configures a Transport built by NewTransport. Each option has a
+// setter counterpart on Transport for settings that change after creation.
+type Option func(*Transport)
+
+// WithMemoryBudget is the option form of SetMemoryBudget.
+func WithMemoryBudget(budget *MemoryBudget, reservation int64) Option {
+	return func(t *Transport) { t.SetMemoryBudget(budget, reservation) }
+}
+
+// WithBackend is the option form of SetBackend.
+func WithBackend(backend Backend) Option {
+	return func(t *Transport) { t.SetBackend(backend) }
+}
+
+// WithConcurrency is the option form of SetConcurrency.
+func WithConcurrency(n int) Option {
+	return func(t *Transport) { t.SetConcurrency(n) }
+}
+
+// WithObjectAnnotations is the option form of SetObjectAnnotations.
+func WithObjectAnnotations(metadata, tags map[string]string) Option {
+	return func(t *Transport) { t.SetObjectAnnotations(metadata, tags) }
+}
+
+// WithCleanupTags is the option form of SetCleanupTags.
+func WithCleanupTags(tags map[string]string) Option {
+	return func(t *Transport) { t.SetCleanupTags(tags) }
+}
+
+// WithSelector is the option form of SetSelector.
+func WithSelector(selector Selector) Option {
+	return func(t *Transport) { t.SetSelector(selector) }
+}
+
+// WithACL is the option form of SetACL.
+func WithACL(acl s3types.ObjectCannedACL) Option {
+	return func(t *Transport) { t.SetACL(acl) }
+}
+
+// WithDryRun is the option form of SetDryRun.
+func WithDryRun(enabled bool) Option {
+	return func(t *Transport) { t.SetDryRun(enabled) }
+}
+
+// WithAllowedPrefixes is the option form of SetAllowedPrefixes.
+func WithAllowedPrefixes(prefixes []string) Option {
+	return func(t *Transport) { t.SetAllowedPrefixes(prefixes) }
+}
+
+// WithThrottle is the option form of SetThrottle.
+func WithThrottle(throttle *Throttle) Option {
+	return func(t *Transport) { t.SetThrottle(throttle) }
+}
+
+// WithChecksumType is the option form of SetChecksumType.
+func WithChecksumType(checksumType s3types.ChecksumType) Option {
+	return func(t *Transport) { t.SetChecksumType(checksumType) }
+}
+
+// WithChecksumAlgorithm is the option form of SetChecksumAlgorithm.
+func WithChecksumAlgorithm(algorithm s3types.ChecksumAlgorithm) Option {
+	return func(t *Transport) { t.SetChecksumAlgorithm(algorithm) }
+}
+
+// WithChecksumMetadata is the option form of SetChecksumMetadata.
+func WithChecksumMetadata(enabled bool) Option {
+	return func(t *Transport) { t.SetChecksumMetadata(enabled) }
+}
+
+// WithEncryption is the option form of SetEncryption.
+func WithEncryption(mode s3types.ServerSideEncryption, kmsKeyID string) Option {
+	return func(t *Transport) { t.SetEncryption(mode, kmsKeyID) }
+}
+
+// WithBucketKey is the option form of SetBucketKey.
+func WithBucketKey(enabled bool) Option {
+	return func(t *Transport) { t.SetBucketKey(enabled) }
+}
+
+// WithKMSKeyRules is the option form of SetKMSKeyRules.
+func WithKMSKeyRules(rules []KMSKeyRule) Option {
+	return func(t *Transport) { t.SetKMSKeyRules(rules) }
+}
+
+// WithIfMatch is the option form of SetIfMatch.
+func WithIfMatch(etag string) Option {
+	return func(t *Transport) { t.SetIfMatch(etag) }
+}
+
+// WithRunID is the option form of SetRunID.
+func WithRunID(id string) Option {
+	return func(t *Transport) { t.SetRunID(id) }
+}
+
+// WithExtractTar is the option form of SetExtractTar.
+func WithExtractTar(enabled bool) Option {
+	return func(t *Transport) { t.SetExtractTar(enabled) }
+}
+
+// WithTarPolicy is the option form of SetTarPolicy.
+func WithTarPolicy(policy PlanPolicy) Option {
+	return func(t *Transport) { t.SetTarPolicy(policy) }
+}
+
+// WithDecompress is the option form of SetDecompress.
+func WithDecompress(enabled bool) Option {
+	return func(t *Transport) { t.SetDecompress(enabled) }
+}
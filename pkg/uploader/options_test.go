@@ -0,0 +1,26 @@
+package uploader
+
+import (
+	"testing"
+
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestNewTransportAppliesOptions(t *testing.T) {
+	transport := NewTransport(&fakeClient{}, &stubUploader{}, "bucket", true,
+		WithConcurrency(4),
+		WithChecksumAlgorithm(s3types.ChecksumAlgorithmCrc64nvme),
+		WithEncryption(s3types.ServerSideEncryptionAwsKms, "alias/artifacts"),
+		WithRunID("run-7"),
+		WithObjectAnnotations(nil, map[string]string{"team": "web"}),
+	)
+	if transport.concurrency != 4 || transport.checksumAlgorithm != s3types.ChecksumAlgorithmCrc64nvme {
+		t.Errorf("unexpected transfer settings %d, %q", transport.concurrency, transport.checksumAlgorithm)
+	}
+	if transport.sse != s3types.ServerSideEncryptionAwsKms || transport.sseKMSKeyID != "alias/artifacts" {
+		t.Errorf("unexpected encryption %q, %q", transport.sse, transport.sseKMSKeyID)
+	}
+	if transport.runID != "run-7" || transport.tagging != "team=web" {
+		t.Errorf("unexpected annotations %q, %q", transport.runID, transport.tagging)
+	}
+}
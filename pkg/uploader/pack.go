@@ -0,0 +1,440 @@
+package uploader
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// PackDir is the directory below the context path that packs and their index
+// are stored in.
+const PackDir = ".packs"
+
+// PackIndexName is the name of the index object in PackDir.
+const PackIndexName = "index.json"
+
+// packSuffix names pack objects. Packs are tar archives, but deliberately do
+// not end in .tar so that extract_tar leaves them alone.
+const packSuffix = ".pack"
+
+// tarBlock is the size of tar headers and the unit entries are padded to.
+const tarBlock = 512
+
+// PackPolicy selects the files Pack bundles and how large packs grow.
+type PackPolicy struct {
+	// MaxFileSize is the size up to which files are packed.
+	MaxFileSize int64
+	// ChunkSize is the size a pack is closed at; a file that would take a
+	// pack past it starts the next one.
+	ChunkSize int64
+	// Name prefixes the pack names, which are numbered from 1, e.g. the run id.
+	Name string
+	// ExtractTar leaves tar archives unpacked, as they are uploaded entry
+	// by entry; see Transport.SetExtractTar.
+	ExtractTar bool
+	// Previous is the index an earlier upload to the context path left, see
+	// Transport.ReadPackIndex. Its entries are kept in the new index unless
+	// their key is planned again or their pack is written anew, so files
+	// only earlier runs packed can still be downloaded.
+	Previous *PackIndex
+}
+
+// PackIndex lists the files bundled into packs, each with the pack it is in
+// and where its content starts, so a single file can be fetched with a range
+// request.
+type PackIndex struct {
+	Version int         `json:"version"`
+	Packs   []string    `json:"packs"`
+	Entries []PackEntry `json:"entries"`
+}
+
+// PackEntry locates a packed file. Key is the key the file would have been
+// uploaded to; Offset is where its content starts in the pack.
+type PackEntry struct {
+	Key    string `json:"key"`
+	Pack   string `json:"pack"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+}
+
+// packIndexVersion is the version of the index Pack writes.
+const packIndexVersion = 1
+
+// Pack bundles the planned files of up to policy.MaxFileSize bytes into tar
+// archives of about policy.ChunkSize bytes written to dir, and returns the
+// plans left as they are followed by plans uploading the packs and their
+// index to PackDir below contextPath. Files are stored in the packs under
+// their key relative to contextPath. Placeholders are never packed. Without
+// files to pack, and no entries of policy.Previous to drop, plans are returned
+// unchanged and the index is nil.
+func Pack(plans []FilePlan, contextPath, dir string, policy PackPolicy) ([]FilePlan, *PackIndex, error) {
+	var small, rest []FilePlan
+	planned := make(map[string]bool, len(plans))
+	for _, plan := range plans {
+		planned[plan.Key] = true
+		if plan.Placeholder || plan.Size > policy.MaxFileSize || (policy.ExtractTar && IsTarArchive(plan.Source)) {
+			rest = append(rest, plan)
+			continue
+		}
+		small = append(small, plan)
+	}
+	if len(small) == 0 && !policy.Previous.replaced(planned) {
+		return plans, nil, nil
+	}
+	sort.Slice(small, func(i, j int) bool { return small[i].Key < small[j].Key })
+
+	base := normalizePrefix(contextPath)
+	packDir := joinKey(base, PackDir)
+	index := &PackIndex{Version: packIndexVersion}
+	var (
+		writer *packWriter
+		packed []FilePlan
+	)
+	closePack := func() error {
+		if writer == nil {
+			return nil
+		}
+		size, err := writer.close()
+		if err != nil {
+			return err
+		}
+		packed = append(packed, FilePlan{Source: writer.file.Name(), Key: writer.key, Size: size})
+		writer = nil
+		return nil
+	}
+	for _, plan := range small {
+		entrySize := tarBlock + (plan.Size+tarBlock-1)/tarBlock*tarBlock
+		if writer != nil && writer.size+entrySize > policy.ChunkSize {
+			if err := closePack(); err != nil {
+				return nil, nil, err
+			}
+		}
+		if writer == nil {
+			name := fmt.Sprintf("%s-%04d%s", policy.Name, len(index.Packs)+1, packSuffix)
+			var err error
+			if writer, err = newPackWriter(filepath.Join(dir, name), joinKey(packDir, name)); err != nil {
+				return nil, nil, err
+			}
+			index.Packs = append(index.Packs, writer.key)
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(plan.Key, base), "/")
+		offset, err := writer.add(plan, name)
+		if err != nil {
+			_, _ = writer.close()
+			return nil, nil, err
+		}
+		index.Entries = append(index.Entries, PackEntry{Key: plan.Key, Pack: writer.key, Offset: offset, Size: plan.Size})
+	}
+	if err := closePack(); err != nil {
+		return nil, nil, err
+	}
+	index.keep(policy.Previous, planned)
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode pack index: %w", err)
+	}
+	indexPath := filepath.Join(dir, PackIndexName)
+	if err := os.WriteFile(indexPath, append(data, '\n'), 0o644); err != nil {
+		return nil, nil, fmt.Errorf("failed to write pack index: %w", err)
+	}
+	packed = append(packed, FilePlan{Source: indexPath, Key: joinKey(packDir, PackIndexName), Size: int64(len(data) + 1)})
+	return append(rest, packed...), index, nil
+}
+
+// replaced reports whether any file of the index is planned again, which
+// the index then must no longer list.
+func (index *PackIndex) replaced(planned map[string]bool) bool {
+	if index == nil {
+		return false
+	}
+	for _, entry := range index.Entries {
+		if planned[entry.Key] {
+			return true
+		}
+	}
+	return false
+}
+
+// keep adds the entries of previous that are neither planned again nor in a
+// pack of index, which overwrites the pack of the same name, and the packs
+// holding them.
+func (index *PackIndex) keep(previous *PackIndex, planned map[string]bool) {
+	if previous == nil {
+		return
+	}
+	written := make(map[string]bool, len(index.Packs))
+	for _, pack := range index.Packs {
+		written[pack] = true
+	}
+	kept := make(map[string]bool)
+	for _, entry := range previous.Entries {
+		if planned[entry.Key] || written[entry.Pack] {
+			continue
+		}
+		index.Entries = append(index.Entries, entry)
+		kept[entry.Pack] = true
+	}
+	for _, pack := range previous.Packs {
+		if kept[pack] {
+			index.Packs = append(index.Packs, pack)
+		}
+	}
+}
+
+// under returns the part of index listing the files below prefix.
+func (index *PackIndex) under(prefix string) *PackIndex {
+	filtered := &PackIndex{Version: index.Version}
+	used := make(map[string]bool)
+	for _, entry := range index.Entries {
+		if withinPrefix(entry.Key, prefix) {
+			filtered.Entries = append(filtered.Entries, entry)
+			used[entry.Pack] = true
+		}
+	}
+	for _, pack := range index.Packs {
+		if used[pack] {
+			filtered.Packs = append(filtered.Packs, pack)
+		}
+	}
+	return filtered
+}
+
+// packWriter writes one pack, tracking the offset of each entry's content.
+type packWriter struct {
+	file    *os.File
+	key     string
+	archive *tar.Writer
+	size    int64
+}
+
+func newPackWriter(path, key string) (*packWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pack: %w", err)
+	}
+	w := &packWriter{file: file, key: key}
+	w.archive = tar.NewWriter(&countingWriter{w: file, n: &w.size})
+	return w, nil
+}
+
+// add appends the file of plan as name and returns the offset of its content.
+func (w *packWriter) add(plan FilePlan, name string) (int64, error) {
+	file, err := os.Open(plan.Source)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", plan.Source, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat %s: %w", plan.Source, err)
+	}
+
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     plan.Size,
+		Mode:     0o644,
+		ModTime:  info.ModTime().Truncate(time.Second),
+	}
+	if err := w.archive.WriteHeader(header); err != nil {
+		return 0, fmt.Errorf("failed to pack %s: %w", plan.Source, err)
+	}
+	// Headers are written whole, so the content starts where the count stands.
+	offset := w.size
+	if _, err := io.CopyN(w.archive, file, plan.Size); err != nil {
+		return 0, fmt.Errorf("failed to pack %s (changed since planning?): %w", plan.Source, err)
+	}
+	return offset, nil
+}
+
+// close finishes the pack and returns its size.
+func (w *packWriter) close() (int64, error) {
+	err := w.archive.Close()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to write pack %s: %w", w.key, err)
+	}
+	return w.size, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// isPackIndex reports whether key is the index of a PackDir, returning the
+// key of the directory the packed files were stored relative to.
+func isPackIndex(key string) (string, bool) {
+	suffix := PackDir + "/" + PackIndexName
+	if key == suffix {
+		return "", true
+	}
+	if strings.HasSuffix(key, "/"+suffix) {
+		return strings.TrimSuffix(key, "/"+suffix), true
+	}
+	return "", false
+}
+
+// ReadPackIndex returns the index of the files Pack bundled for an upload to
+// contextPath, or nil when there is none.
+func (t *Transport) ReadPackIndex(ctx context.Context, contextPath string) (*PackIndex, error) {
+	return t.readPackIndex(ctx, packIndexKey(normalizePrefix(contextPath)))
+}
+
+// packIndexKey returns the key of the index of the packs of an upload to
+// base.
+func packIndexKey(base string) string {
+	return joinKey(joinKey(base, PackDir), PackIndexName)
+}
+
+// packIndexKeysAbove returns the keys the indexes of uploads to the prefixes
+// above prefix would be stored at, from the bucket root down.
+func packIndexKeysAbove(prefix string) []string {
+	if prefix == "" {
+		return nil
+	}
+	keys := []string{packIndexKey("")}
+	parts := strings.Split(prefix, "/")
+	for i := 1; i < len(parts); i++ {
+		keys = append(keys, packIndexKey(strings.Join(parts[:i], "/")))
+	}
+	return keys
+}
+
+// readPackIndex reads and decodes the pack index at key, or returns nil when
+// there is none.
+func (t *Transport) readPackIndex(ctx context.Context, key string) (*PackIndex, error) {
+	response, err := t.backend.Get(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(t.bucket),
+		Key:    aws.String(key),
+	})
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pack index %s: %w", key, err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	body, _, err := t.open(ctx, key, response.Body, response.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	var index PackIndex
+	if err := json.NewDecoder(body).Decode(&index); err != nil {
+		return nil, fmt.Errorf("failed to decode pack index %s: %w", key, err)
+	}
+	if index.Version != packIndexVersion {
+		return nil, fmt.Errorf("pack index %s has unsupported version %d", key, index.Version)
+	}
+	return &index, nil
+}
+
+// extractPacks writes the files listed in index, whose packs are stored
+// relative to base, to dir at their key below prefix.
+func (t *Transport) extractPacks(ctx context.Context, index *PackIndex, base, prefix, dir string) ([]DownloadResult, error) {
+	entries := make(map[string]map[string]PackEntry, len(index.Packs))
+	for _, entry := range index.Entries {
+		if entries[entry.Pack] == nil {
+			entries[entry.Pack] = make(map[string]PackEntry)
+		}
+		entries[entry.Pack][entry.Key] = entry
+	}
+
+	results := make([]DownloadResult, 0, len(index.Entries))
+	if t.dryRun {
+		for _, entry := range index.Entries {
+			results = append(results, DownloadResult{Key: entry.Key, Path: packTarget(entry.Key, prefix, dir), Size: entry.Size, Pack: entry.Pack})
+		}
+		return results, nil
+	}
+	for _, pack := range index.Packs {
+		extracted, err := t.extractPack(ctx, pack, entries[pack], base, prefix, dir)
+		results = append(results, extracted...)
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// packTarget returns the path below dir a packed file at key below prefix is
+// extracted to.
+func packTarget(key, prefix, dir string) string {
+	rel := strings.TrimPrefix(strings.TrimPrefix(key, prefix), "/")
+	rel = strings.TrimPrefix(path.Clean("/"+rel), "/")
+	return filepath.Join(dir, filepath.FromSlash(rel))
+}
+
+// extractPack writes the listed entries of the pack at key to dir.
+func (t *Transport) extractPack(ctx context.Context, key string, entries map[string]PackEntry, base, prefix, dir string) ([]DownloadResult, error) {
+	response, err := t.backend.Get(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(t.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download pack %s: %w", key, err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	body, decrypted, err := t.open(ctx, key, response.Body, response.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := tar.NewReader(body)
+	results := make([]DownloadResult, 0, len(entries))
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return results, fmt.Errorf("failed to read pack %s: %w", key, err)
+		}
+		entryKey := joinKey(base, strings.TrimPrefix(path.Clean("/"+header.Name), "/"))
+		if _, ok := entries[entryKey]; !ok || header.Typeflag != tar.TypeReg {
+			continue
+		}
+		target := packTarget(entryKey, prefix, dir)
+		size, err := writeFile(target, archive)
+		if err != nil {
+			return results, fmt.Errorf("failed to extract %s from pack %s: %w", entryKey, key, err)
+		}
+		results = append(results, DownloadResult{Key: entryKey, Path: target, Size: size, Decrypted: decrypted, Pack: key})
+		delete(entries, entryKey)
+	}
+	if len(entries) > 0 {
+		missing := make([]string, 0, len(entries))
+		for entryKey := range entries {
+			missing = append(missing, entryKey)
+		}
+		sort.Strings(missing)
+		return results, fmt.Errorf("pack %s lacks %d indexed file(s): %s", key, len(missing), strings.Join(missing, ", "))
+	}
+	return results, nil
+}
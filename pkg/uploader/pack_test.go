@@ -0,0 +1,223 @@
+package uploader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func packPlans(t *testing.T, files map[string]string) []FilePlan {
+	t.Helper()
+	src := t.TempDir()
+	var plans []FilePlan
+	for rel, content := range files {
+		path := filepath.Join(src, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		plans = append(plans, FilePlan{Source: path, Key: "site/" + rel, Size: int64(len(content))})
+	}
+	return plans
+}
+
+func TestPackBundlesSmallFiles(t *testing.T) {
+	files := map[string]string{
+		"a.txt":       "alpha",
+		"b/c.txt":     "charlie",
+		"d.txt":       "delta",
+		"big/app.bin": strings.Repeat("x", 4096),
+	}
+	plans := packPlans(t, files)
+	dir := t.TempDir()
+
+	out, index, err := Pack(plans, "site", dir, PackPolicy{MaxFileSize: 1024, ChunkSize: 2048, Name: "run"})
+	if err != nil {
+		t.Fatalf("Pack returned error: %v", err)
+	}
+	if index == nil || len(index.Entries) != 3 {
+		t.Fatalf("expected 3 packed entries, got %+v", index)
+	}
+	// Each entry takes a header and a padded content block, so two fit a pack.
+	wantPacks := []string{"site/.packs/run-0001.pack", "site/.packs/run-0002.pack"}
+	if strings.Join(index.Packs, ",") != strings.Join(wantPacks, ",") {
+		t.Fatalf("packs = %v, want %v", index.Packs, wantPacks)
+	}
+
+	keys := make([]string, 0, len(out))
+	for _, plan := range out {
+		keys = append(keys, plan.Key)
+	}
+	want := "site/big/app.bin,site/.packs/run-0001.pack,site/.packs/run-0002.pack,site/.packs/index.json"
+	if strings.Join(keys, ",") != want {
+		t.Fatalf("plans = %v, want %s", keys, want)
+	}
+
+	for _, entry := range index.Entries {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.Base(entry.Pack)))
+		if err != nil {
+			t.Fatalf("failed to read pack: %v", err)
+		}
+		got := string(data[entry.Offset : entry.Offset+entry.Size])
+		if got != files[strings.TrimPrefix(entry.Key, "site/")] {
+			t.Errorf("%s at offset %d = %q", entry.Key, entry.Offset, got)
+		}
+	}
+}
+
+func TestPackLeavesPlansWithoutSmallFiles(t *testing.T) {
+	plans := packPlans(t, map[string]string{"app.bin": strings.Repeat("x", 4096)})
+
+	out, index, err := Pack(plans, "site", t.TempDir(), PackPolicy{MaxFileSize: 1024, ChunkSize: 2048, Name: "run"})
+	if err != nil {
+		t.Fatalf("Pack returned error: %v", err)
+	}
+	if index != nil || len(out) != 1 || out[0].Key != "site/app.bin" {
+		t.Fatalf("expected plans unchanged, got %+v, %+v", out, index)
+	}
+}
+
+func TestDownloadExtractsPackedFiles(t *testing.T) {
+	files := map[string]string{
+		"a.txt":   "alpha",
+		"b/c.txt": "charlie",
+		"main.js": "console.log(1)",
+	}
+	dir := t.TempDir()
+	out, _, err := Pack(packPlans(t, files), "site", dir, PackPolicy{MaxFileSize: 8, ChunkSize: 1 << 20, Name: "run"})
+	if err != nil {
+		t.Fatalf("Pack returned error: %v", err)
+	}
+
+	client := &fakeClient{objects: map[string]string{}}
+	listing := &s3.ListObjectsV2Output{}
+	for _, plan := range out {
+		data, err := os.ReadFile(plan.Source)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", plan.Source, err)
+		}
+		client.objects[plan.Key] = string(data)
+		listing.Contents = append(listing.Contents, s3types.Object{Key: aws.String(plan.Key)})
+	}
+	client.listOutputs = []*s3.ListObjectsV2Output{listing}
+
+	target := t.TempDir()
+	transport := NewTransport(client, &stubUploader{}, "bucket", true)
+	results, err := transport.Download(context.Background(), "site", target)
+	if err != nil {
+		t.Fatalf("Download returned error: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 downloads, got %+v", results)
+	}
+	for rel, content := range files {
+		data, err := os.ReadFile(filepath.Join(target, filepath.FromSlash(rel)))
+		if err != nil {
+			t.Fatalf("expected %s to be written: %v", rel, err)
+		}
+		if string(data) != content {
+			t.Errorf("%s = %q, want %q", rel, data, content)
+		}
+	}
+	for _, result := range results {
+		if (result.Pack != "") != (result.Key != "site/main.js") {
+			t.Errorf("unexpected pack for %+v", result)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(target, PackDir)); !os.IsNotExist(err) {
+		t.Errorf("expected the pack directory to be skipped, got %v", err)
+	}
+}
+
+func TestPackKeepsEntriesOfEarlierRuns(t *testing.T) {
+	previous := &PackIndex{
+		Version: packIndexVersion,
+		Packs:   []string{"site/.packs/old-0001.pack", "site/.packs/run-0001.pack"},
+		Entries: []PackEntry{
+			{Key: "site/kept.txt", Pack: "site/.packs/old-0001.pack", Size: 4},
+			{Key: "site/a.txt", Pack: "site/.packs/old-0001.pack", Size: 3},
+			{Key: "site/retried.txt", Pack: "site/.packs/run-0001.pack", Size: 2},
+		},
+	}
+	plans := packPlans(t, map[string]string{"a.txt": "alpha"})
+
+	_, index, err := Pack(plans, "site", t.TempDir(), PackPolicy{MaxFileSize: 1024, ChunkSize: 2048, Name: "run", Previous: previous})
+	if err != nil {
+		t.Fatalf("Pack returned error: %v", err)
+	}
+	var keys []string
+	for _, entry := range index.Entries {
+		keys = append(keys, entry.Key+"@"+entry.Pack)
+	}
+	// a.txt is packed anew, and run-0001.pack is overwritten by this run.
+	want := "site/a.txt@site/.packs/run-0001.pack,site/kept.txt@site/.packs/old-0001.pack"
+	if strings.Join(keys, ",") != want {
+		t.Errorf("entries = %v, want %s", keys, want)
+	}
+	if strings.Join(index.Packs, ",") != "site/.packs/run-0001.pack,site/.packs/old-0001.pack" {
+		t.Errorf("unexpected packs %v", index.Packs)
+	}
+
+	// A file uploaded on its own now must no longer be extracted from its
+	// old pack, even without anything to pack.
+	large := packPlans(t, map[string]string{"kept.txt": strings.Repeat("x", 4096)})
+	out, index, err := Pack(large, "site", t.TempDir(), PackPolicy{MaxFileSize: 1024, ChunkSize: 2048, Name: "next", Previous: previous})
+	if err != nil {
+		t.Fatalf("Pack returned error: %v", err)
+	}
+	if index == nil || len(index.Entries) != 2 || out[len(out)-1].Key != "site/.packs/index.json" {
+		t.Fatalf("expected a rewritten index without kept.txt, got %+v, %+v", out, index)
+	}
+	for _, entry := range index.Entries {
+		if entry.Key == "site/kept.txt" {
+			t.Errorf("expected kept.txt dropped from the index, got %+v", index.Entries)
+		}
+	}
+}
+
+func TestDownloadExtractsPackedFilesBelowTheContextPath(t *testing.T) {
+	files := map[string]string{
+		"a.txt":        "alpha",
+		"assets/b.css": "body{}",
+		"assets/c.js":  "c()",
+	}
+	dir := t.TempDir()
+	out, _, err := Pack(packPlans(t, files), "site", dir, PackPolicy{MaxFileSize: 8, ChunkSize: 1 << 20, Name: "run"})
+	if err != nil {
+		t.Fatalf("Pack returned error: %v", err)
+	}
+	client := &fakeClient{objects: map[string]string{}}
+	for _, plan := range out {
+		data, err := os.ReadFile(plan.Source)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", plan.Source, err)
+		}
+		client.objects[plan.Key] = string(data)
+	}
+	// Nothing but packed files lives below the prefix.
+	client.listOutputs = []*s3.ListObjectsV2Output{{}}
+
+	target := t.TempDir()
+	transport := NewTransport(client, &stubUploader{}, "bucket", true)
+	results, err := transport.Download(context.Background(), "site/assets", target)
+	if err != nil {
+		t.Fatalf("Download returned error: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected the 2 packed files below the prefix, got %+v", results)
+	}
+	for _, rel := range []string{"b.css", "c.js"} {
+		data, err := os.ReadFile(filepath.Join(target, rel))
+		if err != nil || string(data) != files["assets/"+rel] {
+			t.Errorf("expected %s extracted, got %q, %v", rel, data, err)
+		}
+	}
+}
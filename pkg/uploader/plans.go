@@ -0,0 +1,511 @@
+package uploader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FileAction is what planning does with an empty or special file.
+type FileAction int
+
+const (
+	// FileUpload plans the file like any other.
+	FileUpload FileAction = iota
+	// FileSkip leaves the file out.
+	FileSkip
+	// FileFail fails planning.
+	FileFail
+	// FileUploadEmpty plans an empty object in place of a special file,
+	// without opening it.
+	FileUploadEmpty
+)
+
+// PlanPolicy decides how planning treats empty files and special files:
+// FIFOs, sockets, devices and anything else that is not a regular file. The
+// zero value uploads empty files and fails on special files, which could
+// otherwise block or fail the run midway when opened.
+type PlanPolicy struct {
+	// Empty is FileUpload, FileSkip or FileFail.
+	Empty FileAction
+	// Special is FileFail, FileSkip or FileUploadEmpty; FileUpload means FileFail.
+	Special FileAction
+	// Skipped, when set, is called for every file a policy leaves out.
+	Skipped func(path, reason string)
+	// MaxFiles and MaxTotalSize, when positive, stop planning as soon as the
+	// planned files exceed them, so a source path such as / fails fast
+	// instead of being walked and uploaded in full.
+	MaxFiles     int
+	MaxTotalSize int64
+	// MaxDepth, when positive, limits how many directory levels below each
+	// source directory are walked: 1 plans only the files directly inside
+	// it. Deeper directories are skipped without being read.
+	MaxDepth int
+	// StripComponents, when positive, removes that many leading path
+	// elements from the keys of files below each source directory, like tar
+	// --strip-components. Files with no more elements than that are skipped.
+	StripComponents int
+	// IgnoreFiles names the ignore files, in gitignore syntax, honoured in
+	// every directory of a source directory; see IgnoreFileNames. The
+	// ignore files themselves are not uploaded.
+	IgnoreFiles []string
+	// Gitignore additionally honours .gitignore files and the exclude file
+	// of the enclosing git repository, and leaves out .git itself.
+	Gitignore bool
+	// Forbidden lists patterns of files that must never be uploaded, such as
+	// private keys. They are matched like KMSKeyRule patterns against the
+	// path of a file below its source directory, the base name of a single
+	// file, and the key below the prefix. Planning fails once the walk has
+	// ended, listing every matching file; ignored files are not checked.
+	Forbidden []string
+	// MaxObjectSize, when positive, refuses files larger than that many
+	// bytes, such as VM images or database dumps included by accident.
+	// Planning fails once the walk has ended, listing every such file.
+	MaxObjectSize int64
+	// WalkConcurrency is how many directories of a source directory are read
+	// at once, for sources on slow network file systems. Up to 1 walks in
+	// lexical order; above it plans are emitted in no particular order and
+	// Skipped may be called concurrently.
+	WalkConcurrency int
+}
+
+// plan applies the policy to a file found during the walk and reports
+// whether to emit the resulting plan.
+func (p PlanPolicy) plan(path, key string, info os.FileInfo) (FilePlan, bool, error) {
+	plan := FilePlan{Source: path, Key: key, Size: info.Size()}
+	mode := info.Mode()
+
+	if !mode.IsRegular() {
+		kind := specialKind(mode)
+		switch p.Special {
+		case FileSkip:
+			p.skip(path, kind)
+			return plan, false, nil
+		case FileUploadEmpty:
+			plan.Size = 0
+			plan.Placeholder = true
+			return plan, true, nil
+		default:
+			return plan, false, fmt.Errorf("%s is a %s, not a regular file", path, kind)
+		}
+	}
+
+	if info.Size() == 0 {
+		switch p.Empty {
+		case FileSkip:
+			p.skip(path, "empty file")
+			return plan, false, nil
+		case FileFail:
+			return plan, false, fmt.Errorf("%s is empty", path)
+		}
+	}
+	return plan, true, nil
+}
+
+// limit wraps emit to fail once the planned files exceed MaxFiles or
+// MaxTotalSize.
+func (p PlanPolicy) limit(emit func(FilePlan) error) func(FilePlan) error {
+	if p.MaxFiles <= 0 && p.MaxTotalSize <= 0 {
+		return emit
+	}
+	var files int
+	var total int64
+	return func(plan FilePlan) error {
+		files++
+		total += plan.Size
+		if p.MaxFiles > 0 && files > p.MaxFiles {
+			return fmt.Errorf("sources contain more than %d files, the configured limit; check that the source paths are correct", p.MaxFiles)
+		}
+		if p.MaxTotalSize > 0 && total > p.MaxTotalSize {
+			return fmt.Errorf("sources exceed the configured limit of %d bytes in total at %s; check that the source paths are correct", p.MaxTotalSize, plan.Source)
+		}
+		return emit(plan)
+	}
+}
+
+func (p PlanPolicy) skip(path, reason string) {
+	if p.Skipped != nil {
+		p.Skipped(path, reason)
+	}
+}
+
+func specialKind(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		return "named pipe"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeCharDevice != 0:
+		return "character device"
+	case mode&os.ModeDevice != 0:
+		return "device"
+	case mode&os.ModeSymlink != 0:
+		return "broken symlink"
+	}
+	return "special file"
+}
+
+// BuildPlans resolves a set of filesystem paths into upload plans under the
+// desired prefix. Paths may map to keys below the prefix; see ParseSource.
+func BuildPlans(paths []string, prefix string, policy PlanPolicy) ([]FilePlan, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("at least one source path must be specified")
+	}
+
+	plans := make([]FilePlan, 0)
+	err := walkPlans(paths, prefix, policy, func(plan FilePlan) error {
+		plans = append(plans, plan)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if policy.WalkConcurrency > 1 {
+		sort.Slice(plans, func(i, j int) bool { return plans[i].Key < plans[j].Key })
+	}
+
+	return plans, nil
+}
+
+// StreamPlans walks the paths in the background and emits plans as they are
+// discovered, so uploads can start before a large tree has been fully walked.
+// The plan channel is closed when the walk ends; the error channel then yields
+// at most one error and is closed. Cancelling the context stops the walk.
+func StreamPlans(ctx context.Context, paths []string, prefix string, policy PlanPolicy) (<-chan FilePlan, <-chan error) {
+	plans := make(chan FilePlan, planBufferSize)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(plans)
+
+		if len(paths) == 0 {
+			errs <- fmt.Errorf("at least one source path must be specified")
+			return
+		}
+
+		err := walkPlans(paths, prefix, policy, func(plan FilePlan) error {
+			select {
+			case plans <- plan:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil {
+			errs <- err
+		}
+	}()
+
+	return plans, errs
+}
+
+// ParseSource splits a source of the form local_path=remote_key into the
+// local path and the key, relative to the upload prefix, that the file is
+// stored at; for a directory the key is the prefix its files are stored
+// under. A key ending in "/" is a prefix for files too, which keep their base
+// name below it. A source without "=" is stored under its base name (files)
+// or directly under the upload prefix (directories), and key is empty. The
+// first "=" not preceded by a backslash is the separator, so keys may contain
+// "=" and a path that does, such as a dt=2024-01-01 directory, writes it as
+// "\=".
+func ParseSource(spec string) (path, key string) {
+	spec = strings.TrimSpace(spec)
+	path, key, found := CutUnescaped(spec, '=')
+	if !found {
+		return path, ""
+	}
+	key = strings.TrimLeft(strings.TrimSpace(key), "/")
+	if strings.Trim(key, "/") == "" {
+		key = ""
+	}
+	return strings.TrimSpace(path), key
+}
+
+// SourceUnder returns the source that uploads path below prefix, keeping the
+// base name of a file and the layout of a directory.
+func SourceUnder(path, prefix string) string {
+	path = escapeSeparator(path, '=')
+	prefix = normalizePrefix(prefix)
+	if prefix == "" {
+		return path + "="
+	}
+	return path + "=" + prefix + "/"
+}
+
+// CutUnescaped splits s at the first sep that is not preceded by a backslash
+// and turns every escaped sep before it back into sep; found reports whether
+// there was such a sep. Other backslashes are kept, so Windows paths need no
+// escaping.
+func CutUnescaped(s string, sep byte) (before, after string, found bool) {
+	escaped := `\` + string(sep)
+	for i := 0; i < len(s); i++ {
+		if s[i] == sep && (i == 0 || s[i-1] != '\\') {
+			return strings.ReplaceAll(s[:i], escaped, string(sep)), s[i+1:], true
+		}
+	}
+	return strings.ReplaceAll(s, escaped, string(sep)), "", false
+}
+
+// escapeSeparator escapes every sep in path for CutUnescaped.
+func escapeSeparator(path string, sep byte) string {
+	return strings.ReplaceAll(path, string(sep), `\`+string(sep))
+}
+
+// ValidateSource checks a source for an empty local path and, for a
+// local_path=remote_key source, a key that is invalid or would leave the
+// upload prefix.
+func ValidateSource(spec string) error {
+	path, key := ParseSource(spec)
+	if path == "" {
+		return fmt.Errorf("encountered empty source path entry")
+	}
+	if slices.Contains(strings.Split(key, "/"), "..") {
+		return fmt.Errorf("the key of source %q must not contain '..'", spec)
+	}
+	return ValidateKey(key)
+}
+
+// CheckSources verifies that every source path exists without walking it, so
+// callers streaming plans can fail fast before destructive steps.
+func CheckSources(paths []string) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one source path must be specified")
+	}
+	for _, candidate := range paths {
+		if err := ValidateSource(candidate); err != nil {
+			return err
+		}
+		path, _ := ParseSource(candidate)
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// TeePlans duplicates every plan read from in onto n output channels. Each
+// consumer must drain its channel; the slowest consumer paces the others.
+func TeePlans(in <-chan FilePlan, n int) []<-chan FilePlan {
+	outs := make([]chan FilePlan, n)
+	readers := make([]<-chan FilePlan, n)
+	for i := range outs {
+		outs[i] = make(chan FilePlan, planBufferSize)
+		readers[i] = outs[i]
+	}
+
+	go func() {
+		for plan := range in {
+			for _, out := range outs {
+				out <- plan
+			}
+		}
+		for _, out := range outs {
+			close(out)
+		}
+	}()
+
+	return readers
+}
+
+// CheckPlans forwards the plans read from in that check accepts; returning
+// false drops a plan. The first error stops forwarding and the remaining plans
+// are drained so the producer never blocks. The returned function waits for in
+// to be drained and reports that error.
+func CheckPlans(in <-chan FilePlan, check func(FilePlan) (bool, error)) (<-chan FilePlan, func() error) {
+	out := make(chan FilePlan, planBufferSize)
+	done := make(chan struct{})
+	var failure error
+
+	go func() {
+		defer close(done)
+		defer close(out)
+		for plan := range in {
+			if failure != nil {
+				continue
+			}
+			keep, err := check(plan)
+			if err != nil {
+				failure = err
+				continue
+			}
+			if keep {
+				out <- plan
+			}
+		}
+	}()
+
+	return out, func() error {
+		<-done
+		return failure
+	}
+}
+
+// PrependPlans returns a channel yielding plans followed by every plan read
+// from in. Once ctx is done it stops yielding and drains in, so neither the
+// producer nor PrependPlans blocks when the consumer stopped reading.
+func PrependPlans(ctx context.Context, plans []FilePlan, in <-chan FilePlan) <-chan FilePlan {
+	out := make(chan FilePlan, planBufferSize)
+	go func() {
+		defer close(out)
+		defer func() {
+			for range in {
+			}
+		}()
+		for _, plan := range plans {
+			select {
+			case out <- plan:
+			case <-ctx.Done():
+				return
+			}
+		}
+		for plan := range in {
+			select {
+			case out <- plan:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// planBufferSize bounds how far the directory walk may run ahead of uploads.
+const planBufferSize = 256
+
+func walkPlans(paths []string, prefix string, policy PlanPolicy, emit func(FilePlan) error) error {
+	seen := make(map[string]struct{})
+	basePrefix := normalizePrefix(prefix)
+	emit = policy.limit(emit)
+
+	// Directory walks may plan files from several goroutines.
+	var mu sync.Mutex
+	var refused []refusedFile
+	record := func(path, reason string) {
+		mu.Lock()
+		defer mu.Unlock()
+		refused = append(refused, refusedFile{source: path, reason: reason})
+	}
+	refuse := func(path string, names ...string) bool {
+		pattern := policy.forbidden(names...)
+		if pattern != "" {
+			record(path, "matches forbidden pattern "+pattern)
+		}
+		return pattern != ""
+	}
+	oversized := func(plan FilePlan) bool {
+		if policy.MaxObjectSize <= 0 || plan.Size <= policy.MaxObjectSize {
+			return false
+		}
+		record(plan.Source, fmt.Sprintf("%d bytes, above the maximum object size of %d bytes", plan.Size, policy.MaxObjectSize))
+		return true
+	}
+	claim := func(path, key string) error {
+		if err := ValidateKey(key); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if _, dup := seen[key]; dup {
+			return fmt.Errorf("duplicate object key detected: %s", key)
+		}
+		seen[key] = struct{}{}
+		return nil
+	}
+	send := func(plan FilePlan) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return emit(plan)
+	}
+
+	for _, candidate := range paths {
+		if err := ValidateSource(candidate); err != nil {
+			return err
+		}
+		path, mapped := ParseSource(candidate)
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+
+		if info.IsDir() {
+			dirPrefix := joinKey(basePrefix, mapped)
+			walker := &dirWalker{
+				root:   filepath.Clean(path),
+				policy: policy,
+				file: func(current, rel string, entry os.DirEntry) error {
+					fi, err := entry.Info()
+					if err != nil {
+						return fmt.Errorf("failed to inspect %s: %w", current, err)
+					}
+					if fi.Mode()&os.ModeSymlink != 0 {
+						// Classify links by what they point to, as uploads read through them.
+						if target, err := os.Stat(current); err == nil {
+							fi = target
+						}
+					}
+
+					source := rel
+					if policy.StripComponents > 0 {
+						parts := strings.SplitN(rel, "/", policy.StripComponents+1)
+						if len(parts) <= policy.StripComponents {
+							policy.skip(current, fmt.Sprintf("fewer than %d directories to strip", policy.StripComponents))
+							return nil
+						}
+						rel = parts[policy.StripComponents]
+					}
+					if refuse(current, source, joinKey(mapped, rel)) {
+						return nil
+					}
+					key := joinKey(dirPrefix, rel)
+					if err := claim(current, key); err != nil {
+						return err
+					}
+					plan, ok, err := policy.plan(current, key, fi)
+					if err != nil || !ok || oversized(plan) {
+						return err
+					}
+					return send(plan)
+				},
+			}
+			if err := walker.run(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := mapped
+		if name == "" || strings.HasSuffix(name, "/") {
+			name = joinKey(normalizePrefix(name), filepath.ToSlash(filepath.Base(path)))
+		}
+		if refuse(path, filepath.ToSlash(filepath.Base(path)), name) {
+			continue
+		}
+		key := joinKey(basePrefix, name)
+		if err := claim(path, key); err != nil {
+			return err
+		}
+
+		plan, ok, err := policy.plan(path, key, info)
+		if err != nil {
+			return err
+		}
+		if !ok || oversized(plan) {
+			continue
+		}
+		if err := send(plan); err != nil {
+			return err
+		}
+	}
+
+	if len(refused) > 0 {
+		return refusedError(refused)
+	}
+	return nil
+}
@@ -0,0 +1,623 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTree(t *testing.T, root string, files int) {
+	t.Helper()
+	for i := 0; i < files; i++ {
+		dir := filepath.Join(root, fmt.Sprintf("dir%d", i%3))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("failed to mkdir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%d.txt", i)), []byte("data"), 0o644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+}
+
+func TestStreamPlansEmitsEveryFile(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, 10)
+
+	plans, errs := StreamPlans(context.Background(), []string{root}, "prefix", PlanPolicy{})
+
+	count := 0
+	for plan := range plans {
+		if filepath.Dir(plan.Key) == "." {
+			t.Errorf("expected prefixed key, got %s", plan.Key)
+		}
+		count++
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("StreamPlans returned error: %v", err)
+	}
+	if count != 10 {
+		t.Fatalf("expected 10 plans, got %d", count)
+	}
+}
+
+func TestStreamPlansReportsDuplicates(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "data.txt")
+	if err := os.WriteFile(file, []byte("one"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	plans, errs := StreamPlans(context.Background(), []string{file, file}, "", PlanPolicy{})
+	for range plans {
+	}
+	if err := <-errs; err == nil {
+		t.Fatal("expected duplicate detection error")
+	}
+}
+
+func TestUploadStreamWithWorkersAndTee(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, 20)
+
+	plans, errs := StreamPlans(context.Background(), []string{root}, "", PlanPolicy{})
+	feeds := TeePlans(plans, 2)
+
+	primary := &stubUploader{}
+	mirror := &stubUploader{}
+	first := NewTransport(&fakeClient{}, primary, "bucket", true)
+	first.SetConcurrency(4)
+	second := NewTransport(&fakeClient{}, mirror, "mirror", true)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := second.UploadStream(context.Background(), feeds[1])
+		done <- err
+	}()
+
+	results, err := first.UploadStream(context.Background(), feeds[0])
+	if err != nil {
+		t.Fatalf("UploadStream returned error: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("mirror UploadStream returned error: %v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("StreamPlans returned error: %v", err)
+	}
+
+	if len(results) != 20 || len(primary.uploads) != 20 || len(mirror.uploads) != 20 {
+		t.Fatalf("expected 20 uploads per destination, got %d/%d/%d", len(results), len(primary.uploads), len(mirror.uploads))
+	}
+	for i := 1; i < len(results); i++ {
+		if results[i-1].Key > results[i].Key {
+			t.Fatalf("expected results sorted by key, got %s before %s", results[i-1].Key, results[i].Key)
+		}
+	}
+}
+
+func TestUploadStreamStopsTheProducerOnFailure(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, 1)
+	source := filepath.Join(root, "dir0", "file0.txt")
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	plans := make(chan FilePlan)
+	go func() {
+		// Without being stopped, this producer never ends.
+		defer close(plans)
+		for i := 0; ; i++ {
+			select {
+			case plans <- FilePlan{Source: source, Key: fmt.Sprintf("file%d.txt", i)}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	transport := NewTransport(&fakeClient{}, &stubUploader{err: fmt.Errorf("denied")}, "bucket", true)
+	transport.SetOnFailure(stop)
+	done := make(chan error, 1)
+	go func() {
+		_, err := transport.UploadStream(context.Background(), plans)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		var failure *UploadError
+		if !errors.As(err, &failure) {
+			t.Fatalf("expected an UploadError, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the failed upload to stop the producer")
+	}
+}
+
+func TestCheckPlansDropsAndStopsAtFirstFailure(t *testing.T) {
+	in := make(chan FilePlan, 5)
+	for _, key := range []string{"a", "skip", "b", "bad", "c"} {
+		in <- FilePlan{Key: key}
+	}
+	close(in)
+
+	out, wait := CheckPlans(in, func(plan FilePlan) (bool, error) {
+		switch plan.Key {
+		case "bad":
+			return false, fmt.Errorf("rejected %s", plan.Key)
+		case "skip":
+			return false, nil
+		}
+		return true, nil
+	})
+
+	var forwarded []string
+	for plan := range out {
+		forwarded = append(forwarded, plan.Key)
+	}
+	if err := wait(); err == nil || err.Error() != "rejected bad" {
+		t.Fatalf("expected rejection error, got %v", err)
+	}
+	if len(forwarded) != 2 || forwarded[0] != "a" || forwarded[1] != "b" {
+		t.Errorf("expected accepted plans before the failure to be forwarded, got %v", forwarded)
+	}
+}
+
+func TestPrependPlansYieldsPlansFirst(t *testing.T) {
+	in := make(chan FilePlan, 2)
+	in <- FilePlan{Key: "walked/a"}
+	in <- FilePlan{Key: "walked/b"}
+	close(in)
+
+	var keys []string
+	for plan := range PrependPlans(context.Background(), []FilePlan{{Key: ".attestations/sbom.json"}}, in) {
+		keys = append(keys, plan.Key)
+	}
+	if len(keys) != 3 || keys[0] != ".attestations/sbom.json" || keys[2] != "walked/b" {
+		t.Errorf("unexpected plan order %v", keys)
+	}
+}
+
+func TestPrependPlansStopsWhenCanceled(t *testing.T) {
+	in := make(chan FilePlan)
+	ctx, cancel := context.WithCancel(context.Background())
+	out := PrependPlans(ctx, make([]FilePlan, planBufferSize+1), in)
+	cancel()
+
+	// The canceled goroutine drains in instead of leaving the producer blocked.
+	select {
+	case in <- FilePlan{Key: "walked/a"}:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected PrependPlans to drain its input once canceled")
+	}
+	close(in)
+	for range out {
+	}
+}
+
+func TestBuildPlansAppliesFilePolicy(t *testing.T) {
+	// Socket paths are length-limited, so avoid the long per-test directory.
+	root, err := os.MkdirTemp("", "plans")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(root) })
+
+	if err := os.WriteFile(filepath.Join(root, "data.txt"), []byte("data"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "empty.txt"), nil, 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	listener, err := net.Listen("unix", filepath.Join(root, "agent.sock"))
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	if _, err := BuildPlans([]string{root}, "", PlanPolicy{}); err == nil || !strings.Contains(err.Error(), "socket") {
+		t.Fatalf("expected the socket to fail planning by default, got %v", err)
+	}
+
+	var skipped []string
+	plans, err := BuildPlans([]string{root}, "", PlanPolicy{
+		Empty:   FileSkip,
+		Special: FileSkip,
+		Skipped: func(path, reason string) { skipped = append(skipped, filepath.Base(path)+": "+reason) },
+	})
+	if err != nil {
+		t.Fatalf("BuildPlans returned error: %v", err)
+	}
+	if len(plans) != 1 || plans[0].Key != "data.txt" {
+		t.Errorf("expected only data.txt to be planned, got %+v", plans)
+	}
+	if len(skipped) != 2 {
+		t.Errorf("expected two skipped files, got %v", skipped)
+	}
+
+	plans, err = BuildPlans([]string{root}, "", PlanPolicy{Special: FileUploadEmpty})
+	if err != nil {
+		t.Fatalf("BuildPlans returned error: %v", err)
+	}
+	if len(plans) != 3 || plans[0].Key != "agent.sock" || !plans[0].Placeholder || plans[0].Size != 0 {
+		t.Errorf("expected a placeholder for the socket, got %+v", plans)
+	}
+
+	if _, err := BuildPlans([]string{filepath.Join(root, "empty.txt")}, "", PlanPolicy{Empty: FileFail}); err == nil {
+		t.Error("expected an empty file to fail planning")
+	}
+}
+
+func TestBuildPlansStopsAtLimits(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, 10)
+
+	if plans, err := BuildPlans([]string{root}, "", PlanPolicy{MaxFiles: 10, MaxTotalSize: 40}); err != nil || len(plans) != 10 {
+		t.Fatalf("expected 10 plans within the limits, got %d, %v", len(plans), err)
+	}
+	if _, err := BuildPlans([]string{root}, "", PlanPolicy{MaxFiles: 9}); err == nil || !strings.Contains(err.Error(), "more than 9 files") {
+		t.Fatalf("expected file limit error, got %v", err)
+	}
+	if _, err := BuildPlans([]string{root}, "", PlanPolicy{MaxTotalSize: 39}); err == nil || !strings.Contains(err.Error(), "39 bytes") {
+		t.Fatalf("expected total size limit error, got %v", err)
+	}
+
+	plans, errs := StreamPlans(context.Background(), []string{root}, "", PlanPolicy{MaxFiles: 4})
+	count := 0
+	for range plans {
+		count++
+	}
+	if err := <-errs; err == nil || count != 4 {
+		t.Fatalf("expected streaming to stop after 4 plans, got %d, %v", count, err)
+	}
+}
+
+func TestBuildPlansRejectsInvalidKeys(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "report.txt")
+	if err := os.WriteFile(file, []byte("data"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	prefix := strings.Repeat("a", MaxKeyLength-len("/report.txt"))
+	if plans, err := BuildPlans([]string{root}, prefix, PlanPolicy{}); err != nil || len(plans) != 1 {
+		t.Fatalf("expected a key of %d bytes to be planned, got %d, %v", MaxKeyLength, len(plans), err)
+	}
+	_, err := BuildPlans([]string{root}, prefix+"a", PlanPolicy{})
+	if err == nil || !strings.HasPrefix(err.Error(), file+": key too long: ") || !strings.Contains(err.Error(), "1025 bytes") {
+		t.Fatalf("expected a key too long error naming the file, got %v", err)
+	}
+	if _, err := BuildPlans([]string{file}, "bad\xff", PlanPolicy{}); err == nil || !strings.Contains(err.Error(), "not valid UTF-8") {
+		t.Fatalf("expected an invalid UTF-8 error, got %v", err)
+	}
+}
+
+func TestBuildPlansRefusesForbiddenFiles(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"app.bin":          "elf",
+		"certs/server.pem": "key",
+		"config/.env":      "SECRET=1",
+		".ssh/id_rsa.pub":  "ssh-rsa",
+		"docs/readme.md":   "docs",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+	policy := PlanPolicy{Forbidden: []string{"*.pem", "id_rsa*", "*.env", ".env"}}
+
+	_, err := BuildPlans([]string{root}, "releases", policy)
+	if err == nil {
+		t.Fatal("expected forbidden files to fail planning")
+	}
+	for _, want := range []string{"3 files must not", filepath.Join(root, "certs", "server.pem") + ": matches forbidden pattern *.pem", ".ssh", ".env"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to contain %q, got %v", want, err)
+		}
+	}
+
+	// A file mapped to another key is still refused, as is one mapped to a
+	// forbidden key.
+	binary := filepath.Join(root, "app.bin")
+	if _, err := BuildPlans([]string{filepath.Join(root, "certs", "server.pem") + "=cert.txt"}, "", policy); err == nil || !strings.Contains(err.Error(), "1 file must not") {
+		t.Errorf("expected a renamed forbidden file to be refused, got %v", err)
+	}
+	if _, err := BuildPlans([]string{binary + "=keys/id_rsa"}, "", policy); err == nil {
+		t.Error("expected a file mapped to a forbidden key to be refused")
+	}
+
+	plans, err := BuildPlans([]string{binary, filepath.Join(root, "docs")}, "releases", policy)
+	if err != nil || len(plans) != 2 {
+		t.Errorf("expected the allowed files to be planned, got %+v, %v", plans, err)
+	}
+	if err := ValidateForbiddenPattern("[a-"); err == nil {
+		t.Error("expected an invalid pattern to be rejected")
+	}
+}
+
+func TestBuildPlansRefusesOversizedFiles(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, 3)
+	dump := filepath.Join(root, "db.dump")
+	if err := os.WriteFile(dump, make([]byte, 100), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	_, err := BuildPlans([]string{root}, "", PlanPolicy{MaxObjectSize: 99})
+	if err == nil || !strings.Contains(err.Error(), "1 file must not") || !strings.Contains(err.Error(), dump+": 100 bytes, above the maximum object size of 99 bytes") {
+		t.Errorf("expected the dump to be refused, got %v", err)
+	}
+	_, err = BuildPlans([]string{dump, filepath.Join(root, "dir0")}, "", PlanPolicy{MaxObjectSize: 1})
+	if err == nil || !strings.Contains(err.Error(), "2 files must not") {
+		t.Errorf("expected every oversized file to be listed, got %v", err)
+	}
+	if plans, err := BuildPlans([]string{root}, "", PlanPolicy{MaxObjectSize: 100}); err != nil || len(plans) != 4 {
+		t.Errorf("expected files up to the maximum to be planned, got %+v, %v", plans, err)
+	}
+}
+
+func TestBuildPlansMapsSourcesToKeys(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, filepath.Join(root, "docs"), 2)
+	binary := filepath.Join(root, "app.bin")
+	if err := os.WriteFile(binary, []byte("elf"), 0o755); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	odd := filepath.Join(root, "a=b.txt")
+	if err := os.WriteFile(odd, []byte("data"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	plans, err := BuildPlans([]string{
+		binary + "=bin/app-linux-amd64",
+		filepath.Join(root, "docs") + "=/html/",
+		strings.ReplaceAll(odd, "=", `\=`),
+	}, "releases/v1.2.3", PlanPolicy{})
+	if err != nil {
+		t.Fatalf("BuildPlans returned error: %v", err)
+	}
+	var keys []string
+	for _, plan := range plans {
+		keys = append(keys, plan.Key)
+	}
+	want := "releases/v1.2.3/bin/app-linux-amd64 releases/v1.2.3/html/dir0/file0.txt releases/v1.2.3/html/dir1/file1.txt releases/v1.2.3/a=b.txt"
+	if strings.Join(keys, " ") != want {
+		t.Errorf("unexpected keys:\n got %s\nwant %s", strings.Join(keys, " "), want)
+	}
+
+	if _, err := BuildPlans([]string{binary + "=../escape"}, "releases", PlanPolicy{}); err == nil || !strings.Contains(err.Error(), "must not contain '..'") {
+		t.Errorf("expected a key leaving the prefix to be rejected, got %v", err)
+	}
+	if _, err := BuildPlans([]string{binary + "=app", binary + "=app"}, "", PlanPolicy{}); err == nil || !strings.Contains(err.Error(), "duplicate object key") {
+		t.Errorf("expected two sources mapped to one key to be rejected, got %v", err)
+	}
+	if err := CheckSources([]string{binary + "=app"}); err != nil {
+		t.Errorf("expected CheckSources to stat the local path, got %v", err)
+	}
+
+	partition := filepath.Join(root, "events", "dt=2024-01-01")
+	writeTree(t, partition, 1)
+	escaped := strings.ReplaceAll(partition, "=", `\=`)
+	if path, key := ParseSource(escaped + "=events/dt=2024-01-01/"); path != partition || key != "events/dt=2024-01-01/" {
+		t.Errorf("expected an escaped '=' to stay in the path, got %q, %q", path, key)
+	}
+	if path, key := ParseSource(escaped); path != partition || key != "" {
+		t.Errorf("expected an escaped path without a key, got %q, %q", path, key)
+	}
+	if path, key := ParseSource(`C:\builds\dist=web`); path != `C:\builds\dist` || key != "web" {
+		t.Errorf("expected other backslashes to be kept, got %q, %q", path, key)
+	}
+	if err := CheckSources([]string{escaped + "=events/"}); err != nil {
+		t.Errorf("expected CheckSources to stat the unescaped path, got %v", err)
+	}
+
+	plans, err = BuildPlans([]string{
+		SourceUnder(binary, "/bin/"),
+		SourceUnder(filepath.Join(root, "docs"), "web"),
+		SourceUnder(odd, ""),
+		SourceUnder(partition, "partitions"),
+	}, "builds/42", PlanPolicy{})
+	if err != nil {
+		t.Fatalf("BuildPlans returned error: %v", err)
+	}
+	keys = keys[:0]
+	for _, plan := range plans {
+		keys = append(keys, plan.Key)
+	}
+	want = "builds/42/bin/app.bin builds/42/web/dir0/file0.txt builds/42/web/dir1/file1.txt builds/42/a=b.txt builds/42/partitions/dir0/file0.txt"
+	if strings.Join(keys, " ") != want {
+		t.Errorf("unexpected prefixed keys:\n got %s\nwant %s", strings.Join(keys, " "), want)
+	}
+}
+
+func TestBuildPlansStripsComponents(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"index.html", "web/assets/app.js", "web/robots.txt"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	var skipped []string
+	policy := PlanPolicy{StripComponents: 1, Skipped: func(path, reason string) { skipped = append(skipped, path) }}
+	plans, err := BuildPlans([]string{root, filepath.Join(root, "index.html") + "=index.html"}, "site", policy)
+	if err != nil {
+		t.Fatalf("BuildPlans returned error: %v", err)
+	}
+	var keys []string
+	for _, plan := range plans {
+		keys = append(keys, plan.Key)
+	}
+	if want := "site/assets/app.js,site/robots.txt,site/index.html"; strings.Join(keys, ",") != want {
+		t.Errorf("expected %s, got %v", want, keys)
+	}
+	if len(skipped) != 1 || skipped[0] != filepath.Join(root, "index.html") {
+		t.Errorf("expected the top-level file to be skipped, got %v", skipped)
+	}
+
+	if err := os.MkdirAll(filepath.Join(root, "api", "assets"), 0o755); err != nil {
+		t.Fatalf("failed to mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "api", "assets", "app.js"), []byte("data"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if _, err := BuildPlans([]string{root}, "", policy); err == nil || !strings.Contains(err.Error(), "duplicate object key detected: assets/app.js") {
+		t.Errorf("expected stripped keys to collide, got %v", err)
+	}
+}
+
+func TestBuildPlansHonoursMaxDepth(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"top.txt", "a/one.txt", "a/b/two.txt", "a/b/c/three.txt"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	cases := map[int][]string{
+		0: {"a/b/c/three.txt", "a/b/two.txt", "a/one.txt", "top.txt"},
+		1: {"top.txt"},
+		2: {"a/one.txt", "top.txt"},
+	}
+	for depth, want := range cases {
+		plans, err := BuildPlans([]string{root}, "", PlanPolicy{MaxDepth: depth})
+		if err != nil {
+			t.Fatalf("BuildPlans returned error: %v", err)
+		}
+		var keys []string
+		for _, plan := range plans {
+			keys = append(keys, plan.Key)
+		}
+		if strings.Join(keys, ",") != strings.Join(want, ",") {
+			t.Errorf("max depth %d: expected %v, got %v", depth, want, keys)
+		}
+	}
+}
+
+func TestBuildPlansHonoursIgnoreFiles(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".s3ignore":            "*.log\nnode_modules/\n",
+		"app.js":               "code",
+		"debug.log":            "log",
+		"node_modules/dep.js":  "dep",
+		"sub/.dsignore":        "!keep.log\n/local.txt\n",
+		"sub/keep.log":         "log",
+		"sub/other.log":        "log",
+		"sub/local.txt":        "local",
+		"sub/deeper/local.txt": "deep",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	var skipped []string
+	plans, err := BuildPlans([]string{root}, "", PlanPolicy{
+		IgnoreFiles: IgnoreFileNames,
+		Skipped: func(path, reason string) {
+			skipped = append(skipped, reason)
+		},
+	})
+	if err != nil {
+		t.Fatalf("BuildPlans returned error: %v", err)
+	}
+	var keys []string
+	for _, plan := range plans {
+		keys = append(keys, plan.Key)
+	}
+	want := "app.js,sub/deeper/local.txt,sub/keep.log"
+	if strings.Join(keys, ",") != want {
+		t.Errorf("expected %s, got %v", want, keys)
+	}
+	if len(skipped) != 4 {
+		t.Errorf("expected 4 skipped entries, got %v", skipped)
+	}
+
+	plans, err = BuildPlans([]string{root}, "", PlanPolicy{})
+	if err != nil {
+		t.Fatalf("BuildPlans returned error: %v", err)
+	}
+	if len(plans) != len(files) {
+		t.Errorf("expected ignore files to be disabled, got %d plans", len(plans))
+	}
+}
+
+func TestBuildPlansWalksInParallel(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 40; i++ {
+		writeTree(t, filepath.Join(root, fmt.Sprintf("part%02d", i)), 6)
+	}
+	if err := os.WriteFile(filepath.Join(root, ".s3ignore"), []byte("file5.txt\n"), 0o644); err != nil {
+		t.Fatalf("failed to write ignore file: %v", err)
+	}
+
+	sequential, err := BuildPlans([]string{root}, "prefix", PlanPolicy{IgnoreFiles: IgnoreFileNames})
+	if err != nil {
+		t.Fatalf("BuildPlans returned error: %v", err)
+	}
+	parallel, err := BuildPlans([]string{root}, "prefix", PlanPolicy{IgnoreFiles: IgnoreFileNames, WalkConcurrency: 8})
+	if err != nil {
+		t.Fatalf("BuildPlans returned error: %v", err)
+	}
+	if len(sequential) != 200 || len(parallel) != len(sequential) {
+		t.Fatalf("expected 200 plans from both walks, got %d and %d", len(sequential), len(parallel))
+	}
+	for i := range sequential {
+		if sequential[i] != parallel[i] {
+			t.Fatalf("plan %d differs: %+v vs %+v", i, sequential[i], parallel[i])
+		}
+	}
+
+	if _, err := BuildPlans([]string{root}, "", PlanPolicy{WalkConcurrency: 8, MaxFiles: 50}); err == nil {
+		t.Fatal("expected the parallel walk to stop at the file limit")
+	}
+
+	plans, errs := StreamPlans(context.Background(), []string{root}, "", PlanPolicy{WalkConcurrency: 4})
+	count := 0
+	for range plans {
+		count++
+	}
+	if err := <-errs; err != nil || count != 241 {
+		t.Fatalf("expected 241 streamed plans, got %d, %v", count, err)
+	}
+}
+
+func TestUploadSendsPlaceholdersWithoutOpeningSource(t *testing.T) {
+	stub := &stubUploader{}
+	transport := NewTransport(&fakeClient{}, stub, "bucket", true)
+
+	results, err := transport.Upload(context.Background(), []FilePlan{{Source: "/nonexistent/agent.sock", Key: "agent.sock", Placeholder: true}})
+	if err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+	if len(results) != 1 || results[0].Size != 0 || len(stub.uploads) != 1 {
+		t.Fatalf("expected one empty object, got %+v", results)
+	}
+}
@@ -0,0 +1,85 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ErrKeyNotAllowed is returned for puts, copies and deletes of keys outside
+// the allowed prefixes of a Transport; see SetAllowedPrefixes.
+var ErrKeyNotAllowed = errors.New("key outside the allowed prefixes")
+
+// KeyAllowed reports whether key lies within one of prefixes: it equals a
+// prefix or is below it, so that prefix "team-a" allows "team-a/app.tar" but
+// not "team-ab/app.tar". A prefix key is allowed when every key below it is.
+// Without prefixes every key is allowed.
+func KeyAllowed(prefixes []string, key string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if key == prefix || strings.HasPrefix(key, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// SetAllowedPrefixes limits the puts, copies and deletes of the transport to
+// keys within prefixes (see KeyAllowed), whatever prefix an operation was
+// asked to write to. Writes of other keys fail with ErrKeyNotAllowed before
+// they are sent; a batch of deletes fails as a whole. Reads are not limited.
+// No prefixes lift the limit.
+func (t *Transport) SetAllowedPrefixes(prefixes []string) {
+	t.allowedPrefixes = prefixes
+	t.SetBackend(t.base)
+}
+
+// prefixGuardBackend refuses writes outside the allowed prefixes and passes
+// everything else to the wrapped backend.
+type prefixGuardBackend struct {
+	Backend
+	prefixes []string
+}
+
+func (b prefixGuardBackend) check(action, key string) error {
+	if !KeyAllowed(b.prefixes, key) {
+		return fmt.Errorf("refusing to %s %s: %w", action, key, ErrKeyNotAllowed)
+	}
+	return nil
+}
+
+func (b prefixGuardBackend) Put(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error) {
+	if err := b.check("write", aws.ToString(input.Key)); err != nil {
+		return nil, err
+	}
+	return b.Backend.Put(ctx, input, opts...)
+}
+
+func (b prefixGuardBackend) Delete(ctx context.Context, input *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+	for _, object := range input.Delete.Objects {
+		if err := b.check("delete", aws.ToString(object.Key)); err != nil {
+			return nil, err
+		}
+	}
+	return b.Backend.Delete(ctx, input)
+}
+
+func (b prefixGuardBackend) Copy(ctx context.Context, input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	if err := b.check("copy to", aws.ToString(input.Key)); err != nil {
+		return nil, err
+	}
+	return b.Backend.Copy(ctx, input)
+}
+
+// WeakETags reports whether the wrapped backend has weak ETags.
+func (b prefixGuardBackend) WeakETags() bool {
+	weak, ok := b.Backend.(WeakETagBackend)
+	return ok && weak.WeakETags()
+}
@@ -0,0 +1,25 @@
+package uploader
+
+// Progress observes the files a Transport uploads. Its methods are called
+// from the upload workers, concurrently when more than one file is uploaded
+// at a time, and must not block.
+type Progress interface {
+	// FileStarted is called before plan is uploaded.
+	FileStarted(plan FilePlan)
+	// FileDone is called once plan is uploaded, or failed with err.
+	FileDone(plan FilePlan, err error)
+}
+
+// SetProgress reports every file uploaded to progress. Files left out after
+// an earlier failure are not reported. Nil stops reporting.
+func (t *Transport) SetProgress(progress Progress) {
+	t.progress = progress
+}
+
+// SetOnFailure calls stop once the first file of an UploadStream fails. The
+// stream keeps draining its channel, and stop lets the producer, such as a
+// source walk, end early instead of planning files that are left out anyway.
+// Nil calls nothing.
+func (t *Transport) SetOnFailure(stop func()) {
+	t.onFailure = stop
+}
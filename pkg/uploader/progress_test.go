@@ -0,0 +1,54 @@
+package uploader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+)
+
+type recordingProgress struct {
+	mu      sync.Mutex
+	started []string
+	done    map[string]bool
+}
+
+func (r *recordingProgress) FileStarted(plan FilePlan) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started = append(r.started, plan.Key)
+}
+
+func (r *recordingProgress) FileDone(plan FilePlan, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done[plan.Key] = err == nil
+}
+
+func TestUploadReportsProgress(t *testing.T) {
+	dir := t.TempDir()
+	var plans []FilePlan
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		source := filepath.Join(dir, name)
+		if err := os.WriteFile(source, []byte(name), 0o644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		plans = append(plans, FilePlan{Source: source, Key: name, Size: int64(len(name))})
+	}
+	transport := NewTransport(&fakeClient{}, &failingUploader{key: "b.txt"}, "bucket", true)
+	progress := &recordingProgress{done: map[string]bool{}}
+	transport.SetProgress(progress)
+
+	if _, err := transport.Upload(context.Background(), plans); err == nil {
+		t.Fatal("expected the upload of b.txt to fail")
+	}
+	sort.Strings(progress.started)
+	if len(progress.started) != 2 || progress.started[0] != "a.txt" || progress.started[1] != "b.txt" {
+		t.Errorf("expected a.txt and b.txt to be started, got %v", progress.started)
+	}
+	if !progress.done["a.txt"] || progress.done["b.txt"] || len(progress.done) != 2 {
+		t.Errorf("unexpected finished files: %v", progress.done)
+	}
+}
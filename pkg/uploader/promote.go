@@ -0,0 +1,215 @@
+package uploader
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Promote transfer methods reported in PromoteResult.
+const (
+	PromoteCopy   = "copy"
+	PromoteStream = "stream"
+)
+
+// PromoteOptions tunes how Promote moves objects between transports.
+type PromoteOptions struct {
+	// Stream pipes object bodies through the plugin instead of using a
+	// server-side copy. Required when source and destination live behind
+	// different endpoints or credentials.
+	Stream bool
+	// Verify re-reads each destination object and compares it with the source.
+	Verify bool
+}
+
+// PromoteResult describes a single promoted object.
+type PromoteResult struct {
+	Source   string `json:"source"`
+	Key      string `json:"key"`
+	Size     int64  `json:"size"`
+	Method   string `json:"method"`
+	Verified bool   `json:"verified"`
+}
+
+// Promote copies every object under fromPrefix on the source transport that
+// matches its selector to the same relative key under toPrefix on the
+// destination transport.
+func Promote(ctx context.Context, from *Transport, fromPrefix string, to *Transport, toPrefix string, opts PromoteOptions) ([]PromoteResult, error) {
+	source := normalizePrefix(fromPrefix)
+	destination := normalizePrefix(toPrefix)
+	// The listing would pick up the objects just promoted below the source
+	// and promote them again.
+	if from.bucket == to.bucket && withinPrefix(destination, source) {
+		if source == destination {
+			return nil, fmt.Errorf("source and destination must differ")
+		}
+		return nil, fmt.Errorf("destination %q must not be nested in source %q in the same bucket", destination, source)
+	}
+
+	listPrefix := source
+	if listPrefix != "" {
+		listPrefix += "/"
+	}
+
+	results := make([]PromoteResult, 0)
+	err := from.walkObjects(ctx, listPrefix, func(obj s3types.Object) error {
+		key := aws.ToString(obj.Key)
+		if matched, err := from.selected(ctx, key); err != nil || !matched {
+			return err
+		}
+		target := joinKey(destination, strings.TrimPrefix(key, listPrefix))
+
+		result := PromoteResult{Source: key, Key: target, Size: aws.ToInt64(obj.Size), Method: PromoteCopy}
+		if opts.Stream {
+			result.Method = PromoteStream
+			if err := streamObject(ctx, from, key, aws.ToInt64(obj.Size), to, target); err != nil {
+				return err
+			}
+		} else {
+			input := &s3.CopyObjectInput{
+				Bucket:     aws.String(to.bucket),
+				Key:        aws.String(target),
+				CopySource: aws.String(copySource(from.bucket, key, "")),
+				ACL:        to.acl,
+			}
+			to.encryptCopy(input)
+			if !to.overwrite {
+				input.IfNoneMatch = aws.String("*")
+			}
+			if _, err := to.backend.Copy(ctx, input); err != nil {
+				if conditionErr := to.conditionError(target, err); conditionErr != nil {
+					return conditionErr
+				}
+				return fmt.Errorf("failed to copy %s to %s: %w", key, target, err)
+			}
+		}
+
+		// A dry run wrote nothing to compare.
+		if opts.Verify && !to.dryRun {
+			if err := verifyPromoted(ctx, from, to, target, obj); err != nil {
+				return err
+			}
+			result.Verified = true
+		}
+
+		results = append(results, result)
+		return nil
+	})
+
+	return results, err
+}
+
+// withinPrefix reports whether key is prefix itself or lies below it. Every
+// key lies below the empty prefix.
+func withinPrefix(key, prefix string) bool {
+	return prefix == "" || key == prefix || strings.HasPrefix(key, prefix+"/")
+}
+
+func streamObject(ctx context.Context, from *Transport, key string, size int64, to *Transport, target string) error {
+	if to.dryRun {
+		return nil
+	}
+	release, err := to.reserve(ctx, size)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	object, err := from.backend.Get(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(from.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	defer func() {
+		_ = object.Body.Close()
+	}()
+
+	input := &s3.PutObjectInput{
+		Bucket:       aws.String(to.bucket),
+		Key:          aws.String(target),
+		Body:         object.Body,
+		ContentType:  object.ContentType,
+		CacheControl: object.CacheControl,
+		Metadata:     object.Metadata,
+		ACL:          to.acl,
+	}
+	to.encryptPut(input)
+	options := append(to.applyChecksum(input), to.applyConditions(input)...)
+	_, err = to.backend.Put(ctx, input, options...)
+	if err != nil {
+		if conditionErr := to.conditionError(target, err); conditionErr != nil {
+			return conditionErr
+		}
+		return fmt.Errorf("failed to stream %s to %s: %w", key, target, err)
+	}
+	return nil
+}
+
+// verifyPromoted compares the destination object with its source. When both
+// carry a full-object checksum of the same algorithm the checksums are
+// compared. Otherwise ETags are only compared when neither side is a multipart
+// upload, since multipart ETags depend on the part layout rather than the
+// content alone, and neither backend has weak ETags.
+func verifyPromoted(ctx context.Context, from, to *Transport, target string, source s3types.Object) error {
+	head, err := to.backend.Head(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(to.bucket),
+		Key:          aws.String(target),
+		ChecksumMode: s3types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to verify %s: %w", target, err)
+	}
+
+	if want, got := aws.ToInt64(source.Size), aws.ToInt64(head.ContentLength); want != got {
+		return fmt.Errorf("verification failed for %s: expected %d bytes, found %d", target, want, got)
+	}
+
+	if source.ChecksumType == s3types.ChecksumTypeFullObject && head.ChecksumType == s3types.ChecksumTypeFullObject {
+		compared, err := verifyChecksum(ctx, from, aws.ToString(source.Key), target, headChecksums(head))
+		if err != nil || compared {
+			return err
+		}
+	}
+
+	if from.weakETags() || to.weakETags() {
+		return nil
+	}
+	want, got := aws.ToString(source.ETag), aws.ToString(head.ETag)
+	if want != "" && got != "" && !strings.Contains(want, "-") && !strings.Contains(got, "-") && want != got {
+		return fmt.Errorf("verification failed for %s: etag %s does not match source %s", target, got, want)
+	}
+
+	return nil
+}
+
+// verifyChecksum compares the full-object checksum of the source object with
+// the one reported for the destination. It reports whether both sides shared
+// an algorithm to compare.
+func verifyChecksum(ctx context.Context, from *Transport, key, target string, got checksums) (bool, error) {
+	head, err := from.backend.Head(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(from.bucket),
+		Key:          aws.String(key),
+		ChecksumMode: s3types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to read checksum of %s: %w", key, err)
+	}
+
+	for _, want := range headChecksums(head).values() {
+		value := got.get(want.algorithm)
+		if value == "" {
+			continue
+		}
+		if value != aws.ToString(want.value) {
+			return true, fmt.Errorf("verification failed for %s: %s checksum %s does not match source %s", target, want.algorithm, value, aws.ToString(want.value))
+		}
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,195 @@
+package uploader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestPromoteServerSideCopyVerifies(t *testing.T) {
+	source := &fakeClient{
+		listOutputs: []*s3.ListObjectsV2Output{
+			{Contents: []s3types.Object{{Key: aws.String("staging/app.bin"), Size: aws.Int64(4), ETag: aws.String(`"abc"`)}}},
+		},
+	}
+	dest := &fakeClient{
+		headOutputs: map[string]*s3.HeadObjectOutput{
+			"production/app.bin": {ContentLength: aws.Int64(4), ETag: aws.String(`"abc"`)},
+		},
+	}
+
+	from := NewTransport(source, &stubUploader{}, "staging-bucket", true)
+	to := NewTransport(dest, &stubUploader{}, "prod-bucket", true)
+
+	results, err := Promote(context.Background(), from, "staging", to, "production", PromoteOptions{Verify: true})
+	if err != nil {
+		t.Fatalf("Promote returned error: %v", err)
+	}
+	if len(results) != 1 || results[0].Key != "production/app.bin" || !results[0].Verified || results[0].Method != PromoteCopy {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	if len(dest.copyInputs) != 1 || aws.ToString(dest.copyInputs[0].CopySource) != "staging-bucket/staging/app.bin" {
+		t.Fatalf("unexpected copy requests %+v", dest.copyInputs)
+	}
+}
+
+func TestPromoteStreamsAcrossEndpoints(t *testing.T) {
+	source := &fakeClient{
+		listOutputs: []*s3.ListObjectsV2Output{
+			{Contents: []s3types.Object{{Key: aws.String("app.bin"), Size: aws.Int64(4)}}},
+		},
+		objects: map[string]string{"app.bin": "data"},
+	}
+	dest := &fakeClient{}
+	destUploader := &stubUploader{}
+
+	from := NewTransport(source, &stubUploader{}, "bucket", true)
+	to := NewTransport(dest, destUploader, "mirror", true)
+
+	results, err := Promote(context.Background(), from, "", to, "copy", PromoteOptions{Stream: true})
+	if err != nil {
+		t.Fatalf("Promote returned error: %v", err)
+	}
+	if len(results) != 1 || results[0].Method != PromoteStream {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	if len(destUploader.uploads) != 1 || aws.ToString(destUploader.uploads[0].Key) != "copy/app.bin" {
+		t.Fatalf("expected streamed upload to copy/app.bin, got %+v", destUploader.uploads)
+	}
+}
+
+func TestPromoteVerificationDetectsSizeMismatch(t *testing.T) {
+	source := &fakeClient{
+		listOutputs: []*s3.ListObjectsV2Output{
+			{Contents: []s3types.Object{{Key: aws.String("a/app.bin"), Size: aws.Int64(10)}}},
+		},
+	}
+	dest := &fakeClient{
+		headOutputs: map[string]*s3.HeadObjectOutput{"b/app.bin": {ContentLength: aws.Int64(3)}},
+	}
+
+	from := NewTransport(source, &stubUploader{}, "bucket", true)
+	to := NewTransport(dest, &stubUploader{}, "bucket", true)
+
+	if _, err := Promote(context.Background(), from, "a", to, "b", PromoteOptions{Verify: true}); err == nil {
+		t.Fatal("expected verification error")
+	}
+}
+
+func TestPromoteVerificationComparesFullObjectChecksums(t *testing.T) {
+	listing := []*s3.ListObjectsV2Output{
+		{Contents: []s3types.Object{{
+			Key:               aws.String("a/app.bin"),
+			Size:              aws.Int64(4),
+			ETag:              aws.String(`"abc-2"`),
+			ChecksumAlgorithm: []s3types.ChecksumAlgorithm{s3types.ChecksumAlgorithmCrc64nvme},
+			ChecksumType:      s3types.ChecksumTypeFullObject,
+		}}},
+	}
+	sourceHead := &s3.HeadObjectOutput{ContentLength: aws.Int64(4), ChecksumCRC64NVME: aws.String("nvme=="), ChecksumType: s3types.ChecksumTypeFullObject}
+
+	for _, tc := range []struct {
+		name     string
+		checksum string
+		wantErr  bool
+	}{
+		{name: "match", checksum: "nvme=="},
+		{name: "mismatch", checksum: "other==", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			source := &fakeClient{
+				listOutputs: listing,
+				headOutputs: map[string]*s3.HeadObjectOutput{"a/app.bin": sourceHead},
+			}
+			dest := &fakeClient{
+				headOutputs: map[string]*s3.HeadObjectOutput{"b/app.bin": {
+					ContentLength:     aws.Int64(4),
+					ETag:              aws.String(`"def-3"`),
+					ChecksumCRC64NVME: aws.String(tc.checksum),
+					ChecksumType:      s3types.ChecksumTypeFullObject,
+				}},
+			}
+
+			from := NewTransport(source, &stubUploader{}, "bucket", true)
+			to := NewTransport(dest, &stubUploader{}, "bucket", true)
+
+			_, err := Promote(context.Background(), from, "a", to, "b", PromoteOptions{Verify: true})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+type weakETagBackend struct {
+	S3Backend
+}
+
+func (weakETagBackend) WeakETags() bool { return true }
+
+func TestPromoteVerificationSkipsWeakETags(t *testing.T) {
+	source := &fakeClient{
+		listOutputs: []*s3.ListObjectsV2Output{
+			{Contents: []s3types.Object{{Key: aws.String("staging/app.bin"), Size: aws.Int64(4), ETag: aws.String(`"0x8DC1"`)}}},
+		},
+	}
+	dest := &fakeClient{
+		headOutputs: map[string]*s3.HeadObjectOutput{
+			"production/app.bin": {ContentLength: aws.Int64(4), ETag: aws.String(`"0x8DC2"`)},
+		},
+	}
+	destUploader := &stubUploader{}
+
+	from := NewTransport(source, &stubUploader{}, "bucket", true)
+	to := NewTransport(dest, destUploader, "bucket", true, WithBackend(weakETagBackend{S3Backend{Client: dest, Uploader: destUploader}}))
+
+	results, err := Promote(context.Background(), from, "staging", to, "production", PromoteOptions{Verify: true})
+	if err != nil {
+		t.Fatalf("expected equal sizes to verify despite differing ETags, got %v", err)
+	}
+	if len(results) != 1 || !results[0].Verified {
+		t.Fatalf("unexpected results %+v", results)
+	}
+}
+
+func TestPromoteRefusesNestedDestination(t *testing.T) {
+	for _, tc := range []struct {
+		from, to string
+		stream   bool
+	}{
+		{from: "releases", to: "releases"},
+		{from: "releases", to: "releases", stream: true},
+		{from: "releases", to: "releases/prod"},
+		{from: "", to: "prod", stream: true},
+	} {
+		source := &fakeClient{
+			listOutputs: []*s3.ListObjectsV2Output{
+				{Contents: []s3types.Object{{Key: aws.String("releases/app.bin"), Size: aws.Int64(4)}}},
+			},
+		}
+		from := NewTransport(source, &stubUploader{}, "bucket", true)
+		to := NewTransport(&fakeClient{}, &stubUploader{}, "bucket", true)
+
+		if _, err := Promote(context.Background(), from, tc.from, to, tc.to, PromoteOptions{Stream: tc.stream}); err == nil {
+			t.Errorf("%q -> %q: expected the destination to be refused", tc.from, tc.to)
+		}
+		if len(source.listInputs) != 0 {
+			t.Errorf("%q -> %q: expected nothing listed, got %d requests", tc.from, tc.to, len(source.listInputs))
+		}
+	}
+
+	source := &fakeClient{
+		listOutputs: []*s3.ListObjectsV2Output{
+			{Contents: []s3types.Object{{Key: aws.String("releases/prod/app.bin"), Size: aws.Int64(4)}}},
+		},
+	}
+	from := NewTransport(source, &stubUploader{}, "bucket", true)
+	to := NewTransport(source, &stubUploader{}, "bucket", true)
+	results, err := Promote(context.Background(), from, "releases/prod", to, "releases", PromoteOptions{})
+	if err != nil || len(results) != 1 || results[0].Key != "releases/app.bin" {
+		t.Errorf("expected a promotion to the parent prefix, got %+v, %v", results, err)
+	}
+}
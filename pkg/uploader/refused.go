@@ -0,0 +1,48 @@
+package uploader
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ValidateForbiddenPattern reports whether pattern is a valid pattern for
+// PlanPolicy.Forbidden.
+func ValidateForbiddenPattern(pattern string) error {
+	return validatePattern(pattern)
+}
+
+// refusedFile is a file planning refused because of a forbidden pattern or
+// its size.
+type refusedFile struct {
+	source string
+	reason string
+}
+
+// forbidden returns the first forbidden pattern matching any of names, the
+// paths a file is known by, or "" when none does.
+func (p PlanPolicy) forbidden(names ...string) string {
+	for _, pattern := range p.Forbidden {
+		for _, name := range names {
+			if name != "" && matchPattern(pattern, name) {
+				return pattern
+			}
+		}
+	}
+	return ""
+}
+
+// refusedError lists every refused file, so that all of them can be removed
+// or excluded before the next run.
+func refusedError(files []refusedFile) error {
+	sort.Slice(files, func(i, j int) bool { return files[i].source < files[j].source })
+	var listing strings.Builder
+	for _, file := range files {
+		fmt.Fprintf(&listing, "\n  %s: %s", file.source, file.reason)
+	}
+	noun := "files"
+	if len(files) == 1 {
+		noun = "file"
+	}
+	return fmt.Errorf("%d %s must not be uploaded; remove or exclude them:%s", len(files), noun, listing.String())
+}
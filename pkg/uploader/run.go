@@ -0,0 +1,92 @@
+package uploader
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// MetadataRunID is the user metadata key recording the run that uploaded an
+// object.
+const MetadataRunID = "ds-run-id"
+
+// SetRunID records id in the metadata of every uploaded object, so a re-run
+// with the same id can tell which objects it already uploaded.
+func (t *Transport) SetRunID(id string) {
+	t.runID = id
+}
+
+// UploadedByRun reports whether the object of plan was uploaded by the run
+// set with SetRunID from the same file and, if so, describes it as the upload
+// did. The object must have the size of the file and, when it carries the
+// SHA-256 of its content, the file must hash to it; a file that changed
+// since the earlier attempt is uploaded again.
+func (t *Transport) UploadedByRun(ctx context.Context, plan FilePlan) (UploadResult, bool, error) {
+	if t.runID == "" {
+		return UploadResult{}, false, nil
+	}
+	key := plan.Key
+	head, err := t.backend.Head(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(t.bucket),
+		Key:          aws.String(key),
+		ChecksumMode: s3types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return UploadResult{}, false, nil
+		}
+		return UploadResult{}, false, fmt.Errorf("failed to inspect %s: %w", key, err)
+	}
+	if head.Metadata[MetadataRunID] != t.runID {
+		return UploadResult{}, false, nil
+	}
+	same, err := sameContent(plan, head)
+	if err != nil || !same {
+		return UploadResult{}, false, err
+	}
+
+	algorithm, checksum := headChecksums(head).pick(t.checksumAlgorithm)
+	return UploadResult{
+		Key:               key,
+		Size:              aws.ToInt64(head.ContentLength),
+		ETag:              aws.ToString(head.ETag),
+		VersionID:         aws.ToString(head.VersionId),
+		Checksum:          checksum,
+		ChecksumAlgorithm: string(algorithm),
+		ChecksumType:      string(head.ChecksumType),
+		SHA256:            head.Metadata[SHA256MetadataKey],
+		Resumed:           true,
+	}, true, nil
+}
+
+// sameContent reports whether the object described by head holds the file
+// of plan, by its size and, when the object records one, by the SHA-256 of
+// its content: the sha256 metadata or a full-object SHA-256 checksum.
+func sameContent(plan FilePlan, head *s3.HeadObjectOutput) (bool, error) {
+	if plan.Placeholder {
+		return aws.ToInt64(head.ContentLength) == 0, nil
+	}
+	if aws.ToInt64(head.ContentLength) != plan.Size {
+		return false, nil
+	}
+	stored := head.Metadata[SHA256MetadataKey]
+	if stored == "" && head.ChecksumType == s3types.ChecksumTypeFullObject && head.ChecksumSHA256 != nil {
+		raw, err := base64.StdEncoding.DecodeString(aws.ToString(head.ChecksumSHA256))
+		if err == nil {
+			stored = hex.EncodeToString(raw)
+		}
+	}
+	if stored == "" {
+		return true, nil
+	}
+	digest, err := hashFile(plan.Source)
+	if err != nil {
+		return false, fmt.Errorf("failed to hash %s: %w", plan.Source, err)
+	}
+	return digest == stored, nil
+}
@@ -0,0 +1,86 @@
+package uploader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestRunIDStampedAndRecognised(t *testing.T) {
+	stub := &stubUploader{}
+	client := &fakeClient{headOutputs: map[string]*s3.HeadObjectOutput{
+		"done.txt": {
+			ContentLength: aws.Int64(4),
+			ETag:          aws.String(`"abc"`),
+			Metadata:      map[string]string{MetadataRunID: "run-42"},
+		},
+		"other.txt": {
+			Metadata: map[string]string{MetadataRunID: "run-41"},
+		},
+	}}
+	transport := NewTransport(client, stub, "bucket", true)
+	transport.SetObjectAnnotations(map[string]string{"ds-pipeline": "release"}, nil)
+	transport.SetRunID("run-42")
+
+	if _, err := transport.Upload(context.Background(), []FilePlan{{Source: "/nonexistent/agent.sock", Key: "agent.sock", Placeholder: true}}); err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+	metadata := stub.uploads[0].Metadata
+	if metadata[MetadataRunID] != "run-42" || metadata["ds-pipeline"] != "release" {
+		t.Errorf("expected run id next to the annotations, got %v", metadata)
+	}
+
+	result, done, err := transport.UploadedByRun(context.Background(), FilePlan{Key: "done.txt", Size: 4})
+	if err != nil || !done {
+		t.Fatalf("expected done.txt to be recognised, got %v, %v", done, err)
+	}
+	if result.ETag != `"abc"` || !result.Resumed {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if _, done, err := transport.UploadedByRun(context.Background(), FilePlan{Key: "other.txt"}); err != nil || done {
+		t.Errorf("expected an object of another run not to count, got %v, %v", done, err)
+	}
+
+	client.headErr = &stubAPIError{code: "NotFound"}
+	if _, done, err := transport.UploadedByRun(context.Background(), FilePlan{Key: "missing.txt"}); err != nil || done {
+		t.Errorf("expected a missing object not to count, got %v, %v", done, err)
+	}
+}
+
+func TestRunIDNeedsTheSameContent(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "app.js")
+	if err := os.WriteFile(source, []byte("v2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := hashFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &fakeClient{headOutputs: map[string]*s3.HeadObjectOutput{
+		"app.js": {
+			ContentLength: aws.Int64(3),
+			Metadata:      map[string]string{MetadataRunID: "run-42", SHA256MetadataKey: digest},
+		},
+	}}
+	transport := NewTransport(client, &stubUploader{}, "bucket", true)
+	transport.SetRunID("run-42")
+	ctx := context.Background()
+
+	if _, done, err := transport.UploadedByRun(ctx, FilePlan{Source: source, Key: "app.js", Size: 3}); err != nil || !done {
+		t.Errorf("expected the unchanged file to be recognised, got %v, %v", done, err)
+	}
+	if _, done, err := transport.UploadedByRun(ctx, FilePlan{Source: source, Key: "app.js", Size: 4}); err != nil || done {
+		t.Errorf("expected a file of another size to be uploaded again, got %v, %v", done, err)
+	}
+	if err := os.WriteFile(source, []byte("v3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, done, err := transport.UploadedByRun(ctx, FilePlan{Source: source, Key: "app.js", Size: 3}); err != nil || done {
+		t.Errorf("expected a changed file to be uploaded again, got %v, %v", done, err)
+	}
+}
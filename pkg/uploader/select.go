@@ -0,0 +1,65 @@
+package uploader
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Selector picks the objects bulk operations act on by the tags and user
+// metadata they carry, such as the ds-run-id metadata stamped on every upload.
+// An object matches when it carries every given tag and metadata value.
+type Selector struct {
+	Tags     map[string]string `json:"tags,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// IsZero reports whether the selector matches every object.
+func (s Selector) IsZero() bool {
+	return len(s.Tags) == 0 && len(s.Metadata) == 0
+}
+
+// SetSelector restricts List and Promote to objects matching selector. Each
+// listed object then costs a GetObjectTagging request when tags are given and
+// a HeadObject request when metadata is.
+func (t *Transport) SetSelector(selector Selector) {
+	t.selector = selector
+}
+
+// selected reports whether the object at key matches the selector.
+func (t *Transport) selected(ctx context.Context, key string) (bool, error) {
+	if t.selector.IsZero() {
+		return true, nil
+	}
+	if matched, err := t.matchesTags(ctx, key, t.selector.Tags); err != nil || !matched {
+		return false, err
+	}
+	if len(t.selector.Metadata) == 0 {
+		return true, nil
+	}
+
+	head, err := t.backend.Head(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(t.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read metadata of %s: %w", key, err)
+	}
+	// S3 returns user metadata keys in lower case.
+	metadata := make(map[string]string, len(head.Metadata))
+	for name, value := range head.Metadata {
+		metadata[strings.ToLower(name)] = value
+	}
+	for name, value := range t.selector.Metadata {
+		if got, ok := metadata[strings.ToLower(name)]; !ok || got != value {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,75 @@
+package uploader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestListFiltersBySelector(t *testing.T) {
+	client := &fakeClient{
+		listOutputs: []*s3.ListObjectsV2Output{
+			{
+				Contents: []s3types.Object{
+					{Key: aws.String("releases/run-1.tar")},
+					{Key: aws.String("releases/run-2.tar")},
+					{Key: aws.String("releases/untagged.tar")},
+				},
+				CommonPrefixes: []s3types.CommonPrefix{{Prefix: aws.String("releases/v1/")}},
+			},
+		},
+		tags: map[string]map[string]string{
+			"releases/run-1.tar": {"pipeline": "build"},
+			"releases/run-2.tar": {"pipeline": "build"},
+		},
+		headOutputs: map[string]*s3.HeadObjectOutput{
+			"releases/run-1.tar": {Metadata: map[string]string{"ds-run-id": "1"}},
+			"releases/run-2.tar": {Metadata: map[string]string{"ds-run-id": "2"}},
+		},
+	}
+	transport := NewTransport(client, &stubUploader{}, "bucket", true)
+	transport.SetSelector(Selector{Tags: map[string]string{"pipeline": "build"}, Metadata: map[string]string{"DS-Run-Id": "2"}})
+
+	listing, err := transport.List(context.Background(), "releases", "/")
+	if err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+	if len(listing.Objects) != 1 || listing.Objects[0].Key != "releases/run-2.tar" {
+		t.Errorf("expected only the object of run 2, got %+v", listing.Objects)
+	}
+	if len(listing.Prefixes) != 1 {
+		t.Errorf("expected prefixes to be kept, got %v", listing.Prefixes)
+	}
+	// The untagged object is ruled out by its tags without a HEAD request.
+	if len(client.headCalls) != 2 {
+		t.Errorf("expected 2 HEAD requests, got %v", client.headCalls)
+	}
+}
+
+func TestPromoteCopiesSelectedObjects(t *testing.T) {
+	source := &fakeClient{
+		listOutputs: []*s3.ListObjectsV2Output{
+			{Contents: []s3types.Object{
+				{Key: aws.String("staging/app.bin"), Size: aws.Int64(4)},
+				{Key: aws.String("staging/debug.bin"), Size: aws.Int64(4)},
+			}},
+		},
+		tags: map[string]map[string]string{"staging/app.bin": {"release": "true"}},
+	}
+	dest := &fakeClient{}
+
+	from := NewTransport(source, &stubUploader{}, "staging-bucket", true)
+	from.SetSelector(Selector{Tags: map[string]string{"release": "true"}})
+	to := NewTransport(dest, &stubUploader{}, "prod-bucket", true)
+
+	results, err := Promote(context.Background(), from, "staging", to, "production", PromoteOptions{})
+	if err != nil {
+		t.Fatalf("Promote returned error: %v", err)
+	}
+	if len(results) != 1 || results[0].Key != "production/app.bin" || len(dest.copyInputs) != 1 {
+		t.Errorf("expected only the release object to be copied, got %+v", results)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package uploader
+
+import "os"
+
+// AllocatedSize returns the disk space allocated to a file, which is smaller
+// than its size for sparse files. ok is false when the platform does not
+// report it.
+func AllocatedSize(info os.FileInfo) (allocated int64, ok bool) {
+	return 0, false
+}
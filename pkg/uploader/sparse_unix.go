@@ -0,0 +1,20 @@
+//go:build unix
+
+package uploader
+
+import (
+	"os"
+	"syscall"
+)
+
+// AllocatedSize returns the disk space allocated to a file, which is smaller
+// than its size for sparse files. ok is false when the platform does not
+// report it.
+func AllocatedSize(info os.FileInfo) (allocated int64, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	// Blocks are always counted in 512-byte units.
+	return int64(stat.Blocks) * 512, true
+}
@@ -0,0 +1,35 @@
+//go:build unix
+
+package uploader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAllocatedSizeSparseFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "core")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Truncate(256 << 20); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allocated, ok := AllocatedSize(info)
+	if !ok {
+		t.Fatal("expected allocated size on unix")
+	}
+	if allocated >= info.Size()/2 {
+		t.Skipf("file system does not create sparse files (%d of %d bytes allocated)", allocated, info.Size())
+	}
+}
@@ -0,0 +1,134 @@
+package uploader
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// SetExtractTar makes planned tar archives (.tar, .tar.gz, .tgz) upload their
+// entries as individual objects instead of the archive itself. The entries
+// land under the directory the archive's own key would have been in, so an
+// archive at the top of a source ends up unpacked under the context path.
+func (t *Transport) SetExtractTar(enabled bool) {
+	t.extractTar = enabled
+}
+
+// SetTarPolicy applies the Forbidden patterns and MaxObjectSize of policy to
+// the entries of extracted archives, which planning only sees as the archive
+// itself.
+func (t *Transport) SetTarPolicy(policy PlanPolicy) {
+	t.tarPolicy = policy
+}
+
+// IsTarArchive reports whether path names a tar archive by its extension.
+func IsTarArchive(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasSuffix(lower, ".tar") || strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz")
+}
+
+func (t *Transport) uploadArchive(ctx context.Context, plan FilePlan) ([]UploadResult, error) {
+	file, err := os.Open(plan.Source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", plan.Source, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	prefix := ""
+	if i := strings.LastIndex(plan.Key, "/"); i >= 0 {
+		prefix = plan.Key[:i]
+	}
+	return t.UploadTar(ctx, file, prefix, plan.Source, t.tarPolicy)
+}
+
+// UploadTar uploads every regular file of the tar stream r, which may be
+// gzip-compressed, as an object under prefix. Entries are streamed one after
+// another straight from the archive, so nothing is extracted to disk;
+// directories, links and other special entries are skipped. source names the
+// archive in errors and results. Entries matching the Forbidden patterns of
+// policy or larger than its MaxObjectSize are never uploaded: the others are,
+// and the upload then fails listing every refused entry.
+func (t *Transport) UploadTar(ctx context.Context, r io.Reader, prefix, source string, policy PlanPolicy) ([]UploadResult, error) {
+	stream, err := decompress(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive %s: %w", source, err)
+	}
+
+	archive := tar.NewReader(stream)
+	results := make([]UploadResult, 0)
+	var refused []refusedFile
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			if len(refused) > 0 {
+				return results, refusedError(refused)
+			}
+			return results, nil
+		}
+		if err != nil {
+			return results, fmt.Errorf("failed to read archive %s: %w", source, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+header.Name), "/")
+		if name == "" {
+			continue
+		}
+		if pattern := policy.forbidden(name); pattern != "" {
+			refused = append(refused, refusedFile{source: source + ":" + name, reason: "matches forbidden pattern " + pattern})
+			continue
+		}
+		if policy.MaxObjectSize > 0 && header.Size > policy.MaxObjectSize {
+			refused = append(refused, refusedFile{source: source + ":" + name, reason: fmt.Sprintf("%d bytes, above the maximum object size of %d bytes", header.Size, policy.MaxObjectSize)})
+			continue
+		}
+		key := joinKey(prefix, name)
+		if err := ValidateKey(key); err != nil {
+			return results, fmt.Errorf("%s:%s: %w", source, name, err)
+		}
+		result, err := t.uploadEntry(ctx, archive, header.Size, source+":"+name, key)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+}
+
+func (t *Transport) uploadEntry(ctx context.Context, entry io.Reader, size int64, source, key string) (UploadResult, error) {
+	release, err := t.reserve(ctx, size)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	defer release()
+
+	body := bufio.NewReader(entry)
+	contentType := mime.TypeByExtension(strings.ToLower(path.Ext(key)))
+	if contentType == "" {
+		sniff, _ := body.Peek(512)
+		contentType = http.DetectContentType(sniff)
+	}
+	return t.put(ctx, source, key, body, size, contentType, t.metadata)
+}
+
+// decompress transparently unwraps gzip-compressed input.
+func decompress(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(buffered)
+	}
+	return buffered, nil
+}
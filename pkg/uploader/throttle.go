@@ -0,0 +1,236 @@
+package uploader
+
+import (
+	"context"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ThrottleWindow limits uploads during a recurring time of day, such as
+// business hours on a link shared with production traffic.
+type ThrottleWindow struct {
+	// Days are the days the window starts on; empty means every day.
+	Days []time.Weekday
+	// Start and End are times of day as offsets from midnight. A window whose
+	// End is not after its Start ends on the following day.
+	Start time.Duration
+	End   time.Duration
+	// Concurrency caps the files uploaded at once; zero leaves it unchanged.
+	Concurrency int
+	// Bandwidth caps the bytes per second all uploads send together; zero
+	// leaves it unlimited.
+	Bandwidth int64
+}
+
+// Active reports whether the window applies at now, in the location of now.
+func (w ThrottleWindow) Active(now time.Time) bool {
+	offset := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute +
+		time.Duration(now.Second())*time.Second + time.Duration(now.Nanosecond())
+	startsOn := func(day time.Weekday) bool {
+		return len(w.Days) == 0 || slices.Contains(w.Days, day)
+	}
+	if w.Start < w.End {
+		return offset >= w.Start && offset < w.End && startsOn(now.Weekday())
+	}
+	if offset >= w.Start && startsOn(now.Weekday()) {
+		return true
+	}
+	return offset < w.End && startsOn((now.Weekday()+6)%7)
+}
+
+// ThrottleSchedule lists the windows uploads are throttled in, as times of
+// day in Location.
+type ThrottleSchedule struct {
+	Windows []ThrottleWindow
+	// Location is the zone of the windows; nil means the local zone.
+	Location *time.Location
+}
+
+// At returns the first window active at now, if any.
+func (s ThrottleSchedule) At(now time.Time) (ThrottleWindow, bool) {
+	location := s.Location
+	if location == nil {
+		location = time.Local
+	}
+	now = now.In(location)
+	for _, window := range s.Windows {
+		if window.Active(now) {
+			return window, true
+		}
+	}
+	return ThrottleWindow{}, false
+}
+
+// NewThrottle returns a throttle limiting how many files are uploaded at once
+// and how fast while a window of schedule is active; outside of them uploads
+// run at full speed. Limits are looked up again as files start and data is
+// sent, so a long run speeds up or slows down as windows end or begin. An
+// empty schedule returns nil, which throttles nothing.
+func NewThrottle(schedule ThrottleSchedule) *Throttle {
+	if len(schedule.Windows) == 0 {
+		return nil
+	}
+	return newThrottle(schedule, time.Now)
+}
+
+// SetThrottle throttles the uploads of the transport with throttle. A
+// throttle set on several transports, such as those of an upload and its
+// replicas, caps their uploads together. Nil removes the throttle.
+func (t *Transport) SetThrottle(throttle *Throttle) {
+	t.throttle = throttle
+}
+
+// throttleRecheck is how often a file waiting for a concurrency slot checks
+// whether its window has ended.
+const throttleRecheck = 10 * time.Second
+
+// throttleChunk bounds the bytes read at once from a throttled body, so that
+// waits stay short and uploads speed up soon after a window ends.
+const throttleChunk = 256 << 10
+
+// Throttle is shared by the uploads of the transports it is set on: it counts
+// the files in flight against the concurrency of the active window, and
+// meters the bytes they send against its bandwidth with a token bucket
+// holding up to one second of data.
+type Throttle struct {
+	schedule ThrottleSchedule
+	now      func() time.Time
+
+	mu     sync.Mutex
+	active int
+	// released is closed and replaced whenever a file finishes.
+	released chan struct{}
+	tokens   float64
+	filled   time.Time
+}
+
+func newThrottle(schedule ThrottleSchedule, now func() time.Time) *Throttle {
+	return &Throttle{schedule: schedule, now: now, released: make(chan struct{})}
+}
+
+// acquire waits until another file may start uploading.
+func (t *Throttle) acquire(ctx context.Context) error {
+	for {
+		t.mu.Lock()
+		window, _ := t.schedule.At(t.now())
+		if window.Concurrency <= 0 || t.active < window.Concurrency {
+			t.active++
+			t.mu.Unlock()
+			return nil
+		}
+		released := t.released
+		t.mu.Unlock()
+
+		timer := time.NewTimer(throttleRecheck)
+		select {
+		case <-released:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		timer.Stop()
+	}
+}
+
+// release ends a file started with acquire.
+func (t *Throttle) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active--
+	close(t.released)
+	t.released = make(chan struct{})
+}
+
+// wait takes n bytes from the bucket, sleeping while it is in debt.
+func (t *Throttle) wait(ctx context.Context, n int) error {
+	t.mu.Lock()
+	now := t.now()
+	window, _ := t.schedule.At(now)
+	rate := float64(window.Bandwidth)
+	if rate <= 0 {
+		t.filled = time.Time{}
+		t.mu.Unlock()
+		return nil
+	}
+	if t.filled.IsZero() {
+		t.tokens = rate
+	} else {
+		t.tokens = min(rate, t.tokens+now.Sub(t.filled).Seconds()*rate)
+	}
+	t.filled = now
+	t.tokens -= float64(n)
+	debt := -t.tokens
+	t.mu.Unlock()
+
+	if debt <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(time.Duration(debt / rate * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// body wraps an upload body so that reading it is metered. Bodies that can
+// seek and read at offsets keep doing so, which lets the upload manager size
+// multipart uploads.
+func (t *Throttle) body(ctx context.Context, body io.Reader) io.Reader {
+	reader := &throttledReader{ctx: ctx, throttle: t, body: body}
+	if _, ok := body.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		return &throttledReadSeeker{throttledReader: reader}
+	}
+	return reader
+}
+
+type throttledReader struct {
+	ctx      context.Context
+	throttle *Throttle
+	body     io.Reader
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunk {
+		p = p[:throttleChunk]
+	}
+	n, err := r.body.Read(p)
+	if waitErr := r.throttle.wait(r.ctx, n); waitErr != nil && err == nil {
+		err = waitErr
+	}
+	return n, err
+}
+
+type throttledReadSeeker struct {
+	*throttledReader
+}
+
+// ReadAt fills p chunk by chunk, metering each one, so that like any
+// io.ReaderAt it only returns fewer bytes than asked for with an error.
+func (r *throttledReadSeeker) ReadAt(p []byte, off int64) (int, error) {
+	read := 0
+	for read < len(p) {
+		chunk := p[read:min(read+throttleChunk, len(p))]
+		n, err := r.body.(io.ReaderAt).ReadAt(chunk, off+int64(read))
+		read += n
+		if waitErr := r.throttle.wait(r.ctx, n); waitErr != nil && err == nil {
+			err = waitErr
+		}
+		if err != nil {
+			return read, err
+		}
+	}
+	return read, nil
+}
+
+func (r *throttledReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return r.body.(io.Seeker).Seek(offset, whence)
+}
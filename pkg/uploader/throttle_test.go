@@ -0,0 +1,122 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestThrottleWindowActive(t *testing.T) {
+	businessHours := ThrottleWindow{
+		Days:  []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+		Start: 8 * time.Hour,
+		End:   18 * time.Hour,
+	}
+	overnight := ThrottleWindow{Days: []time.Weekday{time.Friday}, Start: 22 * time.Hour, End: 6 * time.Hour}
+
+	// 2026-10-16 is a Friday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, time.UTC)
+	}
+	cases := []struct {
+		window ThrottleWindow
+		now    time.Time
+		active bool
+	}{
+		{businessHours, at(16, 8, 0), true},
+		{businessHours, at(16, 17, 59), true},
+		{businessHours, at(16, 18, 0), false},
+		{businessHours, at(16, 7, 59), false},
+		{businessHours, at(17, 12, 0), false},
+		{overnight, at(16, 23, 0), true},
+		{overnight, at(17, 5, 59), true},
+		{overnight, at(17, 6, 0), false},
+		{overnight, at(17, 23, 0), false},
+		{overnight, at(16, 5, 0), false},
+	}
+	for _, tc := range cases {
+		if got := tc.window.Active(tc.now); got != tc.active {
+			t.Errorf("window %v-%v at %s: active %v, want %v", tc.window.Start, tc.window.End, tc.now.Format(time.RFC1123), got, tc.active)
+		}
+	}
+
+	berlin := time.FixedZone("CEST", 2*60*60)
+	schedule := ThrottleSchedule{Windows: []ThrottleWindow{businessHours}, Location: berlin}
+	if _, ok := schedule.At(at(16, 6, 30)); !ok {
+		t.Error("expected the window to be matched in the location of the schedule")
+	}
+}
+
+func TestThrottleLimitsConcurrency(t *testing.T) {
+	throttle := newThrottle(ThrottleSchedule{Windows: []ThrottleWindow{{Concurrency: 1, Start: 0, End: 24 * time.Hour}}}, time.Now)
+	if err := throttle.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire returned error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := throttle.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a second file to wait for the first, got %v", err)
+	}
+
+	started := make(chan error, 1)
+	go func() { started <- throttle.acquire(context.Background()) }()
+	throttle.release()
+	select {
+	case err := <-started:
+		if err != nil {
+			t.Fatalf("acquire returned error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the waiting file to start once the first finished")
+	}
+}
+
+func TestThrottleLimitsBandwidth(t *testing.T) {
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	schedule := ThrottleSchedule{Windows: []ThrottleWindow{{Bandwidth: 1000, Start: 8 * time.Hour, End: 18 * time.Hour}}, Location: time.UTC}
+	throttle := newThrottle(schedule, clock)
+
+	// The first second of data is sent at once, the rest waits.
+	if err := throttle.wait(context.Background(), 1000); err != nil {
+		t.Fatalf("wait returned error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := throttle.wait(ctx, 500); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected sending beyond the bandwidth to wait, got %v", err)
+	}
+
+	// Outside of the window data is sent at full speed.
+	now = now.Add(10 * time.Hour)
+	if err := throttle.wait(context.Background(), 1<<30); err != nil {
+		t.Fatalf("wait returned error: %v", err)
+	}
+
+	body := throttle.body(context.Background(), bytes.NewReader(make([]byte, throttleChunk*2)))
+	if _, ok := body.(io.Seeker); !ok {
+		t.Error("expected a seekable body to stay seekable")
+	}
+	n, err := body.Read(make([]byte, throttleChunk*2))
+	if err != nil || n != throttleChunk {
+		t.Errorf("expected reads to be bounded to %d bytes, got %d, %v", throttleChunk, n, err)
+	}
+
+	// ReadAt fills the buffer across chunks, and only reads short at the end.
+	data := make([]byte, throttleChunk*2+10)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	at := throttle.body(context.Background(), bytes.NewReader(data)).(io.ReaderAt)
+	buf := make([]byte, throttleChunk*2)
+	if n, err := at.ReadAt(buf, 5); err != nil || n != len(buf) || !bytes.Equal(buf, data[5:5+len(buf)]) {
+		t.Errorf("expected ReadAt to fill %d bytes, got %d, %v", len(buf), n, err)
+	}
+	if n, err := at.ReadAt(buf, throttleChunk+10); !errors.Is(err, io.EOF) || n != throttleChunk {
+		t.Errorf("expected a short ReadAt at the end to return io.EOF, got %d, %v", n, err)
+	}
+}
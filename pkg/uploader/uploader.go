@@ -0,0 +1,622 @@
+// Package uploader is the planning and transfer engine of the ds-s3 plugin.
+// BuildPlans and StreamPlans turn local paths into FilePlans, and a Transport
+// uploads them to a bucket, along with downloads, cleanup, promotion, listing
+// and manifest diffs. Other DS plugins and tools import it to move artifacts
+// the way the plugin does without running it.
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// FilePlan represents a local file scheduled for upload.
+type FilePlan struct {
+	Source string
+	Key    string
+	Size   int64
+	// Placeholder uploads an empty object instead of reading Source, which
+	// is a special file; see PlanPolicy.
+	Placeholder bool
+}
+
+// UploadResult describes an uploaded object returned to the caller.
+// Checksum is the object-level checksum reported by S3; unlike the ETag of a
+// multipart upload it can be verified against the content when ChecksumType is
+// FULL_OBJECT.
+type UploadResult struct {
+	Source            string `json:"source"`
+	Key               string `json:"key"`
+	Size              int64  `json:"size"`
+	ETag              string `json:"etag,omitempty"`
+	VersionID         string `json:"version_id,omitempty"`
+	Checksum          string `json:"checksum,omitempty"`
+	ChecksumAlgorithm string `json:"checksum_algorithm,omitempty"`
+	ChecksumType      string `json:"checksum_type,omitempty"`
+	SHA256            string `json:"sha256,omitempty"`
+	// Resumed marks objects an earlier attempt of the same run uploaded.
+	Resumed bool `json:"resumed,omitempty"`
+}
+
+// Client captures the subset of S3 methods required by Transport.
+type Client interface {
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+	ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	ListMultipartUploads(ctx context.Context, params *s3.ListMultipartUploadsInput, optFns ...func(*s3.Options)) (*s3.ListMultipartUploadsOutput, error)
+	ListParts(ctx context.Context, params *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error)
+	GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error)
+	GetBucketEncryption(ctx context.Context, params *s3.GetBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.GetBucketEncryptionOutput, error)
+	GetBucketOwnershipControls(ctx context.Context, params *s3.GetBucketOwnershipControlsInput, optFns ...func(*s3.Options)) (*s3.GetBucketOwnershipControlsOutput, error)
+}
+
+// ErrNoFiles is returned by Upload and UploadStream when there was nothing to upload.
+var ErrNoFiles = errors.New("no files provided for upload")
+
+// UploadError is returned by UploadStream when a plan failed to upload. It
+// keeps what the run achieved so the remaining plans can be retried.
+type UploadError struct {
+	Err error
+	// Failed lists the plans that failed and those skipped after the first
+	// failure, in the order they were received.
+	Failed []FilePlan
+	// Uploaded lists the objects uploaded before the run stopped.
+	Uploaded []UploadResult
+}
+
+func (e *UploadError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UploadError) Unwrap() error {
+	return e.Err
+}
+
+// Transport coordinates cleanup and upload operations against S3-compatible storage.
+type PutUploader interface {
+	Upload(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error)
+}
+
+type Transport struct {
+	client Client
+	// backend carries the requests S3-compatible stores differ on; see
+	// Backend. It is base, wrapped for dry runs and allowed prefixes.
+	backend     Backend
+	base        Backend
+	bucket      string
+	overwrite   bool
+	budget      *MemoryBudget
+	reservation int64
+	concurrency int
+	metadata    map[string]string
+	tagging     string
+	cleanupTags map[string]string
+	selector    Selector
+	acl         s3types.ObjectCannedACL
+	// dryRun drops writes; see SetDryRun.
+	dryRun bool
+	// allowedPrefixes limits writes; see SetAllowedPrefixes.
+	allowedPrefixes []string
+	// checksumType is sent with multipart uploads; see SetChecksumType.
+	checksumType      s3types.ChecksumType
+	checksumAlgorithm s3types.ChecksumAlgorithm
+	sse               s3types.ServerSideEncryption
+	sseKMSKeyID       string
+	kmsKeyRules       []KMSKeyRule
+	bucketKey         bool
+	ifMatch           string
+	checksumMetadata  bool
+	extractTar        bool
+	tarPolicy         PlanPolicy
+	decompress        bool
+	envelope          Envelope
+	runID             string
+	progress          Progress
+	onFailure         func()
+	// throttle slows uploads down in windows; see SetThrottle.
+	throttle *Throttle
+}
+
+// NewTransport builds a Transport uploading to bucket with uploader, which
+// usually is a manager.Uploader wrapping client (see AbortDetached), through
+// an S3Backend unless an option selects another one. With overwrite unset,
+// keys that already exist are not replaced.
+func NewTransport(client Client, uploader PutUploader, bucket string, overwrite bool, opts ...Option) *Transport {
+	backend := S3Backend{Client: client, Uploader: uploader}
+	t := &Transport{
+		client:    client,
+		backend:   backend,
+		base:      backend,
+		bucket:    bucket,
+		overwrite: overwrite,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// SetMemoryBudget makes every streamed upload, whose parts the upload manager
+// buffers itself, reserve up to reservation bytes from the shared budget for
+// the duration of the transfer. The reservation should cover the part buffers
+// of a single upload (part size times part concurrency plus one). Files are
+// buffered part by part through a BufferPool on the same budget instead.
+func (t *Transport) SetMemoryBudget(budget *MemoryBudget, reservation int64) {
+	t.budget = budget
+	t.reservation = reservation
+}
+
+// SetBackend sends puts, heads, listings, deletes and copies through backend;
+// see NewBackend.
+func (t *Transport) SetBackend(backend Backend) {
+	t.base = backend
+	if t.dryRun {
+		backend = dryRunBackend{Backend: backend}
+	}
+	if len(t.allowedPrefixes) > 0 {
+		backend = prefixGuardBackend{Backend: backend, prefixes: t.allowedPrefixes}
+	}
+	t.backend = backend
+}
+
+// weakETags reports whether the backend's ETags do not identify content; see
+// WeakETagBackend.
+func (t *Transport) weakETags() bool {
+	weak, ok := t.backend.(WeakETagBackend)
+	return ok && weak.WeakETags()
+}
+
+// SetConcurrency sets how many files are uploaded in parallel. Values below one mean one.
+func (t *Transport) SetConcurrency(n int) {
+	t.concurrency = n
+}
+
+// SetObjectAnnotations stamps every uploaded object with the given user
+// metadata and object tags. Nil or empty maps leave objects unannotated.
+func (t *Transport) SetObjectAnnotations(metadata, tags map[string]string) {
+	t.metadata = metadata
+	t.tagging = encodeTags(tags)
+}
+
+// SetCleanupTags restricts Cleanup to objects carrying every given tag, so
+// temporary outputs can be purged without touching other objects under the
+// same prefix. Nil or empty tags remove every object.
+func (t *Transport) SetCleanupTags(tags map[string]string) {
+	t.cleanupTags = tags
+}
+
+// reserve acquires memory for an object of the given size, or the full
+// reservation when the size is unknown (negative).
+func (t *Transport) reserve(ctx context.Context, size int64) (func(), error) {
+	n := t.reservation
+	if size >= 0 && size < n {
+		n = size
+	}
+	acquired, err := t.budget.Acquire(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	return func() { t.budget.Release(acquired) }, nil
+}
+
+// Cleanup removes objects under the provided prefix. An empty prefix clears the
+// bucket. When cleanup tags are set, each listed object's tags are fetched and
+// only matching objects are removed.
+func (t *Transport) Cleanup(ctx context.Context, prefix string) (int, error) {
+	total := 0
+	var token *string
+
+	resolved := normalizePrefix(prefix)
+	if resolved != "" {
+		resolved += "/"
+	}
+
+	for {
+		response, err := t.backend.List(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(t.bucket),
+			Prefix:            stringPointer(resolved),
+			ContinuationToken: token,
+		})
+		if err != nil {
+			return total, fmt.Errorf("failed to list objects for cleanup: %w", err)
+		}
+
+		if len(response.Contents) == 0 {
+			if response.NextContinuationToken == nil {
+				return total, nil
+			}
+			token = response.NextContinuationToken
+			continue
+		}
+
+		batch := make([]s3types.ObjectIdentifier, 0, len(response.Contents))
+		for _, obj := range response.Contents {
+			matched, err := t.matchesTags(ctx, aws.ToString(obj.Key), t.cleanupTags)
+			if err != nil {
+				return total, err
+			}
+			if matched {
+				batch = append(batch, s3types.ObjectIdentifier{Key: obj.Key})
+			}
+		}
+
+		if len(batch) > 0 {
+			_, err = t.backend.Delete(ctx, &s3.DeleteObjectsInput{
+				Bucket: aws.String(t.bucket),
+				Delete: &s3types.Delete{Objects: batch, Quiet: aws.Bool(true)},
+			})
+			if err != nil {
+				return total, fmt.Errorf("failed to delete objects: %w", err)
+			}
+		}
+
+		total += len(batch)
+
+		if response.NextContinuationToken == nil {
+			return total, nil
+		}
+		token = response.NextContinuationToken
+	}
+}
+
+// matchesTags reports whether the object carries every given tag.
+func (t *Transport) matchesTags(ctx context.Context, key string, want map[string]string) (bool, error) {
+	if len(want) == 0 {
+		return true, nil
+	}
+
+	response, err := t.backend.GetTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(t.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read tags of %s: %w", key, err)
+	}
+
+	tags := make(map[string]string, len(response.TagSet))
+	for _, tag := range response.TagSet {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	for key, value := range want {
+		if got, ok := tags[key]; !ok || got != value {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Upload executes the planned transfers.
+func (t *Transport) Upload(ctx context.Context, plans []FilePlan) ([]UploadResult, error) {
+	if len(plans) == 0 {
+		return nil, ErrNoFiles
+	}
+
+	queue := make(chan FilePlan, len(plans))
+	for _, plan := range plans {
+		queue <- plan
+	}
+	close(queue)
+
+	return t.UploadStream(ctx, queue)
+}
+
+// UploadStream uploads plans as they arrive on the channel using the configured
+// number of workers, returning results sorted by key. The channel is always
+// drained, even after a failure, so producers never block. A failure is
+// reported as an *UploadError. With checksum metadata, files are hashed ahead
+// of the workers; see hashAhead.
+func (t *Transport) UploadStream(ctx context.Context, plans <-chan FilePlan) ([]UploadResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := t.concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	var queue <-chan queuedPlan
+	if t.checksumMetadata {
+		queue = t.hashAhead(ctx, plans, workers)
+	} else {
+		queue = enqueue(plans)
+	}
+
+	var (
+		mu       sync.Mutex
+		results  = make([]UploadResult, 0)
+		firstErr error
+		failed   []FilePlan
+		received int
+		wg       sync.WaitGroup
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for plan := range queue {
+				mu.Lock()
+				received++
+				stopped := firstErr != nil
+				if stopped {
+					failed = append(failed, plan.FilePlan)
+				}
+				mu.Unlock()
+				if stopped {
+					continue
+				}
+
+				uploaded, err := t.uploadThrottled(ctx, plan)
+
+				mu.Lock()
+				if err != nil {
+					failed = append(failed, plan.FilePlan)
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+						if t.onFailure != nil {
+							t.onFailure()
+						}
+					}
+				} else {
+					results = append(results, uploaded...)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if received == 0 {
+		return nil, ErrNoFiles
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Key < results[j].Key })
+	if firstErr != nil {
+		return nil, &UploadError{Err: firstErr, Failed: failed, Uploaded: results}
+	}
+	return results, nil
+}
+
+// uploadThrottled uploads plan once the throttle lets another file start,
+// reporting it to the progress observer.
+func (t *Transport) uploadThrottled(ctx context.Context, plan queuedPlan) ([]UploadResult, error) {
+	if t.throttle != nil {
+		if err := t.throttle.acquire(ctx); err != nil {
+			return nil, err
+		}
+		defer t.throttle.release()
+	}
+	if t.progress != nil {
+		t.progress.FileStarted(plan.FilePlan)
+	}
+	uploaded, err := t.uploadPlan(ctx, plan)
+	if t.progress != nil {
+		t.progress.FileDone(plan.FilePlan, err)
+	}
+	return uploaded, err
+}
+
+// uploadPlan uploads the planned file, or the entries of a tar archive when
+// archive extraction is enabled.
+func (t *Transport) uploadPlan(ctx context.Context, plan queuedPlan) ([]UploadResult, error) {
+	if plan.Placeholder {
+		result, err := t.put(ctx, plan.Source, plan.Key, strings.NewReader(""), 0, "application/octet-stream", t.metadata)
+		if err != nil {
+			return nil, err
+		}
+		return []UploadResult{result}, nil
+	}
+	if t.extractTar && IsTarArchive(plan.Source) {
+		return t.uploadArchive(ctx, plan.FilePlan)
+	}
+	result, err := t.uploadOne(ctx, plan)
+	if err != nil {
+		return nil, err
+	}
+	return []UploadResult{result}, nil
+}
+
+func (t *Transport) uploadOne(ctx context.Context, plan queuedPlan) (UploadResult, error) {
+	file, err := os.Open(plan.Source)
+	if err != nil {
+		return UploadResult{}, fmt.Errorf("failed to open %s: %w", plan.Source, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	contentType := detectContentType(plan.Source, file)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return UploadResult{}, fmt.Errorf("failed to rewind %s: %w", plan.Source, err)
+	}
+
+	metadata := t.metadata
+	digest := plan.digest
+	if t.checksumMetadata {
+		if plan.hashErr != nil {
+			return UploadResult{}, fmt.Errorf("failed to checksum %s: %w", plan.Source, plan.hashErr)
+		}
+		if digest == "" {
+			if digest, err = fileSHA256(file); err != nil {
+				return UploadResult{}, fmt.Errorf("failed to checksum %s: %w", plan.Source, err)
+			}
+		}
+		metadata = withMetadata(t.metadata, SHA256MetadataKey, digest)
+	}
+
+	// Files are read part by part into the buffers of the manager's
+	// BufferPool; sealed files become streams the manager buffers itself.
+	if t.envelope != nil {
+		release, err := t.reserve(ctx, plan.Size)
+		if err != nil {
+			return UploadResult{}, err
+		}
+		defer release()
+	}
+
+	result, err := t.put(ctx, plan.Source, plan.Key, file, plan.Size, contentType, metadata)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	result.SHA256 = digest
+	return result, nil
+}
+
+// put uploads body to key with the transport's annotations, client-side and
+// server-side encryption, checksum and write conditions applied.
+func (t *Transport) put(ctx context.Context, source, key string, body io.Reader, size int64, contentType string, metadata map[string]string) (UploadResult, error) {
+	if t.runID != "" {
+		metadata = withMetadata(metadata, MetadataRunID, t.runID)
+	}
+	body, metadata, err := t.seal(ctx, source, body, size, metadata)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	if t.throttle != nil {
+		body = t.throttle.body(ctx, body)
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(t.bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: stringPointer(contentType),
+		Metadata:    metadata,
+		Tagging:     stringPointer(t.tagging),
+		ACL:         t.acl,
+	}
+	t.encryptPut(input)
+	options := append(t.applyChecksum(input), t.applyConditions(input)...)
+	output, err := t.backend.Put(ctx, input, options...)
+	if err != nil {
+		if conditionErr := t.conditionError(key, err); conditionErr != nil {
+			return UploadResult{}, conditionErr
+		}
+		return UploadResult{}, fmt.Errorf("failed to upload %s to %s: %w", source, key, err)
+	}
+
+	algorithm, checksum := uploadChecksums(output).pick(input.ChecksumAlgorithm)
+	return UploadResult{
+		Source:            source,
+		Key:               key,
+		Size:              size,
+		ETag:              aws.ToString(output.ETag),
+		VersionID:         aws.ToString(output.VersionID),
+		Checksum:          checksum,
+		ChecksumAlgorithm: string(algorithm),
+		ChecksumType:      string(output.ChecksumType),
+	}, nil
+}
+
+func isNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var nf *s3types.NotFound
+	if errors.As(err, &nf) {
+		return true
+	}
+
+	var ns *s3types.NoSuchKey
+	if errors.As(err, &ns) {
+		return true
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch strings.ToLower(apiErr.ErrorCode()) {
+		case "notfound", "nosuchkey", "404", "no such key":
+			return true
+		}
+	}
+
+	return false
+}
+
+func detectContentType(path string, file *os.File) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != "" {
+		if value := mime.TypeByExtension(ext); value != "" {
+			return value
+		}
+	}
+
+	buffer := make([]byte, 512)
+	n, err := file.Read(buffer)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return ""
+	}
+	return http.DetectContentType(buffer[:n])
+}
+
+// encodeTags renders tags in the URL query form expected by PutObject.
+func encodeTags(tags map[string]string) string {
+	values := url.Values{}
+	for key, value := range tags {
+		values.Set(key, value)
+	}
+	return values.Encode()
+}
+
+func normalizePrefix(prefix string) string {
+	trimmed := strings.TrimSpace(prefix)
+	return strings.Trim(trimmed, "/")
+}
+
+// MaxKeyLength is the longest object key S3 accepts, in bytes of UTF-8.
+const MaxKeyLength = 1024
+
+// ValidateKey checks key against the limits S3 puts on object keys, so that
+// planning rejects a key before S3 does midway through an upload.
+func ValidateKey(key string) error {
+	if !utf8.ValidString(key) {
+		return fmt.Errorf("key is not valid UTF-8: %q", key)
+	}
+	if len(key) > MaxKeyLength {
+		return fmt.Errorf("key too long: %s (%d bytes, S3 allows at most %d)", key, len(key), MaxKeyLength)
+	}
+	return nil
+}
+
+func joinKey(prefix, rel string) string {
+	rel = strings.TrimSpace(rel)
+	rel = strings.Trim(rel, "/")
+	if rel == "" {
+		return prefix
+	}
+	if prefix == "" {
+		return rel
+	}
+	return prefix + "/" + rel
+}
+
+func stringPointer(value string) *string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	return aws.String(value)
+}
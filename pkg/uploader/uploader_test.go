@@ -0,0 +1,406 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+type fakeClient struct {
+	headErr       error
+	headCalls     []string
+	listOutputs   []*s3.ListObjectsV2Output
+	listInputs    []*s3.ListObjectsV2Input
+	deleteInputs  []*s3.DeleteObjectsInput
+	listCallIndex int
+
+	versionOutputs   []*s3.ListObjectVersionsOutput
+	versionCallIndex int
+	copyInputs       []*s3.CopyObjectInput
+	objects          map[string]string
+	encodings        map[string]string
+	objectMetadata   map[string]map[string]string
+	headOutputs      map[string]*s3.HeadObjectOutput
+
+	multipartOutputs   []*s3.ListMultipartUploadsOutput
+	multipartCallIndex int
+	parts              map[string][]*s3.ListPartsOutput
+	tags               map[string]map[string]string
+	bucketEncryption   s3types.ServerSideEncryption
+	bucketOwnership    s3types.ObjectOwnership
+}
+
+func (f *fakeClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	f.headCalls = append(f.headCalls, aws.ToString(params.Key))
+	if f.headErr != nil {
+		return nil, f.headErr
+	}
+	if out, ok := f.headOutputs[aws.ToString(params.Key)]; ok {
+		return out, nil
+	}
+	return &s3.HeadObjectOutput{}, nil
+}
+
+func (f *fakeClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	f.listInputs = append(f.listInputs, params)
+	if f.listCallIndex >= len(f.listOutputs) {
+		return &s3.ListObjectsV2Output{}, nil
+	}
+	out := f.listOutputs[f.listCallIndex]
+	f.listCallIndex++
+	return out, nil
+}
+
+func (f *fakeClient) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	f.deleteInputs = append(f.deleteInputs, params)
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func (f *fakeClient) ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	if f.versionCallIndex >= len(f.versionOutputs) {
+		return &s3.ListObjectVersionsOutput{}, nil
+	}
+	out := f.versionOutputs[f.versionCallIndex]
+	f.versionCallIndex++
+	return out, nil
+}
+
+func (f *fakeClient) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	f.copyInputs = append(f.copyInputs, params)
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (f *fakeClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	body, ok := f.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &stubAPIError{code: "NoSuchKey"}
+	}
+	return &s3.GetObjectOutput{
+		Body:            io.NopCloser(strings.NewReader(body)),
+		ContentEncoding: stringPointer(f.encodings[aws.ToString(params.Key)]),
+		Metadata:        f.objectMetadata[aws.ToString(params.Key)],
+	}, nil
+}
+
+func (f *fakeClient) ListMultipartUploads(ctx context.Context, params *s3.ListMultipartUploadsInput, optFns ...func(*s3.Options)) (*s3.ListMultipartUploadsOutput, error) {
+	if f.multipartCallIndex >= len(f.multipartOutputs) {
+		return &s3.ListMultipartUploadsOutput{}, nil
+	}
+	out := f.multipartOutputs[f.multipartCallIndex]
+	f.multipartCallIndex++
+	return out, nil
+}
+
+func (f *fakeClient) ListParts(ctx context.Context, params *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error) {
+	pages, ok := f.parts[aws.ToString(params.UploadId)]
+	if !ok {
+		return nil, &stubAPIError{code: "NoSuchUpload"}
+	}
+	page := 0
+	if params.PartNumberMarker != nil {
+		page, _ = strconv.Atoi(aws.ToString(params.PartNumberMarker))
+	}
+	return pages[page], nil
+}
+
+func (f *fakeClient) GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	out := &s3.GetObjectTaggingOutput{}
+	for key, value := range f.tags[aws.ToString(params.Key)] {
+		out.TagSet = append(out.TagSet, s3types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	return out, nil
+}
+
+func (f *fakeClient) GetBucketOwnershipControls(ctx context.Context, params *s3.GetBucketOwnershipControlsInput, optFns ...func(*s3.Options)) (*s3.GetBucketOwnershipControlsOutput, error) {
+	if f.bucketOwnership == "" {
+		return nil, &stubAPIError{code: "OwnershipControlsNotFoundError"}
+	}
+	return &s3.GetBucketOwnershipControlsOutput{
+		OwnershipControls: &s3types.OwnershipControls{
+			Rules: []s3types.OwnershipControlsRule{{ObjectOwnership: f.bucketOwnership}},
+		},
+	}, nil
+}
+
+func (f *fakeClient) GetBucketEncryption(ctx context.Context, params *s3.GetBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.GetBucketEncryptionOutput, error) {
+	if f.bucketEncryption == "" {
+		return nil, &stubAPIError{code: "ServerSideEncryptionConfigurationNotFoundError"}
+	}
+	return &s3.GetBucketEncryptionOutput{
+		ServerSideEncryptionConfiguration: &s3types.ServerSideEncryptionConfiguration{
+			Rules: []s3types.ServerSideEncryptionRule{{
+				ApplyServerSideEncryptionByDefault: &s3types.ServerSideEncryptionByDefault{SSEAlgorithm: f.bucketEncryption},
+			}},
+		},
+	}, nil
+}
+
+type stubUploader struct {
+	mu      sync.Mutex
+	uploads []*s3.PutObjectInput
+	options [][]func(*manager.Uploader)
+	output  *manager.UploadOutput
+	err     error
+}
+
+func (s *stubUploader) Upload(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*manager.Uploader)) (*manager.UploadOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uploads = append(s.uploads, input)
+	s.options = append(s.options, optFns)
+	if s.err != nil {
+		return nil, s.err
+	}
+	if s.output != nil {
+		return s.output, nil
+	}
+	return &manager.UploadOutput{ETag: aws.String("etag")}, nil
+}
+
+func TestBuildPlansIncludesDirectories(t *testing.T) {
+	tmpDir := t.TempDir()
+	subDir := filepath.Join(tmpDir, "nested")
+	if err := os.Mkdir(subDir, 0o755); err != nil {
+		t.Fatalf("failed to mkdir: %v", err)
+	}
+
+	filePath := filepath.Join(subDir, "data.txt")
+	if err := os.WriteFile(filePath, []byte("hello"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	plans, err := BuildPlans([]string{subDir}, "artifact", PlanPolicy{})
+	if err != nil {
+		t.Fatalf("BuildPlans returned error: %v", err)
+	}
+
+	if len(plans) != 1 {
+		t.Fatalf("expected 1 plan, got %d", len(plans))
+	}
+
+	if plans[0].Key != "artifact/data.txt" {
+		t.Errorf("unexpected key %s", plans[0].Key)
+	}
+}
+
+func TestTransportUploadNoOverwrite(t *testing.T) {
+	uploader := &stubUploader{err: &stubAPIError{code: "PreconditionFailed"}}
+	transport := NewTransport(&fakeClient{}, uploader, "bucket", false)
+
+	tmpFile, err := os.CreateTemp(t.TempDir(), "test-*.txt")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	defer func() {
+		_ = tmpFile.Close()
+	}()
+
+	plans := []FilePlan{{Source: tmpFile.Name(), Key: "existing.txt", Size: 1}}
+
+	_, err = transport.Upload(context.Background(), plans)
+	if err == nil || !strings.Contains(err.Error(), "already exists and overwrite is disabled") {
+		t.Fatalf("expected existing object error when overwrite disabled, got %v", err)
+	}
+}
+
+func TestTransportUploadAllowsMissingObject(t *testing.T) {
+	client := &fakeClient{}
+	uploader := &stubUploader{}
+	transport := NewTransport(client, uploader, "bucket", false)
+
+	tmpFile, err := os.CreateTemp(t.TempDir(), "test-*.txt")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	defer func() {
+		_ = tmpFile.Close()
+	}()
+
+	if _, err := tmpFile.WriteString("hello"); err != nil {
+		t.Fatalf("failed to write temp file: %v", err)
+	}
+
+	plans := []FilePlan{{Source: tmpFile.Name(), Key: "new.txt", Size: 5}}
+
+	res, err := transport.Upload(context.Background(), plans)
+	if err != nil {
+		t.Fatalf("expected upload to succeed, got error: %v", err)
+	}
+
+	if len(res) != 1 {
+		t.Fatalf("expected 1 upload result, got %d", len(res))
+	}
+	if got := aws.ToString(uploader.uploads[0].IfNoneMatch); got != "*" {
+		t.Errorf("expected conditional write with If-None-Match *, got %q", got)
+	}
+	if len(client.headCalls) != 0 {
+		t.Errorf("expected no HeadObject existence check, got %d", len(client.headCalls))
+	}
+}
+
+func TestTransportUploadStampsAnnotations(t *testing.T) {
+	uploader := &stubUploader{}
+	transport := NewTransport(&fakeClient{}, uploader, "bucket", true)
+	transport.SetObjectAnnotations(
+		map[string]string{"ds-run-id": "42"},
+		map[string]string{"ds-pipeline": "release build", "ds-run-id": "42"},
+	)
+
+	source := filepath.Join(t.TempDir(), "app.txt")
+	if err := os.WriteFile(source, []byte("hello"), 0o600); err != nil {
+		t.Fatalf("failed to write temp file: %v", err)
+	}
+
+	if _, err := transport.Upload(context.Background(), []FilePlan{{Source: source, Key: "app.txt", Size: 5}}); err != nil {
+		t.Fatalf("expected upload to succeed, got error: %v", err)
+	}
+
+	input := uploader.uploads[0]
+	if input.Metadata["ds-run-id"] != "42" {
+		t.Errorf("unexpected metadata: %v", input.Metadata)
+	}
+	if got := aws.ToString(input.Tagging); got != "ds-pipeline=release+build&ds-run-id=42" {
+		t.Errorf("unexpected tagging: %q", got)
+	}
+}
+
+func TestTransportCleanupDeletesObjects(t *testing.T) {
+	client := &fakeClient{
+		listOutputs: []*s3.ListObjectsV2Output{
+			{
+				Contents:              []s3types.Object{{Key: aws.String("prefix/file1")}, {Key: aws.String("prefix/file2")}},
+				NextContinuationToken: nil,
+			},
+		},
+	}
+	transport := NewTransport(client, &stubUploader{}, "bucket", true)
+
+	deleted, err := transport.Cleanup(context.Background(), "prefix")
+	if err != nil {
+		t.Fatalf("cleanup returned error: %v", err)
+	}
+	if deleted != 2 {
+		t.Fatalf("expected 2 deleted objects, got %d", deleted)
+	}
+	if len(client.deleteInputs) != 1 {
+		t.Fatalf("expected 1 delete request, got %d", len(client.deleteInputs))
+	}
+}
+
+func TestTransportCleanupFiltersByTags(t *testing.T) {
+	client := &fakeClient{
+		listOutputs: []*s3.ListObjectsV2Output{
+			{
+				Contents: []s3types.Object{
+					{Key: aws.String("prefix/tmp.log")},
+					{Key: aws.String("prefix/release.tar")},
+					{Key: aws.String("prefix/other.log")},
+				},
+			},
+		},
+		tags: map[string]map[string]string{
+			"prefix/tmp.log":     {"ephemeral": "true", "team": "ci"},
+			"prefix/release.tar": {"ephemeral": "false"},
+		},
+	}
+	transport := NewTransport(client, &stubUploader{}, "bucket", true)
+	transport.SetCleanupTags(map[string]string{"ephemeral": "true"})
+
+	deleted, err := transport.Cleanup(context.Background(), "prefix")
+	if err != nil {
+		t.Fatalf("cleanup returned error: %v", err)
+	}
+	if deleted != 1 {
+		t.Fatalf("expected 1 deleted object, got %d", deleted)
+	}
+	objects := client.deleteInputs[0].Delete.Objects
+	if len(objects) != 1 || aws.ToString(objects[0].Key) != "prefix/tmp.log" {
+		t.Errorf("expected only the ephemeral object to be deleted, got %+v", objects)
+	}
+}
+
+func TestBuildPlansRejectsDuplicates(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "data.txt")
+	if err := os.WriteFile(file, []byte("one"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	plans, err := BuildPlans([]string{file, file}, "", PlanPolicy{})
+	if err == nil {
+		t.Fatal("expected duplicate detection error")
+	}
+	if plans != nil {
+		t.Fatalf("expected nil plans on error")
+	}
+}
+
+// failingUploader fails the uploads of one key.
+type failingUploader struct {
+	stubUploader
+	key string
+}
+
+func (f *failingUploader) Upload(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*manager.Uploader)) (*manager.UploadOutput, error) {
+	if aws.ToString(input.Key) == f.key {
+		return nil, &stubAPIError{code: "InternalError"}
+	}
+	return f.stubUploader.Upload(ctx, input, optFns...)
+}
+
+func TestUploadReportsFailedPlans(t *testing.T) {
+	dir := t.TempDir()
+	var plans []FilePlan
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		source := filepath.Join(dir, name)
+		if err := os.WriteFile(source, []byte(name), 0o644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		plans = append(plans, FilePlan{Source: source, Key: name, Size: int64(len(name))})
+	}
+	transport := NewTransport(&fakeClient{}, &failingUploader{key: "b.txt"}, "bucket", true)
+
+	_, err := transport.Upload(context.Background(), plans)
+	var uploadErr *UploadError
+	if !errors.As(err, &uploadErr) {
+		t.Fatalf("expected UploadError, got %v", err)
+	}
+	if len(uploadErr.Uploaded) != 1 || uploadErr.Uploaded[0].Key != "a.txt" {
+		t.Errorf("expected a.txt to be reported as uploaded, got %+v", uploadErr.Uploaded)
+	}
+	if len(uploadErr.Failed) != 2 || uploadErr.Failed[0].Key != "b.txt" || uploadErr.Failed[1].Key != "c.txt" {
+		t.Errorf("expected the failed and skipped plans, got %+v", uploadErr.Failed)
+	}
+}
+
+type stubAPIError struct {
+	code string
+}
+
+func (s *stubAPIError) Error() string {
+	return s.code
+}
+
+func (s *stubAPIError) ErrorCode() string {
+	return s.code
+}
+
+func (s *stubAPIError) ErrorMessage() string {
+	return s.code
+}
+
+func (s *stubAPIError) ErrorFault() smithy.ErrorFault {
+	return smithy.FaultClient
+}
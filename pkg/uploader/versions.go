@@ -0,0 +1,266 @@
+package uploader
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ObjectVersion describes a single version or delete marker of an object.
+type ObjectVersion struct {
+	Key          string    `json:"key"`
+	VersionID    string    `json:"version_id"`
+	IsLatest     bool      `json:"is_latest"`
+	DeleteMarker bool      `json:"delete_marker,omitempty"`
+	Size         int64     `json:"size,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// RollbackResult describes the action taken for a single key during rollback.
+type RollbackResult struct {
+	Key         string `json:"key"`
+	Action      string `json:"action"`
+	FromVersion string `json:"from_version,omitempty"`
+	ToVersion   string `json:"to_version,omitempty"`
+}
+
+// Rollback actions reported in RollbackResult.
+const (
+	RollbackRestored = "restored"
+	RollbackDeleted  = "deleted"
+	RollbackSkipped  = "skipped"
+)
+
+// ListVersions returns every version and delete marker under the prefix, newest first per key.
+func (t *Transport) ListVersions(ctx context.Context, prefix string) ([]ObjectVersion, error) {
+	resolved := normalizePrefix(prefix)
+	if resolved != "" {
+		resolved += "/"
+	}
+
+	versions := make([]ObjectVersion, 0)
+	var keyMarker, versionMarker *string
+
+	for {
+		response, err := t.backend.ListVersions(ctx, &s3.ListObjectVersionsInput{
+			Bucket:          aws.String(t.bucket),
+			Prefix:          stringPointer(resolved),
+			KeyMarker:       keyMarker,
+			VersionIdMarker: versionMarker,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list object versions: %w", err)
+		}
+
+		for _, v := range response.Versions {
+			versions = append(versions, ObjectVersion{
+				Key:          aws.ToString(v.Key),
+				VersionID:    aws.ToString(v.VersionId),
+				IsLatest:     aws.ToBool(v.IsLatest),
+				Size:         aws.ToInt64(v.Size),
+				ETag:         aws.ToString(v.ETag),
+				LastModified: aws.ToTime(v.LastModified),
+			})
+		}
+		for _, m := range response.DeleteMarkers {
+			versions = append(versions, ObjectVersion{
+				Key:          aws.ToString(m.Key),
+				VersionID:    aws.ToString(m.VersionId),
+				IsLatest:     aws.ToBool(m.IsLatest),
+				DeleteMarker: true,
+				LastModified: aws.ToTime(m.LastModified),
+			})
+		}
+
+		if !aws.ToBool(response.IsTruncated) {
+			break
+		}
+		keyMarker = response.NextKeyMarker
+		versionMarker = response.NextVersionIdMarker
+	}
+
+	return versions, nil
+}
+
+// VersionHistory returns every version and delete marker under the prefix
+// ordered by key, newest first within each key.
+func (t *Transport) VersionHistory(ctx context.Context, prefix string) ([]ObjectVersion, error) {
+	versions, err := t.ListVersions(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	history := groupVersions(versions)
+	keys := make([]string, 0, len(history))
+	for key := range history {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	ordered := make([]ObjectVersion, 0, len(versions))
+	for _, key := range keys {
+		ordered = append(ordered, history[key]...)
+	}
+	return ordered, nil
+}
+
+// RollbackOptions tunes which keys Rollback touches.
+type RollbackOptions struct {
+	// Targets maps keys to the exact version IDs that should become current
+	// instead of the previous ones. Only those keys are touched.
+	Targets map[string]string
+	// Replaced maps keys to the version an earlier rollback replaced. A key
+	// whose previous version is still that one has not changed since and is
+	// skipped, so repeating a rollback does not undo it.
+	Replaced map[string]string
+	// Skip lists keys left alone, such as the record of earlier rollbacks.
+	Skip []string
+}
+
+// Rollback restores every key under the prefix to its previous version. Keys
+// whose previous state was absent are deleted.
+func (t *Transport) Rollback(ctx context.Context, prefix string, opts RollbackOptions) ([]RollbackResult, error) {
+	versions, err := t.ListVersions(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	history := groupVersions(versions)
+
+	keys := make([]string, 0, len(history))
+	if len(opts.Targets) > 0 {
+		for key := range opts.Targets {
+			keys = append(keys, key)
+		}
+	} else {
+		for key := range history {
+			keys = append(keys, key)
+		}
+	}
+	keys = slices.DeleteFunc(keys, func(key string) bool {
+		return slices.Contains(opts.Skip, key)
+	})
+	sort.Strings(keys)
+
+	results := make([]RollbackResult, 0, len(keys))
+	for _, key := range keys {
+		entries := history[key]
+		if len(entries) == 0 {
+			return results, fmt.Errorf("no versions found for %s", key)
+		}
+		current := entries[0]
+
+		if replaced, ok := opts.Replaced[key]; ok && len(entries) > 1 && entries[1].VersionID == replaced {
+			results = append(results, RollbackResult{Key: key, Action: RollbackSkipped, FromVersion: current.VersionID})
+			continue
+		}
+
+		var restore *ObjectVersion
+		if want, ok := opts.Targets[key]; ok {
+			for i := range entries {
+				if entries[i].VersionID == want && !entries[i].DeleteMarker {
+					restore = &entries[i]
+					break
+				}
+			}
+			if restore == nil {
+				return results, fmt.Errorf("version %s of %s not found", want, key)
+			}
+		} else if len(entries) > 1 && !entries[1].DeleteMarker {
+			restore = &entries[1]
+		}
+
+		if restore == nil {
+			if current.DeleteMarker {
+				results = append(results, RollbackResult{Key: key, Action: RollbackSkipped, FromVersion: current.VersionID})
+				continue
+			}
+			if err := t.deleteKey(ctx, key); err != nil {
+				return results, err
+			}
+			results = append(results, RollbackResult{Key: key, Action: RollbackDeleted, FromVersion: current.VersionID})
+			continue
+		}
+
+		if restore.VersionID == current.VersionID {
+			results = append(results, RollbackResult{Key: key, Action: RollbackSkipped, FromVersion: current.VersionID, ToVersion: restore.VersionID})
+			continue
+		}
+
+		input := &s3.CopyObjectInput{
+			Bucket:     aws.String(t.bucket),
+			Key:        aws.String(key),
+			CopySource: aws.String(copySource(t.bucket, key, restore.VersionID)),
+			ACL:        t.acl,
+		}
+		t.encryptCopy(input)
+		if _, err := t.backend.Copy(ctx, input); err != nil {
+			return results, fmt.Errorf("failed to restore %s to version %s: %w", key, restore.VersionID, err)
+		}
+
+		results = append(results, RollbackResult{Key: key, Action: RollbackRestored, FromVersion: current.VersionID, ToVersion: restore.VersionID})
+	}
+
+	return results, nil
+}
+
+func (t *Transport) deleteKey(ctx context.Context, key string) error {
+	_, err := t.backend.Delete(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(t.bucket),
+		Delete: &s3types.Delete{
+			Objects: []s3types.ObjectIdentifier{{Key: aws.String(key)}},
+			Quiet:   aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+// groupVersions buckets versions by key, newest first. S3 returns versions and
+// delete markers in separate lists, so ordering is restored from the latest
+// flag and modification time once the two are merged.
+func groupVersions(versions []ObjectVersion) map[string][]ObjectVersion {
+	history := make(map[string][]ObjectVersion)
+	for _, v := range versions {
+		history[v.Key] = append(history[v.Key], v)
+	}
+	for key, entries := range history {
+		sort.SliceStable(entries, func(i, j int) bool {
+			if entries[i].IsLatest != entries[j].IsLatest {
+				return entries[i].IsLatest
+			}
+			return entries[i].LastModified.After(entries[j].LastModified)
+		})
+		history[key] = entries
+	}
+	return history
+}
+
+// copySource builds the CopySource of a copy request. Objects behind an access
+// point are addressed as <access point ARN>/object/<key>.
+func copySource(bucket, key, versionID string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	if arn.IsARN(bucket) {
+		bucket += "/object"
+	}
+	source := bucket + "/" + strings.Join(segments, "/")
+	if versionID != "" {
+		source += "?versionId=" + url.QueryEscape(versionID)
+	}
+	return source
+}
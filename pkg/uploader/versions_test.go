@@ -0,0 +1,190 @@
+package uploader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestRollbackRestoresPreviousVersions(t *testing.T) {
+	now := time.Now()
+	client := &fakeClient{
+		versionOutputs: []*s3.ListObjectVersionsOutput{
+			{
+				Versions: []s3types.ObjectVersion{
+					{Key: aws.String("app/a.txt"), VersionId: aws.String("a2"), IsLatest: aws.Bool(true), LastModified: aws.Time(now)},
+					{Key: aws.String("app/a.txt"), VersionId: aws.String("a1"), IsLatest: aws.Bool(false), LastModified: aws.Time(now.Add(-time.Hour))},
+					{Key: aws.String("app/new.txt"), VersionId: aws.String("n1"), IsLatest: aws.Bool(true), LastModified: aws.Time(now)},
+				},
+			},
+		},
+	}
+	transport := NewTransport(client, &stubUploader{}, "bucket", true)
+
+	results, err := transport.Rollback(context.Background(), "app", RollbackOptions{})
+	if err != nil {
+		t.Fatalf("Rollback returned error: %v", err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if results[0].Action != RollbackRestored || results[0].ToVersion != "a1" {
+		t.Errorf("expected a.txt restored to a1, got %+v", results[0])
+	}
+	if results[1].Action != RollbackDeleted {
+		t.Errorf("expected new.txt to be deleted, got %+v", results[1])
+	}
+	if len(client.copyInputs) != 1 || aws.ToString(client.copyInputs[0].CopySource) != "bucket/app/a.txt?versionId=a1" {
+		t.Fatalf("unexpected copy requests: %+v", client.copyInputs)
+	}
+	if len(client.deleteInputs) != 1 {
+		t.Fatalf("expected 1 delete request, got %d", len(client.deleteInputs))
+	}
+}
+
+func TestRollbackRestoresDeletedObject(t *testing.T) {
+	now := time.Now()
+	client := &fakeClient{
+		versionOutputs: []*s3.ListObjectVersionsOutput{
+			{
+				Versions: []s3types.ObjectVersion{
+					{Key: aws.String("gone.txt"), VersionId: aws.String("v1"), IsLatest: aws.Bool(false), LastModified: aws.Time(now.Add(-time.Hour))},
+				},
+				DeleteMarkers: []s3types.DeleteMarkerEntry{
+					{Key: aws.String("gone.txt"), VersionId: aws.String("dm"), IsLatest: aws.Bool(true), LastModified: aws.Time(now)},
+				},
+			},
+		},
+	}
+	transport := NewTransport(client, &stubUploader{}, "bucket", true)
+
+	results, err := transport.Rollback(context.Background(), "", RollbackOptions{})
+	if err != nil {
+		t.Fatalf("Rollback returned error: %v", err)
+	}
+	if len(results) != 1 || results[0].Action != RollbackRestored || results[0].ToVersion != "v1" {
+		t.Fatalf("expected deleted object to be restored, got %+v", results)
+	}
+}
+
+func TestRollbackToManifestVersions(t *testing.T) {
+	now := time.Now()
+	client := &fakeClient{
+		versionOutputs: []*s3.ListObjectVersionsOutput{
+			{
+				Versions: []s3types.ObjectVersion{
+					{Key: aws.String("a.txt"), VersionId: aws.String("v3"), IsLatest: aws.Bool(true), LastModified: aws.Time(now)},
+					{Key: aws.String("a.txt"), VersionId: aws.String("v2"), IsLatest: aws.Bool(false), LastModified: aws.Time(now.Add(-time.Hour))},
+					{Key: aws.String("a.txt"), VersionId: aws.String("v1"), IsLatest: aws.Bool(false), LastModified: aws.Time(now.Add(-2 * time.Hour))},
+				},
+			},
+		},
+	}
+	transport := NewTransport(client, &stubUploader{}, "bucket", true)
+
+	results, err := transport.Rollback(context.Background(), "", RollbackOptions{Targets: map[string]string{"a.txt": "v1"}})
+	if err != nil {
+		t.Fatalf("Rollback returned error: %v", err)
+	}
+	if len(results) != 1 || results[0].ToVersion != "v1" {
+		t.Fatalf("expected a.txt restored to v1, got %+v", results)
+	}
+
+	client.versionCallIndex = 0
+	if _, err := transport.Rollback(context.Background(), "", RollbackOptions{Targets: map[string]string{"a.txt": "missing"}}); err == nil {
+		t.Fatal("expected error for unknown manifest version")
+	}
+}
+
+func TestRollbackSkipsKeysAlreadyRolledBack(t *testing.T) {
+	now := time.Now()
+	client := &fakeClient{
+		versionOutputs: []*s3.ListObjectVersionsOutput{
+			{
+				Versions: []s3types.ObjectVersion{
+					{Key: aws.String("a.txt"), VersionId: aws.String("a3"), IsLatest: aws.Bool(true), LastModified: aws.Time(now)},
+					{Key: aws.String("a.txt"), VersionId: aws.String("a2"), IsLatest: aws.Bool(false), LastModified: aws.Time(now.Add(-time.Hour))},
+					{Key: aws.String("a.txt"), VersionId: aws.String("a1"), IsLatest: aws.Bool(false), LastModified: aws.Time(now.Add(-2 * time.Hour))},
+					{Key: aws.String("b.txt"), VersionId: aws.String("b3"), IsLatest: aws.Bool(true), LastModified: aws.Time(now)},
+					{Key: aws.String("b.txt"), VersionId: aws.String("b2"), IsLatest: aws.Bool(false), LastModified: aws.Time(now.Add(-time.Hour))},
+					{Key: aws.String("record"), VersionId: aws.String("r1"), IsLatest: aws.Bool(true), LastModified: aws.Time(now)},
+				},
+			},
+		},
+	}
+	transport := NewTransport(client, &stubUploader{}, "bucket", true)
+
+	results, err := transport.Rollback(context.Background(), "", RollbackOptions{
+		// a.txt was rolled back from a2 and has not changed since; b.txt was
+		// uploaded again after its rollback from b1.
+		Replaced: map[string]string{"a.txt": "a2", "b.txt": "b1"},
+		Skip:     []string{"record"},
+	})
+	if err != nil {
+		t.Fatalf("Rollback returned error: %v", err)
+	}
+	if len(results) != 2 || results[0].Action != RollbackSkipped || results[1].Action != RollbackRestored || results[1].ToVersion != "b2" {
+		t.Fatalf("expected a.txt skipped and b.txt restored, got %+v", results)
+	}
+	if len(client.copyInputs) != 1 || len(client.deleteInputs) != 0 {
+		t.Errorf("expected only b.txt to be copied, got %d copies and %d deletes", len(client.copyInputs), len(client.deleteInputs))
+	}
+}
+
+func TestVersionHistoryOrdersByKeyNewestFirst(t *testing.T) {
+	now := time.Now()
+	client := &fakeClient{
+		versionOutputs: []*s3.ListObjectVersionsOutput{
+			{
+				Versions: []s3types.ObjectVersion{
+					{Key: aws.String("app/b.txt"), VersionId: aws.String("b1"), IsLatest: aws.Bool(false), LastModified: aws.Time(now.Add(-time.Hour))},
+					{Key: aws.String("app/a.txt"), VersionId: aws.String("a1"), IsLatest: aws.Bool(true), LastModified: aws.Time(now)},
+				},
+				DeleteMarkers: []s3types.DeleteMarkerEntry{
+					{Key: aws.String("app/b.txt"), VersionId: aws.String("b2"), IsLatest: aws.Bool(true), LastModified: aws.Time(now)},
+				},
+				IsTruncated:         aws.Bool(true),
+				NextKeyMarker:       aws.String("app/b.txt"),
+				NextVersionIdMarker: aws.String("b2"),
+			},
+			{
+				Versions: []s3types.ObjectVersion{
+					{Key: aws.String("app/b.txt"), VersionId: aws.String("b0"), IsLatest: aws.Bool(false), LastModified: aws.Time(now.Add(-2 * time.Hour))},
+				},
+			},
+		},
+	}
+	transport := NewTransport(client, &stubUploader{}, "bucket", true)
+
+	versions, err := transport.VersionHistory(context.Background(), "app")
+	if err != nil {
+		t.Fatalf("VersionHistory returned error: %v", err)
+	}
+
+	want := []string{"a1", "b2", "b1", "b0"}
+	if len(versions) != len(want) {
+		t.Fatalf("expected %d versions, got %d", len(want), len(versions))
+	}
+	for i, id := range want {
+		if versions[i].VersionID != id {
+			t.Errorf("version %d = %s, want %s", i, versions[i].VersionID, id)
+		}
+	}
+	if !versions[1].DeleteMarker {
+		t.Errorf("expected b2 to be reported as a delete marker")
+	}
+}
+
+func TestCopySourceAddressesAccessPointObjects(t *testing.T) {
+	accessPoint := "arn:aws:s3:eu-west-1:123456789012:accesspoint/artifacts"
+	got := copySource(accessPoint, "app/a b.txt", "v1")
+	want := accessPoint + "/object/app/a%20b.txt?versionId=v1"
+	if got != want {
+		t.Errorf("copySource = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,99 @@
+package uploader
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// visibleConcurrency bounds the HeadObject requests WaitVisible sends at once.
+const visibleConcurrency = 16
+
+// WaitVisible polls HeadObject for every uploaded object, every interval,
+// until the store shows each of them as uploaded or timeout expires, and
+// returns the keys of the objects still not visible. Caching layers of
+// S3-compatible gateways may not show new objects, or keep showing an
+// overwritten one, for a while after an upload. An object is visible once
+// HeadObject finds it with the ETag the upload returned; backends with weak
+// ETags are only checked for the object to exist. Errors other than a
+// missing object end the wait.
+func (t *Transport) WaitVisible(ctx context.Context, objects []UploadResult, interval, timeout time.Duration) ([]string, error) {
+	deadline := time.Now().Add(timeout)
+	pending := objects
+	for {
+		var err error
+		if pending, err = t.invisible(ctx, pending); err != nil || len(pending) == 0 {
+			return nil, err
+		}
+		wait := min(interval, time.Until(deadline))
+		if wait <= 0 {
+			break
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+
+	keys := make([]string, len(pending))
+	for i, object := range pending {
+		keys[i] = object.Key
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// invisible returns the objects HeadObject does not show as uploaded yet.
+func (t *Transport) invisible(ctx context.Context, objects []UploadResult) ([]UploadResult, error) {
+	var (
+		mu       sync.Mutex
+		pending  []UploadResult
+		firstErr error
+		wg       sync.WaitGroup
+		slots    = make(chan struct{}, visibleConcurrency)
+	)
+	for _, object := range objects {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			visible, err := t.visible(ctx, object)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil && firstErr == nil:
+				firstErr = err
+			case err == nil && !visible:
+				pending = append(pending, object)
+			}
+		}()
+	}
+	wg.Wait()
+	return pending, firstErr
+}
+
+func (t *Transport) visible(ctx context.Context, object UploadResult) (bool, error) {
+	head, err := t.backend.Head(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(t.bucket),
+		Key:    aws.String(object.Key),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check that %s is visible: %w", object.Key, err)
+	}
+	if object.ETag == "" || t.weakETags() {
+		return true, nil
+	}
+	return aws.ToString(head.ETag) == object.ETag, nil
+}
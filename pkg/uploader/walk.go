@@ -0,0 +1,134 @@
+package uploader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// dirWalker walks a source directory, applying the ignore rules and depth
+// limit of its policy and calling file for every remaining non-directory
+// entry. With PlanPolicy.WalkConcurrency above 1, subdirectories are handed
+// to new goroutines while fewer than that many are reading; otherwise, and
+// whenever all are busy, they are walked inline, so the number of goroutines
+// stays bounded however wide the tree is.
+type dirWalker struct {
+	root   string
+	policy PlanPolicy
+	// file plans the entry at path, rel being its slash-separated path below
+	// the root. It may be called concurrently.
+	file func(path, rel string, entry os.DirEntry) error
+
+	slots chan struct{}
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	err   error
+}
+
+// run walks the root and returns the first error encountered.
+func (w *dirWalker) run() error {
+	if w.policy.WalkConcurrency > 1 {
+		// The calling goroutine takes the first slot.
+		w.slots = make(chan struct{}, w.policy.WalkConcurrency-1)
+	}
+	scope, err := w.policy.newIgnoreScope(w.root)
+	if err != nil {
+		return err
+	}
+	if scope, err = scope.enter(".", w.root); err != nil {
+		return err
+	}
+	w.dir(w.root, ".", scope)
+	w.wg.Wait()
+	return w.err
+}
+
+// dir walks the directory at path, rel below the root, recording the first
+// error for run.
+func (w *dirWalker) dir(path, rel string, scope *ignoreScope) {
+	if err := w.walk(path, rel, scope); err != nil {
+		w.mu.Lock()
+		if w.err == nil {
+			w.err = err
+		}
+		w.mu.Unlock()
+	}
+}
+
+func (w *dirWalker) walk(path, rel string, scope *ignoreScope) error {
+	if w.failed() {
+		return nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return fmt.Errorf("failed to traverse %s: %w", path, err)
+	}
+
+	for _, entry := range entries {
+		current := filepath.Join(path, entry.Name())
+		entryRel := entry.Name()
+		if rel != "." {
+			entryRel = rel + "/" + entry.Name()
+		}
+
+		if entry.IsDir() {
+			if w.policy.MaxDepth > 0 && strings.Count(entryRel, "/")+1 >= w.policy.MaxDepth {
+				continue
+			}
+			if scope.ignored(entryRel, true) {
+				w.policy.skip(current, "ignored directory")
+				continue
+			}
+			child, err := scope.enter(entryRel, current)
+			if err != nil {
+				return err
+			}
+			if !w.spawn(current, entryRel, child) {
+				if err := w.walk(current, entryRel, child); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if slices.Contains(w.policy.IgnoreFiles, entry.Name()) {
+			continue
+		}
+		if scope.ignored(entryRel, false) {
+			w.policy.skip(current, "ignored file")
+			continue
+		}
+		if err := w.file(current, entryRel, entry); err != nil {
+			return err
+		}
+		if w.failed() {
+			return nil
+		}
+	}
+	return nil
+}
+
+// spawn walks a subdirectory in a new goroutine when a slot is free.
+func (w *dirWalker) spawn(path, rel string, scope *ignoreScope) bool {
+	select {
+	case w.slots <- struct{}{}:
+	default:
+		return false
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer func() { <-w.slots }()
+		w.dir(path, rel, scope)
+	}()
+	return true
+}
+
+func (w *dirWalker) failed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err != nil
+}